@@ -0,0 +1,306 @@
+package gocache
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"gocache/consistenthash"
+	pb "gocache/gocachepb"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WithAdminListener 开启管理接口：服务启动时在addr(与gRPC端口分开)上提供 AdminHandler 中的接口，停止时关闭。
+// 请求必须携带 "Authorization: Bearer <token>"，token 为空时拒绝所有请求。addr 为空表示不开启(默认)。
+func WithAdminListener(addr, token string) ServerOption {
+	return func(s *Server) {
+		if addr == "" {
+			s.admin = nil
+			return
+		}
+		s.admin = &httpListener{addr: addr}
+		s.adminToken = token
+	}
+}
+
+// ReloadFunc 重新加载配置并应用到运行中的节点，返回发生了变化但需要重启才能生效的设置
+type ReloadFunc func() (restartRequired []string, err error)
+
+// WithReload 设置 POST /admin/reload 调用的函数。重新读取哪些配置由使用者决定，一般在其中调用
+// Group.Resize、Group.SetDefaultTTL、SetRateLimit 等可以在运行时修改的设置，缓存的数据不受影响。没有设置时该接口返回404
+func WithReload(fn ReloadFunc) ServerOption {
+	return func(s *Server) {
+		s.reload = fn
+	}
+}
+
+// AdminAddr 返回管理接口实际监听的地址，没有开启或服务没有运行时返回空字符串
+func (s *Server) AdminAddr() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.admin.address()
+}
+
+// AdminHandler 返回需要令牌认证的管理接口，可以挂载到已有的HTTP服务上，不需要 WithAdminListener。
+// 修改数据的接口只接受POST，返回JSON：
+//
+//	POST /admin/flush?group=xxx              清空本节点上的缓存组，见 Group.Flush
+//	POST /admin/delete?group=xxx&key=yyy     从集群中所有节点删除key，见 DeleteFromCluster
+//	POST /admin/resize?group=xxx&bytes=n     修改本节点上缓存组的容量，见 Group.Resize
+//	GET  /admin/inspect?group=xxx&key=yyy    key在本节点上的元数据和归属节点
+//	GET  /admin/ring                         哈希环的快照(RingState)
+//	GET  /admin/warm                         预热的进度，见 WarmProgress
+//	GET  /admin/forecast                     各缓存组的容量预测，见 CapacityForecastHandler
+//	POST /admin/reload                       重新加载配置，见 WithReload
+//	GET  /admin/snapshot?group=xxx           下载缓存组主缓存的快照(二进制)，见 Group.Snapshot
+//	POST /admin/restore?group=xxx            从请求体中的快照恢复缓存组，见 Group.Restore，请求体的大小见 maxRestoreBytes
+//
+// 令牌以 "Authorization: Bearer <token>" 传递，token 为空时拒绝所有请求。
+func (s *Server) AdminHandler(token string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/admin/flush", s.adminFlush)
+	mux.HandleFunc("/admin/delete", s.adminDelete)
+	mux.HandleFunc("/admin/resize", s.adminResize)
+	mux.HandleFunc("/admin/inspect", s.adminInspect)
+	mux.HandleFunc("/admin/reload", s.adminReload)
+	mux.HandleFunc("/admin/snapshot", s.adminSnapshot)
+	mux.HandleFunc("/admin/restore", s.adminRestore)
+	mux.HandleFunc("/admin/ring", func(w http.ResponseWriter, r *http.Request) {
+		if allowMethod(w, r, http.MethodGet) {
+			writeJSON(w, s.RingState())
+		}
+	})
+	mux.HandleFunc("/admin/warm", func(w http.ResponseWriter, r *http.Request) {
+		if allowMethod(w, r, http.MethodGet) {
+			writeJSON(w, s.WarmProgress())
+		}
+	})
+	forecast := CapacityForecastHandler()
+	mux.HandleFunc("/admin/forecast", func(w http.ResponseWriter, r *http.Request) {
+		if allowMethod(w, r, http.MethodGet) {
+			forecast.ServeHTTP(w, r)
+		}
+	})
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if token == "" || !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="gocache"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		s.logger.Info("admin request", "self", s.self, "method", r.Method, "path", r.URL.Path, "query", r.URL.RawQuery, "remote", r.RemoteAddr)
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// ClusterDeleteResult 是 DeleteFromCluster 的结果
+type ClusterDeleteResult struct {
+	Deleted map[string]bool   `json:"deleted"`          // 删除成功的节点，值表示删除前该节点的主缓存中是否存在key
+	Errors  map[string]string `json:"errors,omitempty"` // 删除失败的节点及原因
+}
+
+// DeleteFromCluster 并发地从缓存组哈希环上的所有节点(包括本节点)删除key，各节点的主缓存和热点缓存都会删除，
+// 用于数据源中的数据被修改后立即失效。不支持写入(没有实现 PeerWriter)或请求失败的节点记录在 Errors 中，
+// 本节点上不存在该缓存组时返回错误。
+func (s *Server) DeleteFromCluster(group, key string) (ClusterDeleteResult, error) {
+	g := GetGroup(group)
+	if g == nil {
+		return ClusterDeleteResult{}, groupNotFound(group)
+	}
+	if key == "" {
+		return ClusterDeleteResult{}, errKeyRequired
+	}
+	res := ClusterDeleteResult{Deleted: map[string]bool{s.self: g.Delete(key)}, Errors: map[string]string{}}
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	for _, addr := range s.groupRing(group).Nodes() {
+		if addr == s.self {
+			continue
+		}
+		wg.Add(1)
+		go func(addr string) {
+			defer wg.Done()
+			deleted, err := s.deleteFromPeer(addr, group, key)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				res.Errors[addr] = err.Error()
+				return
+			}
+			res.Deleted[addr] = deleted
+		}(addr)
+	}
+	wg.Wait()
+	return res, nil
+}
+
+// deleteFromPeer 删除远程节点上缓存的key
+func (s *Server) deleteFromPeer(addr, group, key string) (bool, error) {
+	peer, ok := s.peerClient(addr)
+	if !ok {
+		return false, &UnknownPeerError{Addr: addr}
+	}
+	writer, ok := peer.(PeerWriter)
+	if !ok {
+		return false, fmt.Errorf("peer %s does not support delete", addr)
+	}
+	return writer.Delete(&pb.DeleteRequest{Group: group, Key: key})
+}
+
+// KeyInspection 是 /admin/inspect 返回的key的元数据
+type KeyInspection struct {
+	Group  string                   `json:"group"`
+	Key    string                   `json:"key"`
+	Owner  consistenthash.Ownership `json:"owner"`            // key在缓存组的哈希环上的归属节点
+	Cached bool                     `json:"cached"`           // 本节点的主缓存中是否存在该key
+	Size   int                      `json:"size,omitempty"`   // 缓存中存储的数据大小
+	Added  time.Time                `json:"added,omitempty"`  // 最近一次写入的时间
+	Expire time.Time                `json:"expire,omitempty"` // 过期时间，零值表示永不过期
+	Hits   int64                    `json:"hits,omitempty"`   // 命中次数，包括主缓存和热点缓存
+}
+
+func (s *Server) adminFlush(w http.ResponseWriter, r *http.Request) {
+	g, ok := adminGroup(w, r, http.MethodPost)
+	if !ok {
+		return
+	}
+	writeJSON(w, map[string]interface{}{"group": g.name, "removed": g.Flush()})
+}
+
+func (s *Server) adminDelete(w http.ResponseWriter, r *http.Request) {
+	g, ok := adminGroup(w, r, http.MethodPost)
+	if !ok {
+		return
+	}
+	key := r.URL.Query().Get("key")
+	if key == "" {
+		http.Error(w, "key is required", http.StatusBadRequest)
+		return
+	}
+	res, err := s.DeleteFromCluster(g.name, key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(res.Errors) > 0 { // 部分节点删除失败，返回结果由调用方决定是否重试
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadGateway)
+	}
+	writeJSON(w, res)
+}
+
+func (s *Server) adminResize(w http.ResponseWriter, r *http.Request) {
+	g, ok := adminGroup(w, r, http.MethodPost)
+	if !ok {
+		return
+	}
+	n, err := strconv.ParseInt(r.URL.Query().Get("bytes"), 10, 64)
+	if err != nil || n < 0 {
+		http.Error(w, "bytes must be a non-negative integer", http.StatusBadRequest)
+		return
+	}
+	g.Resize(n)
+	writeJSON(w, map[string]interface{}{"group": g.name, "capacity": n, "bytes": g.mainCache.bytes()})
+}
+
+func (s *Server) adminInspect(w http.ResponseWriter, r *http.Request) {
+	g, ok := adminGroup(w, r, http.MethodGet)
+	if !ok {
+		return
+	}
+	key := r.URL.Query().Get("key")
+	if key == "" {
+		http.Error(w, "key is required", http.StatusBadRequest)
+		return
+	}
+	out := KeyInspection{Group: g.name, Key: key, Owner: s.groupRing(g.name).Owner(key)}
+	if info, ok := g.Inspect(key); ok {
+		out.Cached, out.Size, out.Added, out.Expire, out.Hits = true, info.Size, info.Added, info.Expire, info.Hits
+	}
+	writeJSON(w, out)
+}
+
+func (s *Server) adminReload(w http.ResponseWriter, r *http.Request) {
+	if s.reload == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+	restart, err := s.reload()
+	if err != nil {
+		s.logger.Error("reload failed", "self", s.self, "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if restart == nil {
+		restart = []string{}
+	}
+	writeJSON(w, map[string]interface{}{"reloaded": true, "restart_required": restart})
+}
+
+func (s *Server) adminSnapshot(w http.ResponseWriter, r *http.Request) {
+	g, ok := adminGroup(w, r, http.MethodGet)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", g.name+".snapshot"))
+	n, err := g.Snapshot(w)
+	if err != nil { // 响应已经开始发送，只能记录日志，客户端读到的快照校验失败
+		s.logger.Error("snapshot failed", "self", s.self, "group", g.name, "entries", n, "err", err)
+	}
+}
+
+func (s *Server) adminRestore(w http.ResponseWriter, r *http.Request) {
+	g, ok := adminGroup(w, r, http.MethodPost)
+	if !ok {
+		return
+	}
+	n, err := g.Restore(http.MaxBytesReader(w, r.Body, maxRestoreBytes(g)))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, map[string]interface{}{"group": g.name, "restored": n})
+}
+
+// defaultMaxRestoreBytes 缓存组不限制容量时恢复快照的请求体上限
+const defaultMaxRestoreBytes = 1 << 30
+
+// maxRestoreBytes 返回恢复快照时请求体的上限。快照中的数据不超过缓存组的容量，再为key和元数据留出同样大小的余量
+func maxRestoreBytes(g *Group) int64 {
+	if c := g.mainCache.capacity(); c > 0 {
+		return 2*c + 1<<20
+	}
+	return defaultMaxRestoreBytes
+}
+
+// adminGroup 检查请求方法并返回 group 参数指定的缓存组，失败时写出错误响应
+func adminGroup(w http.ResponseWriter, r *http.Request, method string) (*Group, bool) {
+	if !allowMethod(w, r, method) {
+		return nil, false
+	}
+	name := r.URL.Query().Get("group")
+	g := GetGroup(name)
+	if g == nil {
+		http.Error(w, fmt.Sprintf("group %q not found", name), http.StatusNotFound)
+		return nil, false
+	}
+	return g, true
+}
+
+// allowMethod 请求方法不是method时返回405
+func allowMethod(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method != method {
+		w.Header().Set("Allow", method)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return false
+	}
+	return true
+}
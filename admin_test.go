@@ -0,0 +1,202 @@
+package gocache
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAdminAuth(t *testing.T) {
+	svr, _ := NewServer("127.0.0.1:9710")
+	for _, tc := range []struct {
+		token, header string
+		want          int
+	}{
+		{"secret", "", http.StatusUnauthorized},
+		{"secret", "Bearer wrong", http.StatusUnauthorized},
+		{"", "Bearer ", http.StatusUnauthorized},
+		{"secret", "Bearer secret", http.StatusOK},
+	} {
+		req := httptest.NewRequest("GET", "/admin/ring", nil)
+		if tc.header != "" {
+			req.Header.Set("Authorization", tc.header)
+		}
+		rec := httptest.NewRecorder()
+		svr.AdminHandler(tc.token).ServeHTTP(rec, req)
+		if rec.Code != tc.want {
+			t.Errorf("token %q header %q: status %d, want %d", tc.token, tc.header, rec.Code, tc.want)
+		}
+	}
+}
+
+func TestAdminHandler(t *testing.T) {
+	g := NewGroup("admin", 2<<10, "lru", GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}))
+	svr, _ := NewServer("127.0.0.1:9711")
+	svr.Set("127.0.0.1:9711")
+	h := svr.AdminHandler("secret")
+	do := func(method, target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	g.Set("a", []byte("value-a"), 0)
+	g.Set("b", []byte("value-b"), 0)
+	var inspect KeyInspection
+	rec := do("GET", "/admin/inspect?group=admin&key=a")
+	if err := json.Unmarshal(rec.Body.Bytes(), &inspect); err != nil {
+		t.Fatal(err)
+	}
+	if !inspect.Cached || inspect.Size != len("value-a") || inspect.Owner.Node != "127.0.0.1:9711" {
+		t.Errorf("inspect = %+v", inspect)
+	}
+
+	if rec := do("GET", "/admin/flush?group=admin"); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET flush status = %d", rec.Code)
+	}
+	if rec := do("POST", "/admin/flush?group=missing"); rec.Code != http.StatusNotFound {
+		t.Errorf("flush missing group status = %d", rec.Code)
+	}
+	if rec := do("POST", "/admin/flush?group=admin"); !strings.Contains(rec.Body.String(), `"removed": 2`) {
+		t.Errorf("flush = %s", rec.Body)
+	}
+	if _, ok := g.Inspect("a"); ok {
+		t.Error("a still cached after flush")
+	}
+
+	g.Set("c", []byte(strings.Repeat("x", 100)), 0)
+	if rec := do("POST", "/admin/resize?group=admin&bytes=-1"); rec.Code != http.StatusBadRequest {
+		t.Errorf("negative resize status = %d", rec.Code)
+	}
+	do("POST", "/admin/resize?group=admin&bytes=64")
+	if st := g.Stats(); st.Capacity != 64 || st.Bytes != 0 {
+		t.Errorf("after resize capacity %d bytes %d", st.Capacity, st.Bytes)
+	}
+
+	var warm WarmProgress
+	if rec := do("GET", "/admin/warm"); json.Unmarshal(rec.Body.Bytes(), &warm) != nil || !warm.Ready {
+		t.Errorf("warm = %d %s", rec.Code, rec.Body)
+	}
+	var forecasts []Forecast
+	if rec := do("GET", "/admin/forecast"); json.Unmarshal(rec.Body.Bytes(), &forecasts) != nil || len(forecasts) == 0 {
+		t.Errorf("forecast = %d %s", rec.Code, rec.Body)
+	}
+	if rec := do("POST", "/admin/forecast"); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST forecast status = %d", rec.Code)
+	}
+}
+
+func TestAdminSnapshot(t *testing.T) {
+	g := NewGroup("admin-snapshot", 2<<10, "lru", GetterFunc(func(key string) ([]byte, error) {
+		return nil, ErrNotFound
+	}))
+	svr, _ := NewServer("127.0.0.1:9715")
+	h := svr.AdminHandler("secret")
+	do := func(method, target string, body []byte) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, bytes.NewReader(body))
+		req.Header.Set("Authorization", "Bearer secret")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	g.Set("a", []byte("value-a"), time.Hour)
+	rec := do("GET", "/admin/snapshot?group=admin-snapshot", nil)
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/octet-stream" {
+		t.Fatalf("snapshot = %d %s", rec.Code, rec.Header())
+	}
+	snapshot := rec.Body.Bytes()
+	g.Flush()
+	if rec := do("POST", "/admin/restore?group=admin-snapshot", []byte("garbage")); rec.Code != http.StatusBadRequest {
+		t.Errorf("restore garbage status = %d", rec.Code)
+	}
+	// 请求体超过缓存组容量对应的上限时停止读取
+	big := NewGroup("admin-snapshot-big", 8<<20, "lru", GetterFunc(func(key string) ([]byte, error) {
+		return nil, ErrNotFound
+	}))
+	big.Set("big", make([]byte, 2<<20), 0)
+	var oversized bytes.Buffer
+	if _, err := big.Snapshot(&oversized); err != nil {
+		t.Fatal(err)
+	}
+	if rec := do("POST", "/admin/restore?group=admin-snapshot", oversized.Bytes()); rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "too large") {
+		t.Errorf("restore oversized body = %d %s", rec.Code, rec.Body)
+	}
+	if rec := do("POST", "/admin/restore?group=admin-snapshot", snapshot); !strings.Contains(rec.Body.String(), `"restored": 1`) {
+		t.Errorf("restore = %d %s", rec.Code, rec.Body)
+	}
+	if info, ok := g.Inspect("a"); !ok || info.Expire.IsZero() {
+		t.Errorf("a after restore = %+v %v", info, ok)
+	}
+}
+
+func TestAdminReload(t *testing.T) {
+	do := func(svr *Server, method string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/admin/reload", nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		rec := httptest.NewRecorder()
+		svr.AdminHandler("secret").ServeHTTP(rec, req)
+		return rec
+	}
+	svr, _ := NewServer("127.0.0.1:9714")
+	if rec := do(svr, "POST"); rec.Code != http.StatusNotFound {
+		t.Errorf("reload without WithReload status = %d", rec.Code)
+	}
+
+	calls := 0
+	svr, _ = NewServer("127.0.0.1:9714", WithReload(func() ([]string, error) {
+		calls++
+		if calls > 1 {
+			return nil, errors.New("bad config")
+		}
+		return []string{"tls"}, nil
+	}))
+	if rec := do(svr, "GET"); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET reload status = %d", rec.Code)
+	}
+	if rec := do(svr, "POST"); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"tls"`) {
+		t.Errorf("reload = %d %s", rec.Code, rec.Body)
+	}
+	if rec := do(svr, "POST"); rec.Code != http.StatusInternalServerError || !strings.Contains(rec.Body.String(), "bad config") {
+		t.Errorf("failed reload = %d %s", rec.Code, rec.Body)
+	}
+}
+
+func TestDeleteFromCluster(t *testing.T) {
+	g := NewGroup("admin-delete", 2<<10, "lru", GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}))
+	peer, _ := NewServer("127.0.0.1:9712")
+	peer.setServing(true)
+	addr, stop := serveGRPC(t, peer)
+	defer stop()
+	svr, _ := NewServer("127.0.0.1:9713", WithStaticPeers("127.0.0.1:9713", addr, "127.0.0.1:1"), WithRPCTimeout(time.Second))
+
+	g.Set("k", []byte("v"), 0)
+	res, err := svr.DeleteFromCluster("admin-delete", "k")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 两个节点在同一个进程中共享缓存组，本节点先删除，远程节点上已经不存在
+	if deleted, ok := res.Deleted["127.0.0.1:9713"]; !ok || !deleted {
+		t.Errorf("local result = %v", res.Deleted)
+	}
+	if deleted, ok := res.Deleted[addr]; !ok || deleted {
+		t.Errorf("peer result = %v", res.Deleted)
+	}
+	if res.Errors["127.0.0.1:1"] == "" || len(res.Errors) != 1 {
+		t.Errorf("errors = %v", res.Errors)
+	}
+	if _, err := svr.DeleteFromCluster("missing", "k"); err == nil {
+		t.Error("expected error for unknown group")
+	}
+}
@@ -0,0 +1,64 @@
+package gocache
+
+import (
+	"sort"
+	"time"
+)
+
+// ageBuckets 数据年龄直方图的桶上限，最后还有一个不设上限的桶
+var ageBuckets = [...]time.Duration{
+	time.Second, 5 * time.Second, 15 * time.Second, 30 * time.Second, time.Minute, 5 * time.Minute,
+	15 * time.Minute, 30 * time.Minute, time.Hour, 3 * time.Hour, 6 * time.Hour, 12 * time.Hour, 24 * time.Hour,
+}
+
+// ageHistogram 数据年龄(距离写入缓存的时间)的直方图，零值可以直接使用，并发安全
+type ageHistogram struct {
+	counts [len(ageBuckets) + 1]AtomicInt
+	count  AtomicInt
+	sumMs  AtomicInt // 以毫秒累计，避免纳秒累计溢出
+}
+
+// observe 记录一次年龄
+func (h *ageHistogram) observe(age time.Duration) {
+	if age < 0 {
+		age = 0
+	}
+	h.counts[sort.Search(len(ageBuckets), func(i int) bool { return age <= ageBuckets[i] })].Add(1)
+	h.count.Add(1)
+	h.sumMs.Add(age.Milliseconds())
+}
+
+// snapshot 返回当前的直方图
+func (h *ageHistogram) snapshot() Histogram {
+	out := Histogram{
+		Bounds: append([]time.Duration(nil), ageBuckets[:]...),
+		Counts: make([]int64, len(h.counts)),
+		Count:  h.count.Get(),
+		Sum:    time.Duration(h.sumMs.Get()) * time.Millisecond,
+	}
+	for i := range h.counts {
+		out.Counts[i] = h.counts[i].Get()
+	}
+	return out
+}
+
+// observeHit 记录命中的数据的年龄，added 为数据写入缓存的时间
+func (g *Group) observeHit(added time.Time) {
+	if !added.IsZero() {
+		g.counters.hitAge.observe(time.Since(added))
+	}
+}
+
+// observeEviction 记录从主缓存中移除的数据：已经过期的计入 expirations，因容量不足被淘汰的记录其年龄，
+// 被显式删除(Delete、失效、迁移)的不计入
+func (g *Group) observeEviction(value ByteView, removed bool) {
+	if removed || value.t.IsZero() {
+		return
+	}
+	now := time.Now()
+	if !value.e.IsZero() && value.e.Before(now) {
+		g.counters.expirations.Add(1)
+		return
+	}
+	g.counters.evictionAge.observe(now.Sub(value.t))
+}
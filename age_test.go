@@ -0,0 +1,35 @@
+package gocache
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAgeStats(t *testing.T) {
+	g := NewGroup("age", 64, "lru", GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}))
+	g.Set("short", []byte("v"), time.Millisecond)
+	g.Set("a", []byte("v"), 0)
+	g.GetCacheData("a")
+	g.Delete("a")
+	time.Sleep(5 * time.Millisecond)
+	g.GetCacheData("short") // 过期后被移除并重新加载
+
+	st := g.Stats()
+	if st.Expirations != 1 || st.EvictionAge.Count != 0 {
+		t.Fatalf("expirations = %d, eviction ages = %d, want 1 and 0 (deletes are not counted)", st.Expirations, st.EvictionAge.Count)
+	}
+	if st.HitAge.Count != 1 || st.HitAge.Counts[0] != 1 || len(st.HitAge.Bounds) != len(ageBuckets) {
+		t.Fatalf("hit age = %+v", st.HitAge)
+	}
+
+	// 超过容量后最早写入的数据被淘汰
+	for _, key := range []string{"k1", "k2", "k3", "k4"} {
+		g.Set(key, []byte(strings.Repeat("x", 16)), 0)
+	}
+	if st := g.Stats(); st.EvictionAge.Count == 0 || st.EvictionAge.Quantile(1) != time.Second {
+		t.Fatalf("eviction age = %+v", st.EvictionAge)
+	}
+}
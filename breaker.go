@@ -0,0 +1,157 @@
+package gocache
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// 默认的熔断参数：连续失败5次后熔断，10秒后放行一个试探请求
+const (
+	defaultBreakerThreshold = 5
+	defaultBreakerCooldown  = 10 * time.Second
+)
+
+// ErrCircuitOpen 表示远程节点连续失败后已经熔断，请求没有发送，调用方会立即回退到本地加载
+var ErrCircuitOpen = errors.New("gocache: circuit open")
+
+// BreakerState 熔断器的状态：closed -> open -> half-open -> closed 或 open
+type BreakerState int
+
+const (
+	BreakerClosed   BreakerState = iota // 正常放行请求
+	BreakerOpen                         // 已经熔断，请求立即失败
+	BreakerHalfOpen                     // 冷却结束，放行一个试探请求，成功后恢复，失败后重新熔断
+)
+
+func (st BreakerState) String() string {
+	switch st {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// MarshalText 以名称的形式序列化状态
+func (st BreakerState) MarshalText() ([]byte, error) {
+	return []byte(st.String()), nil
+}
+
+// BreakerStats 一个远程节点的熔断器统计
+type BreakerStats struct {
+	State               BreakerState `json:"state"`
+	ConsecutiveFailures int          `json:"consecutive_failures"`
+	Opens               int64        `json:"opens"`    // 熔断的次数
+	Rejected            int64        `json:"rejected"` // 熔断期间被拒绝的请求数
+}
+
+// WithCircuitBreaker 设置访问其他节点的熔断器：连续 threshold 次失败(节点不可达、超时、内部错误)后熔断，
+// 熔断期间对该节点的读取立即失败并回退到本地加载，cooldown 之后放行一个试探请求，成功则恢复。
+// 默认连续失败5次熔断、冷却10秒，threshold 小于等于0表示不熔断。
+func WithCircuitBreaker(threshold int, cooldown time.Duration) ServerOption {
+	return func(s *Server) {
+		s.breakerThreshold = threshold
+		s.breakerCooldown = cooldown
+	}
+}
+
+// BreakerStats 返回到各个节点的熔断器统计，键为节点地址
+func (s *Server) BreakerStats() map[string]BreakerStats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make(map[string]BreakerStats, len(s.clients))
+	for addr, client := range s.clients {
+		if client.breaker != nil {
+			out[addr] = client.breaker.stats(time.Now())
+		}
+	}
+	return out
+}
+
+// circuitBreaker 一个远程节点的熔断器
+type circuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	state    BreakerState
+	failures int       // 连续失败的次数
+	openedAt time.Time // 最近一次熔断的时间
+	probing  bool      // 半开状态下是否已经放行了试探请求
+	opens    int64
+	rejected int64
+}
+
+// newCircuitBreaker 创建熔断器，threshold 小于等于0时返回nil，表示不熔断
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	if threshold <= 0 {
+		return nil
+	}
+	return &circuitBreaker{threshold: threshold, cooldown: cooldown}
+}
+
+// allow 返回是否放行请求，放行的请求结束后需要调用 record
+func (b *circuitBreaker) allow(now time.Time) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == BreakerOpen && now.Sub(b.openedAt) >= b.cooldown {
+		b.state, b.probing = BreakerHalfOpen, false
+	}
+	switch {
+	case b.state == BreakerOpen, b.state == BreakerHalfOpen && b.probing:
+		b.rejected++
+		return fmt.Errorf("%w after %d consecutive failures", ErrCircuitOpen, b.failures)
+	case b.state == BreakerHalfOpen:
+		b.probing = true
+	}
+	return nil
+}
+
+// record 记录一次放行的请求的结果
+func (b *circuitBreaker) record(err error, now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !breakerFailure(err) {
+		b.state, b.failures, b.probing = BreakerClosed, 0, false
+		return
+	}
+	b.failures++
+	if b.state == BreakerHalfOpen || b.failures >= b.threshold {
+		if b.state != BreakerOpen {
+			b.opens++
+		}
+		b.state, b.openedAt, b.probing = BreakerOpen, now, false
+	}
+}
+
+// stats 返回熔断器的统计，冷却已经结束的熔断器报告为半开
+func (b *circuitBreaker) stats(now time.Time) BreakerStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	st := b.state
+	if st == BreakerOpen && now.Sub(b.openedAt) >= b.cooldown {
+		st = BreakerHalfOpen
+	}
+	return BreakerStats{State: st, ConsecutiveFailures: b.failures, Opens: b.opens, Rejected: b.rejected}
+}
+
+// breakerFailure 返回err是否说明远程节点有故障。key不存在、请求错误、限流等是节点正常处理请求的结果，不计入失败。
+func breakerFailure(err error) bool {
+	if err == nil || errors.Is(err, ErrNotFound) {
+		return false
+	}
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.Internal, codes.Unknown:
+		return true
+	}
+	return false
+}
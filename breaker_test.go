@@ -0,0 +1,93 @@
+package gocache
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	pb "gocache/gocachepb"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	svr, _ := NewServer("127.0.0.1:9713", WithCircuitBreaker(3, 50*time.Millisecond))
+	svr.Set("127.0.0.1:9714")
+	client := svr.clients["127.0.0.1:9714"]
+	calls := 0
+	var fail error = status.Error(codes.Unavailable, "connection refused")
+	client.fetch = func(in *pb.Request) (*pb.Response, error) {
+		calls++
+		if fail != nil {
+			return nil, fail
+		}
+		return &pb.Response{Value: []byte("v"), Found: true, ProtocolVersion: protocolVersion}, nil
+	}
+	get := func() error {
+		return client.Get(&pb.Request{Group: "breaker", Key: "k"}, &pb.Response{})
+	}
+
+	// key不存在不是节点故障
+	fail = ErrNotFound
+	for i := 0; i < 5; i++ {
+		get()
+	}
+	if st := svr.BreakerStats()["127.0.0.1:9714"]; st.State != BreakerClosed {
+		t.Fatalf("breaker %v after not-found responses, want closed", st.State)
+	}
+
+	fail = status.Error(codes.Unavailable, "connection refused")
+	for i := 0; i < 3; i++ {
+		get()
+	}
+	calls = 0
+	if err := get(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("Get on open breaker = %v, want ErrCircuitOpen", err)
+	}
+	if calls != 0 {
+		t.Fatal("request was sent while the breaker was open")
+	}
+	st := svr.BreakerStats()["127.0.0.1:9714"]
+	if st.State != BreakerOpen || st.Opens != 1 || st.Rejected != 1 || st.ConsecutiveFailures != 3 {
+		t.Fatalf("stats = %+v, want open once with one rejection", st)
+	}
+
+	// 冷却后试探失败，重新熔断
+	time.Sleep(60 * time.Millisecond)
+	if st := svr.BreakerStats()["127.0.0.1:9714"]; st.State != BreakerHalfOpen {
+		t.Fatalf("breaker %v after cooldown, want half-open", st.State)
+	}
+	if err := get(); errors.Is(err, ErrCircuitOpen) || calls != 1 {
+		t.Fatalf("probe was not sent: err=%v calls=%d", err, calls)
+	}
+	if err := get(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("Get after failed probe = %v, want ErrCircuitOpen", err)
+	}
+
+	// 冷却后试探成功，恢复
+	time.Sleep(60 * time.Millisecond)
+	fail = nil
+	if err := get(); err != nil {
+		t.Fatal(err)
+	}
+	if st := svr.BreakerStats()["127.0.0.1:9714"]; st.State != BreakerClosed || st.Opens != 2 {
+		t.Fatalf("stats = %+v, want closed after 2 opens", st)
+	}
+}
+
+func TestHalfOpenSingleProbe(t *testing.T) {
+	b := newCircuitBreaker(1, time.Second)
+	now := time.Now()
+	b.record(status.Error(codes.Unavailable, ""), now)
+	now = now.Add(time.Second)
+	if err := b.allow(now); err != nil {
+		t.Fatalf("first request after cooldown rejected: %v", err)
+	}
+	if err := b.allow(now); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatal("second concurrent request was allowed while probing")
+	}
+	if newCircuitBreaker(0, time.Second) != nil {
+		t.Fatal("threshold 0 should disable the breaker")
+	}
+}
@@ -0,0 +1,167 @@
+package gocache
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// MemoryBudget 是多个缓存组共享的内存预算。每个缓存组的容量(见 NewGroup 和 Resize)各自独立，
+// 多个缓存组的容量之和可能超过进程可用的内存；加入同一个 MemoryBudget 的缓存组写入数据后，
+// 如果这些缓存组的主缓存和热点缓存占用的字节数之和超过预算，就从按优先级折算后占用最多的缓存组中淘汰数据，
+// 直到回到预算以内。优先级为p的缓存组在竞争中最终占用的内存大约与p成正比，空闲缓存组的份额可以被其他缓存组使用。
+// 先淘汰该缓存组热点缓存中的副本，再按淘汰策略淘汰主缓存中的数据。
+type MemoryBudget struct {
+	limit     AtomicInt
+	members   atomic.Pointer[[]budgetMember] // 写时复制，读取时不加锁
+	mu        sync.Mutex                     // 串行化成员的增删和淘汰
+	reclaimed AtomicInt                      // 因超出预算被淘汰的字节数
+}
+
+type budgetMember struct {
+	group    *Group
+	priority int64
+}
+
+// NewMemoryBudget 创建一个预算为limit字节的 MemoryBudget，0表示不限制
+func NewMemoryBudget(limit int64) *MemoryBudget {
+	b := &MemoryBudget{}
+	b.limit.Set(limit)
+	b.members.Store(&[]budgetMember{})
+	return b
+}
+
+// WithMemoryBudget 把缓存组加入内存预算b，priority 是缓存组在竞争内存时的权重，小于1时为1。
+// 缓存组自己的容量仍然有效，设置为0表示只受预算限制
+func WithMemoryBudget(b *MemoryBudget, priority int) GroupOption {
+	return func(g *Group) {
+		if b == nil {
+			g.budget, g.budgetPriority = nil, 0
+			return
+		}
+		if priority < 1 {
+			priority = 1
+		}
+		g.budget = b
+		g.budgetPriority = priority
+		b.register(g, int64(priority))
+	}
+}
+
+// MemoryBudget 返回缓存组所在的内存预算，没有加入时返回nil
+func (g *Group) MemoryBudget() *MemoryBudget {
+	return g.budget
+}
+
+// register 加入缓存组，替换同名的旧缓存组
+func (b *MemoryBudget) register(g *Group, priority int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	old := *b.members.Load()
+	members := make([]budgetMember, 0, len(old)+1)
+	for _, m := range old {
+		if m.group.name != g.name {
+			members = append(members, m)
+		}
+	}
+	members = append(members, budgetMember{group: g, priority: priority})
+	b.members.Store(&members)
+}
+
+// Limit 返回预算的字节数，0表示不限制
+func (b *MemoryBudget) Limit() int64 {
+	return b.limit.Get()
+}
+
+// SetLimit 在运行时修改预算，新的预算小于已占用的内存时立即淘汰数据
+func (b *MemoryBudget) SetLimit(limit int64) {
+	b.limit.Set(limit)
+	b.enforce()
+}
+
+// Used 返回所有成员的主缓存和热点缓存占用的字节数之和
+func (b *MemoryBudget) Used() int64 {
+	var used int64
+	for _, m := range *b.members.Load() {
+		used += m.group.cachedBytes()
+	}
+	return used
+}
+
+// MemoryBudgetStats 内存预算的统计
+type MemoryBudgetStats struct {
+	Limit     int64                    `json:"limit"`
+	Used      int64                    `json:"used"`
+	Reclaimed int64                    `json:"reclaimed"` // 因超出预算被淘汰的累计字节数
+	Groups    []MemoryBudgetGroupStats `json:"groups"`    // 按缓存组名排序
+}
+
+// MemoryBudgetGroupStats 一个成员的统计
+type MemoryBudgetGroupStats struct {
+	Name     string `json:"name"`
+	Priority int    `json:"priority"`
+	Bytes    int64  `json:"bytes"` // 主缓存和热点缓存占用的字节数
+}
+
+// Stats 返回预算和每个成员的占用
+func (b *MemoryBudget) Stats() MemoryBudgetStats {
+	st := MemoryBudgetStats{Limit: b.Limit(), Reclaimed: b.reclaimed.Get()}
+	for _, m := range *b.members.Load() {
+		n := m.group.cachedBytes()
+		st.Used += n
+		st.Groups = append(st.Groups, MemoryBudgetGroupStats{Name: m.group.name, Priority: int(m.priority), Bytes: n})
+	}
+	sort.Slice(st.Groups, func(i, j int) bool { return st.Groups[i].Name < st.Groups[j].Name })
+	return st
+}
+
+// enforce 超出预算时淘汰数据，在缓存组写入数据之后调用，调用时不能持有缓存的锁。b 为nil时什么也不做
+func (b *MemoryBudget) enforce() {
+	if b == nil {
+		return
+	}
+	limit := b.limit.Get()
+	if limit <= 0 || b.Used() <= limit {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	members := *b.members.Load()
+	usage := make([]int64, len(members))
+	for {
+		var used int64
+		for i, m := range members {
+			usage[i] = m.group.cachedBytes()
+			used += usage[i]
+		}
+		limit := b.limit.Get()
+		excess := used - limit
+		if limit <= 0 || excess <= 0 {
+			return
+		}
+		// 按优先级折算后占用最多的成员，即 usage[i]/priority 最大
+		victim := -1
+		for i, m := range members {
+			if usage[i] > 0 && (victim < 0 || usage[i]*members[victim].priority > usage[victim]*m.priority) {
+				victim = i
+			}
+		}
+		if victim < 0 {
+			return
+		}
+		g := members[victim].group
+		freed := g.hotCache.evict(excess)
+		if freed < excess {
+			freed += g.mainCache.evict(excess - freed)
+		}
+		if freed <= 0 {
+			return
+		}
+		b.reclaimed.Add(freed)
+	}
+}
+
+// cachedBytes 返回主缓存和热点缓存占用的字节数
+func (g *Group) cachedBytes() int64 {
+	return g.mainCache.bytes() + g.hotCache.bytes()
+}
@@ -0,0 +1,59 @@
+package gocache
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestMemoryBudget(t *testing.T) {
+	getter := GetterFunc(func(key string) ([]byte, error) { return []byte(key), nil })
+	b := NewMemoryBudget(4000)
+	low := NewGroup("budget-low", 0, "lru", getter, WithMemoryBudget(b, 1))
+	high := NewGroup("budget-high", 0, "lfu", getter, WithMemoryBudget(b, 3))
+	value := make([]byte, 90)
+	for i := 0; i < 200; i++ {
+		low.Set(fmt.Sprintf("key-%03d", i), value, 0)
+		high.Set(fmt.Sprintf("key-%03d", i), value, 0)
+		if used := b.Used(); used > b.Limit() {
+			t.Fatalf("used %d exceeds limit %d", used, b.Limit())
+		}
+	}
+	st := b.Stats()
+	if len(st.Groups) != 2 || st.Reclaimed == 0 || st.Used > 4000 || st.Used < 3800 {
+		t.Fatalf("unexpected stats %+v", st)
+	}
+	// 竞争之后占用的内存与优先级成正比
+	lowBytes, highBytes := st.Groups[1].Bytes, st.Groups[0].Bytes
+	if ratio := float64(highBytes) / float64(lowBytes); ratio < 2.5 || ratio > 3.5 {
+		t.Fatalf("expect high/low about 3, got %d/%d", highBytes, lowBytes)
+	}
+	// 最近写入的数据保留，最旧的数据被淘汰
+	if _, ok := low.mainCache.peek("key-199"); !ok {
+		t.Fatal("newest key evicted")
+	}
+	if _, ok := low.mainCache.peek("key-000"); ok {
+		t.Fatal("oldest key not evicted")
+	}
+	if c := high.Config(); c.MemoryPriority != 3 {
+		t.Fatalf("memory priority = %d", c.MemoryPriority)
+	}
+
+	// 降低预算后立即淘汰
+	b.SetLimit(1000)
+	if used := b.Used(); used > 1000 {
+		t.Fatalf("used %d after SetLimit", used)
+	}
+	// 同名的缓存组替换旧的成员
+	NewGroup("budget-low", 0, "lru", getter, WithMemoryBudget(b, 1))
+	if st := b.Stats(); len(st.Groups) != 2 || st.Used != high.cachedBytes() {
+		t.Fatalf("unexpected stats after re-creating group %+v", st)
+	}
+	// 0表示不限制
+	b.SetLimit(0)
+	for i := 0; i < 50; i++ {
+		high.Set(fmt.Sprintf("more-%d", i), value, 0)
+	}
+	if used := b.Used(); used <= 1000 {
+		t.Fatalf("used %d without limit", used)
+	}
+}
@@ -1,11 +1,17 @@
 package gocache
 
-import "time"
+import (
+	"bytes"
+	"io"
+	"time"
+)
 
 // A ByteView holds an immutable view of bytes.  这是一个只读的数据结构
 type ByteView struct {
 	b []byte
 	e time.Time
+	t time.Time // 写入缓存的时间，由缓存在写入时设置，用于统计数据的年龄
+	s *slab     // b 所在的slab，nil表示b是单独分配的，见 WithSlabAllocator
 }
 
 // Len returns the view's length
@@ -27,6 +33,33 @@ func (v ByteView) String() string {
 	return string(v.b)
 }
 
+// UnsafeBytes 返回缓存中的数据本身而不复制，用于数据较大或者对延迟敏感、可以信任的调用者。
+// 调用者必须保证：不修改返回的切片，也不把它交给可能修改它的代码(例如 append 之后写入、作为 Read 的缓冲区)，
+// 修改会直接破坏缓存中以及其他调用者读到的数据。可以在读取之后继续持有：数据被淘汰后内存由GC回收，
+// 开启 WithSlabAllocator 时slab中的内存也不会被复用。不能保证上述约束时使用 ByteSlice、Copy 或 WriteTo
+func (v ByteView) UnsafeBytes() []byte {
+	return v.b
+}
+
+// Copy 把数据复制到dst中，返回复制的字节数，调用者可以复用dst避免每次读取都分配内存
+func (v ByteView) Copy(dst []byte) int {
+	return copy(dst, v.b)
+}
+
+// WriteTo 把数据写入w而不复制，实现了 io.WriterTo，例如直接写入 http.ResponseWriter
+func (v ByteView) WriteTo(w io.Writer) (int64, error) {
+	n, err := w.Write(v.b)
+	if err == nil && n != len(v.b) {
+		err = io.ErrShortWrite
+	}
+	return int64(n), err
+}
+
+// Reader 返回读取数据的 io.ReadSeeker，不复制数据
+func (v ByteView) Reader() io.ReadSeeker {
+	return bytes.NewReader(v.b)
+}
+
 func cloneBytes(b []byte) []byte {
 	c := make([]byte, len(b))
 	copy(c, b)
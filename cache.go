@@ -4,19 +4,43 @@ import (
 	"gocache/lfu"
 	"gocache/lru"
 	"sync"
+	"time"
+	"unsafe"
 )
 
-// BaseCache 是一个接口，定义了基本的缓存操作方法。它包含了两个方法：add 和 get，用于向缓存中添加数据和从缓存中获取数据。
+// BaseCache 是一个接口，定义了基本的缓存操作方法。add 和 get 用于向缓存中添加数据和从缓存中获取数据，
+// peek 读取数据但不影响淘汰顺序，stat 返回数据写入的时间和命中次数，remove 用于删除数据，keys 按热度从高到低枚举缓存中的key，
+// rangeKeys 不加缓存的锁、按不确定的顺序逐个枚举key(见 readPath.rangeKeys)，适合抽样或者不需要顺序的统计，
+// scanKeys 按字典序分页返回一个索引分片中的key(见 readPath.scanKeys)，
+// bytes 返回已占用的容量，capacity 返回最大容量(0表示不限制)，resize 修改最大容量并立即淘汰超出的数据，
+// evict 按淘汰策略移除数据直到释放至少n字节或者缓存为空，返回实际释放的字节数，memory 返回实际占用内存的估计。
 type BaseCache interface {
 	add(key string, value ByteView)
 	get(key string) (value ByteView, ok bool)
+	peek(key string) (value ByteView, ok bool)
+	stat(key string) (added time.Time, hits int64, ok bool)
+	remove(key string)
+	keys() []string
+	rangeKeys(fn func(key string) bool)
+	scanKeys(shard int, after string, n int) []string
+	bytes() int64
+	capacity() int64
+	resize(cacheBytes int64)
+	evict(n int64) int64
+	memory() cacheMemory
 }
 
-// LRUcache 对lru算法的封装,加锁实现并发缓存
+// LRUcache 对lru算法的封装,加锁实现并发缓存，读取不加锁，见 readPath
 type LRUcache struct {
 	mu         sync.RWMutex
 	lru        *lru.LRUCache
-	cacheBytes int64 // 最大内存容量
+	cacheBytes int64                                          // 最大内存容量
+	onEvicted  func(key string, value ByteView, removed bool) // 数据被淘汰或删除时的回调，removed 表示被显式删除，可以为nil
+	removing   bool                                           // 正在执行 remove，由 c.mu 保护
+	alloc      *slabAllocator                                 // 把数据复制到slab中，nil表示不使用，见 WithSlabAllocator
+	reads      readPath                                       // 不加锁的读路径
+	watermarks *watermarks                                    // 淘汰水位，见 WithEvictionWatermarks
+	dataBytes  int64                                          // key和value实际占用的内存，见 dataSize，由 c.mu 保护
 }
 
 // add 用于向缓存中添加数据
@@ -27,30 +51,212 @@ func (c *LRUcache) add(key string, value ByteView) {
 		延迟初始化，一个对象的创建会延迟到第一次使用该对象时，可以减少开销，提高性能
 	*/
 	if c.lru == nil {
-		c.lru = lru.New(c.cacheBytes, nil)
+		c.lru = lru.New(c.cacheBytes, c.evicted)
+		c.lru.OnReplaced = c.replaced
+		c.lru.SetLowWatermark(c.watermarks.lowWatermark(c.cacheBytes))
 	}
+	c.reads.flush(c)
+	value.t = time.Now()
+	value = c.alloc.hold(value)
+	c.reads.store(key, value) // 先写入索引，数据被立即淘汰时由回调删除
+	c.dataBytes += dataSize(key, value)
 	c.lru.Add(key, value, value.Expire())
+	if c.watermarks.above(c.lru.Bytes(), c.cacheBytes) {
+		c.watermarks.wake(c)
+	}
 }
 
-// get 用于从缓存中获取数据
+// evicted 将底层 lru 的淘汰回调转换为 onEvicted，调用时持有 c.mu
+func (c *LRUcache) evicted(key string, value lru.Value) {
+	c.reads.delete(key)
+	c.dataBytes -= dataSize(key, value.(ByteView))
+	if c.onEvicted != nil {
+		c.onEvicted(key, value.(ByteView), c.removing)
+	}
+	c.alloc.drop(value.(ByteView))
+}
+
+// replaced 在数据被同一个key的新数据覆盖后释放旧数据占用的slab，调用时持有 c.mu
+func (c *LRUcache) replaced(key string, old lru.Value) {
+	c.dataBytes -= dataSize(key, old.(ByteView)) // add 已经重新计算了key
+	c.alloc.drop(old.(ByteView))
+}
+
+// get 用于从缓存中获取数据，不获取缓存的锁，见 readPath
 func (c *LRUcache) get(key string) (value ByteView, ok bool) {
+	it := c.reads.load(key)
+	if it == nil {
+		return
+	}
+	if it.expired() {
+		c.removeExpired(key)
+		return
+	}
+	c.reads.hit(it, c)
+	return it.value, true
+}
+
+// removeExpired 移除过期的数据，由底层的 Get 检查过期并触发淘汰回调
+func (c *LRUcache) removeExpired(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.lru != nil {
+		c.lru.Get(key)
+	}
+}
+
+// tryPromote 实现了 promoter
+func (c *LRUcache) tryPromote(items []*cacheItem) bool {
+	if !c.mu.TryLock() {
+		return false
+	}
+	c.touchLocked(items)
+	c.mu.Unlock()
+	return true
+}
+
+// touchLocked 实现了 promoter
+func (c *LRUcache) touchLocked(items []*cacheItem) {
+	for _, it := range items {
+		it.queued.Store(0) // 多次访问与一次相同，移到链表头部
+		c.lru.Touch(it.key)
+	}
+}
+
+// peek 用于读取数据，不更新访问顺序
+func (c *LRUcache) peek(key string) (value ByteView, ok bool) {
+	it := c.reads.load(key)
+	if it == nil || it.expired() {
+		return
+	}
+	return it.value, true
+}
+
+// stat 用于读取数据写入的时间和命中次数
+func (c *LRUcache) stat(key string) (added time.Time, hits int64, ok bool) {
+	it := c.reads.load(key)
+	if it == nil {
+		return
+	}
+	return it.value.t, it.hits.Load(), true
+}
+
+// remove 用于从缓存中删除数据
+func (c *LRUcache) remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.lru != nil {
+		c.removing = true
+		c.lru.Remove(key)
+		c.removing = false
+	}
+}
+
+// bytes 返回已占用的容量
+func (c *LRUcache) bytes() int64 {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 	if c.lru == nil {
-		return
+		return 0
 	}
+	return c.lru.Bytes()
+}
 
-	if v, ok := c.lru.Get(key); ok {
-		return v.(ByteView), ok
+// capacity 返回最大容量
+func (c *LRUcache) capacity() int64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.cacheBytes
+}
+
+// resize 修改最大容量
+func (c *LRUcache) resize(cacheBytes int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cacheBytes = cacheBytes
+	if c.lru != nil {
+		c.reads.flush(c)
+		c.lru.SetLowWatermark(c.watermarks.lowWatermark(cacheBytes))
+		c.lru.Resize(cacheBytes)
+	}
+}
+
+// evictBatch 后台淘汰一批数据，见 watermarks
+func (c *LRUcache) evictBatch() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.lru == nil || c.cacheBytes == 0 {
+		return false
+	}
+	c.reads.flush(c)
+	target := c.watermarks.target(c.cacheBytes)
+	for i := 0; i < evictBatchSize && c.lru.Bytes() > target; i++ {
+		c.lru.RemoveOldest()
+	}
+	return c.lru.Bytes() > target
+}
+
+// evict 淘汰数据直到释放至少n字节
+func (c *LRUcache) evict(n int64) int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.lru == nil {
+		return 0
 	}
-	return
+	c.reads.flush(c)
+	before := c.lru.Bytes()
+	for before-c.lru.Bytes() < n && c.lru.Len() > 0 {
+		c.lru.RemoveOldest()
+	}
+	return before - c.lru.Bytes()
+}
+
+// memory 返回占用内存的估计
+func (c *LRUcache) memory() cacheMemory {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	m := cacheMemory{total: int64(unsafe.Sizeof(*c))}
+	if c.lru == nil {
+		return m
+	}
+	m.entries, m.data = int64(c.lru.Len()), c.lru.Bytes()
+	m.total += c.dataBytes + c.lru.Overhead() + m.entries*entryOverhead
+	return m
+}
+
+// keys 返回缓存中所有的key
+func (c *LRUcache) keys() []string {
+	c.mu.Lock() // 先补记尚未处理的访问，keys 按热度排列
+	defer c.mu.Unlock()
+	if c.lru == nil {
+		return nil
+	}
+	c.reads.flush(c)
+	return c.lru.Keys()
+}
+
+// rangeKeys 见 readPath.rangeKeys
+func (c *LRUcache) rangeKeys(fn func(key string) bool) {
+	c.reads.rangeKeys(fn)
+}
+
+// scanKeys 见 readPath.scanKeys
+func (c *LRUcache) scanKeys(shard int, after string, n int) []string {
+	return c.reads.scanKeys(shard, after, n)
 }
 
-// LFUcache 对lfu算法的封装,加锁实现并发缓存
+// LFUcache 对lfu算法的封装,加锁实现并发缓存，读取不加锁，见 readPath
 type LFUcache struct {
 	mu         sync.RWMutex
 	lfu        *lfu.LFUCache
-	cacheBytes int64 // 最大内存容量
+	cacheBytes int64                                          // 最大内存容量
+	onEvicted  func(key string, value ByteView, removed bool) // 数据被淘汰或删除时的回调，removed 表示被显式删除，可以为nil
+	removing   bool                                           // 正在执行 remove，由 c.mu 保护
+	alloc      *slabAllocator                                 // 把数据复制到slab中，nil表示不使用，见 WithSlabAllocator
+	tieBreak   lfu.TieBreak                                   // 访问频率相同时的淘汰顺序
+	reads      readPath                                       // 不加锁的读路径
+	watermarks *watermarks                                    // 淘汰水位，见 WithEvictionWatermarks
+	dataBytes  int64                                          // key和value实际占用的内存，见 dataSize，由 c.mu 保护
 }
 
 // add 用于向缓存中添加数据
@@ -61,21 +267,198 @@ func (c *LFUcache) add(key string, value ByteView) {
 		延迟初始化，一个对象的创建会延迟到第一次使用该对象时，可以减少开销，提高性能
 	*/
 	if c.lfu == nil {
-		c.lfu = lfu.New(c.cacheBytes, nil)
+		c.lfu = lfu.New(c.cacheBytes, c.evicted)
+		c.lfu.SetTieBreak(c.tieBreak)
+		c.lfu.OnReplaced = c.replaced
+		c.lfu.SetLowWatermark(c.watermarks.lowWatermark(c.cacheBytes))
 	}
+	c.reads.flush(c)
+	value.t = time.Now()
+	value = c.alloc.hold(value)
+	c.reads.store(key, value) // 先写入索引，数据被立即淘汰时由回调删除
+	c.dataBytes += dataSize(key, value)
 	c.lfu.Add(key, value, value.Expire())
+	if c.watermarks.above(c.lfu.Bytes(), c.cacheBytes) {
+		c.watermarks.wake(c)
+	}
 }
 
-// get 用于从缓存中获取数据
+// evicted 将底层 lfu 的淘汰回调转换为 onEvicted，调用时持有 c.mu
+func (c *LFUcache) evicted(key string, value lfu.Value) {
+	c.reads.delete(key)
+	c.dataBytes -= dataSize(key, value.(ByteView))
+	if c.onEvicted != nil {
+		c.onEvicted(key, value.(ByteView), c.removing)
+	}
+	c.alloc.drop(value.(ByteView))
+}
+
+// replaced 在数据被同一个key的新数据覆盖后释放旧数据占用的slab，调用时持有 c.mu
+func (c *LFUcache) replaced(key string, old lfu.Value) {
+	c.dataBytes -= dataSize(key, old.(ByteView)) // add 已经重新计算了key
+	c.alloc.drop(old.(ByteView))
+}
+
+// get 用于从缓存中获取数据，不获取缓存的锁，见 readPath
 func (c *LFUcache) get(key string) (value ByteView, ok bool) {
+	it := c.reads.load(key)
+	if it == nil {
+		return
+	}
+	if it.expired() {
+		c.removeExpired(key)
+		return
+	}
+	c.reads.hit(it, c)
+	return it.value, true
+}
+
+// removeExpired 移除过期的数据，由底层的 Get 检查过期并触发淘汰回调
+func (c *LFUcache) removeExpired(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.lfu != nil {
+		c.lfu.Get(key)
+	}
+}
+
+// tryPromote 实现了 promoter
+func (c *LFUcache) tryPromote(items []*cacheItem) bool {
+	if !c.mu.TryLock() {
+		return false
+	}
+	c.touchLocked(items)
+	c.mu.Unlock()
+	return true
+}
+
+// touchLocked 实现了 promoter
+func (c *LFUcache) touchLocked(items []*cacheItem) {
+	for _, it := range items {
+		if n := it.queued.Swap(0); n > 0 {
+			c.lfu.Touch(it.key, int(n))
+		}
+	}
+}
+
+// peek 用于读取数据，不增加访问频率
+func (c *LFUcache) peek(key string) (value ByteView, ok bool) {
+	it := c.reads.load(key)
+	if it == nil || it.expired() {
+		return
+	}
+	return it.value, true
+}
+
+// stat 用于读取数据写入的时间和命中次数
+func (c *LFUcache) stat(key string) (added time.Time, hits int64, ok bool) {
+	it := c.reads.load(key)
+	if it == nil {
+		return
+	}
+	return it.value.t, it.hits.Load(), true
+}
+
+// remove 用于从缓存中删除数据
+func (c *LFUcache) remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.lfu != nil {
+		c.removing = true
+		c.lfu.Remove(key)
+		c.removing = false
+	}
+}
+
+// bytes 返回已占用的容量
+func (c *LFUcache) bytes() int64 {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 	if c.lfu == nil {
-		return
+		return 0
 	}
+	return c.lfu.Bytes()
+}
 
-	if v, ok := c.lfu.Get(key); ok {
-		return v.(ByteView), ok
+// capacity 返回最大容量
+func (c *LFUcache) capacity() int64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.cacheBytes
+}
+
+// resize 修改最大容量
+func (c *LFUcache) resize(cacheBytes int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cacheBytes = cacheBytes
+	if c.lfu != nil {
+		c.reads.flush(c)
+		c.lfu.SetLowWatermark(c.watermarks.lowWatermark(cacheBytes))
+		c.lfu.Resize(cacheBytes)
+	}
+}
+
+// evictBatch 后台淘汰一批数据，见 watermarks
+func (c *LFUcache) evictBatch() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.lfu == nil || c.cacheBytes == 0 {
+		return false
+	}
+	c.reads.flush(c)
+	target := c.watermarks.target(c.cacheBytes)
+	for i := 0; i < evictBatchSize && c.lfu.Bytes() > target; i++ {
+		c.lfu.RemoveOldest()
+	}
+	return c.lfu.Bytes() > target
+}
+
+// evict 淘汰数据直到释放至少n字节
+func (c *LFUcache) evict(n int64) int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.lfu == nil {
+		return 0
 	}
-	return
+	c.reads.flush(c)
+	before := c.lfu.Bytes()
+	for before-c.lfu.Bytes() < n && c.lfu.Len() > 0 {
+		c.lfu.RemoveOldest()
+	}
+	return before - c.lfu.Bytes()
+}
+
+// memory 返回占用内存的估计
+func (c *LFUcache) memory() cacheMemory {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	m := cacheMemory{total: int64(unsafe.Sizeof(*c))}
+	if c.lfu == nil {
+		return m
+	}
+	m.entries, m.data = int64(c.lfu.Len()), c.lfu.Bytes()
+	m.total += c.dataBytes + c.lfu.Overhead() + m.entries*entryOverhead
+	return m
+}
+
+// keys 返回缓存中所有的key
+func (c *LFUcache) keys() []string {
+	c.mu.Lock() // 先补记尚未处理的访问，keys 按热度排列
+	defer c.mu.Unlock()
+	if c.lfu == nil {
+		return nil
+	}
+	c.reads.flush(c)
+	return c.lfu.Keys()
+}
+
+// rangeKeys 见 readPath.rangeKeys
+func (c *LFUcache) rangeKeys(fn func(key string) bool) {
+	c.reads.rangeKeys(fn)
+}
+
+// scanKeys 见 readPath.scanKeys
+func (c *LFUcache) scanKeys(shard int, after string, n int) []string {
+	return c.reads.scanKeys(shard, after, n)
 }
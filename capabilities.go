@@ -0,0 +1,147 @@
+package gocache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	pb "gocache/gocachepb"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/status"
+)
+
+// Capability 节点支持的可选功能，节点之间通过 Hello 交换，只使用双方都支持的功能
+type Capability string
+
+const (
+	CapRawValue  Capability = "raw_value" // v2协议：Get 的响应直接携带数据
+	CapWrite     Capability = "write"     // Put、Delete
+	CapBatchGet  Capability = "batch_get" // BatchGet
+	CapStream    Capability = "stream"    // GetStream
+	CapSubscribe Capability = "subscribe" // Subscribe
+	CapStats     Capability = "stats"     // Stats
+	CapLease     Capability = "lease"     // Lease
+
+	capCompressionPrefix = "compression:" // 后面跟压缩算法的名称，见 CapCompression
+)
+
+// CapCompression 返回表示支持名为name的压缩算法的功能
+func CapCompression(name string) Capability {
+	return Capability(capCompressionPrefix + name)
+}
+
+// capsTTL 协商结果的有效期，过期后重新交换，使滚动升级之后的节点能够用上新功能
+const capsTTL = time.Minute
+
+// knownCompressors 需要检查是否已经注册的压缩算法，gRPC没有提供枚举已注册算法的方法
+var knownCompressors = []string{"gzip", "snappy", "zstd"}
+
+// ErrNotSupported 表示远程节点不支持请求的功能，通常是集群中还有未升级的旧版本节点
+var ErrNotSupported = errors.New("gocache: not supported by peer")
+
+// Capabilities 一个节点的协议版本和支持的功能
+type Capabilities struct {
+	Node            string
+	ProtocolVersion int32
+	Features        []Capability
+}
+
+// Has 返回节点是否支持功能f
+func (c Capabilities) Has(f Capability) bool {
+	for _, have := range c.Features {
+		if have == f {
+			return true
+		}
+	}
+	return false
+}
+
+// localCapabilities 返回本进程支持的功能
+func localCapabilities(node string) Capabilities {
+	caps := Capabilities{
+		Node:            node,
+		ProtocolVersion: protocolVersion,
+		Features:        []Capability{CapRawValue, CapWrite, CapBatchGet, CapStream, CapSubscribe, CapStats, CapLease},
+	}
+	for _, name := range knownCompressors {
+		if encoding.GetCompressor(name) != nil {
+			caps.Features = append(caps.Features, CapCompression(name))
+		}
+	}
+	return caps
+}
+
+// toHello 转换为在网络上传输的 Hello 消息
+func (c Capabilities) toHello() *pb.Hello {
+	h := &pb.Hello{Node: c.Node, ProtocolVersion: c.ProtocolVersion}
+	for _, f := range c.Features {
+		h.Capabilities = append(h.Capabilities, string(f))
+	}
+	return h
+}
+
+// capabilitiesFromHello 从 Hello 消息还原 Capabilities
+func capabilitiesFromHello(h *pb.Hello) Capabilities {
+	c := Capabilities{Node: h.Node, ProtocolVersion: h.ProtocolVersion}
+	for _, f := range h.Capabilities {
+		c.Features = append(c.Features, Capability(f))
+	}
+	return c
+}
+
+// Hello 实现了 Hello RPC，记录请求方的版本并返回本节点支持的功能
+func (s *Server) Hello(ctx context.Context, in *pb.Hello) (*pb.Hello, error) {
+	s.logger.Info("hello from peer", "self", s.self, "peer", in.Node, "protocol", in.ProtocolVersion, "capabilities", strings.Join(in.Capabilities, ","))
+	return localCapabilities(s.self).toHello(), nil
+}
+
+// peerCaps 缓存的协商结果
+type peerCaps struct {
+	caps    Capabilities
+	expires time.Time
+}
+
+// Capabilities 返回远程节点的协议版本和支持的功能，结果缓存 capsTTL。
+// 旧版本的节点没有 Hello 方法，视为只支持v1协议、没有任何可选功能。
+func (c *Client) Capabilities() (Capabilities, error) {
+	c.capsMu.Lock()
+	defer c.capsMu.Unlock()
+	if c.caps != nil && time.Now().Before(c.caps.expires) {
+		return c.caps.caps, nil
+	}
+	var caps Capabilities
+	err := c.call(func(ctx context.Context, grpcClient pb.GroupCacheClient) error {
+		resp, err := grpcClient.Hello(ctx, localCapabilities(c.self).toHello())
+		if status.Code(err) == codes.Unimplemented {
+			caps = Capabilities{ProtocolVersion: 1}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		caps = capabilitiesFromHello(resp)
+		return nil
+	})
+	if err != nil {
+		return Capabilities{}, err
+	}
+	c.caps = &peerCaps{caps: caps, expires: time.Now().Add(capsTTL)}
+	return caps, nil
+}
+
+// supports 返回远程节点是否支持功能f。无法完成协商时(例如节点暂时不可达)乐观地认为支持，由实际的调用报告错误。
+func (c *Client) supports(f Capability) bool {
+	caps, err := c.Capabilities()
+	return err != nil || caps.Has(f)
+}
+
+// require 远程节点不支持功能f时返回 ErrNotSupported
+func (c *Client) require(f Capability) error {
+	if !c.supports(f) {
+		return fmt.Errorf("%w: %s does not support %s", ErrNotSupported, c.baseURL, f)
+	}
+	return nil
+}
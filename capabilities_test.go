@@ -0,0 +1,62 @@
+package gocache
+
+import (
+	"context"
+	"errors"
+	pb "gocache/gocachepb"
+	"net"
+	"testing"
+
+	"google.golang.org/grpc"
+)
+
+// legacyServer 模拟只实现了 Get 的旧版本节点
+type legacyServer struct {
+	pb.UnimplementedGroupCacheServer
+	svr *Server
+}
+
+func (l *legacyServer) Get(ctx context.Context, in *pb.Request) (*pb.Response, error) {
+	return l.svr.Get(ctx, in)
+}
+
+func TestCapabilities(t *testing.T) {
+	NewGroup("caps", 2<<10, "lru", GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}))
+	svr, _ := NewServer("127.0.0.1:9811")
+	addr, stop := serveGRPC(t, svr)
+	defer stop()
+	client := directClient(addr)
+	caps, err := client.Capabilities()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if caps.Node != svr.self || caps.ProtocolVersion != protocolVersion || !caps.Has(CapBatchGet) || !caps.Has(CapCompression("gzip")) {
+		t.Fatalf("unexpected capabilities %+v", caps)
+	}
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gs := grpc.NewServer()
+	pb.RegisterGroupCacheServer(gs, &legacyServer{svr: svr})
+	go gs.Serve(lis)
+	defer gs.Stop()
+
+	old := directClient(lis.Addr().String())
+	if caps, err := old.Capabilities(); err != nil || caps.ProtocolVersion != 1 || len(caps.Features) != 0 {
+		t.Fatalf("old node should fall back to v1 without features, got %+v %v", caps, err)
+	}
+	values, err := old.BatchGet(&pb.BatchGetRequest{Group: "caps", Keys: []string{"a", "b"}})
+	if err != nil || len(values) != 2 || string(values[1].Value) != "b" || !values[1].Found {
+		t.Fatalf("BatchGet should fall back to Get, got %v %v", values, err)
+	}
+	if err := old.Put(&pb.PutRequest{Group: "caps", Key: "a", Value: []byte("x")}); !errors.Is(err, ErrNotSupported) {
+		t.Fatalf("expect ErrNotSupported, got %v", err)
+	}
+	if err := old.Watch("caps", "a"); !errors.Is(err, ErrNotSupported) {
+		t.Fatalf("expect ErrNotSupported, got %v", err)
+	}
+}
@@ -5,59 +5,293 @@ import (
 	"fmt"
 	clientv3 "go.etcd.io/etcd/client/v3"
 	pb "gocache/gocachepb"
+	"gocache/logging"
 	"gocache/registry"
+	"gocache/singleflight"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/proto"
+	"sync"
 	"time"
 )
 
 // Client 实现gocache访问其他远程节点获取缓存的能力
 type Client struct {
-	baseURL string // 服务名称 gocache/ip:addr
+	baseURL string // 服务名称 <namespace>/ip:addr
+
+	// flights 合并同一时刻对同一个(group, key)的请求，只向远程节点发送一次，响应广播给所有调用者。
+	// 每个 Client 对应一个远程节点，因此合并的范围是(peer, group, key)；被合并的请求数见 PeerMetrics.Coalesced
+	flights singleflight.Group
+	// fetch 实际发送请求的函数，默认为 c.fetchRemote，测试时可以替换
+	fetch func(in *pb.Request) (*pb.Response, error)
+	// maxValueSize 接收数据的大小上限，0表示不限制
+	maxValueSize int64
+	// connect 建立到远程节点的连接，返回连接和关闭连接的函数，默认为 c.etcdConnect，测试时可以替换
+	connect func() (*grpc.ClientConn, func(), error)
+
+	connMu      sync.Mutex       // 保护以下字段
+	pool        []pooledConn     // 到远程节点的长连接，创建客户端时确定大小，见 dial
+	next        int              // 下一个请求使用的连接
+	idleTimeout time.Duration    // 连接空闲多久后关闭，0表示不关闭
+	idleTimer   *time.Timer      // 空闲连接的关闭定时器
+	closed      bool             // 已经调用了 Close，正在使用的连接在最后一个请求结束后关闭
+	etcdCli     *clientv3.Client // 连接池共享的etcd客户端，没有连接时关闭
+	etcdRefs    int              // 使用 etcdCli 的连接数
+	etcdConfig  clientv3.Config  // 连接etcd的配置，由 Server 创建的客户端与 Server 相同，见 WithEtcdConfig
+
+	keepalive keepalive.ClientParameters // 连接的keepalive参数，见 WithClientKeepalive
+
+	retry   RetryPolicy // 读取失败时的重试策略，见 WithRetryPolicy
+	retries AtomicInt   // 重试的次数
+
+	breaker *circuitBreaker // 熔断器，nil表示不熔断，见 WithCircuitBreaker
+	timeout time.Duration   // 请求没有携带截止时间时一次RPC的超时时间，0表示不限制，见 WithRPCTimeout
+	metrics clientMetrics   // 读取统计，见 Metrics
+
+	watchMu sync.Mutex   // 保护 watch
+	watch   *watchStream // 到远程节点的失效通知订阅，nil表示还没有订阅，见 Watch
+
+	self   string     // 本节点的地址，在 Hello 中告知远程节点，空字符串表示不是由缓存节点创建的客户端
+	capsMu sync.Mutex // 保护 caps
+	caps   *peerCaps  // 与远程节点协商的结果，nil表示还没有协商，见 Capabilities
+
+	creds credentials.TransportCredentials // 连接远程节点使用的传输凭据，nil表示明文传输，见 WithTLS
+
+	logger Logger // 见 SetLogger
 }
 
-var (
-	//这个变量通常用于创建etcd客户端的配置，当你不需要定制化的配置时，可以直接使用 defaultEtcdConfig 这个预定义的配置。
-	defaultEtcdConfig = clientv3.Config{
-		Endpoints:   []string{"localhost:2379"}, // etcd服务器的地址，这里使用本地地址和默认端口
-		DialTimeout: 5 * time.Second,            // 建立连接的超时时间为5秒
+// defaultRPCTimeout 请求没有携带截止时间时一次RPC的默认超时时间
+const defaultRPCTimeout = 10 * time.Second
+
+// WithRPCTimeout 设置访问其他节点时一次RPC的超时时间，默认10秒，0表示不限制。
+// 调用方的上下文带有截止时间时(见 Group.GetContext 和 WithPeerTimeout)以调用方的截止时间为准。
+func WithRPCTimeout(d time.Duration) ServerOption {
+	return func(s *Server) {
+		s.rpcTimeout = d
 	}
-)
+}
 
 // Get 方法允许 Client 结构体实例向远程节点发送请求，获取缓存数据，并将响应解码为 pb.Response 结构体。
+// 并发的相同(group, key)请求会被合并为一次远程调用。远程节点已经熔断时立即返回 ErrCircuitOpen。
 func (c *Client) Get(in *pb.Request, out *pb.Response) error {
-	cli, err := clientv3.New(defaultEtcdConfig) // 创建一个etcd客户端
+	return c.get(context.Background(), in, out, false)
+}
+
+// getShared 与 Get 相同，但合并的调用者共享同一份 out.Value 而不各自复制，调用者保证不修改它。
+// 缓存组把响应中的数据直接放入只读的 ByteView，见 requestPeer。
+// ctx 结束时不再等待重试，合并的请求按实际发起请求的调用者的ctx处理
+func (c *Client) getShared(ctx context.Context, in *pb.Request, out *pb.Response) error {
+	return c.get(ctx, in, out, true)
+}
+
+func (c *Client) get(ctx context.Context, in *pb.Request, out *pb.Response, shareValue bool) error {
+	fetch := c.fetch
+	if fetch == nil {
+		fetch = func(in *pb.Request) (*pb.Response, error) {
+			return c.fetchRemote(ctx, in)
+		}
+	}
+	var sent bool
+	v, err, shared := c.flights.Do(in.GetGroup()+"\x00"+in.GetKey(), func() (interface{}, error) {
+		sent = true
+		start := time.Now()
+		resp, err := c.fetchWithBreaker(fetch, in)
+		c.metrics.observe(time.Since(start), proto.Size(in), len(resp.GetValue()), err)
+		if err != nil {
+			return nil, err
+		}
+		// 数据与其余字段分开，合并其余字段时不会复制数据
+		r := flightResponse{resp: resp, value: resp.Value}
+		resp.Value = nil
+		return r, nil
+	})
+	if !sent {
+		c.metrics.coalesced()
+	}
 	if err != nil {
 		return err
 	}
-	defer cli.Close()
+	r := v.(flightResponse)
+	proto.Reset(out)
+	proto.Merge(out, r.resp)
+	out.Value = r.value
+	switch {
+	case !shared:
+		putResponse(r.resp) // 只有当前调用者持有响应(flights 不保留已完成的结果)，放回池中
+	case !shareValue && r.value != nil:
+		out.Value = cloneBytes(r.value) // 响应被多个调用者共享，复制一份给当前调用者，避免互相修改
+	}
+	return nil
+}
+
+// flightResponse 是合并的请求共享的响应，Value 单独保存在 value 中
+type flightResponse struct {
+	resp  *pb.Response
+	value []byte
+}
+
+// fetchWithBreaker 在熔断器允许时调用fetch，并记录结果
+func (c *Client) fetchWithBreaker(fetch func(in *pb.Request) (*pb.Response, error), in *pb.Request) (*pb.Response, error) {
+	if c.breaker == nil {
+		return fetch(in)
+	}
+	if err := c.breaker.allow(time.Now()); err != nil {
+		return nil, err
+	}
+	resp, err := fetch(in)
+	c.breaker.record(err, time.Now())
+	return resp, err
+}
 
-	//使用etcd客户端发现指定服务（g.baseURL）并建立连接（conn）。如果发现服务或建立连接失败，则返回错误。
-	conn, err := registry.EtcdDial(cli, c.baseURL)
+// fetchRemote 向远程节点发送请求，暂时性的失败按重试策略重试，见 RetryPolicy
+func (c *Client) fetchRemote(ctx context.Context, in *pb.Request) (*pb.Response, error) {
+	var response *pb.Response
+	err := c.withRetry(ctx, in.GetDeadline(), func() error {
+		return c.callWithDeadline(in.GetDeadline(), func(ctx context.Context, grpcClient pb.GroupCacheClient) (err error) {
+			req := getRequest()
+			defer putRequest(req)
+			proto.Merge(req, in)
+			req.ProtocolVersion = protocolVersion
+			response, err = grpcClient.Get(outgoingTrace(ctx, req), req)
+			if tooLarge(err) { // 超过单条消息的大小限制，交给 fetchStream 分段读取
+				return err
+			}
+			if err != nil {
+				return fmt.Errorf("reading response body:%w", fromStatus(err))
+			}
+			return nil
+		})
+	})
+	if tooLarge(err) && c.supports(CapStream) {
+		return c.fetchStream(in)
+	}
 	if err != nil {
+		return nil, err
+	}
+	return decodeResponse(response)
+}
+
+// Put 向远程节点写入数据，本节点的同名缓存组开启了压缩、数据达到阈值并且远程节点支持该算法时压缩请求，见 WithCompression
+func (c *Client) Put(in *pb.PutRequest) error {
+	if err := c.require(CapWrite); err != nil {
 		return err
 	}
-	defer conn.Close()
+	var opts []grpc.CallOption
+	if g := GetGroup(in.Group); g != nil {
+		if name := g.compressor(len(in.Value)); name != "" && c.supports(CapCompression(name)) {
+			opts = append(opts, grpc.UseCompressor(name))
+		}
+	}
+	return c.call(func(ctx context.Context, grpcClient pb.GroupCacheClient) error {
+		_, err := grpcClient.Put(ctx, in, opts...)
+		return err
+	})
+}
 
-	//创建一个 gRPC 客户端，用于向远程对等节点发送请求
-	grpcClient := pb.NewGroupCacheClient(conn)
+// Delete 删除远程节点上缓存的key，deleted 表示删除前该节点的主缓存中是否存在该key
+func (c *Client) Delete(in *pb.DeleteRequest) (deleted bool, err error) {
+	if err := c.require(CapWrite); err != nil {
+		return false, err
+	}
+	err = c.call(func(ctx context.Context, grpcClient pb.GroupCacheClient) error {
+		resp, err := grpcClient.Delete(ctx, in)
+		deleted = resp.GetDeleted()
+		return err
+	})
+	return deleted, err
+}
 
-	//创建一个带有10秒超时时间的上下文，并使用该上下文发送 gRPC 请求到远程节点
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-	response, err := grpcClient.Get(ctx, in)
+// BatchGet 一次从远程节点读取多个key，返回的响应与请求的key一一对应。远程节点不支持 BatchGet 时逐个读取。
+func (c *Client) BatchGet(in *pb.BatchGetRequest) ([]*pb.Response, error) {
+	if !c.supports(CapBatchGet) {
+		values := make([]*pb.Response, len(in.Keys))
+		for i, key := range in.Keys {
+			values[i] = &pb.Response{}
+			if err := c.Get(&pb.Request{Group: in.Group, Key: key}, values[i]); err != nil {
+				values[i].Error = err.Error()
+			}
+		}
+		return values, nil
+	}
+	var values []*pb.Response
+	err := c.call(func(ctx context.Context, grpcClient pb.GroupCacheClient) error {
+		resp, err := grpcClient.BatchGet(ctx, in)
+		values = resp.GetValues()
+		return err
+	})
+	return values, err
+}
+
+// call 连接远程节点，在超时时间内执行一次RPC
+func (c *Client) call(fn func(ctx context.Context, grpcClient pb.GroupCacheClient) error) error {
+	return c.callWithDeadline(0, fn)
+}
+
+// callWithDeadline 与 call 相同，deadline(UnixNano)不为0时以调用方的截止时间代替客户端的超时时间
+func (c *Client) callWithDeadline(deadline int64, fn func(ctx context.Context, grpcClient pb.GroupCacheClient) error) error {
+	conn, release, err := c.dial()
 	if err != nil {
-		return fmt.Errorf("reading response body:%v", err)
+		return err
 	}
-	if err = proto.Unmarshal(response.GetValue(), out); err != nil {
-		return fmt.Errorf("decoding response body:%v", err)
+	defer release()
+
+	//创建一个带有超时时间的上下文，并使用该上下文发送 gRPC 请求到远程节点
+	ctx, cancel := c.rpcContext(deadline)
+	defer cancel()
+	return fn(ctx, pb.NewGroupCacheClient(conn))
+}
+
+// rpcContext 返回发送一次RPC使用的上下文：请求携带截止时间时沿用该截止时间，否则使用客户端的超时时间
+func (c *Client) rpcContext(deadline int64) (context.Context, context.CancelFunc) {
+	if deadline != 0 {
+		return context.WithDeadline(context.Background(), time.Unix(0, deadline))
 	}
-	return nil
+	if c.timeout > 0 {
+		return context.WithTimeout(context.Background(), c.timeout)
+	}
+	return context.WithCancel(context.Background())
+}
+
+// tooLarge 返回err是否是超过消息大小限制的错误，远程节点因限流或过载拒绝请求时同样使用 codes.ResourceExhausted，见 IsOverloaded
+func tooLarge(err error) bool {
+	return status.Code(err) == codes.ResourceExhausted && !IsOverloaded(err)
+}
+
+// decodeResponse 按响应的协议版本还原 Response，兼容只支持v1的旧节点
+func decodeResponse(response *pb.Response) (*pb.Response, error) {
+	if response.GetProtocolVersion() >= protocolVersion {
+		return response, nil
+	}
+	out := &pb.Response{}
+	if err := proto.Unmarshal(response.GetValue(), out); err != nil {
+		return nil, fmt.Errorf("decoding response body:%v", err)
+	}
+	out.Found = true // v1 没有不存在的概念，key不存在时返回的是错误
+	return out, nil
 }
 
 // NewClient 创建一个远程节点客户端
 func NewClient(service string) *Client {
-	return &Client{baseURL: service}
+	c := &Client{
+		baseURL:     service,
+		pool:        make([]pooledConn, 1),
+		idleTimeout: defaultIdleTimeout,
+		keepalive:   defaultClientKeepalive,
+		retry:       DefaultRetryPolicy,
+		timeout:     defaultRPCTimeout,
+		breaker:     newCircuitBreaker(defaultBreakerThreshold, defaultBreakerCooldown),
+		etcdConfig:  registry.DefaultEtcdConfig(),
+		logger:      logging.Nop,
+	}
+	c.connect = c.etcdConnect
+	return c
 }
 
-// 测试 Client 是否实现了 PeerGetter 接口
+// 测试 Client 是否实现了 PeerGetter、PeerWriter、PeerLeaser 和 PeerWatcher 接口
 var _ PeerGetter = (*Client)(nil)
+var _ PeerWriter = (*Client)(nil)
+var _ PeerLeaser = (*Client)(nil)
+var _ PeerWatcher = (*Client)(nil)
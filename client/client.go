@@ -0,0 +1,418 @@
+// Package client 为不属于哈希环的应用提供访问gocache集群的轻量客户端。
+// 客户端通过etcd发现集群中的节点，在本地计算key的归属节点，直接向归属节点发送 Get、Set、Delete，
+// 不需要在应用中嵌入完整的 gocache.Server。
+//
+//	c, err := client.New(client.WithEtcdEndpoints("localhost:2379"))
+//	if err != nil { ... }
+//	defer c.Close()
+//	value, err := c.Get(ctx, "scores", "Tom")
+//
+// 客户端的哈希环必须与集群中的节点一致：节点应当把etcd中注册的节点作为自己的哈希环，
+// 并且使用相同的哈希函数和虚拟节点倍数(见 WithHash、WithReplicas)。节点的权重(见 gocache.WithWeight)
+// 从注册时携带的元数据中读取，与节点相同。
+// 开启了 gocache.WithTransforms 的缓存组返回的是变换后的数据，轻量客户端不会还原。
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"gocache/consistenthash"
+	pb "gocache/gocachepb"
+	"gocache/registry"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	defaultService  = "gocache"           // 节点在etcd中注册的服务名称
+	envNamespace    = "GOCACHE_NAMESPACE" // 与 gocache.EnvNamespace 相同
+	defaultReplicas = 50                  // 与 gocache.Server 默认的虚拟节点倍数相同
+	defaultTimeout  = time.Second         // 调用方的上下文没有截止时间时一次请求的超时时间
+	protocolVersion = 2                   // 请求使用的协议版本，响应直接携带数据
+	discoverTimeout = 10 * time.Second    // 等待第一次发现节点的超时时间
+)
+
+var (
+	// ErrNotFound 表示key不存在
+	ErrNotFound = errors.New("gocache: not found")
+	// ErrNoNodes 表示还没有发现任何节点
+	ErrNoNodes = errors.New("gocache: no nodes available")
+)
+
+// Option 用于配置 Client 的可选参数
+type Option func(*Client)
+
+// WithEtcdConfig 设置连接etcd的完整配置(地址、认证、TLS、超时)，默认读取环境变量，见 registry.EtcdConfigFromEnv
+func WithEtcdConfig(cfg clientv3.Config) Option {
+	return func(c *Client) {
+		c.etcdConfig = &cfg
+	}
+}
+
+// WithEtcdEndpoints 设置etcd的地址，默认为 localhost:2379 或环境变量 GOCACHE_ETCD_ENDPOINTS
+func WithEtcdEndpoints(endpoints ...string) Option {
+	return func(c *Client) {
+		c.etcdEndpoints = endpoints
+	}
+}
+
+// WithEtcdClient 使用已有的etcd客户端发现节点，Close 不会关闭它
+func WithEtcdClient(cli *clientv3.Client) Option {
+	return func(c *Client) {
+		c.etcd = cli
+	}
+}
+
+// WithStaticNodes 使用固定的节点列表代替etcd发现，节点地址的格式为 host:port
+func WithStaticNodes(addrs ...string) Option {
+	return func(c *Client) {
+		c.static = append([]string{}, addrs...) // 不传参数时也不使用etcd
+	}
+}
+
+// WithService 设置节点在etcd中注册的服务名称，即节点的命名空间(见 gocache.WithNamespace)，默认为 gocache 或环境变量 GOCACHE_NAMESPACE
+func WithService(service string) Option {
+	return func(c *Client) {
+		c.service = service
+	}
+}
+
+// WithHash 设置哈希环使用的哈希函数，必须与集群中的节点相同(见 gocache.WithHash)，默认为 CRC32
+func WithHash(fn consistenthash.Hash64) Option {
+	return func(c *Client) {
+		c.hash = fn
+	}
+}
+
+// WithReplicas 设置哈希环的虚拟节点倍数，必须与集群中的节点相同，默认为50
+func WithReplicas(n int) Option {
+	return func(c *Client) {
+		c.replicas = n
+	}
+}
+
+// WithTimeout 设置调用方的上下文没有截止时间时一次请求的超时时间，默认1秒
+func WithTimeout(d time.Duration) Option {
+	return func(c *Client) {
+		c.timeout = d
+	}
+}
+
+// WithRegistry 通过指定的注册中心发现节点，例如 registry.ConsulRegistry，代替默认的etcd
+func WithRegistry(r registry.Registry) Option {
+	return func(c *Client) {
+		c.registry = r
+	}
+}
+
+// WithDialOptions 设置连接节点的gRPC参数，例如使用 grpc.WithTransportCredentials 连接开启了TLS的集群
+func WithDialOptions(opts ...grpc.DialOption) Option {
+	return func(c *Client) {
+		c.dialOpts = append(c.dialOpts, opts...)
+	}
+}
+
+// Client 访问gocache集群的轻量客户端，可以被并发使用
+type Client struct {
+	service       string
+	etcdEndpoints []string
+	etcdConfig    *clientv3.Config
+	static        []string
+	hash          consistenthash.Hash64
+	replicas      int
+	timeout       time.Duration
+	dialOpts      []grpc.DialOption
+
+	etcd     *clientv3.Client  // 发现节点使用的etcd客户端，nil表示使用固定的节点列表
+	ownsEtcd bool              // etcd 是否由客户端创建，需要在 Close 时关闭
+	registry registry.Registry // 发现节点使用的注册中心，nil表示使用etcd
+	cancel   context.CancelFunc
+	done     chan struct{} // 发现节点的goroutine退出时关闭
+
+	mu    sync.RWMutex
+	ring  *consistenthash.Map
+	conns map[string]*grpc.ClientConn // 到各个节点的连接，按需建立
+}
+
+// New 创建客户端。使用etcd发现节点时，等到第一次取得节点列表后才返回，之后在后台跟踪节点的加入和退出。
+func New(opts ...Option) (*Client, error) {
+	c := &Client{
+		service:  defaultService,
+		replicas: defaultReplicas,
+		timeout:  defaultTimeout,
+		conns:    map[string]*grpc.ClientConn{},
+	}
+	if ns := os.Getenv(envNamespace); ns != "" {
+		c.service = ns
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.ring = consistenthash.NewWithHash64(c.replicas, c.hash)
+	if c.static != nil {
+		c.ring.Add(c.static...)
+		return c, nil
+	}
+	if c.etcd == nil && c.registry == nil {
+		cfg, err := c.etcdClientConfig()
+		if err != nil {
+			return nil, err
+		}
+		cli, err := clientv3.New(cfg)
+		if err != nil {
+			return nil, err
+		}
+		c.etcd, c.ownsEtcd = cli, true
+	}
+	if err := c.discover(); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// etcdClientConfig 返回连接etcd的配置：WithEtcdConfig 或者环境变量，再由 WithEtcdEndpoints 覆盖地址
+func (c *Client) etcdClientConfig() (clientv3.Config, error) {
+	var cfg clientv3.Config
+	if c.etcdConfig != nil {
+		cfg = *c.etcdConfig
+	} else {
+		var err error
+		if cfg, err = registry.EtcdConfigFromEnv(os.Getenv); err != nil {
+			return cfg, err
+		}
+	}
+	if len(c.etcdEndpoints) > 0 {
+		cfg.Endpoints = c.etcdEndpoints
+	}
+	return cfg, nil
+}
+
+// discover 在后台监听注册中心(默认为etcd中 <service>/ 下的节点记录)，等到第一次读取全部节点后返回
+func (c *Client) discover() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	c.cancel = cancel
+	synced := make(chan struct{})
+	var once sync.Once
+	c.done = make(chan struct{})
+	var lookup func(ctx context.Context, service, addr string) (json.RawMessage, error)
+	if mr, ok := c.registry.(registry.MetadataResolver); ok {
+		lookup = mr.Metadata
+	} else if c.registry == nil {
+		lookup = func(ctx context.Context, service, addr string) (json.RawMessage, error) {
+			return registry.LookupMetadata(ctx, c.etcd, service, addr)
+		}
+	}
+	go func() {
+		defer close(c.done)
+		fn := func(added, removed []string) {
+			if lookup != nil {
+				c.loadWeights(ctx, lookup, added)
+			}
+			c.apply(added, removed)
+			once.Do(func() { close(synced) })
+		}
+		if c.registry != nil {
+			c.registry.Watch(ctx, c.service, fn)
+		} else {
+			registry.WatchNodes(ctx, c.etcd, c.service, fn)
+		}
+	}()
+	select {
+	case <-synced:
+		return nil
+	case <-time.After(discoverTimeout):
+		return fmt.Errorf("gocache: discover %s: timeout", c.service)
+	}
+}
+
+// nodeMetadata 是节点注册时携带的元数据(gocache.NodeMetadata)中客户端需要的部分
+type nodeMetadata struct {
+	Weight int `json:"weight,omitempty"`
+}
+
+// loadWeights 从注册中心读取新加入的节点的元数据，按其中的权重设置节点在哈希环上的权重，
+// 在节点加入哈希环之前调用，避免按默认权重短暂地计算出与节点不同的归属。读取失败的节点使用默认的权重
+func (c *Client) loadWeights(ctx context.Context, lookup func(ctx context.Context, service, addr string) (json.RawMessage, error), addrs []string) {
+	for _, addr := range addrs {
+		raw, err := lookup(ctx, c.service, addr)
+		if err != nil || raw == nil {
+			continue
+		}
+		var md nodeMetadata
+		if json.Unmarshal(raw, &md) == nil {
+			c.ring.SetWeight(addr, md.Weight)
+		}
+	}
+}
+
+// apply 根据节点的加入和退出更新哈希环，并关闭到已经退出的节点的连接
+func (c *Client) apply(added, removed []string) {
+	if len(added) > 0 {
+		c.ring.Add(added...)
+	}
+	if len(removed) > 0 {
+		c.ring.Remove(removed...)
+		c.mu.Lock()
+		for _, addr := range removed {
+			if conn := c.conns[addr]; conn != nil {
+				conn.Close()
+				delete(c.conns, addr)
+			}
+		}
+		c.mu.Unlock()
+	}
+}
+
+// Nodes 返回当前已知的节点，按地址排序
+func (c *Client) Nodes() []string {
+	return c.ring.Nodes()
+}
+
+// Owner 返回key的归属节点，还没有发现任何节点时返回空字符串
+func (c *Client) Owner(key string) string {
+	return c.ring.Get(key)
+}
+
+// Info 描述一次读取的数据在归属节点上的来源
+type Info struct {
+	Node   string    // 响应的节点
+	Source string    // 数据在该节点上的来源，取值见 gocache.Source，例如 main_cache、local_load
+	Added  time.Time // 数据写入该节点缓存的时间
+	Expire time.Time // 过期时间，零值表示永不过期
+}
+
+// Cached 返回数据是否命中了节点的缓存(主缓存或热点缓存)，而不是刚刚加载的
+func (i Info) Cached() bool {
+	return i.Source == "main_cache" || i.Source == "hot_cache"
+}
+
+// Get 从key的归属节点读取数据，key不存在时返回 ErrNotFound。数据不在缓存中时由归属节点从数据源加载。
+func (c *Client) Get(ctx context.Context, group, key string) ([]byte, error) {
+	value, _, err := c.GetWithInfo(ctx, group, key)
+	return value, err
+}
+
+// GetWithInfo 与 Get 相同，同时返回数据的来源，用于统计命中率和排查路由
+func (c *Client) GetWithInfo(ctx context.Context, group, key string) ([]byte, Info, error) {
+	var (
+		value []byte
+		info  Info
+	)
+	err := c.call(ctx, key, func(ctx context.Context, gc pb.GroupCacheClient) error {
+		req := &pb.Request{Group: group, Key: key, ProtocolVersion: protocolVersion}
+		if deadline, ok := ctx.Deadline(); ok {
+			req.Deadline = deadline.UnixNano()
+		}
+		resp, err := gc.Get(ctx, req)
+		if err != nil {
+			return err
+		}
+		info.Node, info.Source = resp.Node, resp.Source
+		if !resp.Found {
+			return ErrNotFound
+		}
+		value = resp.Value
+		if resp.Added != 0 {
+			info.Added = time.Unix(0, resp.Added)
+		}
+		if resp.ExpiresAt != 0 {
+			info.Expire = time.Unix(0, resp.ExpiresAt)
+		}
+		return nil
+	})
+	return value, info, err
+}
+
+// Set 向key的归属节点写入数据，ttl 为0时使用缓存组的默认过期时间
+func (c *Client) Set(ctx context.Context, group, key string, value []byte, ttl time.Duration) error {
+	return c.call(ctx, key, func(ctx context.Context, gc pb.GroupCacheClient) error {
+		_, err := gc.Put(ctx, &pb.PutRequest{Group: group, Key: key, Value: value, Ttl: int64(ttl)})
+		return err
+	})
+}
+
+// Delete 删除归属节点上缓存的key，deleted 表示删除前该节点的主缓存中是否存在该key。
+// 其他节点热点缓存中的副本由归属节点的失效通知清理。
+func (c *Client) Delete(ctx context.Context, group, key string) (deleted bool, err error) {
+	err = c.call(ctx, key, func(ctx context.Context, gc pb.GroupCacheClient) error {
+		resp, err := gc.Delete(ctx, &pb.DeleteRequest{Group: group, Key: key})
+		deleted = resp.GetDeleted()
+		return err
+	})
+	return deleted, err
+}
+
+// call 向key的归属节点发送一次请求，调用方的上下文没有截止时间时使用客户端的超时时间
+func (c *Client) call(ctx context.Context, key string, fn func(ctx context.Context, gc pb.GroupCacheClient) error) error {
+	addr := c.Owner(key)
+	if addr == "" {
+		return ErrNoNodes
+	}
+	conn, err := c.conn(addr)
+	if err != nil {
+		return err
+	}
+	if _, ok := ctx.Deadline(); !ok && c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+	err = fn(ctx, pb.NewGroupCacheClient(conn))
+	if st, ok := status.FromError(err); ok && st.Code() == codes.NotFound && strings.Contains(st.Message(), ErrNotFound.Error()) {
+		return fmt.Errorf("%w: %s", ErrNotFound, st.Message())
+	}
+	return err
+}
+
+// conn 返回到节点addr的连接，第一次使用时建立
+func (c *Client) conn(addr string) (*grpc.ClientConn, error) {
+	c.mu.RLock()
+	conn := c.conns[addr]
+	c.mu.RUnlock()
+	if conn != nil {
+		return conn, nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if conn := c.conns[addr]; conn != nil {
+		return conn, nil
+	}
+	opts := append([]grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}, c.dialOpts...)
+	conn, err := grpc.Dial(addr, opts...)
+	if err != nil {
+		return nil, err
+	}
+	c.conns[addr] = conn
+	return conn, nil
+}
+
+// Close 停止发现节点并关闭所有连接
+func (c *Client) Close() error {
+	if c.cancel != nil {
+		c.cancel()
+	}
+	if c.ownsEtcd {
+		c.etcd.Close()
+	}
+	if c.done != nil {
+		<-c.done
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for addr, conn := range c.conns {
+		conn.Close()
+		delete(c.conns, addr)
+	}
+	return nil
+}
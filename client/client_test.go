@@ -0,0 +1,148 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	"gocache"
+	"gocache/consistenthash"
+	pb "gocache/gocachepb"
+
+	"google.golang.org/grpc"
+)
+
+// serveNode 在随机端口上启动一个缓存节点，返回地址和停止函数
+func serveNode(t *testing.T) (string, func()) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	svr, err := gocache.NewServer(lis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	gs := grpc.NewServer()
+	pb.RegisterGroupCacheServer(gs, svr)
+	go gs.Serve(lis)
+	return lis.Addr().String(), gs.Stop
+}
+
+func TestClient(t *testing.T) {
+	gocache.NewGroup("sdk", 2<<10, "lru", gocache.GetterFunc(func(key string) ([]byte, error) {
+		if key == "missing" {
+			return nil, gocache.ErrNotFound
+		}
+		return []byte("loaded:" + key), nil
+	}))
+	addr1, stop1 := serveNode(t)
+	defer stop1()
+	addr2, stop2 := serveNode(t)
+	defer stop2()
+
+	c, err := New(WithStaticNodes(addr1, addr2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if nodes := c.Nodes(); len(nodes) != 2 {
+		t.Fatalf("Nodes = %v", nodes)
+	}
+
+	ctx := context.Background()
+	for i := 0; i < 10; i++ {
+		key := fmt.Sprintf("k%d", i)
+		v, err := c.Get(ctx, "sdk", key)
+		if err != nil || string(v) != "loaded:"+key {
+			t.Fatalf("Get(%s) = %q, %v", key, v, err)
+		}
+	}
+	if _, info, err := c.GetWithInfo(ctx, "sdk", "k0"); err != nil || !info.Cached() || info.Node != c.Owner("k0") || info.Added.IsZero() {
+		t.Fatalf("GetWithInfo(k0) = %+v, %v, want a cache hit on the owner", info, err)
+	}
+	if _, err := c.Get(ctx, "sdk", "missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get(missing) = %v, want ErrNotFound", err)
+	}
+
+	if err := c.Set(ctx, "sdk", "written", []byte("v1"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := c.Get(ctx, "sdk", "written"); err != nil || string(v) != "v1" {
+		t.Fatalf("Get after Set = %q, %v", v, err)
+	}
+	if deleted, err := c.Delete(ctx, "sdk", "written"); err != nil || !deleted {
+		t.Fatalf("Delete = %v, %v", deleted, err)
+	}
+	if v, _ := c.Get(ctx, "sdk", "written"); string(v) != "loaded:written" {
+		t.Fatalf("Get after Delete = %q, want the value reloaded from the source", v)
+	}
+
+	empty, _ := New(WithStaticNodes())
+	if _, err := empty.Get(ctx, "sdk", "k"); !errors.Is(err, ErrNoNodes) {
+		t.Fatalf("Get without nodes = %v, want ErrNoNodes", err)
+	}
+}
+
+// listRegistry 返回固定节点的注册中心
+type listRegistry struct{ nodes []string }
+
+func (r listRegistry) Register(service, addr string, metadata interface{}, stop chan error) error {
+	return <-stop
+}
+func (r listRegistry) Deregister(service, addr string) error { return nil }
+func (r listRegistry) Watch(ctx context.Context, service string, fn func(added, removed []string)) error {
+	fn(r.nodes, nil)
+	<-ctx.Done()
+	return ctx.Err()
+}
+func (r listRegistry) Resolve(ctx context.Context, service string) ([]string, error) {
+	return r.nodes, nil
+}
+
+// weightedRegistry 在 listRegistry 的基础上返回节点注册时携带的权重
+type weightedRegistry struct {
+	listRegistry
+	weights map[string]int
+}
+
+func (r weightedRegistry) Metadata(ctx context.Context, service, addr string) (json.RawMessage, error) {
+	return json.Marshal(map[string]interface{}{"scheme": "plain", "weight": r.weights[addr]})
+}
+
+func TestWeightedDiscovery(t *testing.T) {
+	nodes := []string{"10.0.0.1:8001", "10.0.0.2:8001"}
+	weights := map[string]int{"10.0.0.2:8001": 3}
+	c, err := New(WithRegistry(weightedRegistry{listRegistry{nodes}, weights}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if w := c.ring.Weight("10.0.0.2:8001"); w != 3 {
+		t.Fatalf("weight = %d, want 3", w)
+	}
+
+	// 与按相同权重构建哈希环的节点计算出相同的归属
+	ring := consistenthash.NewWithHash64(defaultReplicas, nil)
+	ring.SetWeight("10.0.0.2:8001", 3)
+	ring.Add(nodes...)
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		if got, want := c.Owner(key), ring.Get(key); got != want {
+			t.Fatalf("Owner(%s) = %s, want %s", key, got, want)
+		}
+	}
+}
+
+func TestRegistryDiscovery(t *testing.T) {
+	c, err := New(WithRegistry(listRegistry{nodes: []string{"10.0.0.1:8001", "10.0.0.2:8001"}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if nodes := c.Nodes(); len(nodes) != 2 || c.Owner("k") == "" {
+		t.Fatalf("Nodes = %v", nodes)
+	}
+}
@@ -0,0 +1,388 @@
+package gocache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	pb "gocache/gocachepb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestClientCoalescesRequests(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	c := NewClient("gocache/test")
+	c.fetch = func(in *pb.Request) (*pb.Response, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return &pb.Response{Value: []byte(in.GetGroup() + "/" + in.GetKey())}, nil
+	}
+
+	const n = 10
+	var wg sync.WaitGroup
+	outs := make([]*pb.Response, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			outs[i] = &pb.Response{}
+			if err := c.Get(&pb.Request{Group: "g", Key: "k"}, outs[i]); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	for c.flights.Stats().Dups < n-1 {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Fatalf("expect 1 remote call, got %d", got)
+	}
+	if m := c.Metrics(); m.Requests != 1 || m.Coalesced != n-1 {
+		t.Fatalf("metrics requests=%d coalesced=%d, want 1 and %d", m.Requests, m.Coalesced, n-1)
+	}
+	outs[0].Value[0] = 'x' // 每个调用者拿到的是独立的副本
+	for i := 1; i < n; i++ {
+		if string(outs[i].Value) != "g/k" {
+			t.Fatalf("caller %d got %q", i, outs[i].Value)
+		}
+	}
+
+	// 不同的key不会被合并
+	out := &pb.Response{}
+	if err := c.Get(&pb.Request{Group: "g", Key: "k2"}, out); err != nil || string(out.Value) != "g/k2" {
+		t.Fatalf("unexpected response %q %v", out.Value, err)
+	}
+}
+
+func TestClientSharesCoalescedValue(t *testing.T) {
+	release := make(chan struct{})
+	c := NewClient("gocache/test")
+	c.fetch = func(in *pb.Request) (*pb.Response, error) {
+		<-release
+		return &pb.Response{Value: []byte("shared"), Found: true, Node: "n1", ProtocolVersion: protocolVersion}, nil
+	}
+
+	const n = 4
+	var wg sync.WaitGroup
+	outs := make([]*pb.Response, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			outs[i] = &pb.Response{}
+			if err := c.getShared(context.Background(), &pb.Request{Group: "g", Key: "k"}, outs[i]); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	for c.flights.Stats().Dups < n-1 {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+
+	for i, out := range outs {
+		if string(out.Value) != "shared" || !out.Found || out.Node != "n1" || out.ProtocolVersion != protocolVersion {
+			t.Fatalf("caller %d got %v", i, out)
+		}
+		if &out.Value[0] != &outs[0].Value[0] { // 合并的调用者共享同一份数据，不再各自复制
+			t.Fatalf("caller %d got a copy of the value", i)
+		}
+	}
+}
+
+func TestProtocolNegotiation(t *testing.T) {
+	NewGroup("protocol", 2<<10, "lru", GetterFunc(func(key string) ([]byte, error) {
+		return []byte("value-" + key), nil
+	}))
+	svr, _ := NewServer("127.0.0.1:9701")
+
+	// v1 请求方：value 是序列化后的 Response
+	v1, err := svr.Get(context.Background(), &pb.Request{Group: "protocol", Key: "k"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v1.ProtocolVersion != 0 || string(v1.Value) == "value-k" {
+		t.Fatalf("v1 request should get a v1 response, got %+v", v1)
+	}
+	// v2 请求方：value 直接是缓存的数据
+	v2, err := svr.Get(context.Background(), &pb.Request{Group: "protocol", Key: "k", ProtocolVersion: protocolVersion})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v2.ProtocolVersion != protocolVersion || string(v2.Value) != "value-k" {
+		t.Fatalf("v2 request should get raw bytes, got %+v", v2)
+	}
+	for _, resp := range []*pb.Response{v1, v2} {
+		out, err := decodeResponse(resp)
+		if err != nil || string(out.Value) != "value-k" {
+			t.Fatalf("decode %+v: %q %v", resp, out.GetValue(), err)
+		}
+	}
+}
+
+// loopbackPeer 把请求转发给进程内的 Server 并改写缓存组名称，用于不依赖etcd测试节点之间的交互
+type loopbackPeer struct {
+	svr   *Server
+	group string
+}
+
+func (p loopbackPeer) Get(in *pb.Request, out *pb.Response) error {
+	req := proto.Clone(in).(*pb.Request)
+	req.Group, req.ProtocolVersion = p.group, protocolVersion
+	resp, err := p.svr.Get(context.Background(), req)
+	if err != nil {
+		return err
+	}
+	if resp, err = decodeResponse(resp); err != nil {
+		return err
+	}
+	proto.Reset(out)
+	proto.Merge(out, resp)
+	return nil
+}
+
+func (p loopbackPeer) Put(in *pb.PutRequest) error {
+	req := proto.Clone(in).(*pb.PutRequest)
+	req.Group = p.group
+	_, err := p.svr.Put(context.Background(), req)
+	return err
+}
+
+func (p loopbackPeer) Delete(in *pb.DeleteRequest) (bool, error) {
+	req := proto.Clone(in).(*pb.DeleteRequest)
+	req.Group = p.group
+	resp, err := p.svr.Delete(context.Background(), req)
+	return resp.GetDeleted(), err
+}
+
+func (p loopbackPeer) Lease(ctx context.Context, in *pb.LeaseRequest) (*pb.LeaseResponse, error) {
+	req := proto.Clone(in).(*pb.LeaseRequest)
+	req.Group = p.group
+	resp, err := p.svr.Lease(ctx, req)
+	return resp, fromStatus(err)
+}
+
+// remotePicker 把所有key都交给同一个远程节点
+type remotePicker struct{ peer PeerGetter }
+
+func (p remotePicker) PickPeer(key string) (PeerGetter, bool) { return p.peer, true }
+
+func TestResponseFields(t *testing.T) {
+	NewGroup("fields-origin", 2<<10, "lru", TTLGetterFunc(func(key string) ([]byte, time.Duration, error) {
+		if key == "missing" {
+			return nil, 0, fmt.Errorf("no row for %s: %w", key, ErrNotFound)
+		}
+		return []byte{}, time.Hour, nil // 空值也是存在的
+	}))
+	svr, _ := NewServer("127.0.0.1:9702")
+
+	resp, err := svr.Get(context.Background(), &pb.Request{Group: "fields-origin", Key: "empty", ProtocolVersion: protocolVersion})
+	if err != nil || !resp.Found || len(resp.Value) != 0 || resp.ExpiresAt == 0 {
+		t.Fatalf("empty value should be found with expiry, got %+v %v", resp, err)
+	}
+	resp, err = svr.Get(context.Background(), &pb.Request{Group: "fields-origin", Key: "missing", ProtocolVersion: protocolVersion})
+	if err != nil || resp.Found || resp.Error == "" {
+		t.Fatalf("missing key should be reported as not found, got %+v %v", resp, err)
+	}
+	if _, err := svr.Get(context.Background(), &pb.Request{Group: "fields-origin", Key: "missing"}); err == nil {
+		t.Fatal("v1 request should still get an error for a missing key")
+	}
+
+	// 请求方：不存在时不回退到本地数据源，过期时间以归属节点为准
+	var localLoads int32
+	g := NewGroup("fields", 2<<10, "lru", GetterFunc(func(key string) ([]byte, error) {
+		atomic.AddInt32(&localLoads, 1)
+		return []byte("local"), nil
+	}))
+	g.RegisterPeers(remotePicker{loopbackPeer{svr: svr, group: "fields-origin"}})
+	if _, err := g.GetCacheData("missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expect ErrNotFound, got %v", err)
+	}
+	v, _, err := g.getFromPeer(context.Background(), loopbackPeer{svr: svr, group: "fields-origin"}, "empty")
+	if err != nil || v.Len() != 0 || time.Until(v.Expire()) < 59*time.Minute {
+		t.Fatalf("unexpected value %+v %v", v, err)
+	}
+	if atomic.LoadInt32(&localLoads) != 0 {
+		t.Fatal("should not fall back to the local getter")
+	}
+
+	// 归属节点上的热点数据直接进入请求方的热点缓存
+	for i := 0; i < maxMinuteRemoteQPS; i++ {
+		GetGroup("fields-origin").GetCacheData("empty")
+	}
+	g.getFromPeer(context.Background(), loopbackPeer{svr: svr, group: "fields-origin"}, "empty")
+	if _, ok := g.hotCache.get("empty"); !ok {
+		t.Fatal("hot value should be put into the hot cache")
+	}
+}
+
+func TestPutDeleteBatchGet(t *testing.T) {
+	g := NewGroup("writes", 2<<10, "lru", GetterFunc(func(key string) ([]byte, error) {
+		if key == "missing" {
+			return nil, ErrNotFound
+		}
+		if key == "broken" {
+			return nil, errors.New("backend down")
+		}
+		return []byte("loaded-" + key), nil
+	}))
+	svr, _ := NewServer("127.0.0.1:9703")
+	ctx := context.Background()
+
+	if _, err := svr.Put(ctx, &pb.PutRequest{Group: "writes", Key: "k", Value: []byte("put"), Ttl: int64(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := g.mainCache.peek("k"); !ok || v.String() != "put" || time.Until(v.Expire()) < 59*time.Minute {
+		t.Fatalf("put should write mainCache with ttl, got %+v %v", v, ok)
+	}
+
+	resp, err := svr.BatchGet(ctx, &pb.BatchGetRequest{Group: "writes", Keys: []string{"k", "other", "missing", "broken"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		found bool
+		value string
+		err   bool
+	}{{true, "put", false}, {true, "loaded-other", false}, {false, "", true}, {false, "", true}}
+	for i, w := range want {
+		v := resp.Values[i]
+		if v.Found != w.found || string(v.Value) != w.value || (v.Error != "") != w.err {
+			t.Fatalf("value %d: got %+v", i, v)
+		}
+	}
+	if _, err := svr.BatchGet(ctx, &pb.BatchGetRequest{Group: "writes", Keys: make([]string, maxBatchKeys+1)}); err == nil {
+		t.Fatal("expect error for too many keys")
+	}
+
+	del, err := svr.Delete(ctx, &pb.DeleteRequest{Group: "writes", Key: "k"})
+	if err != nil || !del.Deleted {
+		t.Fatalf("expect k to be deleted, got %v %v", del, err)
+	}
+	if _, ok := g.mainCache.peek("k"); ok {
+		t.Fatal("k should be removed from mainCache")
+	}
+	if del, _ := svr.Delete(ctx, &pb.DeleteRequest{Group: "writes", Key: "k"}); del.Deleted {
+		t.Fatal("deleting twice should report nothing deleted")
+	}
+}
+
+func TestCloneIntoRemoteOwner(t *testing.T) {
+	getter := GetterFunc(func(key string) ([]byte, error) { return []byte(key), nil })
+	src := NewGroup("clone-remote-src", 2<<10, "lru", getter)
+	owner := NewGroup("clone-remote-owner", 2<<10, "lru", getter)
+	dst := NewGroup("clone-remote-dst", 2<<10, "lru", getter)
+	svr, _ := NewServer("127.0.0.1:9704")
+	dst.RegisterPeers(remotePicker{loopbackPeer{svr: svr, group: "clone-remote-owner"}})
+	src.mainCache.add("a", ByteView{b: []byte("1")})
+
+	stats, err := src.CloneInto("clone-remote-dst", func(k string, v ByteView) (string, ByteView, bool) {
+		return "v2:" + k, v, true
+	})
+	if err != nil || stats.Remote != 1 || stats.Cloned != 0 {
+		t.Fatalf("expect the key to be forwarded, got %+v %v", stats, err)
+	}
+	if v, ok := owner.mainCache.peek("v2:a"); !ok || v.String() != "1" {
+		t.Fatalf("owner should hold the cloned key, got %v %v", v, ok)
+	}
+}
+
+// capturePeer 记录收到的请求并返回固定的数据
+type capturePeer struct {
+	mu   sync.Mutex
+	reqs []*pb.Request
+}
+
+func (p *capturePeer) Get(in *pb.Request, out *pb.Response) error {
+	p.mu.Lock()
+	p.reqs = append(p.reqs, proto.Clone(in).(*pb.Request))
+	p.mu.Unlock()
+	out.Value, out.Found, out.ProtocolVersion = []byte("v"), true, protocolVersion
+	return nil
+}
+
+// namedPicker 是带有本节点地址的 remotePicker
+type namedPicker struct {
+	remotePicker
+	self string
+}
+
+func (p namedPicker) Self() string { return p.self }
+
+func TestRequestMetadata(t *testing.T) {
+	peer := &capturePeer{}
+	g := NewGroup("meta", 2<<10, "lru", GetterFunc(func(key string) ([]byte, error) { return nil, ErrNotFound }))
+	g.RegisterPeers(namedPicker{remotePicker{peer}, "127.0.0.1:9709"})
+
+	ctx, cancel := context.WithTimeout(WithTraceID(context.Background(), "trace-1"), time.Minute)
+	defer cancel()
+	if _, err := g.GetContext(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	g.GetCacheData("b")
+	if len(peer.reqs) != 2 {
+		t.Fatalf("expect 2 peer requests, got %d", len(peer.reqs))
+	}
+	if r := peer.reqs[0]; r.TraceId != "trace-1" || r.Caller != "127.0.0.1:9709" || r.Deadline == 0 {
+		t.Fatalf("unexpected metadata %+v", r)
+	}
+	if r := peer.reqs[1]; r.TraceId == "" || r.TraceId == "trace-1" || r.Deadline != 0 {
+		t.Fatalf("requests without a trace should get a new one, got %+v", r)
+	}
+
+	// 服务端沿用请求的追踪ID转发给下一个节点，超过截止时间的请求直接拒绝
+	svr, _ := NewServer("127.0.0.1:9710")
+	deadline := time.Now().Add(time.Minute).UnixNano()
+	if _, err := svr.Get(context.Background(), &pb.Request{Group: "meta", Key: "c", TraceId: "trace-2", Deadline: deadline}); err != nil {
+		t.Fatal(err)
+	}
+	if r := peer.reqs[2]; r.TraceId != "trace-2" || r.Deadline != deadline {
+		t.Fatalf("nested hop should keep the trace and deadline, got %+v", r)
+	}
+	_, err := svr.Get(context.Background(), &pb.Request{Group: "meta", Key: "d", Deadline: time.Now().Add(-time.Second).UnixNano()})
+	if status.Code(err) != codes.DeadlineExceeded {
+		t.Fatalf("expect DeadlineExceeded, got %v", err)
+	}
+}
+
+func TestGetWithInfo(t *testing.T) {
+	NewGroup("info-origin", 2<<10, "lru", TTLGetterFunc(func(key string) ([]byte, time.Duration, error) {
+		return []byte("v-" + key), time.Hour, nil
+	}))
+	g := NewGroup("info", 2<<10, "lru", GetterFunc(func(key string) ([]byte, error) {
+		return []byte("local-" + key), nil
+	}))
+	ctx := context.Background()
+
+	v, info, err := g.GetWithInfo(ctx, "a")
+	if err != nil || v.String() != "local-a" || info.Source != SourceLocalLoad || info.Added.IsZero() {
+		t.Fatalf("first read should load locally, got %q %+v %v", v.String(), info, err)
+	}
+	// 本地加载的数据同时放入热点缓存，之后从热点缓存命中
+	if _, info, _ = g.GetWithInfo(ctx, "a"); info.Source != SourceHotCache || info.Age() < 0 {
+		t.Fatalf("second read should hit the hot cache, got %+v", info)
+	}
+	g.hotCache.remove("a")
+	if _, info, _ = g.GetWithInfo(ctx, "a"); info.Source != SourceMainCache {
+		t.Fatalf("expect main cache hit, got %+v", info)
+	}
+
+	svr, _ := NewServer("127.0.0.1:9711")
+	g.RegisterPeers(remotePicker{loopbackPeer{svr: svr, group: "info-origin"}})
+	v, info, err = g.GetWithInfo(ctx, "b")
+	if err != nil || v.String() != "v-b" || info.Source != SourcePeer || info.Node != "127.0.0.1:9711" ||
+		info.PeerSource != SourceLocalLoad || info.Added.IsZero() || time.Until(info.Expire) < 59*time.Minute {
+		t.Fatalf("expect value from peer with provenance, got %q %+v %v", v.String(), info, err)
+	}
+}
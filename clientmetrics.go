@@ -0,0 +1,172 @@
+package gocache
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// LatencyBuckets 远程读取耗时直方图的桶上限，最后还有一个不设上限的桶
+var LatencyBuckets = []time.Duration{
+	time.Millisecond, 2500 * time.Microsecond, 5 * time.Millisecond, 10 * time.Millisecond,
+	25 * time.Millisecond, 50 * time.Millisecond, 100 * time.Millisecond, 250 * time.Millisecond,
+	500 * time.Millisecond, time.Second, 2500 * time.Millisecond, 5 * time.Second, 10 * time.Second,
+}
+
+// ErrorClass 远程读取失败的分类
+type ErrorClass string
+
+const (
+	ErrorNotFound    ErrorClass = "not_found"    // key不存在(v1协议以错误返回)
+	ErrorTimeout     ErrorClass = "timeout"      // 超过截止时间
+	ErrorCanceled    ErrorClass = "canceled"     // 请求被取消
+	ErrorUnavailable ErrorClass = "unavailable"  // 节点不可达或暂时无法处理
+	ErrorOverloaded  ErrorClass = "overloaded"   // 被对方限流或过载保护拒绝，见 IsOverloaded
+	ErrorCircuit     ErrorClass = "circuit_open" // 熔断期间没有发送，见 ErrCircuitOpen
+	ErrorOther       ErrorClass = "other"        // 其他错误，例如对方的数据源故障
+)
+
+// ClassifyError 返回远程读取错误的分类
+func ClassifyError(err error) ErrorClass {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return ErrorNotFound
+	case errors.Is(err, ErrCircuitOpen):
+		return ErrorCircuit
+	case IsOverloaded(err):
+		return ErrorOverloaded
+	case errors.Is(err, context.DeadlineExceeded):
+		return ErrorTimeout
+	}
+	switch status.Code(err) {
+	case codes.DeadlineExceeded:
+		return ErrorTimeout
+	case codes.Canceled:
+		return ErrorCanceled
+	case codes.Unavailable:
+		return ErrorUnavailable
+	}
+	return ErrorOther
+}
+
+// Histogram 耗时直方图，Counts[i] 为耗时不超过 Bounds[i] 且超过 Bounds[i-1] 的请求数，最后一个元素为超过所有上限的请求数
+type Histogram struct {
+	Bounds []time.Duration `json:"bounds"`
+	Counts []int64         `json:"counts"`
+	Count  int64           `json:"count"`
+	Sum    time.Duration   `json:"sum"`
+}
+
+// observe 记录一次耗时
+func (h *Histogram) observe(d time.Duration) {
+	if h.Counts == nil {
+		h.Bounds = LatencyBuckets
+		h.Counts = make([]int64, len(h.Bounds)+1)
+	}
+	h.Counts[sort.Search(len(h.Bounds), func(i int) bool { return d <= h.Bounds[i] })]++
+	h.Count++
+	h.Sum += d
+}
+
+// Quantile 按桶的上限估算分位数q(0到1之间)，例如 Quantile(0.95) 可以作为 WithHedging 的延迟。
+// 落在最后一个不设上限的桶中时返回最大的上限，没有数据时返回0。
+func (h Histogram) Quantile(q float64) time.Duration {
+	if h.Count == 0 {
+		return 0
+	}
+	rank := int64(q*float64(h.Count) + 0.5)
+	if rank < 1 {
+		rank = 1
+	}
+	var seen int64
+	for i, n := range h.Counts {
+		if seen += n; seen >= rank {
+			if i < len(h.Bounds) {
+				return h.Bounds[i]
+			}
+			break
+		}
+	}
+	return h.Bounds[len(h.Bounds)-1]
+}
+
+// PeerMetrics 访问一个远程节点的读取统计，计数为创建客户端以来的累计值
+type PeerMetrics struct {
+	Peer          string               `json:"peer"`
+	Requests      int64                `json:"requests"`
+	Errors        map[ErrorClass]int64 `json:"errors"`
+	Latency       Histogram            `json:"latency"`
+	BytesSent     int64                `json:"bytes_sent"`     // 请求的字节数
+	BytesReceived int64                `json:"bytes_received"` // 响应中数据的字节数
+	Coalesced     int64                `json:"coalesced"`      // 与同时进行的相同请求合并、没有单独发送的请求数
+}
+
+// PeerMetricsProvider 提供访问各个远程节点的读取统计，Server 实现了该接口，Prometheus 等监控集成据此导出指标
+type PeerMetricsProvider interface {
+	PeerMetrics() []PeerMetrics
+}
+
+// PeerMetrics 返回访问各个远程节点的读取统计，按节点地址排序
+func (s *Server) PeerMetrics() []PeerMetrics {
+	s.mu.RLock()
+	out := make([]PeerMetrics, 0, len(s.clients))
+	for addr, client := range s.clients {
+		m := client.Metrics()
+		m.Peer = addr
+		out = append(out, m)
+	}
+	s.mu.RUnlock()
+	sort.Slice(out, func(i, j int) bool { return out[i].Peer < out[j].Peer })
+	return out
+}
+
+// 测试 Server 是否实现了 PeerMetricsProvider 接口
+var _ PeerMetricsProvider = (*Server)(nil)
+
+// clientMetrics 一个客户端的读取统计
+type clientMetrics struct {
+	mu sync.Mutex
+	m  PeerMetrics
+}
+
+// observe 记录一次远程读取
+func (cm *clientMetrics) observe(d time.Duration, sent, received int, err error) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	cm.m.Requests++
+	cm.m.Latency.observe(d)
+	cm.m.BytesSent += int64(sent)
+	cm.m.BytesReceived += int64(received)
+	if err != nil {
+		if cm.m.Errors == nil {
+			cm.m.Errors = map[ErrorClass]int64{}
+		}
+		cm.m.Errors[ClassifyError(err)]++
+	}
+}
+
+// coalesced 记录一次与进行中的相同请求合并的读取
+func (cm *clientMetrics) coalesced() {
+	cm.mu.Lock()
+	cm.m.Coalesced++
+	cm.mu.Unlock()
+}
+
+// Metrics 返回客户端的读取统计
+func (c *Client) Metrics() PeerMetrics {
+	c.metrics.mu.Lock()
+	defer c.metrics.mu.Unlock()
+	m := c.metrics.m
+	m.Peer = c.peerAddr()
+	m.Latency.Counts = append([]int64(nil), m.Latency.Counts...)
+	m.Errors = make(map[ErrorClass]int64, len(c.metrics.m.Errors))
+	for class, n := range c.metrics.m.Errors {
+		m.Errors[class] = n
+	}
+	return m
+}
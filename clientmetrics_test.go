@@ -0,0 +1,83 @@
+package gocache
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	pb "gocache/gocachepb"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestClientMetrics(t *testing.T) {
+	svr, _ := NewServer("127.0.0.1:9716", WithCircuitBreaker(0, 0))
+	svr.Set("127.0.0.1:9717")
+	client := svr.clients["127.0.0.1:9717"]
+	errs := map[string]error{
+		"down": status.Error(codes.Unavailable, "connection refused"),
+		"slow": status.Error(codes.DeadlineExceeded, "deadline exceeded"),
+	}
+	client.fetch = func(in *pb.Request) (*pb.Response, error) {
+		if err := errs[in.Key]; err != nil {
+			return nil, err
+		}
+		return &pb.Response{Value: []byte("abc"), Found: true, ProtocolVersion: protocolVersion}, nil
+	}
+	for _, key := range []string{"a", "b", "down", "slow"} {
+		client.Get(&pb.Request{Group: "metrics", Key: key}, &pb.Response{})
+	}
+
+	all := svr.PeerMetrics()
+	if len(all) != 1 || all[0].Peer != "127.0.0.1:9717" {
+		t.Fatalf("PeerMetrics = %+v, want one entry for the peer", all)
+	}
+	m := all[0]
+	if m.Requests != 4 || m.Latency.Count != 4 || m.BytesReceived != 6 || m.BytesSent == 0 {
+		t.Fatalf("requests=%d latency.count=%d received=%d sent=%d", m.Requests, m.Latency.Count, m.BytesReceived, m.BytesSent)
+	}
+	if m.Errors[ErrorUnavailable] != 1 || m.Errors[ErrorTimeout] != 1 || len(m.Errors) != 2 {
+		t.Fatalf("errors = %v", m.Errors)
+	}
+}
+
+func TestClassifyError(t *testing.T) {
+	for err, want := range map[error]ErrorClass{
+		fmt.Errorf("reading: %w", ErrNotFound):                                   ErrorNotFound,
+		fmt.Errorf("%w after 5 consecutive failures", ErrCircuitOpen):            ErrorCircuit,
+		status.Error(codes.ResourceExhausted, overloadedPrefix+": 10 in flight"): ErrorOverloaded,
+		status.Error(codes.DeadlineExceeded, ""):                                 ErrorTimeout,
+		context.DeadlineExceeded:                                                 ErrorTimeout,
+		status.Error(codes.Canceled, ""):                                         ErrorCanceled,
+		status.Error(codes.Unavailable, ""):                                      ErrorUnavailable,
+		status.Error(codes.Internal, "db down"):                                  ErrorOther,
+	} {
+		if got := ClassifyError(err); got != want {
+			t.Errorf("ClassifyError(%v) = %s, want %s", err, got, want)
+		}
+	}
+}
+
+func TestHistogramQuantile(t *testing.T) {
+	var h Histogram
+	if h.Quantile(0.95) != 0 {
+		t.Fatal("empty histogram should report 0")
+	}
+	for i := 0; i < 95; i++ {
+		h.observe(3 * time.Millisecond)
+	}
+	for i := 0; i < 5; i++ {
+		h.observe(time.Minute)
+	}
+	if q := h.Quantile(0.5); q != 5*time.Millisecond {
+		t.Fatalf("p50 = %v, want 5ms bucket", q)
+	}
+	if q := h.Quantile(0.99); q != LatencyBuckets[len(LatencyBuckets)-1] {
+		t.Fatalf("p99 = %v, want the largest bound", q)
+	}
+	if h.Counts[len(h.Counts)-1] != 5 {
+		t.Fatalf("overflow bucket = %d, want 5", h.Counts[len(h.Counts)-1])
+	}
+}
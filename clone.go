@@ -0,0 +1,106 @@
+package gocache
+
+import (
+	"fmt"
+	pb "gocache/gocachepb"
+	"math"
+	"time"
+)
+
+// CloneStats 记录一次 CloneInto 的结果
+type CloneStats struct {
+	Scanned int // 扫描的缓存项数量
+	Cloned  int // 写入目标缓存组的数量
+	Dropped int // 被transform丢弃的数量
+	Remote  int // 新key归属其他节点，通过 Put 写入归属节点的数量
+	Skipped int // 新key归属其他节点，但节点不支持写入或写入失败而跳过的数量
+}
+
+// CloneInto 将本节点主缓存中的数据经过transform转换后写入名为newGroupName的缓存组，
+// 用于蓝绿迁移：在线修改key的格式或者value的编码。transform 返回false表示丢弃该项。
+// 目标缓存组需要事先通过 NewGroup 创建，数据的过期时间会被保留。
+// transform 看到的是经过源缓存组变换链还原后的数据，写入时再经过目标缓存组的变换链。
+// 每个节点只处理自己持有的数据，在集群的每个节点上执行即可完成整个集群的迁移；
+// 转换后新key归属其他节点的数据通过 Put 写入归属节点；节点不支持写入(没有实现 PeerWriter)或写入失败时跳过，
+// 由归属节点在访问时重新加载。
+func (g *Group) CloneInto(newGroupName string, transform func(k string, v ByteView) (string, ByteView, bool)) (CloneStats, error) {
+	var stats CloneStats
+	if newGroupName == g.name {
+		return stats, fmt.Errorf("cannot clone group %s into itself", g.name)
+	}
+	target := GetGroup(newGroupName)
+	if target == nil {
+		return stats, fmt.Errorf("group %s not found", newGroupName)
+	}
+	if g.mainCache == nil || target.mainCache == nil {
+		return stats, fmt.Errorf("group cache not initialized")
+	}
+
+	// 按读路径索引的分片逐个处理，每次只复制一个分片的key，不会一次性复制整个缓存
+	for shard := 0; shard < indexShards; shard++ {
+		for _, key := range g.mainCache.scanKeys(shard, "", math.MaxInt) {
+			if err := g.cloneKey(target, key, transform, &stats); err != nil {
+				return stats, err
+			}
+		}
+	}
+	return stats, nil
+}
+
+// cloneKey 转换一个key并写入目标缓存组，本地写入与 Set 相同，见 storeLocally
+func (g *Group) cloneKey(target *Group, key string, transform func(k string, v ByteView) (string, ByteView, bool), stats *CloneStats) error {
+	value, ok := g.mainCache.peek(key)
+	if !ok { // 已经过期或被淘汰
+		return nil
+	}
+	stats.Scanned++
+	value, err := g.decode(key, value)
+	if err != nil {
+		return err
+	}
+	newKey, newValue, keep := transform(key, value)
+	if !keep || newKey == "" {
+		stats.Dropped++
+		return nil
+	}
+	if target.peers != nil {
+		if peer, remote := target.pickPeer(newKey); remote {
+			if target.forwardPut(peer, newKey, newValue) {
+				stats.Remote++
+			} else {
+				stats.Skipped++
+			}
+			return nil
+		}
+	}
+	b, err := target.encode(newKey, newValue.b)
+	if err != nil {
+		return err
+	}
+	newValue.b = b
+	if newValue.e.IsZero() { // 没有过期时间时使用目标缓存组的默认过期时间
+		newValue.e = target.expireAt(0)
+	}
+	target.storeLocally(newKey, newValue)
+	stats.Cloned++
+	return nil
+}
+
+// forwardPut 把数据写入归属节点，保留剩余的过期时长
+func (g *Group) forwardPut(peer PeerGetter, key string, value ByteView) bool {
+	writer, ok := peer.(PeerWriter)
+	if !ok {
+		return false
+	}
+	var ttl time.Duration
+	if !value.e.IsZero() {
+		if ttl = time.Until(value.e); ttl <= 0 { // 已经过期
+			return false
+		}
+	}
+	if err := writer.Put(&pb.PutRequest{Group: g.name, Key: key, Value: value.b, Ttl: int64(ttl)}); err != nil {
+		g.logger.Warn("clone to peer failed", "group", g.name, "key", key, "error", err)
+		return false
+	}
+	return true
+}
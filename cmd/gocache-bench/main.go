@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"gocache/client"
+	"log"
+	"math/rand"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+gocache-bench 对gocache集群施加可配置的负载，报告吞吐量、延迟分位数、命中率以及各节点的请求分布：
+
+	gocache-bench --addrs localhost:8001,localhost:8002 --group scores --keys 100000 --zipf 1.1 --read 0.9 --value-size 64-4096 --duration 30s
+
+读写都通过轻量客户端(gocache/client)直接发往key的归属节点；不指定 --addrs 时通过etcd发现节点(见 GOCACHE_ETCD_ENDPOINTS)。
+--zipf 为0时key均匀分布，大于1时越小的编号越热。--preload 先写入所有key，使读取从热缓存开始。
+Ctrl+C 提前结束并输出已经完成的部分。
+*/
+
+// config 压测的参数
+type config struct {
+	addrs       []string
+	group       string
+	keys        int
+	prefix      string
+	zipf        float64
+	readRatio   float64
+	minSize     int
+	maxSize     int
+	concurrency int
+	duration    time.Duration
+	requests    int
+	ttl         time.Duration
+	timeout     time.Duration
+	preload     bool
+	seed        int64
+}
+
+func parseFlags(args []string) (config, error) {
+	fs := flag.NewFlagSet("gocache-bench", flag.ContinueOnError)
+	addrs := fs.String("addrs", "", "comma separated node addresses, empty to discover nodes from etcd")
+	group := fs.String("group", "bench", "cache group to read and write")
+	keys := fs.Int("keys", 10000, "number of distinct keys")
+	prefix := fs.String("prefix", "bench:", "key prefix")
+	zipf := fs.Float64("zipf", 1.1, "zipf exponent of the key distribution (>1), 0 for uniform")
+	read := fs.Float64("read", 0.9, "fraction of operations that are reads, the rest are writes")
+	valueSize := fs.String("value-size", "128", "size of written values in bytes, either n or min-max")
+	concurrency := fs.Int("concurrency", 16, "number of concurrent workers")
+	duration := fs.Duration("duration", 10*time.Second, "how long to run, ignored when -requests is set")
+	requests := fs.Int("requests", 0, "total number of operations, 0 to run for -duration")
+	ttl := fs.Duration("ttl", 0, "ttl of written values, 0 for the group default")
+	timeout := fs.Duration("timeout", time.Second, "timeout of a single operation")
+	preload := fs.Bool("preload", false, "write every key once before the run")
+	seed := fs.Int64("seed", 0, "random seed, 0 for a time based seed")
+	if err := fs.Parse(args); err != nil {
+		return config{}, err
+	}
+	cfg := config{
+		group:       *group,
+		keys:        *keys,
+		prefix:      *prefix,
+		zipf:        *zipf,
+		readRatio:   *read,
+		concurrency: *concurrency,
+		duration:    *duration,
+		requests:    *requests,
+		ttl:         *ttl,
+		timeout:     *timeout,
+		preload:     *preload,
+		seed:        *seed,
+	}
+	for _, a := range strings.Split(*addrs, ",") {
+		if a = strings.TrimSpace(a); a != "" {
+			cfg.addrs = append(cfg.addrs, a)
+		}
+	}
+	var err error
+	if cfg.minSize, cfg.maxSize, err = parseSize(*valueSize); err != nil {
+		return config{}, err
+	}
+	switch {
+	case cfg.keys < 1:
+		return config{}, fmt.Errorf("-keys must be at least 1")
+	case cfg.zipf != 0 && cfg.zipf <= 1:
+		return config{}, fmt.Errorf("-zipf must be greater than 1, or 0 for uniform keys")
+	case cfg.readRatio < 0 || cfg.readRatio > 1:
+		return config{}, fmt.Errorf("-read must be between 0 and 1")
+	case cfg.concurrency < 1:
+		return config{}, fmt.Errorf("-concurrency must be at least 1")
+	}
+	if cfg.seed == 0 {
+		cfg.seed = time.Now().UnixNano()
+	}
+	return cfg, nil
+}
+
+// parseSize 解析 n 或 min-max 格式的数据大小
+func parseSize(s string) (min, max int, err error) {
+	lo, hi, found := strings.Cut(s, "-")
+	if min, err = strconv.Atoi(lo); err != nil || min < 0 {
+		return 0, 0, fmt.Errorf("invalid -value-size %q", s)
+	}
+	max = min
+	if found {
+		if max, err = strconv.Atoi(hi); err != nil || max < min {
+			return 0, 0, fmt.Errorf("invalid -value-size %q", s)
+		}
+	}
+	return min, max, nil
+}
+
+// workload 生成一个worker的操作序列，不能被并发使用
+type workload struct {
+	cfg  config
+	rnd  *rand.Rand
+	zipf *rand.Zipf
+}
+
+func newWorkload(cfg config, seed int64) *workload {
+	w := &workload{cfg: cfg, rnd: rand.New(rand.NewSource(seed))}
+	if cfg.zipf > 1 {
+		w.zipf = rand.NewZipf(w.rnd, cfg.zipf, 1, uint64(cfg.keys-1))
+	}
+	return w
+}
+
+// next 返回下一个操作的key以及是否是读取
+func (w *workload) next() (key string, read bool) {
+	var n uint64
+	if w.zipf != nil {
+		n = w.zipf.Uint64()
+	} else {
+		n = uint64(w.rnd.Intn(w.cfg.keys))
+	}
+	return w.cfg.prefix + strconv.FormatUint(n, 10), w.rnd.Float64() < w.cfg.readRatio
+}
+
+// value 返回一个随机大小的值
+func (w *workload) value() []byte {
+	size := w.cfg.minSize
+	if w.cfg.maxSize > w.cfg.minSize {
+		size += w.rnd.Intn(w.cfg.maxSize - w.cfg.minSize + 1)
+	}
+	b := make([]byte, size)
+	w.rnd.Read(b)
+	return b
+}
+
+// run 按配置施加负载直到完成、超时或ctx被取消，返回所有worker的结果
+func run(ctx context.Context, c *client.Client, cfg config) *result {
+	if cfg.requests == 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.duration)
+		defer cancel()
+	}
+	var (
+		mu        sync.Mutex // 保护 remaining
+		remaining = cfg.requests
+	)
+	take := func() bool {
+		if cfg.requests == 0 {
+			return ctx.Err() == nil
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if remaining == 0 || ctx.Err() != nil {
+			return false
+		}
+		remaining--
+		return true
+	}
+
+	results := make([]*result, cfg.concurrency)
+	var wg sync.WaitGroup
+	start := time.Now()
+	for i := range results {
+		r := newResult()
+		results[i] = r
+		wg.Add(1)
+		go func(w *workload) {
+			defer wg.Done()
+			for take() {
+				key, read := w.next()
+				opCtx, cancel := context.WithTimeout(context.Background(), cfg.timeout)
+				begin := time.Now()
+				var (
+					info client.Info
+					err  error
+				)
+				if read {
+					_, info, err = c.GetWithInfo(opCtx, cfg.group, key)
+				} else {
+					err = c.Set(opCtx, cfg.group, key, w.value(), cfg.ttl)
+				}
+				cancel()
+				if info.Node == "" { // 写入和失败的读取按客户端计算的归属节点统计
+					info.Node = c.Owner(key)
+				}
+				r.observe(read, time.Since(begin), info, err)
+			}
+		}(newWorkload(cfg, cfg.seed+int64(i)))
+	}
+	wg.Wait()
+	total := mergeResults(results)
+	total.elapsed = time.Since(start)
+	return total
+}
+
+// preload 写入所有key，使压测从热缓存开始
+func preload(ctx context.Context, c *client.Client, cfg config) error {
+	w := newWorkload(cfg, cfg.seed)
+	for i := 0; i < cfg.keys; i++ {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		opCtx, cancel := context.WithTimeout(ctx, cfg.timeout)
+		err := c.Set(opCtx, cfg.group, cfg.prefix+strconv.Itoa(i), w.value(), cfg.ttl)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("preload %s%d: %v", cfg.prefix, i, err)
+		}
+	}
+	return nil
+}
+
+func main() {
+	cfg, err := parseFlags(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	var opts []client.Option
+	if len(cfg.addrs) > 0 {
+		opts = append(opts, client.WithStaticNodes(cfg.addrs...))
+	}
+	opts = append(opts, client.WithTimeout(cfg.timeout))
+	c, err := client.New(opts...)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer c.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if cfg.preload {
+		start := time.Now()
+		if err := preload(ctx, c, cfg); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("preloaded %d keys in %v\n", cfg.keys, time.Since(start).Round(time.Millisecond))
+	}
+	fmt.Printf("running against %d nodes: %d workers, %d keys, zipf %.2f, %.0f%% reads, values %d-%d bytes\n",
+		len(c.Nodes()), cfg.concurrency, cfg.keys, cfg.zipf, cfg.readRatio*100, cfg.minSize, cfg.maxSize)
+	run(ctx, c, cfg).report(os.Stdout, c.Nodes())
+}
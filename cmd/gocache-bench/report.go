@@ -0,0 +1,165 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"gocache/client"
+	"io"
+	"math"
+	"sort"
+	"time"
+)
+
+// opStats 一类操作(读或写)的统计
+type opStats struct {
+	latencies []time.Duration // 成功的操作的耗时
+	errors    int
+}
+
+// nodeStats 一个节点的统计
+type nodeStats struct {
+	ops    int
+	reads  int
+	hits   int
+	errors int
+}
+
+// result 一个worker或者合并后的压测结果
+type result struct {
+	reads    opStats
+	writes   opStats
+	hits     int // 命中节点缓存的读取
+	notFound int // key不存在的读取
+	nodes    map[string]*nodeStats
+	elapsed  time.Duration
+}
+
+func newResult() *result {
+	return &result{nodes: map[string]*nodeStats{}}
+}
+
+// observe 记录一次操作
+func (r *result) observe(read bool, d time.Duration, info client.Info, err error) {
+	ns := r.nodes[info.Node]
+	if ns == nil {
+		ns = &nodeStats{}
+		r.nodes[info.Node] = ns
+	}
+	ns.ops++
+	op := &r.writes
+	if read {
+		op = &r.reads
+		ns.reads++
+	}
+	switch {
+	case read && errors.Is(err, client.ErrNotFound):
+		// key不存在是正常的响应，计入延迟但不算错误
+		r.notFound++
+		op.latencies = append(op.latencies, d)
+	case err != nil:
+		op.errors++
+		ns.errors++
+	default:
+		op.latencies = append(op.latencies, d)
+		if read && info.Cached() {
+			r.hits++
+			ns.hits++
+		}
+	}
+}
+
+// mergeResults 合并所有worker的结果
+func mergeResults(results []*result) *result {
+	total := newResult()
+	for _, r := range results {
+		total.reads.latencies = append(total.reads.latencies, r.reads.latencies...)
+		total.reads.errors += r.reads.errors
+		total.writes.latencies = append(total.writes.latencies, r.writes.latencies...)
+		total.writes.errors += r.writes.errors
+		total.hits += r.hits
+		total.notFound += r.notFound
+		for node, ns := range r.nodes {
+			t := total.nodes[node]
+			if t == nil {
+				t = &nodeStats{}
+				total.nodes[node] = t
+			}
+			t.ops += ns.ops
+			t.reads += ns.reads
+			t.hits += ns.hits
+			t.errors += ns.errors
+		}
+	}
+	return total
+}
+
+// report 输出吞吐量、延迟分位数、命中率和各节点的请求分布，nodes 是压测时已知的节点，没有收到请求的节点也会列出
+func (r *result) report(w io.Writer, nodes []string) {
+	reads := len(r.reads.latencies) + r.reads.errors
+	writes := len(r.writes.latencies) + r.writes.errors
+	ops := reads + writes
+	secs := r.elapsed.Seconds()
+	if secs == 0 {
+		secs = math.SmallestNonzeroFloat64
+	}
+	fmt.Fprintf(w, "\n%d ops in %v, %.0f ops/s (%d reads, %d writes)\n", ops, r.elapsed.Round(time.Millisecond), float64(ops)/secs, reads, writes)
+	okReads := len(r.reads.latencies) - r.notFound
+	fmt.Fprintf(w, "hit ratio %.2f%% (%d of %d found reads), %d not found\n\n", percent(r.hits, okReads), r.hits, okReads, r.notFound)
+
+	fmt.Fprintf(w, "%-6s %10s %10s %10s %10s %10s %10s %8s\n", "op", "count", "p50", "p90", "p99", "p99.9", "max", "errors")
+	for _, op := range []struct {
+		name  string
+		stats opStats
+	}{{"read", r.reads}, {"write", r.writes}} {
+		l := op.stats.latencies
+		sort.Slice(l, func(i, j int) bool { return l[i] < l[j] })
+		fmt.Fprintf(w, "%-6s %10d %10v %10v %10v %10v %10v %8d\n", op.name, len(l),
+			quantile(l, 0.5), quantile(l, 0.9), quantile(l, 0.99), quantile(l, 0.999), quantile(l, 1), op.stats.errors)
+	}
+
+	for _, n := range nodes {
+		if r.nodes[n] == nil {
+			r.nodes[n] = &nodeStats{}
+		}
+	}
+	names := make([]string, 0, len(r.nodes))
+	for n := range r.nodes {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	fmt.Fprintf(w, "\n%-24s %10s %8s %8s %8s\n", "node", "ops", "share%", "hit%", "errors")
+	maxOps := 0
+	for _, n := range names {
+		ns := r.nodes[n]
+		if n == "" {
+			n = "(no node)"
+		}
+		fmt.Fprintf(w, "%-24s %10d %7.2f%% %7.2f%% %8d\n", n, ns.ops, percent(ns.ops, ops), percent(ns.hits, ns.reads), ns.errors)
+		if ns.ops > maxOps {
+			maxOps = ns.ops
+		}
+	}
+	// 最忙的节点与平均值之比，1表示完全均衡
+	if len(names) > 0 && ops > 0 {
+		fmt.Fprintf(w, "imbalance (max/mean) %.2f\n", float64(maxOps)*float64(len(names))/float64(ops))
+	}
+}
+
+// quantile 返回已排序的耗时的q分位数
+func quantile(sorted []time.Duration, q float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(math.Ceil(q*float64(len(sorted)))) - 1
+	if i < 0 {
+		i = 0
+	}
+	return sorted[i].Round(time.Microsecond)
+}
+
+func percent(a, b int) float64 {
+	if b == 0 {
+		return 0
+	}
+	return float64(a) * 100 / float64(b)
+}
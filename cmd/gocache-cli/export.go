@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	pb "gocache/gocachepb"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// exportHeader 导出文件的列
+var exportHeader = []string{"node", "group", "key", "hash", "size", "age_ms", "expire", "hits"}
+
+// exportRecord 导出文件中的一行，对应 exportHeader
+type exportRecord struct {
+	node, group, key string
+	hash             uint64
+	size             int64
+	ageMs            int64
+	expire           time.Time // 零值表示永不过期
+	hits             int64
+}
+
+// exportWriter 按导出格式写入记录，close 写入缓存的数据和文件末尾，不关闭底层的文件
+type exportWriter interface {
+	write(r exportRecord) error
+	close() error
+}
+
+// csvWriter 把记录写成CSV，expire 为RFC3339格式，永不过期时为空
+type csvWriter struct {
+	w *csv.Writer
+}
+
+// newCSVWriter 创建 csvWriter 并写入表头，写入的错误在 close 时返回
+func newCSVWriter(w io.Writer) *csvWriter {
+	c := &csvWriter{w: csv.NewWriter(w)}
+	c.w.Write(exportHeader)
+	return c
+}
+
+func (c *csvWriter) write(r exportRecord) error {
+	expire := ""
+	if !r.expire.IsZero() {
+		expire = r.expire.Format(time.RFC3339)
+	}
+	return c.w.Write([]string{
+		r.node, r.group, r.key,
+		strconv.FormatUint(r.hash, 10),
+		strconv.FormatInt(r.size, 10),
+		strconv.FormatInt(r.ageMs, 10),
+		expire,
+		strconv.FormatInt(r.hits, 10),
+	})
+}
+
+func (c *csvWriter) close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// runExport 逐个节点分页调用 Scan，将key的元数据写入CSV或Parquet文件
+func runExport(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	addrs := fs.String("addrs", "localhost:9999", "comma separated addresses of all gocache nodes")
+	group := fs.String("group", "", "group to export")
+	format := fs.String("format", "csv", "output format, csv or parquet")
+	out := fs.String("out", "-", "output file, - for stdout")
+	page := fs.Int("page", 1000, "number of keys fetched per Scan call")
+	rate := fs.Float64("rate", 10, "maximum Scan calls per second on each node, 0 for unlimited")
+	fs.Parse(args)
+
+	if *group == "" {
+		return fmt.Errorf("--group is required")
+	}
+	if *format != "csv" && *format != "parquet" {
+		return fmt.Errorf("unsupported format %q, expect csv or parquet", *format)
+	}
+
+	w := io.Writer(os.Stdout)
+	if *out != "-" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	var ew exportWriter
+	if *format == "parquet" {
+		ew = newParquetWriter(w)
+	} else {
+		ew = newCSVWriter(w)
+	}
+	for _, addr := range strings.Split(*addrs, ",") {
+		if addr = strings.TrimSpace(addr); addr == "" {
+			continue
+		}
+		n, err := exportNode(ctx, ew, addr, *group, *page, *rate)
+		if err != nil {
+			return fmt.Errorf("export %s: %v", addr, err)
+		}
+		fmt.Fprintf(os.Stderr, "exported %d keys from %s\n", n, addr)
+	}
+	return ew.close()
+}
+
+// exportNode 导出一个节点上的key，返回导出的数量
+func exportNode(ctx context.Context, ew exportWriter, addr, group string, page int, rate float64) (int, error) {
+	conn, err := dial(addr)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	client := pb.NewGroupCacheClient(conn)
+
+	// 限制 Scan 的频率，避免导出影响线上请求
+	var tick <-chan time.Time
+	if rate > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / rate))
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	n, cursor := 0, ""
+	for {
+		resp, err := client.Scan(ctx, &pb.ScanRequest{Group: group, Cursor: cursor, Limit: int32(page)})
+		if err != nil {
+			return n, err
+		}
+		now := time.Now()
+		for _, k := range resp.GetKeys() {
+			record := exportRecord{
+				node:  addr,
+				group: group,
+				key:   k.GetKey(),
+				hash:  k.GetHash(),
+				size:  k.GetSize(),
+				ageMs: now.Sub(time.Unix(0, k.GetAdded())).Milliseconds(),
+				hits:  k.GetHits(),
+			}
+			if k.GetExpire() != 0 {
+				record.expire = time.Unix(0, k.GetExpire())
+			}
+			if err := ew.write(record); err != nil {
+				return n, err
+			}
+			n++
+		}
+		if cursor = resp.GetNextCursor(); cursor == "" {
+			return n, nil
+		}
+		if tick != nil {
+			select {
+			case <-tick:
+			case <-ctx.Done():
+				return n, ctx.Err()
+			}
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	pb "gocache/gocachepb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+)
+
+/*
+gocache-cli 是gocache节点的命令行工具，直接通过gRPC连接指定的节点。
+
+	gocache-cli events --addr localhost:9999 --group scores --types miss,eviction
+
+实时打印节点上的缓存事件，便于在发布过程中观察缓存的行为，Ctrl+C 退出。
+
+	gocache-cli export --addrs localhost:9999,localhost:10000 --group scores --out keys.csv
+	gocache-cli export --addrs localhost:9999,localhost:10000 --group scores --format parquet --out keys.parquet
+
+通过 Scan RPC 分页导出所有节点上key的元数据(hash、大小、存活时间、命中次数)，用于离线分析。
+*/
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	var err error
+	switch os.Args[1] {
+	case "events":
+		err = runEvents(os.Args[2:])
+	case "export":
+		err = runExport(os.Args[2:])
+	case "-h", "--help", "help":
+		usage()
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", os.Args[1])
+		usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "gocache-cli:", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, `usage: gocache-cli <command> [flags]
+
+commands:
+  events    tail live cache events from a node
+  export    export key metadata of all nodes to a CSV or Parquet file`)
+}
+
+// runEvents 订阅节点的事件流并逐行打印
+func runEvents(args []string) error {
+	fs := flag.NewFlagSet("events", flag.ExitOnError)
+	addr := fs.String("addr", "localhost:9999", "address of the gocache node")
+	group := fs.String("group", "", "only show events of this group, empty for all groups")
+	types := fs.String("types", "", "comma separated event types: hit,miss,load,load_error,eviction,set,capacity_warning; empty for all")
+	fs.Parse(args)
+
+	req := &pb.EventsRequest{Group: *group}
+	for _, t := range strings.Split(*types, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			req.Types = append(req.Types, t)
+		}
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+	conn, err := dial(*addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	stream, err := pb.NewGroupCacheClient(conn).Events(ctx, req)
+	if err != nil {
+		return err
+	}
+	for {
+		e, err := stream.Recv()
+		if err == io.EOF || ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s %-10s %s/%s size=%d\n",
+			time.Unix(0, e.GetTime()).Format("15:04:05.000"), e.GetType(), e.GetGroup(), e.GetKey(), e.GetSize())
+	}
+}
+
+// dial 建立到节点的gRPC连接
+func dial(addr string) (*grpc.ClientConn, error) {
+	return grpc.Dial(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+}
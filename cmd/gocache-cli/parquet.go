@@ -0,0 +1,320 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+)
+
+// parquetRowGroupSize 每个行组的行数，写满后输出，导出时最多缓存这么多行
+const parquetRowGroupSize = 64 << 10
+
+// Parquet 格式中用到的常量，见 parquet.thrift
+const (
+	parquetInt64     = 2 // Type.INT64
+	parquetByteArray = 6 // Type.BYTE_ARRAY
+
+	parquetUTF8            = 0  // ConvertedType.UTF8
+	parquetTimestampMillis = 9  // ConvertedType.TIMESTAMP_MILLIS
+	parquetUint64          = 14 // ConvertedType.UINT_64
+
+	parquetPlain = 0 // Encoding.PLAIN
+	parquetRLE   = 3 // Encoding.RLE
+)
+
+// parquetColumn 描述导出文件的一列，str 和 int64 只设置其中一个；int64 返回false表示空值，只用于 optional 的列
+type parquetColumn struct {
+	name      string
+	converted int32
+	optional  bool
+	str       func(r *exportRecord) string
+	int64     func(r *exportRecord) (int64, bool)
+}
+
+// parquetColumns 与 exportHeader 一一对应
+var parquetColumns = []parquetColumn{
+	{name: "node", converted: parquetUTF8, str: func(r *exportRecord) string { return r.node }},
+	{name: "group", converted: parquetUTF8, str: func(r *exportRecord) string { return r.group }},
+	{name: "key", converted: parquetUTF8, str: func(r *exportRecord) string { return r.key }},
+	{name: "hash", converted: parquetUint64, int64: func(r *exportRecord) (int64, bool) { return int64(r.hash), true }},
+	{name: "size", converted: -1, int64: func(r *exportRecord) (int64, bool) { return r.size, true }},
+	{name: "age_ms", converted: -1, int64: func(r *exportRecord) (int64, bool) { return r.ageMs, true }},
+	{name: "expire", converted: parquetTimestampMillis, optional: true, int64: func(r *exportRecord) (int64, bool) {
+		return r.expire.UnixMilli(), !r.expire.IsZero()
+	}},
+	{name: "hits", converted: -1, int64: func(r *exportRecord) (int64, bool) { return r.hits, true }},
+}
+
+// parquetWriter 把导出的记录写成Parquet文件。只实现导出需要的子集，不依赖第三方库：
+// 扁平的schema、PLAIN 编码、不压缩，每 parquetRowGroupSize 行一个行组，每个列块只有一个数据页
+type parquetWriter struct {
+	w      *bufio.Writer
+	offset int64 // 已经写入的字节数
+	rows   []exportRecord
+	groups []parquetRowGroup
+	total  int64
+}
+
+// parquetRowGroup 记录已经写入的行组，用于生成文件末尾的元数据
+type parquetRowGroup struct {
+	rows   int64
+	chunks []parquetChunk
+}
+
+type parquetChunk struct {
+	offset int64 // 数据页的起始位置
+	size   int64 // 包括页头
+}
+
+func newParquetWriter(w io.Writer) *parquetWriter {
+	return &parquetWriter{w: bufio.NewWriter(w)}
+}
+
+func (p *parquetWriter) write(r exportRecord) error {
+	if p.offset == 0 {
+		if err := p.put([]byte("PAR1")); err != nil {
+			return err
+		}
+	}
+	p.rows = append(p.rows, r)
+	if len(p.rows) >= parquetRowGroupSize {
+		return p.flushRowGroup()
+	}
+	return nil
+}
+
+// close 写入剩余的行和文件末尾的元数据，不关闭底层的 io.Writer
+func (p *parquetWriter) close() error {
+	if p.offset == 0 {
+		if err := p.put([]byte("PAR1")); err != nil {
+			return err
+		}
+	}
+	if len(p.rows) > 0 {
+		if err := p.flushRowGroup(); err != nil {
+			return err
+		}
+	}
+	meta := p.fileMetaData()
+	footer := binary.LittleEndian.AppendUint32(meta, uint32(len(meta)))
+	if err := p.put(append(footer, "PAR1"...)); err != nil {
+		return err
+	}
+	return p.w.Flush()
+}
+
+func (p *parquetWriter) put(b []byte) error {
+	n, err := p.w.Write(b)
+	p.offset += int64(n)
+	return err
+}
+
+// flushRowGroup 把缓存的行按列写成一个行组
+func (p *parquetWriter) flushRowGroup() error {
+	g := parquetRowGroup{rows: int64(len(p.rows))}
+	for i := range parquetColumns {
+		data := encodeParquetColumn(&parquetColumns[i], p.rows)
+		var h thriftWriter
+		h.begin()   // PageHeader
+		h.i32(1, 0) // DATA_PAGE
+		h.i32(2, int32(len(data)))
+		h.i32(3, int32(len(data)))
+		h.structField(5) // DataPageHeader
+		h.i32(1, int32(len(p.rows)))
+		h.i32(2, parquetPlain)
+		h.i32(3, parquetRLE)
+		h.i32(4, parquetRLE)
+		h.end()
+		h.end()
+
+		chunk := parquetChunk{offset: p.offset, size: int64(len(h.buf) + len(data))}
+		if err := p.put(h.buf); err != nil {
+			return err
+		}
+		if err := p.put(data); err != nil {
+			return err
+		}
+		g.chunks = append(g.chunks, chunk)
+	}
+	p.groups = append(p.groups, g)
+	p.total += g.rows
+	p.rows = p.rows[:0]
+	return nil
+}
+
+// encodeParquetColumn 返回一列的数据页内容。optional 的列先写定义级别：4字节长度加上RLE编码，
+// 最大级别为1，每个值占1字节；空值不写入数据
+func encodeParquetColumn(c *parquetColumn, rows []exportRecord) []byte {
+	var buf []byte
+	if c.optional {
+		var levels []byte
+		for i := 0; i < len(rows); {
+			_, def := c.int64(&rows[i])
+			j := i + 1
+			for j < len(rows) {
+				if _, ok := c.int64(&rows[j]); ok != def {
+					break
+				}
+				j++
+			}
+			levels = binary.AppendUvarint(levels, uint64(j-i)<<1)
+			if def {
+				levels = append(levels, 1)
+			} else {
+				levels = append(levels, 0)
+			}
+			i = j
+		}
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(len(levels)))
+		buf = append(buf, levels...)
+	}
+	for i := range rows {
+		if c.str != nil {
+			s := c.str(&rows[i])
+			buf = binary.LittleEndian.AppendUint32(buf, uint32(len(s)))
+			buf = append(buf, s...)
+		} else if v, ok := c.int64(&rows[i]); ok {
+			buf = binary.LittleEndian.AppendUint64(buf, uint64(v))
+		}
+	}
+	return buf
+}
+
+// fileMetaData 返回文件末尾的 FileMetaData
+func (p *parquetWriter) fileMetaData() []byte {
+	var t thriftWriter
+	t.begin()
+	t.i32(1, 1) // version
+	t.list(2, thriftStruct, len(parquetColumns)+1)
+	t.begin() // 根节点
+	t.binary(4, "schema")
+	t.i32(5, int32(len(parquetColumns)))
+	t.end()
+	for _, c := range parquetColumns {
+		t.begin()
+		t.i32(1, c.physicalType())
+		if c.optional {
+			t.i32(3, 1) // OPTIONAL
+		} else {
+			t.i32(3, 0) // REQUIRED
+		}
+		t.binary(4, c.name)
+		if c.converted >= 0 {
+			t.i32(6, c.converted)
+		}
+		t.end()
+	}
+	t.i64(3, p.total)
+	t.list(4, thriftStruct, len(p.groups))
+	for _, g := range p.groups {
+		t.begin() // RowGroup
+		t.list(1, thriftStruct, len(g.chunks))
+		var size int64
+		for i, chunk := range g.chunks {
+			c := &parquetColumns[i]
+			size += chunk.size
+			t.begin() // ColumnChunk
+			t.i64(2, chunk.offset)
+			t.structField(3) // ColumnMetaData
+			t.i32(1, c.physicalType())
+			t.list(2, thriftI32, 2)
+			t.listI32(parquetPlain)
+			t.listI32(parquetRLE)
+			t.list(3, thriftBinary, 1)
+			t.listBinary(c.name)
+			t.i32(4, 0) // UNCOMPRESSED
+			t.i64(5, g.rows)
+			t.i64(6, chunk.size)
+			t.i64(7, chunk.size)
+			t.i64(9, chunk.offset)
+			t.end()
+			t.end()
+		}
+		t.i64(2, size)
+		t.i64(3, g.rows)
+		t.end()
+	}
+	t.binary(6, "gocache-cli")
+	t.end()
+	return t.buf
+}
+
+func (c *parquetColumn) physicalType() int32 {
+	if c.str != nil {
+		return parquetByteArray
+	}
+	return parquetInt64
+}
+
+// Thrift compact protocol 的类型
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// thriftWriter 按 Thrift compact protocol 编码 Parquet 的元数据，只实现用到的类型
+type thriftWriter struct {
+	buf  []byte
+	last []int16 // 每一层结构体中上一个字段的序号，字段头只记录差值
+}
+
+// begin 开始一个结构体，end 写入结束标记
+func (t *thriftWriter) begin() { t.last = append(t.last, 0) }
+
+func (t *thriftWriter) end() {
+	t.buf = append(t.buf, 0)
+	t.last = t.last[:len(t.last)-1]
+}
+
+func (t *thriftWriter) field(id int16, typ byte) {
+	last := &t.last[len(t.last)-1]
+	if d := id - *last; d > 0 && d <= 15 {
+		t.buf = append(t.buf, byte(d)<<4|typ)
+	} else {
+		t.buf = append(t.buf, typ)
+		t.buf = binary.AppendVarint(t.buf, int64(id))
+	}
+	*last = id
+}
+
+func (t *thriftWriter) i32(id int16, v int32) {
+	t.field(id, thriftI32)
+	t.listI32(v)
+}
+
+func (t *thriftWriter) i64(id int16, v int64) {
+	t.field(id, thriftI64)
+	t.buf = binary.AppendVarint(t.buf, v)
+}
+
+func (t *thriftWriter) binary(id int16, s string) {
+	t.field(id, thriftBinary)
+	t.listBinary(s)
+}
+
+// structField 开始一个结构体类型的字段，之后需要调用 end
+func (t *thriftWriter) structField(id int16) {
+	t.field(id, thriftStruct)
+	t.begin()
+}
+
+// list 写入列表的头部，之后写入n个元素：结构体用 begin/end，其他类型用 listI32、listBinary
+func (t *thriftWriter) list(id int16, elem byte, n int) {
+	t.field(id, thriftList)
+	if n < 15 {
+		t.buf = append(t.buf, byte(n)<<4|elem)
+	} else {
+		t.buf = append(t.buf, 0xf0|elem)
+		t.buf = binary.AppendUvarint(t.buf, uint64(n))
+	}
+}
+
+func (t *thriftWriter) listI32(v int32) { t.buf = binary.AppendVarint(t.buf, int64(v)) }
+
+func (t *thriftWriter) listBinary(s string) {
+	t.buf = binary.AppendUvarint(t.buf, uint64(len(s)))
+	t.buf = append(t.buf, s...)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+func TestParquetWriter(t *testing.T) {
+	var buf bytes.Buffer
+	p := newParquetWriter(&buf)
+	for i, key := range []string{"alpha", "beta", "gamma"} {
+		r := exportRecord{node: "n1", group: "scores", key: key, hash: 1 << 63, size: 10, hits: int64(i)}
+		if i == 1 {
+			r.expire = time.UnixMilli(1700000000000)
+		}
+		if err := p.write(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := p.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	b := buf.Bytes()
+	if !bytes.HasPrefix(b, []byte("PAR1")) || !bytes.HasSuffix(b, []byte("PAR1")) {
+		t.Fatal("missing magic number")
+	}
+	n := int(binary.LittleEndian.Uint32(b[len(b)-8:]))
+	if n <= 0 || n > len(b)-12 {
+		t.Fatalf("bad footer length %d", n)
+	}
+	meta := b[len(b)-8-n : len(b)-8]
+	for _, name := range exportHeader {
+		if !bytes.Contains(meta, []byte(name)) {
+			t.Fatalf("column %s missing from the schema", name)
+		}
+	}
+	// key 列按 PLAIN 编码：4字节长度加上内容
+	key := binary.LittleEndian.AppendUint32(nil, 5)
+	if !bytes.Contains(b[4:len(b)-8-n], append(key, "alpha"...)) {
+		t.Fatal("key column does not contain alpha")
+	}
+	// expire 列的定义级别：长度6，三段RLE，每段1个值，依次为空、有值、空
+	levels := []byte{6, 0, 0, 0, 1 << 1, 0, 1 << 1, 1, 1 << 1, 0}
+	if !bytes.Contains(b, levels) {
+		t.Fatal("unexpected definition levels for expire")
+	}
+}
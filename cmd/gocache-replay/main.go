@@ -0,0 +1,156 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"gocache"
+	"gocache/consistenthash"
+	"gocache/replay"
+	"log"
+	"os"
+	"sort"
+)
+
+/*
+gocache-replay 在进程内的模拟集群上重放 gocache.StartRecording 录制的日志，报告各节点的请求数和未命中数，
+用于复现缓存击穿、负载不均等问题：
+
+	gocache-replay --trace trace.jsonl --type lru --cache-bytes 1048576
+
+模拟集群的节点由日志中的哈希环变化决定，日志中没有哈希环变化时只有一个节点。
+--speed 为0时不等待，结果只取决于操作顺序，每次重放都得到相同的结果。
+*/
+
+// nodeStats 一个节点的统计
+type nodeStats struct {
+	gets  int
+	loads int // 未命中后调用数据源的次数
+}
+
+// cluster 是进程内的模拟集群，实现了 replay.Target
+type cluster struct {
+	cacheType  string
+	cacheBytes int64
+	hash       consistenthash.Hash64
+
+	ring   *consistenthash.Map
+	groups map[string]*gocache.Group // node/group -> Group
+	sizes  map[string]int            // key -> 数据大小，数据源按该大小返回数据
+	stats  map[string]*nodeStats
+}
+
+func newCluster(cacheType string, cacheBytes int64, hash consistenthash.Hash64) *cluster {
+	c := &cluster{
+		cacheType:  cacheType,
+		cacheBytes: cacheBytes,
+		hash:       hash,
+		groups:     map[string]*gocache.Group{},
+		sizes:      map[string]int{},
+		stats:      map[string]*nodeStats{},
+	}
+	c.SetTopology([]string{"local"})
+	return c
+}
+
+func (c *cluster) SetTopology(nodes []string) error {
+	c.ring = consistenthash.NewWithHash64(50, c.hash)
+	c.ring.Add(nodes...)
+	return nil
+}
+
+// group 返回key的归属节点上的缓存组
+func (c *cluster) group(group, key string) (*gocache.Group, *nodeStats) {
+	node := c.ring.Get(key)
+	st, ok := c.stats[node]
+	if !ok {
+		st = &nodeStats{}
+		c.stats[node] = st
+	}
+	name := node + "/" + group
+	g, ok := c.groups[name]
+	if !ok {
+		g = gocache.NewGroup(name, c.cacheBytes, c.cacheType, gocache.GetterFunc(func(key string) ([]byte, error) {
+			st.loads++
+			return make([]byte, c.sizes[key]), nil
+		}))
+		c.groups[name] = g
+	}
+	return g, st
+}
+
+func (c *cluster) Get(group, key string, size int) error {
+	if size > 0 {
+		c.sizes[key] = size
+	}
+	g, st := c.group(group, key)
+	st.gets++
+	_, err := g.GetCacheData(key)
+	return err
+}
+
+func (c *cluster) Set(group, key string, size int) error {
+	c.sizes[key] = size
+	g, _ := c.group(group, key)
+	return g.Set(key, make([]byte, size), 0)
+}
+
+func (c *cluster) report() {
+	nodes := make([]string, 0, len(c.stats))
+	total := nodeStats{}
+	for node, st := range c.stats {
+		nodes = append(nodes, node)
+		total.gets += st.gets
+		total.loads += st.loads
+	}
+	sort.Strings(nodes)
+	fmt.Printf("%-24s %10s %10s %8s\n", "node", "gets", "loads", "miss%")
+	for _, node := range nodes {
+		st := c.stats[node]
+		fmt.Printf("%-24s %10d %10d %7.2f%%\n", node, st.gets, st.loads, percent(st.loads, st.gets))
+	}
+	fmt.Printf("%-24s %10d %10d %7.2f%%\n", "total", total.gets, total.loads, percent(total.loads, total.gets))
+}
+
+func percent(a, b int) float64 {
+	if b == 0 {
+		return 0
+	}
+	return 100 * float64(a) / float64(b)
+}
+
+func main() {
+	trace := flag.String("trace", "", "trace file recorded by gocache.StartRecording")
+	cacheType := flag.String("type", "lru", "cache type of the simulated nodes: lru or lfu")
+	cacheBytes := flag.Int64("cache-bytes", 2<<20, "cache bytes of each group on each simulated node")
+	hash := flag.String("hash", "crc32", "ring hash function: crc32, xxhash64 or murmur3")
+	speed := flag.Float64("speed", 0, "replay speed relative to the recording, 0 for as fast as possible")
+	flag.Parse()
+	log.SetOutput(os.Stderr)
+
+	if *trace == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	hashes := map[string]consistenthash.Hash64{
+		"crc32":    consistenthash.CRC32,
+		"xxhash64": consistenthash.XXHash64,
+		"murmur3":  consistenthash.Murmur3,
+	}
+	fn, ok := hashes[*hash]
+	if !ok {
+		log.Fatalf("unknown hash %q", *hash)
+	}
+	f, err := os.Open(*trace)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+
+	c := newCluster(*cacheType, *cacheBytes, fn)
+	n, err := replay.Replay(f, c, *speed)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("replayed %d ops\n", n)
+	c.report()
+}
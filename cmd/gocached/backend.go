@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gocache"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// backendFactory 根据配置中的 backend 创建缓存组的数据源
+type backendFactory func(u *url.URL, opts backendOptions) (gocache.Getter, error)
+
+// backendOptions 所有数据源共用的参数
+type backendOptions struct {
+	timeout time.Duration // 一次读取的超时时间
+	maxSize int64         // 数据的最大字节数，0表示不限制
+}
+
+// backends 按 backend 的scheme注册的数据源，新增数据源时在这里注册
+var backends = map[string]backendFactory{
+	"none":  newNoneBackend,
+	"http":  newHTTPBackend,
+	"https": newHTTPBackend,
+	"file":  newFileBackend,
+}
+
+// newBackend 解析 backend 并创建数据源，为空时等同于 none://
+func newBackend(spec string, opts backendOptions) (gocache.Getter, error) {
+	if spec == "" {
+		spec = "none://"
+	}
+	u, err := url.Parse(spec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid backend %q: %v", spec, err)
+	}
+	f, ok := backends[u.Scheme]
+	if !ok {
+		return nil, fmt.Errorf("unknown backend %q, expect one of none, http, https, file", u.Scheme)
+	}
+	return f(u, opts)
+}
+
+// newNoneBackend 没有数据源，数据只能通过写入接口进入缓存，未命中时返回 ErrNotFound
+func newNoneBackend(*url.URL, backendOptions) (gocache.Getter, error) {
+	return gocache.GetterFunc(func(key string) ([]byte, error) {
+		return nil, gocache.ErrNotFound
+	}), nil
+}
+
+// httpBackend 通过HTTP GET读取数据，URL中的 {key} 替换为转义后的key。404表示key不存在，
+// 响应的 Cache-Control: max-age 作为数据的过期时间
+type httpBackend struct {
+	template string
+	client   *http.Client
+	maxSize  int64
+}
+
+func newHTTPBackend(u *url.URL, opts backendOptions) (gocache.Getter, error) {
+	template := u.String()
+	if !strings.Contains(template, "%7Bkey%7D") && !strings.Contains(template, "{key}") {
+		return nil, fmt.Errorf("http backend %q must contain {key}", template)
+	}
+	// url.URL.String 会转义路径中的花括号
+	template = strings.ReplaceAll(template, "%7Bkey%7D", "{key}")
+	return &httpBackend{template: template, client: &http.Client{Timeout: opts.timeout}, maxSize: opts.maxSize}, nil
+}
+
+func (b *httpBackend) Get(key string) ([]byte, error) {
+	value, _, err := b.GetWithTTL(key)
+	return value, err
+}
+
+func (b *httpBackend) GetWithTTL(key string) ([]byte, time.Duration, error) {
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, strings.ReplaceAll(b.template, "{key}", url.PathEscape(key)), nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, 0, fmt.Errorf("%s: %w", key, gocache.ErrNotFound)
+	case resp.StatusCode != http.StatusOK:
+		return nil, 0, fmt.Errorf("backend returned %s for %s", resp.Status, key)
+	}
+	body := io.Reader(resp.Body)
+	if b.maxSize > 0 {
+		body = io.LimitReader(resp.Body, b.maxSize+1)
+	}
+	value, err := io.ReadAll(body)
+	if err != nil {
+		return nil, 0, err
+	}
+	if b.maxSize > 0 && int64(len(value)) > b.maxSize {
+		return nil, 0, fmt.Errorf("value of %s exceeds %d bytes", key, b.maxSize)
+	}
+	return value, maxAge(resp.Header.Get("Cache-Control")), nil
+}
+
+// maxAge 返回 Cache-Control 中的 max-age，没有时返回0(使用缓存组的默认过期时间)
+func maxAge(cacheControl string) time.Duration {
+	for _, directive := range strings.Split(cacheControl, ",") {
+		if v, ok := strings.CutPrefix(strings.TrimSpace(directive), "max-age="); ok {
+			if n, err := strconv.Atoi(v); err == nil && n > 0 {
+				return time.Duration(n) * time.Second
+			}
+		}
+	}
+	return 0
+}
+
+// fileBackend 从目录中读取与key同名的文件，key中不能包含 .. 等跳出目录的路径
+type fileBackend struct {
+	root    string
+	maxSize int64
+}
+
+func newFileBackend(u *url.URL, opts backendOptions) (gocache.Getter, error) {
+	root := u.Path
+	if u.Host != "" { // file://relative/dir
+		root = u.Host + u.Path
+	}
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, fmt.Errorf("file backend: %v", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("file backend: %s is not a directory", root)
+	}
+	return &fileBackend{root: root, maxSize: opts.maxSize}, nil
+}
+
+func (b *fileBackend) Get(key string) ([]byte, error) {
+	if !fs.ValidPath(key) {
+		return nil, fmt.Errorf("invalid key %q for file backend", key)
+	}
+	path := filepath.Join(b.root, filepath.FromSlash(key))
+	if b.maxSize > 0 {
+		if info, err := os.Stat(path); err == nil && info.Size() > b.maxSize {
+			return nil, fmt.Errorf("value of %s exceeds %d bytes", key, b.maxSize)
+		}
+	}
+	value, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%s: %w", key, gocache.ErrNotFound)
+	}
+	return value, err
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"gocache"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHTTPBackend(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/items/a b" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Cache-Control", "public, max-age=60")
+		w.Write([]byte("value"))
+	}))
+	defer origin.Close()
+
+	getter, err := newBackend(origin.URL+"/items/{key}", backendOptions{timeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	value, ttl, err := getter.(gocache.TTLGetter).GetWithTTL("a b")
+	if err != nil || string(value) != "value" || ttl != time.Minute {
+		t.Fatalf("got %q %v %v", value, ttl, err)
+	}
+	if _, err := getter.Get("missing"); !errors.Is(err, gocache.ErrNotFound) {
+		t.Fatalf("expect ErrNotFound, got %v", err)
+	}
+	limited, _ := newBackend(origin.URL+"/items/{key}", backendOptions{maxSize: 3})
+	if _, err := limited.Get("a b"); err == nil {
+		t.Fatal("expect error for a value over the size limit")
+	}
+	if _, err := newBackend(origin.URL+"/items", backendOptions{}); err == nil {
+		t.Fatal("expect error for a template without {key}")
+	}
+}
+
+func TestFileBackend(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "k"), []byte("v"), 0o600)
+	getter, err := newBackend("file://"+dir, backendOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, err := getter.Get("k"); err != nil || string(v) != "v" {
+		t.Fatalf("got %q %v", v, err)
+	}
+	if _, err := getter.Get("missing"); !errors.Is(err, gocache.ErrNotFound) {
+		t.Fatalf("expect ErrNotFound, got %v", err)
+	}
+	if _, err := getter.Get("../k"); err == nil || errors.Is(err, gocache.ErrNotFound) {
+		t.Fatalf("expect path outside the directory to be rejected, got %v", err)
+	}
+
+	none, _ := newBackend("", backendOptions{})
+	if _, err := none.Get("k"); !errors.Is(err, gocache.ErrNotFound) {
+		t.Fatalf("none backend: %v", err)
+	}
+	if _, err := newBackend("redis://localhost", backendOptions{}); err == nil {
+		t.Fatal("expect error for an unknown backend")
+	}
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"gocache"
+	"gocache/config"
+	"log"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+/*
+gocached 是独立运行的gocache节点：从配置文件(见 gocache/config)创建缓存组和服务，收到 SIGTERM/SIGINT 后
+先从注册中心注销，等待进行中的请求完成再退出。再次收到信号时立即退出。
+
+收到 SIGHUP 或者调用管理接口的 POST /admin/reload 时重新读取配置文件，缓存组的容量、过期时间、热点阈值、
+速率限制、内存预算和日志级别立即生效，缓存的数据保留；其他设置需要重启，日志中会列出这些设置。
+
+	gocached --config /etc/gocache/node.toml --ops 127.0.0.1:6060 --dashboard
+
+--dashboard 在运维端口上开启网页控制台 http://127.0.0.1:6060/debug/dashboard/，显示节点、哈希环分布、
+各缓存组的命中率和内存占用、热点key以及最近被淘汰的数据。
+
+每个缓存组的数据源由配置中的 backend 指定：
+
+	none://                                  没有数据源(默认)，数据只能通过 Put 写入
+	http://origin/api/items/{key}            HTTP GET，404表示key不存在，Cache-Control: max-age 作为过期时间
+	file:///var/lib/gocache/data             读取目录中与key同名的文件
+
+配置中有 peers 时只使用这些节点，否则注册到etcd并从etcd发现其他节点。
+
+缓存组配置了 warmup_keys 时，启动后从该文件读取key列表，预先加载归本节点所有的key；
+同时配置 [warmup] min_ratio 时，预热达到该比例(或超时)之后才注册并对外提供服务。
+
+配置了 [snapshots] 时，启动时从最新的有效快照恢复缓存的数据，运行期间定期保存快照，退出前再保存一次，
+计划内的重启不需要重新从数据源加载。快照保存在本地目录(dir)或者S3兼容的对象存储([snapshots.s3])中，
+对象存储的访问密钥从 AWS_ACCESS_KEY_ID、AWS_SECRET_ACCESS_KEY 读取。
+*/
+
+// options 命令行参数，覆盖配置文件
+type options struct {
+	configPath      string
+	addr            string
+	opsAddr         string
+	dashboard       bool
+	adminAddr       string
+	adminToken      string
+	logLevel        string // 为空时使用配置文件中的 log_level
+	drainWindow     time.Duration
+	shutdownTimeout time.Duration
+	backendTimeout  time.Duration
+}
+
+func parseFlags(args []string, getenv func(string) string) (options, error) {
+	fs := flag.NewFlagSet("gocached", flag.ContinueOnError)
+	configPath := fs.String("config", getenv(config.EnvConfig), "TOML or JSON config file, defaults to GOCACHE_CONFIG")
+	addr := fs.String("addr", "", "advertised address of this node, overrides the config file")
+	opsAddr := fs.String("ops", getenv("GOCACHE_OPS"), "ops address serving /debug/pprof, /debug/ring and /debug/groups, empty to disable")
+	dashboard := fs.Bool("dashboard", false, "serve the web dashboard at /debug/dashboard/ on the ops address")
+	adminAddr := fs.String("admin", getenv("GOCACHE_ADMIN"), "admin API address (token from GOCACHE_ADMIN_TOKEN), empty to disable")
+	logLevel := fs.String("log-level", "", "minimum log level: debug, info, warn or error, overrides log_level in the config file")
+	drainWindow := fs.Duration("drain-window", 5*time.Second, "keep serving for this long after deregistering on shutdown")
+	shutdownTimeout := fs.Duration("shutdown-timeout", 30*time.Second, "max time to wait for in-flight requests on shutdown")
+	backendTimeout := fs.Duration("backend-timeout", 5*time.Second, "timeout of a single backend read")
+	if err := fs.Parse(args); err != nil {
+		return options{}, err
+	}
+	o := options{
+		configPath:      *configPath,
+		addr:            *addr,
+		opsAddr:         *opsAddr,
+		dashboard:       *dashboard,
+		adminAddr:       *adminAddr,
+		adminToken:      getenv("GOCACHE_ADMIN_TOKEN"),
+		logLevel:        *logLevel,
+		drainWindow:     *drainWindow,
+		shutdownTimeout: *shutdownTimeout,
+		backendTimeout:  *backendTimeout,
+	}
+	if o.configPath == "" {
+		return options{}, fmt.Errorf("-config or GOCACHE_CONFIG is required")
+	}
+	if o.dashboard && o.opsAddr == "" {
+		return options{}, fmt.Errorf("-dashboard requires -ops")
+	}
+	if o.adminAddr != "" && o.adminToken == "" {
+		return options{}, fmt.Errorf("-admin requires GOCACHE_ADMIN_TOKEN")
+	}
+	return o, nil
+}
+
+// loadConfig 读取配置文件并应用命令行参数
+func loadConfig(o options, getenv func(string) string) (*config.Config, error) {
+	cfg, err := config.Load(o.configPath, getenv)
+	if err != nil {
+		return nil, err
+	}
+	if o.addr != "" {
+		cfg.Advertise = o.addr
+	}
+	if len(cfg.Groups) == 0 {
+		return nil, fmt.Errorf("%s: no groups configured", o.configPath)
+	}
+	if _, err := logLevel(o, cfg); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// logLevel 返回日志级别，命令行参数优先于配置文件，都没有设置时为info
+func logLevel(o options, cfg *config.Config) (slog.Level, error) {
+	name := o.logLevel
+	if name == "" {
+		name = cfg.LogLevel
+	}
+	var level slog.Level
+	if name == "" {
+		return level, nil
+	}
+	if err := level.UnmarshalText([]byte(name)); err != nil {
+		return level, fmt.Errorf("unknown log level %q", name)
+	}
+	return level, nil
+}
+
+// newGroups 按配置创建所有缓存组
+func newGroups(cfg *config.Config, o options, logger gocache.Logger) ([]*gocache.Group, error) {
+	groups := make([]*gocache.Group, 0, len(cfg.Groups))
+	budget := cfg.NewMemoryBudget()
+	for _, gc := range cfg.Groups {
+		getter, err := newBackend(gc.Backend, backendOptions{timeout: o.backendTimeout, maxSize: int64(cfg.Limits.MaxValueSize)})
+		if err != nil {
+			return nil, fmt.Errorf("group %s: %v", gc.Name, err)
+		}
+		groups = append(groups, gc.NewGroup(getter, gocache.WithGroupLogger(logger), gocache.WithMemoryBudget(budget, gc.MemoryPriority)))
+	}
+	return groups, nil
+}
+
+// newServer 按配置创建服务，并把缓存组注册到服务
+func newServer(cfg *config.Config, o options, logger gocache.Logger, groups []*gocache.Group, extra ...gocache.ServerOption) (*gocache.Server, error) {
+	opts, err := cfg.ServerOptions()
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts, gocache.WithLogger(logger), gocache.WithDrainWindow(o.drainWindow))
+	opts = append(opts, extra...)
+	if len(cfg.Peers) > 0 {
+		opts = append(opts, gocache.WithStaticPeers(cfg.Peers...))
+	} else {
+		opts = append(opts, gocache.WithDiscovery())
+	}
+	if o.opsAddr != "" {
+		opts = append(opts, gocache.WithOpsListener(o.opsAddr))
+	}
+	if o.dashboard {
+		opts = append(opts, gocache.WithDashboard(0))
+	}
+	if o.adminAddr != "" {
+		opts = append(opts, gocache.WithAdminListener(o.adminAddr, o.adminToken))
+	}
+	svr, err := gocache.NewServer(cfg.Advertise, opts...)
+	if err != nil {
+		return nil, err
+	}
+	for _, g := range groups {
+		g.RegisterPeers(svr)
+	}
+	return svr, nil
+}
+
+// run 启动节点，直到ctx被取消后优雅退出
+func run(ctx context.Context, cfg *config.Config, o options, getenv func(string) string) error {
+	level := new(slog.LevelVar)
+	lv, err := logLevel(o, cfg)
+	if err != nil {
+		return err
+	}
+	level.Set(lv)
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level}))
+	d := &daemon{opts: o, getenv: getenv, level: level, logger: logger, cfg: cfg}
+
+	groups, err := newGroups(cfg, o, logger)
+	if err != nil {
+		return err
+	}
+	svr, err := newServer(cfg, o, logger, groups, gocache.WithReload(d.reload))
+	if err != nil {
+		return err
+	}
+	d.svr = svr
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	errc := make(chan error, 1)
+	go func() {
+		// Start 会一直阻塞，直到服务停止或出错
+		if err := svr.Start(); err != nil {
+			errc <- err
+		}
+	}()
+	go func() {
+		for err := range svr.Err() { // 后台错误(例如etcd暂时不可用)只记录日志，注册会自动重试
+			logger.Warn("background error", "err", err)
+		}
+	}()
+	logger.Info("gocached started", "addr", cfg.Advertise, "groups", len(groups))
+
+wait:
+	for {
+		select {
+		case <-hup:
+			if _, err := d.reload(); err != nil {
+				logger.Error("reload failed, keeping the current config", "err", err)
+			}
+		case <-ctx.Done():
+			logger.Info("shutting down", "timeout", o.shutdownTimeout)
+			break wait
+		case err := <-errc:
+			return err
+		}
+	}
+	if err := svr.GracefulStop(o.shutdownTimeout); err != nil {
+		if errors.Is(err, gocache.ErrDrainTimeout) {
+			logger.Warn("in-flight requests did not finish before the shutdown timeout")
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+func main() {
+	o, err := parseFlags(os.Args[1:], os.Getenv)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	cfg, err := loadConfig(o, os.Getenv)
+	if err != nil {
+		log.Fatal(err)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop() // 恢复默认的信号处理，再次收到信号时立即退出
+	}()
+	if err := run(ctx, cfg, o, os.Getenv); err != nil {
+		log.Fatal(err)
+	}
+}
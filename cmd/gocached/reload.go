@@ -0,0 +1,41 @@
+package main
+
+import (
+	"gocache"
+	"gocache/config"
+	"log/slog"
+	"sync"
+)
+
+// daemon 运行中的节点，保存当前的配置用于重新加载
+type daemon struct {
+	opts   options
+	getenv func(string) string
+	level  *slog.LevelVar
+	logger *slog.Logger
+	svr    *gocache.Server
+
+	mu  sync.Mutex // 保护 cfg，SIGHUP 和 /admin/reload 可能同时触发重新加载
+	cfg *config.Config
+}
+
+// reload 重新读取配置文件并应用可以在运行时修改的设置，实现了 gocache.ReloadFunc。
+// 配置文件有错误时保留当前的配置；需要重启的设置只在第一次发现变化时报告
+func (d *daemon) reload() ([]string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	cfg, err := loadConfig(d.opts, d.getenv)
+	if err != nil {
+		return nil, err
+	}
+	level, _ := logLevel(d.opts, cfg) // loadConfig 已经校验过
+	restart := config.Reload(d.cfg, cfg, d.svr)
+	d.level.Set(level)
+	d.cfg = cfg
+	if len(restart) > 0 {
+		d.logger.Warn("config reloaded, some settings require a restart", "restart_required", restart)
+	} else {
+		d.logger.Info("config reloaded")
+	}
+	return restart, nil
+}
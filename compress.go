@@ -0,0 +1,38 @@
+package gocache
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding"
+	_ "google.golang.org/grpc/encoding/gzip" // 注册gzip压缩算法
+)
+
+// WithCompression 开启节点之间传输的压缩：本节点返回(Get、BatchGet、GetStream)或写入(Put)不小于 minSize 字节的数据时，
+// 使用名为name的压缩算法，例如 "gzip"。gzip 已经注册，snappy、zstd 等算法需要先通过 encoding.RegisterCompressor 注册。
+// 对方节点没有注册该算法时不压缩，因此可以逐个节点开启。
+func WithCompression(name string, minSize int) GroupOption {
+	return func(g *Group) {
+		g.compression = name
+		g.compressMin = minSize
+	}
+}
+
+// compressor 返回传输size字节的数据时使用的压缩算法，不压缩时返回空字符串
+func (g *Group) compressor(size int) string {
+	if g.compression == "" || size < g.compressMin || encoding.GetCompressor(g.compression) == nil {
+		return ""
+	}
+	return g.compression
+}
+
+// setSendCompressor 数据达到阈值时设置响应使用的压缩算法，ctx 必须是gRPC传给处理函数的上下文
+func setSendCompressor(ctx context.Context, g *Group, size int) {
+	name := g.compressor(size)
+	if name == "" {
+		return
+	}
+	if err := grpc.SetSendCompressor(ctx, name); err != nil { // 请求方不支持该算法
+		g.logger.Debug("send uncompressed", "group", g.name, "bytes", size, "error", err)
+	}
+}
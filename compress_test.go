@@ -0,0 +1,67 @@
+package gocache
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync/atomic"
+	"testing"
+
+	pb "gocache/gocachepb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/encoding/gzip"
+)
+
+// countingCompressor 包装gzip并统计压缩次数，用于确认服务端是否压缩了响应
+type countingCompressor struct {
+	encoding.Compressor
+	n int32
+}
+
+func (c *countingCompressor) Compress(w io.Writer) (io.WriteCloser, error) {
+	atomic.AddInt32(&c.n, 1)
+	return c.Compressor.Compress(w)
+}
+
+func (c *countingCompressor) Name() string { return "counting-gzip" }
+
+func TestCompression(t *testing.T) {
+	counter := &countingCompressor{Compressor: encoding.GetCompressor(gzip.Name)}
+	encoding.RegisterCompressor(counter)
+
+	large := bytes.Repeat([]byte("a"), 4096)
+	NewGroup("compress", 1<<20, "lru", GetterFunc(func(key string) ([]byte, error) {
+		if key == "small" {
+			return []byte("s"), nil
+		}
+		return large, nil
+	}), WithCompression(counter.Name(), 1024))
+
+	svr, _ := NewServer("127.0.0.1:9708")
+	addr, stop := serveGRPC(t, svr)
+	defer stop()
+
+	conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	cli := pb.NewGroupCacheClient(conn)
+
+	get := func(key string) {
+		resp, err := cli.Get(context.Background(), &pb.Request{Group: "compress", Key: key, ProtocolVersion: protocolVersion})
+		if err != nil || !resp.Found {
+			t.Fatalf("get %s: %v", key, err)
+		}
+	}
+	get("small")
+	if n := atomic.LoadInt32(&counter.n); n != 0 {
+		t.Fatalf("small values should not be compressed, got %d", n)
+	}
+	get("large")
+	if n := atomic.LoadInt32(&counter.n); n != 1 {
+		t.Fatalf("large values should be compressed once, got %d", n)
+	}
+}
@@ -0,0 +1,581 @@
+// Package config 从文件加载节点的声明式配置：监听和公布的地址、etcd、TLS证书、限流以及缓存组的容量、淘汰策略和过期时间，
+// 环境变量覆盖文件中的值，用于不修改代码部署节点。
+//
+// 文件格式由扩展名决定：.toml 为TOML(支持表、表数组、字符串、数字、布尔值和数组，不支持内联表和日期)，
+// .json 为JSON。字段名与TOML/JSON中的键相同，未知的键会报错，避免拼写错误被忽略：
+//
+//	listen = "0.0.0.0:8001"
+//	advertise = "10.0.0.1:8001"
+//
+//	[etcd]
+//	endpoints = ["10.0.0.10:2379"]
+//	dial_timeout = "5s"
+//
+//	[tls]
+//	cert = "/etc/gocache/node.pem"
+//	key = "/etc/gocache/node-key.pem"
+//	ca = "/etc/gocache/ca.pem"
+//
+//	[limits]
+//	max_in_flight = 1000
+//	rate_limit = 5000
+//	memory_budget = "1GiB"
+//
+//	[warmup]
+//	min_ratio = 0.9
+//	timeout = "2m"
+//
+//	[snapshots]
+//	dir = "/var/lib/gocache/snapshots"
+//	interval = "10m"
+//	retain = 3
+//
+//	[[groups]]
+//	name = "scores"
+//	cache_bytes = "64MiB"
+//	policy = "lfu"
+//	ttl = "10m"
+//	memory_priority = 2
+//	warmup_keys = "/var/lib/gocache/scores.keys"
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"gocache"
+	"gocache/registry"
+	"gocache/s3store"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 覆盖配置文件的环境变量，etcd的环境变量与 registry.EtcdConfigFromEnv 相同
+const (
+	EnvListen    = "GOCACHE_LISTEN"     // 监听地址
+	EnvAdvertise = "GOCACHE_ADDR"       // 对外公布的地址，与示例程序的 -addr 相同
+	EnvPeers     = "GOCACHE_PEERS"      // 逗号分隔的静态节点列表
+	EnvZone      = "GOCACHE_ZONE"       // 本节点所在的可用区
+	EnvTLSCert   = "GOCACHE_TLS_CERT"   // 节点证书文件
+	EnvTLSKey    = "GOCACHE_TLS_KEY"    // 节点证书的私钥文件
+	EnvTLSCA     = "GOCACHE_TLS_CA"     // 校验其他节点证书的CA文件
+	EnvGroupBase = "GOCACHE_GROUP_"     // 缓存组的覆盖以 GOCACHE_GROUP_<NAME>_ 开头，见 Config.ApplyEnv
+	EnvConfig    = "GOCACHE_CONFIG"     // 配置文件的路径，由使用本包的程序读取
+	EnvRateLimit = "GOCACHE_RATE_LIMIT" // 每秒允许的请求数，见 Limits.RateLimit
+)
+
+// Config 节点的配置
+type Config struct {
+	Listen    string    `json:"listen,omitempty"`    // 监听地址，为空时监听 Advertise
+	Advertise string    `json:"advertise"`           // 对外公布的地址，即节点在哈希环上的名字
+	Peers     []string  `json:"peers,omitempty"`     // 静态节点列表，为空时从注册中心发现
+	Namespace string    `json:"namespace,omitempty"` // 节点在etcd中注册的命名空间，见 gocache.WithNamespace
+	Zone      string    `json:"zone,omitempty"`      // 见 gocache.WithZone
+	Weight    int       `json:"weight,omitempty"`    // 见 gocache.WithWeight
+	LogLevel  string    `json:"log_level,omitempty"` // debug、info、warn 或 error，由使用本包的程序解释
+	Etcd      Etcd      `json:"etcd"`
+	TLS       TLS       `json:"tls"`
+	Limits    Limits    `json:"limits"`
+	Warmup    Warmup    `json:"warmup"`
+	Snapshots Snapshots `json:"snapshots"`
+	Groups    []Group   `json:"groups,omitempty"`
+}
+
+// Etcd 连接etcd的配置，为空的字段使用默认值或环境变量
+type Etcd struct {
+	Endpoints   []string `json:"endpoints,omitempty"`
+	Username    string   `json:"username,omitempty"`
+	Password    string   `json:"password,omitempty"`
+	DialTimeout Duration `json:"dial_timeout,omitempty"`
+	Cert        string   `json:"cert,omitempty"` // 客户端证书文件
+	Key         string   `json:"key,omitempty"`  // 客户端证书的私钥文件
+	CA          string   `json:"ca,omitempty"`   // 校验etcd服务端证书的CA文件
+}
+
+// TLS 节点之间双向认证的证书文件，见 gocache.WithTLSFiles。三个字段都为空表示不开启
+type TLS struct {
+	Cert string `json:"cert,omitempty"`
+	Key  string `json:"key,omitempty"`
+	CA   string `json:"ca,omitempty"`
+}
+
+// Limits 节点的限流和资源限制，0表示不限制或使用默认值
+type Limits struct {
+	RPCTimeout           Duration `json:"rpc_timeout,omitempty"`            // 见 gocache.WithRPCTimeout
+	MaxValueSize         Size     `json:"max_value_size,omitempty"`         // 见 gocache.WithMaxValueSize
+	MaxConcurrentStreams uint32   `json:"max_concurrent_streams,omitempty"` // 见 gocache.WithMaxConcurrentStreams
+	MaxInFlight          int64    `json:"max_in_flight,omitempty"`          // 见 gocache.WithLoadShedding
+	RateLimit            float64  `json:"rate_limit,omitempty"`             // 每秒请求数，见 gocache.WithRateLimit
+	RateBurst            int      `json:"rate_burst,omitempty"`
+	RatePerCaller        bool     `json:"rate_per_caller,omitempty"`
+	MemoryBudget         Size     `json:"memory_budget,omitempty"` // 所有缓存组共享的内存预算，见 gocache.MemoryBudget
+}
+
+// Warmup 节点注册之前的预热要求，见 gocache.WithWarmGate。MinRatio 为0表示不等待预热
+type Warmup struct {
+	MinRatio float64  `json:"min_ratio,omitempty"`
+	Timeout  Duration `json:"timeout,omitempty"` // 0表示一直等待
+}
+
+// Snapshots 定期保存缓存组的快照，启动时从最新的快照恢复，见 gocache.WithSnapshots。Dir 和 S3.Bucket 都为空表示不开启
+type Snapshots struct {
+	Dir      string   `json:"dir,omitempty"`      // 保存快照的本地目录
+	Interval Duration `json:"interval,omitempty"` // 0表示只在停止时保存
+	Retain   int      `json:"retain,omitempty"`   // 每个缓存组保留的快照数量，0表示3个
+	S3       S3       `json:"s3"`
+}
+
+// S3 保存快照的S3兼容对象存储，见 gocache/s3store。访问密钥只从环境变量 AWS_ACCESS_KEY_ID、AWS_SECRET_ACCESS_KEY 读取
+type S3 struct {
+	Endpoint     string `json:"endpoint,omitempty"` // 为空时使用AWS S3
+	Region       string `json:"region,omitempty"`
+	Bucket       string `json:"bucket,omitempty"`
+	Prefix       string `json:"prefix,omitempty"` // 每个节点应当使用不同的前缀
+	AccessKey    string `json:"-"`
+	SecretKey    string `json:"-"`
+	SessionToken string `json:"-"`
+}
+
+// Group 一个缓存组的配置，数据源由程序在创建缓存组时提供，见 Group.NewGroup
+type Group struct {
+	Name            string   `json:"name"`
+	CacheBytes      Size     `json:"cache_bytes"`
+	Policy          string   `json:"policy,omitempty"` // lru 或 lfu，默认 lru
+	TTL             Duration `json:"ttl,omitempty"`    // 默认过期时间，见 gocache.WithDefaultTTL
+	ErrorTTL        Duration `json:"error_ttl,omitempty"`
+	PeerTimeout     Duration `json:"peer_timeout,omitempty"`
+	HedgeDelay      Duration `json:"hedge_delay,omitempty"`
+	HotKeyThreshold int      `json:"hot_key_threshold,omitempty"` // 每分钟的远程读取次数，见 gocache.WithHotKeyThreshold
+	LoadWorkers     int      `json:"load_workers,omitempty"`      // 见 gocache.WithLoadPool
+	LoadQueue       int      `json:"load_queue,omitempty"`
+	MemoryPriority  int      `json:"memory_priority,omitempty"`      // 在 limits.memory_budget 中的优先级，默认1，见 gocache.WithMemoryBudget
+	SlabSize        Size     `json:"slab_size,omitempty"`            // 开启slab分配器时每块slab的大小，见 gocache.WithSlabAllocator
+	EvictLow        float64  `json:"evict_low_watermark,omitempty"`  // 超出容量时一次淘汰到容量的这个比例，见 gocache.WithEvictionWatermarks
+	EvictHigh       float64  `json:"evict_high_watermark,omitempty"` // 占用超过容量的这个比例时在后台淘汰，0表示不开启
+	WarmupKeys      string   `json:"warmup_keys,omitempty"`          // 启动时预热的key列表文件，每行一个key，见 gocache.WithStartupWarmup
+	WarmupWorkers   int      `json:"warmup_workers,omitempty"`       // 预热的并发数，默认1
+	Backend         string   `json:"backend,omitempty"`              // 数据源，由使用本包的程序解释，例如 gocached 的 http://host/path/{key}
+}
+
+// Load 读取配置文件，应用环境变量后校验，getenv 一般传入 os.Getenv
+func Load(path string, getenv func(string) string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := Parse(data, strings.TrimPrefix(filepath.Ext(path), "."))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if err := cfg.ApplyEnv(getenv); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return cfg, nil
+}
+
+// Parse 解析toml或json格式的配置，不应用环境变量也不校验
+func Parse(data []byte, format string) (*Config, error) {
+	switch format {
+	case "toml":
+		doc, err := parseTOML(data)
+		if err != nil {
+			return nil, err
+		}
+		if data, err = json.Marshal(doc); err != nil {
+			return nil, err
+		}
+	case "json":
+	default:
+		return nil, fmt.Errorf("unsupported config format %q, expect toml or json", format)
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	cfg := &Config{}
+	if err := dec.Decode(cfg); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// ApplyEnv 用环境变量覆盖配置，没有设置的环境变量不改变配置。缓存组的覆盖为
+// GOCACHE_GROUP_<NAME>_CACHE_BYTES、_POLICY、_TTL 和 _BACKEND，NAME 为缓存组名的大写，非字母数字的字符替换为下划线
+func (c *Config) ApplyEnv(getenv func(string) string) error {
+	setString := func(dst *string, key string) {
+		if v := getenv(key); v != "" {
+			*dst = v
+		}
+	}
+	setList := func(dst *[]string, key string) {
+		if v := getenv(key); v != "" {
+			*dst = splitList(v)
+		}
+	}
+	setString(&c.Listen, EnvListen)
+	setString(&c.Advertise, EnvAdvertise)
+	setList(&c.Peers, EnvPeers)
+	setString(&c.Namespace, gocache.EnvNamespace)
+	setString(&c.Zone, EnvZone)
+	setList(&c.Etcd.Endpoints, registry.EnvEtcdEndpoints)
+	setString(&c.Etcd.Username, registry.EnvEtcdUsername)
+	setString(&c.Etcd.Password, registry.EnvEtcdPassword)
+	setString(&c.Etcd.Cert, registry.EnvEtcdCert)
+	setString(&c.Etcd.Key, registry.EnvEtcdKey)
+	setString(&c.Etcd.CA, registry.EnvEtcdCA)
+	setString(&c.TLS.Cert, EnvTLSCert)
+	setString(&c.TLS.Key, EnvTLSKey)
+	setString(&c.TLS.CA, EnvTLSCA)
+	setString(&c.Snapshots.S3.Endpoint, s3store.EnvEndpoint)
+	setString(&c.Snapshots.S3.Region, s3store.EnvRegion)
+	setString(&c.Snapshots.S3.AccessKey, s3store.EnvAccessKey)
+	setString(&c.Snapshots.S3.SecretKey, s3store.EnvSecretKey)
+	setString(&c.Snapshots.S3.SessionToken, s3store.EnvSessionToken)
+	if err := c.Etcd.DialTimeout.setEnv(getenv, registry.EnvEtcdDialTimeout); err != nil {
+		return err
+	}
+	if v := getenv(EnvRateLimit); v != "" {
+		qps, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return fmt.Errorf("%s: %v", EnvRateLimit, err)
+		}
+		c.Limits.RateLimit = qps
+	}
+	for i := range c.Groups {
+		g := &c.Groups[i]
+		prefix := EnvGroupBase + envName(g.Name) + "_"
+		if v := getenv(prefix + "CACHE_BYTES"); v != "" {
+			if err := g.CacheBytes.UnmarshalText([]byte(v)); err != nil {
+				return fmt.Errorf("%sCACHE_BYTES: %v", prefix, err)
+			}
+		}
+		setString(&g.Policy, prefix+"POLICY")
+		setString(&g.Backend, prefix+"BACKEND")
+		if err := g.TTL.setEnv(getenv, prefix+"TTL"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Validate 校验配置
+func (c *Config) Validate() error {
+	if c.Advertise == "" {
+		return fmt.Errorf("advertise is required")
+	}
+	for _, addr := range []string{c.Listen, c.Advertise} {
+		if addr != "" && !strings.Contains(addr, ":") {
+			return fmt.Errorf("address %q must be host:port", addr)
+		}
+	}
+	if t := c.TLS; (t.Cert != "" || t.Key != "" || t.CA != "") && (t.Cert == "" || t.Key == "" || t.CA == "") {
+		return fmt.Errorf("tls requires cert, key and ca together")
+	}
+	if c.Limits.MemoryBudget < 0 {
+		return fmt.Errorf("limits.memory_budget must not be negative")
+	}
+	if c.Warmup.MinRatio < 0 || c.Warmup.MinRatio > 1 {
+		return fmt.Errorf("warmup.min_ratio must be between 0 and 1")
+	}
+	if sn := c.Snapshots; sn.Dir != "" && sn.S3.Bucket != "" {
+		return fmt.Errorf("snapshots: dir and s3 are mutually exclusive")
+	} else if sn.Interval < 0 || sn.Retain < 0 {
+		return fmt.Errorf("snapshots: interval and retain must not be negative")
+	}
+	seen := map[string]bool{}
+	for _, g := range c.Groups {
+		switch {
+		case g.Name == "":
+			return fmt.Errorf("group name is required")
+		case seen[g.Name]:
+			return fmt.Errorf("duplicate group %q", g.Name)
+		case g.CacheBytes <= 0:
+			return fmt.Errorf("group %q: cache_bytes must be positive", g.Name)
+		case g.Policy != "" && g.Policy != "lru" && g.Policy != "lfu":
+			return fmt.Errorf("group %q: unknown policy %q", g.Name, g.Policy)
+		case g.TTL < 0 || g.ErrorTTL < 0:
+			return fmt.Errorf("group %q: ttl must not be negative", g.Name)
+		case g.HotKeyThreshold < 0:
+			return fmt.Errorf("group %q: hot_key_threshold must not be negative", g.Name)
+		case g.WarmupWorkers < 0:
+			return fmt.Errorf("group %q: warmup_workers must not be negative", g.Name)
+		case g.MemoryPriority < 0:
+			return fmt.Errorf("group %q: memory_priority must not be negative", g.Name)
+		case g.SlabSize < 0:
+			return fmt.Errorf("group %q: slab_size must not be negative", g.Name)
+		case g.EvictLow < 0 || g.EvictLow >= 1 || g.EvictLow == 0 && g.EvictHigh != 0:
+			return fmt.Errorf("group %q: evict_low_watermark must be between 0 and 1", g.Name)
+		case g.EvictHigh != 0 && (g.EvictHigh <= g.EvictLow || g.EvictHigh > 1):
+			return fmt.Errorf("group %q: evict_high_watermark must be between evict_low_watermark and 1", g.Name)
+		}
+		seen[g.Name] = true
+	}
+	return nil
+}
+
+// Group 返回名为name的缓存组的配置
+func (c *Config) Group(name string) (Group, bool) {
+	for _, g := range c.Groups {
+		if g.Name == name {
+			return g, true
+		}
+	}
+	return Group{}, false
+}
+
+// ServerOptions 返回创建 gocache.Server 的选项，不包括节点列表和发现方式，由程序根据 Peers 决定。
+// 读取etcd的证书失败时返回错误，节点证书的错误由 gocache.NewServer 返回。
+func (c *Config) ServerOptions() ([]gocache.ServerOption, error) {
+	var opts []gocache.ServerOption
+	if c.Listen != "" && c.Listen != c.Advertise {
+		opts = append(opts, gocache.WithListenAddr(c.Listen))
+	}
+	if c.Namespace != "" {
+		opts = append(opts, gocache.WithNamespace(c.Namespace))
+	}
+	if c.Zone != "" {
+		opts = append(opts, gocache.WithZone(c.Zone))
+	}
+	if c.Weight > 0 {
+		opts = append(opts, gocache.WithWeight(c.Weight))
+	}
+	if len(c.Etcd.Endpoints) > 0 {
+		opts = append(opts, gocache.WithEtcdEndpoints(c.Etcd.Endpoints...))
+	}
+	if c.Etcd.Username != "" {
+		opts = append(opts, gocache.WithEtcdAuth(c.Etcd.Username, c.Etcd.Password))
+	}
+	if c.Etcd.DialTimeout > 0 {
+		opts = append(opts, gocache.WithEtcdDialTimeout(time.Duration(c.Etcd.DialTimeout)))
+	}
+	if c.Etcd.Cert != "" || c.Etcd.Key != "" || c.Etcd.CA != "" {
+		tlsCfg, err := registry.LoadEtcdTLS(c.Etcd.Cert, c.Etcd.Key, c.Etcd.CA)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, gocache.WithEtcdTLS(tlsCfg))
+	}
+	if c.TLS.Cert != "" {
+		opts = append(opts, gocache.WithTLSFiles(c.TLS.Cert, c.TLS.Key, c.TLS.CA))
+	}
+	l := c.Limits
+	if l.RPCTimeout > 0 {
+		opts = append(opts, gocache.WithRPCTimeout(time.Duration(l.RPCTimeout)))
+	}
+	if l.MaxValueSize > 0 {
+		opts = append(opts, gocache.WithMaxValueSize(int64(l.MaxValueSize)))
+	}
+	if l.MaxConcurrentStreams > 0 {
+		opts = append(opts, gocache.WithMaxConcurrentStreams(l.MaxConcurrentStreams))
+	}
+	if l.MaxInFlight > 0 {
+		opts = append(opts, gocache.WithLoadShedding(l.MaxInFlight))
+	}
+	if l.RateLimit > 0 {
+		opts = append(opts, gocache.WithRateLimit(l.RateLimit, l.RateBurst, l.RatePerCaller))
+	}
+	if c.Warmup.MinRatio > 0 {
+		opts = append(opts, gocache.WithWarmGate(c.Warmup.MinRatio, time.Duration(c.Warmup.Timeout)))
+	}
+	if store, err := c.Snapshots.store(); err != nil {
+		return nil, err
+	} else if store != nil {
+		opts = append(opts, gocache.WithSnapshots(store, time.Duration(c.Snapshots.Interval), c.Snapshots.Retain))
+	}
+	for _, g := range c.Groups {
+		if g.WarmupKeys != "" {
+			opts = append(opts, gocache.WithStartupWarmup(g.Name, gocache.KeysFromFile(g.WarmupKeys), g.WarmupWorkers))
+		}
+	}
+	return opts, nil
+}
+
+// NewMemoryBudget 按 limits.memory_budget 创建缓存组共享的内存预算，没有设置时返回nil。
+// 创建缓存组时传入 gocache.WithMemoryBudget(budget, g.MemoryPriority)
+func (c *Config) NewMemoryBudget() *gocache.MemoryBudget {
+	if c.Limits.MemoryBudget <= 0 {
+		return nil
+	}
+	return gocache.NewMemoryBudget(int64(c.Limits.MemoryBudget))
+}
+
+// store 返回保存快照的存储，没有开启快照时返回nil
+func (sn Snapshots) store() (gocache.SnapshotStore, error) {
+	switch {
+	case sn.Dir != "":
+		return gocache.NewDirStore(sn.Dir)
+	case sn.S3.Bucket != "":
+		return &s3store.Store{
+			Endpoint:     sn.S3.Endpoint,
+			Region:       sn.S3.Region,
+			Bucket:       sn.S3.Bucket,
+			Prefix:       sn.S3.Prefix,
+			AccessKey:    sn.S3.AccessKey,
+			SecretKey:    sn.S3.SecretKey,
+			SessionToken: sn.S3.SessionToken,
+		}, nil
+	}
+	return nil, nil
+}
+
+// CacheType 返回 gocache.NewGroup 使用的缓存类型
+func (g Group) CacheType() string {
+	if g.Policy == "" {
+		return "lru"
+	}
+	return g.Policy
+}
+
+// Options 返回缓存组的选项
+func (g Group) Options() []gocache.GroupOption {
+	var opts []gocache.GroupOption
+	if g.TTL > 0 {
+		opts = append(opts, gocache.WithDefaultTTL(time.Duration(g.TTL)))
+	}
+	if g.ErrorTTL > 0 {
+		opts = append(opts, gocache.WithErrorCacheTTL(time.Duration(g.ErrorTTL)))
+	}
+	if g.PeerTimeout > 0 {
+		opts = append(opts, gocache.WithPeerTimeout(time.Duration(g.PeerTimeout)))
+	}
+	if g.HedgeDelay > 0 {
+		opts = append(opts, gocache.WithHedging(time.Duration(g.HedgeDelay)))
+	}
+	if g.HotKeyThreshold > 0 {
+		opts = append(opts, gocache.WithHotKeyThreshold(g.HotKeyThreshold))
+	}
+	if g.LoadWorkers > 0 {
+		opts = append(opts, gocache.WithLoadPool(g.LoadWorkers, g.LoadQueue))
+	}
+	if g.SlabSize > 0 {
+		opts = append(opts, gocache.WithSlabAllocator(int(g.SlabSize)))
+	}
+	if g.EvictLow > 0 {
+		opts = append(opts, gocache.WithEvictionWatermarks(g.EvictLow, g.EvictHigh))
+	}
+	return opts
+}
+
+// NewGroup 按配置创建缓存组，opts 在配置的选项之后应用，可以覆盖配置
+func (g Group) NewGroup(getter gocache.Getter, opts ...gocache.GroupOption) *gocache.Group {
+	return gocache.NewGroup(g.Name, int64(g.CacheBytes), g.CacheType(), getter, append(g.Options(), opts...)...)
+}
+
+// Duration 是可以从 "30s" 这样的字符串或纳秒数解析的时间间隔
+type Duration time.Duration
+
+// UnmarshalJSON 实现了 json.Unmarshaler
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	if len(b) > 0 && b[0] == '"' {
+		var s string
+		if err := json.Unmarshal(b, &s); err != nil {
+			return err
+		}
+		v, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		*d = Duration(v)
+		return nil
+	}
+	var n int64
+	if err := json.Unmarshal(b, &n); err != nil {
+		return fmt.Errorf("invalid duration %s", b)
+	}
+	*d = Duration(n)
+	return nil
+}
+
+// MarshalJSON 实现了 json.Marshaler
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// setEnv 环境变量key设置时解析其值
+func (d *Duration) setEnv(getenv func(string) string, key string) error {
+	v := getenv(key)
+	if v == "" {
+		return nil
+	}
+	parsed, err := time.ParseDuration(v)
+	if err != nil {
+		return fmt.Errorf("%s: %v", key, err)
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// Size 是字节数，可以写成数字或者带单位的字符串，例如 "512KB"、"64MiB"、"1G"，单位按1024进制
+type Size int64
+
+var sizeUnits = []struct {
+	suffix string
+	n      int64
+}{
+	{"KiB", 1 << 10}, {"MiB", 1 << 20}, {"GiB", 1 << 30},
+	{"KB", 1 << 10}, {"MB", 1 << 20}, {"GB", 1 << 30},
+	{"K", 1 << 10}, {"M", 1 << 20}, {"G", 1 << 30},
+	{"B", 1},
+}
+
+// UnmarshalText 解析带单位的字节数
+func (s *Size) UnmarshalText(text []byte) error {
+	str := strings.TrimSpace(string(text))
+	mult := int64(1)
+	for _, u := range sizeUnits {
+		if rest, ok := strings.CutSuffix(str, u.suffix); ok {
+			str, mult = strings.TrimSpace(rest), u.n
+			break
+		}
+	}
+	n, err := strconv.ParseInt(str, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid size %q", text)
+	}
+	*s = Size(n * mult)
+	return nil
+}
+
+// UnmarshalJSON 实现了 json.Unmarshaler，接受数字和字符串
+func (s *Size) UnmarshalJSON(b []byte) error {
+	if len(b) > 0 && b[0] == '"' {
+		var str string
+		if err := json.Unmarshal(b, &str); err != nil {
+			return err
+		}
+		return s.UnmarshalText([]byte(str))
+	}
+	var n int64
+	if err := json.Unmarshal(b, &n); err != nil {
+		return fmt.Errorf("invalid size %s", b)
+	}
+	*s = Size(n)
+	return nil
+}
+
+// envName 把缓存组名转换为环境变量名的一部分
+func envName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
@@ -0,0 +1,145 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const sample = `
+# 节点配置
+listen = "0.0.0.0:8001"
+advertise = "10.0.0.1:8001"
+peers = [
+  "10.0.0.1:8001",
+  "10.0.0.2:8001", # 第二个节点
+]
+
+[etcd]
+endpoints = ["10.0.0.10:2379"]
+dial_timeout = "3s"
+
+[snapshots]
+interval = "10m"
+[snapshots.s3]
+bucket = "gocache"
+prefix = "node-1/"
+
+[limits]
+max_in_flight = 1_000
+rate_limit = 2500.5
+max_value_size = "4MiB"
+memory_budget = "256MiB"
+
+[[groups]]
+name = "scores"
+cache_bytes = "64MiB"
+policy = "lfu"
+ttl = "10m"
+memory_priority = 2
+slab_size = "1MiB"
+evict_low_watermark = 0.9
+evict_high_watermark = 0.95
+
+[[groups]]
+name = "user-profiles"
+cache_bytes = 1048576
+error_ttl = 1_000_000_000
+warmup_keys = "profiles.keys"
+warmup_workers = 4
+`
+
+func TestParseTOML(t *testing.T) {
+	cfg, err := Parse([]byte(sample), "toml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Config{
+		Listen:    "0.0.0.0:8001",
+		Advertise: "10.0.0.1:8001",
+		Peers:     []string{"10.0.0.1:8001", "10.0.0.2:8001"},
+		Etcd:      Etcd{Endpoints: []string{"10.0.0.10:2379"}, DialTimeout: Duration(3 * time.Second)},
+		Limits:    Limits{MaxInFlight: 1000, RateLimit: 2500.5, MaxValueSize: 4 << 20, MemoryBudget: 256 << 20},
+		Snapshots: Snapshots{Interval: Duration(10 * time.Minute), S3: S3{Bucket: "gocache", Prefix: "node-1/"}},
+		Groups: []Group{
+			{Name: "scores", CacheBytes: 64 << 20, Policy: "lfu", TTL: Duration(10 * time.Minute), MemoryPriority: 2, SlabSize: 1 << 20,
+				EvictLow: 0.9, EvictHigh: 0.95},
+			{Name: "user-profiles", CacheBytes: 1 << 20, ErrorTTL: Duration(time.Second), WarmupKeys: "profiles.keys", WarmupWorkers: 4},
+		},
+	}
+	if !reflect.DeepEqual(cfg, want) {
+		t.Fatalf("got %+v\nwant %+v", cfg, want)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if opts, err := cfg.ServerOptions(); err != nil || len(opts) != 8 {
+		t.Fatalf("server options: %d %v", len(opts), err)
+	}
+	if b := cfg.NewMemoryBudget(); b == nil || b.Limit() != 256<<20 {
+		t.Fatalf("memory budget %v", b)
+	}
+	if g, ok := cfg.Group("user-profiles"); !ok || g.CacheType() != "lru" || len(g.Options()) != 1 {
+		t.Fatalf("group %+v %v", g, ok)
+	}
+	if g, _ := cfg.Group("scores"); len(g.Options()) != 3 {
+		t.Fatalf("scores options: %d", len(g.Options()))
+	}
+	cfg.Groups[0].EvictHigh = 0.8
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("expect error for evict_high_watermark below evict_low_watermark")
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, doc := range []string{
+		`unknown = 1`,                   // 未知的键
+		`advertise = "a:1`,              // 字符串没有闭合
+		"peers = [\"a\"",                // 数组没有闭合
+		`[etcd]` + "\n" + `[etcd]`,      // 表定义了两次
+		`advertise = 1`,                 // 类型错误
+		`tls = {cert = "a"}`,            // 内联表
+		`advertise = "a:1" "b"`,         // 值后面多余的内容
+		`[[groups]]` + "\nttl = 5x",     // 无效的值
+		`[[groups]]` + "\nttl = \"5x\"", // 无效的时间
+	} {
+		if _, err := Parse([]byte(doc), "toml"); err == nil {
+			t.Errorf("expect error for %q", doc)
+		}
+	}
+	if _, err := Parse([]byte(`advertise: a`), "yaml"); err == nil {
+		t.Error("expect error for unsupported format")
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "node.json")
+	os.WriteFile(path, []byte(`{"advertise": "a:1", "groups": [{"name": "scores", "cache_bytes": "2MB"}]}`), 0o600)
+	env := map[string]string{
+		"GOCACHE_ADDR":                     "b:1",
+		"GOCACHE_ETCD_ENDPOINTS":           "e1:2379, e2:2379",
+		"GOCACHE_GROUP_SCORES_CACHE_BYTES": "1G",
+		"GOCACHE_GROUP_SCORES_TTL":         "1m",
+	}
+	cfg, err := Load(path, func(k string) string { return env[k] })
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, _ := cfg.Group("scores")
+	if cfg.Advertise != "b:1" || len(cfg.Etcd.Endpoints) != 2 || g.CacheBytes != 1<<30 || g.TTL != Duration(time.Minute) {
+		t.Fatalf("env overrides not applied: %+v", cfg)
+	}
+
+	env["GOCACHE_GROUP_SCORES_POLICY"] = "fifo"
+	if _, err := Load(path, func(k string) string { return env[k] }); err == nil || !strings.Contains(err.Error(), "fifo") {
+		t.Fatalf("expect unknown policy error, got %v", err)
+	}
+	env = map[string]string{"GOCACHE_TLS_CERT": "node.pem"}
+	if _, err := Load(path, func(k string) string { return env[k] }); err == nil {
+		t.Fatal("expect tls without key and ca to be rejected")
+	}
+}
@@ -0,0 +1,84 @@
+package config
+
+import (
+	"gocache"
+	"reflect"
+	"time"
+)
+
+// Reload 把新配置中可以在运行时修改的设置应用到运行中的节点，已经缓存的数据保留：缓存组的容量、默认过期时间和热点阈值，
+// 以及节点的速率限制、并发上限和内存预算的大小。地址、etcd、TLS等其他设置以及缓存组的增删需要重启才能生效，返回这些发生了变化的设置的名字，
+// 例如 "tls"、"groups.scores"。日志级别由程序自己处理。cur 应当已经通过 Validate 校验
+func Reload(old, cur *Config, svr *gocache.Server) (restartRequired []string) {
+	changed := func(name string, differ bool) {
+		if differ {
+			restartRequired = append(restartRequired, name)
+		}
+	}
+	changed("listen", old.Listen != cur.Listen)
+	changed("advertise", old.Advertise != cur.Advertise)
+	changed("peers", !reflect.DeepEqual(old.Peers, cur.Peers))
+	changed("namespace", old.Namespace != cur.Namespace)
+	changed("zone", old.Zone != cur.Zone)
+	changed("weight", old.Weight != cur.Weight)
+	changed("etcd", !reflect.DeepEqual(old.Etcd, cur.Etcd))
+	changed("tls", old.TLS != cur.TLS)
+	changed("warmup", old.Warmup != cur.Warmup)
+	changed("snapshots", old.Snapshots != cur.Snapshots)
+
+	ol, cl := old.Limits, cur.Limits
+	changed("limits.rpc_timeout", ol.RPCTimeout != cl.RPCTimeout)
+	changed("limits.max_value_size", ol.MaxValueSize != cl.MaxValueSize)
+	changed("limits.max_concurrent_streams", ol.MaxConcurrentStreams != cl.MaxConcurrentStreams)
+	if ol.RateLimit != cl.RateLimit || ol.RateBurst != cl.RateBurst || ol.RatePerCaller != cl.RatePerCaller {
+		svr.SetRateLimit(cl.RateLimit, cl.RateBurst, cl.RatePerCaller)
+	}
+	if ol.MaxInFlight != cl.MaxInFlight {
+		svr.SetLoadShedding(cl.MaxInFlight)
+	}
+	if ol.MemoryBudget != cl.MemoryBudget {
+		// 开启或关闭内存预算需要重新创建缓存组
+		b := memoryBudget(old)
+		changed("limits.memory_budget", b == nil || cl.MemoryBudget == 0)
+		if b != nil && cl.MemoryBudget > 0 {
+			b.SetLimit(int64(cl.MemoryBudget))
+		}
+	}
+
+	for _, g := range cur.Groups {
+		prev, ok := old.Group(g.Name)
+		group := gocache.GetGroup(g.Name)
+		if !ok || group == nil {
+			changed("groups."+g.Name, true)
+			continue
+		}
+		if g.CacheBytes != prev.CacheBytes {
+			group.Resize(int64(g.CacheBytes))
+		}
+		if g.TTL != prev.TTL {
+			group.SetDefaultTTL(time.Duration(g.TTL))
+		}
+		if g.HotKeyThreshold != prev.HotKeyThreshold {
+			group.SetHotKeyThreshold(g.HotKeyThreshold)
+		}
+		// 去掉可以在运行时修改的字段后比较其余的设置
+		prev.CacheBytes, prev.TTL, prev.HotKeyThreshold = g.CacheBytes, g.TTL, g.HotKeyThreshold
+		changed("groups."+g.Name, prev != g)
+	}
+	for _, g := range old.Groups {
+		if _, ok := cur.Group(g.Name); !ok {
+			changed("groups."+g.Name, true)
+		}
+	}
+	return restartRequired
+}
+
+// memoryBudget 返回按配置创建的缓存组所在的内存预算，没有时返回nil
+func memoryBudget(c *Config) *gocache.MemoryBudget {
+	for _, g := range c.Groups {
+		if group := gocache.GetGroup(g.Name); group != nil && group.MemoryBudget() != nil {
+			return group.MemoryBudget()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package config
+
+import (
+	"gocache"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestReload(t *testing.T) {
+	old, err := Parse([]byte(`
+advertise = "127.0.0.1:9851"
+[limits]
+rate_limit = 100
+[[groups]]
+name = "reload"
+cache_bytes = 1024
+ttl = "1m"
+`), "toml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, _ := old.Group("reload")
+	group := g.NewGroup(gocache.GetterFunc(func(key string) ([]byte, error) { return []byte(key), nil }))
+	svr, _ := gocache.NewServer(old.Advertise)
+	group.Set("k", []byte("v"), 0)
+
+	cur, _ := Parse([]byte(`
+advertise = "127.0.0.1:9851"
+[tls]
+cert = "node.pem"
+key = "node-key.pem"
+ca = "ca.pem"
+[[groups]]
+name = "reload"
+cache_bytes = 2048
+ttl = "5m"
+hot_key_threshold = 3
+[[groups]]
+name = "reload-added"
+cache_bytes = 1024
+`), "toml")
+	restart := Reload(old, cur, svr)
+	if want := []string{"tls", "groups.reload-added"}; !reflect.DeepEqual(restart, want) {
+		t.Fatalf("restart required = %v, want %v", restart, want)
+	}
+	c := group.Config()
+	if c.Capacity != 2048 || c.DefaultTTL != 5*time.Minute || c.HotKeyThreshold != 3 {
+		t.Fatalf("group config after reload %+v", c)
+	}
+	if _, ok := group.Inspect("k"); !ok {
+		t.Fatal("cached data should survive a reload")
+	}
+
+	// 修改淘汰策略需要重启
+	prev, next := *cur, *cur
+	prev.Groups = cur.Groups[:1]
+	next.Groups = []Group{cur.Groups[0]}
+	next.Groups[0].Policy = "lfu"
+	if restart := Reload(&prev, &next, svr); !reflect.DeepEqual(restart, []string{"groups.reload"}) {
+		t.Fatalf("restart required = %v", restart)
+	}
+
+	// 内存预算的大小可以在运行时修改，开启或关闭需要重启
+	withBudget := func(budget string) *Config {
+		c, err := Parse([]byte(`
+advertise = "127.0.0.1:9851"
+[limits]
+memory_budget = `+budget+`
+[[groups]]
+name = "reload-budget"
+cache_bytes = 1024
+`), "toml")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	prev = *withBudget("4096")
+	budget := prev.NewMemoryBudget()
+	prev.Groups[0].NewGroup(gocache.GetterFunc(func(key string) ([]byte, error) { return []byte(key), nil }), gocache.WithMemoryBudget(budget, 1))
+	if restart := Reload(&prev, withBudget("2048"), svr); len(restart) != 0 || budget.Limit() != 2048 {
+		t.Fatalf("restart required = %v, budget %d", restart, budget.Limit())
+	}
+	if restart := Reload(withBudget("2048"), withBudget("0"), svr); !reflect.DeepEqual(restart, []string{"limits.memory_budget"}) {
+		t.Fatalf("restart required = %v", restart)
+	}
+}
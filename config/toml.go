@@ -0,0 +1,321 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseTOML 解析TOML的一个子集：注释、[表]、[[表数组]]、点分隔的键、基本字符串和字面量字符串、整数、浮点数、布尔值以及
+// 可以跨行的数组。不支持多行字符串、内联表和日期时间。返回的文档可以直接由 encoding/json 序列化
+func parseTOML(data []byte) (map[string]interface{}, error) {
+	p := &tomlParser{root: map[string]interface{}{}, defined: map[string]bool{}}
+	cur := p.root
+	lines := strings.Split(string(data), "\n")
+	for i := 0; i < len(lines); i++ {
+		lineNo := i + 1
+		line := strings.TrimSpace(stripComment(lines[i]))
+		if line == "" {
+			continue
+		}
+		var err error
+		switch {
+		case strings.HasPrefix(line, "[["):
+			if !strings.HasSuffix(line, "]]") {
+				return nil, fmt.Errorf("line %d: unterminated table array header", lineNo)
+			}
+			cur, err = p.arrayTable(line[2 : len(line)-2])
+		case strings.HasPrefix(line, "["):
+			if !strings.HasSuffix(line, "]") {
+				return nil, fmt.Errorf("line %d: unterminated table header", lineNo)
+			}
+			cur, err = p.table(line[1 : len(line)-1])
+		default:
+			key, val, ok := strings.Cut(line, "=")
+			if !ok {
+				return nil, fmt.Errorf("line %d: expect key = value", lineNo)
+			}
+			// 数组没有闭合时拼接后续的行
+			for bracketDepth(val) > 0 && i+1 < len(lines) {
+				i++
+				val += "\n" + stripComment(lines[i])
+			}
+			err = p.set(cur, key, val)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNo, err)
+		}
+	}
+	return p.root, nil
+}
+
+type tomlParser struct {
+	root    map[string]interface{}
+	defined map[string]bool // 已经由 [表] 定义的表，同一个表不能定义两次
+}
+
+// table 处理 [a.b] 并返回该表
+func (p *tomlParser) table(header string) (map[string]interface{}, error) {
+	keys, err := splitKey(header)
+	if err != nil {
+		return nil, err
+	}
+	path := strings.Join(keys, "\x00")
+	if p.defined[path] {
+		return nil, fmt.Errorf("table [%s] defined twice", header)
+	}
+	p.defined[path] = true
+	return descend(p.root, keys)
+}
+
+// arrayTable 处理 [[a.b]]，在表数组的末尾添加一个表并返回
+func (p *tomlParser) arrayTable(header string) (map[string]interface{}, error) {
+	keys, err := splitKey(header)
+	if err != nil {
+		return nil, err
+	}
+	parent, err := descend(p.root, keys[:len(keys)-1])
+	if err != nil {
+		return nil, err
+	}
+	last := keys[len(keys)-1]
+	var arr []interface{}
+	switch v := parent[last].(type) {
+	case nil:
+	case []interface{}:
+		arr = v
+	default:
+		return nil, fmt.Errorf("key %q is not a table array", last)
+	}
+	t := map[string]interface{}{}
+	parent[last] = append(arr, t)
+	return t, nil
+}
+
+// set 解析 key = value 并写入表t
+func (p *tomlParser) set(t map[string]interface{}, rawKey, rawVal string) error {
+	keys, err := splitKey(rawKey)
+	if err != nil {
+		return err
+	}
+	parent, err := descend(t, keys[:len(keys)-1])
+	if err != nil {
+		return err
+	}
+	val, rest, err := parseValue(strings.TrimSpace(rawVal))
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(rest) != "" {
+		return fmt.Errorf("unexpected %q after value", strings.TrimSpace(rest))
+	}
+	last := keys[len(keys)-1]
+	if _, ok := parent[last]; ok {
+		return fmt.Errorf("key %q defined twice", last)
+	}
+	parent[last] = val
+	return nil
+}
+
+// descend 从表t沿着keys找到或创建子表，经过表数组时进入最后一个表
+func descend(t map[string]interface{}, keys []string) (map[string]interface{}, error) {
+	for _, k := range keys {
+		switch v := t[k].(type) {
+		case nil:
+			sub := map[string]interface{}{}
+			t[k] = sub
+			t = sub
+		case map[string]interface{}:
+			t = v
+		case []interface{}:
+			var last map[string]interface{}
+			if len(v) > 0 {
+				last, _ = v[len(v)-1].(map[string]interface{})
+			}
+			if last == nil {
+				return nil, fmt.Errorf("key %q is not a table", k)
+			}
+			t = last
+		default:
+			return nil, fmt.Errorf("key %q is not a table", k)
+		}
+	}
+	return t, nil
+}
+
+// splitKey 解析点分隔的键，每一段是裸键或者带引号的键
+func splitKey(s string) ([]string, error) {
+	var keys []string
+	s = strings.TrimSpace(s)
+	for {
+		var key string
+		switch {
+		case s == "":
+			return nil, fmt.Errorf("empty key")
+		case s[0] == '"' || s[0] == '\'':
+			v, rest, err := parseString(s)
+			if err != nil {
+				return nil, err
+			}
+			key, s = v, rest
+		default:
+			end := strings.IndexFunc(s, func(r rune) bool {
+				return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-')
+			})
+			if end == -1 {
+				end = len(s)
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("invalid key %q", s)
+			}
+			key, s = s[:end], s[end:]
+		}
+		keys = append(keys, key)
+		s = strings.TrimSpace(s)
+		if s == "" {
+			return keys, nil
+		}
+		if s[0] != '.' {
+			return nil, fmt.Errorf("invalid key near %q", s)
+		}
+		s = strings.TrimSpace(s[1:])
+	}
+}
+
+// parseValue 解析s开头的一个值，返回值和剩余的部分
+func parseValue(s string) (interface{}, string, error) {
+	if s == "" {
+		return nil, "", fmt.Errorf("missing value")
+	}
+	switch s[0] {
+	case '"', '\'':
+		return parseString(s)
+	case '[':
+		return parseArray(s)
+	case '{':
+		return nil, "", fmt.Errorf("inline tables are not supported")
+	}
+	end := strings.IndexAny(s, ", \t\n\r]")
+	if end == -1 {
+		end = len(s)
+	}
+	tok, rest := s[:end], s[end:]
+	switch tok {
+	case "true":
+		return true, rest, nil
+	case "false":
+		return false, rest, nil
+	}
+	num := strings.ReplaceAll(tok, "_", "")
+	base := 10
+	if len(num) > 2 && num[0] == '0' && strings.ContainsRune("xob", rune(num[1])) {
+		base = 0
+	}
+	if n, err := strconv.ParseInt(num, base, 64); err == nil {
+		return n, rest, nil
+	}
+	if f, err := strconv.ParseFloat(num, 64); err == nil {
+		return f, rest, nil
+	}
+	return nil, "", fmt.Errorf("invalid value %q", tok)
+}
+
+// parseString 解析s开头的基本字符串("...")或字面量字符串('...')
+func parseString(s string) (string, string, error) {
+	if strings.HasPrefix(s, `"""`) || strings.HasPrefix(s, "'''") {
+		return "", "", fmt.Errorf("multi-line strings are not supported")
+	}
+	if s[0] == '\'' {
+		end := strings.IndexByte(s[1:], '\'')
+		if end == -1 {
+			return "", "", fmt.Errorf("unterminated string")
+		}
+		return s[1 : end+1], s[end+2:], nil
+	}
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '\n':
+			return "", "", fmt.Errorf("unterminated string")
+		case '"':
+			v, err := strconv.Unquote(s[:i+1])
+			if err != nil {
+				return "", "", fmt.Errorf("invalid string %s", s[:i+1])
+			}
+			return v, s[i+1:], nil
+		}
+	}
+	return "", "", fmt.Errorf("unterminated string")
+}
+
+// parseArray 解析s开头的数组，数组可以跨行，允许末尾的逗号
+func parseArray(s string) ([]interface{}, string, error) {
+	arr := []interface{}{}
+	s = s[1:]
+	for {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			return nil, "", fmt.Errorf("unterminated array")
+		}
+		if s[0] == ']' {
+			return arr, s[1:], nil
+		}
+		v, rest, err := parseValue(s)
+		if err != nil {
+			return nil, "", err
+		}
+		arr = append(arr, v)
+		s = strings.TrimSpace(rest)
+		if strings.HasPrefix(s, ",") {
+			s = s[1:]
+		} else if !strings.HasPrefix(s, "]") {
+			return nil, "", fmt.Errorf("expect , or ] in array")
+		}
+	}
+}
+
+// stripComment 去掉字符串之外的 # 注释
+func stripComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// bracketDepth 返回字符串之外没有闭合的方括号数
+func bracketDepth(s string) int {
+	depth := 0
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '[':
+			depth++
+		case c == ']':
+			depth--
+		}
+	}
+	return depth
+}
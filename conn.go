@@ -0,0 +1,233 @@
+package gocache
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"gocache/registry"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/keepalive"
+)
+
+// defaultIdleTimeout 到远程节点的连接空闲多久后关闭，下一次请求时重新建立
+const defaultIdleTimeout = 5 * time.Minute
+
+// defaultClientKeepalive 到其他节点的连接的keepalive参数：空闲时每30秒探测一次，
+// 不低于服务器允许的最小间隔(见 defaultKeepalivePolicy)，及时发现已经断开的连接
+var defaultClientKeepalive = keepalive.ClientParameters{
+	Time:                30 * time.Second,
+	Timeout:             10 * time.Second,
+	PermitWithoutStream: true,
+}
+
+// healthCheckServiceConfig 开启gRPC客户端的健康检查：远程节点报告 NOT_SERVING(例如正在优雅停止)时请求立即失败，
+// 由调用方回退到本地加载，而不是等到超时。健康检查只在 round_robin 等负载均衡策略下生效；
+// 没有健康检查服务的旧版本节点视为健康。
+var healthCheckServiceConfig = fmt.Sprintf(
+	`{"loadBalancingConfig":[{"round_robin":{}}],"healthCheckConfig":{"serviceName":%q}}`, groupCacheService)
+
+// WithIdleTimeout 设置到其他节点的连接空闲多久后关闭，默认5分钟，0表示不关闭空闲连接
+func WithIdleTimeout(d time.Duration) ServerOption {
+	return func(s *Server) {
+		s.idleTimeout = d
+	}
+}
+
+// WithConnPool 设置 Set 等方法创建的客户端到每个节点的连接数，默认为1。请求按轮询分配到各个连接上，
+// 对少数热点节点的高并发请求不会受限于单个HTTP/2连接的并发流数量和队头阻塞。连接在需要时才建立。
+func WithConnPool(size int) ServerOption {
+	return func(s *Server) {
+		if size > 0 {
+			s.poolSize = size
+		}
+	}
+}
+
+// WithClientKeepalive 设置到其他节点的连接的keepalive参数，Time 为0表示不发送探测。
+// Time 不能小于其他节点的服务器允许的最小间隔(默认10秒，见 WithKeepalive)，否则连接会被对方关闭。
+func WithClientKeepalive(params keepalive.ClientParameters) ServerOption {
+	return func(s *Server) {
+		s.clientKeepalive = params
+	}
+}
+
+// pooledConn 连接池中的一个连接
+type pooledConn struct {
+	conn     *grpc.ClientConn // nil表示还没有建立或已经关闭
+	closeFn  func()           // 关闭 conn 的函数
+	active   int              // 正在使用 conn 的请求数
+	lastUsed time.Time        // conn 最近一次变为空闲的时间
+}
+
+// close 关闭连接，调用时需持有 c.connMu
+func (p *pooledConn) close() {
+	if p.conn == nil {
+		return
+	}
+	p.closeFn()
+	p.conn, p.closeFn = nil, nil
+}
+
+// dial 按轮询从连接池中选择一个到远程节点的长连接，返回连接和使用结束后需要调用的释放函数。
+// 连接在第一次被选中时建立，之后被请求共享，已经失效时重新建立，空闲超过 idleTimeout 后关闭。
+func (c *Client) dial() (*grpc.ClientConn, func(), error) {
+	c.connMu.Lock()
+	defer c.connMu.Unlock()
+	p := &c.pool[c.next%len(c.pool)]
+	c.next++
+	if p.conn != nil && p.conn.GetState() == connectivity.Shutdown {
+		p.close()
+	}
+	if p.conn == nil {
+		conn, closeFn, err := c.connect()
+		if err != nil {
+			return nil, nil, err
+		}
+		p.conn, p.closeFn = conn, closeFn
+		c.closed = false
+	}
+	p.active++
+	conn := p.conn
+	return conn, func() { c.release(p, conn) }, nil
+}
+
+// release 一次使用结束，连接空闲时开始计算空闲时间，已经被 Close 的连接在最后一次使用结束后关闭
+func (c *Client) release(p *pooledConn, conn *grpc.ClientConn) {
+	c.connMu.Lock()
+	defer c.connMu.Unlock()
+	p.active--
+	if p.active > 0 || p.conn != conn {
+		return
+	}
+	if c.closed {
+		p.close()
+		return
+	}
+	p.lastUsed = time.Now()
+	if c.idleTimeout > 0 {
+		if c.idleTimer == nil {
+			c.idleTimer = time.AfterFunc(c.idleTimeout, c.closeIdle)
+		} else {
+			c.idleTimer.Reset(c.idleTimeout)
+		}
+	}
+}
+
+// closeIdle 关闭空闲超过 idleTimeout 的连接，还有连接没有到期时重新计时
+func (c *Client) closeIdle() {
+	c.connMu.Lock()
+	defer c.connMu.Unlock()
+	var next time.Duration
+	for i := range c.pool {
+		p := &c.pool[i]
+		if p.conn == nil || p.active > 0 {
+			continue
+		}
+		if idle := time.Since(p.lastUsed); idle >= c.idleTimeout {
+			p.close()
+		} else if left := c.idleTimeout - idle; next == 0 || left < next {
+			next = left
+		}
+	}
+	if next > 0 {
+		c.idleTimer.Reset(next)
+	}
+}
+
+// connections 返回当前已经建立的连接数
+func (c *Client) connections() int {
+	c.connMu.Lock()
+	defer c.connMu.Unlock()
+	n := 0
+	for _, p := range c.pool {
+		if p.conn != nil {
+			n++
+		}
+	}
+	return n
+}
+
+// dialOptions 返回连接远程节点的gRPC参数，不包括默认的明文传输
+func (c *Client) dialOptions() []grpc.DialOption {
+	opts := []grpc.DialOption{grpc.WithDefaultServiceConfig(healthCheckServiceConfig), grpc.WithRecvBufferPool(rpcBufferPool)}
+	if c.creds != nil {
+		opts = append(opts, grpc.WithTransportCredentials(c.creds))
+	}
+	if c.keepalive.Time > 0 {
+		opts = append(opts, grpc.WithKeepaliveParams(c.keepalive))
+	}
+	return opts
+}
+
+// etcdConnect 通过etcd发现远程节点并建立连接，返回连接和关闭连接的函数，调用时需持有 c.connMu。
+// 连接池中的连接共享一个etcd客户端，etcd中的地址变化时连接会自动切换到新的地址。
+func (c *Client) etcdConnect() (*grpc.ClientConn, func(), error) {
+	if c.etcdCli == nil {
+		cli, err := clientv3.New(c.etcdConfig) // 创建一个etcd客户端
+		if err != nil {
+			return nil, nil, err
+		}
+		c.etcdCli = cli
+	}
+	//使用etcd客户端发现指定服务（c.baseURL）并创建连接（conn），连接在后台建立，请求会等待连接就绪
+	conn, err := registry.NewEtcdConn(c.etcdCli, c.baseURL, c.dialOptions()...)
+	if err != nil {
+		c.releaseEtcd()
+		return nil, nil, err
+	}
+	c.etcdRefs++
+	return conn, func() {
+		conn.Close()
+		c.etcdRefs--
+		c.releaseEtcd()
+	}, nil
+}
+
+// directConnect 不经过etcd，直接按地址连接远程节点，用于固定节点列表的部署，见 WithStaticPeers
+func (c *Client) directConnect() (*grpc.ClientConn, func(), error) {
+	opts := append([]grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}, c.dialOptions()...)
+	conn, err := grpc.Dial(c.peerAddr(), opts...) // 后传入的参数覆盖默认的明文传输
+	if err != nil {
+		return nil, nil, err
+	}
+	return conn, func() { conn.Close() }, nil
+}
+
+// peerAddr 返回远程节点的地址，即服务名称去掉命名空间的部分
+func (c *Client) peerAddr() string {
+	return c.baseURL[strings.LastIndex(c.baseURL, "/")+1:]
+}
+
+// releaseEtcd 没有连接使用etcd客户端时将其关闭，调用时需持有 c.connMu
+func (c *Client) releaseEtcd() {
+	if c.etcdRefs == 0 && c.etcdCli != nil {
+		c.etcdCli.Close()
+		c.etcdCli = nil
+	}
+}
+
+// Close 关闭客户端持有的失效通知订阅和连接，正在进行的请求结束后才关闭它使用的连接。之后的请求会重新建立连接。
+func (c *Client) Close() {
+	c.watchMu.Lock()
+	w := c.watch
+	c.watchMu.Unlock()
+	if w != nil {
+		c.closeWatch(w)
+	}
+
+	c.connMu.Lock()
+	defer c.connMu.Unlock()
+	c.closed = true
+	if c.idleTimer != nil {
+		c.idleTimer.Stop()
+	}
+	for i := range c.pool {
+		if c.pool[i].active == 0 {
+			c.pool[i].close()
+		}
+	}
+}
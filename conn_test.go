@@ -0,0 +1,120 @@
+package gocache
+
+import (
+	"testing"
+	"time"
+
+	pb "gocache/gocachepb"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+func TestPersistentConn(t *testing.T) {
+	NewGroup("conn", 2<<10, "lru", GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}))
+	svr, _ := NewServer("127.0.0.1:9710")
+	addr, stop := serveGRPC(t, svr)
+	defer stop()
+
+	dials := 0
+	c := NewClient("gocache/" + addr)
+	c.idleTimeout = 100 * time.Millisecond
+	c.connect = func() (*grpc.ClientConn, func(), error) {
+		dials++
+		conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		if err != nil {
+			return nil, nil, err
+		}
+		return conn, func() { conn.Close() }, nil
+	}
+	get := func(key string) {
+		t.Helper()
+		if err := c.Get(&pb.Request{Group: "conn", Key: key}, &pb.Response{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i := 0; i < 5; i++ {
+		get("k" + string(rune('a'+i)))
+	}
+	if dials != 1 {
+		t.Fatalf("dialed %d times for 5 requests, want 1", dials)
+	}
+
+	// 空闲超时后关闭，下一次请求重新建立
+	deadline := time.Now().Add(2 * time.Second)
+	for c.connections() > 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("idle connection was not closed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	get("after-idle")
+	if dials != 2 {
+		t.Fatalf("dialed %d times after idle timeout, want 2", dials)
+	}
+
+	// Close 等待正在使用连接的请求结束
+	_, release, err := c.dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+	if c.connections() != 1 {
+		t.Fatal("Close closed a connection that is still in use")
+	}
+	release()
+	if c.connections() != 0 {
+		t.Fatal("connection was not closed after the last request finished")
+	}
+	get("after-close")
+	if dials != 3 {
+		t.Fatalf("dialed %d times after Close, want 3", dials)
+	}
+	c.Close()
+}
+
+func TestConnPool(t *testing.T) {
+	NewGroup("pool", 2<<10, "lru", GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}))
+	svr, _ := NewServer("127.0.0.1:9711", WithConnPool(3))
+	addr, stop := serveGRPC(t, svr)
+	defer stop()
+
+	c := svr.newClient(addr)
+	defer c.Close()
+	dials := 0
+	c.connect = func() (*grpc.ClientConn, func(), error) {
+		dials++
+		conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		if err != nil {
+			return nil, nil, err
+		}
+		return conn, func() { conn.Close() }, nil
+	}
+
+	// 请求按轮询分配，每个连接在第一次被选中时建立
+	seen := map[*grpc.ClientConn]int{}
+	for i := 0; i < 6; i++ {
+		conn, release, err := c.dial()
+		if err != nil {
+			t.Fatal(err)
+		}
+		seen[conn]++
+		release()
+	}
+	if dials != 3 || len(seen) != 3 || c.connections() != 3 {
+		t.Fatalf("dials=%d distinct=%d open=%d, want 3 each", dials, len(seen), c.connections())
+	}
+	for conn, n := range seen {
+		if n != 2 {
+			t.Fatalf("connection %p used %d times, want 2", conn, n)
+		}
+	}
+	if err := c.Get(&pb.Request{Group: "pool", Key: "k"}, &pb.Response{}); err != nil {
+		t.Fatal(err)
+	}
+}
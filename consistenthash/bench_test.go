@@ -0,0 +1,66 @@
+package consistenthash
+
+import (
+	"math"
+	"strconv"
+	"testing"
+)
+
+var benchHashes = []struct {
+	name string
+	fn   Hash64
+}{
+	{"crc32", CRC32},
+	{"xxhash64", XXHash64},
+	{"murmur3", Murmur3},
+}
+
+// BenchmarkDistribution 比较不同哈希函数下各节点分到的key数量，
+// 通过 stddev/mean 指标(变异系数，越小越均匀)和 max/mean 指标(最忙节点的负载倍数)报告分布情况
+func BenchmarkDistribution(b *testing.B) {
+	const (
+		nodes = 64
+		keys  = 100000
+	)
+	for _, h := range benchHashes {
+		b.Run(h.name, func(b *testing.B) {
+			var cv, peak float64
+			for i := 0; i < b.N; i++ {
+				m := NewWithHash64(50, h.fn)
+				for n := 0; n < nodes; n++ {
+					m.Add("10.0." + strconv.Itoa(n/256) + "." + strconv.Itoa(n%256) + ":8001")
+				}
+				counts := make(map[string]int, nodes)
+				for k := 0; k < keys; k++ {
+					counts[m.Get("user:"+strconv.Itoa(k))]++
+				}
+				mean := float64(keys) / nodes
+				var sum, max float64
+				for _, c := range counts {
+					d := float64(c) - mean
+					sum += d * d
+					max = math.Max(max, float64(c))
+				}
+				cv = math.Sqrt(sum/nodes) / mean
+				peak = max / mean
+			}
+			b.ReportMetric(cv, "stddev/mean")
+			b.ReportMetric(peak, "max/mean")
+		})
+	}
+}
+
+func BenchmarkGet(b *testing.B) {
+	for _, h := range benchHashes {
+		b.Run(h.name, func(b *testing.B) {
+			m := NewWithHash64(50, h.fn)
+			for n := 0; n < 64; n++ {
+				m.Add("node-" + strconv.Itoa(n))
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				m.Get("user:" + strconv.Itoa(i))
+			}
+		})
+	}
+}
@@ -1,58 +1,261 @@
 package consistenthash
 
 import (
-	"hash/crc32"
 	"sort"
 	"strconv"
+	"sync"
+	"sync/atomic"
 )
 
 // Hash maps bytes to uint32
 type Hash func(data []byte) uint32
 
 // Map constains all hashed keys
+// Map 可以被并发使用：哈希环是不可变的快照，通过原子操作整体替换。
+// 查询(Get、GetN等)不加锁，直接读取当前快照；修改(Add、Remove、Reset)在旁边构建新的快照后再替换，修改之间互斥。
 type Map struct {
-	hash     Hash           // 哈希函数
-	replicas int            // 虚拟节点倍数
-	ring     []int          // 哈希环
-	hashMap  map[int]string // 虚拟节点的hash到真实节点的映射
+	hash     Hash64 // 哈希函数
+	replicas int    // 虚拟节点倍数
+
+	mu   sync.Mutex   // 保证修改之间互斥
+	snap atomic.Value // 当前的 *snapshot
+}
+
+// snapshot 是哈希环的一个不可变快照，创建之后不会再被修改
+type snapshot struct {
+	ring    []uint64          // 哈希环
+	hashMap map[uint64]string // 虚拟节点的hash到真实节点的映射
+	nodes   map[string]bool   // 哈希环中的真实节点
+	weights map[string]int    // 节点的权重，没有设置的节点为1，见 SetWeight
+	version uint64            // 版本号，节点集合或权重每变化一次加1
 }
 
-// New 创建一个map实例
+// New 创建一个map实例，fn 为nil时使用 crc32
 func New(replicas int, fn Hash) *Map {
+	if fn == nil {
+		return NewWithHash64(replicas, nil)
+	}
+	return NewWithHash64(replicas, func(data []byte) uint64 { return uint64(fn(data)) })
+}
+
+// NewWithHash64 使用64位的哈希函数创建一个map实例，例如 XXHash64、Murmur3，fn 为nil时使用 CRC32
+func NewWithHash64(replicas int, fn Hash64) *Map {
 	m := &Map{
 		replicas: replicas,
 		hash:     fn,
-		hashMap:  make(map[int]string),
 	}
 	if m.hash == nil {
-		m.hash = crc32.ChecksumIEEE
+		m.hash = CRC32
 	}
+	m.snap.Store(&snapshot{hashMap: make(map[uint64]string), nodes: make(map[string]bool)})
 	return m
 }
 
+// load 返回当前的快照
+func (m *Map) load() *snapshot {
+	return m.snap.Load().(*snapshot)
+}
+
+// Clone 返回一个与当前哈希环相同的 Map，两者之后的修改互不影响。快照是共享的，开销很小。
+func (m *Map) Clone() *Map {
+	c := &Map{hash: m.hash, replicas: m.replicas}
+	c.snap.Store(m.load())
+	return c
+}
+
+// build 根据真实节点构建一个新的快照
+// 节点的虚拟节点数为 replicas 乘以权重，不同真实节点的虚拟节点发生哈希冲突时，该位置归属名称较小的节点，保证路由结果与添加顺序无关；
+// 重复添加同一个节点不会产生重复的虚拟节点。
+func (m *Map) build(nodes map[string]bool, weights map[string]int) *snapshot {
+	s := &snapshot{
+		ring:    make([]uint64, 0, len(nodes)*m.replicas),
+		hashMap: make(map[uint64]string, len(nodes)*m.replicas),
+		nodes:   nodes,
+		weights: weights,
+	}
+	for key := range nodes {
+		replicas := m.replicas
+		if w := weights[key]; w > 1 { // 权重为w的节点拥有w倍的虚拟节点
+			replicas *= w
+		}
+		for i := 0; i < replicas; i++ { // 每一个节点要对应几个虚拟节点
+			hash := m.hash([]byte(strconv.Itoa(i) + key)) // 虚拟节点的值映射出hash
+			if owner, ok := s.hashMap[hash]; ok {         // 哈希冲突或同一节点的虚拟节点重复
+				if key < owner {
+					s.hashMap[hash] = key
+				}
+				continue
+			}
+			s.ring = append(s.ring, hash) // 把虚拟节点添加进哈希环
+			s.hashMap[hash] = key         // 虚拟节点的hash对应真实的节点
+		}
+	}
+	sort.Slice(s.ring, func(i, j int) bool { return s.ring[i] < s.ring[j] })
+	return s
+}
+
+// update 复制当前的节点集合，交给fn修改后构建并替换快照，fn 返回false表示没有变化
+func (m *Map) update(fn func(nodes map[string]bool) bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	old := m.load()
+	nodes := make(map[string]bool, len(old.nodes))
+	for node := range old.nodes {
+		nodes[node] = true
+	}
+	if fn(nodes) {
+		s := m.build(nodes, old.weights)
+		s.version = old.version + 1
+		m.snap.Store(s)
+	}
+}
+
 // Add 向哈希环中添加节点
 func (m *Map) Add(keys ...string) {
-	for _, key := range keys { // 一次可能传入多个节点
-		for i := 0; i < m.replicas; i++ { // 每一个节点要对应几个虚拟节点
-			hash := int(m.hash([]byte(strconv.Itoa(i) + key))) // 虚拟节点的值映射出hash
-			m.ring = append(m.ring, hash)                      // 把虚拟节点添加进哈希环
-			m.hashMap[hash] = key                              // 虚拟节点的hash对应真实的节点
+	m.update(func(nodes map[string]bool) bool {
+		changed := false
+		for _, key := range keys { // 一次可能传入多个节点
+			if !nodes[key] {
+				nodes[key] = true
+				changed = true
+			}
 		}
+		return changed
+	})
+}
+
+// Remove 从哈希环中删除节点及其所有虚拟节点，不存在的节点会被忽略。
+// 被删除节点在哈希冲突中占据的位置会交还给同样映射到该位置的其他节点，结果与只添加剩余节点相同。
+func (m *Map) Remove(keys ...string) {
+	m.update(func(nodes map[string]bool) bool {
+		changed := false
+		for _, key := range keys {
+			if nodes[key] {
+				delete(nodes, key)
+				changed = true
+			}
+		}
+		return changed
+	})
+}
+
+// Reset 清空哈希环中的所有节点
+func (m *Map) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	old := m.load()
+	if len(old.nodes) == 0 {
+		return
 	}
-	sort.Ints(m.ring)
+	m.snap.Store(&snapshot{hashMap: make(map[uint64]string), nodes: make(map[string]bool), weights: old.weights, version: old.version + 1})
+}
+
+// SetWeight 设置节点的权重，权重为w的节点拥有w倍的虚拟节点，负责的哈希空间也大约是w倍。
+// w 小于等于1时恢复为默认的权重1。可以在节点加入之前设置，节点被删除后权重仍然保留。
+func (m *Map) SetWeight(key string, w int) {
+	if w < 1 {
+		w = 1
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	old := m.load()
+	if m.weight(old, key) == w {
+		return
+	}
+	weights := make(map[string]int, len(old.weights)+1)
+	for k, v := range old.weights {
+		weights[k] = v
+	}
+	if w == 1 {
+		delete(weights, key)
+	} else {
+		weights[key] = w
+	}
+	s := &snapshot{hashMap: old.hashMap, ring: old.ring, nodes: old.nodes, weights: weights, version: old.version}
+	if old.nodes[key] { // 节点在哈希环中时重新构建
+		s = m.build(old.nodes, weights)
+		s.version = old.version + 1
+	}
+	m.snap.Store(s)
+}
+
+// Weight 返回节点的权重，没有设置时为1
+func (m *Map) Weight(key string) int {
+	return m.weight(m.load(), key)
+}
+
+func (m *Map) weight(s *snapshot, key string) int {
+	if w := s.weights[key]; w > 1 {
+		return w
+	}
+	return 1
+}
+
+// Version 返回哈希环的版本号，节点集合每变化一次加1，新建的哈希环版本号为0。
+// Clone 得到的哈希环与原哈希环版本号相同，可以用来判断两个快照之间是否发生了变化。
+func (m *Map) Version() uint64 {
+	return m.load().version
 }
 
 // Get 对于传入的数据该分到哪个节点？
 func (m *Map) Get(key string) string {
-	if len(m.ring) == 0 {
+	s := m.load()
+	if len(s.ring) == 0 {
 		return ""
 	}
 
-	hash := int(m.hash([]byte(key))) // 先取数据key的hash
+	hash := m.hash([]byte(key)) // 先取数据key的hash
 	// Binary search for appropriate replica.
-	idx := sort.Search(len(m.ring), func(i int) bool { // 拿到顺时针最近的虚拟节点
-		return m.ring[i] >= hash
+	idx := sort.Search(len(s.ring), func(i int) bool { // 拿到顺时针最近的虚拟节点
+		return s.ring[i] >= hash
 	})
 	// 返回真实节点的key,是一个string类型的数据
-	return m.hashMap[m.ring[idx%len(m.ring)]] // 用来处理idx == len(.keys),本身返回的idx就已经是虚拟节点的hash了
+	return s.hashMap[s.ring[idx%len(s.ring)]] // 用来处理idx == len(.keys),本身返回的idx就已经是虚拟节点的hash了
+}
+
+// GetN 从key的位置开始沿哈希环顺时针查找，返回最先遇到的n个不同的真实节点，第一个就是 Get 的结果。
+// 用于副本存放和对冲读取，真实节点不足n个时返回全部节点。
+func (m *Map) GetN(key string, n int) []string {
+	s := m.load()
+	if len(s.ring) == 0 || n <= 0 {
+		return nil
+	}
+	if n > len(s.nodes) {
+		n = len(s.nodes)
+	}
+	hash := m.hash([]byte(key))
+	idx := sort.Search(len(s.ring), func(i int) bool {
+		return s.ring[i] >= hash
+	})
+	nodes := make([]string, 0, n)
+	for i := 0; i < len(s.ring) && len(nodes) < n; i++ {
+		node := s.hashMap[s.ring[(idx+i)%len(s.ring)]]
+		dup := false
+		for _, seen := range nodes {
+			if seen == node {
+				dup = true
+				break
+			}
+		}
+		if !dup {
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
+}
+
+// Hash 返回key在哈希环上的位置
+func (m *Map) Hash(key string) uint64 {
+	return m.hash([]byte(key))
+}
+
+// Nodes 返回哈希环中所有的真实节点，按名称排序
+func (m *Map) Nodes() []string {
+	s := m.load()
+	nodes := make([]string, 0, len(s.nodes))
+	for node := range s.nodes {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+	return nodes
 }
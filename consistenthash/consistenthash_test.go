@@ -1,7 +1,10 @@
 package consistenthash
 
 import (
+	"math"
+	"reflect"
 	"strconv"
+	"strings"
 	"testing"
 )
 
@@ -41,3 +44,304 @@ func TestHashing(t *testing.T) {
 	}
 
 }
+
+func TestMinimalDisruption(t *testing.T) {
+	const (
+		nodes   = 10
+		samples = 10000
+	)
+	names := make([]string, nodes+1)
+	for i := range names {
+		names[i] = "10.0.0." + strconv.Itoa(i) + ":8001"
+	}
+	before := New(50, nil)
+	before.Add(names[:nodes]...)
+	after := New(50, nil)
+	after.Add(names...)
+
+	// 从 before 到 after 是添加一个节点，反过来就是删除一个节点
+	moved := 0
+	for i := 0; i < samples; i++ {
+		key := "key-" + strconv.Itoa(i)
+		oldOwner, newOwner := before.Get(key), after.Get(key)
+		if oldOwner == newOwner {
+			continue
+		}
+		moved++
+		// 只有被新节点接管的key才允许迁移，其他节点之间不应发生迁移
+		if newOwner != names[nodes] {
+			t.Fatalf("key %s moved from %s to %s, expected only moves to the new node", key, oldOwner, newOwner)
+		}
+	}
+
+	// 理想情况下迁移 1/(N+1) 的key，这里允许两倍的偏差
+	limit := 2 * samples / (nodes + 1)
+	if moved == 0 || moved > limit {
+		t.Fatalf("moved %d of %d keys, expected (0, %d]", moved, samples, limit)
+	}
+}
+
+func TestHashCollisionDeterministic(t *testing.T) {
+	// 所有虚拟节点都映射到同一个位置，不同真实节点之间必然冲突
+	collide := func(key []byte) uint32 { return 42 }
+
+	m1 := New(3, collide)
+	m1.Add("b", "a", "c")
+	m2 := New(3, collide)
+	m2.Add("c", "a")
+	m2.Add("b")
+
+	for _, m := range []*Map{m1, m2} {
+		if got := m.Get("anything"); got != "a" {
+			t.Fatalf("collision should resolve to the smallest node a, got %s", got)
+		}
+		if len(m.load().ring) != 1 {
+			t.Fatalf("colliding virtual nodes should occupy one ring slot, got %d", len(m.load().ring))
+		}
+	}
+}
+
+func TestAddIdempotent(t *testing.T) {
+	m := New(3, nil)
+	m.Add("a", "b")
+	n := len(m.load().ring)
+	m.Add("a")
+	if len(m.load().ring) != n {
+		t.Fatalf("re-adding a node should not grow the ring: %d -> %d", n, len(m.load().ring))
+	}
+}
+
+func TestNodes(t *testing.T) {
+	m := New(3, nil)
+	m.Add("b", "a")
+	m.Add("c", "a")
+	if nodes := m.Nodes(); strings.Join(nodes, ",") != "a,b,c" {
+		t.Fatalf("expect a,b,c got %v", nodes)
+	}
+}
+
+func TestRemove(t *testing.T) {
+	m := New(50, nil)
+	m.Add("a", "b", "c")
+	m.Remove("b", "missing")
+
+	expect := New(50, nil)
+	expect.Add("a", "c")
+	if !reflect.DeepEqual(m.load().ring, expect.load().ring) || !reflect.DeepEqual(m.load().hashMap, expect.load().hashMap) {
+		t.Fatal("ring after Remove should equal a ring built from the remaining nodes")
+	}
+	if nodes := m.Nodes(); !reflect.DeepEqual(nodes, []string{"a", "c"}) {
+		t.Fatalf("Nodes() = %v", nodes)
+	}
+
+	// 冲突的位置交还给其他节点
+	collide := New(3, func(key []byte) uint32 { return 42 })
+	collide.Add("a", "b")
+	collide.Remove("a")
+	if got := collide.Get("x"); got != "b" {
+		t.Fatalf("slot should be handed over to b, got %q", got)
+	}
+}
+
+func TestReset(t *testing.T) {
+	m := New(3, nil)
+	m.Add("a", "b")
+	m.Reset()
+	if got := m.Get("x"); got != "" || len(m.Nodes()) != 0 {
+		t.Fatalf("ring should be empty after Reset, got %q %v", got, m.Nodes())
+	}
+	m.Add("c")
+	if got := m.Get("x"); got != "c" {
+		t.Fatalf("got %q after re-adding", got)
+	}
+}
+
+func TestHash64Ring(t *testing.T) {
+	for _, fn := range []Hash64{XXHash64, Murmur3} {
+		m := NewWithHash64(50, fn)
+		m.Add("a", "b", "c")
+		seen := map[string]bool{}
+		for i := 0; i < 1000; i++ {
+			seen[m.Get("key-"+strconv.Itoa(i))] = true
+		}
+		if len(seen) != 3 {
+			t.Fatalf("expect keys to spread over 3 nodes, got %v", seen)
+		}
+	}
+}
+
+func TestGetN(t *testing.T) {
+	hash := New(1, func(key []byte) uint32 {
+		i, _ := strconv.Atoi(string(key))
+		return uint32(i)
+	})
+	// 虚拟节点的位置：2, 4, 6
+	hash.Add("6", "4", "2")
+
+	if got := hash.GetN("3", 2); !reflect.DeepEqual(got, []string{"4", "6"}) {
+		t.Fatalf("GetN(3, 2) = %v", got)
+	}
+	if got := hash.GetN("5", 3); !reflect.DeepEqual(got, []string{"6", "2", "4"}) {
+		t.Fatalf("GetN(5, 3) = %v, expect to wrap around the ring", got)
+	}
+	if got := hash.GetN("5", 10); len(got) != 3 {
+		t.Fatalf("GetN should return at most all nodes, got %v", got)
+	}
+
+	m := New(50, nil)
+	m.Add("a", "b", "c", "d")
+	for i := 0; i < 100; i++ {
+		key := strconv.Itoa(i)
+		got := m.GetN(key, 3)
+		if len(got) != 3 || got[0] != m.Get(key) || got[0] == got[1] || got[1] == got[2] || got[0] == got[2] {
+			t.Fatalf("GetN(%s, 3) = %v, Get = %s", key, got, m.Get(key))
+		}
+	}
+}
+
+func TestConcurrentGetAndUpdate(t *testing.T) {
+	m := New(50, nil)
+	m.Add("a", "b")
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 200; i++ {
+			m.Add("c" + strconv.Itoa(i%5))
+			m.Remove("c" + strconv.Itoa((i+2)%5))
+		}
+	}()
+	for i := 0; ; i++ {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		if node := m.Get(strconv.Itoa(i)); node == "" {
+			t.Fatal("lookup during update should always see a complete ring")
+		}
+		m.GetN(strconv.Itoa(i), 2)
+	}
+}
+
+func TestClone(t *testing.T) {
+	m := New(50, nil)
+	m.Add("a", "b")
+	c := m.Clone()
+	m.Add("c")
+	c.Remove("a")
+	if !reflect.DeepEqual(m.Nodes(), []string{"a", "b", "c"}) || !reflect.DeepEqual(c.Nodes(), []string{"b"}) {
+		t.Fatalf("clone should be independent: %v %v", m.Nodes(), c.Nodes())
+	}
+}
+
+func TestOwnerAndDistribution(t *testing.T) {
+	hash := New(1, func(key []byte) uint32 {
+		i, _ := strconv.Atoi(string(key))
+		return uint32(i)
+	})
+	// 虚拟节点的位置：2, 4, 6
+	hash.Add("6", "4", "2")
+
+	o := hash.Owner("5")
+	if o.KeyHash != 5 || o.VirtualNode != 6 || o.Node != "6" {
+		t.Fatalf("unexpected ownership %+v", o)
+	}
+	if o := hash.Owner("7"); o.VirtualNode != 2 || o.Node != "2" {
+		t.Fatalf("key after the last virtual node should wrap around, got %+v", o)
+	}
+
+	dist := hash.Distribution()
+	// "2" 负责 (6, 2^32) 和 [0, 2]，其余节点各负责2个位置
+	if d := dist["4"]; d != 2/math.Pow(2, 32) {
+		t.Fatalf("unexpected fraction for 4: %v", d)
+	}
+	for _, fn := range []Hash64{CRC32, XXHash64} {
+		m := NewWithHash64(50, fn)
+		m.Add("a", "b", "c")
+		sum := 0.0
+		for node, d := range m.Distribution() {
+			if d < 0.1 || d > 0.6 {
+				t.Fatalf("node %s owns %.3f of the keyspace", node, d)
+			}
+			sum += d
+		}
+		if math.Abs(sum-1) > 1e-9 {
+			t.Fatalf("fractions should sum to 1, got %v", sum)
+		}
+		if len(m.VirtualNodes()) != 150 {
+			t.Fatalf("expect 150 virtual nodes, got %d", len(m.VirtualNodes()))
+		}
+	}
+}
+
+func TestJump(t *testing.T) {
+	if JumpHash(42, 0) != -1 {
+		t.Fatalf("no buckets should return -1")
+	}
+	// 分片数增加时，key要么留在原分片，要么移动到新分片
+	for key := uint64(0); key < 1000; key++ {
+		prev := JumpHash(key*0x9E3779B97F4A7C15, 10)
+		if next := JumpHash(key*0x9E3779B97F4A7C15, 11); next != prev && next != 10 {
+			t.Fatalf("key %d moved from %d to %d", key, prev, next)
+		}
+	}
+
+	j := NewJump(nil, "a", "b", "c", "d")
+	counts := map[string]int{}
+	for i := 0; i < 40000; i++ {
+		counts[j.Get(strconv.Itoa(i))]++
+	}
+	for node, n := range counts {
+		if n < 9000 || n > 11000 {
+			t.Fatalf("node %s got %d of 40000 keys", node, n)
+		}
+	}
+	nodes := j.GetN("key", 3)
+	if len(nodes) != 3 || nodes[0] != j.Get("key") {
+		t.Fatalf("unexpected replicas %v", nodes)
+	}
+	if NewJump(nil).Get("key") != "" {
+		t.Fatalf("empty jump should return no node")
+	}
+}
+
+func TestVersion(t *testing.T) {
+	m := New(3, nil)
+	if m.Version() != 0 {
+		t.Fatalf("new ring should start at version 0")
+	}
+	m.Add("a", "b")
+	m.Add("a") // 没有变化，版本号不变
+	c := m.Clone()
+	if m.Version() != 1 || c.Version() != 1 {
+		t.Fatalf("expect version 1, got %d %d", m.Version(), c.Version())
+	}
+	m.Remove("a")
+	m.Reset()
+	m.Reset()
+	if m.Version() != 3 || c.Version() != 1 {
+		t.Fatalf("expect version 3 and clone unchanged, got %d %d", m.Version(), c.Version())
+	}
+}
+
+func TestWeight(t *testing.T) {
+	m := NewWithHash64(50, XXHash64)
+	m.SetWeight("big", 3) // 加入之前设置的权重同样生效
+	m.Add("big", "small")
+	if m.Weight("big") != 3 || m.Weight("small") != 1 || len(m.VirtualNodes()) != 200 {
+		t.Fatalf("weights %d/%d, %d virtual nodes", m.Weight("big"), m.Weight("small"), len(m.VirtualNodes()))
+	}
+	if d := m.Distribution()["big"]; d < 0.6 || d > 0.9 {
+		t.Fatalf("node with weight 3 owns %.3f of the keyspace", d)
+	}
+
+	v := m.Version()
+	m.SetWeight("big", 3) // 没有变化，版本号不变
+	if m.Version() != v {
+		t.Fatal("setting the same weight should not change the ring")
+	}
+	m.SetWeight("big", 0)
+	if m.Weight("big") != 1 || len(m.VirtualNodes()) != 100 || m.Version() != v+1 {
+		t.Fatalf("weight %d, %d virtual nodes, version %d", m.Weight("big"), len(m.VirtualNodes()), m.Version())
+	}
+}
@@ -0,0 +1,189 @@
+package consistenthash
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"math/bits"
+)
+
+// Hash64 maps bytes to uint64，使用64位的哈希空间，节点较多时冲突更少、分布更均匀
+type Hash64 func(data []byte) uint64
+
+// CRC32 是默认的哈希函数，与早期版本的路由结果保持一致
+func CRC32(data []byte) uint64 {
+	return uint64(crc32.ChecksumIEEE(data))
+}
+
+// 使用变量而不是常量，以便运算时按uint64回绕
+var (
+	xxPrime1 uint64 = 11400714785074694791
+	xxPrime2 uint64 = 14029467366897019727
+	xxPrime3 uint64 = 1609587929392839161
+	xxPrime4 uint64 = 9650029242287828579
+	xxPrime5 uint64 = 2870177450012600261
+)
+
+// XXHash64 计算 seed 为0的 xxHash64
+func XXHash64(b []byte) uint64 {
+	n := len(b)
+	var h uint64
+	if n >= 32 {
+		v1 := xxPrime1 + xxPrime2
+		v2 := xxPrime2
+		v3 := uint64(0)
+		v4 := -xxPrime1
+		for len(b) >= 32 {
+			v1 = xxRound(v1, binary.LittleEndian.Uint64(b[0:8]))
+			v2 = xxRound(v2, binary.LittleEndian.Uint64(b[8:16]))
+			v3 = xxRound(v3, binary.LittleEndian.Uint64(b[16:24]))
+			v4 = xxRound(v4, binary.LittleEndian.Uint64(b[24:32]))
+			b = b[32:]
+		}
+		h = bits.RotateLeft64(v1, 1) + bits.RotateLeft64(v2, 7) + bits.RotateLeft64(v3, 12) + bits.RotateLeft64(v4, 18)
+		h = xxMergeRound(h, v1)
+		h = xxMergeRound(h, v2)
+		h = xxMergeRound(h, v3)
+		h = xxMergeRound(h, v4)
+	} else {
+		h = xxPrime5
+	}
+	h += uint64(n)
+
+	for ; len(b) >= 8; b = b[8:] {
+		h ^= xxRound(0, binary.LittleEndian.Uint64(b[:8]))
+		h = bits.RotateLeft64(h, 27)*xxPrime1 + xxPrime4
+	}
+	if len(b) >= 4 {
+		h ^= uint64(binary.LittleEndian.Uint32(b[:4])) * xxPrime1
+		h = bits.RotateLeft64(h, 23)*xxPrime2 + xxPrime3
+		b = b[4:]
+	}
+	for _, c := range b {
+		h ^= uint64(c) * xxPrime5
+		h = bits.RotateLeft64(h, 11) * xxPrime1
+	}
+
+	h ^= h >> 33
+	h *= xxPrime2
+	h ^= h >> 29
+	h *= xxPrime3
+	h ^= h >> 32
+	return h
+}
+
+func xxRound(acc, input uint64) uint64 {
+	acc += input * xxPrime2
+	acc = bits.RotateLeft64(acc, 31)
+	return acc * xxPrime1
+}
+
+func xxMergeRound(acc, val uint64) uint64 {
+	val = xxRound(0, val)
+	acc ^= val
+	return acc*xxPrime1 + xxPrime4
+}
+
+const (
+	murmurC1 uint64 = 0x87c37b91114253d5
+	murmurC2 uint64 = 0x4cf5ad432745937f
+)
+
+// Murmur3 计算 seed 为0的 MurmurHash3 x64_128，返回128位结果的前64位
+func Murmur3(b []byte) uint64 {
+	n := len(b)
+	var h1, h2 uint64
+	for ; len(b) >= 16; b = b[16:] {
+		k1 := binary.LittleEndian.Uint64(b[0:8])
+		k2 := binary.LittleEndian.Uint64(b[8:16])
+
+		k1 *= murmurC1
+		k1 = bits.RotateLeft64(k1, 31)
+		k1 *= murmurC2
+		h1 ^= k1
+		h1 = bits.RotateLeft64(h1, 27)
+		h1 += h2
+		h1 = h1*5 + 0x52dce729
+
+		k2 *= murmurC2
+		k2 = bits.RotateLeft64(k2, 33)
+		k2 *= murmurC1
+		h2 ^= k2
+		h2 = bits.RotateLeft64(h2, 31)
+		h2 += h1
+		h2 = h2*5 + 0x38495ab5
+	}
+
+	var k1, k2 uint64
+	switch len(b) {
+	case 15:
+		k2 ^= uint64(b[14]) << 48
+		fallthrough
+	case 14:
+		k2 ^= uint64(b[13]) << 40
+		fallthrough
+	case 13:
+		k2 ^= uint64(b[12]) << 32
+		fallthrough
+	case 12:
+		k2 ^= uint64(b[11]) << 24
+		fallthrough
+	case 11:
+		k2 ^= uint64(b[10]) << 16
+		fallthrough
+	case 10:
+		k2 ^= uint64(b[9]) << 8
+		fallthrough
+	case 9:
+		k2 ^= uint64(b[8])
+		k2 *= murmurC2
+		k2 = bits.RotateLeft64(k2, 33)
+		k2 *= murmurC1
+		h2 ^= k2
+		fallthrough
+	case 8:
+		k1 ^= uint64(b[7]) << 56
+		fallthrough
+	case 7:
+		k1 ^= uint64(b[6]) << 48
+		fallthrough
+	case 6:
+		k1 ^= uint64(b[5]) << 40
+		fallthrough
+	case 5:
+		k1 ^= uint64(b[4]) << 32
+		fallthrough
+	case 4:
+		k1 ^= uint64(b[3]) << 24
+		fallthrough
+	case 3:
+		k1 ^= uint64(b[2]) << 16
+		fallthrough
+	case 2:
+		k1 ^= uint64(b[1]) << 8
+		fallthrough
+	case 1:
+		k1 ^= uint64(b[0])
+		k1 *= murmurC1
+		k1 = bits.RotateLeft64(k1, 31)
+		k1 *= murmurC2
+		h1 ^= k1
+	}
+
+	h1 ^= uint64(n)
+	h2 ^= uint64(n)
+	h1 += h2
+	h2 += h1
+	h1 = murmurFmix(h1)
+	h2 = murmurFmix(h2)
+	h1 += h2
+	return h1
+}
+
+func murmurFmix(k uint64) uint64 {
+	k ^= k >> 33
+	k *= 0xff51afd7ed558ccd
+	k ^= k >> 33
+	k *= 0xc4ceb9fe1a85ec53
+	k ^= k >> 33
+	return k
+}
@@ -0,0 +1,38 @@
+package consistenthash
+
+import "testing"
+
+func TestXXHash64(t *testing.T) {
+	cases := map[string]uint64{
+		"":    0xef46db3751d8e999,
+		"a":   0xd24ec4f1a98c6e5b,
+		"abc": 0x44bc2cf5ad770999,
+		// 32字节及以上的输入经过四路累加的主循环
+		"0123456789abcdef0123456789abcdef":            0x642a94958e71e6c5,
+		"The quick brown fox jumps over the lazy dog": 0x0b242d361fda71bc,
+	}
+	// 100字节：三轮主循环，再处理剩余的4字节
+	long := make([]byte, 100)
+	for i := range long {
+		long[i] = byte(i)
+	}
+	cases[string(long)] = 0x6ac1e58032166597
+	for in, want := range cases {
+		if got := XXHash64([]byte(in)); got != want {
+			t.Errorf("XXHash64(%q) = %#x, want %#x", in, got, want)
+		}
+	}
+}
+
+func TestMurmur3(t *testing.T) {
+	cases := map[string]uint64{
+		"":      0,
+		"hello": 0xcbd8a7b341bd9b02,
+		"The quick brown fox jumps over the lazy dog": 0xe34bbc7bbc071b6c,
+	}
+	for in, want := range cases {
+		if got := Murmur3([]byte(in)); got != want {
+			t.Errorf("Murmur3(%q) = %#x, want %#x", in, got, want)
+		}
+	}
+}
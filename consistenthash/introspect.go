@@ -0,0 +1,72 @@
+package consistenthash
+
+import (
+	"math"
+	"sort"
+)
+
+// Ownership 说明了一个key为什么被分配到某个节点
+type Ownership struct {
+	Key         string `json:"key"`
+	KeyHash     uint64 `json:"key_hash"`     // key在哈希环上的位置
+	VirtualNode uint64 `json:"virtual_node"` // 顺时针找到的第一个虚拟节点的位置
+	Node        string `json:"node"`         // 该虚拟节点所属的真实节点
+}
+
+// VirtualNode 哈希环上的一个虚拟节点
+type VirtualNode struct {
+	Hash uint64 `json:"hash"`
+	Node string `json:"node"`
+}
+
+// Owner 返回key的归属节点以及路由过程中的哈希值，哈希环为空时 Node 为空
+func (m *Map) Owner(key string) Ownership {
+	s := m.load()
+	o := Ownership{Key: key, KeyHash: m.hash([]byte(key))}
+	if len(s.ring) == 0 {
+		return o
+	}
+	idx := sort.Search(len(s.ring), func(i int) bool {
+		return s.ring[i] >= o.KeyHash
+	})
+	o.VirtualNode = s.ring[idx%len(s.ring)]
+	o.Node = s.hashMap[o.VirtualNode]
+	return o
+}
+
+// VirtualNodes 按位置顺序返回哈希环上的所有虚拟节点
+func (m *Map) VirtualNodes() []VirtualNode {
+	s := m.load()
+	vnodes := make([]VirtualNode, len(s.ring))
+	for i, h := range s.ring {
+		vnodes[i] = VirtualNode{Hash: h, Node: s.hashMap[h]}
+	}
+	return vnodes
+}
+
+// Distribution 返回每个真实节点负责的哈希空间比例，所有节点之和为1，用于检查负载是否均衡。
+// 哈希空间的大小根据虚拟节点的位置推断：所有位置都小于2^32时按32位哈希(例如crc32)计算，否则按64位计算。
+func (m *Map) Distribution() map[string]float64 {
+	s := m.load()
+	dist := make(map[string]float64, len(s.nodes))
+	n := len(s.ring)
+	if n == 0 {
+		return dist
+	}
+	if n == 1 {
+		dist[s.hashMap[s.ring[0]]] = 1
+		return dist
+	}
+	space := math.Pow(2, 64)
+	wrap := s.ring[0] - s.ring[n-1] // 64位空间中 uint64 的减法自然回绕
+	if s.ring[n-1] <= math.MaxUint32 {
+		space = math.Pow(2, 32)
+		wrap = s.ring[0] + 1<<32 - s.ring[n-1]
+	}
+	// 每个虚拟节点负责从上一个虚拟节点(不含)到自身(含)的一段哈希空间
+	dist[s.hashMap[s.ring[0]]] += float64(wrap) / space
+	for i := 1; i < n; i++ {
+		dist[s.hashMap[s.ring[i]]] += float64(s.ring[i]-s.ring[i-1]) / space
+	}
+	return dist
+}
@@ -0,0 +1,62 @@
+package consistenthash
+
+// JumpHash 实现了 Lamping 和 Veach 提出的 jump consistent hash，把key映射到 [0, buckets) 中的一个分片。
+// 不需要哈希环，也不占用额外内存，各分片负责的key数量几乎完全相等；
+// 分片数从n增加到n+1时，只有约1/(n+1)的key会移动到新分片。buckets 小于等于0时返回-1。
+func JumpHash(key uint64, buckets int) int {
+	if buckets <= 0 {
+		return -1
+	}
+	var b, j int64 = -1, 0
+	for j < int64(buckets) {
+		b = j
+		key = key*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+	return int(b)
+}
+
+// Jump 是基于 jump consistent hash 的节点选择器，适用于分片编号固定、节点稳定的集群。
+// 第i个节点负责编号为i的分片，因此只能在末尾增加或删除节点，否则大量key会改变归属。
+// Jump 是不可变的，可以被并发使用。
+type Jump struct {
+	hash   Hash64
+	shards []string
+}
+
+// NewJump 创建一个 Jump，shards 按分片编号排列，fn 为nil时使用 XXHash64
+func NewJump(fn Hash64, shards ...string) *Jump {
+	if fn == nil {
+		fn = XXHash64
+	}
+	return &Jump{hash: fn, shards: append([]string(nil), shards...)}
+}
+
+// Get 返回key所属的节点，没有节点时返回空字符串
+func (j *Jump) Get(key string) string {
+	if len(j.shards) == 0 {
+		return ""
+	}
+	return j.shards[JumpHash(j.hash([]byte(key)), len(j.shards))]
+}
+
+// GetN 返回key的n个副本节点，第一个就是 Get 的结果，其余依次为之后编号的分片。节点不足n个时返回全部节点。
+func (j *Jump) GetN(key string, n int) []string {
+	if len(j.shards) == 0 || n <= 0 {
+		return nil
+	}
+	if n > len(j.shards) {
+		n = len(j.shards)
+	}
+	first := JumpHash(j.hash([]byte(key)), len(j.shards))
+	nodes := make([]string, n)
+	for i := range nodes {
+		nodes[i] = j.shards[(first+i)%len(j.shards)]
+	}
+	return nodes
+}
+
+// Shards 返回按分片编号排列的节点
+func (j *Jump) Shards() []string {
+	return append([]string(nil), j.shards...)
+}
@@ -0,0 +1,183 @@
+package gocache
+
+import (
+	_ "embed"
+	"net/http"
+	"runtime"
+	"sync"
+	"time"
+)
+
+//go:embed dashboard.html
+var dashboardHTML []byte
+
+const (
+	defaultRecentEvictions = 100
+	dashboardTopKeys       = 10 // 每个缓存组显示的热点key数量
+)
+
+// dashboard 运维端口上的网页控制台，见 WithDashboard
+type dashboard struct {
+	mu        sync.Mutex
+	evictions []CacheEvent // 最近被淘汰的数据，环形缓冲区
+	next      int          // 下一个写入的位置
+	full      bool         // 缓冲区是否已经写满过
+	cancel    func()       // 取消订阅淘汰事件，没有订阅时为nil
+}
+
+// WithDashboard 在运维调试端口(见 WithOpsListener 和 OpsHandler)上开启网页控制台 /debug/dashboard，
+// 显示哈希环上的节点和各节点负责的哈希空间比例、各缓存组的命中率和内存占用、热点key(需要 WithKeyHeat)以及最近被淘汰的
+// recentEvictions 条数据(0表示100条)。控制台没有鉴权，与其他运维接口一样应当只监听内网或本机地址。
+// 记录淘汰需要订阅缓存事件(见 SubscribeEvents)，服务运行期间每次缓存读写都会产生一个事件，有少量额外开销。
+func WithDashboard(recentEvictions int) ServerOption {
+	return func(s *Server) {
+		if recentEvictions <= 0 {
+			recentEvictions = defaultRecentEvictions
+		}
+		s.dashboard = &dashboard{evictions: make([]CacheEvent, recentEvictions)}
+	}
+}
+
+// startDashboard 开始记录淘汰事件，调用时需持有 s.mu
+func (s *Server) startDashboard() {
+	d := s.dashboard
+	if d == nil {
+		return
+	}
+	ch, cancel := SubscribeEvents(EventFilter{Types: []EventType{EventEviction}})
+	d.mu.Lock()
+	d.cancel = cancel
+	d.mu.Unlock()
+	go func() {
+		for e := range ch { // 取消订阅后通道被关闭
+			d.record(e)
+		}
+	}()
+}
+
+// stopDashboard 停止记录淘汰事件，已经记录的数据保留，调用时需持有 s.mu
+func (s *Server) stopDashboard() {
+	d := s.dashboard
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	cancel := d.cancel
+	d.cancel = nil
+	d.mu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+}
+
+// record 记录一次淘汰，缓冲区写满后覆盖最早的记录
+func (d *dashboard) record(e CacheEvent) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.evictions[d.next] = e
+	d.next = (d.next + 1) % len(d.evictions)
+	if d.next == 0 {
+		d.full = true
+	}
+}
+
+// recent 返回最近的淘汰记录，从新到旧排列
+func (d *dashboard) recent() []DashboardEviction {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	n := d.next
+	if d.full {
+		n = len(d.evictions)
+	}
+	out := make([]DashboardEviction, 0, n)
+	for i := 1; i <= n; i++ {
+		e := d.evictions[(d.next-i+len(d.evictions))%len(d.evictions)]
+		out = append(out, DashboardEviction{Group: e.Group, Key: e.Key, Size: e.Size, Time: e.Time})
+	}
+	return out
+}
+
+// DashboardData 是 /debug/dashboard/data 返回的控制台数据
+type DashboardData struct {
+	Self      string              `json:"self"`
+	Time      time.Time           `json:"time"`
+	Warm      WarmProgress        `json:"warm"`
+	Nodes     []DashboardNode     `json:"nodes"`
+	Groups    []DashboardGroup    `json:"groups"`
+	Evictions []DashboardEviction `json:"evictions"` // 最近被淘汰的数据，从新到旧排列
+	Memory    DashboardMemory     `json:"memory"`
+}
+
+// DashboardNode 是哈希环上的一个节点
+type DashboardNode struct {
+	RingNode
+	Self    bool `json:"self"`
+	Evicted bool `json:"evicted"` // 因健康检查失败被移出哈希环，见 WithPeerHealthCheck
+}
+
+// DashboardGroup 是一个缓存组的概况
+type DashboardGroup struct {
+	GroupStats
+	CacheType string    `json:"cache_type"`
+	HitRatio  float64   `json:"hit_ratio"`          // 本地缓存(主缓存和热点缓存)的命中率，没有读取时为0
+	TopKeys   []KeyHeat `json:"top_keys,omitempty"` // 读取最多的key，需要 WithKeyHeat
+}
+
+// DashboardEviction 是一条淘汰记录
+type DashboardEviction struct {
+	Group string    `json:"group"`
+	Key   string    `json:"key"`
+	Size  int       `json:"size"`
+	Time  time.Time `json:"time"`
+}
+
+// DashboardMemory 是进程的内存和运行时概况，见 runtime.MemStats
+type DashboardMemory struct {
+	HeapAlloc  uint64 `json:"heap_alloc"`
+	HeapInuse  uint64 `json:"heap_inuse"`
+	Sys        uint64 `json:"sys"`
+	NumGC      uint32 `json:"num_gc"`
+	Goroutines int    `json:"goroutines"`
+}
+
+// DashboardData 返回控制台显示的数据，没有开启 WithDashboard 时 Evictions 为空
+func (s *Server) DashboardData() DashboardData {
+	data := DashboardData{Self: s.self, Time: time.Now(), Warm: s.WarmProgress()}
+	evicted := map[string]bool{}
+	for _, addr := range s.EvictedPeers() {
+		evicted[addr] = true
+	}
+	for _, n := range s.RingState().Nodes {
+		data.Nodes = append(data.Nodes, DashboardNode{RingNode: n, Self: n.Addr == s.self})
+		delete(evicted, n.Addr)
+	}
+	for addr := range evicted {
+		data.Nodes = append(data.Nodes, DashboardNode{RingNode: RingNode{Addr: addr}, Evicted: true})
+	}
+	for _, g := range Groups() {
+		st := g.Stats()
+		dg := DashboardGroup{GroupStats: st, CacheType: g.Config().CacheType, TopKeys: g.TopKeys(dashboardTopKeys, 0, false)}
+		if hits := st.HotHits + st.Hits; hits+st.Misses > 0 {
+			dg.HitRatio = float64(hits) / float64(hits+st.Misses)
+		}
+		data.Groups = append(data.Groups, dg)
+	}
+	if s.dashboard != nil {
+		data.Evictions = s.dashboard.recent()
+	}
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	data.Memory = DashboardMemory{HeapAlloc: ms.HeapAlloc, HeapInuse: ms.HeapInuse, Sys: ms.Sys, NumGC: ms.NumGC, Goroutines: runtime.NumGoroutine()}
+	return data
+}
+
+// serveDashboard 返回控制台页面，页面每2秒请求一次 /debug/dashboard/data 刷新
+func serveDashboard(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/debug/dashboard/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", "default-src 'self'; style-src 'unsafe-inline'; script-src 'unsafe-inline'")
+	w.Write(dashboardHTML)
+}
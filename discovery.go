@@ -0,0 +1,99 @@
+package gocache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"gocache/registry"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// WithDiscovery 开启动态节点发现：启动后监听etcd中注册的节点，节点注册时自动加入哈希环并创建客户端(Set)，
+// 注销或者租约过期时自动移除(Remove)，不需要再手动调用 Set。本节点注册之后也会出现在哈希环中。
+// 新发现的节点注册的元数据(权重、可用区等，见 NodeMetadata)通过 SetPeerMetadata 生效。
+func WithDiscovery() ServerOption {
+	return func(s *Server) {
+		s.discovery = true
+	}
+}
+
+// WithStaticPeers 使用固定的节点列表运行，不依赖etcd：启动时不注册到etcd，节点之间按地址直接建立连接，
+// WithDiscovery 不再生效。peers 为集群中的所有节点(包括本节点)，之后仍然可以用 Set、Remove 修改。
+func WithStaticPeers(peers ...string) ServerOption {
+	return func(s *Server) {
+		s.static = true
+		s.staticPeers = peers
+	}
+}
+
+// WithRegistry 使用指定的注册中心代替内置的etcd注册，例如 registry.ConsulRegistry，可以由 registry.FromEnv 按配置选择。
+// 节点之间按地址直接连接；开启 WithDiscovery 时通过注册中心的 Watch 发现节点。
+// 注册的元数据为启动时的 NodeMetadata，缓存组的记录和 RegistryStats、RegistryEvents 只适用于内置的etcd注册。
+func WithRegistry(r registry.Registry) ServerOption {
+	return func(s *Server) {
+		s.backend = r
+	}
+}
+
+// startDiscovery 在后台通过域名解析(见 WithDNSDiscovery)或者etcd发现节点，调用时需持有 s.mu
+func (s *Server) startDiscovery() {
+	if s.dns != nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		s.stopDiscover = cancel
+		go s.watchDNS(ctx)
+		return
+	}
+	if !s.discovery || s.static {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s.stopDiscover = cancel
+	var lookup metadataLookup // 在发现节点的goroutine中设置和使用
+	apply := func(added, removed []string) {
+		if ctx.Err() == nil { // 停止之后不再修改哈希环
+			s.applyDiscovery(added, removed)
+			s.loadPeerMetadata(ctx, lookup, added)
+		}
+	}
+	if s.backend != nil {
+		if mr, ok := s.backend.(registry.MetadataResolver); ok {
+			lookup = mr.Metadata
+		}
+		go s.backend.Watch(ctx, s.namespace, apply)
+		return
+	}
+	go func() {
+		cli, err := clientv3.New(s.etcdConfig)
+		if err != nil {
+			s.reportErr(fmt.Errorf("discovery: %v", err))
+			return
+		}
+		defer cli.Close()
+		lookup = func(ctx context.Context, service, addr string) (json.RawMessage, error) {
+			return registry.LookupMetadata(ctx, cli, service, addr)
+		}
+		registry.WatchNodesWithLogger(ctx, cli, s.namespace, apply, s.logger)
+	}()
+}
+
+// stopDiscovery 停止监听注册的节点，已经发现的节点保留在哈希环中，调用时需持有 s.mu
+func (s *Server) stopDiscovery() {
+	if s.stopDiscover != nil {
+		s.stopDiscover()
+		s.stopDiscover = nil
+	}
+}
+
+// applyDiscovery 把新注册的节点加入哈希环，移除已经注销的节点
+func (s *Server) applyDiscovery(added, removed []string) {
+	if len(added) > 0 {
+		s.logger.Info("discovered peers", "self", s.self, "peers", added)
+		s.Set(added...)
+	}
+	if len(removed) > 0 {
+		s.logger.Info("peers left", "self", s.self, "peers", removed)
+		s.Remove(removed...)
+	}
+}
@@ -0,0 +1,225 @@
+package gocache
+
+import (
+	"context"
+	"errors"
+	pb "gocache/gocachepb"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestApplyDiscovery(t *testing.T) {
+	svr, err := NewServer("localhost:9101", WithDiscovery())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer svr.Stop()
+
+	svr.applyDiscovery([]string{"localhost:9101", "localhost:9102", "localhost:9103"}, nil)
+	if nodes := svr.peers.Nodes(); !reflect.DeepEqual(nodes, []string{"localhost:9101", "localhost:9102", "localhost:9103"}) {
+		t.Fatalf("ring after join = %v", nodes)
+	}
+	if _, ok := svr.clients["localhost:9102"]; !ok {
+		t.Fatal("expect a client for the discovered peer")
+	}
+
+	svr.applyDiscovery(nil, []string{"localhost:9102"})
+	if nodes := svr.peers.Nodes(); !reflect.DeepEqual(nodes, []string{"localhost:9101", "localhost:9103"}) {
+		t.Fatalf("ring after leave = %v", nodes)
+	}
+	if _, ok := svr.clients["localhost:9102"]; ok {
+		t.Fatal("expect the client of the departed peer to be closed")
+	}
+}
+
+func TestStaticPeers(t *testing.T) {
+	NewGroup("static", 2<<10, "lru", GetterFunc(func(key string) ([]byte, error) {
+		return []byte("v:" + key), nil
+	}))
+	var addrs []string
+	for i := 0; i < 2; i++ {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		addrs = append(addrs, lis.Addr().String())
+		lis.Close()
+	}
+	a, err := NewServer(addrs[0], WithStaticPeers(addrs...), WithDiscovery())
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := NewServer(addrs[1], WithStaticPeers(addrs...))
+	if nodes := a.peers.Nodes(); !reflect.DeepEqual(nodes, addrs) && !reflect.DeepEqual(nodes, []string{addrs[1], addrs[0]}) {
+		t.Fatalf("ring = %v, want %v", nodes, addrs)
+	}
+	for _, svr := range []*Server{a, b} {
+		go svr.Start()
+		defer svr.Stop()
+	}
+
+	// 不经过etcd，直接按地址访问另一个节点
+	client := a.clients[addrs[1]]
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		out := &pb.Response{}
+		err := client.Get(&pb.Request{Group: "static", Key: "k"}, out)
+		if err == nil {
+			if string(out.Value) != "v:k" {
+				t.Fatalf("unexpected value %q", out.Value)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("peer is not reachable without etcd: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if a.stopDiscover != nil {
+		t.Fatal("discovery should be disabled with static peers")
+	}
+	select {
+	case err := <-a.Err():
+		t.Fatalf("unexpected background error %v", err)
+	default:
+	}
+}
+
+func TestDNSDiscovery(t *testing.T) {
+	svr, err := NewServer("10.0.0.1:8001", WithDNSDiscovery("gocache.default.svc.cluster.local", "8001", time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	answers := [][]string{{"10.0.0.1", "10.0.0.2"}, {"10.0.0.1", "10.0.0.3", "fd00::4"}, nil}
+	svr.dns.lookup = func(ctx context.Context, host string) ([]string, error) {
+		ips := answers[0]
+		answers = answers[1:]
+		if ips == nil {
+			return nil, errors.New("no such host")
+		}
+		return ips, nil
+	}
+
+	want := [][]string{
+		{"10.0.0.1:8001", "10.0.0.2:8001"},
+		{"10.0.0.1:8001", "10.0.0.3:8001", "[fd00::4]:8001"},
+		{"10.0.0.1:8001", "10.0.0.3:8001", "[fd00::4]:8001"}, // 解析失败时保留之前的节点
+	}
+	for i := range want {
+		err := svr.resolveDNS(context.Background())
+		if (err != nil) != (i == 2) {
+			t.Fatalf("round %d: unexpected error %v", i, err)
+		}
+		if nodes := svr.peers.Nodes(); !reflect.DeepEqual(nodes, want[i]) {
+			t.Fatalf("round %d: ring = %v, want %v", i, nodes, want[i])
+		}
+	}
+	if _, ok := svr.clients["10.0.0.2:8001"]; ok {
+		t.Fatal("expect the client of the removed pod to be closed")
+	}
+	if !svr.static || svr.clients["10.0.0.3:8001"].connect == nil {
+		t.Fatal("dns discovery should not depend on etcd")
+	}
+}
+
+// memRegistry 在内存中实现 registry.Registry，Watch 只通知一次当前的节点
+type memRegistry struct {
+	registered chan string
+	nodes      []string
+}
+
+func (m *memRegistry) Register(service, addr string, metadata interface{}, stop chan error) error {
+	m.registered <- service + "/" + addr
+	return <-stop
+}
+
+func (m *memRegistry) Deregister(service, addr string) error { return nil }
+
+func (m *memRegistry) Watch(ctx context.Context, service string, fn func(added, removed []string)) error {
+	fn(m.nodes, nil)
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (m *memRegistry) Resolve(ctx context.Context, service string) ([]string, error) {
+	return m.nodes, nil
+}
+
+func TestWithRegistry(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := lis.Addr().String()
+	lis.Close()
+	reg := &memRegistry{registered: make(chan string, 1), nodes: []string{addr, "127.0.0.1:9"}}
+	svr, err := NewServer(addr, WithRegistry(reg), WithDiscovery(), WithNamespace("cluster-c"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	go svr.Start()
+	defer svr.Stop()
+
+	if got := <-reg.registered; got != "cluster-c/"+addr {
+		t.Fatalf("registered %q", got)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for len(svr.peers.Nodes()) != 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("ring = %v, want the nodes from the registry", svr.peers.Nodes())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	svr.mu.RLock()
+	client := svr.clients["127.0.0.1:9"]
+	svr.mu.RUnlock()
+	if client == nil || client.baseURL != "cluster-c/127.0.0.1:9" {
+		t.Fatalf("unexpected client %+v", client)
+	}
+}
+
+// failingRegistry 的 Register 立即返回错误，例如地址无效或者端口被占用
+type failingRegistry struct {
+	memRegistry
+	calls chan struct{}
+}
+
+func (f *failingRegistry) Register(service, addr string, metadata interface{}, stop chan error) error {
+	close(f.calls)
+	return errors.New("bind: address already in use")
+}
+
+func TestRegistryFailsDuringStart(t *testing.T) {
+	for _, graceful := range []bool{false, true} {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		addr := lis.Addr().String()
+		lis.Close()
+		reg := &failingRegistry{calls: make(chan struct{})}
+		svr, err := NewServer(addr, WithRegistry(reg))
+		if err != nil {
+			t.Fatal(err)
+		}
+		done := make(chan error, 1)
+		go func() { done <- svr.Start() }()
+		<-reg.calls
+		// 注册已经出错返回，停止不能阻塞或者 panic
+		if graceful {
+			if err := svr.GracefulStop(time.Second); err != nil {
+				t.Fatal(err)
+			}
+		} else {
+			svr.Stop()
+		}
+		if err := <-done; err != nil {
+			t.Fatalf("Start returned %v", err)
+		}
+		if st := svr.State(); st != StateStopped {
+			t.Fatalf("state = %v", st)
+		}
+	}
+}
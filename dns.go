@@ -0,0 +1,86 @@
+package gocache
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"time"
+)
+
+// defaultDNSInterval 默认每隔多久重新解析一次服务的域名
+const defaultDNSInterval = 10 * time.Second
+
+// dnsDiscovery 通过解析域名发现节点，见 WithDNSDiscovery
+type dnsDiscovery struct {
+	host     string
+	port     string
+	interval time.Duration
+	lookup   func(ctx context.Context, host string) ([]string, error) // 默认为 net.DefaultResolver.LookupHost，测试时可以替换
+	known    map[string]bool                                          // 上一次解析得到的节点
+}
+
+// WithDNSDiscovery 通过定期解析域名发现节点，适用于Kubernetes的headless Service：
+// 域名解析为所有就绪Pod的IP，节点地址为 IP:port，解析结果变化时自动更新哈希环。
+// 使用该方式时不依赖etcd(与 WithStaticPeers 相同，不注册到etcd，节点之间按地址直接连接)，
+// 本节点的地址需要是其他节点解析得到的地址，例如通过 Downward API 取得的 $(POD_IP):port。
+// interval 小于等于0时每10秒解析一次；解析失败时保留之前的节点。
+func WithDNSDiscovery(host, port string, interval time.Duration) ServerOption {
+	return func(s *Server) {
+		if interval <= 0 {
+			interval = defaultDNSInterval
+		}
+		s.static = true
+		s.dns = &dnsDiscovery{host: host, port: port, interval: interval, lookup: net.DefaultResolver.LookupHost}
+	}
+}
+
+// watchDNS 每隔 interval 解析一次域名并更新哈希环，直到ctx被取消
+func (s *Server) watchDNS(ctx context.Context) {
+	ticker := time.NewTicker(s.dns.interval)
+	defer ticker.Stop()
+	for {
+		if err := s.resolveDNS(ctx); err != nil && ctx.Err() == nil {
+			s.reportErr(fmt.Errorf("dns discovery: %v", err))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// resolveDNS 解析一次域名，把新出现的地址加入哈希环，移除消失的地址
+func (s *Server) resolveDNS(ctx context.Context) error {
+	d := s.dns
+	ctx, cancel := context.WithTimeout(ctx, d.interval)
+	defer cancel()
+	ips, err := d.lookup(ctx, d.host)
+	if err != nil {
+		return err
+	}
+	if ctx.Err() != nil { // 停止之后不再修改哈希环
+		return ctx.Err()
+	}
+	current := make(map[string]bool, len(ips))
+	for _, ip := range ips {
+		current[net.JoinHostPort(ip, d.port)] = true
+	}
+	var added, removed []string
+	for addr := range current {
+		if !d.known[addr] {
+			added = append(added, addr)
+		}
+	}
+	for addr := range d.known {
+		if !current[addr] {
+			removed = append(removed, addr)
+		}
+	}
+	d.known = current
+	sort.Strings(added)
+	sort.Strings(removed)
+	s.applyDiscovery(added, removed)
+	return nil
+}
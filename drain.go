@@ -0,0 +1,102 @@
+package gocache
+
+import (
+	"errors"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+// ErrDrainTimeout 表示 GracefulStop 在截止时间内没有等到所有请求完成，剩余的连接被强制关闭
+var ErrDrainTimeout = errors.New("gocache: drain deadline exceeded")
+
+// WithDrainWindow 设置停止时的排空窗口：Stop 和 GracefulStop 先从注册中心注销本节点(etcd中的记录立即删除，
+// 开启了 WithDiscovery 的节点据此把key路由到别处)，在窗口内继续处理请求并报告 SERVING，窗口结束后才报告 NOT_SERVING
+// 并关闭监听端口。0表示不等待(默认)，注销的同时报告 NOT_SERVING。
+func WithDrainWindow(d time.Duration) ServerOption {
+	return func(s *Server) {
+		s.drainWindow = d
+	}
+}
+
+// beginLeave 停止后台任务并通知注册goroutine注销本节点，没有排空窗口时立即报告 NOT_SERVING，调用时需持有 s.mu
+func (s *Server) beginLeave() {
+	s.stopRebalance()
+	s.stopDiscovery()
+	s.stopProbe()
+	s.stopDashboard()
+	s.stopListeners()
+	if s.drainWindow <= 0 {
+		s.setServing(false)
+	}
+	close(s.stopSignal) // 关闭而不是发送：注册可能已经出错返回，没有人接收
+	s.state = StateStopped
+}
+
+// awaitLeave 等待注销完成，在排空窗口内继续处理请求，然后报告 NOT_SERVING，调用时不能持有 s.mu
+func (s *Server) awaitLeave(registered <-chan struct{}) {
+	<-registered
+	if s.drainWindow <= 0 {
+		return
+	}
+	s.logger.Info("leaving, keep serving", "self", s.self, "window", s.drainWindow)
+	time.Sleep(s.drainWindow)
+	s.mu.Lock()
+	if s.state == StateStopped { // 窗口期间可能已经重新启动
+		s.setServing(false)
+	}
+	s.mu.Unlock()
+}
+
+// GracefulStop 优雅地停止服务，如果server没有运行 这将是一个no-op：
+//  1. 健康检查报告 NOT_SERVING，并从etcd注销，新的请求不再发往本节点，设置了 WithDrainWindow 时
+//     先注销，在排空窗口内继续处理请求，之后才报告 NOT_SERVING；
+//  2. 停止接受新的连接，等待正在处理的请求完成，最多等待timeout，0表示一直等待；
+//  3. 超过timeout后强制关闭剩余的连接并返回 ErrDrainTimeout；
+//  4. 关闭到其他节点的客户端，处理中的请求可能还需要转发给其他节点，因此放在最后。
+func (s *Server) GracefulStop(timeout time.Duration) error {
+	s.mu.Lock()
+	if s.state != StateRunning {
+		s.mu.Unlock()
+		return nil
+	}
+	s.beginLeave()
+	gs, registered := s.grpcServer, s.registered
+	s.mu.Unlock()
+
+	s.awaitLeave(registered) // 等待注销完成
+	err := drain(gs, timeout)
+	if err != nil {
+		s.logger.Warn("connections closed", "self", s.self, "error", err)
+	}
+
+	s.mu.Lock()
+	if s.state == StateStopped { // 排空期间可能已经重新启动，新的客户端不能关闭
+		s.closeClients()
+	}
+	s.mu.Unlock()
+	return err
+}
+
+// drain 等待gRPC服务器处理完正在进行的请求，超过timeout后强制关闭，timeout为0表示一直等待
+func drain(gs *grpc.Server, timeout time.Duration) error {
+	done := make(chan struct{})
+	go func() {
+		gs.GracefulStop()
+		close(done)
+	}()
+	if timeout <= 0 {
+		<-done
+		return nil
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-done:
+		return nil
+	case <-timer.C:
+		gs.Stop() // GracefulStop 随之返回
+		<-done
+		return ErrDrainTimeout
+	}
+}
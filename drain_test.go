@@ -0,0 +1,110 @@
+package gocache
+
+import (
+	"context"
+	pb "gocache/gocachepb"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestDrain(t *testing.T) {
+	started, release := make(chan string, 2), make(chan struct{})
+	NewGroup("drain", 2<<10, "lru", GetterFunc(func(key string) ([]byte, error) {
+		started <- key
+		<-release
+		return []byte(key), nil
+	}))
+	svr, _ := NewServer("127.0.0.1:9831")
+	serve := func() (*Client, func(time.Duration) error) {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		gs := svr.newGRPCServer()
+		go gs.Serve(lis)
+		return directClient(lis.Addr().String()), func(d time.Duration) error { return drain(gs, d) }
+	}
+	get := func(c *Client, key string) chan error {
+		errc := make(chan error, 1)
+		go func() { errc <- c.Get(&pb.Request{Group: "drain", Key: key}, &pb.Response{}) }()
+		<-started
+		return errc
+	}
+
+	// 等待处理中的请求完成
+	client, stop := serve()
+	errc := get(client, "a")
+	drained := make(chan error, 1)
+	go func() { drained <- stop(0) }()
+	select {
+	case err := <-drained:
+		t.Fatalf("drain returned with a request in flight: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	release <- struct{}{}
+	if err := <-errc; err != nil {
+		t.Fatalf("in-flight request should succeed, got %v", err)
+	}
+	if err := <-drained; err != nil {
+		t.Fatal(err)
+	}
+
+	// 超过截止时间后强制关闭
+	client, stop = serve()
+	errc = get(client, "b")
+	if err := stop(20 * time.Millisecond); err != ErrDrainTimeout {
+		t.Fatalf("expect ErrDrainTimeout, got %v", err)
+	}
+	if err := <-errc; err == nil {
+		t.Fatal("request should fail after forced close")
+	}
+	close(release)
+}
+
+func TestDrainWindow(t *testing.T) {
+	NewGroup("drainwindow", 2<<10, "lru", GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}))
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := lis.Addr().String()
+	lis.Close()
+	svr, _ := NewServer(addr, WithStaticPeers(addr), WithDrainWindow(300*time.Millisecond))
+	go svr.Start()
+	client := directClient(addr)
+	defer client.Close()
+	get := func() error {
+		return client.Get(&pb.Request{Group: "drainwindow", Key: "k"}, &pb.Response{})
+	}
+	for deadline := time.Now().Add(2 * time.Second); get() != nil; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("server did not start")
+		}
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		svr.Stop()
+		close(stopped)
+	}()
+	time.Sleep(100 * time.Millisecond)
+	// 排空窗口内已经注销，但仍然报告 SERVING 并处理请求
+	if err := client.checkHealth(context.Background(), time.Second); err != nil {
+		t.Fatalf("expect SERVING during the drain window, got %v", err)
+	}
+	if err := get(); err != nil {
+		t.Fatalf("expect reads to be served during the drain window, got %v", err)
+	}
+	select {
+	case <-stopped:
+		t.Fatal("Stop returned before the drain window elapsed")
+	default:
+	}
+	<-stopped
+	if err := get(); err == nil {
+		t.Fatal("expect reads to fail after Stop")
+	}
+}
@@ -0,0 +1,72 @@
+package gocache
+
+import (
+	"sync"
+	"time"
+)
+
+// errorCache 短暂缓存数据源的加载错误。
+// 数据源故障时，同一个key在ttl内只会重试一次，避免每个请求都打到已经出错的数据源上。
+// 它与"数据不存在"的缓存是不同的概念：这里缓存的是临时性故障。
+type errorCache struct {
+	mu   sync.Mutex
+	ttl  time.Duration
+	errs map[string]cachedErr
+}
+
+// cachedErr 缓存的加载错误及其过期时间
+type cachedErr struct {
+	err    error
+	expire time.Time
+}
+
+// maxErrorCacheScan 缓存的错误数超过该值时，写入前先清理已过期的错误，避免map无限增长
+const maxErrorCacheScan = 1024
+
+func newErrorCache(ttl time.Duration) *errorCache {
+	return &errorCache{ttl: ttl, errs: make(map[string]cachedErr)}
+}
+
+// get 返回key对应的未过期错误，没有则返回nil
+func (c *errorCache) get(key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.errs[key]
+	if !ok {
+		return nil
+	}
+	if time.Now().After(e.expire) {
+		delete(c.errs, key)
+		return nil
+	}
+	return e.err
+}
+
+// add 缓存一个加载错误
+func (c *errorCache) add(key string, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	if len(c.errs) >= maxErrorCacheScan {
+		for k, e := range c.errs {
+			if now.After(e.expire) {
+				delete(c.errs, k)
+			}
+		}
+	}
+	c.errs[key] = cachedErr{err: err, expire: now.Add(c.ttl)}
+}
+
+// remove 删除key对应的错误，例如数据被显式写入之后
+func (c *errorCache) remove(key string) {
+	c.mu.Lock()
+	delete(c.errs, key)
+	c.mu.Unlock()
+}
+
+// clear 删除所有缓存的错误
+func (c *errorCache) clear() {
+	c.mu.Lock()
+	c.errs = make(map[string]cachedErr)
+	c.mu.Unlock()
+}
@@ -0,0 +1,66 @@
+package gocache
+
+import (
+	"crypto/tls"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// EnvNamespace 没有通过 WithNamespace 指定命名空间时读取的环境变量，etcd的配置见 registry.EtcdConfigFromEnv
+const EnvNamespace = "GOCACHE_NAMESPACE"
+
+// defaultNamespace 默认的命名空间，节点注册在etcd的 gocache/<addr> 下
+const defaultNamespace = "gocache"
+
+// WithEtcdConfig 设置连接etcd的完整配置，覆盖默认配置和环境变量
+func WithEtcdConfig(cfg clientv3.Config) ServerOption {
+	return func(s *Server) {
+		s.etcdConfig = cfg
+	}
+}
+
+// WithEtcdEndpoints 设置etcd的地址，默认为 localhost:2379 或环境变量 GOCACHE_ETCD_ENDPOINTS
+func WithEtcdEndpoints(endpoints ...string) ServerOption {
+	return func(s *Server) {
+		s.etcdConfig.Endpoints = endpoints
+	}
+}
+
+// WithEtcdAuth 设置连接etcd的用户名和密码，默认读取环境变量 GOCACHE_ETCD_USERNAME、GOCACHE_ETCD_PASSWORD
+func WithEtcdAuth(username, password string) ServerOption {
+	return func(s *Server) {
+		s.etcdConfig.Username = username
+		s.etcdConfig.Password = password
+	}
+}
+
+// WithEtcdTLS 设置连接etcd使用的TLS配置，可以由 registry.LoadEtcdTLS 从文件读取
+func WithEtcdTLS(cfg *tls.Config) ServerOption {
+	return func(s *Server) {
+		s.etcdConfig.TLS = cfg
+	}
+}
+
+// WithEtcdDialTimeout 设置连接etcd的超时时间，默认5秒
+func WithEtcdDialTimeout(d time.Duration) ServerOption {
+	return func(s *Server) {
+		s.etcdConfig.DialTimeout = d
+	}
+}
+
+// WithLeaseTTL 设置注册到etcd使用的租约有效期，默认5秒。节点异常退出后其他节点最多经过ttl才能发现；
+// 网络分区或etcd重启导致租约过期后，节点会以新的租约自动重新注册。
+func WithLeaseTTL(ttl time.Duration) ServerOption {
+	return func(s *Server) {
+		s.leaseTTL = ttl
+	}
+}
+
+// WithNamespace 设置节点在etcd中注册的命名空间，节点注册在 <namespace>/<addr> 下，默认为 gocache 或环境变量 GOCACHE_NAMESPACE。
+// 多个集群共用一个etcd时使用不同的命名空间，节点只会发现和访问同一命名空间中的节点。
+func WithNamespace(ns string) ServerOption {
+	return func(s *Server) {
+		s.namespace = ns
+	}
+}
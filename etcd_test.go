@@ -0,0 +1,46 @@
+package gocache
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestEtcdOptions(t *testing.T) {
+	t.Setenv("GOCACHE_ETCD_ENDPOINTS", "10.0.0.1:2379")
+	t.Setenv(EnvNamespace, "cluster-a")
+
+	svr, err := NewServer("localhost:9201")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(svr.etcdConfig.Endpoints, []string{"10.0.0.1:2379"}) || svr.namespace != "cluster-a" {
+		t.Fatalf("expect config from env, got %v %q", svr.etcdConfig.Endpoints, svr.namespace)
+	}
+
+	svr, err = NewServer("localhost:9201",
+		WithEtcdEndpoints("10.0.0.2:2379"),
+		WithEtcdAuth("cache", "secret"),
+		WithEtcdDialTimeout(time.Second),
+		WithNamespace("cluster-b"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := svr.etcdConfig
+	if !reflect.DeepEqual(cfg.Endpoints, []string{"10.0.0.2:2379"}) || cfg.Username != "cache" || cfg.Password != "secret" || cfg.DialTimeout != time.Second {
+		t.Fatalf("options should override env, got %+v", cfg)
+	}
+	client := svr.newClient("localhost:9202")
+	if client.baseURL != "cluster-b/localhost:9202" || client.etcdConfig.Username != "cache" {
+		t.Fatalf("client should use the namespace and etcd config of the server, got %q %+v", client.baseURL, client.etcdConfig)
+	}
+	if m := client.Metrics(); m.Peer != "localhost:9202" {
+		t.Fatalf("metrics peer = %q", m.Peer)
+	}
+
+	t.Setenv("GOCACHE_ETCD_DIAL_TIMEOUT", "soon")
+	if _, err := NewServer("localhost:9201"); err == nil {
+		t.Fatal("expect NewServer to report an invalid etcd env")
+	}
+}
@@ -0,0 +1,142 @@
+package gocache
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// EventType 缓存事件的类型
+type EventType int
+
+const (
+	EventHit             EventType = iota // 命中本地缓存(主缓存或热点缓存)
+	EventMiss                             // 本地缓存未命中
+	EventLoad                             // 从数据源或远程节点加载成功
+	EventLoadError                        // 加载失败
+	EventEviction                         // 数据被淘汰或删除
+	EventSet                              // 数据被显式写入
+	EventCapacityWarning                  // 预计在告警窗口内用满容量，见 WithCapacityForecast
+	EventDelete                           // 数据被显式删除，见 Group.Delete
+)
+
+var eventTypeNames = [...]string{"hit", "miss", "load", "load_error", "eviction", "set", "capacity_warning", "delete"}
+
+func (t EventType) String() string {
+	if t >= 0 && int(t) < len(eventTypeNames) {
+		return eventTypeNames[t]
+	}
+	return "unknown"
+}
+
+// ParseEventType 根据名字解析事件类型，名字与 EventType.String 的返回值相同
+func ParseEventType(name string) (EventType, bool) {
+	for i, n := range eventTypeNames {
+		if strings.EqualFold(n, name) {
+			return EventType(i), true
+		}
+	}
+	return 0, false
+}
+
+// CacheEvent 缓存事件
+type CacheEvent struct {
+	Type  EventType
+	Group string
+	Key   string
+	Size  int // 数据的字节数，未知时为0
+	Time  time.Time
+}
+
+// EventFilter 订阅事件的过滤条件，Group 为空表示所有缓存组，Types 为空表示所有类型
+type EventFilter struct {
+	Group string
+	Types []EventType
+}
+
+func (f EventFilter) match(e CacheEvent) bool {
+	if f.Group != "" && f.Group != e.Group {
+		return false
+	}
+	if len(f.Types) == 0 {
+		return true
+	}
+	for _, t := range f.Types {
+		if t == e.Type {
+			return true
+		}
+	}
+	return false
+}
+
+// eventSubBufferSize 每个订阅者的事件缓冲大小，订阅者来不及读取时新的事件会被丢弃
+const eventSubBufferSize = 256
+
+// eventBus 将缓存事件分发给订阅者。没有订阅者时发布事件几乎没有开销；
+// 发布不会阻塞缓存的读写，订阅者读取过慢时事件被丢弃并计数。
+type eventBus struct {
+	mu      sync.RWMutex
+	subs    map[*eventSub]struct{}
+	nsubs   int32 // 订阅者数量，用于无锁判断是否需要发布
+	dropped AtomicInt
+}
+
+type eventSub struct {
+	filter EventFilter
+	ch     chan CacheEvent
+}
+
+// events 进程内所有缓存组共享的事件总线
+var events = &eventBus{subs: make(map[*eventSub]struct{})}
+
+// SubscribeEvents 订阅满足过滤条件的缓存事件，返回事件通道和取消订阅的函数。
+// 取消订阅后通道会被关闭。订阅者应当尽快读取，来不及读取的事件会被丢弃，见 DroppedEvents。
+func SubscribeEvents(filter EventFilter) (<-chan CacheEvent, func()) {
+	sub := &eventSub{filter: filter, ch: make(chan CacheEvent, eventSubBufferSize)}
+	events.mu.Lock()
+	events.subs[sub] = struct{}{}
+	atomic.AddInt32(&events.nsubs, 1)
+	events.mu.Unlock()
+
+	var once sync.Once
+	return sub.ch, func() {
+		once.Do(func() {
+			events.mu.Lock()
+			delete(events.subs, sub)
+			atomic.AddInt32(&events.nsubs, -1)
+			close(sub.ch)
+			events.mu.Unlock()
+		})
+	}
+}
+
+// DroppedEvents 返回因订阅者读取过慢而被丢弃的事件数量
+func DroppedEvents() int64 {
+	return events.dropped.Get()
+}
+
+// publish 发布一个事件
+func (b *eventBus) publish(t EventType, group, key string, size int) {
+	if atomic.LoadInt32(&b.nsubs) == 0 {
+		return
+	}
+	e := CacheEvent{Type: t, Group: group, Key: key, Size: size, Time: time.Now()}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for sub := range b.subs {
+		if !sub.filter.match(e) {
+			continue
+		}
+		select {
+		case sub.ch <- e:
+		default:
+			b.dropped.Add(1)
+		}
+	}
+}
+
+// emit 发布缓存组的一个事件
+func (g *Group) emit(t EventType, key string, size int) {
+	events.publish(t, g.name, key, size)
+}
@@ -0,0 +1,53 @@
+package gocache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSubscribeEvents(t *testing.T) {
+	getter := GetterFunc(func(key string) ([]byte, error) { return []byte("vv"), nil })
+	g := NewGroup("events", 5, "lru", getter)
+	NewGroup("events-other", 2<<10, "lru", getter).GetCacheData("x") // 不会发布事件
+
+	ch, cancel := SubscribeEvents(EventFilter{Group: "events", Types: []EventType{EventMiss, EventHit, EventEviction}})
+	defer cancel()
+
+	g.GetCacheData("k1")                               // miss
+	g.GetCacheData("k1")                               // hit
+	g.GetCacheData("k2")                               // miss，k1 被淘汰
+	GetGroup("events-other").GetCacheData("other-key") // 其他缓存组
+
+	want := []EventType{EventMiss, EventHit, EventMiss, EventEviction}
+	for i, typ := range want {
+		select {
+		case e := <-ch:
+			if e.Type != typ || e.Group != "events" {
+				t.Fatalf("event %d: got %v %s/%s, want %v", i, e.Type, e.Group, e.Key, typ)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("event %d (%v) not received", i, typ)
+		}
+	}
+	select {
+	case e := <-ch:
+		t.Fatalf("unexpected event %v %s/%s", e.Type, e.Group, e.Key)
+	default:
+	}
+
+	cancel()
+	if _, ok := <-ch; ok {
+		t.Fatal("channel should be closed after cancel")
+	}
+}
+
+func TestParseEventType(t *testing.T) {
+	for _, typ := range []EventType{EventHit, EventMiss, EventLoad, EventLoadError, EventEviction, EventSet, EventCapacityWarning, EventDelete} {
+		if got, ok := ParseEventType(typ.String()); !ok || got != typ {
+			t.Fatalf("ParseEventType(%q) = %v, %v", typ.String(), got, ok)
+		}
+	}
+	if _, ok := ParseEventType("nope"); ok {
+		t.Fatal("expect unknown event type")
+	}
+}
@@ -0,0 +1,116 @@
+package gocache
+
+import (
+	"runtime"
+	"sync"
+)
+
+const evictBatchSize = 128 // 后台淘汰每批最多淘汰的数据条数，每批之间释放缓存的锁
+
+// watermarks 是 LRUcache 和 LFUcache 的淘汰水位，见 WithEvictionWatermarks。创建缓存组时设置，之后不再修改，
+// nil 表示逐条淘汰到容量
+type watermarks struct {
+	low  float64 // 淘汰到容量的low倍，0表示只淘汰到容量
+	high float64 // 占用超过容量的high倍时唤醒后台淘汰，0表示不在后台淘汰
+
+	once sync.Once
+	kick chan struct{}
+	stop <-chan struct{} // 关闭后后台淘汰的 goroutine 退出，见 Group.Close
+}
+
+// batchEvicter 由 LRUcache 和 LFUcache 实现
+type batchEvicter interface {
+	// evictBatch 淘汰一批数据，返回是否仍然高于低水位
+	evictBatch() bool
+}
+
+// lowWatermark 返回容量为cacheBytes时的低水位(字节)，0表示不限制容量或者没有设置低水位
+func (w *watermarks) lowWatermark(cacheBytes int64) int64 {
+	if w == nil || w.low <= 0 {
+		return 0
+	}
+	return int64(float64(cacheBytes) * w.low)
+}
+
+// target 返回后台淘汰的目标(字节)
+func (w *watermarks) target(cacheBytes int64) int64 {
+	if n := w.lowWatermark(cacheBytes); n > 0 {
+		return n
+	}
+	return cacheBytes
+}
+
+// above 返回占用是否超过了高水位
+func (w *watermarks) above(bytes, cacheBytes int64) bool {
+	return w != nil && w.high > 0 && cacheBytes > 0 && bytes > int64(float64(cacheBytes)*w.high)
+}
+
+// wake 唤醒后台淘汰，第一次调用时启动后台的 goroutine；正在淘汰时什么也不做。
+// 停止之后不再唤醒，写入超出容量时同步淘汰
+func (w *watermarks) wake(e batchEvicter) {
+	select {
+	case <-w.stop:
+		return
+	default:
+	}
+	w.once.Do(func() {
+		w.kick = make(chan struct{}, 1)
+		go w.run(e)
+	})
+	select {
+	case w.kick <- struct{}{}:
+	default:
+	}
+}
+
+func (w *watermarks) run(e batchEvicter) {
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-w.kick:
+		}
+		for e.evictBatch() {
+			select {
+			case <-w.stop:
+				return
+			default:
+			}
+			runtime.Gosched() // 让等待写锁的写入和补记访问的读取先执行
+		}
+	}
+}
+
+// WithEvictionWatermarks 设置主缓存和热点缓存的淘汰水位。默认每次写入超出容量时逐条淘汰到刚好不超过容量，
+// 缓存写满之后几乎每次写入都要在写锁内淘汰数据。
+//
+// low(0到1之间，例如0.9)表示超出容量时一次淘汰到容量的low倍，之后的若干次写入不需要淘汰，把淘汰合并为一批。
+// high(low到1之间，0表示不开启)开启后台淘汰：写入使占用超过容量的high倍时唤醒后台的淘汰，每批淘汰
+// evictBatchSize 条数据后释放锁，直到低于低水位，写入只在后台来不及淘汰、占用超过容量时才同步淘汰，
+// 写入延迟的长尾更平滑，后台淘汰的 goroutine 在 Group.Close 时退出。取值不合法时忽略该选项
+func WithEvictionWatermarks(low, high float64) GroupOption {
+	return func(g *Group) {
+		if low <= 0 || low >= 1 || high != 0 && (high <= low || high > 1) {
+			return
+		}
+		for _, c := range []BaseCache{g.mainCache, g.hotCache} {
+			switch c := c.(type) {
+			case *LRUcache:
+				c.watermarks = &watermarks{low: low, high: high, stop: g.stop}
+			case *LFUcache:
+				c.watermarks = &watermarks{low: low, high: high, stop: g.stop}
+			}
+		}
+	}
+}
+
+// evictionWatermarks 返回缓存的淘汰水位，没有设置时返回nil
+func evictionWatermarks(c BaseCache) *watermarks {
+	switch c := c.(type) {
+	case *LRUcache:
+		return c.watermarks
+	case *LFUcache:
+		return c.watermarks
+	}
+	return nil
+}
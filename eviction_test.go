@@ -0,0 +1,186 @@
+package gocache
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestEvictionWatermarks(t *testing.T) {
+	getter := GetterFunc(func(key string) ([]byte, error) { return []byte(key), nil })
+	for _, strategy := range []string{"lru", "lfu"} {
+		// 超出容量时一次淘汰到低水位
+		g := NewGroup("watermarks-"+strategy, 1000, strategy, getter, WithEvictionWatermarks(0.9, 0))
+		if c := g.Config(); c.EvictLow != 0.9 || c.EvictHigh != 0 {
+			t.Fatalf("%s config %+v", strategy, c)
+		}
+		for i := 0; i < 100; i++ {
+			g.Set(fmt.Sprintf("k%03d", i), []byte("value1"), 0)
+		}
+		if st := g.Stats(); st.Bytes != 1000 || st.Evictions != 0 {
+			t.Fatalf("%s evicted before reaching capacity: %+v", strategy, st)
+		}
+		g.Set("k100", []byte("value1"), 0)
+		if st := g.Stats(); st.Bytes > 900 || st.Evictions != 11 {
+			t.Fatalf("%s after exceeding capacity: bytes %d, evictions %d", strategy, st.Bytes, st.Evictions)
+		}
+		for i := 101; i < 110; i++ {
+			g.Set(fmt.Sprintf("k%03d", i), []byte("value1"), 0)
+		}
+		if st := g.Stats(); st.Evictions != 11 {
+			t.Fatalf("%s evicted %d below capacity", strategy, st.Evictions)
+		}
+
+		// 超过高水位时后台淘汰到低水位，写入不需要淘汰
+		g = NewGroup("watermarks-bg-"+strategy, 1000, strategy, getter, WithEvictionWatermarks(0.5, 0.8))
+		for i := 0; i < 85; i++ {
+			g.Set(fmt.Sprintf("k%03d", i), []byte("value1"), 0)
+		}
+		deadline := time.Now().Add(5 * time.Second)
+		for g.Stats().Bytes > 500 {
+			if time.Now().After(deadline) {
+				t.Fatalf("%s background eviction did not reach the low watermark: %d bytes", strategy, g.Stats().Bytes)
+			}
+			time.Sleep(time.Millisecond)
+		}
+		if _, err := g.GetCacheData("k084"); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := g.mainCache.peek("k084"); !ok {
+			t.Fatalf("%s newest key was evicted", strategy)
+		}
+
+		// 不合法的水位被忽略
+		g = NewGroup("watermarks-bad-"+strategy, 1000, strategy, getter, WithEvictionWatermarks(0.9, 0.5))
+		if c := g.Config(); c.EvictLow != 0 {
+			t.Fatalf("%s invalid watermarks applied: %+v", strategy, c)
+		}
+	}
+}
+
+// busyEvicter 每次淘汰都报告仍然高于低水位，模拟写入速度超过后台淘汰速度
+type busyEvicter struct{ batches AtomicInt }
+
+func (e *busyEvicter) evictBatch() bool {
+	e.batches.Add(1)
+	return true
+}
+
+func TestEvictionStop(t *testing.T) {
+	// 停止后后台淘汰的 goroutine 退出，包括正在连续淘汰时
+	for _, busy := range []bool{false, true} {
+		stop := make(chan struct{})
+		w := &watermarks{low: 0.5, high: 0.8, kick: make(chan struct{}, 1), stop: stop}
+		e := &busyEvicter{}
+		done := make(chan struct{})
+		go func() {
+			w.run(e)
+			close(done)
+		}()
+		if busy {
+			w.kick <- struct{}{}
+			for e.batches.Get() == 0 {
+				time.Sleep(time.Millisecond)
+			}
+		}
+		close(stop)
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("busy=%v: background eviction did not exit after stop", busy)
+		}
+	}
+
+	// Group.Close 停止后台淘汰并把缓存组从全局注册表中移除，之后写入同步淘汰，不再启动后台淘汰
+	getter := GetterFunc(func(key string) ([]byte, error) { return []byte(key), nil })
+	g := NewGroup("watermarks-close", 1000, "lru", getter, WithEvictionWatermarks(0.5, 0.8))
+	w := evictionWatermarks(g.mainCache)
+	g.Close()
+	g.Close()
+	select {
+	case <-w.stop:
+	default:
+		t.Fatal("Close did not stop background eviction")
+	}
+	if GetGroup("watermarks-close") != nil {
+		t.Fatal("closed group is still registered")
+	}
+	for i := 0; i < 200; i++ {
+		g.Set(fmt.Sprintf("k%03d", i), []byte("value1"), 0)
+	}
+	if w.kick != nil {
+		t.Fatal("background eviction started after Close")
+	}
+	if st := g.Stats(); st.Bytes > 1000 {
+		t.Fatalf("closed group exceeded capacity: %d bytes", st.Bytes)
+	}
+
+	// 被同名的缓存组替换时停止旧缓存组的后台淘汰，新的缓存组不受影响
+	old := NewGroup("watermarks-replace", 1000, "lfu", getter, WithEvictionWatermarks(0.5, 0.8))
+	g = NewGroup("watermarks-replace", 1000, "lfu", getter, WithEvictionWatermarks(0.5, 0.8))
+	select {
+	case <-evictionWatermarks(old.mainCache).stop:
+	default:
+		t.Fatal("replaced group still runs background eviction")
+	}
+	if GetGroup("watermarks-replace") != g {
+		t.Fatal("replacement group is not registered")
+	}
+	old.Close()
+	if GetGroup("watermarks-replace") != g {
+		t.Fatal("closing the replaced group unregistered its replacement")
+	}
+}
+
+// BenchmarkCacheAdd 对比缓存写满后持续写入新数据时每次写入的延迟分布：
+// 默认每次写入都在写锁内淘汰一条数据，低水位把淘汰合并为一批，后台淘汰把淘汰移出写入的路径
+func BenchmarkCacheAdd(b *testing.B) {
+	const capacity = 1 << 20
+	for _, bc := range []struct {
+		name      string
+		low, high float64
+	}{
+		{"default", 0, 0},
+		{"batch90", 0.9, 0},
+		{"background90-95", 0.9, 0.95},
+	} {
+		for _, strategy := range []string{"lru", "lfu"} {
+			b.Run(bc.name+"/"+strategy, func(b *testing.B) {
+				var c BaseCache = &LRUcache{cacheBytes: capacity}
+				if strategy == "lfu" {
+					c = &LFUcache{cacheBytes: capacity}
+				}
+				if bc.low > 0 {
+					w := &watermarks{low: bc.low, high: bc.high}
+					switch c := c.(type) {
+					case *LRUcache:
+						c.watermarks = w
+					case *LFUcache:
+						c.watermarks = w
+					}
+				}
+				value := ByteView{b: make([]byte, 64)}
+				for i := 0; i < capacity/64; i++ { // 先写满
+					c.add("warm-"+strconv.Itoa(i), value)
+				}
+				keys := make([]string, b.N)
+				for i := range keys {
+					keys[i] = "key-" + strconv.Itoa(i)
+				}
+				latency := make([]time.Duration, b.N)
+				b.ResetTimer()
+				for i, key := range keys {
+					start := time.Now()
+					c.add(key, value)
+					latency[i] = time.Since(start)
+				}
+				b.StopTimer()
+				sort.Slice(latency, func(i, j int) bool { return latency[i] < latency[j] })
+				b.ReportMetric(float64(latency[len(latency)*99/100]), "p99-ns")
+				b.ReportMetric(float64(latency[len(latency)-1]), "max-ns")
+			})
+		}
+	}
+}
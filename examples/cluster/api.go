@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"expvar"
+	"gocache"
+	"gocache/metrics"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// NewAPI 返回对外的HTTP接口：
+//
+//	GET /api?key=Tom  读取缓存，未命中时由归属节点从数据源加载
+//	GET /healthz      健康检查
+//	GET /hotkeys      最近访问最多的key，参数 n(默认10)、window(例如5m，默认为整个统计窗口)、by=bytes 按字节数排序
+//	GET /peers        本节点和哈希环中其他节点的元数据(权重、可用区、版本等)，svr 为nil时不提供
+//	GET /metrics      Prometheus格式的指标，svr 为nil时不提供
+//	GET /debug/vars   expvar格式的指标，gocache 的统计需要先通过 metrics.Collector.Publish 发布
+func NewAPI(group *gocache.Group, svr *gocache.Server) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api", func(w http.ResponseWriter, r *http.Request) {
+		key := r.URL.Query().Get("key")
+		if key == "" {
+			http.Error(w, "key is required", http.StatusBadRequest)
+			return
+		}
+		view, err := group.GetCacheData(key)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		view.WriteTo(w)
+	})
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+	mux.Handle("/debug/vars", expvar.Handler())
+	mux.HandleFunc("/hotkeys", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		n, window := 10, time.Duration(0)
+		var err error
+		if s := q.Get("n"); s != "" {
+			if n, err = strconv.Atoi(s); err != nil {
+				http.Error(w, "invalid n", http.StatusBadRequest)
+				return
+			}
+		}
+		if s := q.Get("window"); s != "" {
+			if window, err = time.ParseDuration(s); err != nil {
+				http.Error(w, "invalid window", http.StatusBadRequest)
+				return
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(group.TopKeys(n, window, q.Get("by") == "bytes"))
+	})
+	if svr != nil {
+		mux.Handle("/metrics", metrics.NewCollector(svr))
+		mux.HandleFunc("/peers", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(struct {
+				Self  gocache.NodeMetadata            `json:"self"`
+				Peers map[string]gocache.NodeMetadata `json:"peers"`
+			}{svr.Metadata(), svr.PeerMetadata()})
+		})
+	}
+	return mux
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"gocache/config"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// Config 示例节点的配置，优先级从低到高依次为配置文件(-config)、环境变量和命令行参数
+type Config struct {
+	File       *config.Config // 配置文件，没有指定时为nil
+	Addr       string         // 本节点的gRPC地址，也是节点在哈希环上的名字
+	HTTPAddr   string         // 对外提供HTTP API的地址，为空表示不启动
+	OpsAddr    string         // 运维调试端口(pprof、哈希环和缓存组)的地址，为空表示不启动
+	AdminAddr  string         // 管理接口的地址，为空表示不启动
+	AdminToken string         // 访问管理接口的令牌，只从环境变量读取，避免出现在进程列表中
+	Peers      []string       // 集群中的所有节点(包括本节点)
+	Discover   bool           // 从etcd发现节点，此时 Peers 可以为空
+	Static     bool           // 只使用 Peers 中的节点，不依赖etcd
+	DNS        string         // 通过解析该域名发现节点(例如Kubernetes的headless Service)，不依赖etcd
+	Registry   string         // 注册中心：etcd、consul、zookeeper 或 gossip
+	Probe      time.Duration  // 健康检查其他节点的间隔，0表示不检查
+	Drain      time.Duration  // 退出时注销之后继续处理请求的时间
+	Weight     int            // 本节点在哈希环上的权重
+	Zone       string         // 本节点所在的可用区
+	LogLevel   slog.Level     // 输出日志的最低级别
+	SlowLoad   time.Duration  // 数据源或远程读取超过该耗时输出慢加载日志，0表示不输出
+	StatsD     string         // DogStatsD的UDP地址，为空表示不发送
+	StatsDTags []string       // 附加在发送到DogStatsD的所有指标上的标签
+	CacheType  string         // lru 或 lfu
+	CacheBytes int64          // 每个缓存组的最大容量
+	TTL        time.Duration  // 缓存组的默认过期时间
+}
+
+// LoadConfig 解析配置，getenv 一般传入 os.Getenv
+func LoadConfig(args []string, getenv func(string) string) (Config, error) {
+	env := func(key, def string) string {
+		if v := getenv(key); v != "" {
+			return v
+		}
+		return def
+	}
+	// 配置文件中的值作为命令行参数的默认值
+	def := struct {
+		addr, peers, zone, cacheType string
+		weight                       int
+		cacheBytes                   int64
+		ttl                          time.Duration
+	}{addr: "localhost:9999", cacheType: "lru", cacheBytes: 2 << 20}
+	path := configPath(args, getenv)
+	var file *config.Config
+	if path != "" {
+		var err error
+		if file, err = config.Load(path, getenv); err != nil {
+			return Config{}, err
+		}
+		def.addr, def.peers, def.zone, def.weight = file.Advertise, strings.Join(file.Peers, ","), file.Zone, file.Weight
+		if g, ok := file.Group("scores"); ok {
+			def.cacheType, def.cacheBytes, def.ttl = g.CacheType(), int64(g.CacheBytes), time.Duration(g.TTL)
+		}
+	}
+
+	fs := flag.NewFlagSet("cluster", flag.ContinueOnError)
+	fs.String("config", path, "TOML or JSON config file (see package gocache/config), flags and env override it")
+	addr := fs.String("addr", env("GOCACHE_ADDR", def.addr), "gRPC address of this node")
+	httpAddr := fs.String("http", env("GOCACHE_HTTP", ""), "HTTP API address, empty to disable")
+	opsAddr := fs.String("ops", env("GOCACHE_OPS", ""), "ops address serving /debug/pprof, /debug/ring and /debug/groups, empty to disable")
+	adminAddr := fs.String("admin", env("GOCACHE_ADMIN", ""), "admin API address (token from GOCACHE_ADMIN_TOKEN), empty to disable")
+	peers := fs.String("peers", env("GOCACHE_PEERS", def.peers), "comma separated addresses of all nodes, defaults to this node only")
+	discover := fs.Bool("discover", env("GOCACHE_DISCOVER", "") == "true", "discover peers registered in etcd instead of using -peers")
+	static := fs.Bool("static", env("GOCACHE_STATIC", "") == "true", "use -peers only and run without etcd")
+	dns := fs.String("dns", env("GOCACHE_DNS", ""), "discover peers by resolving this headless service name instead of etcd")
+	reg := fs.String("registry", env("GOCACHE_REGISTRY", "etcd"), "service registry: etcd, consul, zookeeper (servers from GOCACHE_ZK_SERVERS) or gossip (seeds from GOCACHE_GOSSIP_SEEDS)")
+	probe := fs.Duration("health-check", 0, "probe peers at this interval and evict them from the ring after 3 failures, 0 to disable")
+	drainWindow := fs.Duration("drain-window", 0, "keep serving for this long after deregistering on shutdown")
+	weight := fs.Int("weight", def.weight, "weight of this node on the hash ring, e.g. 2 for a node with twice the memory")
+	zone := fs.String("zone", env("GOCACHE_ZONE", def.zone), "availability zone of this node, replicas in the same zone are preferred")
+	cacheType := fs.String("cache-type", env("GOCACHE_CACHE_TYPE", def.cacheType), "cache type: lru or lfu")
+	cacheBytes := fs.Int64("cache-bytes", def.cacheBytes, "max bytes of the cache")
+	ttl := fs.Duration("ttl", def.ttl, "default ttl of cached values, 0 for no expiration")
+	slowLoad := fs.Duration("slow-load", 0, "log getter calls and peer reads slower than this, 0 to disable")
+	statsd := fs.String("statsd", env("GOCACHE_STATSD", ""), "send metrics to this DogStatsD address every 10s, empty to disable")
+	statsdTags := fs.String("statsd-tags", env("GOCACHE_STATSD_TAGS", ""), "comma separated tags added to all DogStatsD metrics, e.g. env:prod")
+	logLevel := fs.String("log-level", env("GOCACHE_LOG_LEVEL", "info"), "minimum log level: debug, info, warn or error")
+	if err := fs.Parse(args); err != nil {
+		return Config{}, err
+	}
+
+	cfg := Config{
+		File:       file,
+		Addr:       *addr,
+		HTTPAddr:   *httpAddr,
+		OpsAddr:    *opsAddr,
+		AdminAddr:  *adminAddr,
+		AdminToken: getenv("GOCACHE_ADMIN_TOKEN"),
+		Discover:   *discover,
+		Static:     *static,
+		DNS:        *dns,
+		Registry:   *reg,
+		Probe:      *probe,
+		Drain:      *drainWindow,
+		Weight:     *weight,
+		Zone:       *zone,
+		CacheType:  *cacheType,
+		CacheBytes: *cacheBytes,
+		TTL:        *ttl,
+		SlowLoad:   *slowLoad,
+		StatsD:     *statsd,
+	}
+	for _, t := range strings.Split(*statsdTags, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			cfg.StatsDTags = append(cfg.StatsDTags, t)
+		}
+	}
+	for _, p := range strings.Split(*peers, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			cfg.Peers = append(cfg.Peers, p)
+		}
+	}
+	if len(cfg.Peers) == 0 && !cfg.Discover && cfg.DNS == "" {
+		cfg.Peers = []string{cfg.Addr}
+	}
+	if n := btoi(cfg.Static) + btoi(cfg.Discover) + btoi(cfg.DNS != ""); n > 1 {
+		return Config{}, fmt.Errorf("-static, -discover and -dns are mutually exclusive")
+	}
+	if cfg.AdminAddr != "" && cfg.AdminToken == "" {
+		return Config{}, fmt.Errorf("-admin requires GOCACHE_ADMIN_TOKEN")
+	}
+	if cfg.Registry != "etcd" && cfg.Registry != "consul" && cfg.Registry != "zookeeper" && cfg.Registry != "gossip" {
+		return Config{}, fmt.Errorf("unknown registry %q", cfg.Registry)
+	}
+	if err := cfg.LogLevel.UnmarshalText([]byte(*logLevel)); err != nil {
+		return Config{}, fmt.Errorf("unknown log level %q", *logLevel)
+	}
+	if cfg.CacheType != "lru" && cfg.CacheType != "lfu" {
+		return Config{}, fmt.Errorf("unknown cache type %q", cfg.CacheType)
+	}
+	if !strings.Contains(cfg.Addr, ":") {
+		return Config{}, fmt.Errorf("addr %q must be host:port", cfg.Addr)
+	}
+	return cfg, nil
+}
+
+// configPath 返回 -config 参数或环境变量 GOCACHE_CONFIG 指定的配置文件，需要在定义其他参数之前读取
+func configPath(args []string, getenv func(string) string) string {
+	path := getenv(config.EnvConfig)
+	for i := 0; i < len(args); i++ {
+		if args[i] == "--" {
+			break
+		}
+		name, value, hasValue := strings.Cut(strings.TrimLeft(args[i], "-"), "=")
+		if !strings.HasPrefix(args[i], "-") || name != "config" {
+			continue
+		}
+		if !hasValue && i+1 < len(args) {
+			value = args[i+1]
+		}
+		path = value
+	}
+	return path
+}
+
+func btoi(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"gocache"
+	"gocache/metrics"
+	"gocache/registry"
+	"log"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+/*
+一个完整的gocache节点示例：读取配置、创建带选项的缓存组、启动gRPC节点并设置集群节点、
+对外提供HTTP API，收到 SIGINT/SIGTERM 后优雅退出。
+
+启动三个节点(需要本地的etcd)：
+
+	go run ./examples/cluster -addr localhost:8001 -http :9001 -peers localhost:8001,localhost:8002,localhost:8003
+	go run ./examples/cluster -addr localhost:8002 -peers localhost:8001,localhost:8002,localhost:8003
+	go run ./examples/cluster -addr localhost:8003 -peers localhost:8001,localhost:8002,localhost:8003
+
+然后访问 http://localhost:9001/api?key=Tom 。也可以用配置文件声明节点，见 node.toml：
+
+	go run ./examples/cluster -config examples/cluster/node.toml
+*/
+
+// db 是伪造的数据源
+var db = map[string]string{
+	"Tom":  "630",
+	"Jack": "589",
+	"Sam":  "567",
+}
+
+// shutdownTimeout 优雅退出时等待进行中的HTTP请求完成的最长时间
+const shutdownTimeout = 5 * time.Second
+
+func main() {
+	cfg, err := LoadConfig(os.Args[1:], os.Getenv)
+	if err != nil {
+		log.Fatal(err)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := run(ctx, cfg); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// newGroup 创建示例的缓存组
+func newGroup(cfg Config, logger gocache.Logger) *gocache.Group {
+	opts := []gocache.GroupOption{
+		gocache.WithDefaultTTL(cfg.TTL),
+		gocache.WithErrorCacheTTL(time.Second),          // 数据源出错时短暂缓存错误，保护数据源
+		gocache.WithLoadHoldTime(50 * time.Millisecond), // 吸收加载完成后紧接着到达的突发请求
+		gocache.WithGroupLogger(logger),
+		gocache.WithSlowLog(cfg.SlowLoad, 1),
+		gocache.WithKeyHeat(1024, 10*time.Minute), // 最近10分钟的热点key，见 /hotkeys
+	}
+	if cfg.File != nil {
+		if g, ok := cfg.File.Group("scores"); ok { // 配置文件中的选项覆盖上面的默认值，容量和过期时间已经在 cfg 中
+			opts = append(opts, g.Options()...)
+		}
+	}
+	return gocache.NewGroup("scores", cfg.CacheBytes, cfg.CacheType, gocache.GetterFunc(
+		func(key string) ([]byte, error) {
+			log.Println("[SlowDB] search key", key)
+			if v, ok := db[key]; ok {
+				return []byte(v), nil
+			}
+			return nil, fmt.Errorf("%s not exist", key)
+		}), opts...)
+}
+
+// run 启动节点，直到ctx被取消后优雅退出
+func run(ctx context.Context, cfg Config) error {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: cfg.LogLevel}))
+	group := newGroup(cfg, logger)
+
+	opts := []gocache.ServerOption{gocache.WithLogger(logger)}
+	if cfg.File != nil { // 放在前面，命令行参数对应的选项可以覆盖
+		fileOpts, err := cfg.File.ServerOptions()
+		if err != nil {
+			return err
+		}
+		opts = append(fileOpts, opts...)
+	}
+	switch {
+	case cfg.Discover:
+		opts = append(opts, gocache.WithDiscovery())
+	case cfg.Static:
+		opts = append(opts, gocache.WithStaticPeers(cfg.Peers...))
+	case cfg.DNS != "":
+		_, port, _ := net.SplitHostPort(cfg.Addr)
+		opts = append(opts, gocache.WithDNSDiscovery(cfg.DNS, port, 0))
+	}
+	if cfg.OpsAddr != "" {
+		opts = append(opts, gocache.WithOpsListener(cfg.OpsAddr))
+	}
+	if cfg.AdminAddr != "" {
+		opts = append(opts, gocache.WithAdminListener(cfg.AdminAddr, cfg.AdminToken))
+	}
+	if cfg.Weight > 0 {
+		opts = append(opts, gocache.WithWeight(cfg.Weight))
+	}
+	if cfg.Zone != "" {
+		opts = append(opts, gocache.WithZone(cfg.Zone))
+	}
+	if cfg.Drain > 0 {
+		opts = append(opts, gocache.WithDrainWindow(cfg.Drain))
+	}
+	if cfg.Probe > 0 {
+		opts = append(opts, gocache.WithPeerHealthCheck(cfg.Probe, 3))
+	}
+	if cfg.Registry != "etcd" {
+		reg, err := registry.New(cfg.Registry)
+		if err != nil {
+			return err
+		}
+		switch r := reg.(type) {
+		case *registry.ConsulRegistry:
+			r.Logger = logger
+		case *registry.GossipRegistry:
+			r.Logger = logger
+		case *registry.ZooKeeperRegistry:
+			r.Logger = logger
+		}
+		opts = append(opts, gocache.WithRegistry(reg))
+	}
+	svr, err := gocache.NewServer(cfg.Addr, opts...)
+	if err != nil {
+		return err
+	}
+	if len(cfg.Peers) > 0 && !cfg.Static && cfg.DNS == "" {
+		svr.Set(cfg.Peers...)
+	}
+	group.RegisterPeers(svr)
+
+	errc := make(chan error, 2)
+	go func() {
+		// Start 会一直阻塞，直到服务停止或出错
+		if err := svr.Start(); err != nil {
+			errc <- fmt.Errorf("gocache server: %v", err)
+		}
+	}()
+	go func() {
+		for err := range svr.Err() { // 后台错误(例如etcd暂时不可用)只打印日志，注册会自动重试
+			log.Println("gocache server error:", err)
+		}
+	}()
+
+	if cfg.StatsD != "" {
+		sink := metrics.NewStatsD(cfg.StatsD, svr)
+		sink.DogStatsD, sink.Tags = true, cfg.StatsDTags
+		go sink.Run(ctx)
+	}
+
+	var httpServer *http.Server
+	if cfg.HTTPAddr != "" {
+		metrics.NewCollector(svr).Publish("") // 通过 /debug/vars 提供
+		httpServer = &http.Server{Addr: cfg.HTTPAddr, Handler: NewAPI(group, svr)}
+		go func() {
+			if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				errc <- fmt.Errorf("http server: %v", err)
+			}
+		}()
+		log.Println("http api is running at", cfg.HTTPAddr)
+	}
+	log.Println("gocache is running at", cfg.Addr)
+
+	select {
+	case <-ctx.Done():
+		log.Println("shutting down")
+	case err = <-errc:
+	}
+
+	// 先停止接收新的HTTP请求并等待进行中的请求完成，再从etcd注销、停止gRPC服务
+	if httpServer != nil {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if e := httpServer.Shutdown(shutdownCtx); e != nil && err == nil {
+			err = e
+		}
+	}
+	svr.Stop()
+	return err
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"gocache"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLoadConfig(t *testing.T) {
+	env := map[string]string{"GOCACHE_ADDR": "10.0.0.1:8001", "GOCACHE_PEERS": "10.0.0.1:8001, 10.0.0.2:8001"}
+	cfg, err := LoadConfig([]string{"-ttl", "1m"}, func(k string) string { return env[k] })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Addr != "10.0.0.1:8001" || cfg.TTL != time.Minute ||
+		!reflect.DeepEqual(cfg.Peers, []string{"10.0.0.1:8001", "10.0.0.2:8001"}) {
+		t.Fatalf("unexpected config %+v", cfg)
+	}
+
+	cfg, err = LoadConfig([]string{"-addr", "localhost:7000"}, func(string) string { return "" })
+	if err != nil || !reflect.DeepEqual(cfg.Peers, []string{"localhost:7000"}) {
+		t.Fatalf("peers should default to this node, got %+v %v", cfg, err)
+	}
+	cfg, err = LoadConfig([]string{"-discover"}, func(string) string { return "" })
+	if err != nil || !cfg.Discover || len(cfg.Peers) != 0 {
+		t.Fatalf("discover config: %+v %v", cfg, err)
+	}
+	cfg, err = LoadConfig([]string{"-static", "-peers", "a:1,b:1"}, func(string) string { return "" })
+	if err != nil || !cfg.Static || len(cfg.Peers) != 2 {
+		t.Fatalf("static config: %+v %v", cfg, err)
+	}
+	if _, err := LoadConfig([]string{"-static", "-discover"}, func(string) string { return "" }); err == nil {
+		t.Fatal("expect -static and -discover to be rejected together")
+	}
+	env = map[string]string{"GOCACHE_DNS": "gocache.default.svc.cluster.local"}
+	cfg, err = LoadConfig(nil, func(k string) string { return env[k] })
+	if err != nil || cfg.DNS != "gocache.default.svc.cluster.local" || len(cfg.Peers) != 0 {
+		t.Fatalf("dns config: %+v %v", cfg, err)
+	}
+	if cfg, err := LoadConfig([]string{"-registry", "consul"}, func(string) string { return "" }); err != nil || cfg.Registry != "consul" {
+		t.Fatalf("registry config: %+v %v", cfg, err)
+	}
+	if cfg, err := LoadConfig([]string{"-registry", "zookeeper"}, func(string) string { return "" }); err != nil || cfg.Registry != "zookeeper" {
+		t.Fatalf("registry config: %+v %v", cfg, err)
+	}
+	if _, err := LoadConfig([]string{"-registry", "mdns"}, func(string) string { return "" }); err == nil {
+		t.Fatal("expect an error for an unknown registry")
+	}
+	if _, err := LoadConfig([]string{"-cache-type", "fifo"}, func(string) string { return "" }); err == nil {
+		t.Fatal("expect error for unknown cache type")
+	}
+	if cfg, err := LoadConfig([]string{"-log-level", "debug"}, func(string) string { return "" }); err != nil || cfg.LogLevel != slog.LevelDebug {
+		t.Fatalf("log level config: %+v %v", cfg, err)
+	}
+	if _, err := LoadConfig([]string{"-log-level", "verbose"}, func(string) string { return "" }); err == nil {
+		t.Fatal("expect error for unknown log level")
+	}
+	if _, err := LoadConfig([]string{"-admin", ":9090"}, func(string) string { return "" }); err == nil {
+		t.Fatal("expect -admin without a token to be rejected")
+	}
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	env := map[string]string{"GOCACHE_GROUP_SCORES_TTL": "1m"}
+	cfg, err := LoadConfig([]string{"-config", "node.toml", "-cache-bytes", "4096"}, func(k string) string { return env[k] })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.File == nil || cfg.Addr != "localhost:8001" || len(cfg.Peers) != 3 || cfg.CacheBytes != 4096 || cfg.TTL != time.Minute {
+		t.Fatalf("unexpected config %+v", cfg)
+	}
+	env = map[string]string{"GOCACHE_CONFIG": "node.toml", "GOCACHE_ADDR": "localhost:8002"}
+	if cfg, err := LoadConfig(nil, func(k string) string { return env[k] }); err != nil || cfg.Addr != "localhost:8002" || cfg.CacheBytes != 2<<20 {
+		t.Fatalf("config from env: %+v %v", cfg, err)
+	}
+	if _, err := LoadConfig([]string{"-config=missing.toml"}, func(string) string { return "" }); err == nil {
+		t.Fatal("expect error for a missing config file")
+	}
+}
+
+func TestAPI(t *testing.T) {
+	cfg, _ := LoadConfig(nil, func(string) string { return "" })
+	svr, err := gocache.NewServer(cfg.Addr, gocache.WithZone("a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	api := NewAPI(newGroup(cfg, nil), svr)
+
+	cases := []struct {
+		url  string
+		code int
+		body string
+	}{
+		{"/api?key=Tom", http.StatusOK, "630"},
+		{"/api?key=Nobody", http.StatusNotFound, ""},
+		{"/api", http.StatusBadRequest, ""},
+		{"/healthz", http.StatusOK, "ok"},
+		{"/peers", http.StatusOK, ""},
+		{"/metrics", http.StatusOK, ""},
+		{"/debug/vars", http.StatusOK, ""},
+		{"/hotkeys?n=1&window=5m&by=bytes", http.StatusOK, `[{"key":"Tom","count":1,"bytes":3,"error":0}]` + "\n"},
+		{"/hotkeys?window=soon", http.StatusBadRequest, ""},
+	}
+	for _, c := range cases {
+		rec := httptest.NewRecorder()
+		api.ServeHTTP(rec, httptest.NewRequest("GET", c.url, nil))
+		if rec.Code != c.code || (c.body != "" && rec.Body.String() != c.body) {
+			t.Fatalf("GET %s = %d %q", c.url, rec.Code, rec.Body.String())
+		}
+	}
+}
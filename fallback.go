@@ -0,0 +1,67 @@
+package gocache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// FallbackStep 从归属节点读取失败后依次尝试的处理方式，见 WithFallback
+type FallbackStep int
+
+const (
+	FallbackReplica FallbackStep = iota // 从哈希环上的下一个副本节点读取，需要注册的 PeerPicker 实现 PeersPicker
+	FallbackLocal                       // 从本地数据源加载，数据会进入本节点的主缓存，即使本节点不是归属节点
+)
+
+func (s FallbackStep) String() string {
+	switch s {
+	case FallbackReplica:
+		return "replica"
+	case FallbackLocal:
+		return "local"
+	default:
+		return "unknown"
+	}
+}
+
+// defaultFallback 默认的回退顺序：直接从本地数据源加载
+var defaultFallback = []FallbackStep{FallbackLocal}
+
+// WithFallback 设置从归属节点读取失败(不包括key不存在)后依次尝试的处理方式，全部失败或者没有设置任何方式时返回错误。
+// 默认为 FallbackLocal；WithFallback(FallbackReplica, FallbackLocal) 先尝试下一个副本节点再从本地加载；
+// WithFallback() 直接返回错误，本节点的主缓存中不会出现不归属本节点的数据。
+func WithFallback(steps ...FallbackStep) GroupOption {
+	return func(g *Group) {
+		g.fallback = append([]FallbackStep{}, steps...) // 不传参数时也与默认值区分
+	}
+}
+
+// fallbackFromPeer 归属节点owner读取失败(错误为peerErr)后按回退顺序处理。
+// 返回 local 为true时由调用方从本地数据源加载，否则返回副本节点的结果或者错误。
+func (g *Group) fallbackFromPeer(ctx context.Context, owner PeerGetter, key string, peerErr error) (value ByteView, info GetInfo, local bool, err error) {
+	steps := g.fallback
+	if steps == nil {
+		steps = defaultFallback
+	}
+	for _, step := range steps {
+		switch step {
+		case FallbackReplica:
+			replica := g.nextReplica(key, owner)
+			if replica == nil {
+				continue
+			}
+			value, info, err := g.getFromPeer(ctx, replica, key)
+			if err == nil || errors.Is(err, ErrNotFound) {
+				g.counters.fallbackReplica.Add(1)
+				return value, info, false, err
+			}
+			g.logger.Warn("fallback to replica failed", "group", g.name, "key", key, "error", err)
+		case FallbackLocal:
+			g.counters.fallbackLocal.Add(1)
+			return ByteView{}, GetInfo{}, true, nil
+		}
+	}
+	g.counters.fallbackErrors.Add(1)
+	return ByteView{}, GetInfo{}, false, fmt.Errorf("gocache: get %s/%s from owner: %w", g.name, key, peerErr)
+}
@@ -0,0 +1,62 @@
+package gocache
+
+import (
+	"errors"
+	"testing"
+
+	pb "gocache/gocachepb"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// downPeer 总是返回节点不可用
+type downPeer struct{}
+
+func (downPeer) Get(in *pb.Request, out *pb.Response) error {
+	return status.Error(codes.Unavailable, "connection refused")
+}
+
+func TestFallback(t *testing.T) {
+	newGroup := func(name string, steps ...FallbackStep) (*Group, *int) {
+		localLoads := 0
+		g := NewGroup(name, 2<<10, "lru", GetterFunc(func(key string) ([]byte, error) {
+			localLoads++
+			return []byte("local:" + key), nil
+		}), WithFallback(steps...))
+		g.RegisterPeers(replicaPicker{[]PeerGetter{downPeer{}, &delayedPeer{name: "replica"}}})
+		return g, &localLoads
+	}
+
+	// 先尝试副本节点
+	g, loads := newGroup("fallback-replica", FallbackReplica, FallbackLocal)
+	if v, err := g.GetCacheData("k"); err != nil || v.String() != "replica:k" || *loads != 0 {
+		t.Fatalf("replica fallback = %q, %v (local loads %d)", v.String(), err, *loads)
+	}
+	if st := g.Stats(); st.FallbackReplica != 1 || st.FallbackLocal != 0 {
+		t.Fatalf("stats = %+v", st)
+	}
+
+	// 没有可用的副本节点时本地加载
+	g, loads = newGroup("fallback-local", FallbackReplica, FallbackLocal)
+	g.peers = replicaPicker{[]PeerGetter{downPeer{}}}
+	if v, err := g.GetCacheData("k"); err != nil || v.String() != "local:k" || *loads != 1 {
+		t.Fatalf("local fallback = %q, %v (local loads %d)", v.String(), err, *loads)
+	}
+	if st := g.Stats(); st.FallbackLocal != 1 {
+		t.Fatalf("fallback_local = %d, want 1", st.FallbackLocal)
+	}
+
+	// 直接返回错误，不加载不归属本节点的数据
+	g, loads = newGroup("fallback-error")
+	_, err := g.GetCacheData("k")
+	if status.Code(errors.Unwrap(err)) != codes.Unavailable || *loads != 0 {
+		t.Fatalf("error fallback = %v (local loads %d)", err, *loads)
+	}
+	if _, ok := g.mainCache.get("k"); ok {
+		t.Fatal("failed fetch populated the main cache")
+	}
+	if st := g.Stats(); st.FallbackErrors != 1 {
+		t.Fatalf("fallback_errors = %d, want 1", st.FallbackErrors)
+	}
+}
@@ -0,0 +1,166 @@
+package gocache
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// maxUsageSamples 每个缓存组最多保留的用量采样数量，预测基于这些采样的线性趋势
+const maxUsageSamples = 60
+
+// usageSample 一次用量采样
+type usageSample struct {
+	t     time.Time
+	bytes int64
+}
+
+// capacityForecaster 定期采样缓存组的用量，按线性趋势预测何时用满容量。
+// 预计在horizon内用满时发出告警(计数并发布 EventCapacityWarning 事件)，便于运维在淘汰加剧、命中率下降之前扩容。
+type capacityForecaster struct {
+	mu       sync.Mutex
+	interval time.Duration
+	horizon  time.Duration
+	samples  []usageSample
+	warning  bool      // 当前是否处于告警状态，避免每次采样都重复告警
+	warnings AtomicInt // 告警次数
+}
+
+// Forecast 缓存组容量的预测结果
+type Forecast struct {
+	Group       string
+	Bytes       int64         // 当前用量
+	Capacity    int64         // 最大容量，0表示不限制
+	Growth      float64       // 用量的增长速度(字节/秒)，基于最近的采样
+	TimeToFull  time.Duration // 预计多久后用满，不会用满(没有增长或不限制容量)时为0
+	Warning     bool          // 预计在告警窗口内用满
+	Warnings    int64         // 累计告警次数
+	SampleCount int           // 参与预测的采样数量
+}
+
+// WithCapacityForecast 每隔interval采样一次主缓存的用量，预计在horizon内用满时告警
+func WithCapacityForecast(interval, horizon time.Duration) GroupOption {
+	return func(g *Group) {
+		if interval <= 0 || horizon <= 0 {
+			return
+		}
+		g.forecast = &capacityForecaster{interval: interval, horizon: horizon}
+		go func() {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			for {
+				select {
+				case now := <-ticker.C:
+					g.sampleUsage(now)
+				case <-g.stop:
+					return
+				}
+			}
+		}()
+	}
+}
+
+// sampleUsage 记录一次用量采样，并在需要时发出告警
+func (g *Group) sampleUsage(now time.Time) {
+	f := g.forecast
+	f.mu.Lock()
+	f.samples = append(f.samples, usageSample{t: now, bytes: g.mainCache.bytes()})
+	if len(f.samples) > maxUsageSamples {
+		f.samples = f.samples[len(f.samples)-maxUsageSamples:]
+	}
+	fc := g.forecastLocked()
+	raise := fc.Warning && !f.warning
+	f.warning = fc.Warning
+	if raise {
+		f.warnings.Add(1)
+	}
+	f.mu.Unlock()
+
+	if raise {
+		g.logger.Warn("group projected to be full", "group", g.name, "in", fc.TimeToFull, "bytes", fc.Bytes, "capacity", fc.Capacity)
+		g.emit(EventCapacityWarning, "", int(fc.Bytes))
+	}
+}
+
+// forecastLocked 根据采样计算预测结果，调用时需持有 g.forecast.mu
+func (g *Group) forecastLocked() Forecast {
+	f := g.forecast
+	fc := Forecast{
+		Group:       g.name,
+		Capacity:    g.mainCache.capacity(),
+		Warnings:    f.warnings.Get(),
+		SampleCount: len(f.samples),
+	}
+	if len(f.samples) == 0 {
+		fc.Bytes = g.mainCache.bytes()
+		return fc
+	}
+	fc.Bytes = f.samples[len(f.samples)-1].bytes
+	fc.Growth = usageSlope(f.samples)
+	if fc.Capacity > 0 && fc.Growth > 0 {
+		left := float64(fc.Capacity - fc.Bytes)
+		if left < 0 {
+			left = 0
+		}
+		fc.TimeToFull = time.Duration(left / fc.Growth * float64(time.Second))
+		fc.Warning = fc.TimeToFull <= f.horizon
+	}
+	return fc
+}
+
+// usageSlope 用最小二乘法计算用量随时间变化的斜率(字节/秒)
+func usageSlope(samples []usageSample) float64 {
+	if len(samples) < 2 {
+		return 0
+	}
+	t0 := samples[0].t
+	var n, sumX, sumY, sumXY, sumXX float64
+	for _, s := range samples {
+		x := s.t.Sub(t0).Seconds()
+		y := float64(s.bytes)
+		n++
+		sumX += x
+		sumY += y
+		sumXY += x * y
+		sumXX += x * x
+	}
+	d := n*sumXX - sumX*sumX
+	if d == 0 {
+		return 0
+	}
+	return (n*sumXY - sumX*sumY) / d
+}
+
+// CapacityForecast 返回缓存组的容量预测，没有开启 WithCapacityForecast 时只包含当前用量
+func (g *Group) CapacityForecast() Forecast {
+	if g.forecast == nil {
+		return Forecast{Group: g.name, Bytes: g.mainCache.bytes(), Capacity: g.mainCache.capacity()}
+	}
+	g.forecast.mu.Lock()
+	defer g.forecast.mu.Unlock()
+	return g.forecastLocked()
+}
+
+// CapacityForecastHandler 以JSON返回所有缓存组的容量预测，可以挂载到运维用的HTTP服务上
+func CapacityForecastHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.RLock()
+		list := make([]*Group, 0, len(groups))
+		for _, g := range groups {
+			list = append(list, g)
+		}
+		mu.RUnlock()
+		sort.Slice(list, func(i, j int) bool { return list[i].name < list[j].name })
+
+		out := make([]Forecast, 0, len(list))
+		for _, g := range list {
+			if g.mainCache != nil {
+				out = append(out, g.CapacityForecast())
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(out)
+	})
+}
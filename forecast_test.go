@@ -0,0 +1,52 @@
+package gocache
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCapacityForecast(t *testing.T) {
+	g := NewGroup("forecast", 1000, "lru", GetterFunc(
+		func(key string) ([]byte, error) { return []byte(key), nil }))
+	// 使用很长的采样间隔，由测试手动采样
+	WithCapacityForecast(time.Hour, 5500*time.Millisecond)(g)
+	ch, cancel := SubscribeEvents(EventFilter{Group: "forecast", Types: []EventType{EventCapacityWarning}})
+	defer cancel()
+
+	start := time.Now()
+	for i := 0; i < 5; i++ { // 每秒增长100字节
+		g.Set(strings.Repeat("k", i+1), make([]byte, 100-(i+1)), 0)
+		g.sampleUsage(start.Add(time.Duration(i) * time.Second))
+	}
+	fc := g.CapacityForecast()
+	if fc.Bytes != 500 || fc.Growth < 99 || fc.Growth > 101 {
+		t.Fatalf("unexpected forecast %+v", fc)
+	}
+	if fc.TimeToFull < 4*time.Second || fc.TimeToFull > 6*time.Second || !fc.Warning || fc.Warnings != 1 {
+		t.Fatalf("expect a warning about ~5s to full, got %+v", fc)
+	}
+	select {
+	case e := <-ch:
+		if e.Size != 500 {
+			t.Fatalf("unexpected event %+v", e)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("capacity warning event not received")
+	}
+
+	// 告警状态持续期间不会重复告警
+	g.sampleUsage(start.Add(5 * time.Second))
+	if fc := g.CapacityForecast(); fc.Warnings != 1 {
+		t.Fatalf("warning should not repeat, got %d", fc.Warnings)
+	}
+
+	rec := httptest.NewRecorder()
+	CapacityForecastHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/forecast", nil))
+	var out []Forecast
+	if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil || len(out) == 0 {
+		t.Fatalf("bad forecast response %q: %v", rec.Body.String(), err)
+	}
+}
@@ -1,11 +1,17 @@
 package gocache
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	pb "gocache/gocachepb"
+	"gocache/lfu"
+	"gocache/logging"
+	"gocache/replay"
 	"gocache/singleflight"
-	"log"
+	"gocache/topk"
 	"math"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -21,6 +27,10 @@ var (
 	groups             = make(map[string]*Group) //map,根据键缓存组的名字，获取对应的缓存组
 )
 
+// ErrNotFound 数据源返回它(或包装了它的错误)表示key不存在。
+// 远程节点以v2协议明确告知key不存在时，请求方也返回该错误，并且不会再从本地数据源加载。
+var ErrNotFound = errors.New("gocache: key not found")
+
 // Getter 接口
 type Getter interface {
 	Get(key string) ([]byte, error)
@@ -34,6 +44,25 @@ func (f GetterFunc) Get(key string) ([]byte, error) {
 	return f(key)
 }
 
+// TTLGetter 是可选接口，数据源实现它即可为返回的数据指定过期时间
+type TTLGetter interface {
+	GetWithTTL(key string) ([]byte, time.Duration, error)
+}
+
+// TTLGetterFunc 函数类型，同时实现了 Getter 和 TTLGetter 接口
+type TTLGetterFunc func(key string) ([]byte, time.Duration, error)
+
+// Get TTLGetterFunc 实现了Getter 接口，忽略过期时间
+func (f TTLGetterFunc) Get(key string) ([]byte, error) {
+	b, _, err := f(key)
+	return b, err
+}
+
+// GetWithTTL TTLGetterFunc 实现了TTLGetter 接口
+func (f TTLGetterFunc) GetWithTTL(key string) ([]byte, time.Duration, error) {
+	return f(key)
+}
+
 // KeyStats Key的统计信息
 type KeyStats struct {
 	firstGetTime time.Time //第一次请求的时间
@@ -49,6 +78,104 @@ type Group struct {
 	peers     PeerPicker           //实现了 PeerPicker 接口的对象，用于根据键选择相应的缓存节点
 	loader    *singleflight.Group  //确保相同的请求只被执行一次
 	keys      map[string]*KeyStats //根据键key获取对应key的统计信息
+
+	defaultTTL AtomicInt           // 默认过期时间(纳秒)，数据源和调用者都没有指定过期时间时使用，0表示永不过期，见 SetDefaultTTL
+	loadErrs   *errorCache         // 短暂缓存数据源的加载错误，nil表示不缓存
+	limiter    *LoadLimiter        // 限制数据源加载的并发数，nil表示不限制
+	loadWeight int64               // 每次加载占用 limiter 的容量
+	leases     *leaseTable         // 未命中时发放的租约，nil表示不使用租约
+	transforms []Transform         // 写入缓存前后的变换链，见 WithTransforms
+	pool       *loadPool           // 执行数据源加载的工作池，nil表示在调用者的goroutine中执行
+	forecast   *capacityForecaster // 容量预测，nil表示不预测
+
+	budget         *MemoryBudget  // 与其他缓存组共享的内存预算，nil表示不限制，见 WithMemoryBudget
+	budgetPriority int            // 在内存预算中的优先级
+	slabs          *slabAllocator // 小数据的slab分配器，nil表示不使用，见 WithSlabAllocator
+
+	compression string // 节点之间传输数据使用的压缩算法，空字符串表示不压缩，见 WithCompression
+	compressMin int    // 达到该大小的数据才压缩
+
+	counters groupCounters // 命中、未命中和加载的累计计数，见 Stats
+	logger   Logger        // 见 WithGroupLogger
+	slow     *slowLog      // 慢加载日志，nil表示不记录，见 WithSlowLog
+	heat     *topk.Window  // 热点key统计，nil表示不统计，见 WithKeyHeat
+
+	hotThreshold AtomicInt // 每分钟从远程节点读取达到该次数的key放入热点缓存，见 WithHotKeyThreshold
+
+	observers []Observer // 观察每一次读取，见 WithObservers
+
+	peerTimeout time.Duration  // 调用方没有指定截止时间时从远程节点读取的超时时间，0表示使用客户端的超时时间
+	hedgeDelay  time.Duration  // 归属节点超过该时间没有响应时向副本节点发送对冲请求，0表示不对冲，见 WithHedging
+	fallback    []FallbackStep // 从归属节点读取失败后依次尝试的处理方式，nil表示默认的本地加载，见 WithFallback
+
+	stop     chan struct{} // 关闭后后台的 goroutine(后台淘汰、容量预测)退出，见 Close
+	stopOnce sync.Once
+}
+
+// GroupOption 用于配置 Group 的可选参数
+type GroupOption func(*Group)
+
+// WithDefaultTTL 设置缓存组的默认过期时间
+func WithDefaultTTL(ttl time.Duration) GroupOption {
+	return func(g *Group) {
+		g.defaultTTL.Set(int64(ttl))
+	}
+}
+
+// WithHotKeyThreshold 设置热点key的阈值：一分钟内从远程节点读取同一个key达到n次后放入本节点的热点缓存，
+// 归属节点上命中次数达到n的key也会在响应中标记为热点，默认10。运行时可以用 SetHotKeyThreshold 修改
+func WithHotKeyThreshold(n int) GroupOption {
+	return func(g *Group) {
+		g.SetHotKeyThreshold(n)
+	}
+}
+
+// WithErrorCacheTTL 开启加载错误缓存：数据源返回错误后，同一个key在ttl内直接返回该错误而不再重试。
+// 用于数据源故障时保护数据源，ttl应当设置得较短(例如几秒)。
+func WithErrorCacheTTL(ttl time.Duration) GroupOption {
+	return func(g *Group) {
+		if ttl > 0 {
+			g.loadErrs = newErrorCache(ttl)
+		}
+	}
+}
+
+// WithLoadLimiter 使用限流器限制该缓存组同时执行的数据源加载数量，每次加载占用weight个单位的容量。
+// 多个缓存组可以共享同一个 LoadLimiter，实现进程级别的并发限制。
+func WithLoadLimiter(l *LoadLimiter, weight int64) GroupOption {
+	return func(g *Group) {
+		if weight <= 0 {
+			weight = 1
+		}
+		g.limiter = l
+		g.loadWeight = weight
+	}
+}
+
+// WithLoadHoldTime 加载完成后在窗口d内继续复用加载结果，吸收紧随其后到达的突发请求，见 singleflight.Group.HoldTime
+func WithLoadHoldTime(d time.Duration) GroupOption {
+	return func(g *Group) {
+		g.loader.HoldTime = d
+	}
+}
+
+// WithPeerTimeout 设置调用方没有指定截止时间时，该缓存组从远程节点读取数据的超时时间(包括重试)，
+// 超时后回退到本地加载。调用方通过 GetContext 传入的截止时间优先。
+func WithPeerTimeout(d time.Duration) GroupOption {
+	return func(g *Group) {
+		g.peerTimeout = d
+	}
+}
+
+// WithLFUTieBreak 设置lfu缓存中访问频率相同的数据之间的淘汰顺序，默认淘汰最久没有被访问的，对lru缓存无效
+func WithLFUTieBreak(t lfu.TieBreak) GroupOption {
+	return func(g *Group) {
+		for _, c := range []BaseCache{g.mainCache, g.hotCache} {
+			if c, ok := c.(*LFUcache); ok {
+				c.tieBreak = t
+			}
+		}
+	}
 }
 
 type AtomicInt int64 // 封装一个原子类，用于进行原子操作，保证并发安全.
@@ -58,13 +185,18 @@ func (i *AtomicInt) Add(n int64) { //原子自增
 	atomic.AddInt64((*int64)(i), n)
 }
 
+// Set 方法用于原子地设置 AtomicInt 的值
+func (i *AtomicInt) Set(n int64) {
+	atomic.StoreInt64((*int64)(i), n)
+}
+
 // Get 方法用于获取 AtomicInt 中的值。
 func (i *AtomicInt) Get() int64 {
 	return atomic.LoadInt64((*int64)(i))
 }
 
 // NewGroup create a new instance of Group
-func NewGroup(name string, cacheBytes int64, CacheType string, getter Getter) *Group {
+func NewGroup(name string, cacheBytes int64, CacheType string, getter Getter, opts ...GroupOption) *Group {
 	if getter == nil {
 		panic("nil Getter")
 	}
@@ -75,18 +207,53 @@ func NewGroup(name string, cacheBytes int64, CacheType string, getter Getter) *G
 		getter: getter,
 		loader: &singleflight.Group{},
 		keys:   map[string]*KeyStats{},
+		logger: logging.Nop,
+		stop:   make(chan struct{}),
+	}
+	g.hotThreshold.Set(int64(maxMinuteRemoteQPS))
+	onEvicted := func(key string, value ByteView, removed bool) {
+		g.counters.evictions.Add(1)
+		g.observeEviction(value, removed)
+		g.emit(EventEviction, key, value.Len())
 	}
 	if CacheType == "lru" {
-		g.mainCache = &LRUcache{cacheBytes: cacheBytes}
+		g.mainCache = &LRUcache{cacheBytes: cacheBytes, onEvicted: onEvicted}
 		g.hotCache = &LRUcache{cacheBytes: cacheBytes}
 	} else if CacheType == "lfu" {
-		g.mainCache = &LFUcache{cacheBytes: cacheBytes}
+		g.mainCache = &LFUcache{cacheBytes: cacheBytes, onEvicted: onEvicted}
 		g.hotCache = &LFUcache{cacheBytes: cacheBytes}
 	}
+	for _, opt := range opts {
+		opt(g)
+	}
+	if old, ok := groups[name]; ok {
+		old.stopBackground() // 被同名的缓存组替换，停止旧缓存组的后台任务
+	}
 	groups[name] = g // 存入全局变量
 	return g
 }
 
+// Close 停止缓存组的后台任务(后台淘汰、容量预测、加载池的worker)并把它从全局注册表中移除，之后 GetGroup 不再返回它。
+// 关闭后缓存组仍然可以读写，写入超出容量时同步淘汰。可以多次调用
+func (g *Group) Close() {
+	g.stopBackground()
+	mu.Lock()
+	if groups[g.name] == g {
+		delete(groups, g.name)
+	}
+	mu.Unlock()
+}
+
+// stopBackground 停止缓存组的后台任务和加载池的worker，可以多次调用
+func (g *Group) stopBackground() {
+	g.stopOnce.Do(func() {
+		close(g.stop)
+		if g.pool != nil {
+			g.pool.close()
+		}
+	})
+}
+
 // GetGroup 根据缓存组的名字获取缓存组
 func GetGroup(name string) *Group {
 	mu.RLock()
@@ -95,65 +262,301 @@ func GetGroup(name string) *Group {
 	return g
 }
 
+// Groups 返回当前进程中所有的缓存组，按名字排序
+func Groups() []*Group {
+	list := allGroups()
+	sort.Slice(list, func(i, j int) bool { return list[i].name < list[j].name })
+	return list
+}
+
 // GetCacheData 获取缓存数据 热点缓存—>主缓存—>数据源
 func (g *Group) GetCacheData(key string) (ByteView, error) {
+	return g.GetContext(context.Background(), key)
+}
+
+// GetContext 与 GetCacheData 相同，ctx 中的截止时间和追踪ID(见 WithTraceID)会随请求传递给远程节点
+func (g *Group) GetContext(ctx context.Context, key string) (ByteView, error) {
+	v, err := g.getStored(ctx, key)
+	if err != nil {
+		return ByteView{}, err
+	}
+	return g.decode(key, v)
+}
+
+// getStored 获取缓存中存储的数据，即经过变换链之后的数据，节点之间传输的也是这种数据
+func (g *Group) getStored(ctx context.Context, key string) (ByteView, error) {
+	v, _, err := g.getStoredInfo(ctx, key)
+	return v, err
+}
+
+// getStoredInfo 与 getStored 相同，同时返回数据的来源
+func (g *Group) getStoredInfo(ctx context.Context, key string) (value ByteView, info GetInfo, err error) {
+	ctx, span := startSpan(ctx, "gocache.Get")
+	span.SetAttribute("gocache.group", g.name)
+	span.SetAttribute("gocache.key", key)
+	if len(g.observers) > 0 {
+		ctx = g.beforeGet(ctx, key)
+		start := time.Now()
+		defer func() { g.afterGet(ctx, key, start, value, info, err) }()
+	}
+	defer func() {
+		if g.heat != nil && key != "" {
+			g.heat.Add(key, int64(value.Len()))
+		}
+		span.SetAttribute("gocache.source", string(info.Source))
+		endSpan(span, err)
+	}()
 	if key == "" {
-		return ByteView{}, fmt.Errorf("key is required")
+		return ByteView{}, GetInfo{}, fmt.Errorf("key is required")
 	}
 	if v, ok := g.hotCache.get(key); ok {
-		log.Println("[GeeCache] hit hotCache")
-		return v, nil
+		g.logger.Debug("cache hit", "group", g.name, "key", key, "cache", "hot")
+		g.counters.hotHits.Add(1)
+		g.emit(EventHit, key, v.Len())
+		record(replay.Op{Type: replay.OpGet, Group: g.name, Key: key, Size: v.Len(), Hit: true})
+		added, _, _ := g.hotCache.stat(key)
+		g.observeHit(added)
+		return v, GetInfo{Source: SourceHotCache, Added: added, Expire: v.Expire()}, nil
 	}
 
 	if v, ok := g.mainCache.get(key); ok {
-		log.Println("[GeeCache] hit")
-		return v, nil
+		g.logger.Debug("cache hit", "group", g.name, "key", key, "cache", "main")
+		g.counters.hits.Add(1)
+		g.emit(EventHit, key, v.Len())
+		record(replay.Op{Type: replay.OpGet, Group: g.name, Key: key, Size: v.Len(), Hit: true})
+		added, _, _ := g.mainCache.stat(key)
+		g.observeHit(added)
+		return v, GetInfo{Source: SourceMainCache, Added: added, Expire: v.Expire()}, nil
 	}
 
-	return g.load(key) // 查不到执行回调函数,获取值并添加进缓存
+	g.emit(EventMiss, key, 0)
+	g.counters.misses.Add(1)
+	v, info, err := g.load(ctx, key) // 查不到执行回调函数,获取值并添加进缓存
+	if err != nil {
+		g.counters.loadErrors.Add(1)
+		g.emit(EventLoadError, key, 0)
+		record(replay.Op{Type: replay.OpGet, Group: g.name, Key: key})
+		return v, info, err
+	}
+	if info.Source == SourcePeer {
+		g.counters.peerLoads.Add(1)
+	} else {
+		g.counters.localLoads.Add(1)
+	}
+	g.emit(EventLoad, key, v.Len())
+	record(replay.Op{Type: replay.OpGet, Group: g.name, Key: key, Size: v.Len()})
+	return v, info, nil
+}
+
+// loaded 是一次加载的结果，由 singleflight 在合并的调用者之间共享
+type loaded struct {
+	value ByteView
+	info  GetInfo
 }
 
 // 缓存未命中—>尝试从远程节点获取—>若获取失败则从本地获取
-func (g *Group) load(key string) (value ByteView, err error) {
+func (g *Group) load(ctx context.Context, key string) (value ByteView, info GetInfo, err error) {
+	ctx, span := startSpan(ctx, "gocache.load")
+	span.SetAttribute("gocache.group", g.name)
+	span.SetAttribute("gocache.key", key)
+	defer func() {
+		span.SetAttribute("gocache.source", string(info.Source))
+		endSpan(span, err)
+	}()
+	if g.loadErrs != nil {
+		if err := g.loadErrs.get(key); err != nil { // 数据源近期加载失败，直接返回缓存的错误
+			return ByteView{}, GetInfo{}, err
+		}
+	}
 	// each key is only fetched once (either locally or remotely)
 	// regardless of the number of concurrent callers.
-	viewi, err := g.loader.Do(key, func() (interface{}, error) {
+	resi, err, _ := g.loader.Do(key, func() (interface{}, error) {
 		if g.peers != nil {
-			if peer, ok := g.peers.PickPeer(key); ok { // 如果是本地节点就返回nil，如果不是就返回对应节点的地址
-				if value, err = g.getFromPeer(peer, key); err == nil {
-					return value, nil
+			if peer, ok := g.pickPeer(key); ok { // 如果是本地节点就返回nil，如果不是就返回对应节点的地址
+				value, info, err := g.getFromPeerHedged(ctx, peer, key)
+				if err == nil {
+					return loaded{value, info}, nil
+				} else if errors.Is(err, ErrNotFound) { // 归属节点明确告知不存在，不再从本地加载
+					return nil, err
+				}
+				g.logger.Warn("get from peer failed", "group", g.name, "key", key, "error", err)
+				value, info, local, err := g.fallbackFromPeer(ctx, peer, key, err)
+				if !local {
+					if err != nil {
+						return nil, err
+					}
+					return loaded{value, info}, nil
 				}
-				log.Println("[GoCache] Failed to get from peer", err)
 			}
 		}
 		// 该key的哈希值在哈希环中所对应的就是当前节点，因此调用回调方法，去本地的数据源拿值
-		return g.getLocally(key)
+		value, err := g.getLocally(ctx, key)
+		if err != nil {
+			// 被限流或者调用方已经取消不是数据源的故障，不缓存
+			if err != ErrTooManyLoads && err != ErrLoadQueueFull && ctx.Err() == nil && g.loadErrs != nil {
+				g.loadErrs.add(key, err)
+			}
+			return nil, err
+		}
+		return loaded{value, GetInfo{Source: SourceLocalLoad, Added: time.Now(), Expire: value.Expire()}}, nil
 	})
-	if err == nil {
-		return viewi.(ByteView), nil
+	if err != nil {
+		return ByteView{}, GetInfo{}, err
 	}
-	return
+	res := resi.(loaded)
+	return res.value, res.info, nil
 }
 
-// getLocally 从本地获取数据 并添加到本地缓存 与 热点缓存中
-func (g *Group) getLocally(key string) (ByteView, error) {
-	bytes, err := g.getter.Get(key)
+// Set 显式地向主缓存中写入数据，ttl 大于0时优先于数据源和组默认的过期时间。开启了租约时key当前的租约失效(见 WithLeases)，
+// 热点缓存中的旧副本被删除
+func (g *Group) Set(key string, value []byte, ttl time.Duration) error {
+	if key == "" {
+		return fmt.Errorf("key is required")
+	}
+	b, err := g.encode(key, cloneBytes(value))
+	if err != nil {
+		return err
+	}
+	g.storeLocally(key, ByteView{b: b, e: g.expireAt(ttl)})
+	g.emit(EventSet, key, len(b))
+	record(replay.Op{Type: replay.OpSet, Group: g.name, Key: key, Size: len(b)})
+	return nil
+}
+
+// storeLocally 把已经编码、确定了过期时间的数据写入主缓存：清除缓存的加载错误，使key当前的租约失效
+// (租约的持有者不能再用旧数据覆盖)，并删除热点缓存中的旧副本
+func (g *Group) storeLocally(key string, value ByteView) {
+	if g.loadErrs != nil {
+		g.loadErrs.remove(key)
+	}
+	g.leases.invalidate(key, func() {
+		g.mainCache.add(key, value)
+		g.budget.enforce()
+		g.hotCache.remove(key)
+	})
+}
+
+// Delete 从本节点的主缓存和热点缓存中删除key，返回删除前主缓存中是否存在该key，开启了租约时key当前的租约失效。
+// 只影响本节点，其他节点上的副本需要通过 Delete RPC 删除，见 PeerWriter。
+func (g *Group) Delete(key string) bool {
+	_, ok := g.mainCache.peek(key)
+	g.leases.invalidate(key, func() { // 租约的持有者不能再回填删除前加载的数据
+		g.mainCache.remove(key)
+		g.hotCache.remove(key)
+	})
+	if g.loadErrs != nil {
+		g.loadErrs.remove(key)
+	}
+	g.loader.Forget(key) // 正在进行的加载结果可能已经过时
+	g.emit(EventDelete, key, 0)
+	return ok
+}
+
+// Flush 清空本节点上缓存组的主缓存、热点缓存和缓存的加载错误，返回主缓存中删除的数据条数。
+// 只影响本节点，与对每个key调用 Delete 相同，不产生 EventDelete 事件。
+func (g *Group) Flush() int {
+	n := 0
+	for _, key := range g.mainCache.keys() {
+		if _, ok := g.mainCache.peek(key); ok {
+			n++
+		}
+		g.mainCache.remove(key)
+	}
+	for _, key := range g.hotCache.keys() {
+		g.hotCache.remove(key)
+	}
+	if g.loadErrs != nil {
+		g.loadErrs.clear()
+	}
+	return n
+}
+
+// Resize 修改缓存组主缓存和热点缓存的容量(字节)，0表示不限制。新容量小于已占用的容量时立即按淘汰策略移除数据
+func (g *Group) Resize(cacheBytes int64) {
+	g.mainCache.resize(cacheBytes)
+	g.hotCache.resize(cacheBytes)
+}
+
+// SetDefaultTTL 在运行时修改默认过期时间，只影响之后写入的数据，已经缓存的数据保持原来的过期时间
+func (g *Group) SetDefaultTTL(ttl time.Duration) {
+	g.defaultTTL.Set(int64(ttl))
+}
+
+// SetHotKeyThreshold 在运行时修改热点key的阈值，见 WithHotKeyThreshold。n 小于1时恢复默认值
+func (g *Group) SetHotKeyThreshold(n int) {
+	if n < 1 {
+		n = maxMinuteRemoteQPS
+	}
+	g.hotThreshold.Set(int64(n))
+}
+
+// getLocally 从本地获取数据 并添加到本地缓存 与 热点缓存中，ctx 只用于在限流器中排队
+func (g *Group) getLocally(ctx context.Context, key string) (ByteView, error) {
+	if g.limiter != nil {
+		if err := g.limiter.acquire(ctx, g.loadWeight); err != nil {
+			return ByteView{}, err
+		}
+		defer g.limiter.release(g.loadWeight)
+	}
+	var (
+		bytes []byte
+		ttl   time.Duration
+		err   error
+	)
+	if g.pool != nil {
+		bytes, ttl, err = g.pool.run(func() ([]byte, time.Duration, error) { return g.callGetter(key) })
+	} else {
+		bytes, ttl, err = g.callGetter(key)
+	}
 	if err != nil {
 		return ByteView{}, err
 
 	}
-	value := ByteView{b: cloneBytes(bytes)}
-	g.populateCache(key, value)
+	if bytes, err = g.encode(key, cloneBytes(bytes)); err != nil {
+		return ByteView{}, err
+	}
+	value := g.populateCache(key, ByteView{b: bytes}, ttl)
 	g.populateHotCache(key, value)
 	return value, nil
 }
 
-func (g *Group) populateCache(key string, value ByteView) {
+// callGetter 调用数据源，数据源实现了 TTLGetter 时同时返回过期时间
+func (g *Group) callGetter(key string) (b []byte, ttl time.Duration, err error) {
+	if g.slow != nil {
+		start := time.Now()
+		defer func() { g.observeSlow(SourceLocalLoad, key, "", time.Since(start), len(b), err) }()
+	}
+	if tg, ok := g.getter.(TTLGetter); ok { // 数据源可以为数据指定过期时间
+		return tg.GetWithTTL(key)
+	}
+	b, err = g.getter.Get(key)
+	return b, 0, err
+}
+
+// populateCache 计算过期时间后写入主缓存，返回带有过期时间的数据
+func (g *Group) populateCache(key string, value ByteView, ttl time.Duration) ByteView {
+	value.e = g.expireAt(ttl)
 	g.mainCache.add(key, value)
+	g.budget.enforce()
+	return value
+}
+
+// expireAt 根据ttl计算过期时刻，零值表示永不过期
+// 优先级：显式指定的ttl(Set或数据源) > 组默认ttl > 永不过期
+func (g *Group) expireAt(ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		ttl = time.Duration(g.defaultTTL.Get())
+	}
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(ttl)
 }
 
+// populateHotCache 写入热点缓存，数据应当已经由 populateCache 确定了过期时间
 func (g *Group) populateHotCache(key string, value ByteView) {
 	g.hotCache.add(key, value)
+	g.budget.enforce()
 }
 
 // RegisterPeers registers a PeerPicker for choosing remote peer
@@ -164,15 +567,82 @@ func (g *Group) RegisterPeers(peers PeerPicker) {
 	g.peers = peers
 }
 
-func (g *Group) getFromPeer(peer PeerGetter, key string) (ByteView, error) {
-	req := &pb.Request{
-		Group: g.name,
-		Key:   key,
+// pickPeer 选择key的归属节点，peers 实现了 GroupPeerPicker 时按本缓存组的拓扑选择，没有注册 PeerPicker 时返回false
+func (g *Group) pickPeer(key string) (PeerGetter, bool) {
+	if g.peers == nil {
+		return nil, false
 	}
-	res := &pb.Response{}
-	err := peer.Get(req, res)
+	if gp, ok := g.peers.(GroupPeerPicker); ok {
+		return gp.PickGroupPeer(g.name, key)
+	}
+	return g.peers.PickPeer(key)
+}
+
+func (g *Group) getFromPeer(ctx context.Context, peer PeerGetter, key string) (v ByteView, _ GetInfo, err error) {
+	var addr string
+	if c, ok := peer.(*Client); ok {
+		addr = c.peerAddr()
+	}
+	ctx, span := startSpan(ctx, "gocache.getFromPeer")
+	span.SetAttribute("gocache.group", g.name)
+	span.SetAttribute("gocache.key", key)
+	span.SetAttribute("gocache.peer", addr)
+	start := time.Now()
+	defer func() {
+		g.observeSlow(SourcePeer, key, addr, time.Since(start), v.Len(), err)
+		endSpan(span, err)
+	}()
+	res, err := g.requestPeer(ctx, peer, key)
 	if err != nil {
-		return ByteView{}, err
+		return ByteView{}, GetInfo{}, err
+	}
+	return g.acceptPeerResponse(peer, key, res)
+}
+
+// requestPeer 向远程节点发送读取key的请求，返回原始的响应，响应由 acceptPeerResponse 放回池中
+func (g *Group) requestPeer(ctx context.Context, peer PeerGetter, key string) (*pb.Response, error) {
+	req := getRequest()
+	defer putRequest(req)
+	req.Group, req.Key = g.name, key
+	if _, ok := ctx.Deadline(); !ok && g.peerTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, g.peerTimeout)
+		defer cancel()
+	}
+	if err := g.fillMeta(ctx, req); err != nil {
+		return nil, err
+	}
+	get := peer.Get
+	if c, ok := peer.(*Client); ok {
+		// 数据只会放入只读的 ByteView，合并的请求共享同一份数据；调用者取消时不再等待重试
+		get = func(in *pb.Request, out *pb.Response) error { return c.getShared(ctx, in, out) }
+	}
+	res := getResponse()
+	if err := get(req, res); err != nil {
+		putResponse(res)
+		return nil, err
+	}
+	return res, nil
+}
+
+// acceptPeerResponse 处理远程节点peer的响应：区分key不存在，按热度放入热点缓存，返回数据
+func (g *Group) acceptPeerResponse(peer PeerGetter, key string, res *pb.Response) (ByteView, GetInfo, error) {
+	defer putResponse(res) // 返回的数据引用 res.Value，清空响应不影响数据
+	if res.ProtocolVersion >= protocolVersion && !res.Found {
+		if res.Error != "" {
+			return ByteView{}, GetInfo{}, fmt.Errorf("%w: %s", ErrNotFound, res.Error)
+		}
+		return ByteView{}, GetInfo{}, ErrNotFound
+	}
+	expire := g.expireAt(0)
+	info := peerInfo(res)
+	if res.ExpiresAt != 0 { // 以归属节点的过期时间为准
+		expire = time.Unix(0, res.ExpiresAt)
+	}
+	if ResponseFlag(res.Flags)&FlagHot != 0 { // 归属节点认为是热点，直接放入热点缓存
+		g.populateHotCache(key, ByteView{b: res.Value, e: expire})
+		g.watchHot(peer, key)
+		return ByteView{b: res.Value, e: expire}, info, nil
 	}
 	//远程获取cnt++
 	if stat, ok := g.keys[key]; ok {
@@ -180,9 +650,10 @@ func (g *Group) getFromPeer(peer PeerGetter, key string) (ByteView, error) {
 		//计算QPS
 		interval := float64(time.Now().Unix()-stat.firstGetTime.Unix()) / 60
 		qps := stat.remoteCnt.Get() / int64(math.Max(1, math.Round(interval)))
-		if qps >= int64(maxMinuteRemoteQPS) {
+		if qps >= g.hotThreshold.Get() {
 			//存入hotCache
-			g.populateHotCache(key, ByteView{b: res.Value})
+			g.populateHotCache(key, ByteView{b: res.Value, e: expire})
+			g.watchHot(peer, key)
 			//删除映射关系,节省内存
 			mu.Lock()
 			delete(g.keys, key)
@@ -196,5 +667,5 @@ func (g *Group) getFromPeer(peer PeerGetter, key string) (ByteView, error) {
 		}
 	}
 
-	return ByteView{b: res.Value}, nil
+	return ByteView{b: res.Value, e: expire}, info, nil
 }
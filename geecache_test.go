@@ -1,10 +1,17 @@
 package gocache
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
+	"gocache/replay"
+	"io"
 	"log"
 	"reflect"
+	"sort"
 	"testing"
+	"time"
 )
 
 var db = map[string]string{
@@ -26,7 +33,7 @@ func TestGetter(t *testing.T) {
 
 func TestGet(t *testing.T) {
 	loadCounts := make(map[string]int, len(db))
-	gee := NewGroup("scores", 2<<10, GetterFunc(
+	gee := NewGroup("scores", 2<<10, "lru", GetterFunc(
 		func(key string) ([]byte, error) {
 			log.Println("[SlowDB] search key", key)
 			if v, ok := db[key]; ok {
@@ -40,22 +47,50 @@ func TestGet(t *testing.T) {
 		}))
 
 	for k, v := range db {
-		if view, err := gee.Get(k); err != nil || view.String() != v {
+		if view, err := gee.GetCacheData(k); err != nil || view.String() != v {
 			t.Fatal("failed to get value of Tom")
 		}
-		if _, err := gee.Get(k); err != nil || loadCounts[k] > 1 {
+		if _, err := gee.GetCacheData(k); err != nil || loadCounts[k] > 1 {
 			t.Fatalf("cache %s miss", k)
 		}
 	}
 
-	if view, err := gee.Get("unknown"); err == nil {
+	if view, err := gee.GetCacheData("unknown"); err == nil {
 		t.Fatalf("the value of unknow should be empty, but %s got", view)
 	}
 }
 
+func TestByteViewZeroCopy(t *testing.T) {
+	g := NewGroup("zero-copy", 2<<10, "lru", GetterFunc(func(key string) ([]byte, error) {
+		return []byte("value-" + key), nil
+	}))
+	a, _ := g.GetCacheData("k")
+	b, _ := g.GetCacheData("k")
+	if &a.UnsafeBytes()[0] != &b.UnsafeBytes()[0] { // 两次读取都直接引用缓存中的数据
+		t.Fatal("UnsafeBytes copied the cached value")
+	}
+	if &a.ByteSlice()[0] == &a.UnsafeBytes()[0] {
+		t.Fatal("ByteSlice returned the cached value")
+	}
+
+	var buf bytes.Buffer
+	if n, err := a.WriteTo(&buf); err != nil || n != int64(a.Len()) || buf.String() != "value-k" {
+		t.Fatalf("WriteTo = %d, %v, %q", n, err, buf.String())
+	}
+	dst := make([]byte, 5)
+	if n := a.Copy(dst); n != 5 || string(dst) != "value" {
+		t.Fatalf("Copy = %d, %q", n, dst)
+	}
+	r := a.Reader()
+	r.Seek(6, 0)
+	if rest, _ := io.ReadAll(r); string(rest) != "k" {
+		t.Fatalf("Reader read %q", rest)
+	}
+}
+
 func TestGetGroup(t *testing.T) {
 	groupName := "scores"
-	NewGroup(groupName, 2<<10, GetterFunc(
+	NewGroup(groupName, 2<<10, "lru", GetterFunc(
 		func(key string) (bytes []byte, err error) { return }))
 	if group := GetGroup(groupName); group == nil || group.name != groupName {
 		t.Fatalf("group %s not exist", groupName)
@@ -65,3 +100,289 @@ func TestGetGroup(t *testing.T) {
 		t.Fatalf("expect nil, but %s got", group.name)
 	}
 }
+
+func TestTTLPrecedence(t *testing.T) {
+	getter := TTLGetterFunc(func(key string) ([]byte, time.Duration, error) {
+		if key == "ttl" {
+			return []byte(key), time.Hour, nil
+		}
+		return []byte(key), 0, nil
+	})
+	g := NewGroup("ttl", 2<<10, "lru", getter, WithDefaultTTL(time.Minute))
+
+	expireIn := func(key string) time.Duration {
+		v, ok := g.mainCache.get(key)
+		if !ok {
+			t.Fatalf("key %s not cached", key)
+		}
+		if v.Expire().IsZero() {
+			return 0
+		}
+		return time.Until(v.Expire()).Round(time.Minute)
+	}
+
+	// 数据源指定的ttl优先于组默认ttl
+	if _, err := g.GetCacheData("ttl"); err != nil {
+		t.Fatal(err)
+	}
+	if d := expireIn("ttl"); d != time.Hour {
+		t.Fatalf("getter ttl: expect %v, got %v", time.Hour, d)
+	}
+
+	// 数据源没有指定时使用组默认ttl
+	if _, err := g.GetCacheData("default"); err != nil {
+		t.Fatal(err)
+	}
+	if d := expireIn("default"); d != time.Minute {
+		t.Fatalf("default ttl: expect %v, got %v", time.Minute, d)
+	}
+
+	// 显式Set的ttl优先级最高
+	if err := g.Set("ttl", []byte("v"), 2*time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if d := expireIn("ttl"); d != 2*time.Hour {
+		t.Fatalf("set ttl: expect %v, got %v", 2*time.Hour, d)
+	}
+
+	// 运行时修改默认ttl只影响之后写入的数据
+	g.SetDefaultTTL(5 * time.Minute)
+	if _, err := g.GetCacheData("later"); err != nil {
+		t.Fatal(err)
+	}
+	if d, old := expireIn("later"), expireIn("default"); d != 5*time.Minute || old != time.Minute {
+		t.Fatalf("after SetDefaultTTL: expect 5m and 1m, got %v and %v", d, old)
+	}
+
+	// 都没有指定时永不过期
+	noTTL := NewGroup("no-ttl", 2<<10, "lfu", GetterFunc(
+		func(key string) ([]byte, error) { return []byte(key), nil }))
+	if _, err := noTTL.GetCacheData("k"); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := noTTL.mainCache.get("k"); !ok || !v.Expire().IsZero() {
+		t.Fatalf("expect no expiry, got %v", v.Expire())
+	}
+}
+
+func TestErrorCache(t *testing.T) {
+	calls := 0
+	g := NewGroup("err-cache", 2<<10, "lru", GetterFunc(
+		func(key string) ([]byte, error) {
+			calls++
+			return nil, fmt.Errorf("backend down")
+		}), WithErrorCacheTTL(50*time.Millisecond))
+
+	for i := 0; i < 3; i++ {
+		if _, err := g.GetCacheData("k"); err == nil {
+			t.Fatal("expect error from failing backend")
+		}
+	}
+	if calls != 1 {
+		t.Fatalf("backend should be called once within error ttl, got %d", calls)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if _, err := g.GetCacheData("k"); err == nil || calls != 2 {
+		t.Fatalf("expect retry after error ttl, calls = %d", calls)
+	}
+
+	// 显式写入会清除缓存的错误
+	if err := g.Set("k", []byte("v"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := g.GetCacheData("k"); err != nil || v.String() != "v" {
+		t.Fatalf("expect v after Set, got %v %v", v, err)
+	}
+}
+
+func TestCloneInto(t *testing.T) {
+	getter := GetterFunc(func(key string) ([]byte, error) { return []byte(key), nil })
+	src := NewGroup("clone-src", 2<<10, "lru", getter)
+	dst := NewGroup("clone-dst", 2<<10, "lfu", getter)
+	expire := time.Now().Add(time.Hour)
+	src.mainCache.add("a", ByteView{b: []byte("1"), e: expire})
+	src.mainCache.add("b", ByteView{b: []byte("2")})
+	src.mainCache.add("drop", ByteView{b: []byte("3")})
+
+	stats, err := src.CloneInto("clone-dst", func(k string, v ByteView) (string, ByteView, bool) {
+		if k == "drop" {
+			return "", v, false
+		}
+		return "v2:" + k, ByteView{b: []byte("x" + v.String()), e: v.Expire()}, true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Scanned != 3 || stats.Cloned != 2 || stats.Dropped != 1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+	if v, ok := dst.mainCache.get("v2:a"); !ok || v.String() != "x1" || !v.Expire().Equal(expire) {
+		t.Fatalf("v2:a not cloned correctly: %v %v", v, ok)
+	}
+	if v, ok := dst.mainCache.get("v2:b"); !ok || v.String() != "x2" {
+		t.Fatalf("v2:b not cloned correctly: %v %v", v, ok)
+	}
+
+	// 与 Set 相同：租约失效，热点缓存中的旧副本被删除
+	leased := NewGroup("clone-lease-dst", 2<<10, "lru", getter, WithLeases(time.Second))
+	_, token, err := leased.GetLease(context.Background(), "a")
+	if err != nil || token == 0 {
+		t.Fatalf("GetLease = %v, %v", token, err)
+	}
+	leased.hotCache.add("a", ByteView{b: []byte("stale")})
+	if _, err := src.CloneInto("clone-lease-dst", func(k string, v ByteView) (string, ByteView, bool) { return k, v, true }); err != nil {
+		t.Fatal(err)
+	}
+	if err := leased.SetWithLease("a", []byte("old"), 0, token); err != ErrLeaseInvalid {
+		t.Fatalf("expect the lease to be invalidated by the clone, got %v", err)
+	}
+	if _, ok := leased.hotCache.peek("a"); ok {
+		t.Fatal("stale hot copy should be removed")
+	}
+
+	if _, err := src.CloneInto("clone-missing", nil); err == nil {
+		t.Fatal("expect error for unknown target group")
+	}
+}
+
+func TestTransforms(t *testing.T) {
+	var order []string
+	prefix := Transform{
+		Name: "prefix",
+		Write: func(key string, v []byte) ([]byte, error) {
+			order = append(order, "prefix")
+			return append([]byte("p:"), v...), nil
+		},
+		Read: func(key string, v []byte) ([]byte, error) {
+			if !bytes.HasPrefix(v, []byte("p:")) {
+				return nil, fmt.Errorf("bad prefix %q", v)
+			}
+			return v[2:], nil
+		},
+	}
+	xor := func(key string, v []byte) ([]byte, error) {
+		out := make([]byte, len(v))
+		for i := range v {
+			out[i] = v[i] ^ 0x20
+		}
+		return out, nil
+	}
+	getter := GetterFunc(func(key string) ([]byte, error) { return []byte("value"), nil })
+	g := NewGroup("transforms", 2<<10, "lru", getter,
+		WithTransforms(prefix, Transform{Name: "xor", Read: xor, Write: func(key string, v []byte) ([]byte, error) {
+			order = append(order, "xor")
+			return xor(key, v)
+		}}))
+
+	v, err := g.GetCacheData("k")
+	if err != nil || v.String() != "value" {
+		t.Fatalf("GetCacheData = %q, %v", v.String(), err)
+	}
+	if len(order) != 2 || order[0] != "prefix" || order[1] != "xor" {
+		t.Fatalf("write transforms applied in wrong order: %v", order)
+	}
+	stored, _ := g.mainCache.get("k")
+	if want, _ := xor("", []byte("p:value")); stored.String() != string(want) {
+		t.Fatalf("stored value %q is not transformed", stored.String())
+	}
+
+	if err := g.Set("k2", []byte("set"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := g.GetCacheData("k2"); err != nil || v.String() != "set" {
+		t.Fatalf("GetCacheData(k2) = %q, %v", v.String(), err)
+	}
+}
+
+func TestScan(t *testing.T) {
+	g := NewGroup("scan", 2<<10, "lfu", GetterFunc(
+		func(key string) ([]byte, error) { return []byte("v-" + key), nil }))
+	for _, k := range []string{"d", "a", "c", "b", "e"} {
+		g.GetCacheData(k)
+	}
+	g.GetCacheData("c") // 命中一次
+
+	var got []string
+	cursor := ""
+	for page := 0; ; page++ {
+		infos, next := g.Scan(cursor, 2)
+		for _, info := range infos {
+			got = append(got, info.Key)
+			if info.Size != 3 || info.Added.IsZero() {
+				t.Fatalf("unexpected key info %+v", info)
+			}
+			if info.Key == "c" && info.Hits != 1 {
+				t.Fatalf("expect 1 hit for c, got %d", info.Hits)
+			}
+		}
+		if next == "" {
+			break
+		}
+		if page > 5 {
+			t.Fatal("scan does not terminate")
+		}
+		cursor = next
+	}
+	sort.Strings(got) // 按分片返回，分片之间不是字典序
+	if !reflect.DeepEqual(got, []string{"a", "b", "c", "d", "e"}) {
+		t.Fatalf("Scan returned %v", got)
+	}
+
+	// 页的边界落在分片中间时从上一个key之后继续，每个key恰好返回一次
+	big := NewGroup("scan-pages", 1<<20, "lru", GetterFunc(
+		func(key string) ([]byte, error) { return []byte(key), nil }))
+	for i := 0; i < 500; i++ {
+		big.Set(fmt.Sprintf("key-%d", i), []byte("v"), 0)
+	}
+	seen := map[string]bool{}
+	for cursor := ""; ; {
+		infos, next := big.Scan(cursor, 7)
+		for _, info := range infos {
+			if seen[info.Key] {
+				t.Fatalf("key %s returned twice", info.Key)
+			}
+			seen[info.Key] = true
+		}
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	if len(seen) != 500 {
+		t.Fatalf("Scan returned %d keys, want 500", len(seen))
+	}
+}
+
+func TestRecording(t *testing.T) {
+	g := NewGroup("recording", 2<<10, "lru", GetterFunc(
+		func(key string) ([]byte, error) { return []byte("value"), nil }))
+	var buf bytes.Buffer
+	StartRecording(&buf)
+	g.GetCacheData("Tom")
+	g.GetCacheData("Tom")
+	g.Set("Jack", []byte("v"), 0)
+	if err := StopRecording(); err != nil {
+		t.Fatal(err)
+	}
+	g.GetCacheData("Sam") // 停止录制之后的操作不会被记录
+
+	var ops []replay.Op
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var op replay.Op
+		if err := dec.Decode(&op); err != nil {
+			t.Fatal(err)
+		}
+		ops = append(ops, op)
+	}
+	if len(ops) != 3 {
+		t.Fatalf("expect 3 ops, got %+v", ops)
+	}
+	if ops[0].Type != replay.OpGet || ops[0].Hit || ops[0].Key != replay.HashKey("Tom") || ops[0].Size != 5 {
+		t.Fatalf("unexpected first op %+v", ops[0])
+	}
+	if !ops[1].Hit || ops[2].Type != replay.OpSet {
+		t.Fatalf("unexpected ops %+v", ops[1:])
+	}
+}
@@ -18,6 +18,16 @@ const _ = grpc.SupportPackageIsVersion6
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
 type GroupCacheClient interface {
 	Get(ctx context.Context, in *Request, opts ...grpc.CallOption) (*Response, error)
+	Events(ctx context.Context, in *EventsRequest, opts ...grpc.CallOption) (GroupCache_EventsClient, error)
+	Scan(ctx context.Context, in *ScanRequest, opts ...grpc.CallOption) (*ScanResponse, error)
+	Put(ctx context.Context, in *PutRequest, opts ...grpc.CallOption) (*PutResponse, error)
+	Delete(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*DeleteResponse, error)
+	BatchGet(ctx context.Context, in *BatchGetRequest, opts ...grpc.CallOption) (*BatchGetResponse, error)
+	GetStream(ctx context.Context, in *Request, opts ...grpc.CallOption) (GroupCache_GetStreamClient, error)
+	Subscribe(ctx context.Context, opts ...grpc.CallOption) (GroupCache_SubscribeClient, error)
+	Stats(ctx context.Context, in *StatsRequest, opts ...grpc.CallOption) (*StatsResponse, error)
+	Hello(ctx context.Context, in *Hello, opts ...grpc.CallOption) (*Hello, error)
+	Lease(ctx context.Context, in *LeaseRequest, opts ...grpc.CallOption) (*LeaseResponse, error)
 }
 
 type groupCacheClient struct {
@@ -37,11 +47,179 @@ func (c *groupCacheClient) Get(ctx context.Context, in *Request, opts ...grpc.Ca
 	return out, nil
 }
 
+func (c *groupCacheClient) Events(ctx context.Context, in *EventsRequest, opts ...grpc.CallOption) (GroupCache_EventsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_GroupCache_serviceDesc.Streams[0], "/geecachepb.GroupCache/Events", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &groupCacheEventsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type GroupCache_EventsClient interface {
+	Recv() (*Event, error)
+	grpc.ClientStream
+}
+
+type groupCacheEventsClient struct {
+	grpc.ClientStream
+}
+
+func (x *groupCacheEventsClient) Recv() (*Event, error) {
+	m := new(Event)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *groupCacheClient) Scan(ctx context.Context, in *ScanRequest, opts ...grpc.CallOption) (*ScanResponse, error) {
+	out := new(ScanResponse)
+	err := c.cc.Invoke(ctx, "/geecachepb.GroupCache/Scan", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *groupCacheClient) Put(ctx context.Context, in *PutRequest, opts ...grpc.CallOption) (*PutResponse, error) {
+	out := new(PutResponse)
+	err := c.cc.Invoke(ctx, "/geecachepb.GroupCache/Put", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *groupCacheClient) Delete(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*DeleteResponse, error) {
+	out := new(DeleteResponse)
+	err := c.cc.Invoke(ctx, "/geecachepb.GroupCache/Delete", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *groupCacheClient) BatchGet(ctx context.Context, in *BatchGetRequest, opts ...grpc.CallOption) (*BatchGetResponse, error) {
+	out := new(BatchGetResponse)
+	err := c.cc.Invoke(ctx, "/geecachepb.GroupCache/BatchGet", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *groupCacheClient) GetStream(ctx context.Context, in *Request, opts ...grpc.CallOption) (GroupCache_GetStreamClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_GroupCache_serviceDesc.Streams[1], "/geecachepb.GroupCache/GetStream", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &groupCacheGetStreamClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type GroupCache_GetStreamClient interface {
+	Recv() (*Chunk, error)
+	grpc.ClientStream
+}
+
+type groupCacheGetStreamClient struct {
+	grpc.ClientStream
+}
+
+func (x *groupCacheGetStreamClient) Recv() (*Chunk, error) {
+	m := new(Chunk)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *groupCacheClient) Subscribe(ctx context.Context, opts ...grpc.CallOption) (GroupCache_SubscribeClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_GroupCache_serviceDesc.Streams[2], "/geecachepb.GroupCache/Subscribe", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &groupCacheSubscribeClient{stream}
+	return x, nil
+}
+
+type GroupCache_SubscribeClient interface {
+	Send(*SubscribeRequest) error
+	Recv() (*Invalidation, error)
+	grpc.ClientStream
+}
+
+type groupCacheSubscribeClient struct {
+	grpc.ClientStream
+}
+
+func (x *groupCacheSubscribeClient) Send(m *SubscribeRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *groupCacheSubscribeClient) Recv() (*Invalidation, error) {
+	m := new(Invalidation)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *groupCacheClient) Stats(ctx context.Context, in *StatsRequest, opts ...grpc.CallOption) (*StatsResponse, error) {
+	out := new(StatsResponse)
+	err := c.cc.Invoke(ctx, "/geecachepb.GroupCache/Stats", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *groupCacheClient) Hello(ctx context.Context, in *Hello, opts ...grpc.CallOption) (*Hello, error) {
+	out := new(Hello)
+	err := c.cc.Invoke(ctx, "/geecachepb.GroupCache/Hello", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *groupCacheClient) Lease(ctx context.Context, in *LeaseRequest, opts ...grpc.CallOption) (*LeaseResponse, error) {
+	out := new(LeaseResponse)
+	err := c.cc.Invoke(ctx, "/geecachepb.GroupCache/Lease", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // GroupCacheServer is the server API for GroupCache service.
 // All implementations must embed UnimplementedGroupCacheServer
 // for forward compatibility
 type GroupCacheServer interface {
 	Get(context.Context, *Request) (*Response, error)
+	Events(*EventsRequest, GroupCache_EventsServer) error
+	Scan(context.Context, *ScanRequest) (*ScanResponse, error)
+	Put(context.Context, *PutRequest) (*PutResponse, error)
+	Delete(context.Context, *DeleteRequest) (*DeleteResponse, error)
+	BatchGet(context.Context, *BatchGetRequest) (*BatchGetResponse, error)
+	GetStream(*Request, GroupCache_GetStreamServer) error
+	Subscribe(GroupCache_SubscribeServer) error
+	Stats(context.Context, *StatsRequest) (*StatsResponse, error)
+	Hello(context.Context, *Hello) (*Hello, error)
+	Lease(context.Context, *LeaseRequest) (*LeaseResponse, error)
 	mustEmbedUnimplementedGroupCacheServer()
 }
 
@@ -52,6 +230,36 @@ type UnimplementedGroupCacheServer struct {
 func (*UnimplementedGroupCacheServer) Get(context.Context, *Request) (*Response, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Get not implemented")
 }
+func (*UnimplementedGroupCacheServer) Events(*EventsRequest, GroupCache_EventsServer) error {
+	return status.Errorf(codes.Unimplemented, "method Events not implemented")
+}
+func (*UnimplementedGroupCacheServer) Scan(context.Context, *ScanRequest) (*ScanResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Scan not implemented")
+}
+func (*UnimplementedGroupCacheServer) Put(context.Context, *PutRequest) (*PutResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Put not implemented")
+}
+func (*UnimplementedGroupCacheServer) Delete(context.Context, *DeleteRequest) (*DeleteResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Delete not implemented")
+}
+func (*UnimplementedGroupCacheServer) BatchGet(context.Context, *BatchGetRequest) (*BatchGetResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BatchGet not implemented")
+}
+func (*UnimplementedGroupCacheServer) GetStream(*Request, GroupCache_GetStreamServer) error {
+	return status.Errorf(codes.Unimplemented, "method GetStream not implemented")
+}
+func (*UnimplementedGroupCacheServer) Subscribe(GroupCache_SubscribeServer) error {
+	return status.Errorf(codes.Unimplemented, "method Subscribe not implemented")
+}
+func (*UnimplementedGroupCacheServer) Stats(context.Context, *StatsRequest) (*StatsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Stats not implemented")
+}
+func (*UnimplementedGroupCacheServer) Hello(context.Context, *Hello) (*Hello, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Hello not implemented")
+}
+func (*UnimplementedGroupCacheServer) Lease(context.Context, *LeaseRequest) (*LeaseResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Lease not implemented")
+}
 func (*UnimplementedGroupCacheServer) mustEmbedUnimplementedGroupCacheServer() {}
 
 func RegisterGroupCacheServer(s *grpc.Server, srv GroupCacheServer) {
@@ -76,6 +284,200 @@ func _GroupCache_Get_Handler(srv interface{}, ctx context.Context, dec func(inte
 	return interceptor(ctx, in, info, handler)
 }
 
+func _GroupCache_Events_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(EventsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(GroupCacheServer).Events(m, &groupCacheEventsServer{stream})
+}
+
+type GroupCache_EventsServer interface {
+	Send(*Event) error
+	grpc.ServerStream
+}
+
+type groupCacheEventsServer struct {
+	grpc.ServerStream
+}
+
+func (x *groupCacheEventsServer) Send(m *Event) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _GroupCache_Scan_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ScanRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GroupCacheServer).Scan(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/geecachepb.GroupCache/Scan",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GroupCacheServer).Scan(ctx, req.(*ScanRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GroupCache_Put_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PutRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GroupCacheServer).Put(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/geecachepb.GroupCache/Put",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GroupCacheServer).Put(ctx, req.(*PutRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GroupCache_Delete_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GroupCacheServer).Delete(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/geecachepb.GroupCache/Delete",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GroupCacheServer).Delete(ctx, req.(*DeleteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GroupCache_BatchGet_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BatchGetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GroupCacheServer).BatchGet(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/geecachepb.GroupCache/BatchGet",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GroupCacheServer).BatchGet(ctx, req.(*BatchGetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GroupCache_GetStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(Request)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(GroupCacheServer).GetStream(m, &groupCacheGetStreamServer{stream})
+}
+
+type GroupCache_GetStreamServer interface {
+	Send(*Chunk) error
+	grpc.ServerStream
+}
+
+type groupCacheGetStreamServer struct {
+	grpc.ServerStream
+}
+
+func (x *groupCacheGetStreamServer) Send(m *Chunk) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _GroupCache_Subscribe_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(GroupCacheServer).Subscribe(&groupCacheSubscribeServer{stream})
+}
+
+type GroupCache_SubscribeServer interface {
+	Send(*Invalidation) error
+	Recv() (*SubscribeRequest, error)
+	grpc.ServerStream
+}
+
+type groupCacheSubscribeServer struct {
+	grpc.ServerStream
+}
+
+func (x *groupCacheSubscribeServer) Send(m *Invalidation) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *groupCacheSubscribeServer) Recv() (*SubscribeRequest, error) {
+	m := new(SubscribeRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _GroupCache_Stats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(StatsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GroupCacheServer).Stats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/geecachepb.GroupCache/Stats",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GroupCacheServer).Stats(ctx, req.(*StatsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GroupCache_Hello_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Hello)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GroupCacheServer).Hello(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/geecachepb.GroupCache/Hello",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GroupCacheServer).Hello(ctx, req.(*Hello))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GroupCache_Lease_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(LeaseRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GroupCacheServer).Lease(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/geecachepb.GroupCache/Lease",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GroupCacheServer).Lease(ctx, req.(*LeaseRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 var _GroupCache_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "geecachepb.GroupCache",
 	HandlerType: (*GroupCacheServer)(nil),
@@ -84,7 +486,52 @@ var _GroupCache_serviceDesc = grpc.ServiceDesc{
 			MethodName: "Get",
 			Handler:    _GroupCache_Get_Handler,
 		},
+		{
+			MethodName: "Scan",
+			Handler:    _GroupCache_Scan_Handler,
+		},
+		{
+			MethodName: "Put",
+			Handler:    _GroupCache_Put_Handler,
+		},
+		{
+			MethodName: "Delete",
+			Handler:    _GroupCache_Delete_Handler,
+		},
+		{
+			MethodName: "BatchGet",
+			Handler:    _GroupCache_BatchGet_Handler,
+		},
+		{
+			MethodName: "Stats",
+			Handler:    _GroupCache_Stats_Handler,
+		},
+		{
+			MethodName: "Hello",
+			Handler:    _GroupCache_Hello_Handler,
+		},
+		{
+			MethodName: "Lease",
+			Handler:    _GroupCache_Lease_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Events",
+			Handler:       _GroupCache_Events_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "GetStream",
+			Handler:       _GroupCache_GetStream_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "Subscribe",
+			Handler:       _GroupCache_Subscribe_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "geecache/geecachepb/mycachepb.proto",
 }
@@ -2,16 +2,26 @@ package gocache
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	clientv3 "go.etcd.io/etcd/client/v3"
 	"gocache/consistenthash"
 	pb "gocache/gocachepb"
+	"gocache/logging"
 	"gocache/registry"
+	"gocache/replay"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/proto"
-	"log"
 	"net"
-	"strings"
+	"os"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 /*
@@ -23,54 +33,431 @@ import (
 const (
 	//defaultAddr     = "127.0.0.1:6324"
 	defaultReplicas = 50
+	errBufferSize   = 16   // Err 通道的缓冲大小
+	maxBatchKeys    = 1000 // 一次 BatchGet 最多读取的key数量
+
+	// protocolVersion 当前的协议版本。v1的响应把序列化后的 Response 放进 value，请求方需要反序列化两次；
+	// v2的 value 直接携带缓存的数据。请求中携带支持的版本，服务端按请求方的版本响应，新旧节点可以混合部署。
+	protocolVersion = 2
+)
+
+// ResponseFlag v2响应中数据的标志位
+type ResponseFlag uint32
+
+const (
+	// FlagHot 数据在归属节点上是热点，请求方可以直接放入自己的热点缓存
+	FlagHot ResponseFlag = 1 << iota
 )
 
 // Server 和 Group 是解耦合的 所以server要自己实现并发控制
 type Server struct {
 	pb.UnimplementedGroupCacheServer //gRPC 自动生成的代码，用于实现 gRPC 的服务端接口。
 
-	self       string              // 当前服务器的地址，format: ip:port
-	status     bool                // 当前服务器的运行状态，true: running false: stop
-	stopSignal chan error          // 用于接收通知，通知服务器停止运行。通常是其他组件发出的信号，例如 registry 服务，用于通知当前服务停止运行。
-	mu         sync.Mutex          //保护共享资源的互斥锁
-	peers      *consistenthash.Map //一致性哈希（consistent hash）映射，用于确定缓存数据在集群中的分布。
-	clients    map[string]*Client  //用于存储其他节点的客户端连接。键是其他节点的地址，值是与该节点建立的客户端连接
+	self       string                         // 当前服务器对外公布的地址，format: ip:port
+	listenAddr string                         // 监听的地址，空字符串表示监听 self 的端口，见 WithListenAddr
+	state      ServerState                    // 当前服务器的运行状态，见 State
+	stopSignal chan error                     // 通知注册goroutine注销本节点，停止时由 beginLeave 关闭，每次启动重新创建
+	mu         sync.RWMutex                   //保护共享资源的读写锁
+	peers      *consistenthash.Map            //一致性哈希（consistent hash）映射，用于确定缓存数据在集群中的分布。本身是并发安全的，查询不需要加锁
+	clients    map[string]*Client             //用于存储其他节点的客户端连接。键是其他节点的地址，值是与该节点建立的客户端连接
+	groupRings map[string]*consistenthash.Map // 单独指定了节点集合的缓存组使用的哈希环，见 SetGroup
+
+	registration *registry.Registration // 当前服务在etcd中的注册，记录注册状态并负责自动重新注册
+	errs         chan error             // 后台goroutine中产生的错误，交由使用者决定是否致命
+
+	missingPeerPolicy MissingPeerPolicy         // 哈希环选中的节点没有对应客户端时的处理策略
+	migration         map[string]MigrationStats // 最近一次拓扑变化后各缓存组的迁移统计
+
+	rebalanceInterval time.Duration // 渐进式清理不再归属本节点数据的间隔，0表示不清理
+	rebalanceBatch    int           // 每次清理每个缓存组最多删除的key数量
+	rebalanceGen      int64         // 清理任务的代数，拓扑变化或停止服务时递增，使旧任务退出
+
+	hash      consistenthash.Hash64 // 一致性哈希使用的哈希函数，nil表示默认的crc32
+	warm      *warmGate             // 注册之前的预热要求，nil表示不等待预热
+	warmups   []startupWarmup       // 启动时执行的预热，见 WithStartupWarmup
+	snapshots *snapshotter          // 定期快照和启动时恢复，见 WithSnapshots
+
+	ringSubs ringSubs // 哈希环变化的订阅者，见 SubscribeRing
+
+	chunkSize    int   // GetStream 每段数据的最大字节数，见 WithChunkSize
+	maxValueSize int64 // 节点之间传输的数据大小上限，0表示不限制，见 WithMaxValueSize
+
+	health *health.Server // 标准的 grpc.health.v1 健康检查服务，与缓存服务使用同一个端口
+
+	grpcServer  *grpc.Server  // 运行中的gRPC服务器，停止服务时关闭
+	registered  chan struct{} // 注册goroutine退出(已经从etcd注销)时关闭
+	drainWindow time.Duration // 注销之后继续处理请求的时间，见 WithDrainWindow
+
+	grpcOpts []grpc.ServerOption            // 创建gRPC服务器的额外参数，见 WithGRPCOptions
+	unary    []grpc.UnaryServerInterceptor  // 使用者追加的一元RPC拦截器
+	stream   []grpc.StreamServerInterceptor // 使用者追加的流式RPC拦截器
+
+	rateLimit   atomic.Pointer[rateLimiter] // 读取请求的速率限制，nil表示不限制，见 WithRateLimit
+	maxInFlight AtomicInt                   // 同时处理的读取请求上限，0表示不限制，见 WithLoadShedding
+	inFlight    AtomicInt                   // 正在处理的读取请求数
+	rateLimited AtomicInt                   // 因超过速率限制被拒绝的请求数
+	shed        AtomicInt                   // 因节点过载被拒绝的请求数
+
+	tlsConfig *tls.Config // 节点之间通信使用的TLS配置，nil表示明文传输，见 WithTLS
+	optErr    error       // 应用选项时产生的错误，由 NewServer 返回
+
+	idleTimeout     time.Duration              // 到其他节点的连接空闲多久后关闭，见 WithIdleTimeout
+	poolSize        int                        // 到每个节点的连接数，见 WithConnPool
+	clientKeepalive keepalive.ClientParameters // 到其他节点的连接的keepalive参数，见 WithClientKeepalive
+	retry           RetryPolicy                // 访问其他节点读取数据失败时的重试策略，见 WithRetryPolicy
+	rpcTimeout      time.Duration              // 访问其他节点时一次RPC的超时时间，见 WithRPCTimeout
+
+	breakerThreshold int           // 连续失败多少次后熔断，0表示不熔断，见 WithCircuitBreaker
+	breakerCooldown  time.Duration // 熔断后多久放行试探请求
+
+	discovery    bool               // 是否根据etcd中注册的节点自动更新哈希环，见 WithDiscovery
+	stopDiscover context.CancelFunc // 停止监听注册的节点
+
+	static      bool              // 是否使用固定的节点列表，不依赖etcd，见 WithStaticPeers
+	staticPeers []string          // 创建时加入哈希环的节点
+	dns         *dnsDiscovery     // 通过解析域名发现节点，nil表示不使用，见 WithDNSDiscovery
+	backend     registry.Registry // 代替内置etcd注册的注册中心，nil表示不使用，见 WithRegistry
+	probe       *peerProbe        // 对其他节点的健康检查，nil表示不检查，见 WithPeerHealthCheck
+	ops         *httpListener     // 运维调试端口，nil表示不开启，见 WithOpsListener
+	dashboard   *dashboard        // 运维调试端口上的网页控制台，nil表示不开启，见 WithDashboard
+	admin       *httpListener     // 管理接口的端口，nil表示不开启，见 WithAdminListener
+	adminToken  string            // 访问管理接口的令牌
+	reload      ReloadFunc        // POST /admin/reload 调用的函数，见 WithReload
+
+	weight   int                     // 本节点在哈希环上的权重，见 WithWeight
+	zone     string                  // 本节点所在的可用区，见 WithZone
+	peerMeta map[string]NodeMetadata // 其他节点的元数据，见 SetPeerMetadata
+
+	etcdConfig clientv3.Config // 连接etcd的配置，见 WithEtcdConfig
+	namespace  string          // 节点在etcd中注册的命名空间，见 WithNamespace
+	leaseTTL   time.Duration   // 注册使用的租约有效期，0表示默认值，见 WithLeaseTTL
+
+	logger Logger // 见 WithLogger
+}
+
+// ServerOption 用于配置 Server 的可选参数
+type ServerOption func(*Server)
+
+// MissingPeerPolicy 决定一致性哈希选中的节点没有对应客户端时(例如动态发现的节点没有调用Set)的处理方式
+type MissingPeerPolicy int
+
+const (
+	MissingPeerCreate MissingPeerPolicy = iota // 按需创建客户端，默认策略
+	MissingPeerLocal                           // 不访问远程节点，回退到本地加载
+	MissingPeerError                           // 返回 *UnknownPeerError，由调用方的失败处理逻辑决定
+)
+
+// UnknownPeerError 表示哈希环选中的节点没有可用的客户端
+type UnknownPeerError struct {
+	Addr string
+}
+
+func (e *UnknownPeerError) Error() string {
+	return fmt.Sprintf("gocache: no client for peer %s", e.Addr)
+}
+
+// unknownPeer 在 MissingPeerError 策略下代替缺失的客户端，每次请求都返回 *UnknownPeerError
+type unknownPeer struct {
+	addr string
+}
+
+func (p unknownPeer) Get(in *pb.Request, out *pb.Response) error {
+	return &UnknownPeerError{Addr: p.addr}
+}
+
+// WithMissingPeerPolicy 设置哈希环选中的节点没有对应客户端时的处理策略
+func WithMissingPeerPolicy(p MissingPeerPolicy) ServerOption {
+	return func(s *Server) {
+		s.missingPeerPolicy = p
+	}
+}
+
+// WithHash 设置一致性哈希使用的64位哈希函数，例如 consistenthash.XXHash64、consistenthash.Murmur3。
+// 集群中所有节点必须使用相同的哈希函数，否则同一个key会被路由到不同的节点。
+func WithHash(fn consistenthash.Hash64) ServerOption {
+	return func(s *Server) {
+		s.hash = fn
+	}
+}
+
+// WithListenAddr 设置监听的地址，例如 "0.0.0.0:8001"、"[::]:8001"。
+// 默认监听 self 的端口(所有网卡)，在NAT或容器中对外地址的端口与监听的端口不同时需要单独设置。
+func WithListenAddr(addr string) ServerOption {
+	return func(s *Server) {
+		s.listenAddr = addr
+	}
+}
+
+// WithAdvertiseAddr 设置对外公布的地址，即注册到etcd、加入哈希环以及其他节点用来访问本节点的地址，覆盖 NewServer 的 self 参数
+func WithAdvertiseAddr(addr string) ServerOption {
+	return func(s *Server) {
+		s.self = addr
+	}
 }
 
-// NewServer 创建cache的 Server
-func NewServer(self string) (*Server, error) {
-	return &Server{
+// NewServer 创建cache的 Server，self 为本节点对外公布的地址，格式为 host:port，IPv6 地址需要用方括号括起来
+func NewServer(self string, opts ...ServerOption) (*Server, error) {
+	s := &Server{
 		self:    self,
-		peers:   consistenthash.New(defaultReplicas, nil),
 		clients: map[string]*Client{},
-	}, nil
+		errs:    make(chan error, errBufferSize),
+		health:  health.NewServer(),
+
+		idleTimeout:     defaultIdleTimeout,
+		poolSize:        1,
+		clientKeepalive: defaultClientKeepalive,
+		retry:           DefaultRetryPolicy,
+		rpcTimeout:      defaultRPCTimeout,
+
+		breakerThreshold: defaultBreakerThreshold,
+		breakerCooldown:  defaultBreakerCooldown,
+
+		namespace: defaultNamespace,
+		logger:    logging.Nop,
+	}
+	// 先读取环境变量中的etcd配置和命名空间，再由选项覆盖
+	s.etcdConfig, s.optErr = registry.EtcdConfigFromEnv(os.Getenv)
+	if ns := os.Getenv(EnvNamespace); ns != "" {
+		s.namespace = ns
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.optErr != nil {
+		return nil, s.optErr
+	}
+	s.registration = registry.NewRegistration(s.namespace, s.self)
+	s.registration.SetEtcdConfig(s.etcdConfig)
+	s.registration.SetLogger(s.logger)
+	if s.leaseTTL > 0 {
+		s.registration.SetLeaseTTL(s.leaseTTL)
+	}
+	s.peers = s.newRing()
+	s.peers.SetWeight(s.self, s.weight)
+	s.setServing(false)
+	if len(s.staticPeers) > 0 {
+		s.Set(s.staticPeers...)
+	}
+	return s, nil
+}
+
+// listenAddress 返回监听的地址，没有设置 WithListenAddr 时在所有网卡上监听 self 的端口
+func (s *Server) listenAddress() (string, error) {
+	if s.listenAddr != "" {
+		return s.listenAddr, nil
+	}
+	_, port, err := net.SplitHostPort(s.self)
+	if err != nil {
+		return "", fmt.Errorf("invalid address %q: %v", s.self, err)
+	}
+	return net.JoinHostPort("", port), nil
+}
+
+// newRing 创建一个空的哈希环
+func (s *Server) newRing() *consistenthash.Map {
+	return consistenthash.NewWithHash64(defaultReplicas, s.hash)
 }
 
 // Get 实现了 Server 结构体用于处理 gRPC 客户端的请求
-func (s *Server) Get(ctx context.Context, in *pb.Request) (*pb.Response, error) {
+func (s *Server) Get(ctx context.Context, in *pb.Request) (_ *pb.Response, err error) {
 	// 处理客户端的 gRPC 请求，获取缓存数据并返回响应
 	group, key := in.Group, in.Key
-	resp := &pb.Response{}
+	ctx, span := startSpan(extractTrace(ctx, in), "gocache.Server.Get")
+	span.SetAttribute("gocache.group", group)
+	span.SetAttribute("gocache.key", key)
+	span.SetAttribute("gocache.caller", in.Caller)
+	defer func() { endSpan(span, err) }()
 
-	log.Printf("[Geecache_svr %s] Recv RPC Request - (%s)/(%s)", s.self, group, key)
+	s.logger.Debug("recv get request", "self", s.self, "group", group, "key", key, "trace", in.TraceId, "caller", in.Caller)
+	done, err := s.admit(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
 	if key == "" {
-		return resp, fmt.Errorf("key required")
+		return nil, errKeyRequired
 	}
 	g := GetGroup(group)
 	if g == nil {
-		return resp, fmt.Errorf("group not found")
+		return nil, groupNotFound(group)
+	}
+	ctx, cancel, err := requestContext(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+	if in.GetProtocolVersion() >= protocolVersion {
+		resp, err := s.storedResponse(ctx, g, key)
+		if err != nil {
+			return nil, statusError(err)
+		}
+		if s.maxValueSize > 0 && int64(len(resp.Value)) > s.maxValueSize {
+			return nil, status.Errorf(codes.ResourceExhausted, "%v: %d > %d bytes", ErrValueTooLarge, len(resp.Value), s.maxValueSize)
+		}
+		setSendCompressor(ctx, g, len(resp.Value))
+		return resp, nil
+	}
+	view, err := g.getStored(ctx, key) // 传输变换后的数据，由请求方还原
+	if err != nil {
+		return nil, statusError(err)
+	}
+	// v1：将获取到的缓存数据序列化为 protobuf 格式，并存储在响应对象的 Value 字段中。
+	// 内层的 Response 在这里就序列化完成，可以放回池中
+	inner := getResponse()
+	inner.Value = view.b
+	body, err := proto.Marshal(inner)
+	putResponse(inner)
+	if err != nil {
+		s.logger.Error("encode response body failed", "self", s.self, "group", group, "key", key, "error", err)
+	}
+	setSendCompressor(ctx, g, len(body))
+	return &pb.Response{Value: body}, nil
+}
+
+// storedResponse 按v2协议读取key并填充响应，key不存在不是错误，由请求方区分空值和不存在
+func (s *Server) storedResponse(ctx context.Context, g *Group, key string) (*pb.Response, error) {
+	resp := &pb.Response{ProtocolVersion: protocolVersion, Node: s.self}
+	view, info, err := g.getStoredInfo(ctx, key) // 传输变换后的数据，由请求方还原
+	if errors.Is(err, ErrNotFound) {
+		resp.Error = err.Error()
+		return resp, nil
 	}
-	view, err := g.GetCacheData(key)
 	if err != nil {
 		return resp, err
 	}
+	resp.Value = view.b // ByteView 不可修改，slab 中的内存也不会被复用，直接序列化而不复制
+	resp.Found = true
+	resp.Source = string(info.Source)
+	if !info.Added.IsZero() {
+		resp.Added = info.Added.UnixNano()
+	}
+	if !view.Expire().IsZero() {
+		resp.ExpiresAt = view.Expire().UnixNano()
+	}
+	_, hits, _ := g.mainCache.stat(key)
+	if _, hot, ok := g.hotCache.stat(key); ok { // 热点缓存拦截的命中也计入
+		hits += hot
+	}
+	if hits >= g.hotThreshold.Get() {
+		resp.Flags |= uint32(FlagHot)
+	}
+	return resp, nil
+}
 
-	// 将获取到的缓存数据序列化为 protobuf 格式，并存储在响应对象的 Value 字段中
-	body, err := proto.Marshal(&pb.Response{Value: view.ByteSlice()})
+// Put 实现了写入数据的RPC，将数据写入本节点的主缓存
+func (s *Server) Put(ctx context.Context, in *pb.PutRequest) (*pb.PutResponse, error) {
+	g := GetGroup(in.Group)
+	if g == nil {
+		return nil, groupNotFound(in.Group)
+	}
+	if in.Key == "" {
+		return nil, errKeyRequired
+	}
+	if err := g.Set(in.Key, in.Value, time.Duration(in.Ttl)); err != nil {
+		return nil, statusError(err)
+	}
+	return &pb.PutResponse{}, nil
+}
+
+// Delete 实现了删除数据的RPC，删除本节点缓存的key
+func (s *Server) Delete(ctx context.Context, in *pb.DeleteRequest) (*pb.DeleteResponse, error) {
+	if in.Key == "" {
+		return nil, errKeyRequired
+	}
+	g := GetGroup(in.Group)
+	if g == nil {
+		return nil, groupNotFound(in.Group)
+	}
+	return &pb.DeleteResponse{Deleted: g.Delete(in.Key)}, nil
+}
+
+// BatchGet 实现了批量读取的RPC，响应与请求的key一一对应，单个key读取失败时在对应的响应中给出原因
+func (s *Server) BatchGet(ctx context.Context, in *pb.BatchGetRequest) (*pb.BatchGetResponse, error) {
+	done, err := s.admit(ctx)
 	if err != nil {
-		log.Printf("encoding response body:%v", err)
+		return nil, err
+	}
+	defer done()
+	if len(in.Keys) > maxBatchKeys {
+		return nil, status.Errorf(codes.InvalidArgument, "too many keys: %d > %d", len(in.Keys), maxBatchKeys)
+	}
+	g := GetGroup(in.Group)
+	if g == nil {
+		return nil, groupNotFound(in.Group)
+	}
+	out := &pb.BatchGetResponse{Values: make([]*pb.Response, len(in.Keys))}
+	size := 0
+	for i, key := range in.Keys {
+		resp, err := s.storedResponse(ctx, g, key)
+		if err != nil {
+			resp.Error = err.Error()
+		}
+		out.Values[i] = resp
+		size += len(resp.Value)
+	}
+	setSendCompressor(ctx, g, size)
+	return out, nil
+}
+
+// Events 实现了事件订阅的流式RPC，将本节点满足条件的缓存事件实时推送给调用者，直到调用者断开
+func (s *Server) Events(in *pb.EventsRequest, stream pb.GroupCache_EventsServer) error {
+	filter := EventFilter{Group: in.GetGroup()}
+	for _, name := range in.GetTypes() {
+		t, ok := ParseEventType(name)
+		if !ok {
+			return status.Errorf(codes.InvalidArgument, "unknown event type %q", name)
+		}
+		filter.Types = append(filter.Types, t)
+	}
+	ch, cancel := SubscribeEvents(filter)
+	defer cancel()
+	for {
+		select {
+		case e := <-ch:
+			err := stream.Send(&pb.Event{
+				Type:  e.Type.String(),
+				Group: e.Group,
+				Key:   e.Key,
+				Time:  e.Time.UnixNano(),
+				Size:  int64(e.Size),
+			})
+			if err != nil {
+				return err
+			}
+		case <-stream.Context().Done():
+			return nil
+		}
+	}
+}
+
+// Scan 实现了分页枚举key元数据的RPC，用于导出、分析缓存内容
+func (s *Server) Scan(ctx context.Context, in *pb.ScanRequest) (*pb.ScanResponse, error) {
+	done, err := s.admit(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+	g := GetGroup(in.GetGroup())
+	if g == nil {
+		return nil, groupNotFound(in.GetGroup())
+	}
+	infos, next := g.Scan(in.GetCursor(), int(in.GetLimit()))
+	ring := s.peers
+
+	resp := &pb.ScanResponse{NextCursor: next, Keys: make([]*pb.KeyInfo, 0, len(infos))}
+	for _, info := range infos {
+		k := &pb.KeyInfo{
+			Key:   info.Key,
+			Hash:  ring.Hash(info.Key),
+			Size:  int64(info.Size),
+			Added: info.Added.UnixNano(),
+			Hits:  info.Hits,
+		}
+		if !info.Expire.IsZero() {
+			k.Expire = info.Expire.UnixNano()
+		}
+		resp.Keys = append(resp.Keys, k)
 	}
-	resp.Value = body
 	return resp, nil
 }
 
@@ -78,13 +465,13 @@ func (s *Server) Get(ctx context.Context, in *pb.Request) (*pb.Response, error)
 func (s *Server) Start() error {
 	// 启动缓存服务，监听端口，注册 gRPC 服务，处理停止信号
 	s.mu.Lock()
-	if s.status == true {
+	if s.state == StateRunning {
 		s.mu.Unlock()
 		return fmt.Errorf("server already started")
 	}
 	/*
 		-----------------启动服务----------------------
-		1. 设置status为true 表示服务器已在运行
+		1. 设置state为running 表示服务器已在运行
 		2. 初始化stop channel,这用于通知registry stop keep alive
 		3. 初始化tcp socket并开始监听
 		4. 注册rpc服务至grpc 这样grpc收到request可以分发给server处理
@@ -92,97 +479,282 @@ func (s *Server) Start() error {
 			这样的好处是client只需知道服务名，以及etcd的Host即可获取对应服务IP 无需写在至client代码中
 		----------------------------------------------
 	*/
-	// 设置服务器状态为运行中
-	s.status = true
-	s.stopSignal = make(chan error)
-
-	port := strings.Split(s.self, ":")[1]
-	lis, err := net.Listen("tcp", ":"+port) //监听指定的 TCP 端口，用于接受客户端的 gRPC 请求
+	addr, err := s.listenAddress()
 	if err != nil {
+		s.mu.Unlock()
+		return err
+	}
+	lis, err := net.Listen("tcp", addr) //监听指定的 TCP 端口，用于接受客户端的 gRPC 请求
+	if err != nil {
+		s.mu.Unlock()
 		return fmt.Errorf("failed to listen: %v", err)
 	}
+	if err := s.startListeners(); err != nil {
+		lis.Close()
+		s.mu.Unlock()
+		return err
+	}
+
+	// 设置服务器状态为运行中，停止后重新启动时为哈希环中的节点重新创建客户端
+	if s.state == StateStopped {
+		s.reconnect()
+	}
+	s.state = StateRunning
+	s.updateRegistration()
+	s.startDiscovery()
+	s.startProbe()
+	s.startDashboard()
+	stop := make(chan error)
+	s.stopSignal = stop
 
 	// 注册 gRPC 服务
 	// 创建一个新的 gRPC 服务器 grpcServer，然后将当前的 Server 对象 s 注册为 gRPC 服务。
 	// 这样，gRPC 服务器就能够处理来自客户端的请求。
-	grpcServer := grpc.NewServer()
-	pb.RegisterGroupCacheServer(grpcServer, s)
+	grpcServer := s.newGRPCServer()
+	s.grpcServer = grpcServer
+	registered := make(chan struct{})
+	s.registered = registered
+	md := s.nodeMetadata()
+	runCtx, cancelRun := context.WithCancel(context.Background())
+	s.prepare(runCtx)
+	snapshotting := s.startSnapshots(runCtx)
 
 	go func() {
-		// 将当前服务注册至 etcd。该操作会一直阻塞，直到停止信号被接收。
-		// 当停止信号被接收后，关闭通知通道 s.stopSignal，关闭 TCP 监听端口，并输出日志表示服务已经停止。
-		err := registry.Register("gocache", s.self, s.stopSignal)
-		if err != nil {
-			log.Fatalf(err.Error())
+		// 将当前服务注册至 etcd。该操作会一直阻塞，直到 Stop 或 GracefulStop 关闭 stop，期间etcd会话丢失会自动重新注册。
+		// 注册中心出错时提前返回，stop 仍然由停止时关闭。
+		// 开启了预热要求时，先等待预热完成再注册，避免节点接管key之后出现大量未命中
+		if s.warm == nil || s.warm.wait(stop, s.logger) {
+			s.setServing(true)
+			var err error
+			switch {
+			case s.static: // 不注册到etcd，等待停止信号
+				<-stop
+			case s.backend != nil:
+				err = s.backend.Register(s.namespace, s.self, md, stop)
+			default:
+				err = s.registration.Run(stop)
+			}
+			if err != nil {
+				s.reportErr(fmt.Errorf("registry: %v", err))
+			}
 		}
 
-		// 当 registry.Register 函数执行完毕（即停止信号被接收）后，关闭通知通道 s.stopSignal，表示通知信号已经发送完毕
-		close(s.stopSignal)
-		// 关闭 TCP 监听端口，停止接受新的连接请求
-		err = lis.Close()
-		if err != nil {
-			log.Fatalf(err.Error())
-		}
-		// 服务已经停止
-		log.Printf("[%s] Revoke service and close tcp socket ok.", s.self)
+		// 已经从etcd注销，监听端口和连接由 Stop 或 GracefulStop 关闭
+		s.logger.Info("service deregistered", "self", s.self)
+		cancelRun() // 停止预热和定期快照
+		s.saveFinalSnapshots(snapshotting)
+		close(registered)
 	}()
 
 	s.mu.Unlock()
 
 	//启动 gRPC 服务器。grpcServer.Serve(lis) 会阻塞，处理客户端的 gRPC 请求，直到服务器关闭或发生错误。
-	//如果服务器状态为运行状态（s.status 为 true），并且发生了错误，则返回相应的错误。
-	if err := grpcServer.Serve(lis); s.status && err != nil {
+	//通过 Stop 或 GracefulStop 停止时 Serve 返回nil，其他情况下返回相应的错误。
+	if err := grpcServer.Serve(lis); err != nil {
 		return fmt.Errorf("failed to serve: %v", err)
 	}
 	return nil
 }
 
 // Set 方法用于设置其他缓存节点的地址信息，并为每个节点创建相应的客户端连接
+// 哈希环变化后会重新计算各缓存组的迁移统计，见 MigrationStats
 func (s *Server) Set(peersAddr ...string) {
 	// 设置其他缓存节点的地址信息，并为每个节点创建客户端连接
 	s.mu.Lock()
-	defer s.mu.Unlock()
 
-	// 将传入的所有节点地址批量添加到一致性哈希映射 s.peers 中
+	// 保留旧环的快照用于统计key的归属变化，哈希环在旁边构建好之后整体替换，查询不会被阻塞
+	oldRing := s.peers.Clone()
+	// 将传入的所有节点地址批量添加到一致性哈希映射中
 	s.peers.Add(peersAddr...)
+	newRing := s.peers.Clone()
 	// 遍历传入的节点地址列表 peersAddr，为每个节点创建一个客户端连接
 	// 这里拿到的是服务器的名称，这个map里面存的就是对应的地址
 	for _, peerAddr := range peersAddr {
-		//客户端的服务名（service）由节点地址构成，并且遵循一定的命名规则（在这里是 gocache/<peerAddr>）。
-		service := fmt.Sprintf("gocache/%s", peerAddr)
-		//使用 NewClient(service) 函数创建一个新的客户端连接，并将连接对象存储在 s.clients 映射中，以便后续通过节点地址进行查找和通信
-		s.clients[peerAddr] = NewClient(service)
+		//为节点创建一个新的客户端连接，并将连接对象存储在 s.clients 映射中，以便后续通过节点地址进行查找和通信
+		if old := s.clients[peerAddr]; old != nil {
+			old.Close()
+		}
+		s.clients[peerAddr] = s.newClient(peerAddr)
 	}
+	s.forgetProbe(peersAddr)
+	s.updateRegistration()
+	s.mu.Unlock()
+
+	record(replay.Op{Type: replay.OpTopology, Nodes: newRing.Nodes()})
+	s.updateMigrationStats(oldRing, newRing)
+	s.notifyRing(oldRing, newRing)
+	s.startRebalance(newRing)
+}
+
+// Remove 方法用于从哈希环中删除节点(例如宕机的节点)并关闭对应的客户端，之后这些节点负责的key会重新分配给其他节点
+func (s *Server) Remove(peersAddr ...string) {
+	s.mu.Lock()
+	oldRing := s.peers.Clone()
+	s.peers.Remove(peersAddr...)
+	newRing := s.peers.Clone()
+	for _, peerAddr := range peersAddr {
+		if client := s.clients[peerAddr]; client != nil {
+			client.Close()
+		}
+		delete(s.clients, peerAddr)
+	}
+	s.forgetProbe(peersAddr)
+	s.updateRegistration()
+	s.mu.Unlock()
+
+	record(replay.Op{Type: replay.OpTopology, Nodes: newRing.Nodes()})
+	s.updateMigrationStats(oldRing, newRing)
+	s.notifyRing(oldRing, newRing)
+	s.startRebalance(newRing)
 }
 
 // PickPeer 方法，用于根据给定的键选择相应的对等节点，根据在哈希环上拿到的key返回的是对应的地址
+// 使用 Set 设置的公共节点集合，缓存组单独的节点集合见 PickGroupPeer
 func (s *Server) PickPeer(key string) (PeerGetter, bool) {
+	return s.pickFrom(s.peers, key)
+}
+
+// pickFrom 在哈希环ring上选择key的归属节点
+func (s *Server) pickFrom(ring *consistenthash.Map, key string) (PeerGetter, bool) {
+	peerAddr := ring.Get(key) //根据给定的键 key 选择相应的对等节点的地址 peerAddr，查询哈希环不需要加锁
+	if peerAddr == "" {       //哈希环为空，没有可选的节点
+		return nil, false
+	}
+	if peerAddr == s.self { //如果选择的节点地址与当前服务器的地址相同，说明该节点就是当前服务器本身
+		s.logger.Debug("pick self", "self", s.self, "key", key)
+		return nil, false
+	}
+	s.logger.Debug("pick remote peer", "self", s.self, "key", key, "peer", peerAddr)
+	return s.peerClient(peerAddr)
+}
+
+// peerClient 返回节点的客户端，没有客户端时按 MissingPeerPolicy 处理
+func (s *Server) peerClient(peerAddr string) (PeerGetter, bool) {
+	s.mu.RLock()
+	client, ok := s.clients[peerAddr]
+	s.mu.RUnlock()
+	if ok && client != nil {
+		return client, true //如果选择的节点不是当前服务器本身，返回选择的对等节点的客户端连接（s.clients[peerAddr]）和 true，表示选择成功
+	}
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	if client, ok := s.clients[peerAddr]; ok && client != nil { // 加写锁期间可能已经被创建
+		return client, true
+	}
+	return s.missingPeer(peerAddr)
+}
+
+// PickPeers 方法返回key在哈希环上的n个副本节点中远程节点的客户端，local 表示本节点是否是副本节点之一。
+// 没有客户端的节点按 MissingPeerPolicy 处理，MissingPeerLocal 策略下会被跳过。设置了 WithZone 时同一可用区的节点排在前面。
+func (s *Server) PickPeers(key string, n int) (peers []PeerGetter, local bool) {
+	var remote []string
+	for _, peerAddr := range s.peers.GetN(key, n) {
+		if peerAddr == s.self {
+			local = true
+			continue
+		}
+		remote = append(remote, peerAddr)
+	}
+	s.sortByZone(remote)
+	for _, peerAddr := range remote {
+		if peer, ok := s.peerClient(peerAddr); ok {
+			peers = append(peers, peer)
+		}
+	}
+	return peers, local
+}
+
+// 测试 Server 是否实现了 PeersPicker 接口
+var _ PeersPicker = (*Server)(nil)
 
-	peerAddr := s.peers.Get(key) //根据给定的键 key 选择相应的对等节点的地址 peerAddr
-	if peerAddr == s.self {      //如果选择的节点地址与当前服务器的地址相同，说明该节点就是当前服务器本身
-		log.Printf("ooh! pick myself, I am %s\n", s.self)
+// missingPeer 根据策略处理哈希环中存在但没有客户端的节点，调用时需持有 s.mu
+func (s *Server) missingPeer(peerAddr string) (PeerGetter, bool) {
+	switch s.missingPeerPolicy {
+	case MissingPeerLocal:
+		s.logger.Warn("no client for peer, load locally", "self", s.self, "peer", peerAddr)
 		return nil, false
+	case MissingPeerError:
+		return unknownPeer{addr: peerAddr}, true
+	default:
+		client := s.newClient(peerAddr)
+		s.clients[peerAddr] = client
+		return client, true
+	}
+}
+
+// newClient 为节点创建客户端，客户端的服务名（service）由节点地址构成，遵循 <namespace>/<peerAddr> 的命名规则
+func (s *Server) newClient(peerAddr string) *Client {
+	client := NewClient(fmt.Sprintf("%s/%s", s.namespace, peerAddr))
+	client.etcdConfig = s.etcdConfig
+	if s.static || s.backend != nil {
+		client.connect = client.directConnect
 	}
-	log.Printf("[cache %s] pick remote peer: %s\n", s.self, peerAddr)
-	return s.clients[peerAddr], true //如果选择的节点不是当前服务器本身，日志会记录当前服务器选择了远程对等节点，并且函数会返回选择的对等节点的客户端连接（s.clients[peerAddr]）和 true，表示选择成功
+	client.maxValueSize = s.maxValueSize
+	client.self = s.self
+	client.creds = clientCredentials(s.tlsConfig, peerAddr)
+	client.idleTimeout = s.idleTimeout
+	client.pool = make([]pooledConn, s.poolSize)
+	client.keepalive = s.clientKeepalive
+	client.retry = s.retry
+	client.logger = s.logger
+	client.timeout = s.rpcTimeout
+	client.breaker = newCircuitBreaker(s.breakerThreshold, s.breakerCooldown)
+	return client
 }
 
 // Stop 停止server运行 如果server没有运行 这将是一个no-op
+// 监听端口和所有连接立即关闭(设置了 WithDrainWindow 时在注销并等待排空窗口之后关闭)，正在处理的请求会失败，
+// 需要等待这些请求完成时使用 GracefulStop。停止后可以再次调用 Start，哈希环中的节点会被保留。
 func (s *Server) Stop() {
 	s.mu.Lock()
-	if s.status == false {
+	if s.state != StateRunning {
 		s.mu.Unlock()
 		return
 	}
-	s.stopSignal <- nil // 发送停止keepalive信号
-	s.status = false    // 设置server运行状态为stop
-	s.clients = nil     // 清空一致性哈希信息 有助于垃圾回收
-	s.peers = nil       // 清空一致性哈希映射
+	s.beginLeave() // 发送停止keepalive信号，设置server运行状态为stop
+	gs, registered := s.grpcServer, s.registered
+	if s.drainWindow <= 0 {
+		s.closeClients()
+		s.mu.Unlock()
+		gs.Stop()
+		return
+	}
+	s.mu.Unlock()
+
+	s.awaitLeave(registered)
+	gs.Stop()
+	s.mu.Lock()
+	if s.state == StateStopped { // 排空期间可能已经重新启动，新的客户端不能关闭
+		s.closeClients()
+	}
 	s.mu.Unlock()
 }
 
+// Err 返回服务在后台运行时产生的错误，例如etcd注册失败、关闭监听端口失败。
+// 库本身不会因为这些错误终止进程，由使用者决定如何处理。
+func (s *Server) Err() <-chan error {
+	return s.errs
+}
+
+// reportErr 非阻塞地上报后台错误，通道满时只记录日志
+func (s *Server) reportErr(err error) {
+	select {
+	case s.errs <- err:
+	default:
+		s.logger.Error("dropped background error", "self", s.self, "error", err)
+	}
+}
+
+// RegistryStats 返回当前服务在etcd中的注册状态(是否注册、租约ID、最近心跳时间、重连次数)
+func (s *Server) RegistryStats() registry.Stats {
+	return s.registration.Stats()
+}
+
+// RegistryEvents 返回注册状态变化的事件通道，例如心跳丢失和重新注册
+func (s *Server) RegistryEvents() <-chan registry.Event {
+	return s.registration.Events()
+}
+
 // 测试 Server 是否实现了 PeerPicker 接口
 var _ PeerPicker = (*Server)(nil)
 
@@ -0,0 +1,471 @@
+package gocache
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	pb "gocache/gocachepb"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestServerReportErr(t *testing.T) {
+	svr, _ := NewServer("localhost:0")
+	for i := 0; i < errBufferSize+1; i++ {
+		svr.reportErr(errors.New("boom")) // 通道满时不应阻塞
+	}
+	if err := <-svr.Err(); err == nil || err.Error() != "boom" {
+		t.Fatalf("expect boom, got %v", err)
+	}
+}
+
+func TestServerStartListenFailure(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+
+	svr, _ := NewServer(lis.Addr().String())
+	if err := svr.Start(); err == nil {
+		t.Fatal("expect listen error on occupied port")
+	}
+	// 启动失败后服务应当回到停止状态，并且不会持有锁
+	svr.Stop()
+	svr.Set("127.0.0.1:1")
+}
+
+func TestPickPeerUnknownPeer(t *testing.T) {
+	const self, other = "127.0.0.1:8001", "127.0.0.1:8002"
+	newServer := func(opts ...ServerOption) *Server {
+		svr, _ := NewServer(self, opts...)
+		// 模拟动态发现的节点：只加入哈希环，没有通过 Set 创建客户端
+		svr.peers.Add(other)
+		return svr
+	}
+
+	svr := newServer()
+	peer, ok := svr.PickPeer("key")
+	if client, isClient := peer.(*Client); !ok || !isClient || client == nil || client.baseURL != "gocache/"+other {
+		t.Fatalf("expect lazily created client for %s, got %v %v", other, peer, ok)
+	}
+	if again, _ := svr.PickPeer("key"); again != peer {
+		t.Fatal("lazily created client should be reused")
+	}
+
+	svr = newServer(WithMissingPeerPolicy(MissingPeerLocal))
+	if peer, ok := svr.PickPeer("key"); ok || peer != nil {
+		t.Fatalf("expect local fallback, got %v %v", peer, ok)
+	}
+
+	svr = newServer(WithMissingPeerPolicy(MissingPeerError))
+	peer, ok = svr.PickPeer("key")
+	if !ok {
+		t.Fatal("expect error peer to be picked")
+	}
+	err := peer.Get(&pb.Request{Group: "scores", Key: "key"}, &pb.Response{})
+	if e, isUnknown := err.(*UnknownPeerError); !isUnknown || e.Addr != other {
+		t.Fatalf("expect *UnknownPeerError for %s, got %v", other, err)
+	}
+}
+
+func TestPickPeerEmptyRing(t *testing.T) {
+	svr, _ := NewServer("127.0.0.1:8001")
+	if peer, ok := svr.PickPeer("key"); ok || peer != nil {
+		t.Fatalf("expect no peer on empty ring, got %v %v", peer, ok)
+	}
+}
+
+func TestMigrationStats(t *testing.T) {
+	const self, other = "127.0.0.1:9101", "127.0.0.1:9102"
+	g := NewGroup("migration", 2<<20, "lru", GetterFunc(
+		func(key string) ([]byte, error) { return []byte(key), nil }))
+	for i := 0; i < 200; i++ {
+		g.populateCache(fmt.Sprintf("key-%d", i), ByteView{b: []byte("v")}, 0)
+	}
+
+	svr, _ := NewServer(self)
+	svr.Set(self)
+	st := svr.MigrationStats()["migration"]
+	if st.Resident != 200 || st.NotOwned != 0 || st.Gained != 0 {
+		t.Fatalf("single node should own everything, got %+v", st)
+	}
+
+	svr.Set(other)
+	st = svr.MigrationStats()["migration"]
+	if st.NotOwned == 0 || st.NotOwned == 200 || st.ByOwner[other] != st.NotOwned || st.Gained != 0 {
+		t.Fatalf("expect part of the keys to move to %s, got %+v", other, st)
+	}
+
+	svr.Remove(other)
+	st = svr.MigrationStats()["migration"]
+	if st.NotOwned != 0 || st.Gained == 0 {
+		t.Fatalf("keys should come back after removing %s, got %+v", other, st)
+	}
+	if _, ok := svr.clients[other]; ok {
+		t.Fatalf("client of %s should be removed", other)
+	}
+
+	// 统计不占用缓存的锁，写锁被占用时不阻塞
+	c := g.mainCache.(*LRUcache)
+	c.mu.Lock()
+	st = computeMigration(g, self, svr.peers, nil)
+	c.mu.Unlock()
+	if st.Resident != 200 || st.NotOwned != 0 || st.Gained != 0 {
+		t.Fatalf("unexpected stats while the cache is locked: %+v", st)
+	}
+}
+
+func TestRebalanceEvictsNotOwned(t *testing.T) {
+	const self, other = "127.0.0.1:9201", "127.0.0.1:9202"
+	g := NewGroup("rebalance", 2<<20, "lru", GetterFunc(
+		func(key string) ([]byte, error) { return []byte(key), nil }))
+	for i := 0; i < 100; i++ {
+		g.populateCache(fmt.Sprintf("key-%d", i), ByteView{b: []byte("v")}, 0)
+	}
+
+	svr, _ := NewServer(self, WithRebalance(time.Millisecond, 5))
+	svr.Set(self, other)
+	notOwned := svr.MigrationStats()["rebalance"].NotOwned
+	if notOwned == 0 {
+		t.Fatal("expect some keys to move away")
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for svr.MigrationStats()["rebalance"].Evicted < notOwned {
+		if time.Now().After(deadline) {
+			t.Fatalf("rebalance did not finish, stats %+v", svr.MigrationStats()["rebalance"])
+		}
+		time.Sleep(time.Millisecond)
+	}
+	for _, key := range g.mainCache.keys() {
+		if owner := svr.peers.Get(key); owner != self {
+			t.Fatalf("key %s owned by %s should have been evicted", key, owner)
+		}
+	}
+	if n := len(g.mainCache.keys()); n != 100-notOwned {
+		t.Fatalf("expect %d owned keys to remain, got %d", 100-notOwned, n)
+	}
+}
+
+func TestColdestKeys(t *testing.T) {
+	g := NewGroup("rebalance-cold", 2<<10, "lru", GetterFunc(
+		func(key string) ([]byte, error) { return []byte(key), nil }))
+	for _, key := range []string{"a", "b", "c"} {
+		g.populateCache(key, ByteView{b: []byte("v")}, 0)
+	}
+	g.GetCacheData("b")
+	g.GetCacheData("b")
+	g.GetCacheData("c")
+	if got := coldestKeys(g.mainCache, []string{"b", "c", "missing", "a"}, 2); !reflect.DeepEqual(got, []string{"a", "c"}) {
+		t.Fatalf("coldestKeys = %v, want [a c]", got)
+	}
+}
+
+func TestPickPeers(t *testing.T) {
+	const self = "127.0.0.1:9301"
+	svr, _ := NewServer(self, WithMissingPeerPolicy(MissingPeerLocal))
+	svr.Set(self, "127.0.0.1:9302", "127.0.0.1:9303")
+
+	peers, local := svr.PickPeers("key", 3)
+	if !local || len(peers) != 2 {
+		t.Fatalf("expect self and 2 remote replicas, got %d %v", len(peers), local)
+	}
+	peers, local = svr.PickPeers("key", 1)
+	if owner, remote := svr.PickPeer("key"); remote {
+		if local || len(peers) != 1 || peers[0] != owner {
+			t.Fatalf("first replica should be the owner")
+		}
+	} else if !local || len(peers) != 0 {
+		t.Fatalf("first replica should be self")
+	}
+}
+
+func TestWarmGate(t *testing.T) {
+	NewGroup("warm", 2<<10, "lru", GetterFunc(func(key string) ([]byte, error) {
+		if key == "bad" {
+			return nil, fmt.Errorf("not found")
+		}
+		return []byte(key), nil
+	}))
+	svr, _ := NewServer("127.0.0.1:9401", WithWarmGate(0.5, 0))
+	if err := svr.Prefetch("warm", []string{"a", "b", "bad", "c"}); err != nil {
+		t.Fatal(err)
+	}
+	if !svr.warm.wait(make(chan error), svr.logger) {
+		t.Fatal("warm gate should open")
+	}
+	deadline := time.Now().Add(time.Second)
+	for p := svr.WarmProgress(); p.Loaded+p.Failed < 4; p = svr.WarmProgress() {
+		if time.Now().After(deadline) {
+			t.Fatalf("prefetch did not finish: %+v", p)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if p := svr.WarmProgress(); !p.Ready || p.Target != 4 || p.Loaded != 3 || p.Failed != 1 {
+		t.Fatalf("unexpected progress %+v", p)
+	}
+
+	// 无法达到要求时超时放行，收到停止信号时不注册
+	svr, _ = NewServer("127.0.0.1:9402", WithWarmGate(1, 10*time.Millisecond))
+	svr.warm.target = 1
+	if !svr.warm.wait(make(chan error), svr.logger) || !svr.WarmProgress().Ready {
+		t.Fatal("warm gate should open after timeout")
+	}
+	svr, _ = NewServer("127.0.0.1:9403", WithWarmGate(1, 0))
+	svr.warm.target = 1
+	stop := make(chan error, 1)
+	stop <- nil
+	if svr.warm.wait(stop, svr.logger) {
+		t.Fatal("warm gate should give up on stop")
+	}
+}
+
+func TestRingState(t *testing.T) {
+	const self = "127.0.0.1:9401"
+	svr, _ := NewServer(self)
+	svr.Set(self, "127.0.0.1:9402", "127.0.0.1:9403")
+
+	state := svr.RingState()
+	if len(state.Nodes) != 3 || len(state.VirtualNodes) != 3*defaultReplicas {
+		t.Fatalf("unexpected ring state: %d nodes, %d virtual nodes", len(state.Nodes), len(state.VirtualNodes))
+	}
+	sum := 0.0
+	for _, n := range state.Nodes {
+		if n.VirtualNodes != defaultReplicas || !n.HasClient {
+			t.Fatalf("unexpected node %+v", n)
+		}
+		sum += n.Keyspace
+	}
+	if sum < 0.999 || sum > 1.001 {
+		t.Fatalf("keyspace fractions should sum to 1, got %v", sum)
+	}
+	if _, err := json.Marshal(state); err != nil {
+		t.Fatal(err)
+	}
+
+	o := svr.Owner("key")
+	if o.Node != svr.peers.Get("key") {
+		t.Fatalf("owner %s does not match the ring lookup", o.Node)
+	}
+}
+
+func TestJumpPicker(t *testing.T) {
+	const self = "127.0.0.1:9501"
+	svr, _ := NewServer(self, WithNamespace("jump"), WithRPCTimeout(time.Second), WithStaticPeers(self))
+	p := svr.NewJumpPicker(nil, self, "127.0.0.1:9502", "127.0.0.1:9503")
+	defer p.Close()
+	// 客户端与哈希环的客户端使用相同的配置
+	for addr, c := range p.clients {
+		want := svr.newClient(addr)
+		if c.baseURL != "jump/"+addr || c.baseURL != want.baseURL || c.timeout != time.Second || c.self != self || len(c.pool) != len(want.pool) {
+			t.Fatalf("jump client for %s = %+v, want %+v", addr, c, want)
+		}
+	}
+	local := 0
+	for i := 0; i < 3000; i++ {
+		if _, remote := p.PickPeer(fmt.Sprint(i)); !remote {
+			local++
+		}
+	}
+	if local < 800 || local > 1200 {
+		t.Fatalf("self should own about a third of the keys, got %d", local)
+	}
+	peers, isLocal := p.PickPeers("key", 3)
+	if !isLocal || len(peers) != 2 {
+		t.Fatalf("expect self and 2 remote replicas, got %d %v", len(peers), isLocal)
+	}
+}
+
+func TestSubscribeRing(t *testing.T) {
+	const self, other = "127.0.0.1:9601", "127.0.0.1:9602"
+	g := NewGroup("ringwatch", 2<<20, "lru", GetterFunc(
+		func(key string) ([]byte, error) { return []byte(key), nil }))
+	for i := 0; i < 50; i++ {
+		g.populateCache(fmt.Sprintf("key-%d", i), ByteView{b: []byte("v")}, 0)
+	}
+	svr, _ := NewServer(self)
+	svr.Set(self)
+	changes, cancel := svr.SubscribeRing()
+	defer cancel()
+
+	svr.Set(self) // 节点集合没有变化，不通知
+	svr.Set(other)
+	c := <-changes
+	if c.Version != 2 || len(c.Added) != 1 || c.Added[0] != other || len(c.Removed) != 0 {
+		t.Fatalf("unexpected change %+v", c)
+	}
+	if c.Sampled == 0 || len(c.Moves) == 0 {
+		t.Fatalf("expect some sampled keys to move, got %d of %d", len(c.Moves), c.Sampled)
+	}
+	for _, m := range c.Moves {
+		if m.From != self || m.To != other {
+			t.Fatalf("unexpected move %+v", m)
+		}
+	}
+
+	svr.Remove(other)
+	if c := <-changes; len(c.Removed) != 1 || c.Removed[0] != other {
+		t.Fatalf("unexpected change %+v", c)
+	}
+	select {
+	case c := <-changes:
+		t.Fatalf("unexpected extra change %+v", c)
+	default:
+	}
+}
+
+func TestMaxMsgSize(t *testing.T) {
+	NewGroup("msgsize", 2<<20, "lru", GetterFunc(
+		func(key string) ([]byte, error) { return []byte(key), nil }))
+	svr, _ := NewServer("127.0.0.1:9701", WithMaxMsgSize(1024, 0), WithMaxConcurrentStreams(8))
+	addr, stop := serveGRPC(t, svr)
+	defer stop()
+	client := directClient(addr)
+
+	if err := client.Put(&pb.PutRequest{Group: "msgsize", Key: "small", Value: make([]byte, 100)}); err != nil {
+		t.Fatal(err)
+	}
+	err := client.Put(&pb.PutRequest{Group: "msgsize", Key: "large", Value: make([]byte, 4096)})
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("expect ResourceExhausted, got %v", err)
+	}
+}
+
+func TestListenAddress(t *testing.T) {
+	for _, c := range []struct {
+		self string
+		opts []ServerOption
+		want string
+	}{
+		{"127.0.0.1:8001", nil, ":8001"},
+		{"[::1]:8001", nil, ":8001"},
+		{"cache-0.cache:8001", []ServerOption{WithListenAddr("0.0.0.0:9001")}, "0.0.0.0:9001"},
+	} {
+		svr, _ := NewServer(c.self, c.opts...)
+		if addr, err := svr.listenAddress(); err != nil || addr != c.want {
+			t.Fatalf("%s: expect %s, got %s %v", c.self, c.want, addr, err)
+		}
+	}
+	svr, _ := NewServer("8001")
+	if err := svr.Start(); err == nil {
+		t.Fatal("expect error for address without port")
+	}
+	svr, _ = NewServer("127.0.0.1:8001", WithAdvertiseAddr("203.0.113.7:8001"))
+	if svr.Self() != "203.0.113.7:8001" {
+		t.Fatalf("advertise address not applied: %s", svr.Self())
+	}
+}
+
+func TestGroupTopology(t *testing.T) {
+	const self, b, c, d = "127.0.0.1:9901", "127.0.0.1:9902", "127.0.0.1:9903", "127.0.0.1:9904"
+	g := NewGroup("topology", 2<<10, "lru", GetterFunc(
+		func(key string) ([]byte, error) { return []byte(key), nil }))
+	svr, _ := NewServer(self)
+	svr.Set(self, b)
+	svr.SetGroup("topology", c, d)
+	g.RegisterPeers(svr)
+
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprint(i)
+		peer, ok := g.pickPeer(key)
+		if addr := peer.(*Client).baseURL; !ok || (addr != "gocache/"+c && addr != "gocache/"+d) {
+			t.Fatalf("key %s of group topology should go to %s or %s, got %s", key, c, d, addr)
+		}
+	}
+	if peers := svr.GroupPeers("topology"); len(peers) != 2 || peers[0] != c {
+		t.Fatalf("unexpected group peers %v", peers)
+	}
+	if md := svr.nodeMetadata(); len(md.Groups) != 0 {
+		t.Fatalf("self is not serving the group, got %v", md.Groups)
+	}
+	svr.SetGroup("topology", self)
+	if md := svr.nodeMetadata(); len(md.Groups) != 1 || md.Groups[0] != "topology" {
+		t.Fatalf("expect metadata to list the group, got %v", md.Groups)
+	}
+
+	svr.ResetGroup("topology")
+	if peers := svr.GroupPeers("topology"); len(peers) != 2 || peers[0] != self || peers[1] != b {
+		t.Fatalf("group should fall back to the shared peers, got %v", peers)
+	}
+}
+
+func TestServerRestart(t *testing.T) {
+	NewGroup("restart", 2<<10, "lru", GetterFunc(
+		func(key string) ([]byte, error) { return []byte(key), nil }))
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := lis.Addr().String()
+	lis.Close()
+
+	const other = "127.0.0.1:9951"
+	// 预热要求无法满足，服务不会去etcd注册
+	svr, _ := NewServer(addr, WithWarmGate(1, 0))
+	svr.warm.target = 1
+	svr.Set(addr, other)
+	if st := svr.State(); st != StateCreated {
+		t.Fatalf("expect created, got %v", st)
+	}
+	for round := 0; round < 2; round++ {
+		served := make(chan error, 1)
+		go func() { served <- svr.Start() }()
+		client := directClient(addr)
+		deadline := time.Now().Add(2 * time.Second)
+		for {
+			err := client.Get(&pb.Request{Group: "restart", Key: "k"}, &pb.Response{})
+			if err == nil {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("round %d: server did not come up: %v", round, err)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		if svr.State() != StateRunning {
+			t.Fatalf("round %d: expect running, got %v", round, svr.State())
+		}
+		if _, ok := svr.clients[other]; !ok {
+			t.Fatalf("round %d: client of %s should exist", round, other)
+		}
+		svr.Stop()
+		if err := <-served; err != nil {
+			t.Fatalf("round %d: Start returned %v", round, err)
+		}
+		if svr.State() != StateStopped || len(svr.peers.Nodes()) != 2 {
+			t.Fatalf("round %d: expect stopped with the ring kept, got %v %v", round, svr.State(), svr.peers.Nodes())
+		}
+	}
+}
+
+func TestGroupRegistration(t *testing.T) {
+	const self, other = "127.0.0.1:9961", "127.0.0.1:9962"
+	NewGroup("reg-shared", 2<<10, "lru", GetterFunc(
+		func(key string) ([]byte, error) { return []byte(key), nil }))
+	NewGroup("reg-dedicated", 2<<10, "lru", GetterFunc(
+		func(key string) ([]byte, error) { return []byte(key), nil }))
+	svr, _ := NewServer(self)
+	svr.Set(self)
+	svr.SetGroup("reg-dedicated", other)
+	has := func(group string) bool {
+		for _, g := range svr.registration.Groups() {
+			if g == group {
+				return true
+			}
+		}
+		return false
+	}
+	if !has("reg-shared") || has("reg-dedicated") {
+		t.Fatalf("unexpected registered groups %v", svr.registration.Groups())
+	}
+	svr.SetGroup("reg-dedicated", self)
+	if !has("reg-dedicated") {
+		t.Fatalf("dedicated group including self should be registered, got %v", svr.registration.Groups())
+	}
+}
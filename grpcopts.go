@@ -0,0 +1,68 @@
+package gocache
+
+import (
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/keepalive"
+)
+
+// 默认的keepalive参数：空闲连接每分钟探测一次，允许对方在没有请求时每10秒发送一次探测，
+// 避免长时间空闲的节点之间的连接被中间设备断开，或者因为对方探测过于频繁被服务器以 GOAWAY 关闭
+var (
+	defaultKeepalive = keepalive.ServerParameters{
+		Time:    time.Minute,
+		Timeout: 20 * time.Second,
+	}
+	defaultKeepalivePolicy = keepalive.EnforcementPolicy{
+		MinTime:             10 * time.Second,
+		PermitWithoutStream: true,
+	}
+)
+
+// defaultGRPCOptions 创建gRPC服务器的默认参数，可以被 WithGRPCOptions 等选项覆盖
+func defaultGRPCOptions() []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.KeepaliveParams(defaultKeepalive),
+		grpc.KeepaliveEnforcementPolicy(defaultKeepalivePolicy),
+		grpc.RecvBufferPool(rpcBufferPool),
+	}
+}
+
+// WithMaxMsgSize 设置单条消息的大小上限(默认接收4MB，发送不限制)，recv、send 为0时保持默认值。
+// 超过上限的 Get 响应会由请求方改用 GetStream 分段读取。
+func WithMaxMsgSize(recv, send int) ServerOption {
+	return func(s *Server) {
+		if recv > 0 {
+			s.grpcOpts = append(s.grpcOpts, grpc.MaxRecvMsgSize(recv))
+		}
+		if send > 0 {
+			s.grpcOpts = append(s.grpcOpts, grpc.MaxSendMsgSize(send))
+		}
+	}
+}
+
+// WithKeepalive 设置服务器探测空闲连接的参数，以及允许请求方发送探测的频率
+func WithKeepalive(params keepalive.ServerParameters, policy keepalive.EnforcementPolicy) ServerOption {
+	return func(s *Server) {
+		s.grpcOpts = append(s.grpcOpts, grpc.KeepaliveParams(params), grpc.KeepaliveEnforcementPolicy(policy))
+	}
+}
+
+// WithMaxConcurrentStreams 限制每个连接上同时进行的请求数，0表示不限制
+func WithMaxConcurrentStreams(n uint32) ServerOption {
+	return func(s *Server) {
+		if n > 0 {
+			s.grpcOpts = append(s.grpcOpts, grpc.MaxConcurrentStreams(n))
+		}
+	}
+}
+
+// WithConnectionTimeout 设置新连接完成握手的超时时间，默认120秒
+func WithConnectionTimeout(d time.Duration) ServerOption {
+	return func(s *Server) {
+		if d > 0 {
+			s.grpcOpts = append(s.grpcOpts, grpc.ConnectionTimeout(d))
+		}
+	}
+}
@@ -0,0 +1,19 @@
+package gocache
+
+import (
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// groupCacheService 是 GroupCache 服务在健康检查中使用的服务名，与 proto 中的包名和服务名一致
+const groupCacheService = "geecachepb.GroupCache"
+
+// setServing 更新健康检查服务中的状态，空服务名表示整个节点，另外单独报告 GroupCache 服务的状态。
+// 节点在预热完成、注册到etcd之前以及停止之后报告 NOT_SERVING，负载均衡器据此摘除节点。
+func (s *Server) setServing(serving bool) {
+	st := healthpb.HealthCheckResponse_NOT_SERVING
+	if serving {
+		st = healthpb.HealthCheckResponse_SERVING
+	}
+	s.health.SetServingStatus("", st)
+	s.health.SetServingStatus(groupCacheService, st)
+}
@@ -0,0 +1,35 @@
+package gocache
+
+import (
+	"time"
+
+	"gocache/topk"
+)
+
+// KeyHeat 一个key在一段时间内的访问统计，次数和字节数是估计值，见 topk.Entry
+type KeyHeat = topk.Entry
+
+// heatResolution 热点key统计的时间粒度
+const heatResolution = time.Minute
+
+// WithKeyHeat 开启热点key统计：在固定的内存内记录最近window时间内各个key的读取次数和读取的字节数，
+// 通过 TopKeys 查询，用于定位热点。统计按分钟分桶，每个桶最多跟踪capacity个key(见 topk.Summary)，
+// 访问量超过该分钟总访问量 1/capacity 的key一定会被统计到。capacity 小于1时不统计。
+func WithKeyHeat(capacity int, window time.Duration) GroupOption {
+	return func(g *Group) {
+		if capacity < 1 {
+			g.heat = nil
+			return
+		}
+		g.heat = topk.NewWindow(capacity, window, heatResolution)
+	}
+}
+
+// TopKeys 返回最近last时间(按分钟向上取整，小于等于0表示 WithKeyHeat 的整个窗口)内读取最多的n个key，
+// byBytes 为true时按读取的字节数排序。本节点处理的读取都会计入，包括其他节点转发来的请求。没有开启 WithKeyHeat 时返回nil。
+func (g *Group) TopKeys(n int, last time.Duration, byBytes bool) []KeyHeat {
+	if g.heat == nil {
+		return nil
+	}
+	return g.heat.Top(n, last, byBytes)
+}
@@ -0,0 +1,37 @@
+package gocache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTopKeys(t *testing.T) {
+	g := NewGroup("heat", 2<<10, "lru", GetterFunc(func(key string) ([]byte, error) {
+		if key == "big" {
+			return make([]byte, 100), nil
+		}
+		return []byte(key), nil
+	}), WithKeyHeat(16, 5*time.Minute))
+
+	for i := 0; i < 5; i++ {
+		g.GetCacheData("hot")
+	}
+	g.GetCacheData("big")
+	g.GetCacheData("cold")
+
+	top := g.TopKeys(2, 0, false)
+	if len(top) != 2 || top[0].Key != "hot" || top[0].Count != 5 || top[0].Bytes != 15 {
+		t.Fatalf("TopKeys by count = %+v", top)
+	}
+	if top := g.TopKeys(1, 0, true); len(top) != 1 || top[0].Key != "big" || top[0].Bytes != 100 {
+		t.Fatalf("TopKeys by bytes = %+v", top)
+	}
+
+	plain := NewGroup("heat-disabled", 2<<10, "lru", GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}))
+	plain.GetCacheData("k")
+	if top := plain.TopKeys(10, 0, false); top != nil {
+		t.Errorf("TopKeys without WithKeyHeat = %+v", top)
+	}
+}
@@ -0,0 +1,108 @@
+package gocache
+
+import (
+	"context"
+	"reflect"
+	"time"
+
+	pb "gocache/gocachepb"
+)
+
+// WithHedging 开启对冲读取：向归属节点发出的请求超过delay还没有响应时(例如对方正在GC)，
+// 再向哈希环上的下一个副本节点发送同样的请求，采用先返回的成功响应。delay 通常设置为远程读取耗时的p95左右，
+// 这样只有约5%的请求会多发一次。需要注册的 PeerPicker 实现 PeersPicker，delay 小于等于0表示不对冲。
+func WithHedging(delay time.Duration) GroupOption {
+	return func(g *Group) {
+		g.hedgeDelay = delay
+	}
+}
+
+// hedgePeer 返回对冲请求的目标，没有开启对冲时返回nil
+func (g *Group) hedgePeer(key string, owner PeerGetter) PeerGetter {
+	if g.hedgeDelay <= 0 {
+		return nil
+	}
+	return g.nextReplica(key, owner)
+}
+
+// nextReplica 返回key的副本节点中归属节点之外的第一个远程节点，没有时返回nil
+func (g *Group) nextReplica(key string, owner PeerGetter) PeerGetter {
+	pp, ok := g.peers.(PeersPicker)
+	if !ok {
+		return nil
+	}
+	if s, ok := g.peers.(*Server); ok && s.hasGroupRing(g.name) {
+		return nil // PickPeers 按公共哈希环计算副本节点，不适用于单独指定了节点集合的缓存组
+	}
+	peers, _ := pp.PickPeers(key, 2)
+	for _, p := range peers {
+		if !samePeer(p, owner) {
+			return p
+		}
+	}
+	return nil
+}
+
+// samePeer 返回a和b是否是同一个节点，无法比较的类型视为不同
+func samePeer(a, b PeerGetter) bool {
+	if reflect.TypeOf(a) != reflect.TypeOf(b) || !reflect.TypeOf(a).Comparable() {
+		return false
+	}
+	return a == b
+}
+
+// peerResult 一次远程读取的结果
+type peerResult struct {
+	peer PeerGetter
+	res  *pb.Response
+	err  error
+}
+
+// getFromPeerHedged 从归属节点owner读取key，超过 hedgeDelay 还没有响应时同时向副本节点发送请求，
+// 采用先返回的成功响应；都失败时返回归属节点的错误。没有可用的副本节点时与 getFromPeer 相同。
+func (g *Group) getFromPeerHedged(ctx context.Context, owner PeerGetter, key string) (ByteView, GetInfo, error) {
+	backup := g.hedgePeer(key, owner)
+	if backup == nil {
+		return g.getFromPeer(ctx, owner, key)
+	}
+	results := make(chan peerResult, 2) // 落后的请求结束后直接丢弃结果，不会阻塞
+	fetch := func(p PeerGetter) {
+		res, err := g.requestPeer(ctx, p, key)
+		results <- peerResult{peer: p, res: res, err: err}
+	}
+	go fetch(owner)
+
+	timer := time.NewTimer(g.hedgeDelay)
+	defer timer.Stop()
+	var r peerResult
+	select {
+	case r = <-results: // 归属节点及时响应，无论成功与否都不再对冲
+		return g.acceptResult(key, r)
+	case <-timer.C:
+	}
+	g.counters.hedged.Add(1)
+	go fetch(backup)
+
+	var ownerErr error
+	for i := 0; i < 2; i++ {
+		r = <-results
+		if r.err == nil {
+			if samePeer(r.peer, backup) {
+				g.counters.hedgeWins.Add(1)
+			}
+			return g.acceptResult(key, r)
+		}
+		if samePeer(r.peer, owner) {
+			ownerErr = r.err
+		}
+	}
+	return ByteView{}, GetInfo{}, ownerErr
+}
+
+// acceptResult 处理一次远程读取的结果
+func (g *Group) acceptResult(key string, r peerResult) (ByteView, GetInfo, error) {
+	if r.err != nil {
+		return ByteView{}, GetInfo{}, r.err
+	}
+	return g.acceptPeerResponse(r.peer, key, r.res)
+}
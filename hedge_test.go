@@ -0,0 +1,65 @@
+package gocache
+
+import (
+	"testing"
+	"time"
+
+	pb "gocache/gocachepb"
+)
+
+// delayedPeer 延迟一段时间后返回以节点名称为前缀的数据
+type delayedPeer struct {
+	name  string
+	delay time.Duration
+}
+
+func (p *delayedPeer) Get(in *pb.Request, out *pb.Response) error {
+	time.Sleep(p.delay)
+	out.Value, out.Found, out.ProtocolVersion = []byte(p.name+":"+in.Key), true, protocolVersion
+	return nil
+}
+
+// replicaPicker 按固定顺序返回副本节点，第一个为归属节点
+type replicaPicker struct{ replicas []PeerGetter }
+
+func (p replicaPicker) PickPeer(key string) (PeerGetter, bool) { return p.replicas[0], true }
+
+func (p replicaPicker) PickPeers(key string, n int) ([]PeerGetter, bool) {
+	if n > len(p.replicas) {
+		n = len(p.replicas)
+	}
+	return p.replicas[:n], false
+}
+
+func TestHedging(t *testing.T) {
+	owner := &delayedPeer{name: "owner"}
+	backup := &delayedPeer{name: "backup"}
+	g := NewGroup("hedge", 2<<10, "lru", GetterFunc(func(key string) ([]byte, error) {
+		t.Fatalf("unexpected local load of %s", key)
+		return nil, nil
+	}), WithHedging(20*time.Millisecond))
+	g.RegisterPeers(replicaPicker{[]PeerGetter{owner, backup}})
+
+	// 归属节点及时响应，不对冲
+	v, err := g.GetCacheData("fast")
+	if err != nil || v.String() != "owner:fast" {
+		t.Fatalf("Get(fast) = %q, %v", v.String(), err)
+	}
+	if st := g.Stats(); st.Hedged != 0 {
+		t.Fatalf("hedged %d requests for a fast owner", st.Hedged)
+	}
+
+	// 归属节点变慢，采用副本节点先返回的响应
+	owner.delay = 300 * time.Millisecond
+	start := time.Now()
+	v, err = g.GetCacheData("slow")
+	if err != nil || v.String() != "backup:slow" {
+		t.Fatalf("Get(slow) = %q, %v", v.String(), err)
+	}
+	if d := time.Since(start); d > 200*time.Millisecond {
+		t.Fatalf("hedged Get took %v", d)
+	}
+	if st := g.Stats(); st.Hedged != 1 || st.HedgeWins != 1 {
+		t.Fatalf("hedged=%d wins=%d, want 1 and 1", st.Hedged, st.HedgeWins)
+	}
+}
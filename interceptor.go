@@ -0,0 +1,218 @@
+package gocache
+
+import (
+	"context"
+	pb "gocache/gocachepb"
+	"log"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// WithGRPCOptions 传入创建gRPC服务器时使用的参数，例如 grpc.Creds，后传入的参数覆盖默认值和先传入的参数
+func WithGRPCOptions(opts ...grpc.ServerOption) ServerOption {
+	return func(s *Server) {
+		s.grpcOpts = append(s.grpcOpts, opts...)
+	}
+}
+
+// WithUnaryInterceptors 追加一元RPC的拦截器，按传入的顺序执行，位于内置的 panic 恢复拦截器之内
+func WithUnaryInterceptors(interceptors ...grpc.UnaryServerInterceptor) ServerOption {
+	return func(s *Server) {
+		s.unary = append(s.unary, interceptors...)
+	}
+}
+
+// WithStreamInterceptors 追加流式RPC的拦截器，按传入的顺序执行，位于内置的 panic 恢复拦截器之内
+func WithStreamInterceptors(interceptors ...grpc.StreamServerInterceptor) ServerOption {
+	return func(s *Server) {
+		s.stream = append(s.stream, interceptors...)
+	}
+}
+
+// newGRPCServer 创建gRPC服务器并注册缓存服务和健康检查服务。
+// panic 恢复拦截器总是最先执行，单个请求的 panic 不会导致整个节点崩溃。
+func (s *Server) newGRPCServer() *grpc.Server {
+	unary := append([]grpc.UnaryServerInterceptor{recoveryUnary(s.logger)}, s.unary...)
+	stream := append([]grpc.StreamServerInterceptor{recoveryStream(s.logger)}, s.stream...)
+	opts := append(defaultGRPCOptions(),
+		grpc.ChainUnaryInterceptor(unary...),
+		grpc.ChainStreamInterceptor(stream...),
+	)
+	opts = append(opts, s.serverCredentials()...)
+	opts = append(opts, s.grpcOpts...)
+	grpcServer := grpc.NewServer(opts...)
+	pb.RegisterGroupCacheServer(grpcServer, s)
+	healthpb.RegisterHealthServer(grpcServer, s.health)
+	return grpcServer
+}
+
+// RecoveryUnaryInterceptor 捕获处理函数中的 panic，通过标准库的默认logger记录调用栈并返回 codes.Internal。
+// Server 内置的恢复拦截器使用 WithLogger 设置的 Logger。
+func RecoveryUnaryInterceptor() grpc.UnaryServerInterceptor {
+	return recoveryUnary(nil)
+}
+
+// RecoveryStreamInterceptor 与 RecoveryUnaryInterceptor 相同，用于流式RPC
+func RecoveryStreamInterceptor() grpc.StreamServerInterceptor {
+	return recoveryStream(nil)
+}
+
+// recoveryUnary 与 RecoveryUnaryInterceptor 相同，调用栈通过logger输出，nil表示标准库的默认logger
+func recoveryUnary(logger Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = recovered(logger, info.FullMethod, r)
+			}
+		}()
+		return handler(ctx, req)
+	}
+}
+
+// recoveryStream 与 recoveryUnary 相同，用于流式RPC
+func recoveryStream(logger Logger) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = recovered(logger, info.FullMethod, r)
+			}
+		}()
+		return handler(srv, ss)
+	}
+}
+
+// recovered 记录 panic 并转换为返回给请求方的错误
+func recovered(logger Logger, method string, r interface{}) error {
+	if logger != nil {
+		logger.Error("panic in handler", "method", method, "panic", r, "stack", string(debug.Stack()))
+	} else {
+		log.Printf("[GoCache] panic in %s: %v\n%s", method, r, debug.Stack())
+	}
+	return status.Errorf(codes.Internal, "gocache: panic in %s: %v", method, r)
+}
+
+// LoggingUnaryInterceptor 每个请求结束后输出一行日志，包含方法、请求方地址、状态码和耗时，logger 为nil时使用标准库的默认logger
+func LoggingUnaryInterceptor(logger *log.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		logRequest(logger, ctx, info.FullMethod, start, err)
+		return resp, err
+	}
+}
+
+// LoggingStreamInterceptor 与 LoggingUnaryInterceptor 相同，用于流式RPC，在流结束时输出
+func LoggingStreamInterceptor(logger *log.Logger) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		err := handler(srv, ss)
+		logRequest(logger, ss.Context(), info.FullMethod, start, err)
+		return err
+	}
+}
+
+// logRequest 以 key=value 的格式输出一个请求的结果
+func logRequest(logger *log.Logger, ctx context.Context, method string, start time.Time, err error) {
+	addr := "-"
+	if p, ok := peer.FromContext(ctx); ok {
+		addr = p.Addr.String()
+	}
+	printf := log.Printf
+	if logger != nil {
+		printf = logger.Printf
+	}
+	printf("[GoCache] method=%s peer=%s code=%s duration=%s error=%q",
+		method, addr, status.Code(err), time.Since(start), errString(err))
+}
+
+// errString 返回错误的描述，nil返回空字符串
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+// MethodStats 一个RPC方法的调用统计
+type MethodStats struct {
+	Calls        int64         `json:"calls"`
+	Errors       int64         `json:"errors"` // 返回非OK状态码的次数
+	TotalLatency time.Duration `json:"total_latency"`
+	MaxLatency   time.Duration `json:"max_latency"`
+}
+
+// MeanLatency 返回平均耗时
+func (m MethodStats) MeanLatency() time.Duration {
+	if m.Calls == 0 {
+		return 0
+	}
+	return m.TotalLatency / time.Duration(m.Calls)
+}
+
+// ServerMetrics 按RPC方法统计调用次数、错误次数和耗时，通过 UnaryInterceptor、StreamInterceptor 接入服务器
+type ServerMetrics struct {
+	mu      sync.Mutex
+	methods map[string]*MethodStats
+}
+
+// NewServerMetrics 创建一个 ServerMetrics
+func NewServerMetrics() *ServerMetrics {
+	return &ServerMetrics{methods: map[string]*MethodStats{}}
+}
+
+// UnaryInterceptor 返回统计一元RPC的拦截器
+func (m *ServerMetrics) UnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		m.observe(info.FullMethod, time.Since(start), err)
+		return resp, err
+	}
+}
+
+// StreamInterceptor 返回统计流式RPC的拦截器，耗时为整个流的持续时间
+func (m *ServerMetrics) StreamInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		err := handler(srv, ss)
+		m.observe(info.FullMethod, time.Since(start), err)
+		return err
+	}
+}
+
+// observe 记录一次调用
+func (m *ServerMetrics) observe(method string, d time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	st := m.methods[method]
+	if st == nil {
+		st = &MethodStats{}
+		m.methods[method] = st
+	}
+	st.Calls++
+	if status.Code(err) != codes.OK {
+		st.Errors++
+	}
+	st.TotalLatency += d
+	if d > st.MaxLatency {
+		st.MaxLatency = d
+	}
+}
+
+// Snapshot 返回各方法统计的副本，键为完整的方法名，例如 "/geecachepb.GroupCache/Get"
+func (m *ServerMetrics) Snapshot() map[string]MethodStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make(map[string]MethodStats, len(m.methods))
+	for method, st := range m.methods {
+		out[method] = *st
+	}
+	return out
+}
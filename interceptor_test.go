@@ -0,0 +1,49 @@
+package gocache
+
+import (
+	"bytes"
+	"context"
+	pb "gocache/gocachepb"
+	"log"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestRecoveryInterceptor(t *testing.T) {
+	info := &grpc.UnaryServerInfo{FullMethod: "/geecachepb.GroupCache/Get"}
+	_, err := RecoveryUnaryInterceptor()(context.Background(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		panic("boom")
+	})
+	if status.Code(err) != codes.Internal || !strings.Contains(err.Error(), "boom") {
+		t.Fatalf("expect Internal error, got %v", err)
+	}
+}
+
+func TestServerInterceptors(t *testing.T) {
+	NewGroup("intercept", 2<<10, "lru", GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}))
+	var buf bytes.Buffer
+	metrics := NewServerMetrics()
+	svr, _ := NewServer("127.0.0.1:9821", WithUnaryInterceptors(
+		metrics.UnaryInterceptor(), LoggingUnaryInterceptor(log.New(&buf, "", 0))))
+	addr, stop := serveGRPC(t, svr)
+	defer stop()
+	client := directClient(addr)
+
+	if err := client.Get(&pb.Request{Group: "intercept", Key: "k"}, &pb.Response{}); err != nil {
+		t.Fatal(err)
+	}
+	client.Get(&pb.Request{Group: "missing", Key: "k"}, &pb.Response{})
+	st := metrics.Snapshot()["/geecachepb.GroupCache/Get"]
+	if st.Calls != 2 || st.Errors != 1 || st.MaxLatency <= 0 || st.MeanLatency() > st.MaxLatency {
+		t.Fatalf("unexpected metrics %+v", st)
+	}
+	if !strings.Contains(buf.String(), "method=/geecachepb.GroupCache/Get") || !strings.Contains(buf.String(), "code=OK") {
+		t.Fatalf("unexpected log %q", buf.String())
+	}
+}
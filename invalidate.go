@@ -0,0 +1,166 @@
+package gocache
+
+import (
+	"context"
+	pb "gocache/gocachepb"
+	"io"
+)
+
+// Subscribe 实现了失效通知的双向流RPC：订阅方在流上发送要关注的key，
+// 被关注的key在本节点被写入(Set、Put)或删除(Delete)时，推送一条失效通知。
+// 通知基于事件总线，订阅方读取过慢时可能丢失，热点缓存的过期时间仍然是一致性的最后保障。
+func (s *Server) Subscribe(stream pb.GroupCache_SubscribeServer) error {
+	reqs := make(chan *pb.SubscribeRequest)
+	errc := make(chan error, 1)
+	go func() {
+		for {
+			req, err := stream.Recv()
+			if err != nil {
+				errc <- err
+				return
+			}
+			select {
+			case reqs <- req:
+			case <-stream.Context().Done():
+				return
+			}
+		}
+	}()
+
+	events, cancel := SubscribeEvents(EventFilter{Types: []EventType{EventSet, EventDelete}})
+	defer cancel()
+	watched := watchSet{}
+	for {
+		select {
+		case req := <-reqs:
+			watched.apply(req)
+		case e := <-events:
+			if !watched.match(e.Group, e.Key) {
+				continue
+			}
+			if err := stream.Send(&pb.Invalidation{Group: e.Group, Key: e.Key, Time: e.Time.UnixNano()}); err != nil {
+				return err
+			}
+		case err := <-errc:
+			if err == io.EOF { // 订阅方关闭了发送方向
+				return nil
+			}
+			return err
+		case <-stream.Context().Done():
+			return nil
+		}
+	}
+}
+
+// watchSet 订阅方关注的key，按缓存组分组，空字符串表示关注整个缓存组
+type watchSet map[string]map[string]bool
+
+func (w watchSet) apply(req *pb.SubscribeRequest) {
+	keys := req.Keys
+	if len(keys) == 0 {
+		keys = []string{""}
+	}
+	for _, key := range keys {
+		if req.Unwatch {
+			delete(w[req.Group], key)
+			continue
+		}
+		if w[req.Group] == nil {
+			w[req.Group] = map[string]bool{}
+		}
+		w[req.Group][key] = true
+	}
+}
+
+func (w watchSet) match(group, key string) bool {
+	return w[group][key] || w[group][""]
+}
+
+// watchStream 到一个远程节点的失效通知订阅
+type watchStream struct {
+	stream  pb.GroupCache_SubscribeClient
+	cancel  context.CancelFunc
+	release func()
+	keys    watchSet // 已经关注的key，订阅断开时这些key的副本都视为失效
+}
+
+// Watch 关注远程节点上缓存组中的key，key在该节点上被写入或删除时，从本进程同名缓存组的热点缓存中删除。
+// 第一次调用时建立订阅，订阅断开后已关注key的副本全部失效，下一次调用时重新建立订阅。
+func (c *Client) Watch(group, key string) error {
+	c.watchMu.Lock()
+	defer c.watchMu.Unlock()
+	if c.watch == nil {
+		if err := c.require(CapSubscribe); err != nil {
+			return err
+		}
+		conn, release, err := c.dial()
+		if err != nil {
+			return err
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		stream, err := pb.NewGroupCacheClient(conn).Subscribe(ctx)
+		if err != nil {
+			cancel()
+			release()
+			return err
+		}
+		c.watch = &watchStream{stream: stream, cancel: cancel, release: release, keys: watchSet{}}
+		go c.receiveInvalidations(c.watch)
+	}
+	if c.watch.keys.match(group, key) {
+		return nil
+	}
+	req := &pb.SubscribeRequest{Group: group, Keys: []string{key}}
+	if err := c.watch.stream.Send(req); err != nil {
+		return err
+	}
+	c.watch.keys.apply(req)
+	return nil
+}
+
+// receiveInvalidations 接收失效通知，直到订阅断开
+func (c *Client) receiveInvalidations(w *watchStream) {
+	for {
+		inv, err := w.stream.Recv()
+		if err != nil {
+			c.closeWatch(w)
+			return
+		}
+		invalidateHot(inv.Group, inv.Key)
+	}
+}
+
+// closeWatch 关闭订阅，订阅期间关注的key可能错过了失效通知，因此全部视为失效
+func (c *Client) closeWatch(w *watchStream) {
+	c.watchMu.Lock()
+	if c.watch != w {
+		c.watchMu.Unlock()
+		return
+	}
+	c.watch = nil
+	c.watchMu.Unlock()
+
+	w.cancel()
+	w.release()
+	for group, keys := range w.keys {
+		for key := range keys {
+			invalidateHot(group, key)
+		}
+	}
+}
+
+// invalidateHot 从本进程缓存组的热点缓存中删除key的副本
+func invalidateHot(group, key string) {
+	if g := GetGroup(group); g != nil {
+		g.hotCache.remove(key)
+	}
+}
+
+// watchHot 数据放入热点缓存后，向提供数据的节点关注该key
+func (g *Group) watchHot(peer PeerGetter, key string) {
+	if w, ok := peer.(PeerWatcher); ok {
+		if err := w.Watch(g.name, key); err != nil {
+			g.logger.Warn("watch key failed", "group", g.name, "key", key, "error", err)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package gocache
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// directClient 创建一个不经过etcd、直接连接addr的客户端
+func directClient(addr string) *Client {
+	c := NewClient("gocache/" + addr)
+	c.connect = func() (*grpc.ClientConn, func(), error) {
+		conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		if err != nil {
+			return nil, nil, err
+		}
+		return conn, func() { conn.Close() }, nil
+	}
+	return c
+}
+
+// serveGRPC 在随机端口上启动 Server 的gRPC服务，返回监听地址和停止函数
+func serveGRPC(t *testing.T, svr *Server) (string, func()) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gs := svr.newGRPCServer()
+	go gs.Serve(lis)
+	return lis.Addr().String(), gs.Stop
+}
+
+func TestInvalidationPush(t *testing.T) {
+	g := NewGroup("invalidate", 2<<10, "lru", GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}))
+	svr, _ := NewServer("127.0.0.1:9707")
+	addr, stop := serveGRPC(t, svr)
+	defer stop()
+	client := directClient(addr)
+	defer client.Close()
+
+	g.populateHotCache("k", ByteView{b: []byte("old")})
+	g.populateHotCache("other", ByteView{b: []byte("old")})
+	if err := client.Watch("invalidate", "k"); err != nil {
+		t.Fatal(err)
+	}
+	// 订阅在服务端异步生效，重复写入直到收到失效通知
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		g.Set("k", []byte("new"), 0)
+		if _, ok := g.hotCache.peek("k"); !ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("hot copy of k was not invalidated")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, ok := g.hotCache.peek("other"); !ok {
+		t.Fatal("keys that are not watched should stay")
+	}
+
+	// 订阅关闭后已关注的key全部失效
+	g.populateHotCache("k", ByteView{b: []byte("new")})
+	client.Close()
+	if _, ok := g.hotCache.peek("k"); ok {
+		t.Fatal("watched keys should be invalidated when the subscription closes")
+	}
+}
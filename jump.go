@@ -0,0 +1,67 @@
+package gocache
+
+import "gocache/consistenthash"
+
+// JumpPicker 是基于 jump consistent hash 的 PeerPicker，可以替代 Server 注册给缓存组。
+// 适用于分片编号固定、节点稳定的部署：不需要哈希环，分布完全均衡。
+// 节点列表在创建时确定，之后不会变化，拓扑变化时需要创建新的 JumpPicker 并重新注册。
+type JumpPicker struct {
+	self    string
+	jump    *consistenthash.Jump
+	clients map[string]*Client
+}
+
+// NewJumpPicker 创建一个以s为本节点的 JumpPicker，shards 按分片编号排列且应包含本节点，fn 为nil时使用 XXHash64。
+// 访问其他分片的客户端与哈希环使用的客户端相同，沿用s的命名空间、TLS、超时、重试、连接池等配置。
+// 不再使用时调用 Close 关闭这些客户端
+func (s *Server) NewJumpPicker(fn consistenthash.Hash64, shards ...string) *JumpPicker {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	p := &JumpPicker{
+		self:    s.self,
+		jump:    consistenthash.NewJump(fn, shards...),
+		clients: make(map[string]*Client, len(shards)),
+	}
+	for _, addr := range shards {
+		if _, ok := p.clients[addr]; !ok && addr != s.self {
+			p.clients[addr] = s.newClient(addr)
+		}
+	}
+	return p
+}
+
+// Close 关闭访问其他分片的客户端
+func (p *JumpPicker) Close() {
+	for _, client := range p.clients {
+		client.Close()
+	}
+}
+
+// PickPeer 返回key所属分片的客户端，属于本节点或没有节点时返回false
+func (p *JumpPicker) PickPeer(key string) (PeerGetter, bool) {
+	addr := p.jump.Get(key)
+	if addr == "" || addr == p.self {
+		return nil, false
+	}
+	return p.clients[addr], true
+}
+
+// PickPeers 返回key的n个副本分片中远程节点的客户端，local 表示本节点是否是副本节点之一
+func (p *JumpPicker) PickPeers(key string, n int) (peers []PeerGetter, local bool) {
+	for _, addr := range p.jump.GetN(key, n) {
+		if addr == p.self {
+			local = true
+			continue
+		}
+		peers = append(peers, p.clients[addr])
+	}
+	return peers, local
+}
+
+// Self 返回本节点的地址
+func (p *JumpPicker) Self() string {
+	return p.self
+}
+
+// 测试 JumpPicker 是否实现了 PeersPicker 接口
+var _ PeersPicker = (*JumpPicker)(nil)
@@ -0,0 +1,314 @@
+package gocache
+
+import (
+	"context"
+	"errors"
+	pb "gocache/gocachepb"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// 租约(lease)借鉴了 memcache 的做法，用于在缓存未命中时保护数据源：
+// 第一个未命中的调用者得到一个租约令牌，由它负责从数据源加载并回填；
+// 其他调用者等待回填完成，而不是同时去访问数据源。只有持有有效令牌的调用者才能回填，
+// key 被 Set 或 Delete 时当前的租约随之失效，持有者之后用过时的数据回填会被拒绝。
+// 租约由key的归属节点发放，其他节点上的调用通过 Lease RPC 转发给归属节点，整个集群对同一个key只有一个持有者。
+
+// LeaseToken 租约令牌，0表示没有租约
+type LeaseToken uint64
+
+var (
+	// ErrLeaseInvalid 回填时令牌不是该key当前有效的租约(已过期、已释放或被新的租约取代)
+	ErrLeaseInvalid = errors.New("gocache: lease token is invalid or expired")
+	// ErrLeaseDisabled 缓存组没有通过 WithLeases 开启租约
+	ErrLeaseDisabled = errors.New("gocache: leases are not enabled for this group")
+	// ErrLeaseNotOwner key归属其他节点，并且该节点不能转发租约请求(没有实现 PeerLeaser)
+	ErrLeaseNotOwner = errors.New("gocache: key is owned by another peer")
+)
+
+// Lease RPC 的操作，见 pb.LeaseRequest
+const (
+	leaseAcquire = "acquire"
+	leaseSet     = "set"
+	leaseRelease = "release"
+)
+
+// WithLeases 开启租约，ttl 是租约的有效期：持有者在ttl内没有回填或释放，租约自动失效，
+// 等待者中的一个会得到新的租约。
+func WithLeases(ttl time.Duration) GroupOption {
+	return func(g *Group) {
+		if ttl > 0 {
+			g.leases = newLeaseTable(ttl)
+		}
+	}
+}
+
+// leaseTable 记录每个key当前的租约
+type leaseTable struct {
+	mu     sync.Mutex
+	ttl    time.Duration
+	next   LeaseToken
+	leases map[string]*lease
+	swept  time.Time // 上一次清理过期租约的时间
+}
+
+type lease struct {
+	token  LeaseToken
+	expire time.Time
+	done   chan struct{} // 租约被回填、释放时关闭
+}
+
+func newLeaseTable(ttl time.Duration) *leaseTable {
+	return &leaseTable{ttl: ttl, leases: make(map[string]*lease)}
+}
+
+// acquire 尝试获取key的租约，已有有效租约时返回该租约，granted 为false
+func (t *leaseTable) acquire(key string) (l *lease, granted bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	if now.Sub(t.swept) >= t.ttl {
+		t.sweepLocked(now)
+	}
+	if l, ok := t.leases[key]; ok && now.Before(l.expire) {
+		return l, false
+	} else if ok { // 过期的租约，唤醒等待者后由本次调用取代
+		close(l.done)
+	}
+	t.next++
+	l = &lease{token: t.next, expire: now.Add(t.ttl), done: make(chan struct{})}
+	t.leases[key] = l
+	return l, true
+}
+
+// sweepLocked 删除过期的租约，持有者放弃了key并且之后没有人再读取时，租约不会被新的租约取代。
+// 每个ttl最多清理一次，调用时需持有 t.mu
+func (t *leaseTable) sweepLocked(now time.Time) {
+	t.swept = now
+	for key, l := range t.leases {
+		if !now.Before(l.expire) {
+			delete(t.leases, key)
+			close(l.done)
+		}
+	}
+}
+
+// invalidate 使key当前的租约失效并唤醒等待者，在持有 t.mu 时执行write(可以为nil)：
+// 持有者之后的回填返回 ErrLeaseInvalid，不会覆盖write写入的数据。t 为nil时只执行write
+func (t *leaseTable) invalidate(key string, write func()) {
+	if t == nil {
+		if write != nil {
+			write()
+		}
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if write != nil {
+		write()
+	}
+	if l, ok := t.leases[key]; ok {
+		delete(t.leases, key)
+		close(l.done)
+	}
+}
+
+// release 结束key的租约，令牌不匹配时返回false
+func (t *leaseTable) release(key string, token LeaseToken) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	l, ok := t.leases[key]
+	if !ok || l.token != token || token == 0 {
+		return false
+	}
+	delete(t.leases, key)
+	close(l.done)
+	return time.Now().Before(l.expire)
+}
+
+// GetLease 从本地缓存读取key。命中时返回数据，令牌为0；
+// 未命中时第一个调用者得到一个租约令牌，应当从数据源加载后调用 SetWithLease 回填，
+// 加载失败时调用 ReleaseLease 放弃租约。其他调用者会等待回填完成后返回数据，
+// 或者在租约失效后得到新的租约，ctx 被取消时返回 ctx.Err()。
+// 租约由key的归属节点发放，key归属其他节点时转发给归属节点，之后的 SetWithLease 和 ReleaseLease 同样转发。
+func (g *Group) GetLease(ctx context.Context, key string) (ByteView, LeaseToken, error) {
+	if g.leases == nil {
+		return ByteView{}, 0, ErrLeaseDisabled
+	}
+	if key == "" {
+		return ByteView{}, 0, errors.New("key is required")
+	}
+	peer, err := g.leaseOwner(key)
+	if err != nil {
+		return ByteView{}, 0, err
+	}
+	if peer != nil {
+		req := &pb.LeaseRequest{Group: g.name, Key: key, Op: leaseAcquire}
+		if d, ok := ctx.Deadline(); ok {
+			req.Deadline = d.UnixNano()
+		}
+		res, err := peer.Lease(ctx, req)
+		if err != nil {
+			return ByteView{}, 0, err
+		}
+		return ByteView{b: res.Value}, LeaseToken(res.Token), nil
+	}
+	return g.getLeaseLocal(ctx, key)
+}
+
+// leaseOwner 返回key的归属节点，归属本节点时返回nil
+func (g *Group) leaseOwner(key string) (PeerLeaser, error) {
+	if g.peers == nil {
+		return nil, nil
+	}
+	peer, remote := g.pickPeer(key)
+	if !remote {
+		return nil, nil
+	}
+	if l, ok := peer.(PeerLeaser); ok {
+		return l, nil
+	}
+	return nil, ErrLeaseNotOwner
+}
+
+// getLeaseLocal 在本节点上读取key或者获取租约
+func (g *Group) getLeaseLocal(ctx context.Context, key string) (ByteView, LeaseToken, error) {
+	for {
+		if v, ok := g.mainCache.get(key); ok {
+			v, err := g.decode(key, v)
+			return v, 0, err
+		}
+		l, granted := g.leases.acquire(key)
+		if granted {
+			return ByteView{}, l.token, nil
+		}
+		timer := time.NewTimer(time.Until(l.expire))
+		select {
+		case <-l.done:
+		case <-timer.C: // 持有者迟迟没有回填，重新竞争租约
+		case <-ctx.Done():
+			timer.Stop()
+			return ByteView{}, 0, ctx.Err()
+		}
+		timer.Stop()
+	}
+}
+
+// SetWithLease 使用租约令牌回填数据，令牌无效时不写入并返回 ErrLeaseInvalid
+func (g *Group) SetWithLease(key string, value []byte, ttl time.Duration, token LeaseToken) error {
+	if g.leases == nil {
+		return ErrLeaseDisabled
+	}
+	peer, err := g.leaseOwner(key)
+	if err != nil {
+		return err
+	}
+	if peer != nil {
+		_, err := peer.Lease(context.Background(), &pb.LeaseRequest{
+			Group: g.name, Key: key, Op: leaseSet, Token: uint64(token), Value: value, Ttl: int64(ttl),
+		})
+		return err
+	}
+	return g.setWithLeaseLocal(key, value, ttl, token)
+}
+
+func (g *Group) setWithLeaseLocal(key string, value []byte, ttl time.Duration, token LeaseToken) error {
+	b, err := g.encode(key, cloneBytes(value))
+	if err != nil {
+		return err
+	}
+	g.leases.mu.Lock()
+	l, ok := g.leases.leases[key]
+	valid := ok && l.token == token && token != 0 && time.Now().Before(l.expire)
+	if valid { // 持有锁写入，保证写入后等待者一定能读到
+		g.populateCache(key, ByteView{b: b}, ttl)
+		delete(g.leases.leases, key)
+		close(l.done)
+	}
+	g.leases.mu.Unlock()
+	if !valid {
+		return ErrLeaseInvalid
+	}
+	return nil
+}
+
+// ReleaseLease 放弃租约而不回填，例如数据源加载失败时，等待者中的一个会得到新的租约
+func (g *Group) ReleaseLease(key string, token LeaseToken) error {
+	if g.leases == nil {
+		return ErrLeaseDisabled
+	}
+	peer, err := g.leaseOwner(key)
+	if err != nil {
+		return err
+	}
+	if peer != nil {
+		_, err := peer.Lease(context.Background(), &pb.LeaseRequest{Group: g.name, Key: key, Op: leaseRelease, Token: uint64(token)})
+		return err
+	}
+	if !g.leases.release(key, token) {
+		return ErrLeaseInvalid
+	}
+	return nil
+}
+
+// Lease 实现了 Lease RPC，在本节点上操作租约，请求方已经按自己的哈希环选择了本节点，不再转发
+func (s *Server) Lease(ctx context.Context, in *pb.LeaseRequest) (*pb.LeaseResponse, error) {
+	if in.Key == "" {
+		return nil, errKeyRequired
+	}
+	g := GetGroup(in.Group)
+	if g == nil {
+		return nil, groupNotFound(in.Group)
+	}
+	if g.leases == nil {
+		return nil, statusError(ErrLeaseDisabled)
+	}
+	if in.Deadline != 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, time.Unix(0, in.Deadline))
+		defer cancel()
+	}
+	var err error
+	switch in.Op {
+	case leaseAcquire:
+		v, token, err := g.getLeaseLocal(ctx, in.Key)
+		if err != nil {
+			return nil, statusError(err)
+		}
+		return &pb.LeaseResponse{Value: v.b, Token: uint64(token)}, nil
+	case leaseSet:
+		err = g.setWithLeaseLocal(in.Key, in.Value, time.Duration(in.Ttl), LeaseToken(in.Token))
+	case leaseRelease:
+		if !g.leases.release(in.Key, LeaseToken(in.Token)) {
+			err = ErrLeaseInvalid
+		}
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "unknown lease op %q", in.Op)
+	}
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return &pb.LeaseResponse{}, nil
+}
+
+// Lease 在远程节点上操作租约。acquire 可能要等待其他调用者回填，只受ctx的限制，其他操作使用客户端的超时时间
+func (c *Client) Lease(ctx context.Context, in *pb.LeaseRequest) (*pb.LeaseResponse, error) {
+	if err := c.require(CapLease); err != nil {
+		return nil, err
+	}
+	conn, release, err := c.dial()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	if in.Op != leaseAcquire && c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+	res, err := pb.NewGroupCacheClient(conn).Lease(ctx, in)
+	return res, fromStatus(err)
+}
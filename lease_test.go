@@ -0,0 +1,194 @@
+package gocache
+
+import (
+	"context"
+	pb "gocache/gocachepb"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestLeaseWaitersReceiveValue(t *testing.T) {
+	getter := GetterFunc(func(key string) ([]byte, error) { return nil, nil })
+	g := NewGroup("lease-wait", 2<<10, "lru", getter, WithLeases(time.Second))
+
+	_, token, err := g.GetLease(context.Background(), "k")
+	if err != nil || token == 0 {
+		t.Fatalf("first caller should get a lease, got %v %v", token, err)
+	}
+
+	done := make(chan ByteView)
+	go func() {
+		v, tk, err := g.GetLease(context.Background(), "k")
+		if err != nil || tk != 0 {
+			t.Errorf("waiter should not get a lease, got %v %v", tk, err)
+		}
+		done <- v
+	}()
+
+	if err := g.SetWithLease("k", []byte("v"), 0, token+1); err != ErrLeaseInvalid {
+		t.Fatalf("expect ErrLeaseInvalid for wrong token, got %v", err)
+	}
+	if err := g.SetWithLease("k", []byte("v"), 0, token); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case v := <-done:
+		if v.String() != "v" {
+			t.Fatalf("waiter got %q", v.String())
+		}
+	case <-time.After(time.Second):
+		t.Fatal("waiter not woken up")
+	}
+	if err := g.SetWithLease("k", []byte("v2"), 0, token); err != ErrLeaseInvalid {
+		t.Fatalf("lease should not be reusable, got %v", err)
+	}
+}
+
+func TestLeaseReleaseAndExpire(t *testing.T) {
+	getter := GetterFunc(func(key string) ([]byte, error) { return nil, nil })
+	g := NewGroup("lease-expire", 2<<10, "lru", getter, WithLeases(50*time.Millisecond))
+
+	_, t1, _ := g.GetLease(context.Background(), "k")
+	if err := g.ReleaseLease("k", t1); err != nil {
+		t.Fatal(err)
+	}
+	_, t2, _ := g.GetLease(context.Background(), "k")
+	if t2 == 0 || t2 == t1 {
+		t.Fatalf("expect a new lease after release, got %v", t2)
+	}
+
+	// 持有者没有回填，租约过期后等待者得到新的租约
+	_, t3, err := g.GetLease(context.Background(), "k")
+	if err != nil || t3 == 0 || t3 == t2 {
+		t.Fatalf("expect a new lease after expiry, got %v %v", t3, err)
+	}
+	if err := g.SetWithLease("k", []byte("v"), 0, t2); err != ErrLeaseInvalid {
+		t.Fatalf("expired lease should be rejected, got %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, _, err := g.GetLease(ctx, "k"); err != context.DeadlineExceeded {
+		t.Fatalf("expect deadline exceeded, got %v", err)
+	}
+}
+
+func TestLeaseInvalidatedBySetAndDelete(t *testing.T) {
+	getter := GetterFunc(func(key string) ([]byte, error) { return nil, nil })
+	g := NewGroup("lease-invalidate", 2<<10, "lru", getter, WithLeases(time.Second))
+
+	_, token, _ := g.GetLease(context.Background(), "k")
+	done := make(chan ByteView)
+	go func() {
+		v, _, _ := g.GetLease(context.Background(), "k")
+		done <- v
+	}()
+	// 数据源被更新后写入新数据，持有者加载到的旧数据不能再覆盖
+	if err := g.Set("k", []byte("new"), 0); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case v := <-done:
+		if v.String() != "new" {
+			t.Fatalf("waiter got %q", v.String())
+		}
+	case <-time.After(time.Second):
+		t.Fatal("waiter not woken up by Set")
+	}
+	if err := g.SetWithLease("k", []byte("stale"), 0, token); err != ErrLeaseInvalid {
+		t.Fatalf("expect ErrLeaseInvalid after Set, got %v", err)
+	}
+	if v, _ := g.mainCache.peek("k"); v.String() != "new" {
+		t.Fatalf("stale backfill overwrote %q", v.String())
+	}
+
+	g.Delete("k")
+	_, token, _ = g.GetLease(context.Background(), "k")
+	g.Delete("k")
+	if err := g.SetWithLease("k", []byte("stale"), 0, token); err != ErrLeaseInvalid {
+		t.Fatalf("expect ErrLeaseInvalid after Delete, got %v", err)
+	}
+	if _, ok := g.mainCache.peek("k"); ok {
+		t.Fatal("stale backfill after Delete")
+	}
+}
+
+func TestLeaseSweep(t *testing.T) {
+	getter := GetterFunc(func(key string) ([]byte, error) { return nil, nil })
+	g := NewGroup("lease-sweep", 2<<10, "lru", getter, WithLeases(10*time.Millisecond))
+	for _, key := range []string{"a", "b", "c"} {
+		g.GetLease(context.Background(), key) // 持有者放弃了这些key
+	}
+	time.Sleep(20 * time.Millisecond)
+	g.GetLease(context.Background(), "d")
+	g.leases.mu.Lock()
+	n := len(g.leases.leases)
+	g.leases.mu.Unlock()
+	if n != 1 {
+		t.Fatalf("expired leases not swept, %d left", n)
+	}
+}
+
+func TestLeaseThroughOwner(t *testing.T) {
+	getter := GetterFunc(func(key string) ([]byte, error) { return nil, nil })
+	owner := NewGroup("lease-owner", 2<<10, "lru", getter, WithLeases(time.Second))
+	svr, _ := NewServer("127.0.0.1:9741")
+	g := NewGroup("lease-remote", 2<<10, "lru", getter, WithLeases(time.Second))
+	g.RegisterPeers(remotePicker{loopbackPeer{svr: svr, group: "lease-owner"}})
+
+	_, token, err := g.GetLease(context.Background(), "k")
+	if err != nil || token == 0 {
+		t.Fatalf("expect a lease from the owner, got %v %v", token, err)
+	}
+	// 归属节点上的调用者等待非归属节点上的持有者回填
+	done := make(chan ByteView)
+	go func() {
+		v, _, _ := owner.GetLease(context.Background(), "k")
+		done <- v
+	}()
+	if err := g.ReleaseLease("k", token+1); err != ErrLeaseInvalid {
+		t.Fatalf("expect ErrLeaseInvalid from the owner, got %v", err)
+	}
+	if err := g.SetWithLease("k", []byte("v"), 0, token); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case v := <-done:
+		if v.String() != "v" {
+			t.Fatalf("owner waiter got %q", v.String())
+		}
+	case <-time.After(time.Second):
+		t.Fatal("owner waiter not woken up")
+	}
+	if v, token, err := g.GetLease(context.Background(), "k"); err != nil || token != 0 || v.String() != "v" {
+		t.Fatalf("expect the value from the owner, got %q %v %v", v.String(), token, err)
+	}
+
+	// 通过gRPC转发
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	svr.setServing(true)
+	gs := svr.newGRPCServer()
+	go gs.Serve(lis)
+	defer gs.Stop()
+	c := NewClient("gocache/" + lis.Addr().String())
+	c.connect = c.directConnect
+	defer c.Close()
+	res, err := c.Lease(context.Background(), &pb.LeaseRequest{Group: "lease-owner", Key: "grpc", Op: leaseAcquire})
+	if err != nil || res.Token == 0 {
+		t.Fatalf("grpc acquire: %v %v", res, err)
+	}
+	if _, err := c.Lease(context.Background(), &pb.LeaseRequest{Group: "lease-owner", Key: "grpc", Op: leaseSet, Token: res.Token + 1}); err != ErrLeaseInvalid {
+		t.Fatalf("expect ErrLeaseInvalid over grpc, got %v", err)
+	}
+
+	// 不能转发租约请求的节点
+	old := NewGroup("lease-old-peer", 2<<10, "lru", getter, WithLeases(time.Second))
+	old.RegisterPeers(remotePicker{downPeer{}})
+	if _, _, err := old.GetLease(context.Background(), "k"); err != ErrLeaseNotOwner {
+		t.Fatalf("expect ErrLeaseNotOwner, got %v", err)
+	}
+}
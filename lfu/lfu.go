@@ -2,29 +2,35 @@ package lfu
 
 import (
 	"container/heap"
-	"log"
+	"sort"
 	"time"
+	"unsafe"
 )
 
 /*
 LFUCache 定义了一个结构体，用来实现lfu缓存淘汰算法
 maxBytes：最大存储容量
 nBytes：已占用的容量
+lowWatermark：超出最大容量时一次淘汰到的目标，0表示只淘汰到最大容量
 heap：使用一个 heap 来管理缓存项，heap 中的元素按照频率排序(heap实现了一个最小堆，即堆顶元素是最小值)
 cache：map，键是字符串，值是堆中对应节点的指针
 OnEvicted：是某条记录被移除时的回调函数，可以为 nil
+OnReplaced：是某条记录的值被同一个key的新值覆盖时的回调函数，参数为旧的值，可以为 nil
 defaultTTL：记录在缓存中的默认过期时间
 */
 
 type NowFunc func() time.Time
 
 type LFUCache struct {
-	maxBytes  int64
-	nBytes    int64
-	heap      *entryHeap
-	cache     map[string]*entry
-	OnEvicted func(key string, value Value)
-	Now       NowFunc
+	maxBytes     int64
+	nBytes       int64
+	lowWatermark int64
+	heap         *entryHeap
+	cache        map[string]*entry
+	OnEvicted    func(key string, value Value)
+	OnReplaced   func(key string, old Value)
+	Now          NowFunc
+	clock        uint64 // 逻辑时钟，每次写入或访问递增，用于频率相同时的淘汰顺序
 }
 
 type Value interface {
@@ -36,44 +42,70 @@ type entry struct {
 	value  Value
 	freq   int       // 记录访问频率
 	index  int       // 在堆中的索引，用于快速定位
+	tick   uint64    // 最近一次写入或访问时的逻辑时钟
+	seq    uint64    // 第一次写入时的逻辑时钟
 	expire time.Time //节点的过期时间
+	added  time.Time // 最近一次写入的时间
+	hits   int64     // 命中次数
 }
 
+// TieBreak 决定访问频率相同的缓存项之间的淘汰顺序
+type TieBreak int
+
+const (
+	TieBreakRecency   TieBreak = iota // 淘汰最久没有被访问的，默认策略
+	TieBreakInsertion                 // 淘汰最早写入的
+	TieBreakNone                      // 不做区分，淘汰顺序取决于堆的内部状态
+)
+
 // entryHeap 实现了 heap.Interface 接口，用于对 entry 进行堆排序,实现最小堆
-type entryHeap []*entry
+type entryHeap struct {
+	items    []*entry
+	tieBreak TieBreak
+}
 
 // Len 函数用于返回entryHeap的长度
-func (h entryHeap) Len() int {
-	return len(h)
+func (h *entryHeap) Len() int {
+	return len(h.items)
 }
 
-// Less 函数实现最小堆的排序
-func (h entryHeap) Less(i, j int) bool {
+// Less 函数实现最小堆的排序，频率相同时按 tieBreak 决定先后
+func (h *entryHeap) Less(i, j int) bool {
 	//小于号是因为我们需要一个最小堆
-	return h[i].freq < h[j].freq
+	a, b := h.items[i], h.items[j]
+	if a.freq != b.freq {
+		return a.freq < b.freq
+	}
+	switch h.tieBreak {
+	case TieBreakRecency:
+		return a.tick < b.tick
+	case TieBreakInsertion:
+		return a.seq < b.seq
+	}
+	return false
 }
 
 // Swap 函数交换缓存项，包括在堆中的索引
-func (h entryHeap) Swap(i, j int) {
-	h[i], h[j] = h[j], h[i]
-	h[i].index = i
-	h[j].index = j
+func (h *entryHeap) Swap(i, j int) {
+	h.items[i], h.items[j] = h.items[j], h.items[i]
+	h.items[i].index = i
+	h.items[j].index = j
 }
 
 // Push 函数用于插入一个缓存项
 func (h *entryHeap) Push(x interface{}) {
 	entry := x.(*entry)
-	entry.index = len(*h)
-	*h = append(*h, entry)
+	entry.index = len(h.items)
+	h.items = append(h.items, entry)
 }
 
 // Pop 函数用于删除一个缓存项
 func (h *entryHeap) Pop() interface{} {
-	old := *h
+	old := h.items
 	n := len(old)
 	entry := old[n-1]
 	entry.index = -1 // for safety
-	*h = old[0 : n-1]
+	h.items = old[0 : n-1]
 	return entry
 }
 
@@ -91,12 +123,14 @@ func New(maxBytes int64, onEvicted func(string, Value)) *LFUCache {
 // Get 函数用于根据键获取缓存中的值。如果键存在，则将对应的节点的freq频率增加、调用Fix函数维持堆的性质，并返回对应的值和 true；如果键不存在或者键已经过期，则返回零值和 false。
 func (c *LFUCache) Get(key string) (value Value, ok bool) {
 	if ele, ok := c.cache[key]; ok {
-		if ele.expire.Before(time.Now()) {
+		if !ele.expire.IsZero() && ele.expire.Before(c.Now()) { // 零值表示永不过期
 			c.removeElement(ele)
-			log.Printf("The LFUcache key—%s has expired", key)
 			return nil, false
 		}
 		ele.freq++
+		ele.hits++
+		c.clock++
+		ele.tick = c.clock
 		heap.Fix(c.heap, ele.index)
 		//Fix 方法用于在索引 index 处的元素值发生变化后重新确立堆的顺序。在索引 index 的元素值发生改变后，调用 Fix 方法可以保持堆的性质。
 		//Fix 方法的时间复杂度是 O(log n)，其中 n = h.Len() 表示堆中元素的数量。
@@ -105,6 +139,41 @@ func (c *LFUCache) Get(key string) (value Value, ok bool) {
 	return
 }
 
+// Touch 函数把key的访问频率增加n，与 Get 不同，不检查过期也不增加命中次数，用于批量补记在锁外发生的访问。
+func (c *LFUCache) Touch(key string, n int) {
+	if ele, ok := c.cache[key]; ok {
+		ele.freq += n
+		c.clock++
+		ele.tick = c.clock
+		heap.Fix(c.heap, ele.index)
+	}
+}
+
+// Peek 函数返回key对应的值及其过期时间，但不会增加访问频率。
+func (c *LFUCache) Peek(key string) (value Value, expire time.Time, ok bool) {
+	if ele, ok := c.cache[key]; ok {
+		if !ele.expire.IsZero() && ele.expire.Before(c.Now()) {
+			return nil, time.Time{}, false
+		}
+		return ele.value, ele.expire, true
+	}
+	return
+}
+
+// SetTieBreak 设置访问频率相同的缓存项之间的淘汰顺序，可以在任何时候调用
+func (c *LFUCache) SetTieBreak(t TieBreak) {
+	c.heap.tieBreak = t
+	heap.Init(c.heap)
+}
+
+// Stat 函数返回key最近一次写入的时间和命中次数，不会增加访问频率。
+func (c *LFUCache) Stat(key string) (added time.Time, hits int64, ok bool) {
+	if ele, ok := c.cache[key]; ok {
+		return ele.added, ele.hits, true
+	}
+	return
+}
+
 // RemoveOldest 函数删除频率最低的缓存项。
 func (c *LFUCache) RemoveOldest() {
 	entry := heap.Pop(c.heap).(*entry)
@@ -117,33 +186,129 @@ func (c *LFUCache) RemoveOldest() {
 
 // Add 函数用于插入一个缓存项。
 func (c *LFUCache) Add(key string, value Value, expire time.Time) {
+	c.clock++
 	if ele, ok := c.cache[key]; ok {
 		ele.freq++
+		ele.tick = c.clock
+		c.nBytes += int64(value.Len()) - int64(ele.value.Len()) // 更新大小
+		old := ele.value
 		ele.value = value
 		ele.expire = expire
+		ele.added = c.Now()
 		heap.Fix(c.heap, ele.index)
+		if c.OnReplaced != nil {
+			c.OnReplaced(key, old)
+		}
 	} else {
 		entry := &entry{
 			key:    key,
 			value:  value,
 			freq:   1,
 			expire: expire,
+			added:  c.Now(),
+			tick:   c.clock,
+			seq:    c.clock,
 		}
 		heap.Push(c.heap, entry)
 		c.cache[key] = entry
 		c.nBytes += int64(len(key)) + int64(value.Len())
 	}
 
+	if c.maxBytes != 0 && c.maxBytes < c.nBytes { // 一次淘汰到低水位
+		for target := c.evictTarget(); target < c.nBytes; {
+			c.RemoveOldest()
+		}
+	}
+}
+
+// SetLowWatermark 设置淘汰的低水位：写入使占用超过最大容量时一次淘汰到n字节以下，之后的多次写入不需要淘汰，
+// 把逐条的淘汰合并为一批。0或者不小于最大容量时只淘汰到最大容量
+func (c *LFUCache) SetLowWatermark(n int64) {
+	c.lowWatermark = n
+}
+
+// evictTarget 返回写入超出最大容量时淘汰的目标
+func (c *LFUCache) evictTarget() int64 {
+	if c.lowWatermark > 0 && c.lowWatermark < c.maxBytes {
+		return c.lowWatermark
+	}
+	return c.maxBytes
+}
+
+// Resize 方法修改最大容量，0表示不限制。新容量小于已占用的容量时立即淘汰访问频率最低的缓存项。
+func (c *LFUCache) Resize(maxBytes int64) {
+	c.maxBytes = maxBytes
 	for c.maxBytes != 0 && c.maxBytes < c.nBytes {
 		c.RemoveOldest()
 	}
 }
 
+// Bytes 方法返回已占用的容量。
+func (c *LFUCache) Bytes() int64 {
+	return c.nBytes
+}
+
+// Overhead 方法返回数据结构本身占用的内存估计，不包括key和value的数据：每条记录的 entry、堆中的指针(按容量计算)
+// 以及 map 中的槽位。Bytes 只计算key和value，较小的记录实际占用的内存可能是它的数倍。
+func (c *LFUCache) Overhead() int64 {
+	return int64(len(c.cache))*entryOverhead + int64(cap(c.heap.items))*int64(unsafe.Sizeof(&entry{}))
+}
+
+// entryOverhead 每条记录的结构开销，map 的槽位按平均装载因子约2/3折算
+var entryOverhead = allocSize(unsafe.Sizeof(entry{})) + int64(unsafe.Sizeof("")+unsafe.Sizeof(&entry{})+1)*3/2
+
+// allocSize 返回分配n字节的对象实际占用的内存，256字节以内按内存分配器的大小等级向上取整
+func allocSize(n uintptr) int64 {
+	switch {
+	case n <= 8:
+		return 8
+	case n <= 32:
+		return int64(n+7) &^ 7
+	case n <= 256:
+		return int64(n+15) &^ 15
+	}
+	return int64(n)
+}
+
 // Len 方法返回当前缓存中的记录数量。
 func (c *LFUCache) Len() int {
 	return len(c.cache)
 }
 
+// Keys 方法返回当前缓存中所有的key，按访问频率从高到低排列，频率相同时按淘汰策略从晚到早排列。
+func (c *LFUCache) Keys() []string {
+	entries := make([]*entry, 0, len(c.cache))
+	for _, e := range c.cache {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.freq != b.freq {
+			return a.freq > b.freq
+		}
+		// 与淘汰顺序相反：越晚被淘汰的越靠前
+		switch c.heap.tieBreak {
+		case TieBreakRecency:
+			return a.tick > b.tick
+		case TieBreakInsertion:
+			return a.seq > b.seq
+		}
+		return a.key < b.key
+	})
+	keys := make([]string, len(entries))
+	for i, e := range entries {
+		keys[i] = e.key
+	}
+	return keys
+}
+
+// Remove 方法删除指定的key。
+func (c *LFUCache) Remove(key string) {
+	if e, ok := c.cache[key]; ok {
+		c.removeElement(e)
+	}
+}
+
 // removeElement 函数删除传入的缓存项。
 func (c *LFUCache) removeElement(e *entry) {
 	heap.Remove(c.heap, e.index)
@@ -2,7 +2,9 @@ package lfu
 
 import (
 	"reflect"
+	"strconv"
 	"testing"
+	"time"
 )
 
 type String string
@@ -12,11 +14,11 @@ func (d String) Len() int {
 }
 
 func TestGet(t *testing.T) {
-	lfu := New(int64(0), nil, 60)
+	lfu := New(int64(0), nil)
 	//在这个特定的上下文中，int64(0) 作为参数传递给 New 函数，用于指定 LRU 缓存的最大存储容量。
 	//在这里，将其设置为 0 表示缓存的最大容量为零，即没有存储空间，因此不会保存任何键值对。
 	//这可以用于创建一个非常小的缓存或用于特定的测试场景，其中不需要实际存储数据。
-	lfu.Add("key1", String("1234"), 60)
+	lfu.Add("key1", String("1234"), time.Time{})
 	if v, ok := lfu.Get("key1"); !ok || string(v.(String)) != "1234" {
 		t.Fatalf("cache hit key1=1234 failed")
 	}
@@ -29,10 +31,10 @@ func TestRemoveoldest(t *testing.T) {
 	k1, k2, k3 := "key1", "key2", "k3"
 	v1, v2, v3 := "value1", "value2", "v3"
 	Cap := len(k1 + k2 + v1 + v2)
-	lfu := New(int64(Cap), nil, 60)
-	lfu.Add(k1, String(v1), 60)
-	lfu.Add(k2, String(v2), 60)
-	lfu.Add(k3, String(v3), 60)
+	lfu := New(int64(Cap), nil)
+	lfu.Add(k1, String(v1), time.Time{})
+	lfu.Add(k2, String(v2), time.Time{})
+	lfu.Add(k3, String(v3), time.Time{})
 
 	if _, ok := lfu.Get("key1"); ok || lfu.Len() != 2 {
 		t.Fatalf("Removeoldest key1 failed")
@@ -44,11 +46,11 @@ func TestOnEvicted(t *testing.T) {
 	callback := func(key string, value Value) {
 		keys = append(keys, key)
 	}
-	lfu := New(int64(10), callback, 60)
-	lfu.Add("key1", String("123456"), 60)
-	lfu.Add("k2", String("k2"), 60)
-	lfu.Add("k3", String("k3"), 60)
-	lfu.Add("k4", String("k4"), 60)
+	lfu := New(int64(10), callback)
+	lfu.Add("key1", String("123456"), time.Time{})
+	lfu.Add("k2", String("k2"), time.Time{})
+	lfu.Add("k3", String("k3"), time.Time{})
+	lfu.Add("k4", String("k4"), time.Time{})
 	expect := []string{"key1", "k2"}
 	if !reflect.DeepEqual(expect, keys) {
 		t.Fatalf("Call onEvicted failed,expect keys equals to %s", expect)
@@ -56,11 +58,101 @@ func TestOnEvicted(t *testing.T) {
 }
 
 func TestAdd(t *testing.T) {
-	lfu := New(int64(0), nil, 60)
-	lfu.Add("key", String("1"), 60)
-	lfu.Add("key", String("111"), 60)
+	lfu := New(int64(0), nil)
+	lfu.Add("key", String("1"), time.Time{})
+	lfu.Add("key", String("111"), time.Time{})
 
 	if lfu.nBytes != int64(len("key")+len("111")) {
 		t.Fatal("expected 6 but got", lfu.nBytes)
 	}
 }
+
+func TestKeysAndRemove(t *testing.T) {
+	lfu := New(int64(0), nil)
+	lfu.Add("cold", String("1"), time.Time{})
+	lfu.Add("hot", String("2"), time.Time{})
+	lfu.Get("hot")
+
+	if keys := lfu.Keys(); !reflect.DeepEqual(keys, []string{"hot", "cold"}) {
+		t.Fatalf("expect keys ordered by frequency, got %v", keys)
+	}
+	lfu.Remove("hot")
+	if _, ok := lfu.Get("hot"); ok || lfu.Len() != 1 || lfu.nBytes != int64(len("cold")+1) {
+		t.Fatalf("Remove hot failed")
+	}
+}
+
+func TestTieBreak(t *testing.T) {
+	cases := []struct {
+		tieBreak TieBreak
+		evicted  string
+	}{
+		{TieBreakRecency, "k2"},   // k2 最久没有被访问
+		{TieBreakInsertion, "k1"}, // k1 最早写入
+	}
+	for _, tc := range cases {
+		var evicted []string
+		lfu := New(int64(0), func(key string, value Value) { evicted = append(evicted, key) })
+		lfu.SetTieBreak(tc.tieBreak)
+		lfu.Add("k1", String("1"), time.Time{})
+		lfu.Add("k2", String("2"), time.Time{})
+		lfu.Get("k2")
+		lfu.Get("k1") // 两个key的频率都是2
+		lfu.RemoveOldest()
+		if !reflect.DeepEqual(evicted, []string{tc.evicted}) {
+			t.Fatalf("tie break %d: expect %s to be evicted, got %v", tc.tieBreak, tc.evicted, evicted)
+		}
+	}
+}
+
+func TestResize(t *testing.T) {
+	lfu := New(int64(0), nil)
+	lfu.Add("k1", String("v1"), time.Time{})
+	lfu.Add("k2", String("v2"), time.Time{})
+	lfu.Get("k1")
+	lfu.Resize(4)
+	if _, ok := lfu.Get("k2"); ok || lfu.Len() != 1 || lfu.Bytes() != 4 {
+		t.Fatalf("Resize kept %d entries (%d bytes), want only k1", lfu.Len(), lfu.Bytes())
+	}
+}
+
+func TestTouch(t *testing.T) {
+	lfu := New(int64(0), nil)
+	lfu.Add("k1", String("1"), time.Time{})
+	lfu.Add("k2", String("2"), time.Time{})
+	lfu.Touch("k1", 2)
+	lfu.Touch("missing", 1)
+	lfu.Get("k2")
+	lfu.RemoveOldest()
+	if _, ok := lfu.Get("k2"); ok {
+		t.Fatalf("k2 should be evicted after k1 was touched")
+	}
+	if _, hits, _ := lfu.Stat("k1"); hits != 0 {
+		t.Fatalf("touch counted %d hits", hits)
+	}
+}
+
+func TestLowWatermark(t *testing.T) {
+	evicted := 0
+	lfu := New(int64(30), func(string, Value) { evicted++ })
+	lfu.SetLowWatermark(15)
+	for i := 0; i < 10; i++ {
+		lfu.Add("k"+strconv.Itoa(i), String("v"), time.Time{})
+	}
+	lfu.Get("k0")
+	if evicted != 0 || lfu.Bytes() != 30 {
+		t.Fatalf("evicted %d before reaching capacity, bytes %d", evicted, lfu.Bytes())
+	}
+	// 超出容量时一次淘汰到低水位，之后的写入不需要淘汰
+	lfu.Add("k10", String("v"), time.Time{})
+	if lfu.Bytes() > 15 || evicted != 7 {
+		t.Fatalf("bytes = %d after %d evictions, want <= 15", lfu.Bytes(), evicted)
+	}
+	if _, ok := lfu.Get("k0"); !ok {
+		t.Fatal("most frequently used key was evicted")
+	}
+	lfu.Add("k11", String("v"), time.Time{})
+	if evicted != 7 {
+		t.Fatalf("evicted %d below capacity", evicted)
+	}
+}
@@ -0,0 +1,55 @@
+package gocache
+
+import "gocache/consistenthash"
+
+// ServerState 表示 Server 的生命周期状态：created -> running -> stopped -> running ...
+type ServerState int
+
+const (
+	StateCreated ServerState = iota // 已经创建，还没有启动
+	StateRunning                    // 正在运行，Start 之后
+	StateStopped                    // 已经停止，Stop 或 GracefulStop 之后，可以再次 Start
+)
+
+func (st ServerState) String() string {
+	switch st {
+	case StateCreated:
+		return "created"
+	case StateRunning:
+		return "running"
+	case StateStopped:
+		return "stopped"
+	default:
+		return "unknown"
+	}
+}
+
+// State 返回服务器当前的生命周期状态
+func (s *Server) State() ServerState {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.state
+}
+
+// closeClients 关闭所有客户端，哈希环保持不变，重新启动时由 reconnect 重新创建客户端。调用者需要持有 s.mu
+func (s *Server) closeClients() {
+	for _, client := range s.clients {
+		client.Close()
+	}
+	s.clients = map[string]*Client{} // 清空客户端 有助于垃圾回收
+}
+
+// reconnect 为哈希环(包括缓存组单独的哈希环)中除本节点以外的节点创建客户端，调用者需要持有 s.mu
+func (s *Server) reconnect() {
+	rings := []*consistenthash.Map{s.peers}
+	for _, ring := range s.groupRings {
+		rings = append(rings, ring)
+	}
+	for _, ring := range rings {
+		for _, addr := range ring.Nodes() {
+			if _, ok := s.clients[addr]; !ok && addr != s.self {
+				s.clients[addr] = s.newClient(addr)
+			}
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package gocache
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+)
+
+// defaultMaxWaiting 排队等待的加载数量的默认上限，见 LoadLimiter.SetMaxWaiting
+const defaultMaxWaiting = 1024
+
+// ErrTooManyLoads 当数据源加载的并发数达到上限且限流器不排队时返回
+var ErrTooManyLoads = errors.New("gocache: too many concurrent loads")
+
+// LoadLimiter 是一个带权重的信号量，用于限制同时执行的数据源加载(getter)数量。
+// 同一个 LoadLimiter 可以被多个缓存组共享，从而限制整个进程对数据源的并发访问；
+// 每个缓存组按自己的权重占用容量，例如加载代价更高的缓存组可以设置更大的权重。
+// 相同key的并发加载已经由 singleflight 合并，这里限制的是不同key的加载。
+type LoadLimiter struct {
+	capacity int64
+	wait     bool // 达到上限时排队等待(true)还是立即拒绝(false)
+
+	mu         sync.Mutex
+	cur        int64     // 已占用的容量
+	waiters    list.List // 排队等待的加载，先进先出，元素为 *limiterWaiter
+	maxWaiting int       // 排队等待的加载数量上限，排满后新的加载立即拒绝
+
+	rejected AtomicInt // 被拒绝的加载次数
+}
+
+type limiterWaiter struct {
+	n     int64
+	ready chan struct{}
+}
+
+// NewLoadLimiter 创建一个容量为capacity的加载限流器。
+// wait 为 true 时超出容量的加载会排队等待，否则立即返回 ErrTooManyLoads；
+// 排队的加载数量默认最多1024个，排满后同样返回 ErrTooManyLoads，见 SetMaxWaiting。
+func NewLoadLimiter(capacity int64, wait bool) *LoadLimiter {
+	return &LoadLimiter{capacity: capacity, wait: wait, maxWaiting: defaultMaxWaiting}
+}
+
+// SetMaxWaiting 修改排队等待的加载数量上限，n 小于1时恢复默认值1024。已经在排队的加载不受影响
+func (l *LoadLimiter) SetMaxWaiting(n int) {
+	if n < 1 {
+		n = defaultMaxWaiting
+	}
+	l.mu.Lock()
+	l.maxWaiting = n
+	l.mu.Unlock()
+}
+
+// acquire 占用n个单位的容量。排队时ctx被取消则离开队列，返回ctx的错误
+func (l *LoadLimiter) acquire(ctx context.Context, n int64) error {
+	l.mu.Lock()
+	if n > l.capacity { // 永远无法满足的请求
+		l.mu.Unlock()
+		l.rejected.Add(1)
+		return ErrTooManyLoads
+	}
+	// 有排队者时也要排队，保证先来先服务，避免大权重的加载被饿死
+	if l.capacity-l.cur >= n && l.waiters.Len() == 0 {
+		l.cur += n
+		l.mu.Unlock()
+		return nil
+	}
+	if !l.wait || l.waiters.Len() >= l.maxWaiting {
+		l.mu.Unlock()
+		l.rejected.Add(1)
+		return ErrTooManyLoads
+	}
+	w := &limiterWaiter{n: n, ready: make(chan struct{})}
+	e := l.waiters.PushBack(w)
+	l.mu.Unlock()
+	select {
+	case <-w.ready: // release 在分配容量后关闭ready
+		return nil
+	case <-ctx.Done():
+	}
+	l.mu.Lock()
+	select {
+	case <-w.ready: // 取消的同时已经分配了容量，归还
+		l.cur -= n
+	default:
+		l.waiters.Remove(e)
+	}
+	l.wakeLocked() // 离开的可能是队首，后面的排队者也许已经可以满足
+	l.mu.Unlock()
+	return ctx.Err()
+}
+
+// release 释放n个单位的容量，并按顺序唤醒能够满足的排队者
+func (l *LoadLimiter) release(n int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.cur -= n
+	l.wakeLocked()
+}
+
+// wakeLocked 按顺序为能够满足的排队者分配容量并唤醒，调用时需持有 l.mu
+func (l *LoadLimiter) wakeLocked() {
+	for {
+		front := l.waiters.Front()
+		if front == nil {
+			return
+		}
+		w := front.Value.(*limiterWaiter)
+		if l.capacity-l.cur < w.n {
+			return
+		}
+		l.cur += w.n
+		l.waiters.Remove(front)
+		close(w.ready)
+	}
+}
+
+// InFlight 返回当前已占用的容量
+func (l *LoadLimiter) InFlight() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.cur
+}
+
+// Waiting 返回当前排队等待的加载数量
+func (l *LoadLimiter) Waiting() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.waiters.Len()
+}
+
+// Rejected 返回被拒绝的加载次数
+func (l *LoadLimiter) Rejected() int64 {
+	return l.rejected.Get()
+}
@@ -0,0 +1,122 @@
+package gocache
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLoadLimiterReject(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	g := NewGroup("limiter-reject", 2<<10, "lru", GetterFunc(
+		func(key string) ([]byte, error) {
+			if key == "slow" {
+				close(started)
+				<-release
+			}
+			return []byte(key), nil
+		}), WithLoadLimiter(NewLoadLimiter(1, false), 1))
+
+	done := make(chan error)
+	go func() {
+		_, err := g.GetCacheData("slow")
+		done <- err
+	}()
+	<-started
+
+	if _, err := g.GetCacheData("other"); err != ErrTooManyLoads {
+		t.Fatalf("expect ErrTooManyLoads, got %v", err)
+	}
+	if g.limiter.Rejected() != 1 {
+		t.Fatalf("expect 1 rejected load, got %d", g.limiter.Rejected())
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := g.GetCacheData("other"); err != nil {
+		t.Fatalf("load should succeed once capacity is free, got %v", err)
+	}
+}
+
+func TestLoadLimiterQueue(t *testing.T) {
+	const limit = 2
+	var cur, peak int32
+	// 两个缓存组共享同一个限流器
+	limiter := NewLoadLimiter(limit, true)
+	getter := GetterFunc(func(key string) ([]byte, error) {
+		n := atomic.AddInt32(&cur, 1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		atomic.AddInt32(&cur, -1)
+		return []byte(key), nil
+	})
+	g1 := NewGroup("limiter-queue-1", 2<<10, "lru", getter, WithLoadLimiter(limiter, 1))
+	g2 := NewGroup("limiter-queue-2", 2<<10, "lru", getter, WithLoadLimiter(limiter, 1))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		for _, g := range []*Group{g1, g2} {
+			wg.Add(1)
+			go func(g *Group, key string) {
+				defer wg.Done()
+				if _, err := g.GetCacheData(key); err != nil {
+					t.Error(err)
+				}
+			}(g, fmt.Sprintf("key-%d", i))
+		}
+	}
+	wg.Wait()
+
+	if peak > limit {
+		t.Fatalf("concurrent loads %d exceed limit %d", peak, limit)
+	}
+	if limiter.InFlight() != 0 || limiter.Waiting() != 0 {
+		t.Fatalf("limiter should be idle, in flight %d waiting %d", limiter.InFlight(), limiter.Waiting())
+	}
+}
+
+func TestLoadLimiterCancelAndBound(t *testing.T) {
+	l := NewLoadLimiter(2, true)
+	l.SetMaxWaiting(2)
+	if err := l.acquire(context.Background(), 2); err != nil {
+		t.Fatal(err)
+	}
+
+	// 排队时取消，离开队列
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error)
+	go func() { errc <- l.acquire(ctx, 2) }()
+	for l.Waiting() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	// 队首的大权重加载离开后，后面的小权重加载不再被它挡住
+	small := make(chan error)
+	go func() { small <- l.acquire(context.Background(), 1) }()
+	for l.Waiting() != 2 {
+		time.Sleep(time.Millisecond)
+	}
+	if err := l.acquire(context.Background(), 1); err != ErrTooManyLoads {
+		t.Fatalf("expect the full queue to reject, got %v", err)
+	}
+	l.release(1) // 空出的容量不够队首
+	cancel()
+	if err := <-errc; err != context.Canceled {
+		t.Fatalf("acquire after cancel = %v", err)
+	}
+	if err := <-small; err != nil {
+		t.Fatal(err)
+	}
+	if l.Waiting() != 0 || l.InFlight() != 2 {
+		t.Fatalf("waiting %d in flight %d", l.Waiting(), l.InFlight())
+	}
+}
@@ -0,0 +1,29 @@
+package gocache
+
+import "gocache/logging"
+
+// Logger 分级的结构化日志，*slog.Logger 直接实现了该接口，见 logging.Logger。
+// 默认不输出任何日志，通过 WithLogger、WithGroupLogger 注入。
+type Logger = logging.Logger
+
+// WithLogger 设置节点输出日志使用的 Logger：节点状态变化(注册、发现节点、健康检查)为Info，
+// 可以自动恢复的失败为Warn，逐个请求的细节为Debug。同时用于到其他节点的客户端和内置的etcd注册；
+// 使用 WithRegistry 时注册中心的日志由其自身的 Logger 字段设置。nil表示不输出(默认)。
+func WithLogger(l Logger) ServerOption {
+	return func(s *Server) {
+		s.logger = logging.OrNop(l)
+	}
+}
+
+// WithGroupLogger 设置缓存组输出日志使用的 Logger，例如命中缓存、从远程节点读取失败，nil表示不输出(默认)
+func WithGroupLogger(l Logger) GroupOption {
+	return func(g *Group) {
+		g.logger = logging.OrNop(l)
+	}
+}
+
+// SetLogger 设置客户端输出日志使用的 Logger，nil表示不输出(默认)，需要在发送请求之前调用。
+// 由 Server 创建的客户端使用 WithLogger 设置的 Logger。
+func (c *Client) SetLogger(l Logger) {
+	c.logger = logging.OrNop(l)
+}
@@ -0,0 +1,68 @@
+package gocache
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"google.golang.org/grpc"
+)
+
+// recordLogger 记录输出的日志
+type recordLogger struct {
+	mu      sync.Mutex
+	entries []string
+}
+
+func (l *recordLogger) add(level, msg string) {
+	l.mu.Lock()
+	l.entries = append(l.entries, level+" "+msg)
+	l.mu.Unlock()
+}
+
+func (l *recordLogger) Debug(msg string, args ...interface{}) { l.add("DEBUG", msg) }
+func (l *recordLogger) Info(msg string, args ...interface{})  { l.add("INFO", msg) }
+func (l *recordLogger) Warn(msg string, args ...interface{})  { l.add("WARN", msg) }
+func (l *recordLogger) Error(msg string, args ...interface{}) { l.add("ERROR", msg) }
+
+func (l *recordLogger) has(entry string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, e := range l.entries {
+		if e == entry {
+			return true
+		}
+	}
+	return false
+}
+
+func TestGroupLogger(t *testing.T) {
+	logger := &recordLogger{}
+	g := NewGroup("logger", 2<<10, "lru", GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}), WithGroupLogger(logger))
+	g.GetCacheData("k")
+	g.GetCacheData("k")
+	if !logger.has("DEBUG cache hit") {
+		t.Errorf("entries = %v, want a cache hit", logger.entries)
+	}
+
+	// 没有设置 Logger 的缓存组不输出日志，也不会因为nil而panic
+	quiet := NewGroup("logger-quiet", 2<<10, "lru", GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}), WithGroupLogger(nil))
+	quiet.GetCacheData("k")
+	quiet.GetCacheData("k")
+}
+
+func TestServerLoggerRecoversPanic(t *testing.T) {
+	logger := &recordLogger{}
+	svr, _ := NewServer("127.0.0.1:9709", WithLogger(logger))
+	info := &grpc.UnaryServerInfo{FullMethod: "/geecachepb.GroupCache/Get"}
+	_, err := recoveryUnary(svr.logger)(context.Background(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		panic("boom")
+	})
+	if err == nil || !logger.has("ERROR panic in handler") {
+		t.Errorf("err = %v, entries = %v", err, logger.entries)
+	}
+}
@@ -0,0 +1,36 @@
+// Package logging 定义gocache各模块使用的结构化日志接口。各模块默认不输出日志，需要时通过选项注入 Logger，
+// 标准库的 *slog.Logger 直接实现了该接口：
+//
+//	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelInfo}))
+//	svr, _ := gocache.NewServer(addr, gocache.WithLogger(logger))
+package logging
+
+// Logger 分级的结构化日志，args 为交替出现的键和值，与 slog.Logger 的同名方法相同
+type Logger interface {
+	// Debug 逐个请求的细节，例如命中缓存、选择的节点
+	Debug(msg string, args ...interface{})
+	// Info 节点和集群状态的变化，例如注册成功、发现新节点
+	Info(msg string, args ...interface{})
+	// Warn 可以自动恢复的失败，例如注册中断后重试、访问远程节点失败后从本地加载
+	Warn(msg string, args ...interface{})
+	// Error 需要处理的错误，例如处理请求时发生panic
+	Error(msg string, args ...interface{})
+}
+
+// Nop 丢弃所有日志的 Logger，是各模块的默认值
+var Nop Logger = nop{}
+
+type nop struct{}
+
+func (nop) Debug(string, ...interface{}) {}
+func (nop) Info(string, ...interface{})  {}
+func (nop) Warn(string, ...interface{})  {}
+func (nop) Error(string, ...interface{}) {}
+
+// OrNop 返回l，l为nil时返回 Nop
+func OrNop(l Logger) Logger {
+	if l == nil {
+		return Nop
+	}
+	return l
+}
@@ -0,0 +1,26 @@
+package logging
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestSlogImplementsLogger(t *testing.T) {
+	var buf bytes.Buffer
+	var l Logger = slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelInfo}))
+	l.Debug("hidden")
+	l.Info("peers discovered", "self", "a:1", "peers", []string{"b:1"})
+	out := buf.String()
+	if strings.Contains(out, "hidden") || !strings.Contains(out, "self=a:1") {
+		t.Errorf("output = %q", out)
+	}
+}
+
+func TestOrNop(t *testing.T) {
+	if OrNop(nil) != Nop {
+		t.Error("OrNop(nil) is not Nop")
+	}
+	OrNop(nil).Error("dropped", "k", 1)
+}
@@ -3,15 +3,18 @@ package lru
 import (
 	"container/list"
 	"time"
+	"unsafe"
 )
 
 /*
 LRUCache 定义了一个结构体，用来实现lru缓存淘汰算法
 maxBytes：最大存储容量
 nBytes：已占用的容量
+lowWatermark：超出最大容量时一次淘汰到的目标，0表示只淘汰到最大容量
 ll：直接使用 Go 语言标准库实现的双向链表list.List，双向链表常用于维护缓存中各个数据的访问顺序，以便在淘汰数据时能够方便地找到最近最少使用的数据。
 cache：map,键是字符串，值是双向链表中对应节点的指针
 OnEvicted：是某条记录被移除时的回调函数，可以为 nil
+OnReplaced：是某条记录的值被同一个key的新值覆盖时的回调函数，参数为旧的值，可以为 nil
 Now：用于计算过期值的当前时间,默认为 time.Now()
 */
 
@@ -19,12 +22,14 @@ type NowFunc func() time.Time
 
 // LRUCache is a LRU cache. It is not safe for concurrent access.
 type LRUCache struct {
-	maxCapacity int64
-	curCapacity int64
-	ll          *list.List
-	cache       map[string]*list.Element
-	OnEvicted   func(key string, value Value)
-	Now         NowFunc
+	maxCapacity  int64
+	curCapacity  int64
+	lowWatermark int64
+	ll           *list.List
+	cache        map[string]*list.Element
+	OnEvicted    func(key string, value Value)
+	OnReplaced   func(key string, old Value)
+	Now          NowFunc
 }
 
 // 缓存中存储的数据类型,仍然保存key的好处是在删除队首节点时方便，这里的key就是cache里的key
@@ -32,6 +37,8 @@ type entry struct {
 	key    string
 	value  Value
 	expire time.Time //节点的过期时间
+	added  time.Time // 最近一次写入的时间
+	hits   int64     // 命中次数
 }
 
 // Value use Len to count how many bytes it takes
@@ -61,16 +68,37 @@ func (c *LRUCache) Add(key string, value Value, expire time.Time) {
 		c.ll.MoveToFront(node)                                      // 移至队尾
 		kv := node.Value.(*entry)                                   // 断言取值
 		c.curCapacity += int64(value.Len()) - int64(kv.value.Len()) // 更新大小
-		kv.value = value                                            // 更新值
-		kv.expire = expire                                          // 更新过期时间
+		old := kv.value
+		kv.value = value   // 更新值
+		kv.expire = expire // 更新过期时间
+		kv.added = c.Now()
+		if c.OnReplaced != nil {
+			c.OnReplaced(key, old)
+		}
 	} else {
-		node := c.ll.PushFront(&entry{key, value, expire})    //不存在那就创建节点放在队尾
-		c.cache[key] = node                                   // 插入map
-		c.curCapacity += int64(len(key)) + int64(value.Len()) //更新占用缓存
+		node := c.ll.PushFront(&entry{key: key, value: value, expire: expire, added: c.Now()}) //不存在那就创建节点放在队尾
+		c.cache[key] = node                                                                    // 插入map
+		c.curCapacity += int64(len(key)) + int64(value.Len())                                  //更新占用缓存
 	}
-	for c.maxCapacity != 0 && c.maxCapacity < c.curCapacity { // 内存超过最大内存了，就删一个
-		c.RemoveOldest()
+	if c.maxCapacity != 0 && c.maxCapacity < c.curCapacity { // 内存超过最大内存了，一次淘汰到低水位
+		for target := c.evictTarget(); target < c.curCapacity; {
+			c.RemoveOldest()
+		}
+	}
+}
+
+// SetLowWatermark 设置淘汰的低水位：写入使占用超过最大容量时一次淘汰到n字节以下，之后的多次写入不需要淘汰，
+// 把逐条的淘汰合并为一批。0或者不小于最大容量时只淘汰到最大容量
+func (c *LRUCache) SetLowWatermark(n int64) {
+	c.lowWatermark = n
+}
+
+// evictTarget 返回写入超出最大容量时淘汰的目标
+func (c *LRUCache) evictTarget() int64 {
+	if c.lowWatermark > 0 && c.lowWatermark < c.maxCapacity {
+		return c.lowWatermark
 	}
+	return c.maxCapacity
 }
 
 // Get look ups a key's value，找到该节点，然后放到队尾去
@@ -85,11 +113,46 @@ func (c *LRUCache) Get(key string) (value Value, ok bool) {
 			return nil, false
 		}
 		c.ll.MoveToFront(node)
+		kv.hits++
 		return kv.value, true
 	}
 	return
 }
 
+// Touch 把key移到链表头部，与 Get 不同，不检查过期也不增加命中次数，用于批量补记在锁外发生的访问
+func (c *LRUCache) Touch(key string) {
+	if node, ok := c.cache[key]; ok {
+		c.ll.MoveToFront(node)
+	}
+}
+
+// Peek 返回key对应的值及其过期时间，但不会更新访问顺序
+func (c *LRUCache) Peek(key string) (value Value, expire time.Time, ok bool) {
+	if c.cache == nil {
+		return
+	}
+	if node, ok := c.cache[key]; ok {
+		kv := node.Value.(*entry)
+		if !kv.expire.IsZero() && kv.expire.Before(c.Now()) {
+			return nil, time.Time{}, false
+		}
+		return kv.value, kv.expire, true
+	}
+	return
+}
+
+// Stat 返回key最近一次写入的时间和命中次数，不会更新访问顺序
+func (c *LRUCache) Stat(key string) (added time.Time, hits int64, ok bool) {
+	if c.cache == nil {
+		return
+	}
+	if node, ok := c.cache[key]; ok {
+		kv := node.Value.(*entry)
+		return kv.added, kv.hits, true
+	}
+	return
+}
+
 // RemoveOldest removes the oldest item
 func (c *LRUCache) RemoveOldest() {
 	if c.cache == nil {
@@ -101,6 +164,64 @@ func (c *LRUCache) RemoveOldest() {
 	}
 }
 
+// Keys 返回缓存中所有的key，按最近访问从新到旧排列
+func (c *LRUCache) Keys() []string {
+	if c.cache == nil {
+		return nil
+	}
+	keys := make([]string, 0, c.ll.Len())
+	for node := c.ll.Front(); node != nil; node = node.Next() {
+		keys = append(keys, node.Value.(*entry).key)
+	}
+	return keys
+}
+
+// Remove removes the provided key from the cache. 删除指定的key
+func (c *LRUCache) Remove(key string) {
+	if c.cache == nil {
+		return
+	}
+	if node, ok := c.cache[key]; ok {
+		c.removeElement(node)
+	}
+}
+
+// Resize 修改最大容量，0表示不限制。新容量小于已占用的容量时立即淘汰最久未访问的数据
+func (c *LRUCache) Resize(maxCapacity int64) {
+	c.maxCapacity = maxCapacity
+	for c.maxCapacity != 0 && c.maxCapacity < c.curCapacity {
+		c.RemoveOldest()
+	}
+}
+
+// Bytes 返回已占用的容量
+func (c *LRUCache) Bytes() int64 {
+	return c.curCapacity
+}
+
+// Overhead 返回数据结构本身占用的内存估计，不包括key和value的数据：每条记录的 entry 和链表节点各一次分配，
+// 以及 map 中的槽位。Bytes 只计算key和value，较小的记录实际占用的内存可能是它的数倍
+func (c *LRUCache) Overhead() int64 {
+	return int64(c.Len()) * entryOverhead
+}
+
+// entryOverhead 每条记录的结构开销，map 的槽位按平均装载因子约2/3折算
+var entryOverhead = allocSize(unsafe.Sizeof(entry{})) + allocSize(unsafe.Sizeof(list.Element{})) +
+	int64(unsafe.Sizeof("")+unsafe.Sizeof(&list.Element{})+1)*3/2
+
+// allocSize 返回分配n字节的对象实际占用的内存，256字节以内按内存分配器的大小等级向上取整
+func allocSize(n uintptr) int64 {
+	switch {
+	case n <= 8:
+		return 8
+	case n <= 32:
+		return int64(n+7) &^ 7
+	case n <= 256:
+		return int64(n+15) &^ 15
+	}
+	return int64(n)
+}
+
 // Len the number of cache entries
 func (c *LRUCache) Len() int {
 	return c.ll.Len()
@@ -2,7 +2,9 @@ package lru
 
 import (
 	"reflect"
+	"strconv"
 	"testing"
+	"time"
 )
 
 type String string
@@ -13,7 +15,7 @@ func (d String) Len() int {
 
 func TestGet(t *testing.T) {
 	lru := New(int64(0), nil)
-	lru.Add("key1", String("1234"))
+	lru.Add("key1", String("1234"), time.Time{})
 	if v, ok := lru.Get("key1"); !ok || string(v.(String)) != "1234" {
 		t.Fatalf("cache hit key1=1234 failed")
 	}
@@ -27,9 +29,9 @@ func TestRemoveoldest(t *testing.T) {
 	v1, v2, v3 := "value1", "value2", "v3"
 	cap := len(k1 + k2 + v1 + v2)
 	lru := New(int64(cap), nil)
-	lru.Add(k1, String(v1))
-	lru.Add(k2, String(v2))
-	lru.Add(k3, String(v3))
+	lru.Add(k1, String(v1), time.Time{})
+	lru.Add(k2, String(v2), time.Time{})
+	lru.Add(k3, String(v3), time.Time{})
 
 	if _, ok := lru.Get("key1"); ok || lru.Len() != 2 {
 		t.Fatalf("Removeoldest key1 failed")
@@ -42,10 +44,10 @@ func TestOnEvicted(t *testing.T) {
 		keys = append(keys, key)
 	}
 	lru := New(int64(10), callback)
-	lru.Add("key1", String("123456"))
-	lru.Add("k2", String("k2"))
-	lru.Add("k3", String("k3"))
-	lru.Add("k4", String("k4"))
+	lru.Add("key1", String("123456"), time.Time{})
+	lru.Add("k2", String("k2"), time.Time{})
+	lru.Add("k3", String("k3"), time.Time{})
+	lru.Add("k4", String("k4"), time.Time{})
 
 	expect := []string{"key1", "k2"}
 
@@ -56,10 +58,80 @@ func TestOnEvicted(t *testing.T) {
 
 func TestAdd(t *testing.T) {
 	lru := New(int64(0), nil)
-	lru.Add("key", String("1"))
-	lru.Add("key", String("111"))
+	lru.Add("key", String("1"), time.Time{})
+	lru.Add("key", String("111"), time.Time{})
 
-	if lru.nbytes != int64(len("key")+len("111")) {
-		t.Fatal("expected 6 but got", lru.nbytes)
+	if lru.curCapacity != int64(len("key")+len("111")) {
+		t.Fatal("expected 6 but got", lru.curCapacity)
+	}
+}
+
+func TestKeys(t *testing.T) {
+	lru := New(int64(0), nil)
+	lru.Add("k1", String("1"), time.Time{})
+	lru.Add("k2", String("2"), time.Time{})
+	lru.Get("k1")
+
+	if keys := lru.Keys(); !reflect.DeepEqual(keys, []string{"k1", "k2"}) {
+		t.Fatalf("expect keys ordered by recency, got %v", keys)
+	}
+}
+
+func TestRemove(t *testing.T) {
+	lru := New(int64(0), nil)
+	lru.Add("k1", String("1"), time.Time{})
+	lru.Remove("k1")
+	lru.Remove("missing")
+	if _, ok := lru.Get("k1"); ok || lru.Len() != 0 || lru.curCapacity != 0 {
+		t.Fatalf("Remove k1 failed")
+	}
+}
+
+func TestResize(t *testing.T) {
+	lru := New(int64(0), nil)
+	lru.Add("k1", String("v1"), time.Time{})
+	lru.Add("k2", String("v2"), time.Time{})
+	lru.Get("k1")
+	lru.Resize(4)
+	if _, ok := lru.Get("k2"); ok || lru.Len() != 1 || lru.Bytes() != 4 {
+		t.Fatalf("Resize kept %d entries (%d bytes), want only k1", lru.Len(), lru.Bytes())
+	}
+}
+
+func TestTouch(t *testing.T) {
+	lru := New(int64(0), nil)
+	lru.Add("k1", String("1"), time.Time{})
+	lru.Add("k2", String("2"), time.Time{})
+	lru.Touch("k1")
+	lru.Touch("missing")
+	if keys := lru.Keys(); !reflect.DeepEqual(keys, []string{"k1", "k2"}) {
+		t.Fatalf("keys after touch = %v", keys)
+	}
+	if _, hits, _ := lru.Stat("k1"); hits != 0 {
+		t.Fatalf("touch counted %d hits", hits)
+	}
+}
+
+func TestLowWatermark(t *testing.T) {
+	evicted := 0
+	lru := New(int64(30), func(string, Value) { evicted++ })
+	lru.SetLowWatermark(15)
+	for i := 0; i < 10; i++ {
+		lru.Add("k"+strconv.Itoa(i), String("v"), time.Time{})
+	}
+	if evicted != 0 || lru.Bytes() != 30 {
+		t.Fatalf("evicted %d before reaching capacity, bytes %d", evicted, lru.Bytes())
+	}
+	// 超出容量时一次淘汰到低水位，之后的写入不需要淘汰
+	lru.Add("k10", String("v"), time.Time{})
+	if lru.Bytes() > 15 || evicted != 7 {
+		t.Fatalf("bytes = %d after %d evictions, want <= 15", lru.Bytes(), evicted)
+	}
+	if _, ok := lru.Get("k10"); !ok {
+		t.Fatal("newest key was evicted")
+	}
+	lru.Add("k11", String("v"), time.Time{})
+	if evicted != 7 {
+		t.Fatalf("evicted %d below capacity", evicted)
 	}
 }
@@ -0,0 +1,77 @@
+package gocache
+
+import (
+	"sort"
+	"unsafe"
+)
+
+// sizeClasses 是Go内存分配器的小对象大小等级(runtime/sizeclasses.go)，分配时向上取整到其中之一
+var sizeClasses = []int64{
+	8, 16, 24, 32, 48, 64, 80, 96, 112, 128, 144, 160, 176, 192, 208, 224, 240, 256,
+	288, 320, 352, 384, 416, 448, 480, 512, 576, 640, 704, 768, 896, 1024, 1152, 1280, 1408, 1536, 1792,
+	2048, 2304, 2688, 3072, 3200, 3456, 4096, 4864, 5376, 6144, 6528, 6784, 6912, 8192, 9472, 9728, 10240,
+	10880, 12288, 13568, 14336, 16384, 18432, 19072, 20480, 21760, 24576, 27264, 28672, 32768,
+}
+
+const pageSize = 8 << 10
+
+// allocSize 返回分配n字节实际占用的内存：小对象取整到大小等级，大对象取整到页
+func allocSize(n int) int64 {
+	if n <= 0 {
+		return 0
+	}
+	if size := int64(n); size <= sizeClasses[len(sizeClasses)-1] {
+		return sizeClasses[sort.Search(len(sizeClasses), func(i int) bool { return sizeClasses[i] >= size })]
+	}
+	return (int64(n) + pageSize - 1) &^ (pageSize - 1)
+}
+
+// entryOverhead 是 LRUcache 和 LFUcache 在底层 lru/lfu 之外每条数据的结构开销：
+// 保存在 Value 接口中的 ByteView 需要单独分配一次，读路径的索引中有一个 cacheItem 和一个 map 槽位(按装载因子约2/3折算)
+var entryOverhead = allocSize(int(unsafe.Sizeof(ByteView{}))) + allocSize(int(unsafe.Sizeof(cacheItem{}))) +
+	int64(unsafe.Sizeof("")+unsafe.Sizeof(&cacheItem{})+1)*3/2
+
+// dataSize 返回一条数据的key和value实际占用的内存，value 在slab中时由slab计算，见 Group.MemoryUsage
+func dataSize(key string, value ByteView) int64 {
+	n := allocSize(len(key))
+	if value.s == nil {
+		n += allocSize(cap(value.b))
+	}
+	return n
+}
+
+// cacheMemory 是一级缓存占用内存的估计
+type cacheMemory struct {
+	entries int64
+	data    int64 // key和value的字节数，与 bytes 相同
+	total   int64 // 包括分配器取整和数据结构的开销，不包括slab
+}
+
+// MemoryUsage 缓存组的主缓存和热点缓存占用内存的估计，见 Group.MemoryUsage
+type MemoryUsage struct {
+	Entries  int64 `json:"entries"`  // 数据条数
+	Data     int64 `json:"data"`     // key和value的字节数，即容量和 GroupStats.Bytes 使用的口径
+	Overhead int64 `json:"overhead"` // 分配器取整、链表节点或堆、map、读路径的索引以及slab中暂时不能回收的内存
+	Total    int64 `json:"total"`    // Data 与 Overhead 之和
+}
+
+// MemoryUsage 估计主缓存和热点缓存实际占用的内存。缓存的容量、Stats 中的 Bytes 和 MemoryBudget 只计算key和value的字节数，
+// 数据较小时每条数据的 entry、链表节点、map 槽位等结构开销和内存分配器的取整可能是数据本身的数倍；
+// Total 把这些开销计算在内，与进程中归属于该缓存组的堆内存基本一致，可以用来按实际内存设置容量。
+// 不包括缓存组的其他结构(统计、热点key、加载中的请求等)，同时在主缓存和热点缓存中的数据计算两次
+func (g *Group) MemoryUsage() MemoryUsage {
+	main, hot := g.mainCache.memory(), g.hotCache.memory()
+	u := MemoryUsage{
+		Entries: main.entries + hot.entries,
+		Data:    main.data + hot.data,
+		Total:   main.total + hot.total,
+	}
+	if a := g.slabs; a != nil {
+		u.Total += a.slabBytes.Get()
+	}
+	if u.Total < u.Data {
+		u.Total = u.Data
+	}
+	u.Overhead = u.Total - u.Data
+	return u
+}
@@ -0,0 +1,96 @@
+package gocache
+
+import (
+	"fmt"
+	"runtime"
+	"testing"
+)
+
+func TestAllocSize(t *testing.T) {
+	for _, tc := range []struct {
+		n    int
+		want int64
+	}{
+		{0, 0}, {1, 8}, {8, 8}, {9, 16}, {33, 48}, {257, 288}, {32768, 32768}, {32769, 40960},
+	} {
+		if got := allocSize(tc.n); got != tc.want {
+			t.Errorf("allocSize(%d) = %d, want %d", tc.n, got, tc.want)
+		}
+	}
+}
+
+func TestMemoryUsage(t *testing.T) {
+	for _, strategy := range []string{"lru", "lfu"} {
+		g := NewGroup("memory-"+strategy, 0, strategy, GetterFunc(func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}))
+		empty := g.MemoryUsage()
+		if empty.Entries != 0 || empty.Data != 0 || empty.Overhead <= 0 {
+			t.Fatalf("%s empty usage %+v", strategy, empty)
+		}
+		for i := 0; i < 1000; i++ {
+			g.Set(fmt.Sprintf("k%04d", i), []byte("v"), 0)
+		}
+		u := g.MemoryUsage()
+		if u.Entries != 1000 || u.Data != g.Stats().Bytes || u.Total != u.Data+u.Overhead {
+			t.Fatalf("%s usage %+v", strategy, u)
+		}
+		// 每条数据只有6字节，结构开销是数据本身的数倍
+		if perEntry := (u.Total - empty.Total) / u.Entries; perEntry < 10*6 {
+			t.Fatalf("%s overhead per entry = %d", strategy, perEntry)
+		}
+		if st := g.Stats(); st.MemoryBytes != u.Total {
+			t.Fatalf("%s stats memory = %d, want %d", strategy, st.MemoryBytes, u.Total)
+		}
+
+		// 覆盖不重复计算，删除后释放数据和每条数据的开销
+		g.Set("k0000", []byte("v"), 0)
+		if got := g.MemoryUsage(); got != u {
+			t.Fatalf("%s usage after overwrite %+v, want %+v", strategy, got, u)
+		}
+		g.Flush()
+		if got := g.MemoryUsage(); got.Entries != 0 || got.Data != 0 || got.Total >= u.Total {
+			t.Fatalf("%s usage after flush %+v, empty %+v", strategy, got, empty)
+		}
+	}
+}
+
+// TestMemoryUsageHeap 对比估计值与写入数据前后堆内存的实际增长
+func TestMemoryUsageHeap(t *testing.T) {
+	if testing.Short() {
+		t.Skip("reads runtime memory stats")
+	}
+	for _, tc := range []struct {
+		strategy string
+		value    int
+	}{
+		{"lru", 8}, {"lfu", 8}, {"lru", 200}, {"lfu", 1000},
+	} {
+		const entries = 20000
+		var c BaseCache = &LRUcache{}
+		if tc.strategy == "lfu" {
+			c = &LFUcache{}
+		}
+		keys := make([]string, entries)
+		for i := range keys {
+			keys[i] = fmt.Sprintf("key-%08d", i)
+		}
+		var before, after runtime.MemStats
+		runtime.GC()
+		runtime.ReadMemStats(&before)
+		for _, key := range keys {
+			c.add(key, ByteView{b: make([]byte, tc.value)})
+		}
+		runtime.GC()
+		runtime.ReadMemStats(&after)
+		heap := int64(after.HeapAlloc) - int64(before.HeapAlloc)
+		// keys 在写入之前已经分配，不计入堆的增长
+		m := c.memory()
+		estimate := m.total - entries*allocSize(len(keys[0]))
+		if ratio := float64(estimate) / float64(heap); ratio < 0.8 || ratio > 1.2 {
+			t.Errorf("%s %dB values: estimate %d, heap grew %d (%.2f)", tc.strategy, tc.value, estimate, heap, ratio)
+		}
+		runtime.KeepAlive(c)
+		runtime.KeepAlive(keys)
+	}
+}
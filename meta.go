@@ -0,0 +1,72 @@
+package gocache
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	pb "gocache/gocachepb"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type traceIDKey struct{}
+
+// WithTraceID 返回携带追踪ID的上下文，经由 Group.GetContext 发往远程节点的请求都会带上该追踪ID
+func WithTraceID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, traceIDKey{}, id)
+}
+
+// TraceID 返回上下文中的追踪ID，没有时返回空字符串
+func TraceID(ctx context.Context) string {
+	id, _ := ctx.Value(traceIDKey{}).(string)
+	return id
+}
+
+// newTraceID 生成一个随机的追踪ID
+func newTraceID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// fillMeta 根据上下文填充发往远程节点的请求的元数据，上下文已经结束时返回错误
+func (g *Group) fillMeta(ctx context.Context, req *pb.Request) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		req.Deadline = deadline.UnixNano()
+	}
+	if req.TraceId = TraceID(ctx); req.TraceId == "" { // 由本节点发起的请求，生成新的追踪ID
+		req.TraceId = newTraceID()
+	}
+	if p, ok := g.peers.(interface{ Self() string }); ok {
+		req.Caller = p.Self()
+	}
+	injectTrace(ctx, req)
+	return nil
+}
+
+// requestContext 根据请求的元数据构造处理请求使用的上下文，之后的远程调用沿用其中的截止时间和追踪ID。
+// 请求已经超过截止时间时返回 DeadlineExceeded。
+func requestContext(ctx context.Context, in *pb.Request) (context.Context, context.CancelFunc, error) {
+	if in.TraceId != "" {
+		ctx = WithTraceID(ctx, in.TraceId)
+	}
+	if in.Deadline == 0 {
+		return ctx, func() {}, nil
+	}
+	deadline := time.Unix(0, in.Deadline)
+	if time.Now().After(deadline) {
+		return nil, nil, status.Errorf(codes.DeadlineExceeded, "request deadline exceeded (trace %s)", in.TraceId)
+	}
+	ctx, cancel := context.WithDeadline(ctx, deadline)
+	return ctx, cancel, nil
+}
+
+// Self 返回当前服务器的地址
+func (s *Server) Self() string {
+	return s.self
+}
@@ -0,0 +1,121 @@
+package metrics
+
+import (
+	"expvar"
+	"runtime"
+
+	"gocache"
+)
+
+// Publish 把采集的统计发布为expvar变量name(空字符串表示 Namespace，默认为 "gocache")，通过 /debug/vars 读取，
+// 不依赖Prometheus。每次读取时重新采集，变量的结构为：
+//
+//	gocache.groups.<name>.hits        缓存组的统计，字段见 gocache.GroupStats
+//	gocache.groups.<name>.heap_ratio  缓存组(主缓存和热点缓存)占用的字节数占Go堆内存的比例
+//	gocache.memory                    Go运行时的内存统计和缓存数据占用的总字节数
+//	gocache.server                    设置了 Server 时访问远程节点的统计、熔断器、限流和哈希环的成员
+//
+// 与 expvar.Publish 相同，同一个名字只能发布一次，重复发布会panic。
+func (c *Collector) Publish(name string) {
+	if name == "" {
+		name = c.Namespace
+	}
+	if name == "" {
+		name = defaultNamespace
+	}
+	expvar.Publish(name, expvar.Func(c.expvarValue))
+}
+
+// expvarValue 返回发布到expvar的当前统计
+func (c *Collector) expvarValue() interface{} {
+	groups := c.Groups
+	if groups == nil {
+		groups = gocache.Groups
+	}
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	var cacheBytes, cacheMemory int64
+	out := map[string]interface{}{}
+	for _, g := range groups() {
+		st := g.Stats()
+		bytes := st.Bytes + st.HotBytes
+		cacheBytes += bytes
+		cacheMemory += st.MemoryBytes
+		out[st.Name] = map[string]interface{}{
+			"hits":             st.Hits,
+			"hot_hits":         st.HotHits,
+			"misses":           st.Misses,
+			"peer_loads":       st.PeerLoads,
+			"local_loads":      st.LocalLoads,
+			"load_errors":      st.LoadErrors,
+			"load_calls":       st.LoadCalls,
+			"coalesced":        st.Coalesced,
+			"evictions":        st.Evictions,
+			"slow_loads":       st.SlowLoads,
+			"expirations":      st.Expirations,
+			"hedged":           st.Hedged,
+			"hedge_wins":       st.HedgeWins,
+			"fallback_replica": st.FallbackReplica,
+			"fallback_local":   st.FallbackLocal,
+			"fallback_errors":  st.FallbackErrors,
+			"bytes":            st.Bytes,
+			"hot_bytes":        st.HotBytes,
+			"capacity":         st.Capacity,
+			"memory_bytes":     st.MemoryBytes,
+			"heap_ratio":       ratio(bytes, mem.HeapAlloc),
+		}
+	}
+	vars := map[string]interface{}{
+		"groups": out,
+		"memory": map[string]interface{}{
+			"heap_alloc":         mem.HeapAlloc,
+			"heap_inuse":         mem.HeapInuse,
+			"sys":                mem.Sys,
+			"num_gc":             mem.NumGC,
+			"cache_bytes":        cacheBytes,
+			"cache_ratio":        ratio(cacheBytes, mem.HeapAlloc),
+			"cache_memory_bytes": cacheMemory,
+			"cache_memory_ratio": ratio(cacheMemory, mem.HeapAlloc),
+		},
+	}
+	if c.Server != nil {
+		vars["server"] = serverVars(c.Server)
+	}
+	return vars
+}
+
+// serverVars 返回节点的统计
+func serverVars(svr *gocache.Server) map[string]interface{} {
+	peers := map[string]interface{}{}
+	for _, p := range svr.PeerMetrics() {
+		peers[p.Peer] = map[string]interface{}{
+			"requests":       p.Requests,
+			"errors":         p.Errors,
+			"coalesced":      p.Coalesced,
+			"bytes_sent":     p.BytesSent,
+			"bytes_received": p.BytesReceived,
+			"latency_count":  p.Latency.Count,
+			"latency_sum_ms": float64(p.Latency.Sum.Microseconds()) / 1000,
+		}
+	}
+	return map[string]interface{}{
+		"self":     svr.Self(),
+		"state":    svr.State().String(),
+		"peers":    peers,
+		"breakers": svr.BreakerStats(),
+		"limits":   svr.LimitStats(),
+		"ring": map[string]interface{}{
+			"members": len(svr.RingState().Nodes),
+			"evicted": svr.EvictedPeers(),
+		},
+	}
+}
+
+// ratio 返回 part/total，total 为0时返回0
+func ratio(part int64, total uint64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(part) / float64(total)
+}
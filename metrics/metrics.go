@@ -0,0 +1,253 @@
+// Package metrics 以Prometheus文本格式(0.0.4)导出gocache的指标，不依赖Prometheus的客户端库：
+// 缓存组的命中、未命中、加载、淘汰和内存占用，加载合并的次数，访问远程节点的请求数、错误和耗时直方图，以及哈希环的成员。
+//
+//	c := metrics.NewCollector(svr)
+//	http.Handle("/metrics", c)
+//
+// 或者使用内置的监听：metrics.ListenAndServe(":9100", c)。
+// 同样的统计也可以通过 Collector.Publish 发布到expvar(/debug/vars)，或者由 StatsD 定期发送给StatsD/DogStatsD。
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gocache"
+)
+
+// ContentType 导出的指标的HTTP Content-Type
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// defaultNamespace 指标名称的默认前缀
+const defaultNamespace = "gocache"
+
+// Collector 采集gocache的指标，每次采集时读取最新的统计，实现了 http.Handler
+type Collector struct {
+	// Namespace 指标名称的前缀，空字符串表示 "gocache"
+	Namespace string
+	// Groups 返回需要导出的缓存组，nil表示 gocache.Groups
+	Groups func() []*gocache.Group
+	// Server 导出访问远程节点的统计和哈希环的成员，nil表示只导出缓存组的指标
+	Server *gocache.Server
+}
+
+// NewCollector 创建采集进程中所有缓存组以及svr(可以为nil)的指标的 Collector
+func NewCollector(svr *gocache.Server) *Collector {
+	return &Collector{Server: svr}
+}
+
+// ServeHTTP 实现了 http.Handler，以Prometheus文本格式返回当前的指标
+func (c *Collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", ContentType)
+	c.WriteTo(w)
+}
+
+// WriteTo 以Prometheus文本格式写出当前的指标
+func (c *Collector) WriteTo(w io.Writer) (int64, error) {
+	bw := bufio.NewWriter(w)
+	cw := &countingWriter{w: bw}
+	e := &encoder{w: cw, ns: c.Namespace}
+	if e.ns == "" {
+		e.ns = defaultNamespace
+	}
+	groups := c.Groups
+	if groups == nil {
+		groups = gocache.Groups
+	}
+	c.writeGroups(e, groups())
+	if c.Server != nil {
+		c.writePeers(e, c.Server.PeerMetrics())
+		c.writeRing(e, c.Server)
+	}
+	if err := bw.Flush(); err != nil && cw.err == nil {
+		cw.err = err
+	}
+	return cw.n, cw.err
+}
+
+// writeGroups 写出缓存组的指标
+func (c *Collector) writeGroups(e *encoder, groups []*gocache.Group) {
+	stats := make([]gocache.GroupStats, len(groups))
+	for i, g := range groups {
+		stats[i] = g.Stats()
+	}
+	type metric struct {
+		name, typ, help string
+		labels          []string // 追加在group之后的标签，与 values 的结果一一对应
+		values          func(st gocache.GroupStats) []float64
+	}
+	metrics := []metric{
+		{"group_hits_total", "counter", "Cache hits by cache tier.", []string{`cache="main"`, `cache="hot"`},
+			func(st gocache.GroupStats) []float64 { return []float64{float64(st.Hits), float64(st.HotHits)} }},
+		{"group_misses_total", "counter", "Lookups that missed both the main and the hot cache.", nil,
+			func(st gocache.GroupStats) []float64 { return []float64{float64(st.Misses)} }},
+		{"group_loads_total", "counter", "Successful loads after a miss by source.", []string{`source="peer"`, `source="local"`},
+			func(st gocache.GroupStats) []float64 { return []float64{float64(st.PeerLoads), float64(st.LocalLoads)} }},
+		{"group_load_errors_total", "counter", "Loads that failed after a miss.", nil,
+			func(st gocache.GroupStats) []float64 { return []float64{float64(st.LoadErrors)} }},
+		{"group_load_calls_total", "counter", "Loads actually executed after deduplication.", nil,
+			func(st gocache.GroupStats) []float64 { return []float64{float64(st.LoadCalls)} }},
+		{"group_loads_deduplicated_total", "counter", "Loads that joined an identical in-flight load instead of running.", nil,
+			func(st gocache.GroupStats) []float64 { return []float64{float64(st.Coalesced)} }},
+		{"group_evictions_total", "counter", "Entries evicted or deleted from the main cache.", nil,
+			func(st gocache.GroupStats) []float64 { return []float64{float64(st.Evictions)} }},
+		{"group_expirations_total", "counter", "Entries removed from the main cache after they expired.", nil,
+			func(st gocache.GroupStats) []float64 { return []float64{float64(st.Expirations)} }},
+		{"group_slow_loads_total", "counter", "Getter calls and peer reads slower than the slow log threshold.", nil,
+			func(st gocache.GroupStats) []float64 { return []float64{float64(st.SlowLoads)} }},
+		{"group_bytes", "gauge", "Bytes used by cache tier.", []string{`cache="main"`, `cache="hot"`},
+			func(st gocache.GroupStats) []float64 { return []float64{float64(st.Bytes), float64(st.HotBytes)} }},
+		{"group_capacity_bytes", "gauge", "Capacity of the main cache in bytes.", nil,
+			func(st gocache.GroupStats) []float64 { return []float64{float64(st.Capacity)} }},
+		{"group_memory_bytes", "gauge", "Estimated heap bytes used by the main and hot cache including per-entry overhead.", nil,
+			func(st gocache.GroupStats) []float64 { return []float64{float64(st.MemoryBytes)} }},
+	}
+	for _, m := range metrics {
+		e.header(m.name, m.typ, m.help)
+		for _, st := range stats {
+			group := label("group", st.Name)
+			for i, v := range m.values(st) {
+				labels := group
+				if m.labels != nil {
+					labels += "," + m.labels[i]
+				}
+				e.sample(m.name, labels, v)
+			}
+		}
+	}
+	e.header("group_hit_age_seconds", "histogram", "Age of entries when they were hit.")
+	for _, st := range stats {
+		e.histogram("group_hit_age_seconds", label("group", st.Name), st.HitAge)
+	}
+	e.header("group_eviction_age_seconds", "histogram", "Age of entries evicted from the main cache for capacity.")
+	for _, st := range stats {
+		e.histogram("group_eviction_age_seconds", label("group", st.Name), st.EvictionAge)
+	}
+}
+
+// writePeers 写出访问远程节点的指标
+func (c *Collector) writePeers(e *encoder, peers []gocache.PeerMetrics) {
+	e.header("peer_requests_total", "counter", "Read requests sent to a peer.")
+	for _, p := range peers {
+		e.sample("peer_requests_total", label("peer", p.Peer), float64(p.Requests))
+	}
+	e.header("peer_errors_total", "counter", "Failed read requests to a peer by error class.")
+	for _, p := range peers {
+		classes := make([]string, 0, len(p.Errors))
+		for class := range p.Errors {
+			classes = append(classes, string(class))
+		}
+		sort.Strings(classes)
+		for _, class := range classes {
+			e.sample("peer_errors_total", label("peer", p.Peer)+","+label("class", class), float64(p.Errors[gocache.ErrorClass(class)]))
+		}
+	}
+	e.header("peer_coalesced_total", "counter", "Read requests to a peer merged into an identical in-flight request.")
+	for _, p := range peers {
+		e.sample("peer_coalesced_total", label("peer", p.Peer), float64(p.Coalesced))
+	}
+	e.header("peer_sent_bytes_total", "counter", "Bytes of read requests sent to a peer.")
+	for _, p := range peers {
+		e.sample("peer_sent_bytes_total", label("peer", p.Peer), float64(p.BytesSent))
+	}
+	e.header("peer_received_bytes_total", "counter", "Bytes of values received from a peer.")
+	for _, p := range peers {
+		e.sample("peer_received_bytes_total", label("peer", p.Peer), float64(p.BytesReceived))
+	}
+	e.header("peer_request_duration_seconds", "histogram", "Latency of read requests to a peer.")
+	for _, p := range peers {
+		e.histogram("peer_request_duration_seconds", label("peer", p.Peer), p.Latency)
+	}
+}
+
+// writeRing 写出哈希环的成员
+func (c *Collector) writeRing(e *encoder, svr *gocache.Server) {
+	state := svr.RingState()
+	e.header("ring_members", "gauge", "Number of nodes on the hash ring.")
+	e.sample("ring_members", "", float64(len(state.Nodes)))
+	e.header("ring_member_keyspace_ratio", "gauge", "Fraction of the hash space owned by each node on the ring.")
+	for _, n := range state.Nodes {
+		e.sample("ring_member_keyspace_ratio", label("peer", n.Addr), n.Keyspace)
+	}
+	e.header("ring_evicted_peers", "gauge", "Peers removed from the ring by failed health checks.")
+	e.sample("ring_evicted_peers", "", float64(len(svr.EvictedPeers())))
+}
+
+// ListenAndServe 在addr上启动只提供 /metrics 的HTTP服务，阻塞直到服务出错，与 http.ListenAndServe 相同
+func ListenAndServe(addr string, c *Collector) error {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return Serve(lis, c)
+}
+
+// Serve 在lis上提供 /metrics，阻塞直到服务出错，用于需要先确定监听地址(例如端口为0)的场景
+func Serve(lis net.Listener, c *Collector) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", c)
+	return http.Serve(lis, mux)
+}
+
+// encoder 按Prometheus文本格式写出指标
+type encoder struct {
+	w  io.Writer
+	ns string
+}
+
+func (e *encoder) header(name, typ, help string) {
+	fmt.Fprintf(e.w, "# HELP %s_%s %s\n# TYPE %s_%s %s\n", e.ns, name, help, e.ns, name, typ)
+}
+
+func (e *encoder) sample(name, labels string, v float64) {
+	if labels != "" {
+		labels = "{" + labels + "}"
+	}
+	fmt.Fprintf(e.w, "%s_%s%s %s\n", e.ns, name, labels, formatFloat(v))
+}
+
+// histogram 写出累计的桶、总和与次数，耗时以秒为单位
+func (e *encoder) histogram(name, labels string, h gocache.Histogram) {
+	var cum int64
+	for i, bound := range h.Bounds {
+		cum += h.Counts[i]
+		e.sample(name+"_bucket", labels+","+label("le", formatFloat(bound.Seconds())), float64(cum))
+	}
+	e.sample(name+"_bucket", labels+`,le="+Inf"`, float64(h.Count))
+	e.sample(name+"_sum", labels, h.Sum.Seconds())
+	e.sample(name+"_count", labels, float64(h.Count))
+}
+
+// label 返回转义后的标签
+func label(name, value string) string {
+	return name + `="` + labelEscaper.Replace(value) + `"`
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// countingWriter 记录写出的字节数和第一个错误
+type countingWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	w.err = err
+	return n, err
+}
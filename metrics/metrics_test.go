@@ -0,0 +1,172 @@
+package metrics
+
+import (
+	"bytes"
+	"encoding/json"
+	"expvar"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gocache"
+)
+
+func TestCollector(t *testing.T) {
+	g := gocache.NewGroup("metrics", 2<<10, "lru", gocache.GetterFunc(func(key string) ([]byte, error) {
+		return []byte("v"), nil
+	}))
+	g.GetCacheData("a")
+	g.GetCacheData("a")
+	svr, err := gocache.NewServer("10.0.0.1:8001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	svr.Set("10.0.0.1:8001", "10.0.0.2:8001")
+
+	c := NewCollector(svr)
+	c.Groups = func() []*gocache.Group { return []*gocache.Group{g} }
+	rec := httptest.NewRecorder()
+	c.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); ct != ContentType {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+	body := rec.Body.String()
+	for _, want := range []string{
+		"# TYPE gocache_group_hits_total counter\n",
+		`gocache_group_hits_total{group="metrics",cache="hot"} 1` + "\n",
+		`gocache_group_misses_total{group="metrics"} 1` + "\n",
+		`gocache_group_loads_total{group="metrics",source="local"} 1` + "\n",
+		`gocache_group_load_calls_total{group="metrics"} 1` + "\n",
+		`gocache_group_capacity_bytes{group="metrics"} 2048` + "\n",
+		"# TYPE gocache_group_eviction_age_seconds histogram\n",
+		`gocache_group_hit_age_seconds_count{group="metrics"} 1` + "\n",
+		"# TYPE gocache_peer_request_duration_seconds histogram\n",
+		"gocache_ring_members 2\n",
+		`gocache_ring_member_keyspace_ratio{peer="10.0.0.2:8001"} `,
+	} {
+		if !strings.Contains(body, want) {
+			t.Fatalf("missing %q in\n%s", want, body)
+		}
+	}
+
+	var buf bytes.Buffer
+	c.Namespace = "app"
+	if n, err := c.WriteTo(&buf); err != nil || n != int64(buf.Len()) || !strings.Contains(buf.String(), "app_group_misses_total") {
+		t.Fatalf("WriteTo = %d, %v", n, err)
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	var buf bytes.Buffer
+	e := &encoder{w: &buf, ns: "gocache"}
+	h := gocache.Histogram{Bounds: gocache.LatencyBuckets[:2], Counts: []int64{1, 2, 3}, Count: 6}
+	e.histogram("d", label("peer", `a"b`), h)
+	want := `gocache_d_bucket{peer="a\"b",le="0.001"} 1
+gocache_d_bucket{peer="a\"b",le="0.0025"} 3
+gocache_d_bucket{peer="a\"b",le="+Inf"} 6
+gocache_d_sum{peer="a\"b"} 0
+gocache_d_count{peer="a\"b"} 6
+`
+	if buf.String() != want {
+		t.Fatalf("got\n%s\nwant\n%s", buf.String(), want)
+	}
+}
+
+func TestPublishExpvar(t *testing.T) {
+	g := gocache.NewGroup("expvar", 2<<10, "lru", gocache.GetterFunc(func(key string) ([]byte, error) {
+		return []byte("value"), nil
+	}))
+	g.GetCacheData("a")
+	svr, err := gocache.NewServer("10.0.0.1:8002")
+	if err != nil {
+		t.Fatal(err)
+	}
+	svr.Set("10.0.0.1:8002", "10.0.0.2:8002")
+
+	c := NewCollector(svr)
+	c.Groups = func() []*gocache.Group { return []*gocache.Group{g} }
+	c.Publish("gocache_test")
+	var vars struct {
+		Groups map[string]map[string]float64 `json:"groups"`
+		Memory map[string]float64            `json:"memory"`
+		Server struct {
+			Ring struct {
+				Members int `json:"members"`
+			} `json:"ring"`
+		} `json:"server"`
+	}
+	if err := json.Unmarshal([]byte(expvar.Get("gocache_test").String()), &vars); err != nil {
+		t.Fatal(err)
+	}
+	st := vars.Groups["expvar"]
+	if st["misses"] != 1 || st["local_loads"] != 1 || st["bytes"] == 0 || st["memory_bytes"] <= st["bytes"] || st["heap_ratio"] <= 0 {
+		t.Errorf("group vars = %v", st)
+	}
+	if vars.Memory["heap_alloc"] == 0 || vars.Memory["cache_bytes"] != st["bytes"]+st["hot_bytes"] {
+		t.Errorf("memory vars = %v", vars.Memory)
+	}
+	if vars.Server.Ring.Members != 2 {
+		t.Errorf("ring members = %d", vars.Server.Ring.Members)
+	}
+}
+
+func TestStatsD(t *testing.T) {
+	g := gocache.NewGroup("statsd.scores", 2<<10, "lru", gocache.GetterFunc(func(key string) ([]byte, error) {
+		return []byte("v"), nil
+	}))
+	g.GetCacheData("a")
+	svr, err := gocache.NewServer("10.0.0.1:8003")
+	if err != nil {
+		t.Fatal(err)
+	}
+	svr.Set("10.0.0.1:8003", "10.0.0.2:8003")
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	read := func() string {
+		buf := make([]byte, 64<<10)
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(buf[:n])
+	}
+
+	s := NewStatsD(conn.LocalAddr().String(), svr)
+	s.Collector.Groups = func() []*gocache.Group { return []*gocache.Group{g} }
+	if err := s.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	got := read()
+	for _, want := range []string{
+		"gocache.group.misses.statsd_scores:1|c\n",
+		"gocache.group.loads.statsd_scores.local:1|c\n",
+		"gocache.group.capacity_bytes.statsd_scores:2048|g\n",
+		"gocache.ring.members:2|g",
+	} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("missing %q in\n%s", want, got)
+		}
+	}
+
+	// 计数以增量发送，标签使用DogStatsD的格式
+	g.GetCacheData("b")
+	s.DogStatsD, s.Tags = true, []string{"env:test"}
+	if err := s.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	got = read()
+	for _, want := range []string{
+		"gocache.group.misses:1|c|#env:test,group:statsd.scores\n",
+		"gocache.group.hits:0|c|#env:test,group:statsd.scores,cache:main\n",
+		"gocache.ring.members:2|g|#env:test",
+	} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("missing %q in\n%s", want, got)
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gocache"
+)
+
+const (
+	defaultStatsDAddr     = "127.0.0.1:8125"
+	defaultStatsDPrefix   = "gocache."
+	defaultStatsDInterval = 10 * time.Second
+	statsdMaxPacket       = 1432 // 不超过常见网络的MTU，避免UDP分片
+)
+
+// StatsD 定期把缓存组和访问远程节点的统计通过UDP发送给StatsD或DogStatsD，用于没有Prometheus的环境：
+// 累计的计数转换为两次发送之间的增量(|c)，占用的字节数和哈希环的成员数为 gauge(|g)，
+// 访问远程节点的耗时为两次发送之间的平均值(|ms)。
+//
+// DogStatsD 为true时缓存组、节点等维度以标签发送(gocache.group.hits:3|c|#group:scores,cache:main)，
+// 否则拼接在名称之后(gocache.group.hits.scores.main:3|c)。
+type StatsD struct {
+	Addr      string        // StatsD的UDP地址，默认为 127.0.0.1:8125
+	Prefix    string        // 指标名称的前缀，默认为 "gocache."
+	DogStatsD bool          // 使用DogStatsD的标签扩展
+	Tags      []string      // 附加在所有指标上的标签，例如 "env:prod"，只在 DogStatsD 为true时发送
+	Interval  time.Duration // 发送的间隔，默认10秒
+	Collector *Collector    // 采集的范围，nil表示进程中所有的缓存组
+
+	mu   sync.Mutex
+	conn net.Conn
+	last map[string]int64 // 上一次发送时计数的累计值，键为名称加标签
+	buf  bytes.Buffer
+}
+
+// NewStatsD 创建发送到addr的 StatsD，采集进程中所有缓存组以及svr(可以为nil)的统计
+func NewStatsD(addr string, svr *gocache.Server) *StatsD {
+	return &StatsD{Addr: addr, Collector: NewCollector(svr)}
+}
+
+// Run 每隔 Interval 发送一次统计，阻塞直到ctx被取消，退出前再发送一次。发送失败不会退出，返回值为ctx的错误
+func (s *StatsD) Run(ctx context.Context) error {
+	interval := s.Interval
+	if interval <= 0 {
+		interval = defaultStatsDInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			s.Flush()
+			s.close()
+			return ctx.Err()
+		case <-ticker.C:
+			s.Flush()
+		}
+	}
+}
+
+// Flush 立即发送一次当前的统计，第一次发送的计数为创建以来的累计值
+func (s *StatsD) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		addr := s.Addr
+		if addr == "" {
+			addr = defaultStatsDAddr
+		}
+		conn, err := net.Dial("udp", addr)
+		if err != nil {
+			return err
+		}
+		s.conn = conn
+	}
+	if s.last == nil {
+		s.last = map[string]int64{}
+	}
+	c := s.Collector
+	if c == nil {
+		c = &Collector{}
+	}
+	groups := c.Groups
+	if groups == nil {
+		groups = gocache.Groups
+	}
+	var lines []string
+	for _, g := range groups() {
+		lines = s.groupLines(lines, g.Stats())
+	}
+	if c.Server != nil {
+		for _, p := range c.Server.PeerMetrics() {
+			lines = s.peerLines(lines, p)
+		}
+		lines = append(lines, s.line("ring.members", int64(len(c.Server.RingState().Nodes)), "g"))
+	}
+	return s.send(lines)
+}
+
+// groupLines 追加一个缓存组的指标
+func (s *StatsD) groupLines(lines []string, st gocache.GroupStats) []string {
+	group := "group:" + st.Name
+	return append(lines,
+		s.count("group.hits", st.Hits, group, "cache:main"),
+		s.count("group.hits", st.HotHits, group, "cache:hot"),
+		s.count("group.misses", st.Misses, group),
+		s.count("group.loads", st.PeerLoads, group, "source:peer"),
+		s.count("group.loads", st.LocalLoads, group, "source:local"),
+		s.count("group.load_errors", st.LoadErrors, group),
+		s.count("group.evictions", st.Evictions, group),
+		s.count("group.slow_loads", st.SlowLoads, group),
+		s.line("group.bytes", st.Bytes, "g", group, "cache:main"),
+		s.line("group.bytes", st.HotBytes, "g", group, "cache:hot"),
+		s.line("group.capacity_bytes", st.Capacity, "g", group),
+		s.line("group.memory_bytes", st.MemoryBytes, "g", group),
+	)
+}
+
+// peerLines 追加访问一个远程节点的指标
+func (s *StatsD) peerLines(lines []string, p gocache.PeerMetrics) []string {
+	peer := "peer:" + p.Peer
+	lines = append(lines,
+		s.count("peer.requests", p.Requests, peer),
+		s.count("peer.coalesced", p.Coalesced, peer),
+		s.count("peer.sent_bytes", p.BytesSent, peer),
+		s.count("peer.received_bytes", p.BytesReceived, peer),
+	)
+	classes := make([]string, 0, len(p.Errors))
+	for class := range p.Errors {
+		classes = append(classes, string(class))
+	}
+	sort.Strings(classes)
+	for _, class := range classes {
+		lines = append(lines, s.count("peer.errors", p.Errors[gocache.ErrorClass(class)], peer, "class:"+class))
+	}
+	// 两次发送之间的平均耗时
+	key := "peer.latency|" + p.Peer
+	count, sum := p.Latency.Count-s.last[key+"|count"], int64(p.Latency.Sum)-s.last[key+"|sum"]
+	s.last[key+"|count"], s.last[key+"|sum"] = p.Latency.Count, int64(p.Latency.Sum)
+	if count > 0 {
+		avg := time.Duration(sum / count)
+		lines = append(lines, s.line("peer.latency", avg.Milliseconds(), "ms", peer))
+	}
+	return lines
+}
+
+// count 返回计数自上一次发送以来的增量，计数减少(例如缓存组被重新创建)时发送当前值
+func (s *StatsD) count(name string, total int64, tags ...string) string {
+	key := name + "|" + strings.Join(tags, ",")
+	delta := total - s.last[key]
+	if delta < 0 {
+		delta = total
+	}
+	s.last[key] = total
+	return s.line(name, delta, "c", tags...)
+}
+
+// line 按StatsD格式返回一行
+func (s *StatsD) line(name string, value int64, typ string, tags ...string) string {
+	prefix := s.Prefix
+	if prefix == "" {
+		prefix = defaultStatsDPrefix
+	}
+	var b strings.Builder
+	b.WriteString(prefix)
+	b.WriteString(name)
+	if !s.DogStatsD {
+		for _, t := range tags {
+			b.WriteByte('.')
+			b.WriteString(statsdSanitize(t[strings.IndexByte(t, ':')+1:]))
+		}
+	}
+	b.WriteByte(':')
+	b.WriteString(strconv.FormatInt(value, 10))
+	b.WriteByte('|')
+	b.WriteString(typ)
+	if s.DogStatsD && len(tags)+len(s.Tags) > 0 {
+		b.WriteString("|#")
+		b.WriteString(strings.Join(append(append([]string(nil), s.Tags...), tags...), ","))
+	}
+	return b.String()
+}
+
+// send 把多行合并成不超过 statsdMaxPacket 的数据包发送
+func (s *StatsD) send(lines []string) error {
+	var firstErr error
+	flush := func() {
+		if s.buf.Len() == 0 {
+			return
+		}
+		if _, err := s.conn.Write(s.buf.Bytes()); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		s.buf.Reset()
+	}
+	for _, l := range lines {
+		if s.buf.Len() > 0 && s.buf.Len()+1+len(l) > statsdMaxPacket {
+			flush()
+		}
+		if s.buf.Len() > 0 {
+			s.buf.WriteByte('\n')
+		}
+		s.buf.WriteString(l)
+	}
+	flush()
+	return firstErr
+}
+
+func (s *StatsD) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+}
+
+// statsdSanitize 把名称中StatsD的保留字符替换为下划线，用于拼接在指标名称中的维度
+var statsdSanitize = strings.NewReplacer(".", "_", ":", "_", "|", "_", "@", "_", " ", "_", "#", "_", ",", "_").Replace
@@ -0,0 +1,89 @@
+package gocache
+
+import (
+	"gocache/consistenthash"
+	"time"
+)
+
+// MigrationStats 记录一次拓扑变化后，本节点主缓存中数据归属的变化。
+// 这些数据由再平衡(rebalance)逻辑使用，也让运维人员了解拓扑变化带来的迁移成本。
+type MigrationStats struct {
+	Time     time.Time      // 统计时间，即拓扑变化的时间
+	Resident int            // 主缓存中的key数量
+	NotOwned int            // 本节点仍持有但已不再归属本节点的key数量
+	ByOwner  map[string]int // 不再归属本节点的key按新归属节点统计
+	Gained   int            // 拓扑变化前不归属、变化后归属本节点的已缓存key数量
+	Evicted  int            // 拓扑变化后已被渐进式清理删除的key数量，见 WithRebalance
+}
+
+// ownerOf 返回key在哈希环上的归属节点，哈希环为空时归属本节点
+func ownerOf(ring *consistenthash.Map, key string, self string) string {
+	if ring == nil {
+		return self
+	}
+	if owner := ring.Get(key); owner != "" {
+		return owner
+	}
+	return self
+}
+
+// computeMigration 对比新旧哈希环，统计缓存组主缓存中key的归属变化。按读路径索引的分片分批枚举key，
+// 不复制全部key也不占用缓存的锁，每批只持有一个分片的读锁，统计期间的写入可能被计入也可能不被计入
+func computeMigration(g *Group, self string, oldRing, newRing *consistenthash.Map) MigrationStats {
+	stats := MigrationStats{Time: time.Now(), ByOwner: map[string]int{}}
+	if g.mainCache == nil {
+		return stats
+	}
+	g.mainCache.rangeKeys(func(key string) bool {
+		stats.Resident++
+		oldOwner, newOwner := ownerOf(oldRing, key, self), ownerOf(newRing, key, self)
+		if newOwner != self {
+			stats.NotOwned++
+			stats.ByOwner[newOwner]++
+		} else if oldOwner != self {
+			stats.Gained++
+		}
+		return true
+	})
+	return stats
+}
+
+// allGroups 返回当前进程中所有的缓存组
+func allGroups() []*Group {
+	mu.RLock()
+	defer mu.RUnlock()
+	list := make([]*Group, 0, len(groups))
+	for _, g := range groups {
+		list = append(list, g)
+	}
+	return list
+}
+
+// updateMigrationStats 在哈希环变化后重新计算所有缓存组的迁移统计
+func (s *Server) updateMigrationStats(oldRing, newRing *consistenthash.Map) {
+	stats := make(map[string]MigrationStats)
+	for _, g := range allGroups() {
+		if !s.hasGroupRing(g.name) { // 单独指定了节点集合的缓存组不受公共哈希环变化的影响
+			stats[g.name] = computeMigration(g, s.self, oldRing, newRing)
+		}
+	}
+	s.mu.Lock()
+	for name, st := range s.migration {
+		if _, ok := stats[name]; !ok && s.groupRings[name] != nil {
+			stats[name] = st
+		}
+	}
+	s.migration = stats
+	s.mu.Unlock()
+}
+
+// MigrationStats 返回最近一次拓扑变化后各缓存组的迁移统计，键为缓存组名称
+func (s *Server) MigrationStats() map[string]MigrationStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats := make(map[string]MigrationStats, len(s.migration))
+	for name, st := range s.migration {
+		stats[name] = st
+	}
+	return stats
+}
@@ -0,0 +1,112 @@
+package gocache
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+
+	"gocache/replay"
+)
+
+// BuildVersion 本节点的构建版本，随节点元数据一起注册，可以在构建时设置：
+//
+//	go build -ldflags "-X gocache.BuildVersion=v1.2.3"
+var BuildVersion = "dev"
+
+// WithWeight 设置本节点在哈希环上的权重，权重为w的节点负责大约w倍的key，用于容量不同的节点混合部署。
+// 权重随元数据一起注册，开启 WithDiscovery 的节点发现本节点时按权重加入哈希环；w 小于等于1时为默认的权重1。
+func WithWeight(w int) ServerOption {
+	return func(s *Server) {
+		s.weight = w
+	}
+}
+
+// WithZone 设置本节点所在的可用区。PickPeers 返回的副本节点中同一可用区的节点排在前面，
+// 对冲读取等从副本读取数据的场景优先访问同一可用区的节点；归属节点不受影响。
+func WithZone(zone string) ServerOption {
+	return func(s *Server) {
+		s.zone = zone
+	}
+}
+
+// Metadata 返回本节点注册的元数据
+func (s *Server) Metadata() NodeMetadata {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.nodeMetadata()
+}
+
+// PeerMetadata 返回哈希环中其他节点的元数据，开启 WithDiscovery 时从注册中心读取，也可以通过 SetPeerMetadata 设置
+func (s *Server) PeerMetadata() map[string]NodeMetadata {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	peers := make(map[string]NodeMetadata, len(s.peerMeta))
+	for _, addr := range s.peers.Nodes() {
+		if md, ok := s.peerMeta[addr]; ok {
+			peers[addr] = md
+		}
+	}
+	return peers
+}
+
+// SetPeerMetadata 设置其他节点的元数据：按 Weight 调整节点在哈希环上的权重，按 Zone 决定副本节点的顺序。
+// 节点可以还没有加入哈希环，之后通过 Set 加入时使用该权重。
+func (s *Server) SetPeerMetadata(addr string, md NodeMetadata) {
+	s.mu.Lock()
+	if s.peerMeta == nil {
+		s.peerMeta = map[string]NodeMetadata{}
+	}
+	s.peerMeta[addr] = md
+	oldRing := s.peers.Clone()
+	s.peers.SetWeight(addr, md.Weight)
+	newRing := s.peers.Clone()
+	s.mu.Unlock()
+
+	if oldRing.Version() == newRing.Version() {
+		return
+	}
+	record(replay.Op{Type: replay.OpTopology, Nodes: newRing.Nodes()})
+	s.updateMigrationStats(oldRing, newRing)
+	s.notifyRing(oldRing, newRing)
+	s.startRebalance(newRing)
+}
+
+// metadataLookup 读取节点注册时携带的元数据，见 registry.MetadataResolver
+type metadataLookup func(ctx context.Context, service, addr string) (json.RawMessage, error)
+
+// loadPeerMetadata 从注册中心读取新发现的节点的元数据，读取失败的节点保持默认的权重
+func (s *Server) loadPeerMetadata(ctx context.Context, lookup metadataLookup, addrs []string) {
+	if lookup == nil {
+		return
+	}
+	for _, addr := range addrs {
+		if addr == s.self {
+			continue
+		}
+		raw, err := lookup(ctx, s.namespace, addr)
+		if err != nil || raw == nil {
+			if err != nil && ctx.Err() == nil {
+				s.logger.Warn("load peer metadata failed", "self", s.self, "peer", addr, "error", err)
+			}
+			continue
+		}
+		var md NodeMetadata
+		if err := json.Unmarshal(raw, &md); err != nil {
+			s.logger.Warn("invalid peer metadata", "self", s.self, "peer", addr, "error", err)
+			continue
+		}
+		s.SetPeerMetadata(addr, md)
+	}
+}
+
+// sortByZone 把与本节点在同一可用区的节点稳定地排到前面，没有设置可用区时不改变顺序
+func (s *Server) sortByZone(addrs []string) {
+	if s.zone == "" {
+		return
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	sort.SliceStable(addrs, func(i, j int) bool {
+		return s.peerMeta[addrs[i]].Zone == s.zone && s.peerMeta[addrs[j]].Zone != s.zone
+	})
+}
@@ -0,0 +1,63 @@
+package gocache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestNodeMetadata(t *testing.T) {
+	svr, err := NewServer("10.0.0.1:8001", WithWeight(2), WithZone("us-east-1a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	md := svr.Metadata()
+	if md.Weight != 2 || md.Zone != "us-east-1a" || md.Version != BuildVersion || md.Protocol != protocolVersion || !(Capabilities{Features: md.Features}).Has(CapWrite) {
+		t.Fatalf("unexpected metadata %+v", md)
+	}
+	raw, _ := json.Marshal(md)
+	var decoded NodeMetadata
+	if err := json.Unmarshal(raw, &decoded); err != nil || decoded.Zone != md.Zone || len(decoded.Features) != len(md.Features) {
+		t.Fatalf("metadata does not round trip: %s", raw)
+	}
+}
+
+func TestPeerMetadata(t *testing.T) {
+	svr, _ := NewServer("10.0.0.1:8001", WithZone("a"), WithMissingPeerPolicy(MissingPeerError))
+	peers := []string{"10.0.0.1:8001", "10.0.0.2:8001", "10.0.0.3:8001", "10.0.0.4:8001"}
+	svr.Set(peers...)
+	defer svr.closeClients()
+
+	// 注册中心中的元数据按权重调整哈希环
+	lookup := func(ctx context.Context, service, addr string) (json.RawMessage, error) {
+		switch addr {
+		case "10.0.0.2:8001":
+			return json.RawMessage(`{"scheme":"plain","weight":3,"zone":"b"}`), nil
+		case "10.0.0.3:8001":
+			return json.RawMessage(`{"scheme":"plain","zone":"a"}`), nil
+		}
+		return nil, errors.New("not registered")
+	}
+	svr.loadPeerMetadata(context.Background(), lookup, peers)
+	if w := svr.peers.Weight("10.0.0.2:8001"); w != 3 {
+		t.Fatalf("expect weight 3, got %d", w)
+	}
+	if len(svr.peers.VirtualNodes()) != 6*defaultReplicas {
+		t.Fatalf("expect %d virtual nodes, got %d", 6*defaultReplicas, len(svr.peers.VirtualNodes()))
+	}
+	if md := svr.PeerMetadata(); len(md) != 2 || md["10.0.0.3:8001"].Zone != "a" {
+		t.Fatalf("unexpected peer metadata %+v", md)
+	}
+
+	// 同一可用区的副本节点排在前面
+	for _, key := range []string{"Tom", "Jack", "Sam", "k1", "k2"} {
+		picked, _ := svr.PickPeers(key, len(peers))
+		if len(picked) != 3 {
+			t.Fatalf("expect 3 remote replicas, got %d", len(picked))
+		}
+		if addr := picked[0].(*Client).peerAddr(); addr != "10.0.0.3:8001" {
+			t.Fatalf("key %s: expect the same-zone peer first, got %s", key, addr)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package gocache
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Outcome 一次读取的结果
+type Outcome string
+
+const (
+	OutcomeHit      Outcome = "hit"       // 命中本节点的主缓存或热点缓存
+	OutcomeLoad     Outcome = "load"      // 未命中，从数据源或远程节点加载成功
+	OutcomeNotFound Outcome = "not_found" // key不存在，见 ErrNotFound
+	OutcomeError    Outcome = "error"     // 读取失败
+)
+
+// GetResult 一次读取的结果，传给 Observer.AfterGet
+type GetResult struct {
+	Group   string
+	Key     string
+	Outcome Outcome
+	Source  Source        // 数据的来源，读取失败时为空
+	Latency time.Duration // 从 BeforeGet 之后到读取结束的耗时
+	Size    int           // 数据的字节数
+	Err     error
+}
+
+// Observer 观察缓存组的每一次读取，用于自定义指标、审计日志、采样等，见 WithObservers。
+// 本节点处理的读取都会通知，包括其他节点转发来的请求。方法在读取的goroutine中同步调用，应当尽快返回。
+type Observer interface {
+	// BeforeGet 在读取开始前调用，返回的上下文用于这次读取和对应的 AfterGet，例如携带采样决定
+	BeforeGet(ctx context.Context, group, key string) context.Context
+	// AfterGet 在读取结束后调用
+	AfterGet(ctx context.Context, r GetResult)
+}
+
+// ObserverFuncs 用函数实现 Observer，为nil的函数不调用
+type ObserverFuncs struct {
+	Before func(ctx context.Context, group, key string) context.Context
+	After  func(ctx context.Context, r GetResult)
+}
+
+// BeforeGet 实现了 Observer
+func (f ObserverFuncs) BeforeGet(ctx context.Context, group, key string) context.Context {
+	if f.Before == nil {
+		return ctx
+	}
+	return f.Before(ctx, group, key)
+}
+
+// AfterGet 实现了 Observer
+func (f ObserverFuncs) AfterGet(ctx context.Context, r GetResult) {
+	if f.After != nil {
+		f.After(ctx, r)
+	}
+}
+
+// WithObservers 追加观察读取的 Observer：BeforeGet 按传入的顺序调用，AfterGet 按相反的顺序调用，与中间件相同
+func WithObservers(obs ...Observer) GroupOption {
+	return func(g *Group) {
+		g.observers = append(g.observers, obs...)
+	}
+}
+
+// beforeGet 依次调用 Observer.BeforeGet，返回读取使用的上下文
+func (g *Group) beforeGet(ctx context.Context, key string) context.Context {
+	for _, o := range g.observers {
+		ctx = o.BeforeGet(ctx, g.name, key)
+	}
+	return ctx
+}
+
+// afterGet 按相反的顺序调用 Observer.AfterGet
+func (g *Group) afterGet(ctx context.Context, key string, start time.Time, v ByteView, info GetInfo, err error) {
+	r := GetResult{Group: g.name, Key: key, Latency: time.Since(start), Size: v.Len(), Err: err}
+	switch {
+	case err == nil && (info.Source == SourceMainCache || info.Source == SourceHotCache):
+		r.Outcome, r.Source = OutcomeHit, info.Source
+	case err == nil:
+		r.Outcome, r.Source = OutcomeLoad, info.Source
+	case errors.Is(err, ErrNotFound):
+		r.Outcome = OutcomeNotFound
+	default:
+		r.Outcome = OutcomeError
+	}
+	for i := len(g.observers) - 1; i >= 0; i-- {
+		g.observers[i].AfterGet(ctx, r)
+	}
+}
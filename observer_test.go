@@ -0,0 +1,55 @@
+package gocache
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+type observerKey struct{}
+
+func TestObservers(t *testing.T) {
+	var calls []string
+	var results []GetResult
+	outer := ObserverFuncs{
+		Before: func(ctx context.Context, group, key string) context.Context {
+			calls = append(calls, "outer.before")
+			return context.WithValue(ctx, observerKey{}, "sampled")
+		},
+		After: func(ctx context.Context, r GetResult) {
+			calls = append(calls, "outer.after")
+			if ctx.Value(observerKey{}) != "sampled" {
+				t.Error("AfterGet did not receive the context from BeforeGet")
+			}
+			results = append(results, r)
+		},
+	}
+	inner := ObserverFuncs{After: func(ctx context.Context, r GetResult) { calls = append(calls, "inner.after") }}
+
+	g := NewGroup("observers", 2<<10, "lru", GetterFunc(func(key string) ([]byte, error) {
+		if key == "bad" {
+			return nil, fmt.Errorf("source down")
+		}
+		return []byte(key), nil
+	}), WithObservers(outer, inner))
+
+	g.GetCacheData("k")
+	g.GetCacheData("k")
+	g.GetCacheData("bad")
+
+	if want := []string{"outer.before", "inner.after", "outer.after"}; fmt.Sprint(calls[:3]) != fmt.Sprint(want) {
+		t.Errorf("calls = %v, want %v first", calls, want)
+	}
+	if len(results) != 3 {
+		t.Fatalf("results = %+v", results)
+	}
+	if r := results[0]; r.Outcome != OutcomeLoad || r.Source != SourceLocalLoad || r.Size != 1 || r.Key != "k" {
+		t.Errorf("first get = %+v", r)
+	}
+	if r := results[1]; r.Outcome != OutcomeHit || r.Source == "" {
+		t.Errorf("second get = %+v", r)
+	}
+	if r := results[2]; r.Outcome != OutcomeError || r.Err == nil || r.Source != "" {
+		t.Errorf("failed get = %+v", r)
+	}
+}
@@ -0,0 +1,229 @@
+package gocache
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"time"
+)
+
+// httpListener 随服务启动和停止的HTTP监听，用于 WithOpsListener 和 WithAdminListener。字段由 s.mu 保护
+type httpListener struct {
+	addr string
+	lis  net.Listener
+	srv  *http.Server
+}
+
+// start 开始监听并在后台提供handler，name 用于错误和日志
+func (l *httpListener) start(s *Server, name string, handler http.Handler) error {
+	lis, err := net.Listen("tcp", l.addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen %s: %v", name, err)
+	}
+	srv := &http.Server{Handler: handler, ReadHeaderTimeout: 10 * time.Second}
+	l.lis, l.srv = lis, srv
+	go func() {
+		if err := srv.Serve(lis); err != nil && err != http.ErrServerClosed {
+			s.reportErr(fmt.Errorf("%s listener: %v", name, err))
+		}
+	}()
+	s.logger.Info(name+" listener started", "self", s.self, "addr", lis.Addr().String())
+	return nil
+}
+
+// stop 关闭监听和所有连接
+func (l *httpListener) stop() {
+	if l.srv == nil {
+		return
+	}
+	l.srv.Close()
+	l.lis, l.srv = nil, nil
+}
+
+// address 返回实际监听的地址，没有在监听时返回空字符串
+func (l *httpListener) address() string {
+	if l == nil || l.lis == nil {
+		return ""
+	}
+	return l.lis.Addr().String()
+}
+
+// WithOpsListener 开启运维调试端口：服务启动时在addr(与gRPC端口分开，例如 "127.0.0.1:6060")上提供 OpsHandler 中的
+// /debug/pprof、/debug/ring、/debug/groups 和 /debug/dashboard(见 WithDashboard)，停止时关闭。这些接口没有鉴权，应当只监听内网或本机地址。
+// addr 为空表示不开启(默认)。
+func WithOpsListener(addr string) ServerOption {
+	return func(s *Server) {
+		if addr == "" {
+			s.ops = nil
+			return
+		}
+		s.ops = &httpListener{addr: addr}
+	}
+}
+
+// OpsAddr 返回运维调试端口实际监听的地址，没有开启或服务没有运行时返回空字符串
+func (s *Server) OpsAddr() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.ops.address()
+}
+
+// OpsHandler 返回运维调试接口，可以挂载到已有的HTTP服务上，不需要 WithOpsListener：
+//
+//	/debug/pprof/         Go运行时的性能分析，与 net/http/pprof 相同
+//	/debug/ring           哈希环的快照(RingState)，?key=xxx 返回key的归属节点
+//	/debug/groups         每个缓存组的配置和统计，?name=xxx 只返回指定的缓存组
+//	/debug/dashboard/     网页控制台，/debug/dashboard/data 返回控制台的数据(DashboardData)，需要 WithDashboard
+func (s *Server) OpsHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.HandleFunc("/debug/ring", s.serveRing)
+	mux.HandleFunc("/debug/groups", serveGroups)
+	if s.dashboard != nil {
+		mux.HandleFunc("/debug/dashboard/", serveDashboard)
+		mux.HandleFunc("/debug/dashboard/data", func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, s.DashboardData())
+		})
+	}
+	return mux
+}
+
+// startListeners 在服务启动时开始监听运维调试端口和管理接口的端口，调用时需持有 s.mu
+func (s *Server) startListeners() error {
+	if s.ops != nil {
+		if err := s.ops.start(s, "ops", s.OpsHandler()); err != nil {
+			return err
+		}
+	}
+	if s.admin != nil {
+		if err := s.admin.start(s, "admin", s.AdminHandler(s.adminToken)); err != nil {
+			s.stopListeners()
+			return err
+		}
+	}
+	return nil
+}
+
+// stopListeners 关闭运维调试端口和管理接口的端口，调用时需持有 s.mu
+func (s *Server) stopListeners() {
+	for _, l := range []*httpListener{s.ops, s.admin} {
+		if l != nil {
+			l.stop()
+		}
+	}
+}
+
+// serveRing 返回哈希环的快照或者一个key的归属节点
+func (s *Server) serveRing(w http.ResponseWriter, r *http.Request) {
+	if key := r.URL.Query().Get("key"); key != "" {
+		writeJSON(w, s.Owner(key))
+		return
+	}
+	writeJSON(w, s.RingState())
+}
+
+// GroupDebug 是 /debug/groups 返回的一个缓存组
+type GroupDebug struct {
+	Config GroupConfig `json:"config"`
+	Stats  GroupStats  `json:"stats"`
+}
+
+// serveGroups 返回缓存组的配置和统计
+func serveGroups(w http.ResponseWriter, r *http.Request) {
+	groups := Groups()
+	if name := r.URL.Query().Get("name"); name != "" {
+		g := GetGroup(name)
+		if g == nil {
+			http.Error(w, fmt.Sprintf("group %q not found", name), http.StatusNotFound)
+			return
+		}
+		groups = []*Group{g}
+	}
+	out := make([]GroupDebug, 0, len(groups))
+	for _, g := range groups {
+		out = append(out, GroupDebug{Config: g.Config(), Stats: g.Stats()})
+	}
+	writeJSON(w, out)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+// GroupConfig 缓存组的配置，耗时以纳秒序列化，0表示没有开启对应的功能
+type GroupConfig struct {
+	Name            string        `json:"name"`
+	CacheType       string        `json:"cache_type"` // lru 或 lfu
+	Capacity        int64         `json:"capacity"`
+	DefaultTTL      time.Duration `json:"default_ttl"`
+	ErrorCacheTTL   time.Duration `json:"error_cache_ttl"`      // 见 WithErrorCacheTTL
+	LeaseTTL        time.Duration `json:"lease_ttl"`            // 见 WithLeases
+	PeerTimeout     time.Duration `json:"peer_timeout"`         // 见 WithPeerTimeout
+	HedgeDelay      time.Duration `json:"hedge_delay"`          // 见 WithHedging
+	SlowLoad        time.Duration `json:"slow_load"`            // 见 WithSlowLog
+	Compression     string        `json:"compression"`          // 见 WithCompression
+	LoadWorkers     int           `json:"load_workers"`         // 见 WithLoadPool
+	LoadLimited     bool          `json:"load_limited"`         // 是否设置了 WithLoadLimiter
+	KeyHeat         bool          `json:"key_heat"`             // 是否统计热点key，见 WithKeyHeat
+	HotKeyThreshold int64         `json:"hot_key_threshold"`    // 见 WithHotKeyThreshold
+	Transforms      int           `json:"transforms"`           // 见 WithTransforms
+	Fallback        int           `json:"fallback"`             // 见 WithFallback
+	Observers       int           `json:"observers"`            // 见 WithObservers
+	MemoryPriority  int           `json:"memory_priority"`      // 在内存预算中的优先级，0表示没有加入内存预算，见 WithMemoryBudget
+	SlabSize        int           `json:"slab_size"`            // 见 WithSlabAllocator
+	EvictLow        float64       `json:"evict_low_watermark"`  // 见 WithEvictionWatermarks
+	EvictHigh       float64       `json:"evict_high_watermark"` // 0表示不在后台淘汰
+}
+
+// Config 返回缓存组的配置
+func (g *Group) Config() GroupConfig {
+	c := GroupConfig{
+		Name:            g.name,
+		Capacity:        g.mainCache.capacity(),
+		DefaultTTL:      time.Duration(g.defaultTTL.Get()),
+		HotKeyThreshold: g.hotThreshold.Get(),
+		PeerTimeout:     g.peerTimeout,
+		HedgeDelay:      g.hedgeDelay,
+		Compression:     g.compression,
+		LoadLimited:     g.limiter != nil,
+		KeyHeat:         g.heat != nil,
+		Transforms:      len(g.transforms),
+		Fallback:        len(g.fallback),
+		Observers:       len(g.observers),
+		MemoryPriority:  g.budgetPriority,
+	}
+	if g.slabs != nil {
+		c.SlabSize = g.slabs.size
+	}
+	if w := evictionWatermarks(g.mainCache); w != nil {
+		c.EvictLow, c.EvictHigh = w.low, w.high
+	}
+	switch g.mainCache.(type) {
+	case *LRUcache:
+		c.CacheType = "lru"
+	case *LFUcache:
+		c.CacheType = "lfu"
+	}
+	if g.loadErrs != nil {
+		c.ErrorCacheTTL = g.loadErrs.ttl
+	}
+	if g.leases != nil {
+		c.LeaseTTL = g.leases.ttl
+	}
+	if g.slow != nil {
+		c.SlowLoad = g.slow.threshold
+	}
+	if g.pool != nil {
+		c.LoadWorkers = g.pool.workers
+	}
+	return c
+}
@@ -0,0 +1,153 @@
+package gocache
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOpsListener(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := lis.Addr().String()
+	lis.Close()
+	svr, err := NewServer(addr, WithStaticPeers(addr), WithOpsListener("127.0.0.1:0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	go svr.Start()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for svr.OpsAddr() == "" {
+		if time.Now().After(deadline) {
+			t.Fatal("ops listener not started")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	opsAddr := svr.OpsAddr()
+	resp, err := http.Get("http://" + opsAddr + "/debug/pprof/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("pprof status = %d", resp.StatusCode)
+	}
+	var ring RingState
+	resp, err = http.Get("http://" + opsAddr + "/debug/ring")
+	if err != nil {
+		t.Fatal(err)
+	}
+	json.NewDecoder(resp.Body).Decode(&ring)
+	resp.Body.Close()
+	if ring.Self != addr || len(ring.Nodes) != 1 {
+		t.Fatalf("ring = %+v", ring)
+	}
+
+	svr.Stop()
+	if svr.OpsAddr() != "" {
+		t.Error("ops listener still open after Stop")
+	}
+	if _, err := http.Get("http://" + opsAddr + "/debug/ring"); err == nil {
+		t.Error("ops listener still serving after Stop")
+	}
+}
+
+func TestOpsGroups(t *testing.T) {
+	NewGroup("ops", 2<<10, "lfu", GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}), WithDefaultTTL(time.Minute), WithErrorCacheTTL(time.Second), WithKeyHeat(16, time.Minute))
+	GetGroup("ops").GetCacheData("k")
+	svr, _ := NewServer("127.0.0.1:9709")
+	h := svr.OpsHandler()
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/debug/groups?name=ops", nil))
+	var groups []GroupDebug
+	if err := json.Unmarshal(rec.Body.Bytes(), &groups); err != nil || len(groups) != 1 {
+		t.Fatalf("groups = %s, %v", rec.Body, err)
+	}
+	want := GroupConfig{Name: "ops", CacheType: "lfu", Capacity: 2 << 10, DefaultTTL: time.Minute, ErrorCacheTTL: time.Second, KeyHeat: true, HotKeyThreshold: 10}
+	if groups[0].Config != want || groups[0].Stats.LocalLoads != 1 {
+		t.Errorf("group = %+v", groups[0])
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/debug/groups?name=missing", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("missing group status = %d", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/debug/ring?key=k", nil))
+	if rec.Code != http.StatusOK || rec.Body.Len() == 0 {
+		t.Errorf("owner status = %d", rec.Code)
+	}
+}
+
+func TestDashboard(t *testing.T) {
+	g := NewGroup("dashboard", 64, "lru", GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}))
+	svr, _ := NewServer("127.0.0.1:9710", WithDashboard(2))
+	svr.Set("127.0.0.1:9710")
+	h := svr.OpsHandler()
+	svr.startDashboard()
+	defer svr.stopDashboard()
+
+	g.GetCacheData("k0")
+	g.GetCacheData("k0")
+	for i := 1; i <= 8; i++ {
+		g.Set(fmt.Sprintf("key-%d", i), make([]byte, 20), 0)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for len(svr.DashboardData().Evictions) < 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("evictions not recorded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/debug/dashboard/data", nil))
+	var data DashboardData
+	if err := json.Unmarshal(rec.Body.Bytes(), &data); err != nil {
+		t.Fatalf("data = %s, %v", rec.Body, err)
+	}
+	if len(data.Nodes) != 1 || !data.Nodes[0].Self || data.Nodes[0].Keyspace != 1 {
+		t.Errorf("nodes = %+v", data.Nodes)
+	}
+	var dg *DashboardGroup
+	for i := range data.Groups {
+		if data.Groups[i].Name == "dashboard" {
+			dg = &data.Groups[i]
+		}
+	}
+	if dg == nil || dg.CacheType != "lru" || dg.HitRatio != 0.5 || dg.Evictions == 0 {
+		t.Errorf("group = %+v", dg)
+	}
+	// 只保留最近的2条，从新到旧排列
+	if ev := data.Evictions; len(ev) != 2 || ev[0].Group != "dashboard" || ev[0].Time.Before(ev[1].Time) {
+		t.Errorf("evictions = %+v", ev)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/debug/dashboard/", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "<title>gocache dashboard</title>") {
+		t.Errorf("page status = %d", rec.Code)
+	}
+
+	// 没有开启时不提供控制台
+	svr, _ = NewServer("127.0.0.1:9711")
+	rec = httptest.NewRecorder()
+	svr.OpsHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/debug/dashboard/", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("dashboard without WithDashboard status = %d", rec.Code)
+	}
+}
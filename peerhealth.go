@@ -0,0 +1,183 @@
+package gocache
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// peerProbe 对其他节点的健康检查，见 WithPeerHealthCheck。字段由 s.mu 保护
+type peerProbe struct {
+	interval  time.Duration
+	threshold int
+	failures  map[string]int  // 哈希环中的节点连续失败的次数
+	evicted   map[string]bool // 因健康检查失败被移出哈希环的节点，恢复后重新加入
+	cancel    context.CancelFunc
+}
+
+// WithPeerHealthCheck 开启对其他节点的健康检查：每隔 interval 通过标准的gRPC健康检查探测哈希环中的节点，
+// 连续 threshold 次失败的节点被移出哈希环并关闭客户端(与 Remove 相同)，请求不再路由到该节点；
+// 之后继续探测，恢复时重新加入哈希环(与 Set 相同)。被 Remove 或注册中心移除的节点不再探测。
+// 只作用于 Set 设置的公共节点集合，缓存组单独的节点集合(见 SetGroup)不受影响。interval 小于等于0或 threshold 小于1时不检查。
+func WithPeerHealthCheck(interval time.Duration, threshold int) ServerOption {
+	return func(s *Server) {
+		if interval <= 0 || threshold < 1 {
+			s.probe = nil
+			return
+		}
+		s.probe = &peerProbe{interval: interval, threshold: threshold, failures: map[string]int{}, evicted: map[string]bool{}}
+	}
+}
+
+// EvictedPeers 返回因健康检查失败被移出哈希环的节点，已经排序
+func (s *Server) EvictedPeers() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.probe == nil {
+		return nil
+	}
+	peers := make([]string, 0, len(s.probe.evicted))
+	for addr := range s.probe.evicted {
+		peers = append(peers, addr)
+	}
+	sort.Strings(peers)
+	return peers
+}
+
+// startProbe 在后台定期检查其他节点，调用时需持有 s.mu
+func (s *Server) startProbe() {
+	if s.probe == nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s.probe.cancel = cancel
+	go func() {
+		ticker := time.NewTicker(s.probe.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			s.checkPeers(ctx)
+		}
+	}()
+}
+
+// stopProbe 停止检查其他节点，已经移出哈希环的节点保持移出，重新启动后继续探测，调用时需持有 s.mu
+func (s *Server) stopProbe() {
+	if s.probe != nil && s.probe.cancel != nil {
+		s.probe.cancel()
+		s.probe.cancel = nil
+	}
+}
+
+// forgetProbe 节点被 Set 或 Remove 显式修改后清除其健康检查状态，调用时需持有 s.mu
+func (s *Server) forgetProbe(peersAddr []string) {
+	if s.probe == nil {
+		return
+	}
+	for _, addr := range peersAddr {
+		delete(s.probe.failures, addr)
+		delete(s.probe.evicted, addr)
+	}
+}
+
+// checkPeers 并发地探测一轮哈希环中的节点和已经移出的节点，移出连续失败的节点，重新加入恢复的节点
+func (s *Server) checkPeers(ctx context.Context) {
+	type target struct {
+		addr    string
+		client  *Client
+		evicted bool
+	}
+	s.mu.RLock()
+	var targets []target
+	for _, addr := range s.peers.Nodes() {
+		if addr != s.self {
+			targets = append(targets, target{addr: addr, client: s.clients[addr]})
+		}
+	}
+	for addr := range s.probe.evicted {
+		targets = append(targets, target{addr: addr, evicted: true})
+	}
+	timeout := s.probe.interval
+	s.mu.RUnlock()
+
+	errs := make([]error, len(targets))
+	var wg sync.WaitGroup
+	for i, t := range targets {
+		wg.Add(1)
+		go func(i int, t target) {
+			defer wg.Done()
+			client := t.client
+			if client == nil { // 已经移出的节点没有客户端，使用临时的客户端探测
+				s.mu.RLock()
+				client = s.newClient(t.addr)
+				s.mu.RUnlock()
+				defer client.Close()
+			}
+			errs[i] = client.checkHealth(ctx, timeout)
+		}(i, t)
+	}
+	wg.Wait()
+	if ctx.Err() != nil { // 停止之后不再修改哈希环
+		return
+	}
+
+	var evict, recovered []string
+	s.mu.Lock()
+	for i, t := range targets {
+		switch {
+		case t.evicted && errs[i] == nil && s.probe.evicted[t.addr]:
+			recovered = append(recovered, t.addr)
+		case t.evicted:
+		case errs[i] == nil:
+			delete(s.probe.failures, t.addr)
+		default:
+			s.probe.failures[t.addr]++
+			if n := s.probe.failures[t.addr]; n >= s.probe.threshold {
+				s.logger.Warn("peer failed health checks", "self", s.self, "peer", t.addr, "failures", n, "error", errs[i])
+				evict = append(evict, t.addr)
+			}
+		}
+	}
+	s.mu.Unlock()
+
+	if len(evict) > 0 {
+		s.Remove(evict...)
+		s.mu.Lock()
+		for _, addr := range evict {
+			s.probe.evicted[addr] = true
+		}
+		s.mu.Unlock()
+		s.logger.Info("evicted unhealthy peers", "self", s.self, "peers", evict)
+	}
+	if len(recovered) > 0 {
+		s.logger.Info("peers recovered", "self", s.self, "peers", recovered)
+		s.Set(recovered...)
+	}
+}
+
+// checkHealth 通过标准的gRPC健康检查确认远程节点正在提供服务，超过timeout视为失败
+func (c *Client) checkHealth(ctx context.Context, timeout time.Duration) error {
+	conn, release, err := c.dial()
+	if err != nil {
+		return err
+	}
+	defer release()
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{Service: groupCacheService})
+	if err != nil {
+		return err
+	}
+	if resp.Status != healthpb.HealthCheckResponse_SERVING {
+		return fmt.Errorf("peer %s is %s", c.peerAddr(), resp.Status)
+	}
+	return nil
+}
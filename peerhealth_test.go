@@ -0,0 +1,65 @@
+package gocache
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPeerHealthCheck(t *testing.T) {
+	b, _ := NewServer("127.0.0.1:0")
+	bAddr, stop := serveGRPC(t, b)
+	defer stop()
+	b.setServing(true)
+
+	self := "127.0.0.1:9711"
+	a, err := NewServer(self, WithStaticPeers(self, bAddr), WithPeerHealthCheck(time.Second, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.closeClients()
+	ctx := context.Background()
+	ring := func() []string {
+		nodes := a.peers.Nodes()
+		if len(nodes) == 2 && nodes[0] != self {
+			nodes[0], nodes[1] = nodes[1], nodes[0]
+		}
+		return nodes
+	}
+
+	a.checkPeers(ctx)
+	if !reflect.DeepEqual(ring(), []string{self, bAddr}) {
+		t.Fatalf("healthy peer evicted: ring = %v", ring())
+	}
+
+	// 连续失败达到阈值后移出哈希环并关闭客户端
+	b.setServing(false)
+	a.checkPeers(ctx)
+	if !reflect.DeepEqual(ring(), []string{self, bAddr}) || len(a.EvictedPeers()) != 0 {
+		t.Fatalf("peer evicted after one failure: ring = %v", ring())
+	}
+	a.checkPeers(ctx)
+	if !reflect.DeepEqual(ring(), []string{self}) || !reflect.DeepEqual(a.EvictedPeers(), []string{bAddr}) {
+		t.Fatalf("ring = %v, evicted = %v", ring(), a.EvictedPeers())
+	}
+	if _, ok := a.clients[bAddr]; ok {
+		t.Fatal("expect the client of the evicted peer to be closed")
+	}
+
+	// 恢复后重新加入
+	b.setServing(true)
+	a.checkPeers(ctx)
+	if !reflect.DeepEqual(ring(), []string{self, bAddr}) || len(a.EvictedPeers()) != 0 {
+		t.Fatalf("recovered peer not re-added: ring = %v, evicted = %v", ring(), a.EvictedPeers())
+	}
+
+	// 显式移除的节点不再探测
+	b.setServing(false)
+	a.checkPeers(ctx)
+	a.checkPeers(ctx)
+	a.Remove(bAddr)
+	if len(a.EvictedPeers()) != 0 {
+		t.Fatalf("removed peer still probed: %v", a.EvictedPeers())
+	}
+}
@@ -1,12 +1,29 @@
 package gocache
 
-import pb "gocache/gocachepb"
+import (
+	"context"
+	pb "gocache/gocachepb"
+)
 
 // PeerPicker 定义了获取分布式节点的能力,根据key返回了一个节点
 type PeerPicker interface { // 查应该去哪个节点，返回值也是节点
 	PickPeer(key string) (peer PeerGetter, ok bool)
 }
 
+// PeersPicker 是 PeerPicker 的可选扩展，按哈希环的顺序返回key的n个副本节点，用于数据复制和对冲读取。
+// 返回的 peers 不包含本节点，local 表示本节点是否在这n个副本节点之中。
+type PeersPicker interface {
+	PeerPicker
+	PickPeers(key string, n int) (peers []PeerGetter, local bool)
+}
+
+// GroupPeerPicker 是 PeerPicker 的可选扩展，按缓存组选择节点，使不同的缓存组可以分布在不同的节点集合上。
+// 缓存组注册的 PeerPicker 实现了该接口时，使用 PickGroupPeer 代替 PickPeer。
+type GroupPeerPicker interface {
+	PeerPicker
+	PickGroupPeer(group, key string) (peer PeerGetter, ok bool)
+}
+
 // PeerGetter is the interface that must be implemented by a peer.
 // PeerGetter 定义了从远端获取缓存的能力
 // 所以每个Peer应实现这个接口
@@ -14,3 +31,23 @@ type PeerPicker interface { // 查应该去哪个节点，返回值也是节点
 type PeerGetter interface { // 这个返回的数数据
 	Get(in *pb.Request, out *pb.Response) error // 用于从对应的group中查找缓存值
 }
+
+// PeerWriter 是 PeerGetter 的可选扩展，向远程节点写入数据或者删除远程节点上缓存的key，用于写入和失效路径
+type PeerWriter interface {
+	PeerGetter
+	Put(in *pb.PutRequest) error
+	Delete(in *pb.DeleteRequest) (deleted bool, err error)
+}
+
+// PeerLeaser 是 PeerGetter 的可选扩展，在key的归属节点上获取、回填或放弃租约，见 Group.GetLease
+type PeerLeaser interface {
+	PeerGetter
+	Lease(ctx context.Context, in *pb.LeaseRequest) (*pb.LeaseResponse, error)
+}
+
+// PeerWatcher 是 PeerGetter 的可选扩展，订阅远程节点上key的失效通知。
+// 从远程节点取回的数据放入热点缓存后，请求方通过它关注该key，key在归属节点上被写入或删除时从热点缓存中删除副本。
+type PeerWatcher interface {
+	PeerGetter
+	Watch(group, key string) error
+}
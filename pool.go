@@ -0,0 +1,149 @@
+package gocache
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrLoadQueueFull 加载池的等待队列已满时返回，调用者可以稍后重试
+var ErrLoadQueueFull = errors.New("gocache: load queue is full")
+
+// errLoadGoexit getter 在worker中调用了 runtime.Goexit
+var errLoadGoexit = errors.New("gocache: getter called runtime.Goexit")
+
+// loadPool 是缓存组私有的数据源加载工作池：固定数量的worker复用goroutine执行getter，
+// 待执行的加载在有界队列中排队，队列满时立即拒绝。
+// 数据源变慢时，执行getter的goroutine数量不会随请求量无限增长。
+// 缓存组关闭后worker执行完已排队的加载后退出，之后的加载在调用者的goroutine中直接执行。
+type loadPool struct {
+	workers int
+	tasks   chan func()   // 已提交的加载，关闭后worker退出
+	slots   chan struct{} // 容量为 workers+queue，获取不到说明worker都在忙且队列已满
+	once    sync.Once
+	mu      sync.RWMutex // 保护 closed，提交加载时持有读锁，避免向已关闭的 tasks 发送
+	closed  bool
+
+	active    AtomicInt // 正在执行的加载数量
+	rejected  AtomicInt // 因队列已满被拒绝的加载次数
+	completed AtomicInt // 已完成的加载次数
+}
+
+// LoadPoolStats 是加载池状态的快照
+type LoadPoolStats struct {
+	Workers   int   // worker数量
+	Active    int64 // 正在执行的加载数量
+	Queued    int   // 排队等待的加载数量
+	Rejected  int64 // 因队列已满被拒绝的加载次数
+	Completed int64 // 已完成的加载次数
+}
+
+// WithLoadPool 使用workers个worker执行该缓存组的数据源加载，最多queue个加载排队等待。
+// 与 WithLoadLimiter 可以同时使用：限流器限制跨缓存组的并发，工作池限制本组的goroutine数量。
+func WithLoadPool(workers, queue int) GroupOption {
+	return func(g *Group) {
+		if workers <= 0 {
+			return
+		}
+		if queue < 0 {
+			queue = 0
+		}
+		g.pool = &loadPool{
+			workers: workers,
+			tasks:   make(chan func(), workers+queue),
+			slots:   make(chan struct{}, workers+queue),
+		}
+	}
+}
+
+// start 启动worker，第一次提交加载时调用
+func (p *loadPool) start() {
+	for i := 0; i < p.workers; i++ {
+		go p.worker()
+	}
+}
+
+func (p *loadPool) worker() {
+	for task := range p.tasks {
+		task()
+	}
+}
+
+// close 关闭任务队列，worker执行完已排队的加载后退出，可以多次调用
+func (p *loadPool) close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.closed {
+		p.closed = true
+		close(p.tasks)
+	}
+}
+
+// loadResult 是在worker中执行getter的结果
+type loadResult struct {
+	bytes []byte
+	ttl   time.Duration
+	err   error
+	panic interface{}
+}
+
+// run 在worker中执行fn并等待结果，队列已满时返回 ErrLoadQueueFull。
+// fn 中的panic会在调用者的goroutine中重新抛出，与直接调用getter的行为一致；
+// fn 调用 runtime.Goexit 时返回 errLoadGoexit，并启动新的worker代替退出的worker。
+func (p *loadPool) run(fn func() ([]byte, time.Duration, error)) ([]byte, time.Duration, error) {
+	done := make(chan loadResult, 1)
+	task := func() {
+		p.active.Add(1)
+		var res loadResult
+		normalReturn := false
+		defer func() {
+			if r := recover(); r != nil {
+				res.panic = r
+			} else if !normalReturn { // 既没有正常返回也没有panic，说明调用了 runtime.Goexit
+				res.err = errLoadGoexit
+				go p.worker()
+			}
+			p.active.Add(-1)
+			p.completed.Add(1)
+			done <- res
+		}()
+		res.bytes, res.ttl, res.err = fn()
+		normalReturn = true
+	}
+	p.mu.RLock()
+	if p.closed {
+		p.mu.RUnlock()
+		return fn()
+	}
+	p.once.Do(p.start)
+	select {
+	case p.slots <- struct{}{}:
+	default:
+		p.mu.RUnlock()
+		p.rejected.Add(1)
+		return nil, 0, ErrLoadQueueFull
+	}
+	p.tasks <- task // 占用了槽位，tasks 一定有空间
+	p.mu.RUnlock()
+	res := <-done
+	<-p.slots
+	if res.panic != nil {
+		panic(res.panic)
+	}
+	return res.bytes, res.ttl, res.err
+}
+
+// LoadPoolStats 返回加载池的状态，没有通过 WithLoadPool 开启时返回零值
+func (g *Group) LoadPoolStats() LoadPoolStats {
+	p := g.pool
+	if p == nil {
+		return LoadPoolStats{}
+	}
+	return LoadPoolStats{
+		Workers:   p.workers,
+		Active:    p.active.Get(),
+		Queued:    len(p.tasks),
+		Rejected:  p.rejected.Get(),
+		Completed: p.completed.Get(),
+	}
+}
@@ -0,0 +1,97 @@
+package gocache
+
+import (
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLoadPoolQueueAndReject(t *testing.T) {
+	started := make(chan string, 3)
+	release := make(chan struct{})
+	g := NewGroup("pool", 2<<10, "lru", GetterFunc(
+		func(key string) ([]byte, error) {
+			started <- key
+			<-release
+			return []byte(key), nil
+		}), WithLoadPool(1, 1))
+
+	errs := make(chan error, 2)
+	load := func(key string) {
+		_, err := g.GetCacheData(key)
+		errs <- err
+	}
+	go load("a")
+	<-started // a 占用唯一的worker
+	go load("b")
+	for g.LoadPoolStats().Queued != 1 { // b 在队列中等待
+		time.Sleep(time.Millisecond)
+	}
+
+	if _, err := g.GetCacheData("c"); err != ErrLoadQueueFull {
+		t.Fatalf("expect ErrLoadQueueFull, got %v", err)
+	}
+	if st := g.LoadPoolStats(); st.Workers != 1 || st.Active != 1 || st.Rejected != 1 {
+		t.Fatalf("unexpected stats %+v", st)
+	}
+
+	close(release)
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if st := g.LoadPoolStats(); st.Completed != 2 || st.Active != 0 || st.Queued != 0 {
+		t.Fatalf("unexpected stats after completion %+v", st)
+	}
+}
+
+func TestLoadPoolPanic(t *testing.T) {
+	g := NewGroup("pool-panic", 2<<10, "lru", GetterFunc(
+		func(key string) ([]byte, error) { panic("boom") }), WithLoadPool(1, 0))
+	defer func() {
+		if r := recover(); r == nil {
+			t.Fatal("getter panic should propagate to the caller")
+		}
+		if st := g.LoadPoolStats(); st.Completed != 1 {
+			t.Fatalf("worker should survive the panic, stats %+v", st)
+		}
+	}()
+	g.GetCacheData("k")
+}
+
+func TestLoadPoolGoexit(t *testing.T) {
+	var calls int32
+	g := NewGroup("pool-goexit", 2<<10, "lru", GetterFunc(
+		func(key string) ([]byte, error) {
+			if atomic.AddInt32(&calls, 1) == 1 {
+				runtime.Goexit()
+			}
+			return []byte("v"), nil
+		}), WithLoadPool(1, 0))
+	if _, err := g.GetCacheData("k"); err == nil {
+		t.Fatal("expect an error when the getter calls runtime.Goexit")
+	}
+	// 没有缓存空值，退出的worker被替换
+	if v, err := g.GetCacheData("k"); err != nil || v.String() != "v" {
+		t.Fatalf("GetCacheData = %q, %v", v.String(), err)
+	}
+}
+
+func TestLoadPoolClose(t *testing.T) {
+	before := runtime.NumGoroutine()
+	g := NewGroup("pool-close", 2<<10, "lru", GetterFunc(
+		func(key string) ([]byte, error) { return []byte("v"), nil }), WithLoadPool(8, 0))
+	g.GetCacheData("a")
+	g.Close()
+	for deadline := time.Now().Add(time.Second); runtime.NumGoroutine() > before; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("workers did not exit: %d goroutines, %d before", runtime.NumGoroutine(), before)
+		}
+	}
+	// 关闭后加载在调用者的goroutine中执行
+	if v, err := g.GetCacheData("b"); err != nil || v.String() != "v" {
+		t.Fatalf("GetCacheData after Close = %q, %v", v.String(), err)
+	}
+}
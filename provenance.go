@@ -0,0 +1,58 @@
+package gocache
+
+import (
+	"context"
+	pb "gocache/gocachepb"
+	"time"
+)
+
+// Source 数据的来源
+type Source string
+
+const (
+	SourceHotCache  Source = "hot_cache"  // 本节点的热点缓存
+	SourceMainCache Source = "main_cache" // 本节点的主缓存
+	SourceLocalLoad Source = "local_load" // 本节点的数据源，刚刚加载
+	SourcePeer      Source = "peer"       // 远程节点
+)
+
+// GetInfo 描述一次读取得到的数据从哪里来、有多新，用于判断数据是否足够新以及排查缓存行为
+type GetInfo struct {
+	Source Source    // 数据在本节点的来源
+	Added  time.Time // 数据写入缓存的时间，来自远程节点时为写入远程节点缓存的时间
+	Expire time.Time // 过期时间，零值表示永不过期
+
+	// 以下字段只在 Source 为 SourcePeer 时有效
+	Node       string // 提供数据的远程节点
+	PeerSource Source // 数据在远程节点上的来源
+}
+
+// Age 返回数据写入缓存至今的时长，写入时间未知时返回0
+func (i GetInfo) Age() time.Duration {
+	if i.Added.IsZero() {
+		return 0
+	}
+	return time.Since(i.Added)
+}
+
+// GetWithInfo 与 GetContext 相同，同时返回数据的来源、写入时间和过期时间
+func (g *Group) GetWithInfo(ctx context.Context, key string) (ByteView, GetInfo, error) {
+	v, info, err := g.getStoredInfo(ctx, key)
+	if err != nil {
+		return ByteView{}, info, err
+	}
+	v, err = g.decode(key, v)
+	return v, info, err
+}
+
+// peerInfo 根据远程节点的响应构造数据的来源，v1响应没有这些字段
+func peerInfo(res *pb.Response) GetInfo {
+	info := GetInfo{Source: SourcePeer, Node: res.Node, PeerSource: Source(res.Source)}
+	if res.Added != 0 {
+		info.Added = time.Unix(0, res.Added)
+	}
+	if res.ExpiresAt != 0 {
+		info.Expire = time.Unix(0, res.ExpiresAt)
+	}
+	return info
+}
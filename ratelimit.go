@@ -0,0 +1,193 @@
+package gocache
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// overloadedPrefix 限流和过载保护拒绝请求时错误信息的前缀。
+// 两者都返回 codes.ResourceExhausted，请求方据此与超过消息大小限制的错误区分，后者会改用 GetStream 重试。
+const overloadedPrefix = "gocache: overloaded"
+
+// maxTrackedCallers 按请求方限流时最多跟踪的请求方数量，超过后清理已经空闲的令牌桶，
+// 清理后仍然超过时新的请求方共用一个令牌桶，伪造大量来源不会让内存无限增长
+const maxTrackedCallers = 4096
+
+// WithRateLimit 限制读取请求(Get、BatchGet、GetStream、Scan)的速率：每秒qps个请求，最多允许burst个突发请求。
+// perCaller 为true时按请求方分别限制(双向TLS时为客户端证书的 CommonName，否则为连接的来源IP)，否则限制整个节点的速率。
+// 请求中的 caller 由客户端填写，可以随意伪造，不用于限流。
+// 超过限制的请求返回 codes.ResourceExhausted。
+func WithRateLimit(qps float64, burst int, perCaller bool) ServerOption {
+	return func(s *Server) {
+		s.SetRateLimit(qps, burst, perCaller)
+	}
+}
+
+// WithLoadShedding 同时处理的读取请求达到maxInFlight时，新的请求直接返回 codes.ResourceExhausted，
+// 避免节点过载时请求排队导致所有请求超时
+func WithLoadShedding(maxInFlight int64) ServerOption {
+	return func(s *Server) {
+		s.maxInFlight.Set(maxInFlight)
+	}
+}
+
+// SetRateLimit 在运行时修改读取请求的速率限制，参数见 WithRateLimit，qps 小于等于0表示不限制。
+// 修改后令牌桶重新开始计算，已经在处理的请求不受影响
+func (s *Server) SetRateLimit(qps float64, burst int, perCaller bool) {
+	if qps <= 0 {
+		s.rateLimit.Store(nil)
+		return
+	}
+	s.rateLimit.Store(newRateLimiter(qps, burst, perCaller))
+}
+
+// SetLoadShedding 在运行时修改同时处理的读取请求上限，见 WithLoadShedding，0表示不限制
+func (s *Server) SetLoadShedding(maxInFlight int64) {
+	s.maxInFlight.Set(maxInFlight)
+}
+
+// LimitStats 限流和过载保护的统计
+type LimitStats struct {
+	InFlight    int64 `json:"in_flight"`    // 正在处理的读取请求数
+	RateLimited int64 `json:"rate_limited"` // 因超过速率限制被拒绝的请求数
+	Shed        int64 `json:"shed"`         // 因节点过载被拒绝的请求数
+}
+
+// LimitStats 返回限流和过载保护的统计
+func (s *Server) LimitStats() LimitStats {
+	return LimitStats{
+		InFlight:    s.inFlight.Get(),
+		RateLimited: s.rateLimited.Get(),
+		Shed:        s.shed.Get(),
+	}
+}
+
+// IsOverloaded 返回err是否是远程节点因限流或过载拒绝请求的错误，调用方应当稍后重试或者改为本地加载
+func IsOverloaded(err error) bool {
+	st, ok := status.FromError(err)
+	return ok && st.Code() == codes.ResourceExhausted && strings.HasPrefix(st.Message(), overloadedPrefix)
+}
+
+// admit 检查读取请求是否可以被处理，允许时返回请求结束后需要调用的函数。请求方按连接的身份区分，见 peerIdentity
+func (s *Server) admit(ctx context.Context) (func(), error) {
+	if limit := s.rateLimit.Load(); limit != nil {
+		caller := peerIdentity(ctx)
+		if !limit.allow(caller, time.Now()) {
+			s.rateLimited.Add(1)
+			return nil, status.Errorf(codes.ResourceExhausted, "%s: rate limit exceeded for %s", overloadedPrefix, caller)
+		}
+	}
+	s.inFlight.Add(1)
+	if max := s.maxInFlight.Get(); max > 0 && s.inFlight.Get() > max {
+		s.inFlight.Add(-1)
+		s.shed.Add(1)
+		return nil, status.Errorf(codes.ResourceExhausted, "%s: %d requests in flight", overloadedPrefix, max)
+	}
+	return func() { s.inFlight.Add(-1) }, nil
+}
+
+// peerIdentity 返回连接的身份：双向TLS时为客户端证书的 CommonName，否则为来源IP
+func peerIdentity(ctx context.Context) string {
+	if p, ok := peer.FromContext(ctx); ok {
+		if info, ok := p.AuthInfo.(credentials.TLSInfo); ok && len(info.State.PeerCertificates) > 0 {
+			if cn := info.State.PeerCertificates[0].Subject.CommonName; cn != "" {
+				return "cn:" + cn
+			}
+		}
+	}
+	return peerHost(ctx)
+}
+
+// peerHost 返回连接的来源IP，无法获取时返回空字符串
+func peerHost(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
+
+// rateLimiter 令牌桶限流器，可以限制总速率或者按请求方分别限制
+type rateLimiter struct {
+	qps       float64
+	burst     float64
+	perCaller bool
+
+	mu      sync.Mutex
+	global  tokenBucket
+	callers map[string]*tokenBucket
+}
+
+func newRateLimiter(qps float64, burst int, perCaller bool) *rateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	l := &rateLimiter{qps: qps, burst: float64(burst), perCaller: perCaller, callers: map[string]*tokenBucket{}}
+	l.global = tokenBucket{tokens: l.burst}
+	return l
+}
+
+// allow 消耗caller的一个令牌，没有令牌时返回false。跟踪的请求方已满时，新的请求方使用共同的令牌桶
+func (l *rateLimiter) allow(caller string, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.perCaller {
+		return l.global.take(l.qps, l.burst, now)
+	}
+	b := l.callers[caller]
+	if b == nil {
+		if len(l.callers) >= maxTrackedCallers {
+			l.prune(now)
+		}
+		if len(l.callers) >= maxTrackedCallers {
+			return l.global.take(l.qps, l.burst, now)
+		}
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.callers[caller] = b
+	}
+	return b.take(l.qps, l.burst, now)
+}
+
+// prune 删除已经回满的令牌桶，它们与新建的令牌桶没有区别，调用时需持有 l.mu
+func (l *rateLimiter) prune(now time.Time) {
+	full := time.Duration(l.burst / l.qps * float64(time.Second))
+	for caller, b := range l.callers {
+		if now.Sub(b.last) >= full {
+			delete(l.callers, caller)
+		}
+	}
+}
+
+// tokenBucket 令牌桶，按速率补充令牌，最多积累burst个
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// take 补充令牌后消耗一个，没有令牌时返回false
+func (b *tokenBucket) take(qps, burst float64, now time.Time) bool {
+	if !b.last.IsZero() {
+		b.tokens += now.Sub(b.last).Seconds() * qps
+		if b.tokens > burst {
+			b.tokens = burst
+		}
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
@@ -0,0 +1,109 @@
+package gocache
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	pb "gocache/gocachepb"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+func TestRateLimit(t *testing.T) {
+	now := time.Now()
+	l := newRateLimiter(10, 2, true)
+	if !l.allow("a", now) || !l.allow("a", now) || l.allow("a", now) {
+		t.Fatal("expect burst of 2 for caller a")
+	}
+	if !l.allow("b", now) {
+		t.Fatal("callers should be limited separately")
+	}
+	if !l.allow("a", now.Add(100*time.Millisecond)) || l.allow("a", now.Add(100*time.Millisecond)) {
+		t.Fatal("expect one token after 100ms at 10 qps")
+	}
+
+	// 跟踪的请求方已满时，新的请求方共用一个令牌桶
+	l = newRateLimiter(10, 2, true)
+	for i := 0; i < maxTrackedCallers; i++ {
+		l.allow(fmt.Sprint(i), now)
+	}
+	if !l.allow("x", now) || !l.allow("y", now) || l.allow("z", now) || len(l.callers) != maxTrackedCallers {
+		t.Fatalf("expect new callers to share one bucket, tracking %d callers", len(l.callers))
+	}
+
+	svr, _ := NewServer("127.0.0.1:9841", WithRateLimit(1, 1, false))
+	ctx := context.Background()
+	done, err := svr.admit(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done()
+	if _, err := svr.admit(ctx); !IsOverloaded(err) || tooLarge(err) {
+		t.Fatalf("expect overloaded error, got %v", err)
+	}
+	if _, err := svr.Scan(ctx, &pb.ScanRequest{Group: "scan"}); !IsOverloaded(err) {
+		t.Fatalf("expect Scan to be rate limited, got %v", err)
+	}
+	if st := svr.LimitStats(); st.RateLimited != 2 || st.InFlight != 0 {
+		t.Fatalf("unexpected stats %+v", st)
+	}
+
+	svr.SetRateLimit(0, 0, false) // 运行时关闭限流
+	for i := 0; i < 3; i++ {
+		done, err := svr.admit(ctx)
+		if err != nil {
+			t.Fatalf("rate limit should be disabled, got %v", err)
+		}
+		done()
+	}
+}
+
+func TestLoadShedding(t *testing.T) {
+	svr, _ := NewServer("127.0.0.1:9842", WithLoadShedding(1))
+	ctx := context.Background()
+	done, err := svr.admit(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svr.admit(ctx); !IsOverloaded(err) {
+		t.Fatalf("expect request to be shed, got %v", err)
+	}
+	done()
+	if done, err := svr.admit(ctx); err != nil {
+		t.Fatal(err)
+	} else {
+		done()
+	}
+	if st := svr.LimitStats(); st.Shed != 1 || st.InFlight != 0 {
+		t.Fatalf("unexpected stats %+v", st)
+	}
+
+	svr.SetLoadShedding(2)
+	done1, _ := svr.admit(ctx)
+	done2, err := svr.admit(ctx)
+	if err != nil {
+		t.Fatalf("expect the raised limit to admit two requests, got %v", err)
+	}
+	done1()
+	done2()
+}
+
+func TestPeerIdentity(t *testing.T) {
+	addr := &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5000}
+	ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: addr})
+	if id := peerIdentity(ctx); id != "10.0.0.1" {
+		t.Fatalf("peerIdentity = %q, want the source IP", id)
+	}
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "svc-a"}}
+	info := credentials.TLSInfo{State: tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}}
+	ctx = peer.NewContext(context.Background(), &peer.Peer{Addr: addr, AuthInfo: info})
+	if id := peerIdentity(ctx); id != "cn:svc-a" {
+		t.Fatalf("peerIdentity = %q, want the client certificate", id)
+	}
+}
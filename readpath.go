@@ -0,0 +1,201 @@
+package gocache
+
+import (
+	"container/heap"
+	"hash/maphash"
+	"math/rand"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	indexShards   = 64 // 只读索引的分片数
+	accessStripes = 16 // 访问记录的分段数
+	accessBatch   = 64 // 每个分段攒够这么多次访问后批量更新淘汰顺序
+)
+
+var indexSeed = maphash.MakeSeed()
+
+// cacheItem 是只读索引中的一条数据，写入后不再修改，覆盖时替换为新的 cacheItem
+type cacheItem struct {
+	key    string
+	value  ByteView
+	hits   atomic.Int64 // 命中次数，覆盖时继承
+	queued atomic.Int32 // 尚未补记的访问次数，大于0时已经在某个访问记录分段中
+}
+
+// expired 返回数据是否已经过期，没有过期时间时不读取当前时间
+func (it *cacheItem) expired() bool {
+	return !it.value.e.IsZero() && it.value.e.Before(time.Now())
+}
+
+// readPath 是 LRUcache 和 LFUcache 的读路径，读取不需要获取缓存的锁：
+//
+//   - 分片的只读索引与底层的 lru/lfu 保存相同的数据，get、peek、stat 只读取 key 所在的分片，
+//     不同key的读取互不影响；写入和淘汰在持有缓存写锁时同步更新索引。
+//   - lru 的 Get 需要移动链表节点，lfu 的 Get 需要调整堆，都要独占缓存。命中时只把数据追加到一个访问记录分段中，
+//     已经在分段中等待补记的数据只累加次数，热点key不会占满分段；分段攒满一批后尝试获取缓存的写锁，
+//     一次性补记到底层的淘汰顺序中，写锁正被占用时丢弃这一批，只影响淘汰顺序的精度，不影响读取的结果和命中次数。
+//     写入、淘汰等操作在持有写锁时先补记所有尚未处理的访问。
+type readPath struct {
+	shards  [indexShards]indexShard
+	stripes [accessStripes]accessStripe
+}
+
+type indexShard struct {
+	mu    sync.RWMutex
+	items map[string]*cacheItem
+	_     [32]byte // 填充到缓存行大小，避免相邻分片的伪共享
+}
+
+type accessStripe struct {
+	mu      sync.Mutex
+	items   []*cacheItem
+	pending atomic.Int32 // len(items)，flush 不加锁就能跳过空的分段
+	_       [28]byte
+}
+
+// promoter 把一批访问补记到底层的淘汰顺序中，由 LRUcache 和 LFUcache 实现。
+// 每条数据的访问次数由 it.queued.Swap(0) 取得
+type promoter interface {
+	// tryPromote 在拿到写锁时补记并返回true，拿不到时返回false
+	tryPromote(items []*cacheItem) bool
+	// touchLocked 补记访问，调用时持有写锁
+	touchLocked(items []*cacheItem)
+}
+
+func (r *readPath) shard(key string) *indexShard {
+	return &r.shards[maphash.String(indexSeed, key)%indexShards]
+}
+
+// load 返回key在索引中的数据，不存在时返回nil
+func (r *readPath) load(key string) *cacheItem {
+	s := r.shard(key)
+	s.mu.RLock()
+	it := s.items[key]
+	s.mu.RUnlock()
+	return it
+}
+
+// store 写入或覆盖key，覆盖时保留命中次数，调用时持有缓存的写锁
+func (r *readPath) store(key string, value ByteView) {
+	it := &cacheItem{key: key, value: value}
+	s := r.shard(key)
+	s.mu.Lock()
+	if s.items == nil {
+		s.items = make(map[string]*cacheItem)
+	}
+	if old := s.items[key]; old != nil {
+		it.hits.Store(old.hits.Load())
+	}
+	s.items[key] = it
+	s.mu.Unlock()
+}
+
+// delete 删除key，调用时持有缓存的写锁
+func (r *readPath) delete(key string) {
+	s := r.shard(key)
+	s.mu.Lock()
+	delete(s.items, key)
+	s.mu.Unlock()
+}
+
+// rangeKeys 逐个分片枚举索引中的key，顺序不确定，fn 返回false时停止。每次只持有一个分片的读锁，不需要缓存的锁，
+// 分片之间释放锁，枚举期间的写入和删除可能被反映也可能不被反映。fn 在持有分片的读锁时调用，不能写入缓存
+func (r *readPath) rangeKeys(fn func(key string) bool) {
+	for i := range r.shards {
+		s := &r.shards[i]
+		s.mu.RLock()
+		for key := range s.items {
+			if !fn(key) {
+				s.mu.RUnlock()
+				return
+			}
+		}
+		s.mu.RUnlock()
+	}
+}
+
+// scanKeys 按字典序返回第shard个分片中排在after之后的至多n个key，after 为空时从分片的第一个key开始。
+// 只持有这一个分片的读锁，用于分页枚举，见 Group.Scan
+func (r *readPath) scanKeys(shard int, after string, n int) []string {
+	if n <= 0 {
+		return nil
+	}
+	s := &r.shards[shard]
+	s.mu.RLock()
+	top := make(keyHeap, 0, min(n, len(s.items))) // 最大堆，保留最小的n个key
+	for key := range s.items {
+		if key <= after {
+			continue
+		}
+		if len(top) < n {
+			heap.Push(&top, key)
+		} else if key < top[0] {
+			top[0] = key
+			heap.Fix(&top, 0)
+		}
+	}
+	s.mu.RUnlock()
+	sort.Strings(top)
+	return top
+}
+
+// keyHeap 是key的最大堆
+type keyHeap []string
+
+func (h keyHeap) Len() int            { return len(h) }
+func (h keyHeap) Less(i, j int) bool  { return h[i] > h[j] }
+func (h keyHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *keyHeap) Push(x interface{}) { *h = append(*h, x.(string)) }
+func (h *keyHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// hit 记录一次命中，所在分段攒满一批时交给p补记
+func (r *readPath) hit(it *cacheItem, p promoter) {
+	it.hits.Add(1)
+	if it.queued.Add(1) > 1 { // 已经在等待补记
+		return
+	}
+	s := &r.stripes[rand.Intn(accessStripes)]
+	s.mu.Lock()
+	s.items = append(s.items, it)
+	if len(s.items) >= accessBatch {
+		if !p.tryPromote(s.items) {
+			for _, it := range s.items {
+				it.queued.Store(0)
+			}
+		}
+		s.reset()
+	} else {
+		s.pending.Store(int32(len(s.items)))
+	}
+	s.mu.Unlock()
+}
+
+// flush 补记所有分段中的访问，调用时持有缓存的写锁
+func (r *readPath) flush(p promoter) {
+	for i := range r.stripes {
+		s := &r.stripes[i]
+		if s.pending.Load() == 0 {
+			continue
+		}
+		s.mu.Lock()
+		p.touchLocked(s.items)
+		s.reset()
+		s.mu.Unlock()
+	}
+}
+
+// reset 清空分段，调用时持有 s.mu
+func (s *accessStripe) reset() {
+	clear(s.items) // 不再引用已经处理的数据
+	s.items = s.items[:0]
+	s.pending.Store(0)
+}
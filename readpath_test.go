@@ -0,0 +1,226 @@
+package gocache
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"gocache/lfu"
+	"gocache/lru"
+)
+
+func TestReadPath(t *testing.T) {
+	for _, c := range []BaseCache{&LRUcache{cacheBytes: 12}, &LFUcache{cacheBytes: 12}} {
+		c.add("k1", ByteView{b: []byte("1111")})
+		c.add("k2", ByteView{b: []byte("2222")})
+		for i := 0; i < 3; i++ {
+			if v, ok := c.get("k1"); !ok || v.String() != "1111" {
+				t.Fatalf("%T get k1 = %q, %v", c, v.String(), ok)
+			}
+		}
+		if _, hits, ok := c.stat("k1"); !ok || hits != 3 {
+			t.Fatalf("%T k1 hits = %d, want 3", c, hits)
+		}
+		// 尚未补记的访问在写入前补记，k1 被访问过，淘汰的是 k2
+		c.add("k3", ByteView{b: []byte("3333")})
+		if _, ok := c.peek("k2"); ok {
+			t.Fatalf("%T k2 should be evicted", c)
+		}
+		if _, ok := c.get("k1"); !ok {
+			t.Fatalf("%T k1 was evicted", c)
+		}
+		c.add("k1", ByteView{b: []byte("1")}) // 覆盖时保留命中次数
+		if _, hits, _ := c.stat("k1"); hits != 4 {
+			t.Fatalf("%T k1 hits after overwrite = %d, want 4", c, hits)
+		}
+		c.remove("k1")
+		if _, ok := c.get("k1"); ok {
+			t.Fatalf("%T k1 was removed", c)
+		}
+		c.add("ttl", ByteView{b: []byte("v"), e: time.Now().Add(-time.Second)})
+		if _, ok := c.get("ttl"); ok {
+			t.Fatalf("%T expired value returned", c)
+		}
+		if _, _, ok := c.stat("ttl"); ok {
+			t.Fatalf("%T expired value not removed", c)
+		}
+	}
+}
+
+func TestRangeKeys(t *testing.T) {
+	for _, c := range []BaseCache{&LRUcache{}, &LFUcache{}} {
+		for i := 0; i < 1000; i++ {
+			c.add("k"+strconv.Itoa(i), ByteView{b: []byte("v")})
+		}
+		// 不需要缓存的锁：写锁被占用时仍然可以枚举
+		var mu *sync.RWMutex
+		switch c := c.(type) {
+		case *LRUcache:
+			mu = &c.mu
+		case *LFUcache:
+			mu = &c.mu
+		}
+		mu.Lock()
+		seen := map[string]bool{}
+		c.rangeKeys(func(key string) bool {
+			if seen[key] {
+				t.Fatalf("%T key %s visited twice", c, key)
+			}
+			seen[key] = true
+			return true
+		})
+		if len(seen) != 1000 {
+			t.Fatalf("%T visited %d keys, want 1000", c, len(seen))
+		}
+		n := 0
+		c.rangeKeys(func(string) bool {
+			n++
+			return n < 10
+		})
+		if n != 10 {
+			t.Fatalf("%T visited %d keys after stopping at 10", c, n)
+		}
+		mu.Unlock()
+	}
+}
+
+func TestReadPathConcurrent(t *testing.T) {
+	for _, c := range []BaseCache{&LRUcache{cacheBytes: 1 << 10}, &LFUcache{cacheBytes: 1 << 10}} {
+		var wg sync.WaitGroup
+		for w := 0; w < 8; w++ {
+			wg.Add(1)
+			go func(w int) {
+				defer wg.Done()
+				for i := 0; i < 2000; i++ {
+					key := strconv.Itoa(i % 100)
+					switch {
+					case i%10 == w:
+						c.add(key, ByteView{b: []byte(key)})
+					case i%97 == 0:
+						c.remove(key)
+					default:
+						if v, ok := c.get(key); ok && v.String() != key {
+							t.Errorf("%T get %s = %q", c, key, v.String())
+							return
+						}
+					}
+				}
+			}(w)
+		}
+		wg.Wait()
+		// 索引与底层缓存一致
+		keys := c.keys()
+		n := 0
+		for _, key := range keys {
+			if _, _, ok := c.stat(key); !ok {
+				t.Fatalf("%T key %s missing from index", c, key)
+			}
+		}
+		for i := 0; i < 100; i++ {
+			if _, _, ok := c.stat(strconv.Itoa(i)); ok {
+				n++
+			}
+		}
+		if n != len(keys) {
+			t.Fatalf("%T index has %d keys, cache has %d", c, n, len(keys))
+		}
+	}
+}
+
+// lockedCache 是改用 readPath 之前的读路径：每次读取都独占缓存以更新淘汰顺序，作为基准测试的对照
+type lockedCache struct {
+	mu    sync.Mutex
+	addFn func(key string, value ByteView)
+	getFn func(key string) (interface{ Len() int }, bool)
+}
+
+func newLockedLRU() *lockedCache {
+	c := lru.New(0, nil)
+	return &lockedCache{
+		addFn: func(key string, value ByteView) { c.Add(key, value, value.Expire()) },
+		getFn: func(key string) (interface{ Len() int }, bool) { return c.Get(key) },
+	}
+}
+
+func newLockedLFU() *lockedCache {
+	c := lfu.New(0, nil)
+	return &lockedCache{
+		addFn: func(key string, value ByteView) { c.Add(key, value, value.Expire()) },
+		getFn: func(key string) (interface{ Len() int }, bool) { return c.Get(key) },
+	}
+}
+
+func (c *lockedCache) add(key string, value ByteView) {
+	c.mu.Lock()
+	c.addFn(key, value)
+	c.mu.Unlock()
+}
+
+func (c *lockedCache) get(key string) (ByteView, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if v, ok := c.getFn(key); ok {
+		return v.(ByteView), true
+	}
+	return ByteView{}, false
+}
+
+// BenchmarkCacheGet 对比 readPath 与每次读取都加锁的缓存在并发读取(以及少量写入)时的吞吐量，
+// 使用 -cpu 1,4,16 观察随并发度的变化：加锁的读取在多核上互相等待，readPath 的读取只在访问记录攒满一批时争用写锁
+func BenchmarkCacheGet(b *testing.B) {
+	const keys = 1 << 14
+	type cache interface {
+		add(key string, value ByteView)
+		get(key string) (ByteView, bool)
+	}
+	caches := []struct {
+		name string
+		new  func() cache
+	}{
+		{"locked-lru", func() cache { return newLockedLRU() }},
+		{"lru", func() cache { return &LRUcache{} }},
+		{"locked-lfu", func() cache { return newLockedLFU() }},
+		{"lfu", func() cache { return &LFUcache{} }},
+	}
+	names := make([]string, keys)
+	for i := range names {
+		names[i] = "key-" + strconv.Itoa(i)
+	}
+	for _, workload := range []struct {
+		name       string
+		writeEvery int  // 每多少次操作写入一次，0表示只读
+		hot        bool // 所有操作集中在一个key上
+	}{
+		{"read", 0, false},
+		{"read-hot", 0, true},
+		{"read90-write10", 10, false},
+	} {
+		for _, cache := range caches {
+			b.Run(workload.name+"/"+cache.name, func(b *testing.B) {
+				c := cache.new()
+				value := ByteView{b: make([]byte, 64)}
+				for _, key := range names {
+					c.add(key, value)
+				}
+				b.ResetTimer()
+				b.RunParallel(func(pb *testing.PB) {
+					i := 0
+					for pb.Next() {
+						i++
+						key := names[(i*7919)%keys]
+						if workload.hot {
+							key = names[0]
+						}
+						if workload.writeEvery > 0 && i%workload.writeEvery == 0 {
+							c.add(key, value)
+						} else if _, ok := c.get(key); !ok {
+							b.Errorf("missing %s", key)
+							return
+						}
+					}
+				})
+			})
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package gocache
+
+import (
+	"gocache/consistenthash"
+	"sort"
+	"time"
+)
+
+// WithRebalance 开启拓扑变化后的渐进式清理：每隔interval从每个缓存组的主缓存中
+// 最多删除batch个已不再归属本节点的key，优先删除最冷的数据，直到全部清理完毕。
+// 这样既不会让旧的归属节点长期浪费内存，也避免了一次性清空带来的抖动。
+func WithRebalance(interval time.Duration, batch int) ServerOption {
+	return func(s *Server) {
+		s.rebalanceInterval = interval
+		s.rebalanceBatch = batch
+	}
+}
+
+// startRebalance 在哈希环变化后启动清理任务，旧的清理任务会在下一轮检查时退出
+func (s *Server) startRebalance(ring *consistenthash.Map) {
+	if s.rebalanceInterval <= 0 || s.rebalanceBatch <= 0 {
+		return
+	}
+	s.mu.Lock()
+	s.rebalanceGen++
+	gen := s.rebalanceGen
+	s.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(s.rebalanceInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			s.mu.Lock()
+			stale := s.rebalanceGen != gen
+			s.mu.Unlock()
+			if stale { // 拓扑再次变化或服务停止
+				return
+			}
+			if s.evictNotOwned(ring) == 0 {
+				s.logger.Info("rebalance finished", "self", s.self)
+				return
+			}
+		}
+	}()
+}
+
+// stopRebalance 停止正在进行的清理任务，调用时需持有 s.mu
+func (s *Server) stopRebalance() {
+	s.rebalanceGen++
+}
+
+// rebalanceSample 每轮从不再归属本节点的key中最多取 rebalanceBatch 的这么多倍作为候选，从中删除最冷的
+const rebalanceSample = 4
+
+// evictNotOwned 从每个缓存组中删除最多 rebalanceBatch 个不再归属本节点的key，返回删除的数量。
+// 候选通过 rangeKeys 收集，不需要复制全部的key，再按命中次数和写入时间挑选最冷的删除
+func (s *Server) evictNotOwned(ring *consistenthash.Map) int {
+	total := 0
+	for _, g := range allGroups() {
+		if g.mainCache == nil || s.hasGroupRing(g.name) {
+			continue
+		}
+		var candidates []string
+		g.mainCache.rangeKeys(func(key string) bool {
+			if ownerOf(ring, key, s.self) != s.self {
+				candidates = append(candidates, key)
+			}
+			return len(candidates) < s.rebalanceBatch*rebalanceSample
+		})
+		evicted := 0
+		for _, key := range coldestKeys(g.mainCache, candidates, s.rebalanceBatch) {
+			g.mainCache.remove(key)
+			evicted++
+		}
+		if evicted > 0 {
+			s.mu.Lock()
+			if st, ok := s.migration[g.name]; ok {
+				st.Evicted += evicted
+				s.migration[g.name] = st
+			}
+			s.mu.Unlock()
+		}
+		total += evicted
+	}
+	return total
+}
+
+// coldestKeys 返回keys中最冷的n个：命中次数少的优先，相同时写入早的优先。已经不在缓存中的key被忽略
+func coldestKeys(c BaseCache, keys []string, n int) []string {
+	type candidate struct {
+		key   string
+		added time.Time
+		hits  int64
+	}
+	list := make([]candidate, 0, len(keys))
+	for _, key := range keys {
+		if added, hits, ok := c.stat(key); ok {
+			list = append(list, candidate{key, added, hits})
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].hits != list[j].hits {
+			return list[i].hits < list[j].hits
+		}
+		return list[i].added.Before(list[j].added)
+	})
+	if len(list) > n {
+		list = list[:n]
+	}
+	cold := make([]string, len(list))
+	for i, c := range list {
+		cold[i] = c.key
+	}
+	return cold
+}
@@ -0,0 +1,47 @@
+package gocache
+
+import (
+	"gocache/replay"
+	"io"
+	"sync"
+)
+
+// 当前的操作录制，nil表示没有在录制
+var (
+	recordMu sync.RWMutex
+	recorder *replay.Recorder
+)
+
+// StartRecording 开始将本进程的缓存操作(读取、写入、哈希环变化)录制到w，用于问题报告，
+// 日志中的key经过哈希处理。之前的录制会被直接替换，应当先调用 StopRecording。
+func StartRecording(w io.Writer) {
+	recordMu.Lock()
+	recorder = replay.NewRecorder(w)
+	recordMu.Unlock()
+}
+
+// StopRecording 停止录制并将缓冲的日志写出，返回录制过程中遇到的第一个错误
+func StopRecording() error {
+	recordMu.Lock()
+	r := recorder
+	recorder = nil
+	recordMu.Unlock()
+	if r == nil {
+		return nil
+	}
+	return r.Flush()
+}
+
+// record 在录制时记录一条操作
+func record(op replay.Op) {
+	recordMu.RLock()
+	r := recorder
+	recordMu.RUnlock()
+	if r == nil {
+		return
+	}
+	if op.Key != "" {
+		op.Key = replay.HashKey(op.Key)
+	}
+	r.Record(op)
+}
@@ -0,0 +1,83 @@
+package registry
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// 没有通过参数指定etcd配置时读取的环境变量
+const (
+	EnvEtcdEndpoints   = "GOCACHE_ETCD_ENDPOINTS"    // 逗号分隔的etcd地址
+	EnvEtcdUsername    = "GOCACHE_ETCD_USERNAME"     // etcd用户名
+	EnvEtcdPassword    = "GOCACHE_ETCD_PASSWORD"     // etcd密码
+	EnvEtcdDialTimeout = "GOCACHE_ETCD_DIAL_TIMEOUT" // 连接etcd的超时时间，例如 5s
+	EnvEtcdCert        = "GOCACHE_ETCD_CERT"         // 连接etcd使用的客户端证书文件，与 GOCACHE_ETCD_KEY 一起设置
+	EnvEtcdKey         = "GOCACHE_ETCD_KEY"          // 客户端证书的私钥文件
+	EnvEtcdCA          = "GOCACHE_ETCD_CA"           // 校验etcd服务端证书的CA文件，设置任意一个TLS变量即开启TLS
+)
+
+// getenv 读取环境变量，测试时可以替换
+var getenv = os.Getenv
+
+// DefaultEtcdConfig 返回默认的etcd配置：localhost:2379，不认证，连接超时5秒
+func DefaultEtcdConfig() clientv3.Config {
+	cfg := defaultEtcdConfig
+	cfg.Endpoints = append([]string(nil), defaultEtcdConfig.Endpoints...)
+	return cfg
+}
+
+// EtcdConfigFromEnv 在默认配置的基础上应用环境变量中设置的值，getenv 一般传入 os.Getenv
+func EtcdConfigFromEnv(getenv func(string) string) (clientv3.Config, error) {
+	cfg := DefaultEtcdConfig()
+	if v := getenv(EnvEtcdEndpoints); v != "" {
+		cfg.Endpoints = splitList(v)
+	}
+	cfg.Username = getenv(EnvEtcdUsername)
+	cfg.Password = getenv(EnvEtcdPassword)
+	if v := getenv(EnvEtcdDialTimeout); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return cfg, fmt.Errorf("%s: %v", EnvEtcdDialTimeout, err)
+		}
+		cfg.DialTimeout = d
+	}
+	cert, key, ca := getenv(EnvEtcdCert), getenv(EnvEtcdKey), getenv(EnvEtcdCA)
+	if cert != "" || key != "" || ca != "" {
+		tlsCfg, err := LoadEtcdTLS(cert, key, ca)
+		if err != nil {
+			return cfg, err
+		}
+		cfg.TLS = tlsCfg
+	}
+	return cfg, nil
+}
+
+// LoadEtcdTLS 读取连接etcd使用的TLS配置。certFile 和 keyFile 为客户端证书，etcd没有开启客户端证书认证时可以为空；
+// caFile 为空时使用系统的根证书校验etcd的服务端证书。
+func LoadEtcdTLS(certFile, keyFile, caFile string) (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load etcd client certificate: %v", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("load etcd ca: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("load etcd ca: no certificates in %s", caFile)
+		}
+		cfg.RootCAs = pool
+	}
+	return cfg, nil
+}
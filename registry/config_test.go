@@ -0,0 +1,42 @@
+package registry
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestEtcdConfigFromEnv(t *testing.T) {
+	env := map[string]string{
+		EnvEtcdEndpoints:   "10.0.0.1:2379, 10.0.0.2:2379,",
+		EnvEtcdUsername:    "cache",
+		EnvEtcdPassword:    "secret",
+		EnvEtcdDialTimeout: "2s",
+	}
+	cfg, err := EtcdConfigFromEnv(func(k string) string { return env[k] })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(cfg.Endpoints, []string{"10.0.0.1:2379", "10.0.0.2:2379"}) ||
+		cfg.Username != "cache" || cfg.Password != "secret" || cfg.DialTimeout != 2*time.Second || cfg.TLS != nil {
+		t.Fatalf("unexpected config %+v", cfg)
+	}
+
+	cfg, err = EtcdConfigFromEnv(func(string) string { return "" })
+	if err != nil || !reflect.DeepEqual(cfg.Endpoints, defaultEtcdConfig.Endpoints) || cfg.DialTimeout != defaultEtcdConfig.DialTimeout {
+		t.Fatalf("expect the default config, got %+v %v", cfg, err)
+	}
+	cfg.Endpoints[0] = "changed"
+	if defaultEtcdConfig.Endpoints[0] == "changed" {
+		t.Fatal("DefaultEtcdConfig should return a copy")
+	}
+
+	env = map[string]string{EnvEtcdDialTimeout: "soon"}
+	if _, err := EtcdConfigFromEnv(func(k string) string { return env[k] }); err == nil {
+		t.Fatal("expect an error for an invalid dial timeout")
+	}
+	env = map[string]string{EnvEtcdCA: "/nonexistent/ca.pem"}
+	if _, err := EtcdConfigFromEnv(func(k string) string { return env[k] }); err == nil {
+		t.Fatal("expect an error for a missing ca file")
+	}
+}
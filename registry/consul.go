@@ -0,0 +1,291 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gocache/logging"
+)
+
+// 没有通过参数指定Consul配置时读取的环境变量，与Consul官方工具相同
+const (
+	EnvConsulAddr  = "CONSUL_HTTP_ADDR"  // Consul agent的HTTP地址，默认为 127.0.0.1:8500
+	EnvConsulToken = "CONSUL_HTTP_TOKEN" // 访问Consul的ACL token
+)
+
+const (
+	defaultConsulAddr = "127.0.0.1:8500"
+	consulWatchWait   = time.Minute      // 阻塞查询最多等待的时间
+	consulDeregister  = time.Minute      // 健康检查失败多久后Consul自动删除注册
+	consulMetaKey     = "gocache"        // 元数据序列化为JSON后保存在服务的 Meta 中
+	consulTimeout     = 10 * time.Second // 非阻塞请求的超时时间
+)
+
+// ConsulRegistry 基于Consul agent HTTP API的注册中心。节点注册为一个带TTL健康检查的服务实例，
+// 由心跳维持健康；Watch 和 Resolve 只返回健康检查通过的实例。
+type ConsulRegistry struct {
+	Addr   string         // Consul agent的地址，例如 127.0.0.1:8500 或 https://consul.example.com
+	Token  string         // ACL token，可以为空
+	TTL    time.Duration  // 健康检查的TTL，0表示默认的5秒，心跳间隔为TTL的三分之一
+	Client *http.Client   // 发送请求使用的HTTP客户端，nil表示 http.DefaultClient
+	Logger logging.Logger // 输出注册和监听的日志，nil表示不输出
+}
+
+func (r *ConsulRegistry) logger() logging.Logger {
+	return logging.OrNop(r.Logger)
+}
+
+// ConsulFromEnv 按环境变量 CONSUL_HTTP_ADDR、CONSUL_HTTP_TOKEN 创建Consul注册中心，getenv 一般传入 os.Getenv
+func ConsulFromEnv(getenv func(string) string) *ConsulRegistry {
+	r := &ConsulRegistry{Addr: getenv(EnvConsulAddr), Token: getenv(EnvConsulToken)}
+	if r.Addr == "" {
+		r.Addr = defaultConsulAddr
+	}
+	return r
+}
+
+// consulService 注册服务实例的请求
+type consulService struct {
+	ID      string            `json:"ID"`
+	Name    string            `json:"Name"`
+	Address string            `json:"Address"`
+	Port    int               `json:"Port"`
+	Meta    map[string]string `json:"Meta,omitempty"`
+	Check   consulCheck       `json:"Check"`
+}
+
+type consulCheck struct {
+	CheckID                        string `json:"CheckID"`
+	TTL                            string `json:"TTL"`
+	DeregisterCriticalServiceAfter string `json:"DeregisterCriticalServiceAfter"`
+}
+
+// consulEntry 健康查询返回的一个服务实例
+type consulEntry struct {
+	Service struct {
+		ID      string            `json:"ID"`
+		Address string            `json:"Address"`
+		Port    int               `json:"Port"`
+		Meta    map[string]string `json:"Meta"`
+	} `json:"Service"`
+}
+
+// consulServiceID 服务实例的ID，同一个服务下以地址区分
+func consulServiceID(service, addr string) string {
+	return service + "-" + addr
+}
+
+// Register 见 Registry.Register。每隔TTL的三分之一发送一次心跳，心跳失败(例如agent重启后丢失了注册)时以退避时间重新注册
+func (r *ConsulRegistry) Register(service, addr string, metadata interface{}, stop chan error) error {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("consul: invalid address %q: %v", addr, err)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return fmt.Errorf("consul: invalid port in %q: %v", addr, err)
+	}
+	ttl := r.TTL
+	if ttl <= 0 {
+		ttl = defaultLeaseTTL
+	}
+	id := consulServiceID(service, addr)
+	svc := consulService{
+		ID: id, Name: service, Address: host, Port: port,
+		Check: consulCheck{CheckID: id + ":ttl", TTL: ttl.String(), DeregisterCriticalServiceAfter: consulDeregister.String()},
+	}
+	if metadata != nil {
+		md, err := json.Marshal(metadata)
+		if err != nil {
+			return fmt.Errorf("consul: marshal metadata: %v", err)
+		}
+		svc.Meta = map[string]string{consulMetaKey: string(md)}
+	}
+
+	var attempt int64
+	registered := false
+	ticker := time.NewTicker(ttl / 3)
+	defer ticker.Stop()
+	for {
+		if !registered {
+			if err := r.put("/v1/agent/service/register", svc); err != nil {
+				attempt++
+				r.logger().Warn("consul register failed", "addr", addr, "error", err, "attempt", attempt)
+				select {
+				case err := <-stop:
+					return err
+				case <-time.After(backoff(attempt)):
+				}
+				continue
+			}
+			registered, attempt = true, 0
+			r.logger().Info("service registered", "addr", addr, "backend", "consul")
+		}
+		if err := r.put("/v1/agent/check/pass/"+url.PathEscape(svc.Check.CheckID), nil); err != nil {
+			r.logger().Warn("consul heartbeat failed", "addr", addr, "error", err)
+			registered = false // 下一次心跳时重新注册
+		}
+		select {
+		case err := <-stop:
+			if derr := r.Deregister(service, addr); derr != nil {
+				r.logger().Warn("consul deregister failed", "addr", addr, "error", derr)
+			}
+			return err
+		case <-ticker.C:
+		}
+	}
+}
+
+// Deregister 见 Registry.Deregister
+func (r *ConsulRegistry) Deregister(service, addr string) error {
+	return r.put("/v1/agent/service/deregister/"+url.PathEscape(consulServiceID(service, addr)), nil)
+}
+
+// Watch 见 Registry.Watch，使用Consul的阻塞查询，查询失败时以退避时间重试
+func (r *ConsulRegistry) Watch(ctx context.Context, service string, fn func(added, removed []string)) error {
+	known := map[string]bool{}
+	var index uint64
+	var attempt int64
+	for {
+		addrs, next, err := r.health(ctx, service, index, consulWatchWait)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			attempt++
+			r.logger().Warn("consul watch failed", "service", service, "error", err, "attempt", attempt)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(backoff(attempt)):
+			}
+			continue
+		}
+		attempt = 0
+		if next < index { // 索引回退(例如Consul重建了状态)时重新开始
+			next = 0
+		}
+		if next == 0 {
+			next = 1 // 保证下一次是阻塞查询
+		}
+		if index == 0 || next != index {
+			var added, removed []string
+			known, added, removed = diffAddrs(known, addrs)
+			fn(added, removed)
+		}
+		index = next
+	}
+}
+
+// Resolve 见 Registry.Resolve
+func (r *ConsulRegistry) Resolve(ctx context.Context, service string) ([]string, error) {
+	addrs, _, err := r.health(ctx, service, 0, 0)
+	return addrs, err
+}
+
+// health 查询服务下健康检查通过的实例，index 大于0时为阻塞查询，直到结果变化或者超过wait，返回实例地址和新的索引
+func (r *ConsulRegistry) health(ctx context.Context, service string, index uint64, wait time.Duration) ([]string, uint64, error) {
+	entries, next, err := r.entries(ctx, service, index, wait)
+	if err != nil {
+		return nil, 0, err
+	}
+	addrs := make([]string, 0, len(entries))
+	for _, e := range entries {
+		addrs = append(addrs, net.JoinHostPort(e.Service.Address, strconv.Itoa(e.Service.Port)))
+	}
+	sort.Strings(addrs)
+	return addrs, next, nil
+}
+
+// entries 与 health 相同，返回完整的实例信息
+func (r *ConsulRegistry) entries(ctx context.Context, service string, index uint64, wait time.Duration) ([]consulEntry, uint64, error) {
+	q := url.Values{"passing": {"true"}}
+	if index > 0 {
+		q.Set("index", strconv.FormatUint(index, 10))
+		q.Set("wait", wait.String())
+	} else {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, consulTimeout)
+		defer cancel()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.url("/v1/health/service/"+url.PathEscape(service))+"?"+q.Encode(), nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	resp, err := r.do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	var entries []consulEntry
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return nil, 0, fmt.Errorf("consul: decode health response: %v", err)
+	}
+	next, _ := strconv.ParseUint(resp.Header.Get("X-Consul-Index"), 10, 64)
+	return entries, next, nil
+}
+
+// put 发送PUT请求，body 不为nil时序列化为JSON
+func (r *ConsulRegistry) put(path string, body interface{}) error {
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			return err
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), consulTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, r.url(path), &buf)
+	if err != nil {
+		return err
+	}
+	resp, err := r.do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// do 发送请求并检查状态码，非2xx的响应返回错误
+func (r *ConsulRegistry) do(req *http.Request) (*http.Response, error) {
+	if r.Token != "" {
+		req.Header.Set("X-Consul-Token", r.Token)
+	}
+	client := r.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		resp.Body.Close()
+		return nil, fmt.Errorf("consul: %s %s: %s %s", req.Method, req.URL.Path, resp.Status, bytes.TrimSpace(msg))
+	}
+	return resp, nil
+}
+
+// url 返回请求的完整地址，Addr 没有协议时使用http
+func (r *ConsulRegistry) url(path string) string {
+	addr := r.Addr
+	if addr == "" {
+		addr = defaultConsulAddr
+	}
+	if !strings.Contains(addr, "://") {
+		addr = "http://" + addr
+	}
+	return addr + path
+}
@@ -0,0 +1,154 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeConsul 模拟Consul agent的服务注册、TTL检查和健康查询接口
+type fakeConsul struct {
+	mu       sync.Mutex
+	changed  *sync.Cond
+	index    uint64
+	services map[string]consulService
+	passes   int
+}
+
+func newFakeConsul() *fakeConsul {
+	f := &fakeConsul{index: 1, services: map[string]consulService{}}
+	f.changed = sync.NewCond(&f.mu)
+	return f
+}
+
+func (f *fakeConsul) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch path := req.URL.Path; {
+	case path == "/v1/agent/service/register":
+		var svc consulService
+		json.NewDecoder(req.Body).Decode(&svc)
+		f.services[svc.ID] = svc
+		f.bump()
+	case strings.HasPrefix(path, "/v1/agent/service/deregister/"):
+		delete(f.services, strings.TrimPrefix(path, "/v1/agent/service/deregister/"))
+		f.bump()
+	case strings.HasPrefix(path, "/v1/agent/check/pass/"):
+		id := strings.TrimPrefix(path, "/v1/agent/check/pass/")
+		if _, ok := f.services[strings.TrimSuffix(id, ":ttl")]; !ok {
+			http.Error(w, "unknown check "+id, http.StatusInternalServerError)
+			return
+		}
+		f.passes++
+	case strings.HasPrefix(path, "/v1/health/service/"):
+		name := strings.TrimPrefix(path, "/v1/health/service/")
+		if index, _ := strconv.ParseUint(req.URL.Query().Get("index"), 10, 64); index >= f.index {
+			timer := time.AfterFunc(100*time.Millisecond, func() { // 模拟阻塞查询超时
+				f.mu.Lock()
+				f.changed.Broadcast()
+				f.mu.Unlock()
+			})
+			f.changed.Wait()
+			timer.Stop()
+		}
+		var entries []consulEntry
+		for _, svc := range f.services {
+			if svc.Name == name {
+				var e consulEntry
+				e.Service.ID, e.Service.Address, e.Service.Port, e.Service.Meta = svc.ID, svc.Address, svc.Port, svc.Meta
+				entries = append(entries, e)
+			}
+		}
+		w.Header().Set("X-Consul-Index", strconv.FormatUint(f.index, 10))
+		json.NewEncoder(w).Encode(entries)
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+func (f *fakeConsul) bump() {
+	f.index++
+	f.changed.Broadcast()
+}
+
+func TestConsulRegistry(t *testing.T) {
+	fake := newFakeConsul()
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	r := &ConsulRegistry{Addr: srv.URL, TTL: 300 * time.Millisecond}
+
+	updates := make(chan [2][]string, 16)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go r.Watch(ctx, "gocache", func(added, removed []string) { updates <- [2][]string{added, removed} })
+	if u := <-updates; len(u[0]) != 0 || len(u[1]) != 0 {
+		t.Fatalf("first sync should be empty, got %v", u)
+	}
+
+	stop := make(chan error)
+	done := make(chan error, 1)
+	go func() { done <- r.Register("gocache", "10.0.0.1:8001", map[string]string{"zone": "a"}, stop) }()
+	if u := <-updates; !reflect.DeepEqual(u[0], []string{"10.0.0.1:8001"}) {
+		t.Fatalf("expect the node to join, got %v", u)
+	}
+	addrs, err := r.Resolve(context.Background(), "gocache")
+	if err != nil || !reflect.DeepEqual(addrs, []string{"10.0.0.1:8001"}) {
+		t.Fatalf("Resolve = %v, %v", addrs, err)
+	}
+	fake.mu.Lock()
+	svc := fake.services["gocache-10.0.0.1:8001"]
+	fake.mu.Unlock()
+	if svc.Check.TTL != "300ms" || svc.Meta[consulMetaKey] != `{"zone":"a"}` {
+		t.Fatalf("unexpected registration %+v", svc)
+	}
+	if md, err := r.Metadata(context.Background(), "gocache", "10.0.0.1:8001"); err != nil || string(md) != `{"zone":"a"}` {
+		t.Fatalf("Metadata = %s, %v", md, err)
+	}
+
+	// agent丢失注册后，心跳时重新注册
+	fake.mu.Lock()
+	delete(fake.services, "gocache-10.0.0.1:8001")
+	fake.bump()
+	fake.mu.Unlock()
+	if u := <-updates; !reflect.DeepEqual(u[1], []string{"10.0.0.1:8001"}) {
+		t.Fatalf("expect the node to leave, got %v", u)
+	}
+	if u := <-updates; !reflect.DeepEqual(u[0], []string{"10.0.0.1:8001"}) {
+		t.Fatalf("expect the node to register again, got %v", u)
+	}
+
+	stop <- nil
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	if len(fake.services) != 0 || fake.passes == 0 {
+		t.Fatalf("expect heartbeats and deregistration, got %d services %d passes", len(fake.services), fake.passes)
+	}
+}
+
+func TestNew(t *testing.T) {
+	r, err := New("consul", "consul.local:8500")
+	if c, ok := r.(*ConsulRegistry); err != nil || !ok || c.Addr != "consul.local:8500" {
+		t.Fatalf("New(consul) = %#v, %v", r, err)
+	}
+	r, err = New("etcd", "10.0.0.1:2379")
+	if e, ok := r.(*EtcdRegistry); err != nil || !ok || !reflect.DeepEqual(e.Config.Endpoints, []string{"10.0.0.1:2379"}) {
+		t.Fatalf("New(etcd) = %#v, %v", r, err)
+	}
+	r, err = New("zookeeper", "10.0.0.1:2181", "10.0.0.2:2181")
+	if z, ok := r.(*ZooKeeperRegistry); err != nil || !ok || !reflect.DeepEqual(z.Servers, []string{"10.0.0.1:2181", "10.0.0.2:2181"}) {
+		t.Fatalf("New(zookeeper) = %#v, %v", r, err)
+	}
+	if _, err := New("mdns"); err == nil {
+		t.Fatal("expect an error for an unsupported backend")
+	}
+}
@@ -8,19 +8,22 @@ import (
 )
 
 // EtcdDial 向grpc请求一个服务，通过提供一个etcd client和service name即可获得Connection
-func EtcdDial(c *clientv3.Client, service string) (*grpc.ClientConn, error) {
+// opts 追加在默认参数之后，例如传入 grpc.WithTransportCredentials 使用TLS代替默认的明文连接
+// 连接建立之前阻塞，确保连接建立成功后再继续执行后续的代码
+func EtcdDial(c *clientv3.Client, service string, opts ...grpc.DialOption) (*grpc.ClientConn, error) {
+	return NewEtcdConn(c, service, append([]grpc.DialOption{grpc.WithBlock()}, opts...)...)
+}
+
+// NewEtcdConn 与 EtcdDial 相同，但是不等待连接建立：连接在后台建立，断开后自动重连，
+// 请求会等待连接就绪，适合长期持有的连接
+func NewEtcdConn(c *clientv3.Client, service string, opts ...grpc.DialOption) (*grpc.ClientConn, error) {
 	etcdResolver, err := resolver.NewBuilder(c) //使用etcd客户端构建了一个服务发现的构建器。
 	if err != nil {                             //检查是否在创建etcd服务发现构建器时发生了错误
 		return nil, err
 	}
-	conn, err := grpc.Dial(
-		"etcd:///"+service,                                       //指定了服务的地址
+	dialOpts := []grpc.DialOption{
 		grpc.WithResolvers(etcdResolver),                         //用于服务发现的解析器
-		grpc.WithTransportCredentials(insecure.NewCredentials()), //用于设置gRPC连接的传输层安全性，这里使用了不安全的连接（insecure）
-		grpc.WithBlock(),                                         //用于在连接建立之前阻塞，确保连接建立成功后再继续执行后续的代码。
-	)
-	if err != nil {
-		return nil, err
+		grpc.WithTransportCredentials(insecure.NewCredentials()), //用于设置gRPC连接的传输层安全性，默认使用不安全的连接（insecure）
 	}
-	return conn, nil
-} // 最后返回一个指向已建立连接的grpc.ClientConn类型的指针，或者在发生错误时返回一个错误
+	return grpc.Dial("etcd:///"+service, append(dialOpts, opts...)...) //指定了服务的地址，后传入的参数覆盖默认参数
+}
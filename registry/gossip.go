@@ -0,0 +1,527 @@
+package registry
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	mrand "math/rand"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"gocache/logging"
+)
+
+// 没有通过参数指定gossip配置时读取的环境变量
+const (
+	EnvGossipBind      = "GOCACHE_GOSSIP_BIND"      // gossip监听的UDP地址，默认为 :7946
+	EnvGossipAdvertise = "GOCACHE_GOSSIP_ADVERTISE" // 其他节点访问本节点gossip端口的地址
+	EnvGossipSeeds     = "GOCACHE_GOSSIP_SEEDS"     // 逗号分隔的种子节点gossip地址
+	EnvGossipKey       = "GOCACHE_GOSSIP_KEY"       // base64编码的共享密钥，见 GossipRegistry.SecretKey
+)
+
+const (
+	defaultGossipBind     = ":7946"
+	defaultGossipInterval = time.Second
+	defaultGossipFanout   = 3
+	gossipMaxPacket       = 64 << 10 // 一条gossip消息的最大字节数，节点的数量受此限制(约几百个)
+	gossipTombstoneFactor = 60       // 失效的节点记录保留 FailTimeout 的多少倍，防止过期的消息使它复活
+)
+
+var errGossipClosed = errors.New("gossip: registry closed")
+
+// gossipAAD 加密消息时认证的附加数据，区分其他使用同一个密钥的协议
+var gossipAAD = []byte("gocache-gossip-v1")
+
+// GossipRegistry 基于gossip协议的成员管理，不依赖任何外部协调服务。节点之间每隔 Interval 随机选择 Fanout 个节点
+// 通过UDP交换全部成员的心跳(push-pull)，心跳超过 FailTimeout 没有更新的节点视为故障，主动退出的节点立即广播离开。
+// 新节点只需要知道任意一个已有节点的gossip地址(Seeds)即可加入。一个进程中同一个gossip端口只应该有一个 GossipRegistry。
+//
+// 协议本身没有认证，能向gossip端口发送UDP报文的任何人都可以注册或移除成员。跨越不可信网络时应设置 SecretKey，
+// 所有节点使用相同的密钥。没有密钥时回复不超过请求的大小，不会被伪造来源地址的报文用来放大流量。
+type GossipRegistry struct {
+	BindAddr    string         // 监听的UDP地址，默认为 :7946
+	Advertise   string         // 其他节点访问本节点gossip端口的地址，默认为注册的服务地址的host加上监听的端口
+	Seeds       []string       // 种子节点的gossip地址，不需要包括本节点
+	Interval    time.Duration  // 交换心跳的间隔，默认1秒
+	FailTimeout time.Duration  // 心跳超过多久没有更新视为故障，默认为 Interval 的5倍
+	Fanout      int            // 每次交换心跳的节点数，默认为3
+	Logger      logging.Logger // 输出日志，nil表示不输出
+
+	// SecretKey 共享密钥，长度为16、24或32字节(AES-128、AES-192或AES-256)。设置后所有消息用AES-GCM加密并认证，
+	// 丢弃无法解密(没有加密或者密钥不同)以及发送时间相差超过记录保留时间的消息(防止重放使失效的节点复活)。
+	// nil表示不加密，只应在可信的网络中使用
+	SecretKey []byte
+
+	once     sync.Once
+	startErr error
+	keyErr   error // 环境变量中的密钥不合法，见 GossipFromEnv
+	aead     cipher.AEAD
+	conn     net.PacketConn
+	done     chan struct{}
+
+	mu       sync.Mutex
+	members  map[string]*gossipState // 键为 <service>/<addr>
+	self     map[string]bool         // 本进程注册的成员
+	watchers map[chan struct{}]struct{}
+}
+
+// gossipMember 一个成员的记录，在节点之间传播
+type gossipMember struct {
+	Service   string          `json:"service"`
+	Addr      string          `json:"addr"`   // 注册的服务地址
+	Gossip    string          `json:"gossip"` // 成员的gossip地址
+	Heartbeat int64           `json:"heartbeat"`
+	Left      bool            `json:"left,omitempty"`
+	Metadata  json.RawMessage `json:"metadata,omitempty"`
+}
+
+// gossipState 本地保存的成员记录
+type gossipState struct {
+	gossipMember
+	updated time.Time // 本地最近一次看到心跳增长的时间
+}
+
+// gossipMessage 节点之间交换的消息，Reply 为false时对方回复自己的全部成员
+type gossipMessage struct {
+	Reply   bool           `json:"reply,omitempty"`
+	Sent    int64          `json:"sent,omitempty"` // 发送时间，设置了 SecretKey 时用于拒绝重放的旧消息
+	Members []gossipMember `json:"members"`
+}
+
+func (r *GossipRegistry) logger() logging.Logger {
+	return logging.OrNop(r.Logger)
+}
+
+// GossipFromEnv 按环境变量 GOCACHE_GOSSIP_BIND、GOCACHE_GOSSIP_ADVERTISE、GOCACHE_GOSSIP_SEEDS、GOCACHE_GOSSIP_KEY
+// 创建gossip注册中心。密钥不合法时第一次使用注册中心返回错误
+func GossipFromEnv(getenv func(string) string) *GossipRegistry {
+	r := &GossipRegistry{
+		BindAddr:  getenv(EnvGossipBind),
+		Advertise: getenv(EnvGossipAdvertise),
+		Seeds:     splitList(getenv(EnvGossipSeeds)),
+	}
+	if key := getenv(EnvGossipKey); key != "" {
+		if r.SecretKey, r.keyErr = base64.StdEncoding.DecodeString(key); r.keyErr != nil {
+			r.keyErr = fmt.Errorf("gossip: invalid %s: %v", EnvGossipKey, r.keyErr)
+		}
+	}
+	return r
+}
+
+// start 第一次使用时开始监听并在后台交换心跳
+func (r *GossipRegistry) start() error {
+	r.once.Do(func() {
+		if r.BindAddr == "" {
+			r.BindAddr = defaultGossipBind
+		}
+		if r.Interval <= 0 {
+			r.Interval = defaultGossipInterval
+		}
+		if r.FailTimeout <= 0 {
+			r.FailTimeout = 5 * r.Interval
+		}
+		if r.Fanout <= 0 {
+			r.Fanout = defaultGossipFanout
+		}
+		r.members = map[string]*gossipState{}
+		r.self = map[string]bool{}
+		r.watchers = map[chan struct{}]struct{}{}
+		r.done = make(chan struct{})
+		if r.startErr = r.keyErr; r.startErr != nil {
+			return
+		}
+		if r.SecretKey != nil {
+			block, err := aes.NewCipher(r.SecretKey)
+			if err != nil {
+				r.startErr = fmt.Errorf("gossip: invalid secret key: %v", err)
+				return
+			}
+			r.aead, _ = cipher.NewGCM(block)
+		} else {
+			r.logger().Warn("gossip messages are not authenticated, set SecretKey on untrusted networks")
+		}
+		r.conn, r.startErr = net.ListenPacket("udp", r.BindAddr)
+		if r.startErr != nil {
+			return
+		}
+		go r.receive()
+		go r.run()
+	})
+	return r.startErr
+}
+
+// Close 停止交换心跳并关闭gossip端口，本进程注册的成员不再续期，其他节点在 FailTimeout 后将其视为故障
+func (r *GossipRegistry) Close() error {
+	if err := r.start(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	select {
+	case <-r.done:
+		return nil
+	default:
+	}
+	close(r.done)
+	return r.conn.Close()
+}
+
+// Register 见 Registry.Register，stop 收到信号后向其他节点广播离开
+func (r *GossipRegistry) Register(service, addr string, metadata interface{}, stop chan error) error {
+	if err := r.start(); err != nil {
+		return err
+	}
+	var md json.RawMessage
+	if metadata != nil {
+		var err error
+		if md, err = json.Marshal(metadata); err != nil {
+			return fmt.Errorf("gossip: marshal metadata: %v", err)
+		}
+	}
+	advertise := r.Advertise
+	if advertise == "" {
+		host, _, _ := net.SplitHostPort(addr)
+		_, port, _ := net.SplitHostPort(r.conn.LocalAddr().String())
+		advertise = net.JoinHostPort(host, port)
+	}
+	key := service + "/" + addr
+	r.mu.Lock()
+	r.self[key] = true
+	r.members[key] = &gossipState{
+		gossipMember: gossipMember{Service: service, Addr: addr, Gossip: advertise, Heartbeat: time.Now().UnixNano(), Metadata: md},
+		updated:      time.Now(),
+	}
+	r.notifyLocked()
+	r.mu.Unlock()
+	r.logger().Info("service registered", "addr", addr, "backend", "gossip")
+	r.gossip() // 立即通知种子节点，不必等到下一个周期
+
+	select {
+	case err := <-stop:
+		r.leave(key)
+		return err
+	case <-r.done:
+		return errGossipClosed
+	}
+}
+
+// leave 把本进程注册的成员标记为离开并广播给所有存活的节点
+func (r *GossipRegistry) leave(key string) {
+	r.mu.Lock()
+	delete(r.self, key)
+	if m := r.members[key]; m != nil {
+		m.Left, m.Heartbeat, m.updated = true, time.Now().UnixNano(), time.Now()
+	}
+	msg, targets := r.messageLocked(false), r.targetsLocked(len(r.members))
+	r.notifyLocked()
+	r.mu.Unlock()
+	r.send(msg, targets, 0)
+}
+
+// Deregister 见 Registry.Deregister，把成员标记为离开。仍然存活的节点会以更新的心跳覆盖离开的标记。
+func (r *GossipRegistry) Deregister(service, addr string) error {
+	if err := r.start(); err != nil {
+		return err
+	}
+	key := service + "/" + addr
+	r.mu.Lock()
+	own := r.self[key]
+	if m := r.members[key]; m != nil && !own {
+		m.Left, m.Heartbeat, m.updated = true, m.Heartbeat+1, time.Now()
+		r.notifyLocked()
+	}
+	r.mu.Unlock()
+	if own {
+		r.leave(key)
+	}
+	return nil
+}
+
+// Watch 见 Registry.Watch
+func (r *GossipRegistry) Watch(ctx context.Context, service string, fn func(added, removed []string)) error {
+	if err := r.start(); err != nil {
+		return err
+	}
+	ch := make(chan struct{}, 1)
+	r.mu.Lock()
+	r.watchers[ch] = struct{}{}
+	r.mu.Unlock()
+	defer func() {
+		r.mu.Lock()
+		delete(r.watchers, ch)
+		r.mu.Unlock()
+	}()
+
+	var known map[string]bool
+	for first := true; ; first = false {
+		var added, removed []string
+		known, added, removed = diffAddrs(known, r.alive(service))
+		if first || len(added) > 0 || len(removed) > 0 {
+			fn(added, removed)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-r.done:
+			return errGossipClosed
+		case <-ch:
+		}
+	}
+}
+
+// Resolve 见 Registry.Resolve
+func (r *GossipRegistry) Resolve(ctx context.Context, service string) ([]string, error) {
+	if err := r.start(); err != nil {
+		return nil, err
+	}
+	return r.alive(service), nil
+}
+
+// alive 返回服务下存活的成员地址，已经排序
+func (r *GossipRegistry) alive(service string) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	var addrs []string
+	for _, m := range r.members {
+		if m.Service == service && r.aliveLocked(m, now) {
+			addrs = append(addrs, m.Addr)
+		}
+	}
+	sort.Strings(addrs)
+	return addrs
+}
+
+// aliveLocked 返回成员是否存活，调用时需持有 r.mu
+func (r *GossipRegistry) aliveLocked(m *gossipState, now time.Time) bool {
+	return !m.Left && now.Sub(m.updated) < r.FailTimeout
+}
+
+// run 每隔 Interval 更新本进程成员的心跳，与随机选择的节点交换成员，并清理过期的记录
+func (r *GossipRegistry) run() {
+	ticker := time.NewTicker(r.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-ticker.C:
+		}
+		r.gossip()
+	}
+}
+
+// gossip 进行一轮心跳交换
+func (r *GossipRegistry) gossip() {
+	now := time.Now()
+	r.mu.Lock()
+	for key, m := range r.members {
+		switch {
+		case r.self[key]:
+			m.Heartbeat, m.updated = now.UnixNano(), now
+		case now.Sub(m.updated) > gossipTombstoneFactor*r.FailTimeout:
+			delete(r.members, key)
+		}
+	}
+	msg, targets := r.messageLocked(false), r.targetsLocked(r.Fanout)
+	r.notifyLocked() // 超时的成员在这里被观察者发现
+	r.mu.Unlock()
+	r.send(msg, targets, 0)
+}
+
+// messageLocked 返回要发送的消息，只包括存活和刚刚离开的成员，调用时需持有 r.mu
+func (r *GossipRegistry) messageLocked(reply bool) gossipMessage {
+	msg := gossipMessage{Reply: reply}
+	now := time.Now()
+	for _, m := range r.members {
+		if now.Sub(m.updated) < r.FailTimeout {
+			msg.Members = append(msg.Members, m.gossipMember)
+		}
+	}
+	return msg
+}
+
+// targetsLocked 从存活的成员和种子节点中随机选择最多n个gossip地址，不包括本进程，调用时需持有 r.mu
+func (r *GossipRegistry) targetsLocked(n int) []string {
+	own := map[string]bool{r.conn.LocalAddr().String(): true}
+	for key := range r.self {
+		own[r.members[key].Gossip] = true
+	}
+	seen := map[string]bool{}
+	var candidates []string
+	add := func(addr string) {
+		if addr != "" && !own[addr] && !seen[addr] {
+			seen[addr] = true
+			candidates = append(candidates, addr)
+		}
+	}
+	now := time.Now()
+	for _, m := range r.members {
+		if r.aliveLocked(m, now) {
+			add(m.Gossip)
+		}
+	}
+	for _, seed := range r.Seeds {
+		add(seed)
+	}
+	mrand.Shuffle(len(candidates), func(i, j int) { candidates[i], candidates[j] = candidates[j], candidates[i] })
+	if len(candidates) > n {
+		candidates = candidates[:n]
+	}
+	return candidates
+}
+
+// send 把消息发送给各个地址，发送失败只记录日志。maxSize 大于0时，加密后超过maxSize字节的消息不发送
+func (r *GossipRegistry) send(msg gossipMessage, targets []string, maxSize int) {
+	if len(targets) == 0 {
+		return
+	}
+	msg.Sent = time.Now().UnixNano()
+	data, err := json.Marshal(msg)
+	if err != nil || len(data) > gossipMaxPacket {
+		r.logger().Error("gossip message too large", "members", len(msg.Members), "error", err)
+		return
+	}
+	if data, err = r.seal(data); err != nil {
+		r.logger().Error("gossip encrypt failed", "error", err)
+		return
+	}
+	if maxSize > 0 && len(data) > maxSize {
+		r.logger().Debug("gossip reply larger than the request, skipped", "targets", targets, "size", len(data), "max", maxSize)
+		return
+	}
+	for _, target := range targets {
+		addr, err := net.ResolveUDPAddr("udp", target)
+		if err == nil {
+			_, err = r.conn.WriteTo(data, addr)
+		}
+		if err != nil {
+			select {
+			case <-r.done:
+				return
+			default:
+			}
+			r.logger().Warn("gossip send failed", "target", target, "error", err)
+		}
+	}
+}
+
+// receive 接收其他节点的消息并合并成员，对方请求时回复本地的全部成员。
+// 没有设置 SecretKey 时无法确认报文的来源地址不是伪造的，回复不超过请求的大小，
+// 避免被用来放大UDP流量；回复被跳过时成员仍然通过双方定期的推送传播
+func (r *GossipRegistry) receive() {
+	buf := make([]byte, gossipMaxPacket+gossipSealOverhead)
+	for {
+		n, from, err := r.conn.ReadFrom(buf)
+		if err != nil {
+			select {
+			case <-r.done:
+				return
+			default:
+			}
+			r.logger().Warn("gossip receive failed", "error", err)
+			continue
+		}
+		data, err := r.open(buf[:n])
+		if err != nil {
+			r.logger().Warn("unauthenticated gossip message", "from", from.String(), "error", err)
+			continue
+		}
+		var msg gossipMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			r.logger().Warn("invalid gossip message", "from", from.String(), "error", err)
+			continue
+		}
+		if r.aead != nil && r.stale(msg.Sent, time.Now()) {
+			r.logger().Warn("stale gossip message", "from", from.String(), "sent", time.Unix(0, msg.Sent))
+			continue
+		}
+		r.mu.Lock()
+		r.mergeLocked(msg.Members, time.Now())
+		var reply gossipMessage
+		if !msg.Reply {
+			reply = r.messageLocked(true)
+		}
+		r.mu.Unlock()
+		if !msg.Reply {
+			maxSize := 0
+			if r.aead == nil {
+				maxSize = n
+			}
+			r.send(reply, []string{from.String()}, maxSize)
+		}
+	}
+}
+
+// mergeLocked 合并收到的成员，心跳更大的记录覆盖本地记录；本进程注册的成员只由本进程更新。调用时需持有 r.mu
+func (r *GossipRegistry) mergeLocked(members []gossipMember, now time.Time) {
+	changed := false
+	for _, m := range members {
+		key := m.Service + "/" + m.Addr
+		if r.self[key] {
+			continue
+		}
+		if local := r.members[key]; local != nil && local.Heartbeat >= m.Heartbeat {
+			continue
+		}
+		r.members[key] = &gossipState{gossipMember: m, updated: now}
+		changed = true
+	}
+	if changed {
+		r.notifyLocked()
+	}
+}
+
+// notifyLocked 通知所有观察者重新计算存活的成员，调用时需持有 r.mu
+func (r *GossipRegistry) notifyLocked() {
+	for ch := range r.watchers {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// gossipSealOverhead 加密后的消息比明文多出的字节数：随机数和认证标签
+const gossipSealOverhead = 12 + 16
+
+// seal 用共享密钥加密消息，格式为 随机数 + 密文，没有设置密钥时原样返回
+func (r *GossipRegistry) seal(data []byte) ([]byte, error) {
+	if r.aead == nil {
+		return data, nil
+	}
+	nonce := make([]byte, r.aead.NonceSize(), r.aead.NonceSize()+len(data)+r.aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return r.aead.Seal(nonce, nonce, data, gossipAAD), nil
+}
+
+// open 解密并认证 seal 加密的消息，没有设置密钥时原样返回
+func (r *GossipRegistry) open(packet []byte) ([]byte, error) {
+	if r.aead == nil {
+		return packet, nil
+	}
+	if len(packet) < r.aead.NonceSize() {
+		return nil, errors.New("gossip: message too short")
+	}
+	nonce, ciphertext := packet[:r.aead.NonceSize()], packet[r.aead.NonceSize():]
+	return r.aead.Open(nil, nonce, ciphertext, gossipAAD)
+}
+
+// stale 返回发送时间是否与本地时间相差超过失效记录的保留时间：更早的消息中可能有已经被清理的节点，
+// 重放会使它们复活
+func (r *GossipRegistry) stale(sent int64, now time.Time) bool {
+	d := now.Sub(time.Unix(0, sent))
+	if d < 0 {
+		d = -d
+	}
+	return d > gossipTombstoneFactor*r.FailTimeout
+}
@@ -0,0 +1,192 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// freeUDPAddr 返回一个空闲的本地UDP地址
+func freeUDPAddr(t *testing.T) string {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	return conn.LocalAddr().String()
+}
+
+func TestGossipRegistry(t *testing.T) {
+	seed := freeUDPAddr(t)
+	newNode := func(bind string) *GossipRegistry {
+		r := &GossipRegistry{BindAddr: bind, Seeds: []string{seed}, Interval: 20 * time.Millisecond, FailTimeout: 200 * time.Millisecond}
+		t.Cleanup(func() { r.Close() })
+		return r
+	}
+	nodes := []*GossipRegistry{newNode(seed), newNode("127.0.0.1:0"), newNode("127.0.0.1:0")}
+	stops := make([]chan error, len(nodes))
+	for i, addr := range []string{"127.0.0.1:9001", "127.0.0.1:9002", "127.0.0.1:9003"} {
+		stops[i] = make(chan error, 1)
+		go nodes[i].Register("gocache", addr, map[string]string{"zone": "a"}, stops[i])
+	}
+
+	// 第三个节点观察成员变化
+	var mu sync.Mutex
+	members := map[string]bool{}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go nodes[2].Watch(ctx, "gocache", func(added, removed []string) {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, addr := range added {
+			members[addr] = true
+		}
+		for _, addr := range removed {
+			delete(members, addr)
+		}
+	})
+	waitMembers := func(want ...string) {
+		t.Helper()
+		for deadline := time.Now().Add(3 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+			mu.Lock()
+			_, added, removed := diffAddrs(members, want)
+			got := len(members)
+			mu.Unlock()
+			if len(added) == 0 && len(removed) == 0 {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("%d members, missing %v, unexpected %v", got, added, removed)
+			}
+		}
+	}
+	waitMembers("127.0.0.1:9001", "127.0.0.1:9002", "127.0.0.1:9003")
+	if md, err := nodes[2].Metadata(context.Background(), "gocache", "127.0.0.1:9001"); err != nil || string(md) != `{"zone":"a"}` {
+		t.Fatalf("Metadata = %s, %v", md, err)
+	}
+
+	// 主动退出的节点立即被移除
+	stops[1] <- nil
+	waitMembers("127.0.0.1:9001", "127.0.0.1:9003")
+
+	// 异常退出的节点在心跳超时后被移除
+	nodes[0].Close()
+	waitMembers("127.0.0.1:9003")
+
+	if addrs, err := nodes[2].Resolve(context.Background(), "gocache"); err != nil || !reflect.DeepEqual(addrs, []string{"127.0.0.1:9003"}) {
+		t.Fatalf("Resolve = %v, %v", addrs, err)
+	}
+}
+
+func TestGossipSecretKey(t *testing.T) {
+	key := []byte("0123456789abcdef")
+	seed := freeUDPAddr(t)
+	newNode := func(bind string, key []byte) *GossipRegistry {
+		r := &GossipRegistry{BindAddr: bind, Seeds: []string{seed}, SecretKey: key, Interval: 20 * time.Millisecond, FailTimeout: 200 * time.Millisecond}
+		t.Cleanup(func() { r.Close() })
+		return r
+	}
+	nodes := []*GossipRegistry{
+		newNode(seed, key),
+		newNode("127.0.0.1:0", key),
+		newNode("127.0.0.1:0", []byte("fedcba9876543210")), // 密钥不同
+		newNode("127.0.0.1:0", nil),                        // 没有加密
+	}
+	for i, addr := range []string{"127.0.0.1:9101", "127.0.0.1:9102", "127.0.0.1:9103", "127.0.0.1:9104"} {
+		go nodes[i].Register("gocache", addr, nil, make(chan error))
+	}
+
+	// 密钥相同的节点互相发现，其他节点的消息被丢弃
+	want := []string{"127.0.0.1:9101", "127.0.0.1:9102"}
+	for deadline := time.Now().Add(3 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		addrs, _ := nodes[1].Resolve(context.Background(), "gocache")
+		if reflect.DeepEqual(addrs, want) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("members = %v, want %v", addrs, want)
+		}
+	}
+	time.Sleep(100 * time.Millisecond) // 多交换几轮，确认没有混入
+	for i, want := range [][]string{want, want, {"127.0.0.1:9103"}, {"127.0.0.1:9104"}} {
+		if addrs, _ := nodes[i].Resolve(context.Background(), "gocache"); !reflect.DeepEqual(addrs, want) {
+			t.Errorf("node %d members = %v, want %v", i, addrs, want)
+		}
+	}
+
+	// 伪造的明文消息和重放的旧消息不能注册成员
+	conn, err := net.Dial("udp", seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	forged := gossipMember{Service: "gocache", Addr: "127.0.0.1:9666", Heartbeat: time.Now().UnixNano()}
+	data, _ := json.Marshal(gossipMessage{Reply: true, Sent: time.Now().UnixNano(), Members: []gossipMember{forged}})
+	conn.Write(data)
+	data, _ = json.Marshal(gossipMessage{Reply: true, Sent: time.Now().Add(-time.Hour).UnixNano(), Members: []gossipMember{forged}})
+	sealed, err := nodes[0].seal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Write(sealed)
+	time.Sleep(100 * time.Millisecond)
+	if addrs, _ := nodes[0].Resolve(context.Background(), "gocache"); !reflect.DeepEqual(addrs, want) {
+		t.Fatalf("members after forged messages = %v", addrs)
+	}
+
+	// 密钥长度不合法
+	r := &GossipRegistry{BindAddr: "127.0.0.1:0", SecretKey: []byte("short")}
+	if _, err := r.Resolve(context.Background(), "gocache"); err == nil {
+		t.Fatal("expect an error for an invalid key")
+	}
+
+	// 从环境变量读取base64编码的密钥
+	env := map[string]string{EnvGossipKey: base64.StdEncoding.EncodeToString(key)}
+	if r := GossipFromEnv(func(k string) string { return env[k] }); string(r.SecretKey) != string(key) || r.keyErr != nil {
+		t.Fatalf("key from env = %q, %v", r.SecretKey, r.keyErr)
+	}
+	env[EnvGossipKey] = "not base64!"
+	if r := GossipFromEnv(func(k string) string { return env[k] }); r.keyErr == nil {
+		t.Fatal("expect an error for an invalid key in env")
+	}
+}
+
+func TestGossipReplySize(t *testing.T) {
+	r := &GossipRegistry{BindAddr: "127.0.0.1:0", Interval: time.Hour}
+	defer r.Close()
+	go r.Register("gocache", "127.0.0.1:9201", nil, make(chan error))
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(10 * time.Millisecond) {
+		if addrs, _ := r.Resolve(context.Background(), "gocache"); len(addrs) == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("member did not register")
+		}
+	}
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	request := func(data []byte) bool {
+		conn.WriteTo(data, r.conn.LocalAddr())
+		conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+		_, _, err := conn.ReadFrom(make([]byte, gossipMaxPacket))
+		return err == nil
+	}
+	// 没有密钥时，回复不能比请求大
+	data, _ := json.Marshal(gossipMessage{Sent: time.Now().UnixNano()})
+	if request(data) {
+		t.Fatal("expect no reply larger than a small request")
+	}
+	if !request(append(data, bytes.Repeat([]byte(" "), 1024)...)) {
+		t.Fatal("expect a reply to a request larger than the reply")
+	}
+}
@@ -0,0 +1,105 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// MetadataResolver 是 Registry 的可选扩展，返回地址注册时携带的元数据，各后端都实现了该接口
+type MetadataResolver interface {
+	// Metadata 返回服务下地址注册时携带的元数据(JSON)，没有元数据时返回nil，地址没有注册时返回错误
+	Metadata(ctx context.Context, service, addr string) (json.RawMessage, error)
+}
+
+// LookupMetadata 读取etcd中 <service>/<addr> 注册时携带的元数据(JSON)，没有元数据时返回nil
+func LookupMetadata(ctx context.Context, c *clientv3.Client, service, addr string) (json.RawMessage, error) {
+	resp, err := c.Get(ctx, service+"/"+addr)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, fmt.Errorf("%s/%s is not registered", service, addr)
+	}
+	var ep struct {
+		Metadata json.RawMessage // 与 endpoints.Endpoint 相同的格式
+	}
+	if err := json.Unmarshal(resp.Kvs[0].Value, &ep); err != nil {
+		return nil, fmt.Errorf("%s/%s: invalid registration: %v", service, addr, err)
+	}
+	if string(ep.Metadata) == "null" {
+		return nil, nil
+	}
+	return ep.Metadata, nil
+}
+
+// Metadata 见 MetadataResolver
+func (r *EtcdRegistry) Metadata(ctx context.Context, service, addr string) (json.RawMessage, error) {
+	cli, err := clientv3.New(r.Config)
+	if err != nil {
+		return nil, err
+	}
+	defer cli.Close()
+	return LookupMetadata(ctx, cli, service, addr)
+}
+
+// Metadata 见 MetadataResolver，只返回健康检查通过的实例的元数据
+func (r *ConsulRegistry) Metadata(ctx context.Context, service, addr string) (json.RawMessage, error) {
+	entries, _, err := r.entries(ctx, service, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	id := consulServiceID(service, addr)
+	for _, e := range entries {
+		if e.Service.ID == id {
+			if md := e.Service.Meta[consulMetaKey]; md != "" {
+				return json.RawMessage(md), nil
+			}
+			return nil, nil
+		}
+	}
+	return nil, fmt.Errorf("consul: %s is not registered", id)
+}
+
+// Metadata 见 MetadataResolver，只返回存活的成员的元数据
+func (r *GossipRegistry) Metadata(ctx context.Context, service, addr string) (json.RawMessage, error) {
+	if err := r.start(); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	m := r.members[service+"/"+addr]
+	if m == nil || !r.aliveLocked(m, time.Now()) {
+		return nil, fmt.Errorf("gossip: %s/%s is not a live member", service, addr)
+	}
+	return m.Metadata, nil
+}
+
+// Metadata 见 MetadataResolver
+func (r *ZooKeeperRegistry) Metadata(ctx context.Context, service, addr string) (json.RawMessage, error) {
+	conn, err := r.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.close()
+	data, err := conn.getData(ctx, r.servicePath(service)+"/"+addr)
+	if errors.Is(err, errZKNoNode) {
+		return nil, fmt.Errorf("zookeeper: %s/%s is not registered", service, addr)
+	}
+	if err != nil || len(data) == 0 {
+		return nil, err
+	}
+	return data, nil
+}
+
+// 测试各后端是否实现了 MetadataResolver 接口
+var (
+	_ MetadataResolver = (*EtcdRegistry)(nil)
+	_ MetadataResolver = (*ConsulRegistry)(nil)
+	_ MetadataResolver = (*GossipRegistry)(nil)
+	_ MetadataResolver = (*ZooKeeperRegistry)(nil)
+)
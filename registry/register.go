@@ -2,15 +2,31 @@ package registry // Package registry模块提供服务Service注册至etcd的能
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	clientv3 "go.etcd.io/etcd/client/v3"
 	"go.etcd.io/etcd/client/v3/naming/endpoints"
-	"log"
+	"gocache/logging"
+	"math/rand"
+	"sort"
+	"sync"
 	"time"
 )
 
 // register模块提供服务Service注册至etcd的能力
 
+const (
+	eventBufferSize = 64                     // 事件通道的缓冲大小
+	minBackoff      = 500 * time.Millisecond // 重新注册的最小退避时间
+	maxBackoff      = 30 * time.Second       // 重新注册的最大退避时间
+	defaultLeaseTTL = 5 * time.Second        // 租约的默认有效期
+)
+
+var (
+	errKeepAliveLost = errors.New("keep alive channel closed")
+	errSessionClosed = errors.New("etcd session closed")
+)
+
 var (
 	//这个变量通常用于创建etcd客户端的配置，当你不需要定制化的配置时，可以直接使用 defaultEtcdConfig 这个预定义的配置。
 	defaultEtcdConfig = clientv3.Config{
@@ -21,7 +37,8 @@ var (
 
 // etcdAdd 在租赁模式添加一对kv至etcd
 // 四个参数分别是etcd客户端，etcd租约ID，服务名称，服务地址
-func etcdAdd(c *clientv3.Client, lid clientv3.LeaseID, service string, addr string) error {
+// metadata 为节点的元数据，保存在端点的 Metadata 中，可以为nil
+func etcdAdd(c *clientv3.Client, lid clientv3.LeaseID, service string, addr string, metadata interface{}) error {
 	em, err := endpoints.NewManager(c, service) //创建一个用于管理 etcd 中的服务端点（endpoints）
 	if err != nil {
 		return err
@@ -29,30 +46,258 @@ func etcdAdd(c *clientv3.Client, lid clientv3.LeaseID, service string, addr stri
 	//该方法用于将指定的服务地址（addr）添加到 etcd 中的服务端点列表中。
 	//clientv3.WithLease(lid) 选项表示使用指定的租约 ID（lid）来设置键值的生命周期。
 	//如果添加服务地址成功，函数会返回 nil 表示没有错误；如果发生错误，函数会返回相应的错误信息
-	return em.AddEndpoint(c.Ctx(), service+"/"+addr, endpoints.Endpoint{Addr: addr}, clientv3.WithLease(lid))
+	return em.AddEndpoint(c.Ctx(), service+"/"+addr, endpoints.Endpoint{Addr: addr, Metadata: metadata}, clientv3.WithLease(lid))
+}
+
+// etcdDelete 删除服务下的一个地址，用于撤销不再提供的子服务
+func etcdDelete(c *clientv3.Client, service string, addr string) error {
+	em, err := endpoints.NewManager(c, service)
+	if err != nil {
+		return err
+	}
+	return em.DeleteEndpoint(c.Ctx(), service+"/"+addr)
+}
+
+// ListEndpoints 返回服务下注册的所有地址及其元数据，键为地址。
+// 例如 ListEndpoints(cli, "gocache/scores") 返回提供缓存组 scores 的节点，见 Registration.SetGroups
+func ListEndpoints(c *clientv3.Client, service string) (map[string]endpoints.Endpoint, error) {
+	em, err := endpoints.NewManager(c, service)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), defaultEtcdConfig.DialTimeout)
+	defer cancel()
+	list, err := em.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]endpoints.Endpoint, len(list))
+	for _, e := range list {
+		out[e.Addr] = e
+	}
+	return out, nil
 }
 
 // Register 注册一个服务至etcd,并且在服务的生命周期内保持心跳检测，确保服务的持续在线。
-// 注意 Register将不会return 如果没有error的话
+// 注意 Register将不会return 除非收到停止信号
 func Register(service string, addr string, stop chan error) error {
+	return NewRegistration(service, addr).Run(stop)
+}
+
+// Registration 表示一个服务在etcd中的注册。
+// 它负责保持租约心跳，并在etcd会话丢失时以带抖动的指数退避自动重新注册，
+// 注册状态可以通过 Stats 查询，状态变化通过 Events 通知。
+type Registration struct {
+	service string
+	addr    string
+
+	mu       sync.RWMutex
+	stats    Stats
+	events   chan Event
+	metadata interface{}            // 随地址一起注册的元数据，见 SetMetadata
+	groups   map[string]interface{} // 额外注册的子服务(缓存组)及其元数据，见 SetGroups
+	changed  chan struct{}          // 元数据或子服务变化时通知正在进行的注册立即更新
+
+	etcdConfig clientv3.Config // 连接etcd的配置，见 SetEtcdConfig
+	leaseTTL   time.Duration   // 租约的有效期，见 SetLeaseTTL
+	logger     logging.Logger  // 见 SetLogger
+}
+
+// NewRegistration 创建一个服务注册
+func NewRegistration(service string, addr string) *Registration {
+	return &Registration{
+		service: service,
+		addr:    addr,
+		events:  make(chan Event, eventBufferSize),
+		changed: make(chan struct{}, 1),
+
+		etcdConfig: DefaultEtcdConfig(),
+		leaseTTL:   defaultLeaseTTL,
+		logger:     logging.Nop,
+	}
+}
+
+// SetLogger 设置输出注册过程的日志，nil表示不输出(默认)，需要在 Run 之前调用
+func (r *Registration) SetLogger(l logging.Logger) {
+	r.mu.Lock()
+	r.logger = logging.OrNop(l)
+	r.mu.Unlock()
+}
+
+// SetLeaseTTL 设置注册使用的租约有效期，默认5秒，不足1秒按1秒计算，需要在 Run 之前调用。
+// 节点异常退出后其他节点最多经过ttl才能发现，ttl 过短时网络抖动容易导致租约过期，过期后会自动重新注册。
+func (r *Registration) SetLeaseTTL(ttl time.Duration) {
+	r.mu.Lock()
+	r.leaseTTL = ttl
+	r.mu.Unlock()
+}
+
+// leaseSeconds 返回租约有效期的秒数，向上取整且至少为1
+func leaseSeconds(ttl time.Duration) int64 {
+	sec := int64((ttl + time.Second - 1) / time.Second)
+	if sec < 1 {
+		sec = 1
+	}
+	return sec
+}
+
+// SetEtcdConfig 设置连接etcd的配置(地址、认证、TLS、超时)，默认为 DefaultEtcdConfig，需要在 Run 之前调用
+func (r *Registration) SetEtcdConfig(cfg clientv3.Config) {
+	r.mu.Lock()
+	r.etcdConfig = cfg
+	r.mu.Unlock()
+}
+
+// SetMetadata 设置随地址一起注册的元数据，会被序列化为JSON，已经注册时立即更新
+func (r *Registration) SetMetadata(md interface{}) {
+	r.mu.Lock()
+	r.metadata = md
+	r.mu.Unlock()
+	r.notifyChanged()
+}
+
+// SetGroups 设置本节点提供的缓存组，每个缓存组在 <service>/<group>/<addr> 下额外注册一条记录，值为该缓存组的元数据。
+// 这些记录与主记录使用同一个租约，并发写入；已经注册时立即更新，不再提供的缓存组的记录会被删除。
+func (r *Registration) SetGroups(groups map[string]interface{}) {
+	r.mu.Lock()
+	r.groups = make(map[string]interface{}, len(groups))
+	for g, md := range groups {
+		r.groups[g] = md
+	}
+	r.mu.Unlock()
+	r.notifyChanged()
+}
+
+// Groups 返回本节点注册的缓存组，按名称排序
+func (r *Registration) Groups() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	groups := make([]string, 0, len(r.groups))
+	for g := range r.groups {
+		groups = append(groups, g)
+	}
+	sort.Strings(groups)
+	return groups
+}
+
+// notifyChanged 非阻塞地通知注册内容发生了变化，多次变化合并为一次
+func (r *Registration) notifyChanged() {
+	select {
+	case r.changed <- struct{}{}:
+	default:
+	}
+}
+
+// publish 使用租约lid并发写入主记录和各缓存组的记录，删除published中不再提供的缓存组的记录，返回当前已写入的缓存组
+func (r *Registration) publish(cli *clientv3.Client, lid clientv3.LeaseID, published map[string]bool) (map[string]bool, error) {
+	r.mu.RLock()
+	metadata := r.metadata
+	groups := make(map[string]interface{}, len(r.groups))
+	for g, md := range r.groups {
+		groups[g] = md
+	}
+	r.mu.RUnlock()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, len(groups)+len(published)+1)
+	run := func(fn func() error) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := fn(); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	run(func() error { return etcdAdd(cli, lid, r.service, r.addr, metadata) })
+	current := make(map[string]bool, len(groups))
+	for g, md := range groups {
+		g, md := g, md
+		current[g] = true
+		run(func() error { return etcdAdd(cli, lid, r.service+"/"+g, r.addr, md) })
+	}
+	for g := range published {
+		if !current[g] {
+			g := g
+			run(func() error { return etcdDelete(cli, r.service+"/"+g, r.addr) })
+		}
+	}
+	wg.Wait()
+	close(errs)
+	return current, <-errs // 没有错误时从关闭的通道读到nil
+}
+
+// Stats 返回当前的注册状态
+func (r *Registration) Stats() Stats {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.stats
+}
+
+// Events 返回注册状态变化的事件通道。
+// 通道带有缓冲，如果调用者没有及时读取，新的事件会被丢弃而不会阻塞注册流程。
+func (r *Registration) Events() <-chan Event {
+	return r.events
+}
+
+// Run 注册服务并保持心跳，注册失败或心跳丢失时会自动重新注册。
+// 注意 Run将不会return 除非收到停止信号
+func (r *Registration) Run(stop chan error) error {
+	var attempt int64
+	for {
+		registered, stopped, err := r.register(stop, attempt)
+		if stopped {
+			return r.deregistered(err)
+		}
+
+		if registered { // 注册成功后丢失，重新从第一次开始退避
+			attempt = 0
+		}
+		attempt++
+		r.mu.Lock()
+		r.stats.Registered = false
+		r.stats.LeaseID = 0
+		r.stats.LeaseTTL = 0
+		r.stats.LastError = err
+		r.stats.ReconnectAttempts = attempt
+		r.mu.Unlock()
+		r.logger.Warn("registration lost", "addr", r.addr, "error", err, "attempt", attempt)
+		r.emit(Event{Type: EventLost, Attempt: attempt, Err: err})
+
+		select {
+		case err := <-stop:
+			return r.deregistered(err)
+		case <-time.After(backoff(attempt)):
+		}
+		r.emit(Event{Type: EventReconnecting, Attempt: attempt})
+	}
+}
+
+// register 完成一次注册并保持心跳，直到收到停止信号(stopped为true)或心跳丢失。registered 表示是否已经注册成功(发出了 EventRegistered)
+func (r *Registration) register(stop chan error, attempt int64) (registered, stopped bool, err error) {
 	// 创建一个etcd client
-	cli, err := clientv3.New(defaultEtcdConfig)
+	r.mu.RLock()
+	cfg, ttl := r.etcdConfig, leaseSeconds(r.leaseTTL)
+	r.mu.RUnlock()
+	cli, err := clientv3.New(cfg)
 	if err != nil {
-		return fmt.Errorf("create etcd client failed: %v", err)
+		return false, false, fmt.Errorf("create etcd client failed: %v", err)
 	}
 	defer cli.Close()
 
-	// 创建一个租约 配置5秒过期
-	resp, err := cli.Grant(context.Background(), 5)
+	// 创建一个租约，ttl秒后过期
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.DialTimeout)
+	resp, err := cli.Grant(ctx, ttl)
+	cancel()
 	if err != nil {
-		return fmt.Errorf("create lease failed: %v", err)
+		return false, false, fmt.Errorf("create lease failed: %v", err)
 	}
 	leaseId := resp.ID //获取了该租约的 ID
 
 	// 向 etcd 注册服务，并将服务端点加入到 etcd 中
-	err = etcdAdd(cli, leaseId, service, addr)
+	published, err := r.publish(cli, leaseId, nil)
 	if err != nil {
-		return fmt.Errorf("add etcd record failed: %v", err)
+		return false, false, fmt.Errorf("add etcd record failed: %v", err)
 	}
 
 	// 设置服务心跳检测,创建了一个保持租约活动的心跳通道 ch，确保租约在生命周期内保持有效。
@@ -60,35 +305,115 @@ func Register(service string, addr string, stop chan error) error {
 	//并接收心跳响应，然后将这些心跳响应发送到 ch 这个通道中
 	ch, err := cli.KeepAlive(context.Background(), leaseId)
 	if err != nil {
-		return fmt.Errorf("set keepalive failed: %v", err)
+		return false, false, fmt.Errorf("set keepalive failed: %v", err)
 	}
+	// 监听本节点的主记录，被误删(例如运维操作)时立即重新写入，租约仍然有效时不会被 KeepAlive 发现
+	watchCtx, stopWatch := context.WithCancel(context.Background())
+	defer stopWatch()
+	self := cli.Watch(watchCtx, r.service+"/"+r.addr)
 
-	log.Printf("[%s] register service ok\n", addr)
+	r.mu.Lock()
+	r.stats.Registered = true
+	r.stats.LeaseID = leaseId
+	r.stats.LeaseTTL = time.Duration(ttl) * time.Second
+	r.stats.LastKeepAlive = time.Now()
+	r.stats.LastError = nil
+	r.mu.Unlock()
+	r.logger.Info("service registered", "addr", r.addr, "lease", leaseId)
+	r.emit(Event{Type: EventRegistered, LeaseID: leaseId, Attempt: attempt})
 
 	for {
 		select {
 		case err := <-stop:
 			if err != nil {
-				log.Println(err)
+				r.logger.Warn("stop registration", "addr", r.addr, "error", err)
+			}
+			// 主动撤销租约，服务记录立即从etcd中删除，其他节点不必等到租约过期才停止向本节点发送请求
+			r.emit(Event{Type: EventLeaving, LeaseID: leaseId})
+			ctx, cancel := context.WithTimeout(context.Background(), cfg.DialTimeout)
+			if _, rerr := cli.Revoke(ctx, leaseId); rerr != nil {
+				r.logger.Warn("revoke lease failed", "addr", r.addr, "error", rerr)
+			}
+			cancel()
+			return true, true, err
+		case <-r.changed:
+			if published, err = r.publish(cli, leaseId, published); err != nil {
+				r.logger.Warn("update registration failed", "addr", r.addr, "error", err)
+			}
+		case wresp, ok := <-self:
+			if !ok || wresp.Err() != nil {
+				self = nil // 监听中断时不再监听，租约丢失仍然由 KeepAlive 发现
+				continue
+			}
+			if deleted(wresp.Events) {
+				r.logger.Info("registration deleted, republish", "addr", r.addr)
+				if published, err = r.publish(cli, leaseId, nil); err != nil {
+					r.logger.Warn("republish failed", "addr", r.addr, "error", err)
+				}
 			}
-			return err
 		case <-cli.Ctx().Done():
-			log.Println("service closed")
-			return nil
+			r.logger.Warn("etcd client closed", "addr", r.addr)
+			return true, false, errSessionClosed
 		case _, ok := <-ch:
 			// 监听租约
 			if !ok {
-				log.Println("keep alive channel closed")
-				_, err := cli.Revoke(context.Background(), leaseId)
-				return err
+				r.logger.Warn("keep alive channel closed", "addr", r.addr)
+				ctx, cancel := context.WithTimeout(context.Background(), cfg.DialTimeout)
+				_, _ = cli.Revoke(ctx, leaseId) // 尽力撤销旧租约，失败也会在租约到期后自动删除
+				cancel()
+				return true, false, errKeepAliveLost
 			}
-			//log.Printf("Recv reply from service: %s/%s, ttl:%d", service, addr, resp.TTL)
+			r.mu.Lock()
+			r.stats.LastKeepAlive = time.Now()
+			r.mu.Unlock()
 		}
 	}
 	/*
 		函数同时监听来自 stop 通道的停止信号、cli.Ctx().Done() 的服务关闭信号以及心跳通道 ch 的消息。
 		如果接收到停止信号，函数会返回；
-		如果服务被关闭，函数会打印日志并返回；
-		如果心跳通道被关闭，函数会撤销租约，并返回相应的错误。
+		如果服务被关闭或心跳通道被关闭，函数会返回相应的错误，由 Run 负责重新注册。
 	*/
 }
+
+// deleted 返回事件中是否有删除
+func deleted(events []*clientv3.Event) bool {
+	for _, e := range events {
+		if e.Type == clientv3.EventTypeDelete {
+			return true
+		}
+	}
+	return false
+}
+
+// deregistered 收到停止信号后更新状态并通知
+func (r *Registration) deregistered(err error) error {
+	r.mu.Lock()
+	r.stats.Registered = false
+	r.stats.LeaseID = 0
+	r.stats.LeaseTTL = 0
+	r.mu.Unlock()
+	r.emit(Event{Type: EventDeregistered})
+	return err
+}
+
+// emit 非阻塞地发送事件，通道满时丢弃
+func (r *Registration) emit(e Event) {
+	e.Service = r.service
+	e.Addr = r.addr
+	e.Time = time.Now()
+	select {
+	case r.events <- e:
+	default:
+	}
+}
+
+// backoff 计算第attempt次重新注册前的等待时间，指数增长并加入随机抖动，避免大量节点同时重连etcd
+func backoff(attempt int64) time.Duration {
+	d := maxBackoff
+	if attempt < 16 {
+		if b := minBackoff << uint(attempt-1); b < maxBackoff {
+			d = b
+		}
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
@@ -0,0 +1,71 @@
+package registry
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	prevMax := minBackoff / 2
+	for attempt := int64(1); attempt < 100; attempt++ {
+		d := backoff(attempt)
+		if d > maxBackoff {
+			t.Fatalf("attempt %d: backoff %v exceeds max %v", attempt, d, maxBackoff)
+		}
+		if d < minBackoff/2 {
+			t.Fatalf("attempt %d: backoff %v below min %v", attempt, d, minBackoff/2)
+		}
+		if attempt < 5 && d < prevMax {
+			t.Fatalf("attempt %d: backoff %v should grow, previous upper bound %v", attempt, d, prevMax)
+		}
+		prevMax = minBackoff << uint(attempt-1) / 2
+	}
+}
+
+func TestEmitDoesNotBlock(t *testing.T) {
+	r := NewRegistration("gocache", "localhost:9999")
+	for i := 0; i < eventBufferSize*2; i++ {
+		r.emit(Event{Type: EventLost})
+	}
+	e := <-r.Events()
+	if e.Service != "gocache" || e.Addr != "localhost:9999" || e.Type != EventLost {
+		t.Fatalf("unexpected event %+v", e)
+	}
+}
+
+func TestSetGroups(t *testing.T) {
+	r := NewRegistration("gocache", "localhost:9999")
+	r.SetMetadata("node")
+	r.SetGroups(map[string]interface{}{"scores": 1, "avatars": 2})
+	if groups := r.Groups(); len(groups) != 2 || groups[0] != "avatars" || groups[1] != "scores" {
+		t.Fatalf("unexpected groups %v", groups)
+	}
+	// 多次变化合并为一次通知，不会阻塞
+	<-r.changed
+	select {
+	case <-r.changed:
+		t.Fatal("changes should be coalesced")
+	default:
+	}
+}
+
+func TestLeaseSeconds(t *testing.T) {
+	for ttl, want := range map[time.Duration]int64{
+		0:                       1,
+		500 * time.Millisecond:  1,
+		5 * time.Second:         5,
+		5500 * time.Millisecond: 6,
+	} {
+		if got := leaseSeconds(ttl); got != want {
+			t.Errorf("leaseSeconds(%v) = %d, want %d", ttl, got, want)
+		}
+	}
+	r := NewRegistration("gocache", "localhost:9999")
+	if r.leaseTTL != defaultLeaseTTL {
+		t.Fatalf("default lease ttl = %v", r.leaseTTL)
+	}
+	r.SetLeaseTTL(30 * time.Second)
+	if r.leaseTTL != 30*time.Second {
+		t.Fatalf("lease ttl = %v", r.leaseTTL)
+	}
+}
@@ -0,0 +1,166 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"gocache/logging"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// EnvRegistry 选择注册中心的环境变量，见 FromEnv
+const EnvRegistry = "GOCACHE_REGISTRY"
+
+// Registry 服务注册与发现的后端，EtcdRegistry、ConsulRegistry、ZooKeeperRegistry 和 GossipRegistry 实现了该接口
+type Registry interface {
+	// Register 注册服务地址及其元数据并保持心跳，阻塞直到stop收到信号后注销；期间注册丢失时自动重新注册
+	Register(service, addr string, metadata interface{}, stop chan error) error
+	// Deregister 立即删除服务地址的注册，例如清理异常退出的节点留下的记录
+	Deregister(service, addr string) error
+	// Watch 监听服务下注册的地址，语义与 WatchNodes 相同：每次读取全部地址后调用fn，阻塞直到ctx被取消
+	Watch(ctx context.Context, service string, fn func(added, removed []string)) error
+	// Resolve 返回服务下当前注册的地址，已经排序
+	Resolve(ctx context.Context, service string) ([]string, error)
+}
+
+// New 按名称创建注册中心：etcd、consul、zookeeper 或 gossip，endpoints 为注册中心的地址(gossip为种子节点)，为空时使用默认地址或环境变量
+func New(backend string, endpoints ...string) (Registry, error) {
+	switch backend {
+	case "etcd", "":
+		cfg, err := EtcdConfigFromEnv(getenv)
+		if err != nil {
+			return nil, err
+		}
+		if len(endpoints) > 0 {
+			cfg.Endpoints = endpoints
+		}
+		return &EtcdRegistry{Config: cfg}, nil
+	case "consul":
+		r := ConsulFromEnv(getenv)
+		if len(endpoints) > 0 {
+			r.Addr = endpoints[0]
+		}
+		return r, nil
+	case "zookeeper", "zk":
+		r := ZooKeeperFromEnv(getenv)
+		if len(endpoints) > 0 {
+			r.Servers = endpoints
+		}
+		return r, nil
+	case "gossip":
+		r := GossipFromEnv(getenv)
+		if len(endpoints) > 0 {
+			r.Seeds = endpoints
+		}
+		return r, nil
+	}
+	return nil, fmt.Errorf("registry: unknown backend %q", backend)
+}
+
+// FromEnv 按环境变量 GOCACHE_REGISTRY(etcd、consul、zookeeper 或 gossip，默认为 etcd)创建注册中心，各后端的配置同样从环境变量读取
+func FromEnv() (Registry, error) {
+	return New(getenv(EnvRegistry))
+}
+
+// EtcdRegistry 基于etcd的注册中心，注册的记录与 Registration 相同
+type EtcdRegistry struct {
+	Config   clientv3.Config // 连接etcd的配置，见 EtcdConfigFromEnv
+	LeaseTTL time.Duration   // 租约的有效期，0表示默认的5秒
+	Logger   logging.Logger  // 输出注册和监听的日志，nil表示不输出
+}
+
+// Register 见 Registry.Register，使用 Registration 保持注册
+func (r *EtcdRegistry) Register(service, addr string, metadata interface{}, stop chan error) error {
+	reg := NewRegistration(service, addr)
+	reg.SetEtcdConfig(r.Config)
+	if r.LeaseTTL > 0 {
+		reg.SetLeaseTTL(r.LeaseTTL)
+	}
+	reg.SetMetadata(metadata)
+	reg.SetLogger(r.Logger)
+	return reg.Run(stop)
+}
+
+// Deregister 见 Registry.Deregister
+func (r *EtcdRegistry) Deregister(service, addr string) error {
+	cli, err := clientv3.New(r.Config)
+	if err != nil {
+		return err
+	}
+	defer cli.Close()
+	return etcdDelete(cli, service, addr)
+}
+
+// Watch 见 Registry.Watch
+func (r *EtcdRegistry) Watch(ctx context.Context, service string, fn func(added, removed []string)) error {
+	cli, err := clientv3.New(r.Config)
+	if err != nil {
+		return err
+	}
+	defer cli.Close()
+	return WatchNodesWithLogger(ctx, cli, service, fn, r.Logger)
+}
+
+// Resolve 见 Registry.Resolve，缓存组的记录(<service>/<group>/<addr>)不包括在内
+func (r *EtcdRegistry) Resolve(ctx context.Context, service string) ([]string, error) {
+	cli, err := clientv3.New(r.Config)
+	if err != nil {
+		return nil, err
+	}
+	defer cli.Close()
+	resp, err := cli.Get(ctx, service+"/", clientv3.WithPrefix(), clientv3.WithKeysOnly())
+	if err != nil {
+		return nil, err
+	}
+	nodes := nodeSet{prefix: service + "/"}
+	var addrs []string
+	for _, kv := range resp.Kvs {
+		if addr, ok := nodes.addr(string(kv.Key)); ok {
+			addrs = append(addrs, addr)
+		}
+	}
+	sort.Strings(addrs)
+	return addrs, nil
+}
+
+// diffAddrs 用当前的地址替换已知的地址，返回新增和消失的地址，已经排序
+func diffAddrs(known map[string]bool, current []string) (next map[string]bool, added, removed []string) {
+	next = make(map[string]bool, len(current))
+	for _, addr := range current {
+		next[addr] = true
+		if !known[addr] {
+			added = append(added, addr)
+		}
+	}
+	for addr := range known {
+		if !next[addr] {
+			removed = append(removed, addr)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	return next, added, removed
+}
+
+// splitList 拆分逗号分隔的列表，忽略空白的元素
+func splitList(s string) []string {
+	var out []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// 测试各后端是否实现了 Registry 接口
+var (
+	_ Registry = (*EtcdRegistry)(nil)
+	_ Registry = (*ConsulRegistry)(nil)
+	_ Registry = (*GossipRegistry)(nil)
+	_ Registry = (*ZooKeeperRegistry)(nil)
+)
@@ -0,0 +1,55 @@
+package registry
+
+import (
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// Stats 描述了服务在etcd中的注册状态
+type Stats struct {
+	Registered        bool             // 当前是否已注册并持有有效租约
+	LeaseID           clientv3.LeaseID // 当前使用的租约ID，未注册时为0
+	LeaseTTL          time.Duration    // 当前租约的有效期，未注册时为0，见 Registration.SetLeaseTTL
+	LastKeepAlive     time.Time        // 最近一次收到心跳响应的时间
+	ReconnectAttempts int64            // 累计的重新注册次数
+	LastError         error            // 最近一次注册失败的原因
+}
+
+// EventType 注册事件的类型
+type EventType int
+
+const (
+	EventRegistered   EventType = iota // 注册成功(包括重新注册成功)
+	EventLost                          // 租约心跳丢失或注册失败，即将重新注册
+	EventReconnecting                  // 退避等待结束，开始重新注册
+	EventDeregistered                  // 收到停止信号，注册结束
+	EventLeaving                       // 收到停止信号，即将删除注册记录，其他节点随后停止向本节点发送请求
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventRegistered:
+		return "registered"
+	case EventLost:
+		return "lost"
+	case EventReconnecting:
+		return "reconnecting"
+	case EventDeregistered:
+		return "deregistered"
+	case EventLeaving:
+		return "leaving"
+	}
+	return "unknown"
+}
+
+// Event 注册状态变化的事件
+type Event struct {
+	Type    EventType
+	Service string
+	Addr    string
+	LeaseID clientv3.LeaseID
+	Attempt int64 // 重新注册的次数，首次注册为0
+	Err     error // EventLost 时记录失败原因
+	Time    time.Time
+}
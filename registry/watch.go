@@ -0,0 +1,125 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"gocache/logging"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+var errWatchClosed = errors.New("watch channel closed")
+
+// WatchNodes 监听服务下注册的节点，节点注册或者注销(包括租约过期)时调用fn，added、removed 为变化的节点地址，已经排序。
+// 每次读取全部节点后都会调用一次fn(第一次的 added 为当前已经注册的全部节点)，即使没有变化，调用方可以据此判断已经同步。
+// <service>/<group>/<addr> 形式的缓存组记录会被忽略，同一个节点更新元数据不会产生通知。
+// 监听中断(例如etcd重启、历史版本被压缩)后以退避时间重新读取全部节点，与之前的结果对比后通知差异。
+// 阻塞直到ctx被取消，fn 在同一个goroutine中依次调用。
+func WatchNodes(ctx context.Context, c *clientv3.Client, service string, fn func(added, removed []string)) error {
+	return WatchNodesWithLogger(ctx, c, service, fn, nil)
+}
+
+// WatchNodesWithLogger 与 WatchNodes 相同，监听中断时通过logger(可以为nil)输出日志
+func WatchNodesWithLogger(ctx context.Context, c *clientv3.Client, service string, fn func(added, removed []string), logger logging.Logger) error {
+	logger = logging.OrNop(logger)
+	nodes := nodeSet{prefix: service + "/", known: map[string]bool{}}
+	var attempt int64
+	for {
+		synced, err := nodes.watch(ctx, c, fn)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if synced {
+			attempt = 0
+		}
+		attempt++
+		logger.Warn("watch nodes interrupted", "service", service, "error", err, "attempt", attempt)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff(attempt)):
+		}
+	}
+}
+
+// nodeSet 记录已经通知过的节点
+type nodeSet struct {
+	prefix string
+	known  map[string]bool
+}
+
+// watch 读取全部节点并通知差异，然后从读取时的版本开始监听变化，直到监听中断。synced 表示是否完成了读取
+func (n *nodeSet) watch(ctx context.Context, c *clientv3.Client, fn func(added, removed []string)) (synced bool, err error) {
+	resp, err := c.Get(ctx, n.prefix, clientv3.WithPrefix(), clientv3.WithKeysOnly())
+	if err != nil {
+		return false, err
+	}
+	keys := make([]string, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		keys = append(keys, string(kv.Key))
+	}
+	fn(n.sync(keys))
+
+	wch := c.Watch(ctx, n.prefix, clientv3.WithPrefix(), clientv3.WithRev(resp.Header.Revision+1))
+	for wresp := range wch {
+		if err := wresp.Err(); err != nil {
+			return true, err
+		}
+		var added, removed []string
+		for _, e := range wresp.Events {
+			if n.apply(string(e.Kv.Key), e.Type == clientv3.EventTypePut) {
+				addr, _ := n.addr(string(e.Kv.Key))
+				if e.Type == clientv3.EventTypePut {
+					added = append(added, addr)
+				} else {
+					removed = append(removed, addr)
+				}
+			}
+		}
+		if len(added) > 0 || len(removed) > 0 {
+			sort.Strings(added)
+			sort.Strings(removed)
+			fn(added, removed)
+		}
+	}
+	return true, errWatchClosed
+}
+
+// sync 用全部节点记录的key替换已知的节点，返回新增和消失的节点
+func (n *nodeSet) sync(keys []string) (added, removed []string) {
+	var current []string
+	for _, key := range keys {
+		if addr, ok := n.addr(key); ok {
+			current = append(current, addr)
+		}
+	}
+	n.known, added, removed = diffAddrs(n.known, current)
+	return added, removed
+}
+
+// apply 处理一条记录的写入(put为true)或删除，返回已知的节点是否发生了变化
+func (n *nodeSet) apply(key string, put bool) bool {
+	addr, ok := n.addr(key)
+	if !ok || n.known[addr] == put {
+		return false
+	}
+	if put {
+		n.known[addr] = true
+	} else {
+		delete(n.known, addr)
+	}
+	return true
+}
+
+// addr 从节点记录的key(<service>/<addr>)中取出节点地址，缓存组的记录返回false
+func (n *nodeSet) addr(key string) (string, bool) {
+	addr := strings.TrimPrefix(key, n.prefix)
+	if addr == key || addr == "" || strings.Contains(addr, "/") {
+		return "", false
+	}
+	return addr, true
+}
@@ -0,0 +1,33 @@
+package registry
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNodeSet(t *testing.T) {
+	n := nodeSet{prefix: "gocache/", known: map[string]bool{}}
+	added, removed := n.sync([]string{"gocache/b:1", "gocache/a:1", "gocache/scores/a:1", "other/c:1"})
+	if !reflect.DeepEqual(added, []string{"a:1", "b:1"}) || removed != nil {
+		t.Fatalf("first sync: added %v removed %v", added, removed)
+	}
+
+	if n.apply("gocache/a:1", true) {
+		t.Fatal("updating a known node should not be a change")
+	}
+	if n.apply("gocache/scores/c:1", true) {
+		t.Fatal("group records should be ignored")
+	}
+	if !n.apply("gocache/c:1", true) || !n.apply("gocache/b:1", false) {
+		t.Fatal("expect join and leave to be changes")
+	}
+	if n.apply("gocache/b:1", false) {
+		t.Fatal("deleting an unknown node should not be a change")
+	}
+
+	// 重新监听后与之前的结果对比
+	added, removed = n.sync([]string{"gocache/c:1", "gocache/d:1"})
+	if !reflect.DeepEqual(added, []string{"d:1"}) || !reflect.DeepEqual(removed, []string{"a:1"}) {
+		t.Fatalf("resync: added %v removed %v", added, removed)
+	}
+}
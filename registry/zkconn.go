@@ -0,0 +1,440 @@
+package registry
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+)
+
+// ZooKeeper协议中用到的操作码
+const (
+	zkOpCreate       = 1
+	zkOpDelete       = 2
+	zkOpGetData      = 4
+	zkOpGetChildren  = 8
+	zkOpPing         = 11
+	zkOpCloseSession = -11
+)
+
+// ZooKeeper协议中特殊的xid
+const (
+	zkXidWatch = -1 // 服务端推送的监听事件
+	zkXidPing  = -2
+)
+
+const (
+	zkFlagEphemeral = 1       // 临时节点，会话结束时删除
+	zkMaxPacket     = 4 << 20 // 一个响应的最大字节数，与ZooKeeper默认的 jute.maxbuffer 相近
+	zkDialTimeout   = 5 * time.Second
+)
+
+var (
+	errZKNoNode         = errors.New("zookeeper: node does not exist")
+	errZKNodeExists     = errors.New("zookeeper: node already exists")
+	errZKSessionExpired = errors.New("zookeeper: session expired")
+	errZKClosed         = errors.New("zookeeper: connection closed")
+)
+
+// zkError 把响应中的错误码转换为错误
+func zkError(code int32) error {
+	switch code {
+	case 0:
+		return nil
+	case -101:
+		return errZKNoNode
+	case -110:
+		return errZKNodeExists
+	case -112:
+		return errZKSessionExpired
+	}
+	return fmt.Errorf("zookeeper: error code %d", code)
+}
+
+// zkConn 一个ZooKeeper会话，只实现注册中心用到的操作：创建、删除、读取数据和子节点以及子节点的监听。
+// 连接断开即视为会话结束，不在其他服务器上恢复会话，由调用者重新建立会话(临时节点需要重新创建)
+type zkConn struct {
+	conn    net.Conn
+	timeout time.Duration // 服务端协商的会话超时时间
+
+	wmu     sync.Mutex // 保护写入
+	mu      sync.Mutex
+	xid     int32
+	pending map[int32]chan zkResponse // 等待响应的请求，连接断开后为nil
+
+	watch chan struct{} // 收到监听事件时发送信号，容量为1
+	done  chan struct{} // 连接断开时关闭
+}
+
+// zkResponse 一个请求的响应
+type zkResponse struct {
+	body []byte
+	err  error
+}
+
+// dialZK 随机选择一个服务器建立会话，失败时尝试下一个
+func dialZK(ctx context.Context, servers []string, sessionTimeout time.Duration) (*zkConn, error) {
+	if len(servers) == 0 {
+		return nil, errors.New("zookeeper: no servers")
+	}
+	var lastErr error
+	for _, i := range rand.Perm(len(servers)) {
+		c, err := connectZK(ctx, servers[i], sessionTimeout)
+		if err == nil {
+			return c, nil
+		}
+		lastErr = err
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, lastErr
+}
+
+// connectZK 连接一个服务器并建立新的会话
+func connectZK(ctx context.Context, server string, sessionTimeout time.Duration) (*zkConn, error) {
+	d := net.Dialer{Timeout: zkDialTimeout}
+	conn, err := d.DialContext(ctx, "tcp", server)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(zkDialTimeout))
+	var req zkEncoder
+	req.int32(0) // protocolVersion
+	req.int64(0) // lastZxidSeen
+	req.int32(int32(sessionTimeout / time.Millisecond))
+	req.int64(0)    // sessionId，0表示新的会话
+	req.bytes(nil)  // passwd
+	req.bool(false) // readOnly
+	if err := writeZKPacket(conn, req.buf); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	body, err := readZKPacket(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	resp := zkDecoder{buf: body}
+	resp.int32() // protocolVersion
+	timeout := time.Duration(resp.int32()) * time.Millisecond
+	if resp.err != nil || timeout <= 0 {
+		conn.Close()
+		return nil, errZKSessionExpired
+	}
+	conn.SetDeadline(time.Time{})
+	c := &zkConn{
+		conn:    conn,
+		timeout: timeout,
+		pending: map[int32]chan zkResponse{},
+		watch:   make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+	go c.receive()
+	go c.ping()
+	return c, nil
+}
+
+// receive 读取响应并交给等待的请求，连接断开时唤醒所有等待的请求
+func (c *zkConn) receive() {
+	var err error
+	for {
+		c.conn.SetReadDeadline(time.Now().Add(c.timeout * 2 / 3)) // 心跳间隔为会话超时的三分之一，超过三分之二没有响应视为断开
+		var body []byte
+		if body, err = readZKPacket(c.conn); err != nil {
+			break
+		}
+		d := zkDecoder{buf: body}
+		xid := d.int32()
+		d.int64() // zxid
+		code := d.int32()
+		if d.err != nil {
+			err = d.err
+			break
+		}
+		switch xid {
+		case zkXidWatch:
+			select {
+			case c.watch <- struct{}{}:
+			default:
+			}
+			continue
+		case zkXidPing:
+			continue
+		}
+		c.mu.Lock()
+		ch := c.pending[xid]
+		delete(c.pending, xid)
+		c.mu.Unlock()
+		if ch != nil {
+			ch <- zkResponse{body: d.buf[d.off:], err: zkError(code)}
+		}
+	}
+	c.mu.Lock()
+	pending := c.pending
+	c.pending = nil
+	c.mu.Unlock()
+	for _, ch := range pending {
+		ch <- zkResponse{err: err}
+	}
+	close(c.done)
+	c.conn.Close()
+}
+
+// ping 每隔会话超时的三分之一发送一次心跳，保持会话
+func (c *zkConn) ping() {
+	ticker := time.NewTicker(c.timeout / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+		}
+		var req zkEncoder
+		req.int32(zkXidPing)
+		req.int32(zkOpPing)
+		c.write(req.buf)
+	}
+}
+
+// write 发送一个请求，写入失败时关闭连接
+func (c *zkConn) write(packet []byte) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(c.timeout))
+	err := writeZKPacket(c.conn, packet)
+	if err != nil {
+		c.conn.Close()
+	}
+	return err
+}
+
+// call 发送请求并等待响应，fill 写入请求体，返回响应体
+func (c *zkConn) call(ctx context.Context, op int32, fill func(*zkEncoder)) ([]byte, error) {
+	ch := make(chan zkResponse, 1)
+	c.mu.Lock()
+	if c.pending == nil {
+		c.mu.Unlock()
+		return nil, errZKClosed
+	}
+	c.xid++
+	if c.xid <= 0 { // 负数的xid有特殊含义
+		c.xid = 1
+	}
+	xid := c.xid
+	c.pending[xid] = ch
+	c.mu.Unlock()
+
+	var req zkEncoder
+	req.int32(xid)
+	req.int32(op)
+	fill(&req)
+	if err := c.write(req.buf); err != nil {
+		return nil, err
+	}
+	select {
+	case resp := <-ch:
+		if resp.err == nil || errors.Is(resp.err, errZKNoNode) || errors.Is(resp.err, errZKNodeExists) {
+			return resp.body, resp.err
+		}
+		return nil, resp.err
+	case <-ctx.Done():
+		c.mu.Lock()
+		delete(c.pending, xid)
+		c.mu.Unlock()
+		return nil, ctx.Err()
+	}
+}
+
+// create 创建节点，data 为节点的数据，使用 world:anyone 的全部权限
+func (c *zkConn) create(ctx context.Context, path string, data []byte, flags int32) error {
+	_, err := c.call(ctx, zkOpCreate, func(e *zkEncoder) {
+		e.string(path)
+		e.bytes(data)
+		e.int32(1)  // ACL的数量
+		e.int32(31) // 全部权限
+		e.string("world")
+		e.string("anyone")
+		e.int32(flags)
+	})
+	return err
+}
+
+// ensurePath 创建path以及所有不存在的上级节点(持久节点)
+func (c *zkConn) ensurePath(ctx context.Context, path string) error {
+	for i := 1; i <= len(path); i++ {
+		if i == len(path) || path[i] == '/' {
+			if err := c.create(ctx, path[:i], nil, 0); err != nil && !errors.Is(err, errZKNodeExists) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// delete 删除节点，不检查版本
+func (c *zkConn) delete(ctx context.Context, path string) error {
+	_, err := c.call(ctx, zkOpDelete, func(e *zkEncoder) {
+		e.string(path)
+		e.int32(-1)
+	})
+	return err
+}
+
+// getData 返回节点的数据
+func (c *zkConn) getData(ctx context.Context, path string) ([]byte, error) {
+	body, err := c.call(ctx, zkOpGetData, func(e *zkEncoder) {
+		e.string(path)
+		e.bool(false)
+	})
+	if err != nil {
+		return nil, err
+	}
+	d := zkDecoder{buf: body}
+	data := d.bytes()
+	return data, d.err
+}
+
+// children 返回节点的子节点，watch 为true时在子节点变化后向 c.watch 发送信号(只触发一次)
+func (c *zkConn) children(ctx context.Context, path string, watch bool) ([]string, error) {
+	body, err := c.call(ctx, zkOpGetChildren, func(e *zkEncoder) {
+		e.string(path)
+		e.bool(watch)
+	})
+	if err != nil {
+		return nil, err
+	}
+	d := zkDecoder{buf: body}
+	n := d.int32()
+	var names []string
+	for i := int32(0); i < n && d.err == nil; i++ {
+		names = append(names, d.string())
+	}
+	return names, d.err
+}
+
+// close 结束会话(服务端立即删除会话的临时节点)并关闭连接
+func (c *zkConn) close() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	c.call(ctx, zkOpCloseSession, func(*zkEncoder) {})
+	c.conn.Close()
+	<-c.done
+}
+
+// zkEncoder 按ZooKeeper的jute格式编码请求
+type zkEncoder struct {
+	buf []byte
+}
+
+func (e *zkEncoder) int32(v int32) {
+	e.buf = binary.BigEndian.AppendUint32(e.buf, uint32(v))
+}
+
+func (e *zkEncoder) int64(v int64) {
+	e.buf = binary.BigEndian.AppendUint64(e.buf, uint64(v))
+}
+
+func (e *zkEncoder) bool(v bool) {
+	if v {
+		e.buf = append(e.buf, 1)
+	} else {
+		e.buf = append(e.buf, 0)
+	}
+}
+
+// bytes 编码长度和数据，nil编码为长度-1
+func (e *zkEncoder) bytes(v []byte) {
+	if v == nil {
+		e.int32(-1)
+		return
+	}
+	e.int32(int32(len(v)))
+	e.buf = append(e.buf, v...)
+}
+
+func (e *zkEncoder) string(v string) {
+	e.int32(int32(len(v)))
+	e.buf = append(e.buf, v...)
+}
+
+// zkDecoder 按ZooKeeper的jute格式解码响应，数据不完整时记录错误并返回零值
+type zkDecoder struct {
+	buf []byte
+	off int
+	err error
+}
+
+func (d *zkDecoder) next(n int) []byte {
+	if d.err != nil || n < 0 || d.off+n > len(d.buf) {
+		if d.err == nil {
+			d.err = errors.New("zookeeper: malformed packet")
+		}
+		return nil
+	}
+	b := d.buf[d.off : d.off+n]
+	d.off += n
+	return b
+}
+
+func (d *zkDecoder) int32() int32 {
+	if b := d.next(4); b != nil {
+		return int32(binary.BigEndian.Uint32(b))
+	}
+	return 0
+}
+
+func (d *zkDecoder) int64() int64 {
+	if b := d.next(8); b != nil {
+		return int64(binary.BigEndian.Uint64(b))
+	}
+	return 0
+}
+
+func (d *zkDecoder) bool() bool {
+	b := d.next(1)
+	return b != nil && b[0] != 0
+}
+
+// bytes 解码长度和数据，长度为-1时返回nil
+func (d *zkDecoder) bytes() []byte {
+	n := d.int32()
+	if n < 0 {
+		return nil
+	}
+	return append([]byte(nil), d.next(int(n))...)
+}
+
+func (d *zkDecoder) string() string {
+	return string(d.bytes())
+}
+
+// writeZKPacket 写入一个带长度前缀的数据包
+func writeZKPacket(w io.Writer, packet []byte) error {
+	buf := binary.BigEndian.AppendUint32(make([]byte, 0, 4+len(packet)), uint32(len(packet)))
+	_, err := w.Write(append(buf, packet...))
+	return err
+}
+
+// readZKPacket 读取一个带长度前缀的数据包
+func readZKPacket(r io.Reader) ([]byte, error) {
+	var size [4]byte
+	if _, err := io.ReadFull(r, size[:]); err != nil {
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(size[:])
+	if n > zkMaxPacket {
+		return nil, fmt.Errorf("zookeeper: packet too large (%d bytes)", n)
+	}
+	body := make([]byte, n)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
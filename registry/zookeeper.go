@@ -0,0 +1,213 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"time"
+
+	"gocache/logging"
+)
+
+// 没有通过参数指定ZooKeeper配置时读取的环境变量
+const (
+	EnvZKServers = "GOCACHE_ZK_SERVERS" // 逗号分隔的ZooKeeper地址，默认为 127.0.0.1:2181
+	EnvZKRoot    = "GOCACHE_ZK_ROOT"    // 注册记录的根节点，默认为 /gocache
+)
+
+const (
+	defaultZKServer = "127.0.0.1:2181"
+	defaultZKRoot   = "/gocache"
+	zkTimeout       = 10 * time.Second // 非阻塞请求的超时时间
+)
+
+// ZooKeeperRegistry 基于ZooKeeper的注册中心。节点注册为 <Root>/<service>/<addr> 临时节点，节点的数据为元数据(JSON)，
+// 由会话的心跳维持：进程退出或者与ZooKeeper断开超过会话超时时间后，ZooKeeper自动删除该节点。
+// Watch 通过子节点的监听获得成员变化。
+type ZooKeeperRegistry struct {
+	Servers        []string       // ZooKeeper的地址，例如 10.0.0.1:2181
+	Root           string         // 注册记录的根节点，默认为 /gocache
+	SessionTimeout time.Duration  // 会话超时时间，0表示默认的5秒，实际值由ZooKeeper协商
+	Logger         logging.Logger // 输出注册和监听的日志，nil表示不输出
+}
+
+func (r *ZooKeeperRegistry) logger() logging.Logger {
+	return logging.OrNop(r.Logger)
+}
+
+// ZooKeeperFromEnv 按环境变量 GOCACHE_ZK_SERVERS、GOCACHE_ZK_ROOT 创建ZooKeeper注册中心，getenv 一般传入 os.Getenv
+func ZooKeeperFromEnv(getenv func(string) string) *ZooKeeperRegistry {
+	return &ZooKeeperRegistry{Servers: splitList(getenv(EnvZKServers)), Root: getenv(EnvZKRoot)}
+}
+
+// dial 建立新的会话
+func (r *ZooKeeperRegistry) dial(ctx context.Context) (*zkConn, error) {
+	servers := r.Servers
+	if len(servers) == 0 {
+		servers = []string{defaultZKServer}
+	}
+	timeout := r.SessionTimeout
+	if timeout <= 0 {
+		timeout = defaultLeaseTTL
+	}
+	return dialZK(ctx, servers, timeout)
+}
+
+// servicePath 返回服务的节点，其子节点为注册的地址
+func (r *ZooKeeperRegistry) servicePath(service string) string {
+	root := r.Root
+	if root == "" {
+		root = defaultZKRoot
+	}
+	return path.Join("/", root, service)
+}
+
+// Register 见 Registry.Register。会话断开(例如ZooKeeper重启或者网络中断)后以退避时间建立新的会话并重新创建临时节点
+func (r *ZooKeeperRegistry) Register(service, addr string, metadata interface{}, stop chan error) error {
+	var data []byte
+	if metadata != nil {
+		var err error
+		if data, err = json.Marshal(metadata); err != nil {
+			return fmt.Errorf("zookeeper: marshal metadata: %v", err)
+		}
+	}
+	dir := r.servicePath(service)
+	node := dir + "/" + addr
+	var attempt int64
+	for {
+		conn, err := r.register(dir, node, data)
+		if err != nil {
+			attempt++
+			r.logger().Warn("zookeeper register failed", "addr", addr, "error", err, "attempt", attempt)
+			select {
+			case err := <-stop:
+				return err
+			case <-time.After(backoff(attempt)):
+			}
+			continue
+		}
+		attempt = 0
+		r.logger().Info("service registered", "addr", addr, "backend", "zookeeper")
+		select {
+		case err := <-stop:
+			ctx, cancel := context.WithTimeout(context.Background(), zkTimeout)
+			if derr := conn.delete(ctx, node); derr != nil && !errors.Is(derr, errZKNoNode) {
+				r.logger().Warn("zookeeper deregister failed", "addr", addr, "error", derr)
+			}
+			cancel()
+			conn.close()
+			return err
+		case <-conn.done:
+			r.logger().Warn("zookeeper session lost", "addr", addr)
+		}
+	}
+}
+
+// register 建立会话并创建临时节点。上一个会话留下的同名节点(会话还没有超时)被替换
+func (r *ZooKeeperRegistry) register(dir, node string, data []byte) (*zkConn, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), zkTimeout)
+	defer cancel()
+	conn, err := r.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err = conn.ensurePath(ctx, dir); err == nil {
+		err = conn.create(ctx, node, data, zkFlagEphemeral)
+		if errors.Is(err, errZKNodeExists) {
+			if err = conn.delete(ctx, node); err == nil || errors.Is(err, errZKNoNode) {
+				err = conn.create(ctx, node, data, zkFlagEphemeral)
+			}
+		}
+	}
+	if err != nil {
+		conn.close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// Deregister 见 Registry.Deregister
+func (r *ZooKeeperRegistry) Deregister(service, addr string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), zkTimeout)
+	defer cancel()
+	conn, err := r.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.close()
+	if err := conn.delete(ctx, r.servicePath(service)+"/"+addr); err != nil && !errors.Is(err, errZKNoNode) {
+		return err
+	}
+	return nil
+}
+
+// Watch 见 Registry.Watch，会话断开时以退避时间建立新的会话并重新读取全部地址
+func (r *ZooKeeperRegistry) Watch(ctx context.Context, service string, fn func(added, removed []string)) error {
+	dir := r.servicePath(service)
+	var known map[string]bool
+	var attempt int64
+	first := true
+	for {
+		conn, err := r.dial(ctx)
+		if err == nil {
+			if err = conn.ensurePath(ctx, dir); err == nil {
+				err = r.watch(ctx, conn, dir, func(addrs []string) {
+					var added, removed []string
+					known, added, removed = diffAddrs(known, addrs)
+					if first || len(added) > 0 || len(removed) > 0 {
+						fn(added, removed)
+					}
+					first, attempt = false, 0
+				})
+			}
+			conn.close()
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		attempt++
+		r.logger().Warn("zookeeper watch failed", "service", service, "error", err, "attempt", attempt)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff(attempt)):
+		}
+	}
+}
+
+// watch 在一个会话中持续监听子节点，每次变化后用全部地址调用fn，直到会话断开或者ctx被取消
+func (r *ZooKeeperRegistry) watch(ctx context.Context, conn *zkConn, dir string, fn func(addrs []string)) error {
+	for {
+		addrs, err := conn.children(ctx, dir, true)
+		if err != nil {
+			return err
+		}
+		sort.Strings(addrs)
+		fn(addrs)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-conn.done:
+			return errZKClosed
+		case <-conn.watch:
+		}
+	}
+}
+
+// Resolve 见 Registry.Resolve
+func (r *ZooKeeperRegistry) Resolve(ctx context.Context, service string) ([]string, error) {
+	conn, err := r.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.close()
+	addrs, err := conn.children(ctx, r.servicePath(service), false)
+	if errors.Is(err, errZKNoNode) {
+		return nil, nil
+	}
+	sort.Strings(addrs)
+	return addrs, err
+}
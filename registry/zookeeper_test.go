@@ -0,0 +1,300 @@
+package registry
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeZK 模拟ZooKeeper服务端的会话、节点和子节点监听，连接断开时立即删除会话的临时节点
+type fakeZK struct {
+	ln net.Listener
+
+	mu       sync.Mutex
+	session  int64
+	nodes    map[string]*fakeZNode
+	watches  map[string][]*fakeZKSession // 父节点 -> 监听子节点的会话
+	sessions map[*fakeZKSession]bool
+}
+
+type fakeZNode struct {
+	data  []byte
+	owner *fakeZKSession // 临时节点所属的会话，持久节点为nil
+}
+
+type fakeZKSession struct {
+	conn net.Conn
+	wmu  sync.Mutex
+}
+
+func (s *fakeZKSession) send(xid int32, code int32, body []byte) {
+	var e zkEncoder
+	e.int32(xid)
+	e.int64(0)
+	e.int32(code)
+	s.wmu.Lock()
+	writeZKPacket(s.conn, append(e.buf, body...))
+	s.wmu.Unlock()
+}
+
+func newFakeZK(t *testing.T) *fakeZK {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeZK{ln: ln, nodes: map[string]*fakeZNode{"/": {}}, watches: map[string][]*fakeZKSession{}, sessions: map[*fakeZKSession]bool{}}
+	t.Cleanup(func() { ln.Close(); f.kill() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+	return f
+}
+
+// kill 断开所有会话，模拟ZooKeeper重启
+func (f *fakeZK) kill() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for s := range f.sessions {
+		s.conn.Close()
+	}
+}
+
+func (f *fakeZK) serve(conn net.Conn) {
+	s := &fakeZKSession{conn: conn}
+	defer func() {
+		conn.Close()
+		f.mu.Lock()
+		delete(f.sessions, s)
+		for p, n := range f.nodes {
+			if n.owner == s {
+				f.removeLocked(p)
+			}
+		}
+		f.mu.Unlock()
+	}()
+	body, err := readZKPacket(conn)
+	if err != nil {
+		return
+	}
+	req := zkDecoder{buf: body}
+	req.int32()
+	req.int64()
+	timeout := req.int32()
+	f.mu.Lock()
+	f.session++
+	var e zkEncoder
+	e.int32(0)
+	e.int32(timeout)
+	e.int64(f.session)
+	e.bytes(make([]byte, 16))
+	e.bool(false)
+	f.sessions[s] = true
+	f.mu.Unlock()
+	if writeZKPacket(conn, e.buf) != nil {
+		return
+	}
+	for {
+		body, err := readZKPacket(conn)
+		if err != nil {
+			return
+		}
+		d := zkDecoder{buf: body}
+		xid, op := d.int32(), d.int32()
+		f.mu.Lock()
+		code, resp := f.handleLocked(s, op, &d)
+		f.mu.Unlock()
+		s.send(xid, code, resp)
+		if op == zkOpCloseSession {
+			return
+		}
+	}
+}
+
+func (f *fakeZK) handleLocked(s *fakeZKSession, op int32, d *zkDecoder) (int32, []byte) {
+	var e zkEncoder
+	switch op {
+	case zkOpCreate:
+		p, data := d.string(), d.bytes()
+		for n := d.int32(); n > 0; n-- { // ACL
+			d.int32()
+			d.string()
+			d.string()
+		}
+		flags := d.int32()
+		if f.nodes[p] != nil {
+			return -110, nil
+		}
+		if f.nodes[parentZKPath(p)] == nil {
+			return -101, nil
+		}
+		n := &fakeZNode{data: data}
+		if flags&zkFlagEphemeral != 0 {
+			n.owner = s
+		}
+		f.nodes[p] = n
+		f.fireLocked(parentZKPath(p))
+		e.string(p)
+	case zkOpDelete:
+		p := d.string()
+		if f.nodes[p] == nil {
+			return -101, nil
+		}
+		f.removeLocked(p)
+	case zkOpGetData:
+		p := d.string()
+		n := f.nodes[p]
+		if n == nil {
+			return -101, nil
+		}
+		e.bytes(n.data)
+		e.buf = append(e.buf, make([]byte, 68)...) // stat
+	case zkOpGetChildren:
+		p, watch := d.string(), d.bool()
+		if f.nodes[p] == nil {
+			return -101, nil
+		}
+		var names []string
+		for c := range f.nodes {
+			if c != "/" && parentZKPath(c) == p {
+				names = append(names, c[strings.LastIndex(c, "/")+1:])
+			}
+		}
+		sort.Strings(names)
+		e.int32(int32(len(names)))
+		for _, name := range names {
+			e.string(name)
+		}
+		if watch {
+			f.watches[p] = append(f.watches[p], s)
+		}
+	}
+	return 0, e.buf
+}
+
+func (f *fakeZK) removeLocked(p string) {
+	delete(f.nodes, p)
+	f.fireLocked(parentZKPath(p))
+}
+
+// fireLocked 触发父节点上的子节点监听，每个监听只触发一次
+func (f *fakeZK) fireLocked(parent string) {
+	for _, s := range f.watches[parent] {
+		var e zkEncoder
+		e.int32(4) // NodeChildrenChanged
+		e.int32(3) // SyncConnected
+		e.string(parent)
+		go s.send(zkXidWatch, 0, e.buf)
+	}
+	delete(f.watches, parent)
+}
+
+func (f *fakeZK) node(p string) *fakeZNode {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.nodes[p]
+}
+
+func parentZKPath(p string) string {
+	if i := strings.LastIndex(p, "/"); i > 0 {
+		return p[:i]
+	}
+	return "/"
+}
+
+func TestZooKeeperRegistry(t *testing.T) {
+	fake := newFakeZK(t)
+	r := &ZooKeeperRegistry{Servers: []string{fake.ln.Addr().String()}, SessionTimeout: time.Second}
+
+	updates := make(chan [2][]string, 16)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go r.Watch(ctx, "gocache", func(added, removed []string) { updates <- [2][]string{added, removed} })
+	if u := <-updates; len(u[0]) != 0 || len(u[1]) != 0 {
+		t.Fatalf("first sync should be empty, got %v", u)
+	}
+
+	stop := make(chan error)
+	done := make(chan error, 1)
+	go func() { done <- r.Register("gocache", "10.0.0.1:8001", map[string]string{"zone": "a"}, stop) }()
+	if u := <-updates; !reflect.DeepEqual(u[0], []string{"10.0.0.1:8001"}) {
+		t.Fatalf("expect the node to join, got %v", u)
+	}
+	if n := fake.node("/gocache/gocache/10.0.0.1:8001"); n == nil || n.owner == nil {
+		t.Fatalf("expect an ephemeral node, got %+v", n)
+	}
+	addrs, err := r.Resolve(context.Background(), "gocache")
+	if err != nil || !reflect.DeepEqual(addrs, []string{"10.0.0.1:8001"}) {
+		t.Fatalf("Resolve = %v, %v", addrs, err)
+	}
+	if md, err := r.Metadata(context.Background(), "gocache", "10.0.0.1:8001"); err != nil || string(md) != `{"zone":"a"}` {
+		t.Fatalf("Metadata = %s, %v", md, err)
+	}
+	if _, err := r.Metadata(context.Background(), "gocache", "10.0.0.9:8001"); err == nil {
+		t.Fatal("expect an error for an unregistered address")
+	}
+	if addrs, err := r.Resolve(context.Background(), "other"); err != nil || len(addrs) != 0 {
+		t.Fatalf("Resolve(other) = %v, %v", addrs, err)
+	}
+
+	// 会话断开后临时节点被删除，注册建立新的会话后重新创建
+	owner := fake.node("/gocache/gocache/10.0.0.1:8001").owner
+	fake.kill()
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		if n := fake.node("/gocache/gocache/10.0.0.1:8001"); n != nil && n.owner != owner {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("node did not register again after the session was lost")
+		}
+	}
+
+	// 监听建立新的会话后继续收到变化；删除其他节点留下的记录
+	other := &ZooKeeperRegistry{Servers: r.Servers, SessionTimeout: time.Second}
+	otherStop := make(chan error)
+	defer close(otherStop)
+	go other.Register("gocache", "10.0.0.2:8001", nil, otherStop)
+	for joined := false; !joined; {
+		select {
+		case u := <-updates:
+			joined = reflect.DeepEqual(u[0], []string{"10.0.0.2:8001"})
+		case <-time.After(5 * time.Second):
+			t.Fatal("watch did not see the second node join")
+		}
+	}
+	if err := r.Deregister("gocache", "10.0.0.2:8001"); err != nil {
+		t.Fatal(err)
+	}
+	if u := <-updates; !reflect.DeepEqual(u[1], []string{"10.0.0.2:8001"}) {
+		t.Fatalf("expect the second node to leave, got %v", u)
+	}
+
+	stop <- nil
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if u := <-updates; !reflect.DeepEqual(u[1], []string{"10.0.0.1:8001"}) {
+		t.Fatalf("expect the node to leave, got %v", u)
+	}
+}
+
+func TestZooKeeperFromEnv(t *testing.T) {
+	env := map[string]string{EnvZKServers: "10.0.0.1:2181, 10.0.0.2:2181", EnvZKRoot: "/cache"}
+	r := ZooKeeperFromEnv(func(k string) string { return env[k] })
+	if !reflect.DeepEqual(r.Servers, []string{"10.0.0.1:2181", "10.0.0.2:2181"}) || r.servicePath("gocache") != "/cache/gocache" {
+		t.Fatalf("unexpected registry %+v", r)
+	}
+	if p := (&ZooKeeperRegistry{}).servicePath("gocache"); p != "/gocache/gocache" {
+		t.Fatalf("default service path = %s", p)
+	}
+}
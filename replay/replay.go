@@ -0,0 +1,115 @@
+// Package replay 记录缓存操作的精简日志并按原始顺序重放，
+// 用户可以把录制的日志附在缓存击穿、负载不均之类的问题报告中，由维护者在测试集群上复现。
+package replay
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"gocache/consistenthash"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// OpType 操作的类型
+type OpType string
+
+const (
+	OpGet      OpType = "get"      // 读取，Hit 表示是否命中本地缓存
+	OpSet      OpType = "set"      // 显式写入
+	OpTopology OpType = "topology" // 哈希环的节点变化，Nodes 为变化后的全部节点
+)
+
+// Op 是日志中的一条操作，每条占一行JSON。key 经过哈希处理，日志中不包含原始的key和数据
+type Op struct {
+	T     int64    `json:"t"` // 距离开始录制的纳秒数
+	Type  OpType   `json:"op"`
+	Group string   `json:"g,omitempty"`
+	Key   string   `json:"k,omitempty"`
+	Size  int      `json:"s,omitempty"` // 数据的字节数
+	Hit   bool     `json:"h,omitempty"`
+	Nodes []string `json:"n,omitempty"`
+}
+
+// HashKey 对key做哈希处理，同一个key总是得到同一个结果，因此重放时路由和命中情况与原始请求一致
+func HashKey(key string) string {
+	return strconv.FormatUint(consistenthash.XXHash64([]byte(key)), 16)
+}
+
+// Recorder 将操作写入日志，可以被多个goroutine并发使用
+type Recorder struct {
+	mu    sync.Mutex
+	w     *bufio.Writer
+	enc   *json.Encoder
+	start time.Time
+	err   error // 第一次写入失败的错误，之后的操作被丢弃
+}
+
+// NewRecorder 创建一个写入w的 Recorder，时间从创建时开始计算
+func NewRecorder(w io.Writer) *Recorder {
+	bw := bufio.NewWriter(w)
+	return &Recorder{w: bw, enc: json.NewEncoder(bw), start: time.Now()}
+}
+
+// Record 记录一条操作，op.T 由 Recorder 填写，op.Key 应当已经由 HashKey 处理
+func (r *Recorder) Record(op Op) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return
+	}
+	op.T = int64(time.Since(r.start))
+	r.err = r.enc.Encode(op)
+}
+
+// Flush 将缓冲的操作写入底层的 io.Writer，返回录制过程中遇到的第一个错误
+func (r *Recorder) Flush() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return r.err
+	}
+	r.err = r.w.Flush()
+	return r.err
+}
+
+// Target 是重放的目标，例如由测试节点组成的集群
+type Target interface {
+	Get(group, key string, size int) error
+	Set(group, key string, size int) error
+	SetTopology(nodes []string) error
+}
+
+// Replay 按顺序重放日志中的操作，返回重放的操作数量。
+// speed 为重放速度相对原始速度的倍数，例如2表示两倍速；speed<=0 时不等待，尽可能快地重放，
+// 此时结果只取决于操作的顺序，适合在测试中复现问题。Target 返回的错误不会中断重放。
+func Replay(r io.Reader, t Target, speed float64) (n int, err error) {
+	dec := json.NewDecoder(r)
+	start := time.Now()
+	for {
+		var op Op
+		if err := dec.Decode(&op); err == io.EOF {
+			return n, nil
+		} else if err != nil {
+			return n, fmt.Errorf("replay: op %d: %v", n+1, err)
+		}
+		if speed > 0 {
+			if d := time.Duration(float64(op.T)/speed) - time.Since(start); d > 0 {
+				time.Sleep(d)
+			}
+		}
+		switch op.Type {
+		case OpGet:
+			t.Get(op.Group, op.Key, op.Size)
+		case OpSet:
+			t.Set(op.Group, op.Key, op.Size)
+		case OpTopology:
+			t.SetTopology(op.Nodes)
+		default:
+			return n, fmt.Errorf("replay: op %d: unknown type %q", n+1, op.Type)
+		}
+		n++
+	}
+}
@@ -0,0 +1,58 @@
+package replay
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+type fakeTarget struct {
+	ops []string
+}
+
+func (t *fakeTarget) Get(group, key string, size int) error {
+	t.ops = append(t.ops, fmt.Sprintf("get %s/%s %d", group, key, size))
+	return nil
+}
+
+func (t *fakeTarget) Set(group, key string, size int) error {
+	t.ops = append(t.ops, fmt.Sprintf("set %s/%s %d", group, key, size))
+	return nil
+}
+
+func (t *fakeTarget) SetTopology(nodes []string) error {
+	t.ops = append(t.ops, fmt.Sprintf("topology %v", nodes))
+	return nil
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	var buf bytes.Buffer
+	r := NewRecorder(&buf)
+	r.Record(Op{Type: OpTopology, Nodes: []string{"a", "b"}})
+	r.Record(Op{Type: OpGet, Group: "scores", Key: HashKey("Tom"), Size: 3})
+	r.Record(Op{Type: OpSet, Group: "scores", Key: HashKey("Tom"), Size: 4})
+	if err := r.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(buf.Bytes(), []byte("Tom")) {
+		t.Fatal("trace should not contain raw keys")
+	}
+
+	target := &fakeTarget{}
+	n, err := Replay(&buf, target, 0)
+	if err != nil || n != 3 {
+		t.Fatalf("Replay = %d, %v", n, err)
+	}
+	h := HashKey("Tom")
+	want := []string{"topology [a b]", "get scores/" + h + " 3", "set scores/" + h + " 4"}
+	if !reflect.DeepEqual(target.ops, want) {
+		t.Fatalf("replayed %v, want %v", target.ops, want)
+	}
+}
+
+func TestReplayBadTrace(t *testing.T) {
+	if _, err := Replay(bytes.NewBufferString(`{"op":"nope"}`), &fakeTarget{}, 0); err == nil {
+		t.Fatal("expect error for unknown op")
+	}
+}
@@ -0,0 +1,92 @@
+package gocache
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// RetryPolicy 远程读取失败时的重试策略。只有状态码属于 RetryableCodes 的错误才会重试，
+// 两次尝试之间按指数增长等待并加入随机抖动；请求携带截止时间时，等待之后会超过截止时间的重试不会进行。
+type RetryPolicy struct {
+	MaxAttempts    int           // 最多尝试的次数(包括第一次)，小于等于1表示不重试
+	InitialBackoff time.Duration // 第一次重试前的等待时间
+	MaxBackoff     time.Duration // 等待时间的上限
+	Multiplier     float64       // 每次重试后等待时间的增长倍数，小于1时按1计算
+	RetryableCodes []codes.Code  // 可以重试的状态码
+}
+
+// DefaultRetryPolicy 默认的重试策略：节点暂时不可用(连接断开、正在重启、加载被限流)时最多再重试两次。
+// 限流和过载保护返回的 codes.ResourceExhausted 默认不重试，重试只会加重对方的负担，见 IsOverloaded。
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: 50 * time.Millisecond,
+	MaxBackoff:     time.Second,
+	Multiplier:     2,
+	RetryableCodes: []codes.Code{codes.Unavailable, codes.Aborted},
+}
+
+// WithRetryPolicy 设置访问其他节点读取数据失败时的重试策略，默认为 DefaultRetryPolicy
+func WithRetryPolicy(p RetryPolicy) ServerOption {
+	return func(s *Server) {
+		s.retry = p
+	}
+}
+
+// retryable 返回err是否可以重试
+func (p RetryPolicy) retryable(err error) bool {
+	code := status.Code(err)
+	for _, c := range p.RetryableCodes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// backoff 返回第attempt次重试前的等待时间，在指数增长的等待时间的一半到全部之间随机选择
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	mult := p.Multiplier
+	if mult < 1 {
+		mult = 1
+	}
+	d := float64(p.InitialBackoff)
+	for i := 1; i < attempt && (p.MaxBackoff <= 0 || d < float64(p.MaxBackoff)); i++ {
+		d *= mult
+	}
+	if p.MaxBackoff > 0 && d > float64(p.MaxBackoff) {
+		d = float64(p.MaxBackoff)
+	}
+	if d <= 0 {
+		return 0
+	}
+	return time.Duration(d/2 + rand.Float64()*d/2)
+}
+
+// withRetry 按重试策略执行fn，deadline 为请求的截止时间(UnixNano)，0表示没有截止时间。
+// 等待重试期间ctx结束时不再重试，返回最近一次的错误
+func (c *Client) withRetry(ctx context.Context, deadline int64, fn func() error) error {
+	p := c.retry
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= p.MaxAttempts || !p.retryable(err) {
+			return err
+		}
+		wait := p.backoff(attempt)
+		if deadline != 0 && time.Now().Add(wait).After(time.Unix(0, deadline)) {
+			return err
+		}
+		c.retries.Add(1)
+		c.logger.Debug("retry peer request", "peer", c.peerAddr(), "attempt", attempt, "wait", wait, "error", err)
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
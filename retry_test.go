@@ -0,0 +1,103 @@
+package gocache
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	pb "gocache/gocachepb"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestRetry(t *testing.T) {
+	NewGroup("retry", 2<<10, "lru", GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}))
+	var failures, code atomic.Int64
+	failing := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if strings.HasSuffix(info.FullMethod, "/Get") && failures.Add(-1) >= 0 {
+			return nil, status.Error(codes.Code(code.Load()), "injected failure")
+		}
+		return handler(ctx, req)
+	}
+	svr, _ := NewServer("127.0.0.1:9712", WithUnaryInterceptors(failing))
+	addr, stop := serveGRPC(t, svr)
+	defer stop()
+
+	c := directClient(addr)
+	defer c.Close()
+	c.retry.InitialBackoff = time.Millisecond
+	get := func(in *pb.Request) error {
+		return c.Get(in, &pb.Response{})
+	}
+
+	// 暂时不可用的节点在重试次数内恢复
+	failures.Store(2)
+	code.Store(int64(codes.Unavailable))
+	if err := get(&pb.Request{Group: "retry", Key: "a"}); err != nil {
+		t.Fatalf("Get after 2 transient failures: %v", err)
+	}
+	if n := c.retries.Get(); n != 2 {
+		t.Fatalf("retries = %d, want 2", n)
+	}
+
+	// 超过最多尝试次数
+	failures.Store(3)
+	if err := get(&pb.Request{Group: "retry", Key: "b"}); status.Code(err) != codes.Unavailable {
+		t.Fatalf("Get after 3 failures = %v, want Unavailable", err)
+	}
+
+	// 不可重试的状态码
+	failures.Store(1)
+	code.Store(int64(codes.Internal))
+	before := c.retries.Get()
+	if err := get(&pb.Request{Group: "retry", Key: "c"}); status.Code(err) != codes.Internal {
+		t.Fatalf("Get = %v, want Internal", err)
+	}
+	if c.retries.Get() != before {
+		t.Fatal("non-retryable error was retried")
+	}
+
+	// 等待之后会超过截止时间时不再重试
+	failures.Store(1)
+	code.Store(int64(codes.Unavailable))
+	c.retry.InitialBackoff = time.Second
+	c.retry.MaxBackoff = time.Second
+	deadline := time.Now().Add(200 * time.Millisecond).UnixNano()
+	if err := get(&pb.Request{Group: "retry", Key: "d", Deadline: deadline}); status.Code(err) != codes.Unavailable {
+		t.Fatalf("Get = %v, want Unavailable without retry", err)
+	}
+	if c.retries.Get() != before {
+		t.Fatal("retried past the request deadline")
+	}
+
+	// 调用者取消时不再等待重试，返回最近一次的错误
+	failures.Store(1)
+	c.retry.InitialBackoff = time.Minute
+	c.retry.MaxBackoff = time.Minute
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := c.getShared(ctx, &pb.Request{Group: "retry", Key: "e"}, &pb.Response{}); status.Code(err) != codes.Unavailable {
+		t.Fatalf("Get = %v, want Unavailable", err)
+	}
+	if d := time.Since(start); d > 10*time.Second {
+		t.Fatalf("backoff ignored the cancelled context, took %v", d)
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	p := RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second, Multiplier: 2}
+	for attempt, want := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 3: 400 * time.Millisecond, 10: time.Second} {
+		for i := 0; i < 20; i++ {
+			if d := p.backoff(attempt); d < want/2 || d > want {
+				t.Fatalf("backoff(%d) = %v, want in [%v, %v]", attempt, d, want/2, want)
+			}
+		}
+	}
+}
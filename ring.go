@@ -0,0 +1,51 @@
+package gocache
+
+import (
+	"gocache/consistenthash"
+	"time"
+)
+
+// RingState 是哈希环的快照，可以直接序列化为JSON，用于检查负载是否均衡以及排查key的路由
+type RingState struct {
+	Self         string                       `json:"self"`
+	Time         time.Time                    `json:"time"`
+	Nodes        []RingNode                   `json:"nodes"`
+	VirtualNodes []consistenthash.VirtualNode `json:"virtual_nodes"`
+}
+
+// RingNode 是哈希环上一个真实节点的统计
+type RingNode struct {
+	Addr         string  `json:"addr"`
+	VirtualNodes int     `json:"virtual_nodes"` // 该节点在哈希环上的虚拟节点数量
+	Keyspace     float64 `json:"keyspace"`      // 该节点负责的哈希空间比例
+	HasClient    bool    `json:"has_client"`    // 是否已经有到该节点的客户端
+}
+
+// RingState 返回当前哈希环的快照，节点按地址排序
+func (s *Server) RingState() RingState {
+	ring := s.peers.Clone() // 固定一个快照，保证节点、虚拟节点和分布来自同一个哈希环
+	state := RingState{Self: s.self, Time: time.Now(), VirtualNodes: ring.VirtualNodes()}
+	counts := make(map[string]int)
+	for _, v := range state.VirtualNodes {
+		counts[v.Node]++
+	}
+	dist := ring.Distribution()
+
+	s.mu.RLock()
+	for _, addr := range ring.Nodes() {
+		_, ok := s.clients[addr]
+		state.Nodes = append(state.Nodes, RingNode{
+			Addr:         addr,
+			VirtualNodes: counts[addr],
+			Keyspace:     dist[addr],
+			HasClient:    ok || addr == s.self,
+		})
+	}
+	s.mu.RUnlock()
+	return state
+}
+
+// Owner 返回key在哈希环上的归属节点以及路由时使用的哈希值，用于排查某个key为什么被分配到某个节点
+func (s *Server) Owner(key string) consistenthash.Ownership {
+	return s.peers.Owner(key)
+}
@@ -0,0 +1,116 @@
+package gocache
+
+import (
+	"gocache/consistenthash"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	ringSubBufferSize = 16  // 每个哈希环变化订阅者的通道缓冲大小
+	ringSampleKeys    = 128 // 每次哈希环变化时最多抽样检查的已缓存key数量
+)
+
+// RingChange 描述一次哈希环节点集合的变化
+type RingChange struct {
+	Version uint64    // 变化后哈希环的版本号，见 consistenthash.Map.Version
+	Time    time.Time // 变化发生的时间
+	Nodes   []string  // 变化后的全部节点
+	Added   []string  // 新加入的节点
+	Removed []string  // 被删除的节点
+	Sampled int       // 抽样检查的本地已缓存key数量
+	Moves   []KeyMove // 抽样的key中归属发生变化的key
+}
+
+// KeyMove 记录一个key在哈希环变化前后的归属节点
+type KeyMove struct {
+	Group string
+	Key   string
+	From  string
+	To    string
+}
+
+// ringSubs 哈希环变化的订阅者
+type ringSubs struct {
+	mu   sync.Mutex
+	subs map[chan RingChange]struct{}
+}
+
+// SubscribeRing 订阅哈希环节点集合的变化，返回变化通道和取消订阅的函数，取消订阅后通道会被关闭。
+// 节点集合没有变化的 Set、Remove 不会产生通知；订阅者读取过慢时，来不及读取的通知会被丢弃。
+func (s *Server) SubscribeRing() (<-chan RingChange, func()) {
+	ch := make(chan RingChange, ringSubBufferSize)
+	s.ringSubs.mu.Lock()
+	if s.ringSubs.subs == nil {
+		s.ringSubs.subs = make(map[chan RingChange]struct{})
+	}
+	s.ringSubs.subs[ch] = struct{}{}
+	s.ringSubs.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			s.ringSubs.mu.Lock()
+			delete(s.ringSubs.subs, ch)
+			close(ch)
+			s.ringSubs.mu.Unlock()
+		})
+	}
+}
+
+// notifyRing 在哈希环变化后通知所有订阅者
+func (s *Server) notifyRing(oldRing, newRing *consistenthash.Map) {
+	if oldRing.Version() == newRing.Version() {
+		return
+	}
+	s.ringSubs.mu.Lock()
+	defer s.ringSubs.mu.Unlock()
+	if len(s.ringSubs.subs) == 0 {
+		return
+	}
+	change := diffRings(s.self, oldRing, newRing)
+	for ch := range s.ringSubs.subs {
+		select {
+		case ch <- change:
+		default:
+		}
+	}
+}
+
+// diffRings 对比新旧哈希环，并抽样检查本地已缓存key的归属变化
+func diffRings(self string, oldRing, newRing *consistenthash.Map) RingChange {
+	change := RingChange{Version: newRing.Version(), Time: time.Now(), Nodes: newRing.Nodes()}
+	oldNodes, newNodes := oldRing.Nodes(), newRing.Nodes()
+	change.Added = subtract(newNodes, oldNodes)
+	change.Removed = subtract(oldNodes, newNodes)
+
+	for _, g := range allGroups() {
+		if g.mainCache == nil {
+			continue
+		}
+		g.mainCache.rangeKeys(func(key string) bool { // 只读取抽样的key，不复制全部key，也不占用缓存的锁
+			change.Sampled++
+			from, to := ownerOf(oldRing, key, self), ownerOf(newRing, key, self)
+			if from != to {
+				change.Moves = append(change.Moves, KeyMove{Group: g.name, Key: key, From: from, To: to})
+			}
+			return change.Sampled < ringSampleKeys
+		})
+		if change.Sampled >= ringSampleKeys {
+			break
+		}
+	}
+	return change
+}
+
+// subtract 返回在a中但不在b中的元素，a和b都是有序的
+func subtract(a, b []string) []string {
+	var diff []string
+	for _, x := range a {
+		if i := sort.SearchStrings(b, x); i == len(b) || b[i] != x {
+			diff = append(diff, x)
+		}
+	}
+	return diff
+}
@@ -0,0 +1,46 @@
+package gocache
+
+import (
+	"sync"
+
+	pb "gocache/gocachepb"
+
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+)
+
+// 远程读取热路径上复用的对象。
+//
+// 请求方每次读取都需要一个 Request 和一个 Response，用完后放回池中；响应中的 Value 会被缓存和调用者继续引用，
+// 放回前由 proto.Reset 清空，数据本身不会被复用。
+//
+// 服务端的 Response 不复用：gRPC 在处理函数返回之后才序列化响应，stats handler 和 binlog 在序列化之后仍会读取它，
+// 处理函数无法知道何时可以安全回收。序列化得到的发送缓冲区交给传输层异步写出，同样不能复用。
+var (
+	requestPool  = sync.Pool{New: func() interface{} { return new(pb.Request) }}
+	responsePool = sync.Pool{New: func() interface{} { return new(pb.Response) }}
+
+	// rpcBufferPool 是服务端和请求方共享的接收缓冲区池，gRPC 反序列化完成后归还缓冲区。
+	// proto.Unmarshal 会复制 bytes 字段，Value 不会引用池中的缓冲区
+	rpcBufferPool = grpc.NewSharedBufferPool()
+)
+
+func getRequest() *pb.Request {
+	return requestPool.Get().(*pb.Request)
+}
+
+// putRequest 清空请求并放回池中，调用者之后不能再使用req
+func putRequest(req *pb.Request) {
+	proto.Reset(req)
+	requestPool.Put(req)
+}
+
+func getResponse() *pb.Response {
+	return responsePool.Get().(*pb.Response)
+}
+
+// putResponse 清空响应并放回池中，调用者之后不能再使用res，但可以继续使用之前读取到的 res.Value
+func putResponse(res *pb.Response) {
+	proto.Reset(res)
+	responsePool.Put(res)
+}
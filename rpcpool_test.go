@@ -0,0 +1,97 @@
+package gocache
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"testing"
+
+	pb "gocache/gocachepb"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// benchServer 在随机端口上启动gRPC服务，返回直接连接该服务的客户端
+func benchServer(b *testing.B, name string, value []byte) (*Group, *Client) {
+	g := NewGroup(name, 0, "lru", GetterFunc(func(key string) ([]byte, error) {
+		return value, nil
+	}))
+	g.Set("k", value, 0)
+	svr, _ := NewServer("127.0.0.1:9731")
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		b.Fatal(err)
+	}
+	svr.setServing(true)
+	gs := svr.newGRPCServer()
+	go gs.Serve(lis)
+	b.Cleanup(gs.Stop)
+	c := NewClient("gocache/" + lis.Addr().String())
+	c.connect = c.directConnect
+	b.Cleanup(func() { c.Close() })
+	return g, c
+}
+
+// BenchmarkPeerGet 测量从远程节点读取一个key的完整路径(请求方的 Group、Client 和服务端的 Server.Get)的耗时和内存分配
+func BenchmarkPeerGet(b *testing.B) {
+	for _, size := range []int{16, 4 << 10} {
+		b.Run(byteSize(size), func(b *testing.B) {
+			g, c := benchServer(b, "bench-peer-get", make([]byte, size))
+			ctx := context.Background()
+			if _, _, err := g.getFromPeer(ctx, c, "k"); err != nil {
+				b.Fatal(err)
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, _, err := g.getFromPeer(ctx, c, "k"); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkServerGet 测量服务端处理一次 Get 的内存分配，不包括网络和编解码
+func BenchmarkServerGet(b *testing.B) {
+	NewGroup("bench-server-get", 0, "lru", GetterFunc(func(key string) ([]byte, error) {
+		return make([]byte, 4<<10), nil
+	})).Set("k", make([]byte, 4<<10), 0)
+	svr, _ := NewServer("127.0.0.1:9732")
+	ctx := context.Background()
+	in := &pb.Request{Group: "bench-server-get", Key: "k", ProtocolVersion: protocolVersion}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := svr.Get(ctx, in); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkCopyRequest 对比请求方每次克隆请求和复用池中的请求
+func BenchmarkCopyRequest(b *testing.B) {
+	in := &pb.Request{Group: "scores", Key: "Tom", TraceId: newTraceID(), Caller: "127.0.0.1:9999", Deadline: 1}
+	b.Run("clone", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			req := proto.Clone(in).(*pb.Request)
+			req.ProtocolVersion = protocolVersion
+		}
+	})
+	b.Run("pool", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			req := getRequest()
+			proto.Merge(req, in)
+			req.ProtocolVersion = protocolVersion
+			putRequest(req)
+		}
+	})
+}
+
+func byteSize(n int) string {
+	if n >= 1<<10 {
+		return strconv.Itoa(n>>10) + "KiB"
+	}
+	return strconv.Itoa(n) + "B"
+}
@@ -0,0 +1,347 @@
+// Package s3store 把快照保存到S3兼容的对象存储(AWS S3、MinIO、Ceph RGW等)，实现了 gocache.SnapshotStore。
+// 只使用 PUT、GET、DELETE 和 ListObjectsV2 四个接口，请求使用 AWS Signature Version 4 签名，按路径风格访问存储桶：
+//
+//	store := &s3store.Store{Endpoint: "http://minio:9000", Bucket: "gocache", Prefix: "node-1/", AccessKey: "...", SecretKey: "..."}
+//	svr, _ := gocache.NewServer(addr, gocache.WithSnapshots(store, 10*time.Minute, 3))
+package s3store
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 没有通过参数指定时读取的环境变量，与AWS官方工具相同
+const (
+	EnvAccessKey    = "AWS_ACCESS_KEY_ID"
+	EnvSecretKey    = "AWS_SECRET_ACCESS_KEY"
+	EnvSessionToken = "AWS_SESSION_TOKEN"
+	EnvRegion       = "AWS_REGION"
+	EnvEndpoint     = "AWS_ENDPOINT_URL" // 例如 http://minio:9000，为空时使用AWS S3
+)
+
+const (
+	defaultRegion   = "us-east-1"
+	unsignedPayload = "UNSIGNED-PAYLOAD"
+	amzDateLayout   = "20060102T150405Z"
+)
+
+// Store 保存在存储桶 Bucket 中以 Prefix 开头的对象里的快照。每个节点应当使用不同的 Prefix
+type Store struct {
+	Endpoint     string       // 对象存储的地址，例如 https://s3.amazonaws.com、http://minio:9000，为空时按 Region 使用AWS S3
+	Region       string       // 签名使用的区域，为空表示 us-east-1
+	Bucket       string       // 存储桶
+	Prefix       string       // 对象名的前缀，例如 "gocache/node-1/"
+	AccessKey    string       // 访问密钥
+	SecretKey    string       // 访问密钥对应的私钥
+	SessionToken string       // 临时凭证的令牌，可以为空
+	Client       *http.Client // 发送请求使用的HTTP客户端，nil表示 http.DefaultClient
+}
+
+// FromEnv 按环境变量 AWS_ACCESS_KEY_ID、AWS_SECRET_ACCESS_KEY、AWS_SESSION_TOKEN、AWS_REGION、AWS_ENDPOINT_URL
+// 创建保存在存储桶bucket中的 Store，getenv 一般传入 os.Getenv
+func FromEnv(bucket, prefix string, getenv func(string) string) *Store {
+	return &Store{
+		Endpoint:     getenv(EnvEndpoint),
+		Region:       getenv(EnvRegion),
+		Bucket:       bucket,
+		Prefix:       prefix,
+		AccessKey:    getenv(EnvAccessKey),
+		SecretKey:    getenv(EnvSecretKey),
+		SessionToken: getenv(EnvSessionToken),
+	}
+}
+
+func (s *Store) region() string {
+	if s.Region == "" {
+		return defaultRegion
+	}
+	return s.Region
+}
+
+func (s *Store) client() *http.Client {
+	if s.Client == nil {
+		return http.DefaultClient
+	}
+	return s.Client
+}
+
+// objectURL 返回对象(name不为空)或存储桶的地址
+func (s *Store) objectURL(name string) (*url.URL, error) {
+	endpoint := s.Endpoint
+	if endpoint == "" {
+		endpoint = "https://s3." + s.region() + ".amazonaws.com"
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if s.Bucket == "" {
+		return nil, fmt.Errorf("s3store: bucket is required")
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + s.Bucket
+	if name != "" {
+		u.Path += "/" + s.Prefix + name
+	}
+	u.RawPath = escape(u.Path, false) // 与签名使用相同的转义
+	return u, nil
+}
+
+// Put 先把快照写入临时文件，得到长度后再上传，S3的PUT请求需要预先知道长度
+func (s *Store) Put(ctx context.Context, name string, r io.Reader) error {
+	f, err := os.CreateTemp("", "gocache-snapshot-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(f, h), r)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	u, err := s.objectURL(name)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, u.String(), io.NopCloser(f))
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", "application/octet-stream")
+	resp, err := s.do(req, hex.EncodeToString(h.Sum(nil)))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Open 下载快照，对象不存在时返回的错误满足 errors.Is(err, fs.ErrNotExist)
+func (s *Store) Open(ctx context.Context, name string) (io.ReadCloser, error) {
+	u, err := s.objectURL(name)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.do(req, unsignedPayload)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// listResult 是 ListObjectsV2 的响应
+type listResult struct {
+	Contents []struct {
+		Key string `xml:"Key"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// List 分页列出以prefix开头的快照，返回的名字不包含 Store.Prefix
+func (s *Store) List(ctx context.Context, prefix string) ([]string, error) {
+	var names []string
+	token := ""
+	for {
+		u, err := s.objectURL("")
+		if err != nil {
+			return nil, err
+		}
+		q := url.Values{"list-type": {"2"}, "prefix": {s.Prefix + prefix}}
+		if token != "" {
+			q.Set("continuation-token", token)
+		}
+		u.RawQuery = q.Encode()
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := s.do(req, unsignedPayload)
+		if err != nil {
+			return nil, err
+		}
+		var res listResult
+		err = xml.NewDecoder(resp.Body).Decode(&res)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("s3store: decode list response: %v", err)
+		}
+		for _, c := range res.Contents {
+			names = append(names, strings.TrimPrefix(c.Key, s.Prefix))
+		}
+		if !res.IsTruncated || res.NextContinuationToken == "" {
+			return names, nil
+		}
+		token = res.NextContinuationToken
+	}
+}
+
+// Delete 删除快照，S3删除不存在的对象也返回成功
+func (s *Store) Delete(ctx context.Context, name string) error {
+	u, err := s.objectURL(name)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := s.do(req, unsignedPayload)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Error 是对象存储返回的错误响应
+type Error struct {
+	StatusCode int
+	Code       string `xml:"Code"`
+	Message    string `xml:"Message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("s3store: %d %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+// Is 使404的错误满足 errors.Is(err, fs.ErrNotExist)
+func (e *Error) Is(target error) bool {
+	return target == fs.ErrNotExist && e.StatusCode == http.StatusNotFound
+}
+
+// do 签名并发送请求，状态码不是2xx时关闭响应并返回 *Error
+func (s *Store) do(req *http.Request, payloadHash string) (*http.Response, error) {
+	s.sign(req, payloadHash, time.Now())
+	resp, err := s.client().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 == 2 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	e := &Error{StatusCode: resp.StatusCode}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if xml.Unmarshal(body, e) != nil || e.Code == "" {
+		e.Code, e.Message = http.StatusText(resp.StatusCode), strings.TrimSpace(string(body))
+	}
+	return nil, e
+}
+
+// sign 按 AWS Signature Version 4 为请求添加 Authorization 等请求头，请求头中已有的字段都参与签名
+func (s *Store) sign(req *http.Request, payloadHash string, t time.Time) {
+	t = t.UTC()
+	amzDate := t.Format(amzDateLayout)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if s.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.SessionToken)
+	}
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	headers := map[string]string{"host": host}
+	for k, v := range req.Header {
+		headers[strings.ToLower(k)] = strings.Join(strings.Fields(strings.Join(v, ",")), " ")
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := t.Format("20060102") + "/" + s.region() + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hexSHA256(canonicalRequest)
+
+	key := hmacSHA256([]byte("AWS4"+s.SecretKey), t.Format("20060102"))
+	for _, part := range []string{s.region(), "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.AccessKey, scope, signedHeaders, signature))
+}
+
+// canonicalQuery 按键排序并转义查询参数
+func canonicalQuery(q url.Values) string {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		vs := append([]string(nil), q[k]...)
+		sort.Strings(vs)
+		for _, v := range vs {
+			parts = append(parts, escape(k, true)+"="+escape(v, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// escape 按RFC 3986转义，只保留非保留字符，slash 为true时也转义路径分隔符
+func escape(s string, slash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == '~' || c == '/' && !slash {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
+
+func hexSHA256(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
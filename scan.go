@@ -0,0 +1,73 @@
+package gocache
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// KeyInfo 描述了主缓存中一个key的元数据，用于离线分析
+type KeyInfo struct {
+	Key    string
+	Size   int       // 缓存中存储的数据大小(字节)，即经过变换链之后的大小
+	Added  time.Time // 最近一次写入的时间
+	Expire time.Time // 过期时间，零值表示永不过期
+	Hits   int64     // 命中次数，包括主缓存和热点缓存
+}
+
+// maxScanLimit 单次 Scan 最多返回的key数量
+const maxScanLimit = 10000
+
+// Scan 分页枚举本节点主缓存中的key，返回cursor之后的至多limit个key的元数据。
+// 第一次调用传入空的cursor，之后传入上一次返回的next，next为空表示已经枚举完毕。
+// key 按只读索引的分片依次返回，分片内按字典序，每一页只持有一个分片的读锁，不需要复制全部的key；
+// cursor 记录了分片的序号和上一个返回的key。两次调用之间写入的key如果排在cursor之前则不会被返回，Scan 不是快照。
+func (g *Group) Scan(cursor string, limit int) (infos []KeyInfo, next string) {
+	if limit <= 0 || limit > maxScanLimit {
+		limit = maxScanLimit
+	}
+	shard, after := parseScanCursor(cursor)
+	for shard < indexShards {
+		n := limit - len(infos)
+		keys := g.mainCache.scanKeys(shard, after, n)
+		for _, key := range keys {
+			after = key
+			if info, ok := g.Inspect(key); ok { // 不存在说明已经过期或被淘汰
+				infos = append(infos, info)
+			}
+		}
+		if len(infos) == limit {
+			return infos, strconv.Itoa(shard) + "/" + after
+		}
+		if len(keys) < n { // 这个分片已经枚举完毕
+			shard, after = shard+1, ""
+		}
+	}
+	return infos, ""
+}
+
+// parseScanCursor 解析 Scan 的cursor，格式为 <分片序号>/<上一个key>，无法解析时从头开始
+func parseScanCursor(cursor string) (shard int, after string) {
+	s, after, ok := strings.Cut(cursor, "/")
+	if !ok {
+		return 0, ""
+	}
+	shard, err := strconv.Atoi(s)
+	if err != nil || shard < 0 {
+		return 0, ""
+	}
+	return shard, after
+}
+
+// Inspect 返回本节点主缓存中key的元数据，不影响淘汰顺序和命中次数，key不存在或已经过期时返回false
+func (g *Group) Inspect(key string) (KeyInfo, bool) {
+	v, ok := g.mainCache.peek(key)
+	if !ok {
+		return KeyInfo{}, false
+	}
+	added, hits, _ := g.mainCache.stat(key)
+	if _, hot, ok := g.hotCache.stat(key); ok { // 热点缓存拦截的命中也计入
+		hits += hot
+	}
+	return KeyInfo{Key: key, Size: v.Len(), Added: added, Expire: v.Expire(), Hits: hits}, true
+}
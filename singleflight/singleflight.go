@@ -1,43 +1,303 @@
 package singleflight
 
-import "sync"
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"gocache/topk"
+)
+
+// defaultTrackedKeys 按key统计重复调用时默认最多跟踪的key数量，见 Group.TrackedKeys
+const defaultTrackedKeys = 64
+
+// ErrGoexit 当执行函数调用了 runtime.Goexit 时，返回给等待同一个key的其他调用者
+var ErrGoexit = errors.New("singleflight: runtime.Goexit was called")
+
+// PanicError 当执行函数 panic 时，作为错误返回给等待同一个key的其他调用者，原始调用者会重新 panic
+type PanicError struct {
+	Value interface{} // recover() 得到的值
+	Stack []byte      // panic 发生时的调用栈
+}
+
+func (p *PanicError) Error() string {
+	return fmt.Sprintf("singleflight: panic: %v\n\n%s", p.Value, p.Stack)
+}
+
+func newPanicError(v interface{}) error {
+	stack := debug.Stack()
+	// 第一行是 "goroutine N [status]:"，goroutine 已经不存在了，去掉以免误导
+	if line := bytes.IndexByte(stack, '\n'); line >= 0 {
+		stack = stack[line+1:]
+	}
+	return &PanicError{Value: v, Stack: stack}
+}
 
 // call是一个正在进行或已完成的Do调用
 type call struct {
 	wg  sync.WaitGroup
 	val interface{}
 	err error
+
+	dups  int             // 等待同一个调用结果的重复调用者数量
+	chans []chan<- Result // DoChan 调用者的结果通道
+
+	waiters int                // 仍在等待结果的调用者数量，只有 DoCtx 的调用者会提前离开
+	cancel  context.CancelFunc // 取消 DoCtx 执行函数的上下文，所有等待者都离开时调用
+
+	done   bool // 调用已完成，结果在 HoldTime 窗口内仍保留在映射表中
+	shared bool // 调用完成时结果是否已经被共享，在持有 g.mu 时由 dups 计算，窗口内的调用者仍会增加 dups
 }
 
 type Group struct {
 	mu sync.Mutex       // 用于保护m
 	m  map[string]*call // 存储函数调用的映射表，key为调用的唯一标识，value为对应的call结构体指针
+
+	// HoldTime 调用成功完成后，结果继续保留的时间窗口(例如100ms)。
+	// 窗口内对同一个key的调用直接复用该结果，而不是重新执行，用于吸收紧跟在完成之后到达的突发请求。
+	// 0表示调用完成后立即移除。出错、panic 的结果不会被保留。应在使用 Group 之前设置。
+	HoldTime time.Duration
+
+	// TrackedKeys 按key统计重复调用时最多跟踪的key数量，0表示64，负数表示不按key统计。
+	// 超出后只保留被合并最多的key(Space-Saving)，计数是估计值，内存不会随key的数量增长。应在使用 Group 之前设置。
+	TrackedKeys int
+
+	calls     int64         // 实际执行fn的次数
+	dups      int64         // 被合并、共享了结果的重复调用次数
+	dupsByKey *topk.Summary // 每个key被合并的重复调用次数，只记录发生过合并的key
+}
+
+// Stats 是 Group 调用统计的快照，用于衡量对缓存击穿(thundering herd)的抑制效果
+type Stats struct {
+	Calls     int64            // 实际执行fn的次数
+	Dups      int64            // 被合并、共享了结果的重复调用次数
+	DupsByKey map[string]int64 // 被合并最多的key的重复调用次数，最多 TrackedKeys 个，key较多时是估计值
+}
+
+// Result 保存了Do的执行结果，通过 DoChan 返回的通道传递给调用者
+type Result struct {
+	Val    interface{}
+	Err    error
+	Shared bool // 结果是否被多个调用者共享
 }
 
 // Do 执行给定的函数，并返回结果，确保每个key只有一个执行在进行中。
 // 如果重复调用发生，则重复调用者会等待原始调用完成并接收相同的结果。
-func (g *Group) Do(key string, fn func() (interface{}, error)) (interface{}, error) {
+// 返回值shared表示结果是否被多个调用者共享；设置了 HoldTime 时，原始调用者的shared只反映调用完成时的状态，
+// 窗口内之后到达的调用者仍会得到同一个结果。
+func (g *Group) Do(key string, fn func() (interface{}, error)) (v interface{}, err error, shared bool) {
 	g.mu.Lock()
 	if g.m == nil {
 		g.m = make(map[string]*call) // 如果映射表尚未初始化，则进行初始化
 	}
 	if c, ok := g.m[key]; ok { // 如果在映射表中找到了对应的调用，则释放锁并等待调用完成
+		g.dup(c, key)
+		c.waiters++
 		g.mu.Unlock()
 		c.wg.Wait()
-		return c.val, c.err
+		return c.val, c.err, true
 	}
-	c := new(call)
+	g.calls++
+	c := &call{waiters: 1}
 	c.wg.Add(1)  // 增加等待组计数器，表示有一个调用正在进行中
 	g.m[key] = c // 将新的调用结构体加入到映射表中
 	g.mu.Unlock()
 
-	// 执行给定的函数调用
-	c.val, c.err = fn()
-	c.wg.Done() // 标记调用完成
+	g.doCall(c, key, fn)
+	if e, ok := c.err.(*PanicError); ok { // 原始调用者重新 panic，保持与直接调用 fn 相同的行为
+		panic(e)
+	}
+	return c.val, c.err, c.shared
+}
+
+// DoChan 与 Do 类似，但不会阻塞调用者，而是返回一个通道，结果就绪后会写入该通道。
+// 调用者可以结合自己的超时或取消逻辑对该通道进行 select。
+// 返回的通道带有缓冲，即使调用者不再读取也不会导致执行函数的 goroutine 阻塞。
+func (g *Group) DoChan(key string, fn func() (interface{}, error)) <-chan Result {
+	ch := make(chan Result, 1)
+	g.mu.Lock()
+	if g.m == nil {
+		g.m = make(map[string]*call)
+	}
+	if c, ok := g.m[key]; ok {
+		g.dup(c, key)
+		if c.done { // 结果仍在保留窗口内，直接返回
+			ch <- Result{Val: c.val, Err: c.err, Shared: true}
+			g.mu.Unlock()
+			return ch
+		}
+		c.waiters++
+		c.chans = append(c.chans, ch)
+		g.mu.Unlock()
+		return ch
+	}
+	g.calls++
+	c := &call{chans: []chan<- Result{ch}, waiters: 1}
+	c.wg.Add(1)
+	g.m[key] = c
+	g.mu.Unlock()
+
+	go g.doCall(c, key, fn)
+	return ch
+}
+
+// DoCtx 与 Do 类似，但调用者可以通过ctx提前离开：ctx被取消时立即返回 ctx.Err()，
+// 而fn会继续为其他等待者执行。fn收到的上下文独立于任何一个调用者，
+// 只有当所有等待者都离开后才会被取消，此时该调用也会从 Group 中移除，之后的调用会重新执行。
+func (g *Group) DoCtx(ctx context.Context, key string, fn func(ctx context.Context) (interface{}, error)) (v interface{}, err error, shared bool) {
+	ch := make(chan Result, 1)
+	g.mu.Lock()
+	if g.m == nil {
+		g.m = make(map[string]*call)
+	}
+	c, ok := g.m[key]
+	if ok {
+		g.dup(c, key)
+		if c.done { // 结果仍在保留窗口内，直接返回
+			g.mu.Unlock()
+			return c.val, c.err, true
+		}
+	} else {
+		g.calls++
+		callCtx, cancel := context.WithCancel(context.Background())
+		c = &call{cancel: cancel}
+		c.wg.Add(1)
+		g.m[key] = c
+		go g.doCall(c, key, func() (interface{}, error) {
+			defer cancel()
+			return fn(callCtx)
+		})
+	}
+	c.waiters++
+	c.chans = append(c.chans, ch)
+	g.mu.Unlock()
+
+	select {
+	case res := <-ch:
+		return res.Val, res.Err, res.Shared
+	case <-ctx.Done():
+		g.mu.Lock()
+		c.waiters--
+		if c.waiters == 0 && c.cancel != nil && !c.done { // 最后一个等待者离开，取消执行函数
+			c.cancel()
+			if g.m[key] == c {
+				delete(g.m, key)
+			}
+		}
+		g.mu.Unlock()
+		return nil, ctx.Err(), false
+	}
+}
+
+// dup 记录一次被合并的重复调用，调用时需持有 g.mu
+func (g *Group) dup(c *call, key string) {
+	c.dups++
+	g.dups++
+	if g.TrackedKeys < 0 {
+		return
+	}
+	if g.dupsByKey == nil {
+		n := g.TrackedKeys
+		if n == 0 {
+			n = defaultTrackedKeys
+		}
+		g.dupsByKey = topk.NewSummary(n)
+	}
+	g.dupsByKey.Add(key, 0)
+}
+
+// Stats 返回调用统计的快照
+func (g *Group) Stats() Stats {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	byKey := map[string]int64{}
+	if g.dupsByKey != nil {
+		for _, e := range g.dupsByKey.Entries() {
+			byKey[e.Key] = e.Count
+		}
+	}
+	return Stats{Calls: g.calls, Dups: g.dups, DupsByKey: byKey}
+}
+
+// Counts 返回实际执行fn的次数和被合并的重复调用次数，与 Stats 相同但不复制按key的计数，适合频繁采集
+func (g *Group) Counts() (calls, dups int64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.calls, g.dups
+}
+
+// ResetStats 清空调用统计，例如在每个统计周期结束后调用
+func (g *Group) ResetStats() {
+	g.mu.Lock()
+	g.calls, g.dups, g.dupsByKey = 0, 0, nil
+	g.mu.Unlock()
+}
+
+// doCall 执行给定的函数调用，并将结果通知给所有等待者。
+// 即使 fn panic 或调用了 runtime.Goexit，等待者也会被唤醒并收到相应的错误，而不会永远阻塞。
+func (g *Group) doCall(c *call, key string, fn func() (interface{}, error)) {
+	normalReturn := false
+	recovered := false
+
+	defer func() {
+		// 既没有正常返回也没有 panic，说明 fn 调用了 runtime.Goexit
+		if !normalReturn && !recovered {
+			c.err = ErrGoexit
+		}
+
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		c.done = true
+		c.shared = c.dups > 0
+		c.wg.Done()        // 标记调用完成
+		if g.m[key] == c { // 调用可能已被 Forget，此时映射表中的可能是新的调用
+			if g.HoldTime > 0 && c.err == nil {
+				time.AfterFunc(g.HoldTime, func() { g.release(key, c) }) // 保留窗口结束后再移除
+			} else {
+				delete(g.m, key) // 从映射表中删除该调用
+			}
+		}
+		for _, ch := range c.chans {
+			ch <- Result{Val: c.val, Err: c.err, Shared: c.shared}
+		}
+	}()
+
+	func() {
+		defer func() {
+			if !normalReturn {
+				// recover 只能捕获 panic，Goexit 时返回nil
+				if r := recover(); r != nil {
+					c.err = newPanicError(r)
+				}
+			}
+		}()
 
+		c.val, c.err = fn()
+		normalReturn = true
+	}()
+
+	if !normalReturn {
+		recovered = true
+	}
+}
+
+// release 保留窗口结束后移除已完成的调用
+func (g *Group) release(key string, c *call) {
 	g.mu.Lock()
-	delete(g.m, key) // 从映射表中删除该调用
+	if g.m[key] == c {
+		delete(g.m, key)
+	}
 	g.mu.Unlock()
+}
 
-	return c.val, c.err
+// Forget 让 Group 忘记一个key对应的调用，之后对该key的 Do 调用会重新执行函数，而不是等待之前的调用完成。
+// 通常在显式失效某个key后使用，避免调用者拿到即将过期的结果。
+func (g *Group) Forget(key string) {
+	g.mu.Lock()
+	delete(g.m, key)
+	g.mu.Unlock()
 }
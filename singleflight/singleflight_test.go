@@ -1,12 +1,19 @@
 package singleflight
 
 import (
+	"context"
+	"errors"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestDo(t *testing.T) {
 	var g Group
-	v, err := g.Do("key", func() (interface{}, error) {
+	v, err, _ := g.Do("key", func() (interface{}, error) {
 		return "bar", nil
 	})
 
@@ -14,3 +21,373 @@ func TestDo(t *testing.T) {
 		t.Errorf("Do v = %v, error = %v", v, err)
 	}
 }
+
+func TestDoChan(t *testing.T) {
+	var g Group
+	ch := g.DoChan("key", func() (interface{}, error) {
+		return "bar", nil
+	})
+
+	res := <-ch
+	if res.Val != "bar" || res.Err != nil {
+		t.Errorf("DoChan v = %v, error = %v", res.Val, res.Err)
+	}
+	if res.Shared {
+		t.Errorf("DoChan single caller should not be shared")
+	}
+}
+
+func TestDoChanDupSuppress(t *testing.T) {
+	var g Group
+	release := make(chan struct{})
+	var calls int32
+	fn := func() (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return "bar", nil
+	}
+
+	const n = 10
+	chans := make([]<-chan Result, n)
+	for i := 0; i < n; i++ {
+		chans[i] = g.DoChan("key", fn)
+	}
+	close(release)
+
+	for _, ch := range chans {
+		select {
+		case res := <-ch:
+			if res.Val != "bar" || res.Err != nil || !res.Shared {
+				t.Errorf("DoChan got %+v", res)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("DoChan timed out")
+		}
+	}
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Errorf("number of calls = %d; want 1", got)
+	}
+}
+
+func TestForget(t *testing.T) {
+	var g Group
+	first := make(chan struct{})
+	release := make(chan struct{})
+
+	ch1 := g.DoChan("key", func() (interface{}, error) {
+		close(first)
+		<-release
+		return 1, nil
+	})
+	<-first
+
+	g.Forget("key")
+
+	// Forget 之后的调用应当重新执行函数
+	v, err, _ := g.Do("key", func() (interface{}, error) {
+		return 2, nil
+	})
+	if v != 2 || err != nil {
+		t.Errorf("Do after Forget v = %v, error = %v", v, err)
+	}
+
+	close(release)
+	if res := <-ch1; res.Val != 1 {
+		t.Errorf("forgotten call v = %v, want 1", res.Val)
+	}
+}
+
+func TestPanicDo(t *testing.T) {
+	var g Group
+	started := make(chan struct{})
+	release := make(chan struct{})
+	fn := func() (interface{}, error) {
+		close(started)
+		<-release
+		panic("invalid memory address or nil pointer dereference")
+	}
+
+	waiterErr := make(chan error, 1)
+	go func() {
+		defer func() {
+			r := recover()
+			if _, ok := r.(*PanicError); !ok {
+				t.Errorf("original caller should re-panic with *PanicError, got %v", r)
+			}
+		}()
+		g.Do("key", fn)
+	}()
+	<-started
+
+	go func() {
+		_, err, _ := g.Do("key", func() (interface{}, error) { return nil, nil })
+		waiterErr <- err
+	}()
+	// 等待第二个调用者加入
+	for {
+		g.mu.Lock()
+		dups := g.m["key"].dups
+		g.mu.Unlock()
+		if dups > 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	release <- struct{}{}
+
+	select {
+	case err := <-waiterErr:
+		if _, ok := err.(*PanicError); !ok {
+			t.Errorf("waiter should receive *PanicError, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("waiter blocked after panic")
+	}
+}
+
+func TestGoexitDoChan(t *testing.T) {
+	var g Group
+	ch := g.DoChan("key", func() (interface{}, error) {
+		runtime.Goexit()
+		return nil, nil
+	})
+
+	select {
+	case res := <-ch:
+		if res.Err != ErrGoexit {
+			t.Errorf("expect ErrGoexit, got %v", res.Err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("DoChan blocked after Goexit")
+	}
+
+	// Goexit 之后key应当可以被重新执行
+	v, err, _ := g.Do("key", func() (interface{}, error) { return "bar", nil })
+	if v != "bar" || err != nil {
+		t.Errorf("Do after Goexit v = %v, error = %v", v, err)
+	}
+}
+
+func TestDoCtxWaiterDetach(t *testing.T) {
+	var g Group
+	release := make(chan struct{})
+	fnCanceled := make(chan struct{})
+	fn := func(ctx context.Context) (interface{}, error) {
+		select {
+		case <-release:
+			return "bar", nil
+		case <-ctx.Done():
+			close(fnCanceled)
+			return nil, ctx.Err()
+		}
+	}
+
+	stay := make(chan Result, 1)
+	go func() {
+		v, err, _ := g.DoCtx(context.Background(), "key", fn)
+		stay <- Result{Val: v, Err: err}
+	}()
+	waitForCall(t, &g, "key")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err, _ := g.DoCtx(ctx, "key", fn); err != context.DeadlineExceeded {
+		t.Fatalf("detached waiter expect %v, got %v", context.DeadlineExceeded, err)
+	}
+
+	// 仍有等待者时执行函数不应被取消
+	select {
+	case <-fnCanceled:
+		t.Fatal("fn canceled while another waiter remains")
+	default:
+	}
+	close(release)
+	if res := <-stay; res.Val != "bar" || res.Err != nil {
+		t.Fatalf("remaining waiter got %+v", res)
+	}
+}
+
+func TestDoCtxLastWaiterCancels(t *testing.T) {
+	var g Group
+	fnCanceled := make(chan struct{})
+	fn := func(ctx context.Context) (interface{}, error) {
+		<-ctx.Done()
+		close(fnCanceled)
+		return nil, ctx.Err()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	if _, err, _ := g.DoCtx(ctx, "key", fn); err != context.Canceled {
+		t.Fatalf("expect %v, got %v", context.Canceled, err)
+	}
+
+	select {
+	case <-fnCanceled:
+	case <-time.After(time.Second):
+		t.Fatal("fn not canceled after last waiter left")
+	}
+
+	// 被取消的调用已经移除，新的调用会重新执行
+	v, err, _ := g.DoCtx(context.Background(), "key", func(context.Context) (interface{}, error) {
+		return "bar", nil
+	})
+	if v != "bar" || err != nil {
+		t.Fatalf("DoCtx after cancel v = %v, error = %v", v, err)
+	}
+}
+
+// waitForCall 等待key对应的调用出现在 Group 中
+func waitForCall(t *testing.T, g *Group, key string) {
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		g.mu.Lock()
+		_, ok := g.m[key]
+		g.mu.Unlock()
+		if ok {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("call for %s never started", key)
+}
+
+func TestDoSharedAndStats(t *testing.T) {
+	var g Group
+	release := make(chan struct{})
+	fn := func() (interface{}, error) {
+		<-release
+		return "bar", nil
+	}
+
+	const n = 5
+	var wg sync.WaitGroup
+	shared := make(chan bool, n)
+	go func() {
+		_, _, s := g.Do("key", fn)
+		shared <- s
+	}()
+	waitForCall(t, &g, "key")
+	for i := 1; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _, s := g.Do("key", fn)
+			shared <- s
+		}()
+	}
+	// 等待所有重复调用者加入
+	for g.Stats().Dups < n-1 {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+	for i := 0; i < n; i++ {
+		if !<-shared {
+			t.Fatal("every caller of a deduplicated call should see shared = true")
+		}
+	}
+
+	if _, _, s := g.Do("other", func() (interface{}, error) { return nil, nil }); s {
+		t.Fatal("single caller should see shared = false")
+	}
+
+	st := g.Stats()
+	if st.Calls != 2 || st.Dups != n-1 || st.DupsByKey["key"] != n-1 || len(st.DupsByKey) != 1 {
+		t.Fatalf("unexpected stats %+v", st)
+	}
+	g.ResetStats()
+	if st := g.Stats(); st.Calls != 0 || st.Dups != 0 || len(st.DupsByKey) != 0 {
+		t.Fatalf("stats not reset: %+v", st)
+	}
+}
+
+func TestDupsByKeyBounded(t *testing.T) {
+	g := Group{HoldTime: time.Hour, TrackedKeys: 4}
+	fn := func() (interface{}, error) { return nil, nil }
+	for i := 0; i < 1000; i++ {
+		key := "key-" + strconv.Itoa(i)
+		g.Do(key, fn)
+		g.Do(key, fn) // 保留窗口内的重复调用
+	}
+	for i := 0; i < 100; i++ {
+		g.Do("key-0", fn)
+	}
+	st := g.Stats()
+	if len(st.DupsByKey) != 4 || st.Dups != 1100 {
+		t.Fatalf("unexpected stats: %d keys, %d dups", len(st.DupsByKey), st.Dups)
+	}
+	if st.DupsByKey["key-0"] < 100 {
+		t.Fatalf("the most deduplicated key is missing: %v", st.DupsByKey)
+	}
+
+	g = Group{HoldTime: time.Hour, TrackedKeys: -1}
+	g.Do("key", fn)
+	g.Do("key", fn)
+	if st := g.Stats(); st.Dups != 1 || len(st.DupsByKey) != 0 {
+		t.Fatalf("per-key counting should be disabled: %+v", st)
+	}
+}
+
+func TestHoldTime(t *testing.T) {
+	g := Group{HoldTime: 50 * time.Millisecond}
+	calls := 0
+	fn := func() (interface{}, error) {
+		calls++
+		return calls, nil
+	}
+
+	if v, _, shared := g.Do("key", fn); v != 1 || shared {
+		t.Fatalf("first call v = %v shared = %v", v, shared)
+	}
+	// 保留窗口内复用结果
+	if v, _, shared := g.Do("key", fn); v != 1 || !shared {
+		t.Fatalf("call within hold window v = %v shared = %v", v, shared)
+	}
+	if res := <-g.DoChan("key", fn); res.Val != 1 || !res.Shared {
+		t.Fatalf("DoChan within hold window got %+v", res)
+	}
+	if v, _, _ := g.DoCtx(context.Background(), "key", func(context.Context) (interface{}, error) { return fn() }); v != 1 {
+		t.Fatalf("DoCtx within hold window v = %v", v)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if v, _, _ := g.Do("key", fn); v != 2 {
+		t.Fatalf("call after hold window should re-execute, v = %v", v)
+	}
+
+	// 错误结果不会被保留
+	errCalls := 0
+	errFn := func() (interface{}, error) {
+		errCalls++
+		return nil, errors.New("boom")
+	}
+	g.Do("err", errFn)
+	g.Do("err", errFn)
+	if errCalls != 2 {
+		t.Fatalf("errors should not be held, calls = %d", errCalls)
+	}
+}
+
+// TestHoldTimeConcurrent 原始调用者计算shared时，保留窗口内的调用者同时增加 dups，使用 -race 运行
+func TestHoldTimeConcurrent(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+	g := Group{HoldTime: time.Millisecond}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 2000; j++ {
+				if v, err, _ := g.Do("key", func() (interface{}, error) { return "bar", nil }); v != "bar" || err != nil {
+					t.Errorf("Do = %v, %v", v, err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
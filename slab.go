@@ -0,0 +1,139 @@
+package gocache
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	defaultSlabSize = 1 << 20
+	slabItemRatio   = 64 // 不超过slab大小1/64的数据才放入slab
+)
+
+// slab 是一块连续的内存，多条较小的数据复制到同一块slab中，ByteView 引用其中的一段。
+// refs 是缓存中引用该slab的数据条数，加上分配器正在写入时持有的一个引用，降为0时该slab不再属于任何缓存
+type slab struct {
+	buf   []byte
+	refs  atomic.Int64
+	owner *slabAllocator
+}
+
+// release 释放一个引用
+func (s *slab) release() {
+	if s.refs.Add(-1) == 0 {
+		s.owner.slabs.Add(-1)
+		s.owner.slabBytes.Add(-int64(len(s.buf)))
+	}
+}
+
+// slabAllocator 把写入缓存的小数据复制到较大的slab中，大量小数据时显著减少堆上的对象数量和GC的扫描开销。
+// slab 中的内存不会被复用：一块slab中的所有数据都离开缓存后，分配器不再引用它，由GC在调用者不再持有读取到的
+// ByteView 之后回收。因此读取到的 ByteView 总是安全的，代价是slab中只要还有一条数据在缓存中，整块slab都不会被回收，
+// 见 SlabStats
+type slabAllocator struct {
+	size    int // 每块slab的大小
+	maxItem int // 不超过该大小的数据放入slab
+
+	mu  sync.Mutex
+	cur *slab // 正在写入的slab
+	off int   // cur 中下一条数据的偏移
+
+	slabs     AtomicInt // 仍被缓存引用的slab数量
+	slabBytes AtomicInt // 仍被缓存引用的slab的总字节数
+	liveBytes AtomicInt // 缓存中的数据在slab中占用的字节数
+}
+
+func newSlabAllocator(size int) *slabAllocator {
+	if size <= 0 {
+		size = defaultSlabSize
+	}
+	return &slabAllocator{size: size, maxItem: size / slabItemRatio}
+}
+
+// hold 返回引用slab中内存的数据并增加引用计数，写入缓存之前调用；数据太大或者为空时原样返回。
+// 已经在slab中的数据(例如从主缓存写入热点缓存)只增加引用，不再复制
+func (a *slabAllocator) hold(v ByteView) ByteView {
+	if a == nil {
+		return v
+	}
+	if v.s != nil {
+		v.s.refs.Add(1)
+		v.s.owner.liveBytes.Add(int64(len(v.b)))
+		return v
+	}
+	n := len(v.b)
+	if n == 0 || n > a.maxItem {
+		return v
+	}
+	a.mu.Lock()
+	if a.cur == nil || a.off+n > len(a.cur.buf) {
+		if a.cur != nil {
+			a.cur.release() // 换下一块slab，释放分配器持有的引用
+		}
+		a.cur = &slab{buf: make([]byte, a.size), owner: a}
+		a.cur.refs.Add(1)
+		a.off = 0
+		a.slabs.Add(1)
+		a.slabBytes.Add(int64(a.size))
+	}
+	s := a.cur
+	b := s.buf[a.off : a.off+n : a.off+n] // 限制容量，避免追加写入覆盖相邻的数据
+	a.off += n
+	s.refs.Add(1)
+	a.mu.Unlock()
+
+	copy(b, v.b)
+	a.liveBytes.Add(int64(n))
+	v.b, v.s = b, s
+	return v
+}
+
+// drop 在数据离开缓存(淘汰、删除、过期或者被覆盖)后释放引用
+func (a *slabAllocator) drop(v ByteView) {
+	if a == nil || v.s == nil {
+		return
+	}
+	v.s.owner.liveBytes.Add(-int64(len(v.b)))
+	v.s.release()
+}
+
+// SlabStats slab分配器的统计，见 WithSlabAllocator。SlabBytes 与 LiveBytes 的差是被已经离开缓存的数据占用、
+// 暂时不能回收的内存
+type SlabStats struct {
+	SlabSize  int   `json:"slab_size"`
+	Slabs     int64 `json:"slabs"`      // 仍被缓存引用的slab数量
+	SlabBytes int64 `json:"slab_bytes"` // 仍被缓存引用的slab的总字节数
+	LiveBytes int64 `json:"live_bytes"` // 缓存中的数据在slab中占用的字节数
+}
+
+// WithSlabAllocator 开启slab分配器：写入主缓存和热点缓存的数据中不超过slabSize/64的数据被复制到大小为slabSize的
+// slab中(0表示1MiB)，多条数据共享一次内存分配，适用于大量小数据的缓存组，可以显著减少堆上的对象数量和GC的开销。
+// 一块slab在其中的所有数据都被淘汰之前不会被回收，淘汰顺序与写入顺序差别很大时占用的内存会多于缓存的容量，
+// 见 Group.SlabStats
+func WithSlabAllocator(slabSize int) GroupOption {
+	return func(g *Group) {
+		a := newSlabAllocator(slabSize)
+		g.slabs = a
+		switch c := g.mainCache.(type) {
+		case *LRUcache:
+			c.alloc = a
+		case *LFUcache:
+			c.alloc = a
+		}
+		switch c := g.hotCache.(type) {
+		case *LRUcache:
+			c.alloc = a
+		case *LFUcache:
+			c.alloc = a
+		}
+	}
+}
+
+// SlabStats 返回slab分配器的统计，没有开启 WithSlabAllocator 时返回零值
+func (g *Group) SlabStats() SlabStats {
+	a := g.slabs
+	if a == nil {
+		return SlabStats{}
+	}
+	return SlabStats{SlabSize: a.size, Slabs: a.slabs.Get(), SlabBytes: a.slabBytes.Get(), LiveBytes: a.liveBytes.Get()}
+}
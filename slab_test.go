@@ -0,0 +1,67 @@
+package gocache
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestSlabAllocator(t *testing.T) {
+	g := NewGroup("slab", 4<<10, "lru", GetterFunc(func(key string) ([]byte, error) {
+		return []byte("loaded-" + key), nil
+	}), WithSlabAllocator(1<<10))
+	if c := g.Config(); c.SlabSize != 1<<10 {
+		t.Fatalf("slab size = %d", c.SlabSize)
+	}
+	var views []ByteView
+	for i := 0; i < 100; i++ {
+		g.Set(fmt.Sprintf("key-%02d", i), bytes.Repeat([]byte{byte(i)}, 10), 0)
+		v, err := g.GetCacheData(fmt.Sprintf("key-%02d", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		views = append(views, v)
+	}
+	// 100条10字节的数据只需要1块slab
+	if st := g.SlabStats(); st.Slabs != 1 || st.LiveBytes != 1000 || st.SlabBytes != 1<<10 {
+		t.Fatalf("unexpected stats %+v", st)
+	}
+	// 超过 slabSize/64 的数据单独分配
+	g.Set("large", make([]byte, 100), 0)
+	if st := g.SlabStats(); st.LiveBytes != 1000 {
+		t.Fatalf("large value should not be in a slab: %+v", st)
+	}
+
+	// 覆盖和删除释放旧数据的引用
+	g.Set("key-00", []byte("new"), 0)
+	g.Delete("key-01")
+	if st := g.SlabStats(); st.LiveBytes != 1000-10-10+3 || st.Slabs != 1 {
+		t.Fatalf("unexpected stats after overwrite and delete %+v", st)
+	}
+	// 写满后换下一块slab
+	for i := 0; i < 3; i++ {
+		g.Set(fmt.Sprintf("more-%d", i), make([]byte, 10), 0)
+	}
+	if st := g.SlabStats(); st.Slabs != 2 || st.SlabBytes != 2<<10 {
+		t.Fatalf("unexpected stats after filling a slab %+v", st)
+	}
+	// 全部离开缓存后写满的slab不再被引用，分配器只持有正在写入的slab
+	g.Flush()
+	if st := g.SlabStats(); st.LiveBytes != 0 || st.Slabs != 1 {
+		t.Fatalf("unexpected stats after flush %+v", st)
+	}
+	// 离开缓存后之前读取到的数据不受影响
+	for i, v := range views {
+		if !bytes.Equal(v.ByteSlice(), bytes.Repeat([]byte{byte(i)}, 10)) {
+			t.Fatalf("view %d changed to %v", i, v.ByteSlice())
+		}
+	}
+
+	// 数据源加载的数据同样放入slab
+	if v, err := g.GetCacheData("k"); err != nil || v.String() != "loaded-k" {
+		t.Fatalf("loaded %q %v", v.String(), err)
+	}
+	if v, ok := g.mainCache.peek("k"); !ok || v.s == nil {
+		t.Fatal("loaded value should be in a slab")
+	}
+}
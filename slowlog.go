@@ -0,0 +1,48 @@
+package gocache
+
+import (
+	"math/rand"
+	"time"
+)
+
+// slowLog 慢加载日志的配置，见 WithSlowLog
+type slowLog struct {
+	threshold time.Duration
+	sample    float64 // 输出日志的比例，1表示全部输出
+}
+
+// WithSlowLog 开启慢加载日志：调用数据源(Getter)或者从远程节点读取数据耗时达到threshold时，
+// 通过 WithGroupLogger 设置的 Logger 以Warn级别输出key、耗时、来源、数据大小和错误，用于发现数据源或网络的延迟变化。
+// sample 为输出日志的比例，慢加载很多时用于控制日志量，小于等于0或大于等于1时全部输出；
+// 无论是否输出日志，慢加载都计入 GroupStats.SlowLoads。threshold 小于等于0时不记录。
+func WithSlowLog(threshold time.Duration, sample float64) GroupOption {
+	return func(g *Group) {
+		if threshold <= 0 {
+			g.slow = nil
+			return
+		}
+		if sample <= 0 || sample > 1 {
+			sample = 1
+		}
+		g.slow = &slowLog{threshold: threshold, sample: sample}
+	}
+}
+
+// observeSlow 记录一次数据源调用或远程读取，耗时达到阈值时计数并按采样比例输出日志，peer 为空表示数据源
+func (g *Group) observeSlow(source Source, key, peer string, d time.Duration, size int, err error) {
+	if g.slow == nil || d < g.slow.threshold {
+		return
+	}
+	g.counters.slowLoads.Add(1)
+	if g.slow.sample < 1 && rand.Float64() >= g.slow.sample {
+		return
+	}
+	args := []interface{}{"group", g.name, "key", key, "duration", d, "source", string(source), "size", size}
+	if peer != "" {
+		args = append(args, "peer", peer)
+	}
+	if err != nil {
+		args = append(args, "error", err)
+	}
+	g.logger.Warn("slow load", args...)
+}
@@ -0,0 +1,44 @@
+package gocache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSlowLog(t *testing.T) {
+	logger := &recordLogger{}
+	g := NewGroup("slowlog", 2<<10, "lru", GetterFunc(func(key string) ([]byte, error) {
+		if key == "slow" {
+			time.Sleep(20 * time.Millisecond)
+		}
+		return []byte(key), nil
+	}), WithGroupLogger(logger), WithSlowLog(10*time.Millisecond, 0))
+
+	g.GetCacheData("fast")
+	if logger.has("WARN slow load") || g.Stats().SlowLoads != 0 {
+		t.Fatalf("fast load logged as slow: %v", logger.entries)
+	}
+	g.GetCacheData("slow")
+	if !logger.has("WARN slow load") || g.Stats().SlowLoads != 1 {
+		t.Fatalf("slow load not logged: %v, stats %+v", logger.entries, g.Stats())
+	}
+}
+
+func TestSlowLogSampling(t *testing.T) {
+	logger := &recordLogger{}
+	g := NewGroup("slowlog-sampled", 2<<10, "lru", GetterFunc(func(key string) ([]byte, error) {
+		time.Sleep(time.Millisecond)
+		return []byte(key), nil
+	}), WithGroupLogger(logger), WithSlowLog(time.Nanosecond, 0.000001))
+
+	for _, key := range []string{"a", "b", "c", "d"} {
+		g.GetCacheData(key)
+	}
+	// 所有慢加载都计数，日志只按比例输出
+	if n := g.Stats().SlowLoads; n != 4 {
+		t.Errorf("SlowLoads = %d, want 4", n)
+	}
+	if len(logger.entries) > 1 {
+		t.Errorf("sampled entries = %v", logger.entries)
+	}
+}
@@ -0,0 +1,280 @@
+package gocache
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"time"
+)
+
+// ErrInvalidSnapshot 表示快照的格式错误、被截断或者校验和不匹配
+var ErrInvalidSnapshot = errors.New("gocache: invalid snapshot")
+
+/*
+快照的格式，整数为 uvarint(长度、数量)或 varint(时间戳)：
+
+	"GCSNAP" 版本(1字节)
+	缓存组名的长度 缓存组名 创建时间(unix纳秒)
+	{ 1 key的长度 key value的长度 value 过期时间(unix纳秒，0表示永不过期) } ...
+	0 数据条数 CRC32(IEEE，4字节大端，覆盖之前的所有字节)
+
+数据按热度从低到高排列，恢复时依次写入，最热的数据最后写入，容量不足时先淘汰较冷的数据。
+*/
+const (
+	snapshotMagic   = "GCSNAP"
+	snapshotVersion = 1
+)
+
+// SnapshotInfo 快照的头部信息
+type SnapshotInfo struct {
+	Group   string
+	Created time.Time
+}
+
+// Snapshot 把主缓存中没有过期的数据连同过期时间写入w，返回写入的条数。写入的是经过变换链之后的数据，
+// 恢复的缓存组应当使用相同的变换链(见 WithTransforms)。热点缓存中的副本不会写入。
+// 快照期间写入的数据可能包含也可能不包含在快照中。
+func (g *Group) Snapshot(w io.Writer) (int, error) {
+	sw := newSnapshotWriter(w)
+	sw.header(SnapshotInfo{Group: g.name, Created: time.Now()})
+	keys := g.mainCache.keys()
+	n := 0
+	for i := len(keys) - 1; i >= 0; i-- { // keys 按热度从高到低排列
+		v, ok := g.mainCache.peek(keys[i])
+		if !ok { // 已经过期或者被删除
+			continue
+		}
+		sw.entry(keys[i], v)
+		n++
+		if sw.err != nil {
+			return n, sw.err
+		}
+	}
+	return n, sw.close(n)
+}
+
+// Restore 从r读取 Snapshot 写入的快照，把其中没有过期的数据写入主缓存，返回写入的条数。
+// 快照会先完整读取并校验，缓存组名不同或者快照无效时不写入任何数据，返回的错误包装了 ErrInvalidSnapshot。
+// 已经在缓存中的key保留缓存中的数据，快照中的数据比它更旧。
+func (g *Group) Restore(r io.Reader) (int, error) {
+	info, entries, err := readSnapshot(r)
+	if err != nil {
+		return 0, err
+	}
+	if info.Group != g.name {
+		return 0, fmt.Errorf("%w: snapshot of group %s, not %s", ErrInvalidSnapshot, info.Group, g.name)
+	}
+	now := time.Now()
+	n := 0
+	for _, e := range entries {
+		if !e.value.e.IsZero() && !e.value.e.After(now) {
+			continue
+		}
+		if _, ok := g.mainCache.peek(e.key); ok {
+			continue
+		}
+		g.mainCache.add(e.key, e.value)
+		g.budget.enforce()
+		n++
+	}
+	g.logger.Info("snapshot restored", "group", g.name, "entries", n, "created", info.Created)
+	return n, nil
+}
+
+// ReadSnapshotInfo 读取并校验整个快照，返回其头部信息，不写入任何缓存组
+func ReadSnapshotInfo(r io.Reader) (SnapshotInfo, error) {
+	info, _, err := readSnapshot(r)
+	return info, err
+}
+
+type snapshotEntry struct {
+	key   string
+	value ByteView
+}
+
+// snapshotWriter 写入快照并计算校验和，第一个错误保存在err中，之后的写入被忽略
+type snapshotWriter struct {
+	w   *bufio.Writer
+	crc hash.Hash32
+	buf [binary.MaxVarintLen64]byte
+	err error
+}
+
+func newSnapshotWriter(w io.Writer) *snapshotWriter {
+	crc := crc32.NewIEEE()
+	return &snapshotWriter{w: bufio.NewWriter(io.MultiWriter(w, crc)), crc: crc}
+}
+
+func (sw *snapshotWriter) write(b []byte) {
+	if sw.err == nil {
+		_, sw.err = sw.w.Write(b)
+	}
+}
+
+func (sw *snapshotWriter) uvarint(n uint64) {
+	sw.write(sw.buf[:binary.PutUvarint(sw.buf[:], n)])
+}
+
+func (sw *snapshotWriter) varint(n int64) {
+	sw.write(sw.buf[:binary.PutVarint(sw.buf[:], n)])
+}
+
+func (sw *snapshotWriter) bytes(b []byte) {
+	sw.uvarint(uint64(len(b)))
+	sw.write(b)
+}
+
+func (sw *snapshotWriter) header(info SnapshotInfo) {
+	sw.write(append([]byte(snapshotMagic), snapshotVersion))
+	sw.bytes([]byte(info.Group))
+	sw.varint(info.Created.UnixNano())
+}
+
+func (sw *snapshotWriter) entry(key string, v ByteView) {
+	sw.write([]byte{1})
+	sw.bytes([]byte(key))
+	sw.bytes(v.b)
+	var expire int64
+	if !v.e.IsZero() {
+		expire = v.e.UnixNano()
+	}
+	sw.varint(expire)
+}
+
+// close 写入结尾和校验和
+func (sw *snapshotWriter) close(n int) error {
+	sw.write([]byte{0})
+	sw.uvarint(uint64(n))
+	if sw.err == nil {
+		sw.err = sw.w.Flush()
+	}
+	if sw.err != nil {
+		return sw.err
+	}
+	var sum [4]byte
+	binary.BigEndian.PutUint32(sum[:], sw.crc.Sum32())
+	sw.write(sum[:]) // 校验和本身不计入校验和，但经过同一个 bufio.Writer 写出
+	if sw.err == nil {
+		sw.err = sw.w.Flush()
+	}
+	return sw.err
+}
+
+// snapshotReader 读取快照并计算校验和
+type snapshotReader struct {
+	r   *bufio.Reader
+	crc hash.Hash32
+}
+
+func (sr *snapshotReader) ReadByte() (byte, error) {
+	b, err := sr.r.ReadByte()
+	if err == nil {
+		sr.crc.Write([]byte{b})
+	}
+	return b, err
+}
+
+func (sr *snapshotReader) full(b []byte) error {
+	if _, err := io.ReadFull(sr.r, b); err != nil {
+		return err
+	}
+	sr.crc.Write(b)
+	return nil
+}
+
+func (sr *snapshotReader) bytes(max int) ([]byte, error) {
+	n, err := binary.ReadUvarint(sr)
+	if err != nil {
+		return nil, err
+	}
+	if n > uint64(max) {
+		return nil, fmt.Errorf("length %d exceeds %d", n, max)
+	}
+	b := make([]byte, n)
+	return b, sr.full(b)
+}
+
+// maxSnapshotField 单个key或value的最大长度，用于拒绝损坏的长度字段
+const maxSnapshotField = 1 << 30
+
+// readSnapshot 读取并校验整个快照
+func readSnapshot(r io.Reader) (info SnapshotInfo, entries []snapshotEntry, err error) {
+	defer func() {
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			err = fmt.Errorf("%w: %v", ErrInvalidSnapshot, err)
+		}
+	}()
+	sr := &snapshotReader{r: bufio.NewReader(r), crc: crc32.NewIEEE()}
+	head := make([]byte, len(snapshotMagic)+1)
+	if err := sr.full(head); err != nil {
+		return info, nil, err
+	}
+	if string(head[:len(snapshotMagic)]) != snapshotMagic {
+		return info, nil, fmt.Errorf("bad magic")
+	}
+	if head[len(snapshotMagic)] != snapshotVersion {
+		return info, nil, fmt.Errorf("unsupported version %d", head[len(snapshotMagic)])
+	}
+	group, err := sr.bytes(maxSnapshotField)
+	if err != nil {
+		return info, nil, err
+	}
+	created, err := binary.ReadVarint(sr)
+	if err != nil {
+		return info, nil, err
+	}
+	info = SnapshotInfo{Group: string(group), Created: time.Unix(0, created)}
+
+	for {
+		tag, err := sr.ReadByte()
+		if err != nil {
+			return info, nil, err
+		}
+		if tag == 0 {
+			break
+		}
+		if tag != 1 {
+			return info, nil, fmt.Errorf("unknown record type %d", tag)
+		}
+		key, err := sr.bytes(maxSnapshotField)
+		if err != nil {
+			return info, nil, err
+		}
+		value, err := sr.bytes(maxSnapshotField)
+		if err != nil {
+			return info, nil, err
+		}
+		expire, err := binary.ReadVarint(sr)
+		if err != nil {
+			return info, nil, err
+		}
+		e := snapshotEntry{key: string(key), value: ByteView{b: value}}
+		if expire != 0 {
+			e.value.e = time.Unix(0, expire)
+		}
+		entries = append(entries, e)
+	}
+	count, err := binary.ReadUvarint(sr)
+	if err != nil {
+		return info, nil, err
+	}
+	if count != uint64(len(entries)) {
+		return info, nil, fmt.Errorf("expect %d entries, got %d", count, len(entries))
+	}
+	want := sr.crc.Sum32()
+	var sum [4]byte
+	if _, err := io.ReadFull(sr.r, sum[:]); err != nil {
+		return info, nil, err
+	}
+	if binary.BigEndian.Uint32(sum[:]) != want {
+		return info, nil, fmt.Errorf("checksum mismatch")
+	}
+	return info, entries, nil
+}
@@ -0,0 +1,163 @@
+package gocache
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSnapshotRestore(t *testing.T) {
+	src := NewGroup("snapshot", 2<<10, "lru", GetterFunc(func(key string) ([]byte, error) {
+		return nil, ErrNotFound
+	}))
+	src.Set("forever", []byte("v1"), 0)
+	src.Set("ttl", []byte("v2"), time.Hour)
+	src.Set("expiring", []byte("v3"), 20*time.Millisecond)
+	for i := 0; i < 5; i++ {
+		src.Set(fmt.Sprint(i), []byte{byte(i)}, 0)
+	}
+	src.GetCacheData("forever") // 最热的key
+
+	var buf bytes.Buffer
+	n, err := src.Snapshot(&buf)
+	if err != nil || n != 8 {
+		t.Fatalf("snapshot wrote %d entries: %v", n, err)
+	}
+	snapshot := buf.Bytes()
+	if info, err := ReadSnapshotInfo(bytes.NewReader(snapshot)); err != nil || info.Group != "snapshot" {
+		t.Fatalf("info %+v %v", info, err)
+	}
+
+	// 恢复到重启后的同名缓存组，过期的数据被跳过
+	time.Sleep(30 * time.Millisecond)
+	src.Flush()
+	if n, err := src.Restore(bytes.NewReader(snapshot)); err != nil || n != 7 {
+		t.Fatalf("restored %d entries: %v", n, err)
+	}
+	if v, err := src.GetCacheData("forever"); err != nil || v.String() != "v1" || !v.Expire().IsZero() {
+		t.Fatalf("forever = %q %v %v", v, v.Expire(), err)
+	}
+	if v, _ := src.GetCacheData("ttl"); v.Expire().Before(time.Now().Add(59 * time.Minute)) {
+		t.Fatalf("expiry not restored: %v", v.Expire())
+	}
+	if _, ok := src.Inspect("expiring"); ok {
+		t.Fatal("expired entry should not be restored")
+	}
+	// 容量不足时先淘汰较冷的数据
+	src.Resize(int64(len("forever") + 2))
+	src.Flush()
+	src.Restore(bytes.NewReader(snapshot))
+	if _, ok := src.Inspect("forever"); !ok {
+		t.Fatal("the hottest entry should survive a restore into a smaller cache")
+	}
+}
+
+func TestRestoreInvalidSnapshot(t *testing.T) {
+	g := NewGroup("snapshot-invalid", 2<<10, "lru", GetterFunc(func(key string) ([]byte, error) {
+		return nil, ErrNotFound
+	}))
+	g.Set("k", []byte("v"), 0)
+	var buf bytes.Buffer
+	g.Snapshot(&buf)
+	good := buf.Bytes()
+
+	other := NewGroup("snapshot-other", 2<<10, "lru", GetterFunc(func(key string) ([]byte, error) {
+		return nil, ErrNotFound
+	}))
+	corrupt := append([]byte(nil), good...)
+	corrupt[len(corrupt)-6] ^= 0xff
+	for name, tc := range map[string]struct {
+		g    *Group
+		data []byte
+	}{
+		"empty":     {g, nil},
+		"magic":     {g, []byte("not a snapshot")},
+		"truncated": {g, good[:len(good)-1]},
+		"corrupt":   {g, corrupt},
+		"group":     {other, good},
+	} {
+		g.Flush()
+		if n, err := tc.g.Restore(bytes.NewReader(tc.data)); !errors.Is(err, ErrInvalidSnapshot) || n != 0 {
+			t.Errorf("%s: restored %d, err %v", name, n, err)
+		}
+		if _, ok := g.Inspect("k"); ok {
+			t.Errorf("%s: invalid snapshot should not be applied", name)
+		}
+	}
+}
+
+func TestSnapshotter(t *testing.T) {
+	g := NewGroup("snapshotter", 2<<10, "lru", GetterFunc(func(key string) ([]byte, error) {
+		return nil, ErrNotFound
+	}))
+	dir := t.TempDir()
+	store, err := NewDirStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	svr, _ := NewServer("127.0.0.1:9421", WithSnapshots(store, 0, 2, "snapshotter"))
+	ctx := context.Background()
+	for i := 0; i < 4; i++ {
+		g.Set("k", []byte(fmt.Sprint("v", i)), 0)
+		if err := svr.SaveSnapshots(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	names, _ := svr.snapshots.list(ctx, "snapshotter")
+	if len(names) != 2 {
+		t.Fatalf("expect 2 snapshots to be retained, got %v", names)
+	}
+	// 最新的快照损坏时从上一个有效的快照恢复
+	broken := snapshotPrefix("snapshotter") + time.Now().Add(time.Hour).UTC().Format(snapshotTimeLayout) + snapshotSuffix
+	os.WriteFile(filepath.Join(dir, broken), []byte("broken"), 0o600)
+
+	g.Flush()
+	svr, _ = NewServer("127.0.0.1:9421", WithSnapshots(store, 0, 2, "snapshotter"), WithWarmGate(1, 0))
+	svr.prepare(ctx)
+	if !svr.warm.wait(make(chan error), svr.logger) {
+		t.Fatal("warm gate should open after restore")
+	}
+	if v, err := g.GetCacheData("k"); err != nil || v.String() != "v3" {
+		t.Fatalf("k = %q %v", v, err)
+	}
+	plain, _ := NewServer("127.0.0.1:9422")
+	if err := plain.SaveSnapshots(ctx); err == nil {
+		t.Fatal("expect error when snapshots are not enabled")
+	}
+}
+
+func TestSnapshotOnStop(t *testing.T) {
+	g := NewGroup("snapshot-stop", 2<<10, "lru", GetterFunc(func(key string) ([]byte, error) {
+		return nil, ErrNotFound
+	}))
+	store, _ := NewDirStore(t.TempDir())
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := lis.Addr().String()
+	lis.Close()
+	svr, _ := NewServer(addr, WithStaticPeers(addr), WithSnapshots(store, 0, 1, "snapshot-stop"))
+	go svr.Start()
+	client := directClient(addr)
+	defer client.Close()
+	for deadline := time.Now().Add(2 * time.Second); client.checkHealth(context.Background(), time.Second) != nil; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("server did not start")
+		}
+	}
+	g.Set("k", []byte("v"), 0)
+	if err := svr.GracefulStop(time.Second); err != nil {
+		t.Fatal(err)
+	}
+	names, _ := svr.snapshots.list(context.Background(), "snapshot-stop")
+	if len(names) != 1 {
+		t.Fatalf("expect a snapshot on stop, got %v", names)
+	}
+}
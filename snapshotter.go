@@ -0,0 +1,302 @@
+package gocache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SnapshotStore 保存快照文件的存储，例如本地目录(见 NewDirStore)或者S3兼容的对象存储(见 gocache/s3store)。
+// 多个节点不能共用同一个存储位置，否则会恢复其他节点的数据
+type SnapshotStore interface {
+	// Put 保存名为name的快照，r 读取完毕且没有出错时快照才应当可见
+	Put(ctx context.Context, name string, r io.Reader) error
+	// Open 打开名为name的快照，不存在时返回的错误满足 errors.Is(err, fs.ErrNotExist)
+	Open(ctx context.Context, name string) (io.ReadCloser, error)
+	// List 返回以prefix开头的所有快照的名字，顺序不限
+	List(ctx context.Context, prefix string) ([]string, error)
+	// Delete 删除名为name的快照，不存在时不返回错误
+	Delete(ctx context.Context, name string) error
+}
+
+const (
+	snapshotSuffix     = ".snapshot"
+	snapshotTimeLayout = "20060102T150405.000000000Z" // 按字典序排列即按时间排列
+	defaultRetain      = 3
+)
+
+// snapshotter 定期把缓存组的快照保存到 SnapshotStore，启动时从最新的有效快照恢复
+type snapshotter struct {
+	store    SnapshotStore
+	interval time.Duration
+	retain   int
+	groups   []string // 为空表示所有缓存组
+
+	mu       sync.Mutex // 串行化保存，避免同时写出同一个缓存组的多个快照
+	restored bool       // 只在第一次启动时恢复，停止后重新启动时缓存中的数据比快照更新
+}
+
+// WithSnapshots 开启快照：启动时每个缓存组从store中最新的有效快照恢复(在预热闸门和启动预热之前)，运行期间每隔interval
+// 保存一次快照，停止时(Stop 或 GracefulStop 注销之后)再保存一次，每个缓存组保留最新的retain个快照。
+// interval 为0表示只在停止时保存，retain 为0时保留3个。groups 为空表示所有缓存组。
+// Stop 在没有排空窗口(见 WithDrainWindow)时不等待停止时的快照完成，计划内的重启应当使用 GracefulStop。
+func WithSnapshots(store SnapshotStore, interval time.Duration, retain int, groups ...string) ServerOption {
+	return func(s *Server) {
+		if store == nil {
+			s.snapshots = nil
+			return
+		}
+		if retain <= 0 {
+			retain = defaultRetain
+		}
+		s.snapshots = &snapshotter{store: store, interval: interval, retain: retain, groups: groups}
+	}
+}
+
+// SaveSnapshots 立即保存 WithSnapshots 指定的所有缓存组的快照并清理旧的快照，没有开启快照时返回错误
+func (s *Server) SaveSnapshots(ctx context.Context) error {
+	if s.snapshots == nil {
+		return fmt.Errorf("snapshots are not enabled")
+	}
+	return s.snapshots.save(ctx, s.logger)
+}
+
+// startSnapshots 在后台定期保存快照，返回的通道在ctx被取消、定期保存结束后关闭，没有开启快照时返回nil
+func (s *Server) startSnapshots(ctx context.Context) <-chan struct{} {
+	if s.snapshots == nil {
+		return nil
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.snapshots.run(ctx, s.logger)
+	}()
+	return done
+}
+
+// saveFinalSnapshots 等待定期保存结束后保存停止时的快照
+func (s *Server) saveFinalSnapshots(done <-chan struct{}) {
+	if s.snapshots == nil {
+		return
+	}
+	<-done
+	if err := s.snapshots.save(context.Background(), s.logger); err != nil {
+		s.reportErr(err)
+	}
+}
+
+// targets 返回需要保存和恢复快照的缓存组，不存在的缓存组被忽略
+func (sn *snapshotter) targets() []*Group {
+	if len(sn.groups) == 0 {
+		return Groups()
+	}
+	var list []*Group
+	for _, name := range sn.groups {
+		if g := GetGroup(name); g != nil {
+			list = append(list, g)
+		}
+	}
+	return list
+}
+
+// run 每隔interval保存一次快照，直到ctx被取消
+func (sn *snapshotter) run(ctx context.Context, logger Logger) {
+	if sn.interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(sn.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := sn.save(ctx, logger); err != nil && ctx.Err() == nil {
+				logger.Warn("periodic snapshot failed", "error", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// save 保存所有缓存组的快照，单个缓存组失败不影响其他缓存组，返回所有的错误
+func (sn *snapshotter) save(ctx context.Context, logger Logger) error {
+	sn.mu.Lock()
+	defer sn.mu.Unlock()
+	var errs []error
+	for _, g := range sn.targets() {
+		start := time.Now()
+		name := snapshotPrefix(g.name) + start.UTC().Format(snapshotTimeLayout) + snapshotSuffix
+		n, err := sn.saveGroup(ctx, g, name)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("snapshot %s: %w", g.name, err))
+			continue
+		}
+		logger.Info("snapshot saved", "group", g.name, "name", name, "entries", n, "elapsed", time.Since(start))
+		if err := sn.prune(ctx, g.name); err != nil {
+			errs = append(errs, fmt.Errorf("prune snapshots of %s: %w", g.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// saveGroup 把缓存组的快照通过管道写入存储
+func (sn *snapshotter) saveGroup(ctx context.Context, g *Group, name string) (int, error) {
+	pr, pw := io.Pipe()
+	written := make(chan int, 1)
+	go func() {
+		n, err := g.Snapshot(pw)
+		pw.CloseWithError(err)
+		written <- n
+	}()
+	err := sn.store.Put(ctx, name, pr)
+	pr.CloseWithError(err) // 存储提前返回时让 Snapshot 停止写入
+	return <-written, err
+}
+
+// prune 删除缓存组较旧的快照，只保留最新的retain个
+func (sn *snapshotter) prune(ctx context.Context, group string) error {
+	names, err := sn.list(ctx, group)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, name := range names[min(len(names), sn.retain):] {
+		if err := sn.store.Delete(ctx, name); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// list 返回缓存组的所有快照，从新到旧排列
+func (sn *snapshotter) list(ctx context.Context, group string) ([]string, error) {
+	prefix := snapshotPrefix(group)
+	all, err := sn.store.List(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, name := range all {
+		ts, ok := strings.CutSuffix(strings.TrimPrefix(name, prefix), snapshotSuffix)
+		if !strings.HasPrefix(name, prefix) || !ok {
+			continue
+		}
+		if _, err := time.Parse(snapshotTimeLayout, ts); err != nil { // 名字以另一个缓存组的名字开头，例如 a 和 a.b
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(names)))
+	return names, nil
+}
+
+// restore 每个缓存组从最新的有效快照恢复，无效或者读取失败的快照被跳过。只在第一次调用时执行
+func (sn *snapshotter) restore(ctx context.Context, logger Logger) {
+	sn.mu.Lock()
+	defer sn.mu.Unlock()
+	if sn.restored {
+		return
+	}
+	sn.restored = true
+	for _, g := range sn.targets() {
+		names, err := sn.list(ctx, g.name)
+		if err != nil {
+			logger.Warn("list snapshots failed", "group", g.name, "error", err)
+			continue
+		}
+		for _, name := range names {
+			n, err := sn.restoreGroup(ctx, g, name)
+			if err == nil {
+				logger.Info("restored from snapshot", "group", g.name, "name", name, "entries", n)
+				break
+			}
+			logger.Warn("skip snapshot", "group", g.name, "name", name, "error", err)
+		}
+	}
+}
+
+func (sn *snapshotter) restoreGroup(ctx context.Context, g *Group, name string) (int, error) {
+	rc, err := sn.store.Open(ctx, name)
+	if err != nil {
+		return 0, err
+	}
+	defer rc.Close()
+	return g.Restore(rc)
+}
+
+// snapshotPrefix 返回缓存组快照名字的前缀，缓存组名中的路径分隔符等字符被替换
+func snapshotPrefix(group string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '/', '\\', ':', '*', '?', '"', '<', '>', '|':
+			return '_'
+		}
+		return r
+	}, group) + "."
+}
+
+// dirStore 把快照保存在本地目录中，写入临时文件后重命名，保存到一半的快照不可见
+type dirStore struct {
+	dir string
+}
+
+// NewDirStore 返回保存在目录dir中的 SnapshotStore，目录不存在时创建
+func NewDirStore(dir string) (SnapshotStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &dirStore{dir: dir}, nil
+}
+
+func (d *dirStore) Put(ctx context.Context, name string, r io.Reader) error {
+	f, err := os.CreateTemp(d.dir, "."+name+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name()) // 重命名成功后删除不存在的文件，忽略错误
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), filepath.Join(d.dir, name))
+}
+
+func (d *dirStore) Open(ctx context.Context, name string) (io.ReadCloser, error) {
+	return os.Open(filepath.Join(d.dir, name))
+}
+
+func (d *dirStore) List(ctx context.Context, prefix string) ([]string, error) {
+	entries, err := os.ReadDir(d.dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		if e.Type().IsRegular() && strings.HasPrefix(e.Name(), prefix) {
+			names = append(names, e.Name())
+		}
+	}
+	return names, nil
+}
+
+func (d *dirStore) Delete(ctx context.Context, name string) error {
+	err := os.Remove(filepath.Join(d.dir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,123 @@
+package gocache
+
+import (
+	"context"
+	pb "gocache/gocachepb"
+	"sort"
+)
+
+// groupCounters 缓存组的累计计数，从创建缓存组开始统计
+type groupCounters struct {
+	hotHits    AtomicInt // 热点缓存命中次数
+	hits       AtomicInt // 主缓存命中次数
+	misses     AtomicInt // 两级缓存都未命中的次数
+	peerLoads  AtomicInt // 未命中后从远程节点取得数据的次数
+	localLoads AtomicInt // 未命中后从本地数据源加载成功的次数
+	loadErrors AtomicInt // 未命中后加载失败的次数
+	hedged     AtomicInt // 发出的对冲请求数
+	hedgeWins  AtomicInt // 对冲请求先于归属节点返回的次数
+	evictions  AtomicInt // 主缓存中被淘汰或删除的数据条数
+	slowLoads  AtomicInt // 耗时达到慢加载阈值的数据源调用和远程读取次数
+
+	expirations AtomicInt    // 主缓存中过期后被移除的数据条数
+	hitAge      ageHistogram // 命中时数据的年龄
+	evictionAge ageHistogram // 主缓存因容量不足淘汰数据时数据的年龄
+
+	fallbackReplica AtomicInt // 归属节点读取失败后由副本节点返回结果的次数
+	fallbackLocal   AtomicInt // 归属节点读取失败后从本地数据源加载的次数
+	fallbackErrors  AtomicInt // 归属节点读取失败后没有可用的回退方式、返回错误的次数
+}
+
+// GroupStats 缓存组的统计信息，计数为创建缓存组以来的累计值，字节数为当前值
+type GroupStats struct {
+	Name       string `json:"name"`
+	HotHits    int64  `json:"hot_hits"`
+	Hits       int64  `json:"hits"`
+	Misses     int64  `json:"misses"`
+	PeerLoads  int64  `json:"peer_loads"`
+	LocalLoads int64  `json:"local_loads"`
+	LoadErrors int64  `json:"load_errors"`
+	Hedged     int64  `json:"hedged"`     // 发出的对冲请求数，见 WithHedging
+	HedgeWins  int64  `json:"hedge_wins"` // 对冲请求先返回的次数
+	Evictions  int64  `json:"evictions"`  // 主缓存中被淘汰或删除的数据条数
+	LoadCalls  int64  `json:"load_calls"` // 合并之后实际执行的加载次数
+	Coalesced  int64  `json:"coalesced"`  // 与同时进行的相同加载合并、没有单独执行的次数
+	SlowLoads  int64  `json:"slow_loads"` // 耗时达到阈值的数据源调用和远程读取次数，见 WithSlowLog
+
+	// 归属节点读取失败后的处理结果，见 WithFallback
+	FallbackReplica int64 `json:"fallback_replica"`
+	FallbackLocal   int64 `json:"fallback_local"`
+	FallbackErrors  int64 `json:"fallback_errors"`
+	Bytes           int64 `json:"bytes"`        // 主缓存占用的字节数
+	HotBytes        int64 `json:"hot_bytes"`    // 热点缓存占用的字节数
+	Capacity        int64 `json:"capacity"`     // 主缓存的容量上限
+	MemoryBytes     int64 `json:"memory_bytes"` // 主缓存和热点缓存实际占用内存的估计，见 Group.MemoryUsage
+
+	// 数据的年龄(距离写入缓存的时间)，用于判断容量和过期时间哪一个是命中率的瓶颈：
+	// EvictionAge 明显短于过期时间说明容量不足，数据没有过期就被淘汰；Expirations 占多数且 HitAge 集中在过期时间附近
+	// 说明过期时间过短，HitAge 中年龄超过某个值的比例近似于把过期时间设置为该值后损失的命中
+	Expirations int64     `json:"expirations"`  // 主缓存中过期后被移除的数据条数
+	HitAge      Histogram `json:"hit_age"`      // 命中(主缓存和热点缓存)时数据的年龄
+	EvictionAge Histogram `json:"eviction_age"` // 主缓存因容量不足淘汰数据时数据的年龄，不包括过期和显式删除
+}
+
+// Stats 返回缓存组的统计信息
+func (g *Group) Stats() GroupStats {
+	calls, dups := g.loader.Counts()
+	return GroupStats{
+		Name:       g.name,
+		HotHits:    g.counters.hotHits.Get(),
+		Hits:       g.counters.hits.Get(),
+		Misses:     g.counters.misses.Get(),
+		PeerLoads:  g.counters.peerLoads.Get(),
+		LocalLoads: g.counters.localLoads.Get(),
+		LoadErrors: g.counters.loadErrors.Get(),
+		Hedged:     g.counters.hedged.Get(),
+		HedgeWins:  g.counters.hedgeWins.Get(),
+		Evictions:  g.counters.evictions.Get(),
+		LoadCalls:  calls,
+		Coalesced:  dups,
+		SlowLoads:  g.counters.slowLoads.Get(),
+
+		FallbackReplica: g.counters.fallbackReplica.Get(),
+		FallbackLocal:   g.counters.fallbackLocal.Get(),
+		FallbackErrors:  g.counters.fallbackErrors.Get(),
+		Bytes:           g.mainCache.bytes(),
+		HotBytes:        g.hotCache.bytes(),
+		Capacity:        g.mainCache.capacity(),
+		MemoryBytes:     g.MemoryUsage().Total,
+		Expirations:     g.counters.expirations.Get(),
+		HitAge:          g.counters.hitAge.snapshot(),
+		EvictionAge:     g.counters.evictionAge.snapshot(),
+	}
+}
+
+// Stats 实现了 Stats RPC，返回本节点各缓存组的统计信息，请求中的 group 为空表示所有缓存组
+func (s *Server) Stats(ctx context.Context, in *pb.StatsRequest) (*pb.StatsResponse, error) {
+	var groups []*Group
+	if in.Group == "" {
+		groups = allGroups()
+	} else if g := GetGroup(in.Group); g != nil {
+		groups = []*Group{g}
+	} else {
+		return nil, groupNotFound(in.Group)
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].name < groups[j].name })
+	resp := &pb.StatsResponse{}
+	for _, g := range groups {
+		st := g.Stats()
+		resp.Groups = append(resp.Groups, &pb.GroupStats{
+			Name:       st.Name,
+			HotHits:    st.HotHits,
+			Hits:       st.Hits,
+			Misses:     st.Misses,
+			PeerLoads:  st.PeerLoads,
+			LocalLoads: st.LocalLoads,
+			LoadErrors: st.LoadErrors,
+			Bytes:      st.Bytes,
+			HotBytes:   st.HotBytes,
+			Capacity:   st.Capacity,
+		})
+	}
+	return resp, nil
+}
@@ -0,0 +1,56 @@
+package gocache
+
+import (
+	"context"
+	"fmt"
+	pb "gocache/gocachepb"
+	"testing"
+
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func TestStats(t *testing.T) {
+	g := NewGroup("stats", 2<<10, "lru", GetterFunc(func(key string) ([]byte, error) {
+		if key == "bad" {
+			return nil, fmt.Errorf("not found")
+		}
+		return []byte(key), nil
+	}))
+	for _, key := range []string{"a", "a", "b", "bad"} {
+		g.GetCacheData(key)
+	}
+	st := g.Stats()
+	if st.Misses != 3 || st.LocalLoads != 2 || st.LoadErrors != 1 || st.Hits+st.HotHits != 1 || st.PeerLoads != 0 {
+		t.Fatalf("unexpected stats %+v", st)
+	}
+	if st.Bytes == 0 || st.Capacity != 2<<10 {
+		t.Fatalf("unexpected memory stats %+v", st)
+	}
+
+	svr, _ := NewServer("127.0.0.1:9801")
+	resp, err := svr.Stats(context.Background(), &pb.StatsRequest{Group: "stats"})
+	if err != nil || len(resp.Groups) != 1 || resp.Groups[0].Misses != 3 {
+		t.Fatalf("unexpected response %v %v", resp, err)
+	}
+	if _, err := svr.Stats(context.Background(), &pb.StatsRequest{Group: "missing"}); err == nil {
+		t.Fatal("expect error for unknown group")
+	}
+}
+
+func TestHealth(t *testing.T) {
+	svr, _ := NewServer("127.0.0.1:9802")
+	check := func() healthpb.HealthCheckResponse_ServingStatus {
+		res, err := svr.health.Check(context.Background(), &healthpb.HealthCheckRequest{Service: groupCacheService})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res.Status
+	}
+	if st := check(); st != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Fatalf("server not started should not be serving, got %v", st)
+	}
+	svr.setServing(true)
+	if st := check(); st != healthpb.HealthCheckResponse_SERVING {
+		t.Fatalf("expect serving, got %v", st)
+	}
+}
@@ -0,0 +1,67 @@
+package gocache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// errKeyRequired 请求中没有key
+var errKeyRequired = status.Error(codes.InvalidArgument, "key required")
+
+// groupNotFound 返回本节点没有该缓存组的错误
+func groupNotFound(name string) error {
+	return status.Errorf(codes.NotFound, "group %q not found", name)
+}
+
+// statusError 将处理请求时产生的错误转换为带状态码的gRPC错误，使请求方能够区分key不存在、请求错误和节点故障：
+//   - ErrNotFound：codes.NotFound
+//   - 超过截止时间、被取消：codes.DeadlineExceeded、codes.Canceled
+//   - 加载被限流：codes.Unavailable，请求方可以稍后重试
+//   - 其他错误(例如数据源故障)：codes.Internal
+//
+// 已经带有状态码的错误保持不变。
+func statusError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	code := codes.Internal
+	switch {
+	case errors.Is(err, ErrNotFound):
+		code = codes.NotFound
+	case errors.Is(err, context.DeadlineExceeded):
+		code = codes.DeadlineExceeded
+	case errors.Is(err, context.Canceled):
+		code = codes.Canceled
+	case errors.Is(err, ErrTooManyLoads), errors.Is(err, ErrLoadQueueFull):
+		code = codes.Unavailable
+	case errors.Is(err, ErrLeaseInvalid), errors.Is(err, ErrLeaseDisabled):
+		code = codes.FailedPrecondition
+	}
+	return status.Error(code, err.Error())
+}
+
+// fromStatus 将远程节点返回的状态错误还原为本地的错误，key不存在时返回包装了 ErrNotFound 的错误，
+// 缓存组不存在等其他 codes.NotFound 错误保持不变；租约的错误还原为 ErrLeaseInvalid 和 ErrLeaseDisabled
+func fromStatus(err error) error {
+	st, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+	switch {
+	case st.Code() == codes.NotFound && strings.Contains(st.Message(), ErrNotFound.Error()):
+		return fmt.Errorf("%w: %s", ErrNotFound, st.Message())
+	case st.Code() == codes.FailedPrecondition && st.Message() == ErrLeaseInvalid.Error():
+		return ErrLeaseInvalid
+	case st.Code() == codes.FailedPrecondition && st.Message() == ErrLeaseDisabled.Error():
+		return ErrLeaseDisabled
+	}
+	return err
+}
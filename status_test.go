@@ -0,0 +1,50 @@
+package gocache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	pb "gocache/gocachepb"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestStatusCodes(t *testing.T) {
+	NewGroup("status", 2<<10, "lru", GetterFunc(func(key string) ([]byte, error) {
+		switch key {
+		case "missing":
+			return nil, fmt.Errorf("lookup %s: %w", key, ErrNotFound)
+		case "broken":
+			return nil, errors.New("database down")
+		}
+		return []byte(key), nil
+	}))
+	svr, _ := NewServer("127.0.0.1:9851")
+	ctx := context.Background()
+	for _, c := range []struct {
+		req  *pb.Request
+		code codes.Code
+	}{
+		{&pb.Request{Group: "status", Key: ""}, codes.InvalidArgument},
+		{&pb.Request{Group: "nope", Key: "k"}, codes.NotFound},
+		{&pb.Request{Group: "status", Key: "missing"}, codes.NotFound},
+		{&pb.Request{Group: "status", Key: "broken"}, codes.Internal},
+		{&pb.Request{Group: "status", Key: "k", Deadline: time.Now().Add(-time.Second).UnixNano()}, codes.DeadlineExceeded},
+		{&pb.Request{Group: "status", Key: "k"}, codes.OK},
+	} {
+		if _, err := svr.Get(ctx, c.req); status.Code(err) != c.code {
+			t.Fatalf("%s/%s: expect %v, got %v", c.req.Group, c.req.Key, c.code, err)
+		}
+	}
+
+	_, err := svr.Get(ctx, &pb.Request{Group: "status", Key: "missing"})
+	if !errors.Is(fromStatus(err), ErrNotFound) {
+		t.Fatalf("key miss should map back to ErrNotFound, got %v", fromStatus(err))
+	}
+	if _, err := svr.Get(ctx, &pb.Request{Group: "nope", Key: "k"}); errors.Is(fromStatus(err), ErrNotFound) {
+		t.Fatal("missing group is not a key miss")
+	}
+}
@@ -0,0 +1,136 @@
+package gocache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	pb "gocache/gocachepb"
+	"io"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+const defaultChunkSize = 1 << 20 // GetStream 默认每段数据的大小，远小于gRPC默认4MB的消息大小限制
+
+// ErrValueTooLarge 数据超过了 WithMaxValueSize 设置的大小上限
+var ErrValueTooLarge = errors.New("gocache: value too large")
+
+// WithChunkSize 设置 GetStream 每段数据的最大字节数，默认1MB
+func WithChunkSize(n int) ServerOption {
+	return func(s *Server) {
+		s.chunkSize = n
+	}
+}
+
+// WithMaxValueSize 设置节点之间传输的数据大小上限，0表示不限制。
+// 作为服务端时拒绝发送超过上限的数据，本节点创建的客户端也会拒绝接收超过上限的数据，避免占用过多内存。
+func WithMaxValueSize(n int64) ServerOption {
+	return func(s *Server) {
+		s.maxValueSize = n
+	}
+}
+
+// GetStream 实现了分段读取的流式RPC。数据超过gRPC单条消息的大小限制时，请求方改用它读取
+func (s *Server) GetStream(in *pb.Request, stream pb.GroupCache_GetStreamServer) error {
+	done, err := s.admit(stream.Context())
+	if err != nil {
+		return err
+	}
+	defer done()
+	if in.Key == "" {
+		return errKeyRequired
+	}
+	g := GetGroup(in.Group)
+	if g == nil {
+		return groupNotFound(in.Group)
+	}
+	resp, err := s.storedResponse(stream.Context(), g, in.Key)
+	if err != nil {
+		return statusError(err)
+	}
+	setSendCompressor(stream.Context(), g, len(resp.Value))
+	return sendChunks(stream, resp, s.chunkSize, s.maxValueSize)
+}
+
+// sendChunks 将响应拆分为多段发送，第一段携带响应头
+func sendChunks(stream pb.GroupCache_GetStreamServer, resp *pb.Response, chunkSize int, maxValueSize int64) error {
+	size := int64(len(resp.Value))
+	if maxValueSize > 0 && size > maxValueSize {
+		return status.Errorf(codes.ResourceExhausted, "%v: %d > %d bytes", ErrValueTooLarge, size, maxValueSize)
+	}
+	if chunkSize <= 0 {
+		chunkSize = defaultChunkSize
+	}
+	value := resp.Value
+	header := proto.Clone(resp).(*pb.Response)
+	header.Value = nil
+	first := true
+	for first || len(value) > 0 {
+		n := chunkSize
+		if n > len(value) {
+			n = len(value)
+		}
+		chunk := &pb.Chunk{Data: value[:n]}
+		if first {
+			chunk.Header, chunk.Size = header, size
+			first = false
+		}
+		if err := stream.Send(chunk); err != nil {
+			return err
+		}
+		value = value[n:]
+	}
+	return nil
+}
+
+// fetchStream 通过 GetStream 分段读取数据并拼接
+func (c *Client) fetchStream(in *pb.Request) (*pb.Response, error) {
+	var response *pb.Response
+	err := c.callWithDeadline(in.GetDeadline(), func(ctx context.Context, grpcClient pb.GroupCacheClient) error {
+		req := proto.Clone(in).(*pb.Request)
+		req.ProtocolVersion = protocolVersion
+		stream, err := grpcClient.GetStream(outgoingTrace(ctx, req), req)
+		if err != nil {
+			return err
+		}
+		response, err = readChunks(stream.Recv, c.maxValueSize)
+		return err
+	})
+	return response, err
+}
+
+// readChunks 按顺序读取并拼接各段数据，数据超过 maxValueSize(大于0时)或与声明的总大小不符时返回错误
+func readChunks(recv func() (*pb.Chunk, error), maxValueSize int64) (*pb.Response, error) {
+	first, err := recv()
+	if err != nil {
+		return nil, err
+	}
+	if first.Header == nil {
+		return nil, fmt.Errorf("gocache: stream missing header")
+	}
+	if maxValueSize > 0 && first.Size > maxValueSize {
+		return nil, fmt.Errorf("%w: %d > %d bytes", ErrValueTooLarge, first.Size, maxValueSize)
+	}
+	resp := first.Header
+	resp.Value = make([]byte, 0, first.Size)
+	resp.Value = append(resp.Value, first.Data...)
+	for {
+		chunk, err := recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if int64(len(resp.Value)+len(chunk.Data)) > first.Size {
+			return nil, fmt.Errorf("gocache: stream larger than declared size %d", first.Size)
+		}
+		resp.Value = append(resp.Value, chunk.Data...)
+	}
+	if int64(len(resp.Value)) != first.Size {
+		return nil, fmt.Errorf("gocache: stream truncated: got %d of %d bytes", len(resp.Value), first.Size)
+	}
+	return resp, nil
+}
@@ -0,0 +1,90 @@
+package gocache
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	pb "gocache/gocachepb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// chunkRecorder 记录 GetStream 发送的各段数据
+type chunkRecorder struct {
+	grpc.ServerStream
+	chunks []*pb.Chunk
+}
+
+func (r *chunkRecorder) Send(c *pb.Chunk) error {
+	r.chunks = append(r.chunks, c)
+	return nil
+}
+
+func (r *chunkRecorder) Context() context.Context {
+	return context.Background()
+}
+
+// recv 按顺序返回记录的各段数据，用于模拟客户端的 stream.Recv
+func (r *chunkRecorder) recv() func() (*pb.Chunk, error) {
+	i := 0
+	return func() (*pb.Chunk, error) {
+		if i == len(r.chunks) {
+			return nil, io.EOF
+		}
+		i++
+		return r.chunks[i-1], nil
+	}
+}
+
+func TestGetStream(t *testing.T) {
+	large := bytes.Repeat([]byte("0123456789"), 1000)
+	NewGroup("stream", 1<<20, "lru", GetterFunc(func(key string) ([]byte, error) {
+		if key == "empty" {
+			return []byte{}, nil
+		}
+		return large, nil
+	}))
+	svr, _ := NewServer("127.0.0.1:9705", WithChunkSize(3000), WithMaxValueSize(20000))
+
+	rec := &chunkRecorder{}
+	if err := svr.GetStream(&pb.Request{Group: "stream", Key: "large"}, rec); err != nil {
+		t.Fatal(err)
+	}
+	if len(rec.chunks) != 4 || rec.chunks[0].Size != int64(len(large)) {
+		t.Fatalf("expect 4 chunks, got %d", len(rec.chunks))
+	}
+	resp, err := readChunks(rec.recv(), 0)
+	if err != nil || !resp.Found || !bytes.Equal(resp.Value, large) {
+		t.Fatalf("reassembled value mismatch: %v", err)
+	}
+	if _, err := readChunks(rec.recv(), 5000); !errors.Is(err, ErrValueTooLarge) {
+		t.Fatalf("client should enforce max value size, got %v", err)
+	}
+	rec.chunks = rec.chunks[:3]
+	if _, err := readChunks(rec.recv(), 0); err == nil {
+		t.Fatal("expect error for a truncated stream")
+	}
+
+	// 空值也要发送一段携带响应头的数据
+	rec = &chunkRecorder{}
+	if err := svr.GetStream(&pb.Request{Group: "stream", Key: "empty"}, rec); err != nil {
+		t.Fatal(err)
+	}
+	if resp, err := readChunks(rec.recv(), 0); err != nil || !resp.Found || len(resp.Value) != 0 {
+		t.Fatalf("unexpected empty value %+v %v", resp, err)
+	}
+
+	svr, _ = NewServer("127.0.0.1:9706", WithMaxValueSize(5000))
+	err = svr.GetStream(&pb.Request{Group: "stream", Key: "large"}, &chunkRecorder{})
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("server should refuse values over the limit, got %v", err)
+	}
+	_, err = svr.Get(context.Background(), &pb.Request{Group: "stream", Key: "large", ProtocolVersion: protocolVersion})
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("server should refuse values over the limit, got %v", err)
+	}
+}
@@ -0,0 +1,80 @@
+package gocache
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	pb "gocache/gocachepb"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestRPCTimeout(t *testing.T) {
+	NewGroup("timeout", 2<<10, "lru", GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}))
+	slow := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if strings.HasSuffix(info.FullMethod, "/Get") {
+			time.Sleep(200 * time.Millisecond)
+		}
+		return handler(ctx, req)
+	}
+	svr, _ := NewServer("127.0.0.1:9715", WithUnaryInterceptors(slow), WithRPCTimeout(50*time.Millisecond))
+	addr, stop := serveGRPC(t, svr)
+	defer stop()
+
+	c := svr.newClient(addr)
+	c.connect = directClient(addr).connect
+	defer c.Close()
+	if c.timeout != 50*time.Millisecond {
+		t.Fatalf("client timeout = %v, want the server's WithRPCTimeout", c.timeout)
+	}
+
+	start := time.Now()
+	err := c.Get(&pb.Request{Group: "timeout", Key: "a"}, &pb.Response{})
+	if status.Code(err) != codes.DeadlineExceeded {
+		t.Fatalf("Get = %v, want DeadlineExceeded", err)
+	}
+	if d := time.Since(start); d > 150*time.Millisecond {
+		t.Fatalf("Get took %v with a 50ms timeout", d)
+	}
+
+	// 调用方的截止时间优先于客户端的超时时间
+	deadline := time.Now().Add(2 * time.Second).UnixNano()
+	if err := c.Get(&pb.Request{Group: "timeout", Key: "b", Deadline: deadline}, &pb.Response{}); err != nil {
+		t.Fatalf("Get with caller deadline: %v", err)
+	}
+}
+
+// deadlinePeer 记录请求携带的截止时间
+type deadlinePeer struct{ deadline *int64 }
+
+func (p deadlinePeer) Get(in *pb.Request, out *pb.Response) error {
+	*p.deadline = in.Deadline
+	out.Value, out.Found, out.ProtocolVersion = []byte("v"), true, protocolVersion
+	return nil
+}
+
+func TestPeerTimeout(t *testing.T) {
+	g := NewGroup("peer-timeout", 2<<10, "lru", GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}), WithPeerTimeout(300*time.Millisecond))
+	var deadline int64
+	peer := deadlinePeer{&deadline}
+
+	g.getFromPeer(context.Background(), peer, "a")
+	if left := time.Until(time.Unix(0, deadline)); left <= 0 || left > 300*time.Millisecond {
+		t.Fatalf("request deadline in %v, want within the group's 300ms peer timeout", left)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+	g.getFromPeer(ctx, peer, "b")
+	if left := time.Until(time.Unix(0, deadline)); left < 59*time.Minute {
+		t.Fatalf("request deadline in %v, want the caller's deadline", left)
+	}
+}
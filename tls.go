@@ -0,0 +1,99 @@
+package gocache
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// 注册到etcd的传输协议，其他节点据此判断是否需要使用TLS连接本节点，见 NodeMetadata
+const (
+	SchemePlain = "grpc"  // 明文传输
+	SchemeTLS   = "grpcs" // TLS传输
+)
+
+// WithTLS 使用TLS保护节点之间的通信。cfg 同时用于本节点的gRPC服务器和访问其他节点的客户端：
+// Certificates 为本节点的证书；RootCAs 用于校验其他节点的证书；设置了 ClientCAs 和 ClientAuth 时要求请求方出示证书(mTLS)。
+// 集群中的节点需要使用相同的设置，否则无法互相访问。
+func WithTLS(cfg *tls.Config) ServerOption {
+	return func(s *Server) {
+		s.tlsConfig = cfg
+	}
+}
+
+// WithTLSFiles 从PEM文件加载证书并开启mTLS，见 LoadTLSConfig。加载失败时 NewServer 返回错误。
+func WithTLSFiles(certFile, keyFile, caFile string) ServerOption {
+	return func(s *Server) {
+		cfg, err := LoadTLSConfig(certFile, keyFile, caFile)
+		if err != nil {
+			s.optErr = errors.Join(s.optErr, err)
+			return
+		}
+		s.tlsConfig = cfg
+	}
+}
+
+// LoadTLSConfig 从PEM文件加载节点的证书、私钥和CA证书，返回节点之间双向认证(mTLS)的配置：
+// 节点出示自己的证书，并且只信任由caFile中的CA签发的证书，无论作为服务端还是客户端。
+func LoadTLSConfig(certFile, keyFile, caFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("gocache: load certificate: %w", err)
+	}
+	caPEM, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("gocache: load CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return nil, fmt.Errorf("gocache: no certificates found in %s", caFile)
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      pool,
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// scheme 返回本节点使用的传输协议
+func (s *Server) scheme() string {
+	if s.tlsConfig != nil {
+		return SchemeTLS
+	}
+	return SchemePlain
+}
+
+// serverCredentials 返回gRPC服务器的传输参数，没有开启TLS时返回nil
+func (s *Server) serverCredentials() []grpc.ServerOption {
+	if s.tlsConfig == nil {
+		return nil
+	}
+	return []grpc.ServerOption{grpc.Creds(credentials.NewTLS(s.tlsConfig))}
+}
+
+// clientCredentials 返回访问节点peerAddr使用的传输凭据。
+// 通过etcd发现节点时连接的目标是服务名称而不是地址，cfg 没有指定 ServerName 时使用节点的主机名校验证书，
+// 因此节点的证书需要包含其对外公布的IP或域名。
+func clientCredentials(cfg *tls.Config, peerAddr string) credentials.TransportCredentials {
+	if cfg == nil {
+		return insecure.NewCredentials()
+	}
+	cfg = cfg.Clone()
+	if cfg.ServerName == "" {
+		host, _, err := net.SplitHostPort(peerAddr)
+		if err != nil {
+			host = peerAddr
+		}
+		cfg.ServerName = host
+	}
+	return credentials.NewTLS(cfg)
+}
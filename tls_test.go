@@ -0,0 +1,114 @@
+package gocache
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	pb "gocache/gocachepb"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// writeTestPKI 在dir中生成CA以及由其签发的节点证书(包含127.0.0.1)，返回证书、私钥和CA的文件路径
+func writeTestPKI(t *testing.T, dir string) (certFile, keyFile, caFile string) {
+	t.Helper()
+	caKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	caTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "gocache test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTmpl, caTmpl, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodeKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	nodeTmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "gocache node"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	nodeDER, err := x509.CreateCertificate(rand.Reader, nodeTmpl, caTmpl, &nodeKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, _ := x509.MarshalECPrivateKey(nodeKey)
+
+	write := func(name, typ string, der []byte) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	return write("node.pem", "CERTIFICATE", nodeDER), write("node-key.pem", "EC PRIVATE KEY", keyDER), write("ca.pem", "CERTIFICATE", caDER)
+}
+
+func TestTLS(t *testing.T) {
+	NewGroup("tls", 2<<10, "lru", GetterFunc(func(key string) ([]byte, error) {
+		return []byte("v:" + key), nil
+	}))
+	certFile, keyFile, caFile := writeTestPKI(t, t.TempDir())
+	svr, err := NewServer("127.0.0.1:9709", WithTLSFiles(certFile, keyFile, caFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md := svr.nodeMetadata(); md.Scheme != SchemeTLS {
+		t.Fatalf("registered scheme = %q, want %q", md.Scheme, SchemeTLS)
+	}
+	addr, stop := serveGRPC(t, svr)
+	defer stop()
+
+	get := func(creds credentials.TransportCredentials) error {
+		c := NewClient("gocache/" + addr)
+		c.connect = func() (*grpc.ClientConn, func(), error) {
+			conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(creds))
+			if err != nil {
+				return nil, nil, err
+			}
+			return conn, func() { conn.Close() }, nil
+		}
+		return c.Get(&pb.Request{Group: "tls", Key: "k"}, &pb.Response{})
+	}
+
+	// 节点之间使用相同的配置，双方互相校验证书
+	if err := get(clientCredentials(svr.tlsConfig, addr)); err != nil {
+		t.Fatalf("mTLS Get: %v", err)
+	}
+	if err := get(insecure.NewCredentials()); err == nil {
+		t.Fatal("plaintext client was accepted by TLS server")
+	}
+	// 信任CA但不出示证书的请求方被拒绝
+	noCert := svr.tlsConfig.Clone()
+	noCert.Certificates = nil
+	if err := get(clientCredentials(noCert, addr)); err == nil {
+		t.Fatal("client without certificate was accepted")
+	}
+
+	if _, err := NewServer("127.0.0.1:9709", WithTLSFiles(certFile, keyFile, filepath.Join(t.TempDir(), "missing.pem"))); err == nil {
+		t.Fatal("NewServer accepted a missing CA file")
+	}
+	if plain, _ := NewServer("127.0.0.1:9709"); plain.nodeMetadata().Scheme != SchemePlain {
+		t.Fatalf("plaintext server registered scheme %q", plain.nodeMetadata().Scheme)
+	}
+}
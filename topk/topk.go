@@ -0,0 +1,204 @@
+// Package topk 在固定的内存内统计访问最多的key。
+// 每个时间段使用一个 Space-Saving 摘要：最多跟踪 capacity 个key，新的key在摘要已满时替换计数最小的key，
+// 并继承其计数作为误差上限，因此访问次数超过总次数 1/capacity 的key一定会出现在结果中。
+// Window 按时间分桶保存多个摘要，查询时合并最近一段时间的桶，得到最近M分钟的热点key。
+package topk
+
+import (
+	"container/heap"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Entry 一个key的统计，Count 和 Bytes 是估计值，最多比真实值大 Error 次访问
+type Entry struct {
+	Key   string `json:"key"`
+	Count int64  `json:"count"` // 访问次数
+	Bytes int64  `json:"bytes"` // 访问的数据字节数
+	Error int64  `json:"error"` // Count 的最大高估量
+}
+
+// Summary 一个 Space-Saving 摘要，不是并发安全的
+type Summary struct {
+	capacity int
+	items    map[string]*item
+	heap     itemHeap // 按 Count 排序的最小堆
+}
+
+type item struct {
+	Entry
+	index int // 在堆中的位置
+}
+
+// NewSummary 创建最多跟踪 capacity 个key的摘要，capacity 小于1时按1处理
+func NewSummary(capacity int) *Summary {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &Summary{capacity: capacity, items: make(map[string]*item, capacity)}
+}
+
+// Add 记录一次对key的访问，bytes 为访问的数据大小
+func (s *Summary) Add(key string, bytes int64) {
+	if it, ok := s.items[key]; ok {
+		it.Count++
+		it.Bytes += bytes
+		heap.Fix(&s.heap, it.index)
+		return
+	}
+	if len(s.items) < s.capacity {
+		it := &item{Entry: Entry{Key: key, Count: 1, Bytes: bytes}}
+		s.items[key] = it
+		heap.Push(&s.heap, it)
+		return
+	}
+	// 替换计数最小的key，继承其计数作为误差
+	it := s.heap[0]
+	delete(s.items, it.Key)
+	it.Key, it.Error = key, it.Count
+	it.Count++
+	it.Bytes += bytes
+	s.items[key] = it
+	heap.Fix(&s.heap, 0)
+}
+
+// Len 返回跟踪的key数量
+func (s *Summary) Len() int {
+	return len(s.items)
+}
+
+// Entries 返回所有跟踪的key，顺序不确定
+func (s *Summary) Entries() []Entry {
+	out := make([]Entry, 0, len(s.items))
+	for _, it := range s.items {
+		out = append(out, it.Entry)
+	}
+	return out
+}
+
+// Reset 清空摘要
+func (s *Summary) Reset() {
+	s.items = make(map[string]*item, s.capacity)
+	s.heap = s.heap[:0]
+}
+
+// Top 从entries中返回前n个，byBytes 为true时按 Bytes 排序，否则按 Count 排序，相同时按key排序
+func Top(entries []Entry, n int, byBytes bool) []Entry {
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if byBytes && a.Bytes != b.Bytes {
+			return a.Bytes > b.Bytes
+		}
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.Key < b.Key
+	})
+	if n >= 0 && n < len(entries) {
+		entries = entries[:n]
+	}
+	return entries
+}
+
+// Window 最近一段时间的访问统计，按 resolution 分桶，每个桶是一个 Summary，并发安全
+type Window struct {
+	// Now 返回当前时间，默认为 time.Now，测试时可以替换
+	Now func() time.Time
+
+	mu         sync.Mutex
+	resolution time.Duration
+	buckets    []bucket
+}
+
+type bucket struct {
+	start   int64 // 桶的开始时间，按 resolution 对齐的unix纳秒
+	summary *Summary
+}
+
+// NewWindow 创建统计最近span时间的窗口，每个桶覆盖resolution时间、最多跟踪capacity个key。
+// 内存占用约为 span/resolution*capacity 个key。resolution 小于等于0时为1分钟，span 小于 resolution 时只保留一个桶。
+func NewWindow(capacity int, span, resolution time.Duration) *Window {
+	if resolution <= 0 {
+		resolution = time.Minute
+	}
+	n := int(span / resolution)
+	if n < 1 {
+		n = 1
+	}
+	w := &Window{Now: time.Now, resolution: resolution, buckets: make([]bucket, n)}
+	for i := range w.buckets {
+		w.buckets[i].summary = NewSummary(capacity)
+	}
+	return w
+}
+
+// Add 记录一次对key的访问
+func (w *Window) Add(key string, bytes int64) {
+	start := w.Now().UnixNano() / int64(w.resolution) * int64(w.resolution)
+	w.mu.Lock()
+	b := &w.buckets[int(start/int64(w.resolution))%len(w.buckets)]
+	if b.start != start { // 桶已经过期，开始新的时间段
+		b.start = start
+		b.summary.Reset()
+	}
+	b.summary.Add(key, bytes)
+	w.mu.Unlock()
+}
+
+// Top 返回最近last时间(按桶的粒度向上取整，最多为窗口的长度，小于等于0表示整个窗口)内访问最多的n个key，
+// byBytes 为true时按访问的字节数排序。同一个key在各个桶中的统计相加，没有出现在某个桶的摘要中的访问不计入。
+func (w *Window) Top(n int, last time.Duration, byBytes bool) []Entry {
+	now := w.Now().UnixNano()
+	if last <= 0 {
+		last = time.Duration(len(w.buckets)) * w.resolution
+	}
+	from := now/int64(w.resolution)*int64(w.resolution) - int64(last-1)/int64(w.resolution)*int64(w.resolution)
+	merged := map[string]*Entry{}
+	w.mu.Lock()
+	for i := range w.buckets {
+		b := &w.buckets[i]
+		if b.start < from || b.start > now || b.summary.Len() == 0 {
+			continue
+		}
+		for _, it := range b.summary.items {
+			e, ok := merged[it.Key]
+			if !ok {
+				e = &Entry{Key: it.Key}
+				merged[it.Key] = e
+			}
+			e.Count += it.Count
+			e.Bytes += it.Bytes
+			e.Error += it.Error
+		}
+	}
+	w.mu.Unlock()
+	entries := make([]Entry, 0, len(merged))
+	for _, e := range merged {
+		entries = append(entries, *e)
+	}
+	return Top(entries, n, byBytes)
+}
+
+// itemHeap 按 Count 排序的最小堆
+type itemHeap []*item
+
+func (h itemHeap) Len() int           { return len(h) }
+func (h itemHeap) Less(i, j int) bool { return h[i].Count < h[j].Count }
+func (h itemHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index, h[j].index = i, j
+}
+
+func (h *itemHeap) Push(x interface{}) {
+	it := x.(*item)
+	it.index = len(*h)
+	*h = append(*h, it)
+}
+
+func (h *itemHeap) Pop() interface{} {
+	old := *h
+	it := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return it
+}
@@ -0,0 +1,75 @@
+package topk
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestSummary(t *testing.T) {
+	s := NewSummary(10) // 总共250次访问，超过25次的key一定会被跟踪
+	for i := 0; i < 100; i++ {
+		s.Add("hot", 10)
+		if i%2 == 0 {
+			s.Add("warm", 1)
+		}
+		s.Add(fmt.Sprintf("cold-%d", i), 1) // 每个只访问一次
+	}
+	if s.Len() != 10 {
+		t.Fatalf("Len = %d, want 10", s.Len())
+	}
+	top := Top(s.Entries(), 2, false)
+	if top[0].Key != "hot" || top[0].Count != 100 || top[0].Bytes != 1000 || top[0].Error != 0 {
+		t.Errorf("top[0] = %+v", top[0])
+	}
+	if top[1].Key != "warm" || top[1].Count < 50 {
+		t.Errorf("top[1] = %+v", top[1])
+	}
+}
+
+func TestSummaryErrorBound(t *testing.T) {
+	s := NewSummary(2)
+	s.Add("a", 1)
+	s.Add("b", 1)
+	s.Add("c", 5) // 替换计数最小的key
+	for _, e := range s.Entries() {
+		if e.Key == "c" && (e.Count != 2 || e.Error != 1) {
+			t.Errorf("c = %+v, want count 2 with error 1", e)
+		}
+	}
+}
+
+func TestTopByBytes(t *testing.T) {
+	entries := []Entry{{Key: "a", Count: 10, Bytes: 10}, {Key: "b", Count: 1, Bytes: 100}, {Key: "c", Count: 5, Bytes: 50}}
+	if top := Top(entries, 1, true); top[0].Key != "b" {
+		t.Errorf("by bytes = %+v", top)
+	}
+	if top := Top(entries, 5, false); len(top) != 3 || top[0].Key != "a" || top[2].Key != "b" {
+		t.Errorf("by count = %+v", top)
+	}
+}
+
+func TestWindow(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	w := NewWindow(10, 5*time.Minute, time.Minute)
+	w.Now = func() time.Time { return now }
+
+	w.Add("old", 1)
+	w.Add("old", 1)
+	now = now.Add(3 * time.Minute)
+	w.Add("new", 1)
+
+	if top := w.Top(10, time.Minute, false); len(top) != 1 || top[0].Key != "new" {
+		t.Errorf("last minute = %+v", top)
+	}
+	if top := w.Top(10, 0, false); len(top) != 2 || top[0].Key != "old" || top[0].Count != 2 {
+		t.Errorf("whole window = %+v", top)
+	}
+
+	// 超过窗口长度后旧的桶被丢弃
+	now = now.Add(5 * time.Minute)
+	w.Add("new", 1)
+	if top := w.Top(10, 0, false); len(top) != 1 || top[0].Key != "new" || top[0].Count != 1 {
+		t.Errorf("after expiry = %+v", top)
+	}
+}
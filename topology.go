@@ -0,0 +1,171 @@
+package gocache
+
+import (
+	"gocache/consistenthash"
+	"sort"
+)
+
+// NodeMetadata 随节点地址一起注册到etcd的元数据
+type NodeMetadata struct {
+	Scheme   string       `json:"scheme"`             // 传输协议，SchemePlain 或 SchemeTLS
+	Groups   []string     `json:"groups,omitempty"`   // 单独指定了节点集合并且包含本节点的缓存组，见 SetGroup
+	Weight   int          `json:"weight,omitempty"`   // 在哈希环上的权重，0表示默认的1，见 WithWeight
+	Zone     string       `json:"zone,omitempty"`     // 所在的可用区，见 WithZone
+	Version  string       `json:"version,omitempty"`  // 构建版本，见 BuildVersion
+	Protocol int32        `json:"protocol,omitempty"` // 协议版本
+	Features []Capability `json:"features,omitempty"` // 支持的可选功能，与 Hello 交换的相同
+}
+
+// SetGroup 为缓存组单独指定节点集合(可以包含本节点)，例如缓存组A分布在节点1-3上、缓存组B分布在节点2-5上。
+// 该缓存组的key只在这些节点之间分布，其他缓存组仍然使用 Set 设置的节点。多次调用会向集合中追加节点。
+// 迁移统计会随之更新，渐进式清理(见 WithRebalance)只作用于使用公共节点集合的缓存组。
+func (s *Server) SetGroup(group string, peersAddr ...string) {
+	s.mu.Lock()
+	if s.groupRings == nil {
+		s.groupRings = map[string]*consistenthash.Map{}
+	}
+	ring := s.groupRings[group]
+	if ring == nil {
+		ring = s.newRing()
+		s.groupRings[group] = ring
+	}
+	oldRing := ring.Clone()
+	ring.Add(peersAddr...)
+	newRing := ring.Clone()
+	for _, peerAddr := range peersAddr {
+		if _, ok := s.clients[peerAddr]; !ok && peerAddr != s.self { // 客户端由所有缓存组共享
+			s.clients[peerAddr] = s.newClient(peerAddr)
+		}
+	}
+	s.updateRegistration()
+	s.mu.Unlock()
+
+	s.updateGroupMigration(group, oldRing, newRing)
+}
+
+// RemoveGroupPeers 从缓存组单独的节点集合中删除节点，客户端可能仍被其他缓存组使用，因此不会关闭
+func (s *Server) RemoveGroupPeers(group string, peersAddr ...string) {
+	s.mu.Lock()
+	ring := s.groupRings[group]
+	if ring == nil {
+		s.mu.Unlock()
+		return
+	}
+	oldRing := ring.Clone()
+	ring.Remove(peersAddr...)
+	newRing := ring.Clone()
+	s.updateRegistration()
+	s.mu.Unlock()
+
+	s.updateGroupMigration(group, oldRing, newRing)
+}
+
+// ResetGroup 取消缓存组单独的节点集合，之后该缓存组使用 Set 设置的节点
+func (s *Server) ResetGroup(group string) {
+	s.mu.Lock()
+	delete(s.groupRings, group)
+	s.updateRegistration()
+	s.mu.Unlock()
+}
+
+// GroupPeers 返回缓存组使用的节点，按名称排序
+func (s *Server) GroupPeers(group string) []string {
+	return s.groupRing(group).Nodes()
+}
+
+// groupRing 返回缓存组使用的哈希环，没有单独指定节点集合时返回公共的哈希环
+func (s *Server) groupRing(group string) *consistenthash.Map {
+	s.mu.RLock()
+	ring := s.groupRings[group]
+	s.mu.RUnlock()
+	if ring == nil {
+		return s.peers
+	}
+	return ring
+}
+
+// hasGroupRing 返回缓存组是否单独指定了节点集合
+func (s *Server) hasGroupRing(group string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.groupRings[group]
+	return ok
+}
+
+// PickGroupPeer 实现了 GroupPeerPicker，在缓存组使用的哈希环上选择key的归属节点
+func (s *Server) PickGroupPeer(group, key string) (PeerGetter, bool) {
+	return s.pickFrom(s.groupRing(group), key)
+}
+
+// 测试 Server 是否实现了 GroupPeerPicker 接口
+var _ GroupPeerPicker = (*Server)(nil)
+
+// GroupMetadata 缓存组注册记录(gocache/<group>/<addr>)的元数据
+type GroupMetadata struct {
+	Group     string `json:"group"`
+	Capacity  int64  `json:"capacity"`  // 本节点上该缓存组主缓存的容量上限
+	Dedicated bool   `json:"dedicated"` // 该缓存组是否单独指定了节点集合，见 SetGroup
+}
+
+// updateRegistration 更新注册到etcd的节点元数据和本节点提供的缓存组，调用时需持有 s.mu。
+// 公共哈希环为空或包含本节点时，本节点提供所有没有单独指定节点集合的缓存组。
+func (s *Server) updateRegistration() {
+	s.registration.SetMetadata(s.nodeMetadata())
+	groups := map[string]interface{}{}
+	for _, g := range allGroups() {
+		ring, dedicated := s.groupRings[g.name]
+		if !dedicated {
+			ring = s.peers
+		}
+		if nodes := ring.Nodes(); (!dedicated && len(nodes) == 0) || containsString(nodes, s.self) {
+			md := GroupMetadata{Group: g.name, Dedicated: dedicated}
+			if g.mainCache != nil {
+				md.Capacity = g.mainCache.capacity()
+			}
+			groups[g.name] = md
+		}
+	}
+	s.registration.SetGroups(groups)
+}
+
+// containsString 返回有序切片list中是否包含s
+func containsString(list []string, s string) bool {
+	i := sort.SearchStrings(list, s)
+	return i < len(list) && list[i] == s
+}
+
+// nodeMetadata 返回注册到etcd的元数据，调用时需持有 s.mu
+func (s *Server) nodeMetadata() NodeMetadata {
+	caps := localCapabilities(s.self)
+	md := NodeMetadata{
+		Scheme:   s.scheme(),
+		Weight:   s.weight,
+		Zone:     s.zone,
+		Version:  BuildVersion,
+		Protocol: caps.ProtocolVersion,
+		Features: caps.Features,
+	}
+	for group, ring := range s.groupRings {
+		if containsString(ring.Nodes(), s.self) {
+			md.Groups = append(md.Groups, group)
+		}
+	}
+	sort.Strings(md.Groups)
+	return md
+}
+
+// updateGroupMigration 缓存组的哈希环变化后重新计算该缓存组的迁移统计
+func (s *Server) updateGroupMigration(group string, oldRing, newRing *consistenthash.Map) {
+	g := GetGroup(group)
+	if g == nil {
+		return
+	}
+	st := computeMigration(g, s.self, oldRing, newRing)
+	s.mu.Lock()
+	if s.migration == nil {
+		s.migration = map[string]MigrationStats{}
+	}
+	s.migration[group] = st
+	s.mu.Unlock()
+	s.logger.Info("group topology changed", "self", s.self, "group", group, "nodes", newRing.Nodes())
+}
@@ -0,0 +1,133 @@
+package gocache
+
+import (
+	"context"
+	pb "gocache/gocachepb"
+	"sync"
+
+	"google.golang.org/grpc/metadata"
+)
+
+// Tracer 创建分布式追踪的span，并在节点之间传播追踪上下文，方法与OpenTelemetry一一对应，
+// 可以用 go.opentelemetry.io/otel 适配后通过 SetTracer 安装，把一次请求在多个节点上的路径导出到Jaeger、Tempo等：
+//
+//	Start   -> trace.Tracer.Start
+//	Inject  -> propagation.TraceContext{}.Inject(ctx, propagation.MapCarrier(carrier))
+//	Extract -> propagation.TraceContext{}.Extract(ctx, propagation.MapCarrier(carrier))
+//
+// 节点之间只传播W3C Trace Context 的 traceparent 和 tracestate 两个字段，经由gRPC元数据和 pb.Request 传递。
+type Tracer interface {
+	// Start 创建一个span，返回的上下文携带该span，之后创建的span作为它的子span
+	Start(ctx context.Context, name string) (context.Context, Span)
+	// Inject 把ctx中的追踪上下文写入carrier
+	Inject(ctx context.Context, carrier map[string]string)
+	// Extract 返回携带carrier中的远程追踪上下文的ctx
+	Extract(ctx context.Context, carrier map[string]string) context.Context
+}
+
+// Span 一次操作的追踪记录，对应 trace.Span
+type Span interface {
+	// SetAttribute 设置span的属性，value 为 string、int、int64 或 bool
+	SetAttribute(key string, value interface{})
+	// RecordError 记录操作失败的原因
+	RecordError(err error)
+	// End 结束span
+	End()
+}
+
+// W3C Trace Context 的字段名，同时也是gRPC元数据的键
+const (
+	traceparentKey = "traceparent"
+	tracestateKey  = "tracestate"
+)
+
+// 当前的追踪器，nil表示不追踪
+var (
+	tracerMu sync.RWMutex
+	tracer   Tracer
+)
+
+// SetTracer 设置本进程使用的追踪器，nil表示关闭追踪(默认)。开启后读取、加载、访问远程节点和处理远程请求
+// 都会创建span：gocache.Get、gocache.load、gocache.getFromPeer 和 gocache.Server.Get。
+func SetTracer(t Tracer) {
+	tracerMu.Lock()
+	tracer = t
+	tracerMu.Unlock()
+}
+
+func currentTracer() Tracer {
+	tracerMu.RLock()
+	defer tracerMu.RUnlock()
+	return tracer
+}
+
+// noopSpan 没有设置追踪器时使用的span
+type noopSpan struct{}
+
+func (noopSpan) SetAttribute(string, interface{}) {}
+func (noopSpan) RecordError(error)                {}
+func (noopSpan) End()                             {}
+
+// startSpan 在设置了追踪器时创建span，否则返回原来的ctx和 noopSpan
+func startSpan(ctx context.Context, name string) (context.Context, Span) {
+	t := currentTracer()
+	if t == nil {
+		return ctx, noopSpan{}
+	}
+	return t.Start(ctx, name)
+}
+
+// endSpan 记录err(不为nil时)并结束span
+func endSpan(span Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+	}
+	span.End()
+}
+
+// injectTrace 把ctx中的追踪上下文写入发往远程节点的请求
+func injectTrace(ctx context.Context, req *pb.Request) {
+	t := currentTracer()
+	if t == nil {
+		return
+	}
+	carrier := map[string]string{}
+	t.Inject(ctx, carrier)
+	req.Traceparent, req.Tracestate = carrier[traceparentKey], carrier[tracestateKey]
+}
+
+// outgoingTrace 把请求携带的追踪上下文放入gRPC元数据，接收方或其他gRPC中间件可以直接从元数据中读取
+func outgoingTrace(ctx context.Context, req *pb.Request) context.Context {
+	if req.Traceparent == "" {
+		return ctx
+	}
+	kv := []string{traceparentKey, req.Traceparent}
+	if req.Tracestate != "" {
+		kv = append(kv, tracestateKey, req.Tracestate)
+	}
+	return metadata.AppendToOutgoingContext(ctx, kv...)
+}
+
+// extractTrace 返回携带请求方追踪上下文的ctx，优先读取gRPC元数据，没有时使用请求中的字段
+func extractTrace(ctx context.Context, in *pb.Request) context.Context {
+	t := currentTracer()
+	if t == nil {
+		return ctx
+	}
+	carrier := map[string]string{}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if v := md.Get(traceparentKey); len(v) > 0 {
+			carrier[traceparentKey] = v[0]
+			if v := md.Get(tracestateKey); len(v) > 0 {
+				carrier[tracestateKey] = v[0]
+			}
+		}
+	}
+	if carrier[traceparentKey] == "" && in.Traceparent != "" {
+		carrier[traceparentKey], carrier[tracestateKey] = in.Traceparent, in.Tracestate
+	}
+	if carrier[traceparentKey] == "" {
+		return ctx
+	}
+	return t.Extract(ctx, carrier)
+}
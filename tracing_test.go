@@ -0,0 +1,140 @@
+package gocache
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeTracer 记录创建的span，追踪上下文按 traceparent 的格式传播
+type fakeTracer struct {
+	mu    sync.Mutex
+	spans []*fakeSpan
+	next  int
+}
+
+type fakeSpan struct {
+	name, trace, id, parent string
+	attrs                   map[string]interface{}
+	err                     error
+	ended                   bool
+}
+
+type fakeSpanKey struct{}
+
+func (t *fakeTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.next++
+	span := &fakeSpan{name: name, id: fmt.Sprintf("%016x", t.next), attrs: map[string]interface{}{}}
+	if parent, ok := ctx.Value(fakeSpanKey{}).(*fakeSpan); ok {
+		span.trace, span.parent = parent.trace, parent.id
+	} else {
+		span.trace = fmt.Sprintf("%032x", t.next)
+	}
+	t.spans = append(t.spans, span)
+	return context.WithValue(ctx, fakeSpanKey{}, span), span
+}
+
+func (t *fakeTracer) Inject(ctx context.Context, carrier map[string]string) {
+	if span, ok := ctx.Value(fakeSpanKey{}).(*fakeSpan); ok {
+		carrier["traceparent"] = "00-" + span.trace + "-" + span.id + "-01"
+	}
+}
+
+func (t *fakeTracer) Extract(ctx context.Context, carrier map[string]string) context.Context {
+	parts := strings.Split(carrier["traceparent"], "-")
+	if len(parts) != 4 {
+		return ctx
+	}
+	// 远程的span只用于关联父子关系，不记录
+	return context.WithValue(ctx, fakeSpanKey{}, &fakeSpan{trace: parts[1], id: parts[2]})
+}
+
+func (t *fakeTracer) find(name string) *fakeSpan {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, s := range t.spans {
+		if s.name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+func (s *fakeSpan) SetAttribute(key string, value interface{}) { s.attrs[key] = value }
+func (s *fakeSpan) RecordError(err error)                      { s.err = err }
+func (s *fakeSpan) End()                                       { s.ended = true }
+
+func TestTracingAcrossPeers(t *testing.T) {
+	tr := &fakeTracer{}
+	SetTracer(tr)
+	defer SetTracer(nil)
+
+	g := NewGroup("tracing", 2<<10, "lru", GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}))
+	svr, _ := NewServer("127.0.0.1:9708")
+	addr, stop := serveGRPC(t, svr)
+	defer stop()
+	client := directClient(addr)
+	defer client.Close()
+
+	ctx, root := startSpan(context.Background(), "request")
+	if _, _, err := g.getFromPeer(ctx, client, "k"); err != nil {
+		t.Fatal(err)
+	}
+	root.End()
+
+	peer, remote := tr.find("gocache.getFromPeer"), tr.find("gocache.Server.Get")
+	get, load := tr.find("gocache.Get"), tr.find("gocache.load")
+	if peer == nil || remote == nil || get == nil || load == nil {
+		t.Fatalf("missing spans: %+v", tr.spans)
+	}
+	rootSpan := root.(*fakeSpan)
+	if peer.parent != rootSpan.id {
+		t.Errorf("getFromPeer parent = %q, want %q", peer.parent, rootSpan.id)
+	}
+	// 远程节点上的span与请求方属于同一个追踪，并且是 getFromPeer 的子span
+	if remote.trace != rootSpan.trace || remote.parent != peer.id {
+		t.Errorf("Server.Get trace/parent = %s/%s, want %s/%s", remote.trace, remote.parent, rootSpan.trace, peer.id)
+	}
+	if get.parent != remote.id || load.parent != get.id {
+		t.Errorf("remote spans not nested: Get parent %s, load parent %s", get.parent, load.parent)
+	}
+	if load.attrs["gocache.source"] != string(SourceLocalLoad) || remote.attrs["gocache.key"] != "k" {
+		t.Errorf("attrs: load %v, remote %v", load.attrs, remote.attrs)
+	}
+	for _, s := range []*fakeSpan{peer, remote, get, load} {
+		if !s.ended || s.err != nil {
+			t.Errorf("span %s ended=%v err=%v", s.name, s.ended, s.err)
+		}
+	}
+}
+
+func TestTracingRecordsErrors(t *testing.T) {
+	tr := &fakeTracer{}
+	SetTracer(tr)
+	defer SetTracer(nil)
+
+	g := NewGroup("tracing-error", 2<<10, "lru", GetterFunc(func(key string) ([]byte, error) {
+		return nil, fmt.Errorf("source down")
+	}))
+	if _, err := g.GetCacheData("k"); err == nil {
+		t.Fatal("expected error")
+	}
+	if span := tr.find("gocache.Get"); span == nil || span.err == nil || !span.ended {
+		t.Errorf("gocache.Get span = %+v, want ended with error", span)
+	}
+}
+
+func TestNoTracer(t *testing.T) {
+	ctx := context.Background()
+	got, span := startSpan(ctx, "x")
+	if got != ctx {
+		t.Error("startSpan without tracer changed the context")
+	}
+	endSpan(span, fmt.Errorf("ignored"))
+}
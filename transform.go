@@ -0,0 +1,59 @@
+package gocache
+
+import "fmt"
+
+// WriteTransform 在数据写入缓存之前对其进行变换，例如压缩、加密、编码
+type WriteTransform func(key string, value []byte) ([]byte, error)
+
+// ReadTransform 在数据从缓存读出之后进行逆变换，例如解压、解密、解码
+type ReadTransform func(key string, value []byte) ([]byte, error)
+
+// Transform 是一对互逆的变换，Read 必须能还原 Write 的结果
+type Transform struct {
+	Name  string // 用于错误信息
+	Write WriteTransform
+	Read  ReadTransform
+}
+
+// WithTransforms 为缓存组设置变换链。写入时按顺序执行 Write，读出时按相反的顺序执行 Read，
+// 例如 WithTransforms(codec, compress, encrypt) 会先编码、再压缩、最后加密。
+// 本地缓存、节点之间传输的都是变换后的数据，只有 GetCacheData 返回给调用者时才还原，
+// 所以同一个缓存组在所有节点上必须配置相同的变换链。
+func WithTransforms(ts ...Transform) GroupOption {
+	return func(g *Group) {
+		g.transforms = append(g.transforms, ts...)
+	}
+}
+
+// encode 依次执行变换链的 Write，得到写入缓存的数据
+func (g *Group) encode(key string, value []byte) ([]byte, error) {
+	var err error
+	for _, t := range g.transforms {
+		if t.Write == nil {
+			continue
+		}
+		if value, err = t.Write(key, value); err != nil {
+			return nil, fmt.Errorf("transform %s write: %v", t.Name, err)
+		}
+	}
+	return value, nil
+}
+
+// decode 逆序执行变换链的 Read，还原缓存中的数据，过期时间保持不变
+func (g *Group) decode(key string, value ByteView) (ByteView, error) {
+	if len(g.transforms) == 0 {
+		return value, nil
+	}
+	b := value.b
+	var err error
+	for i := len(g.transforms) - 1; i >= 0; i-- {
+		t := g.transforms[i]
+		if t.Read == nil {
+			continue
+		}
+		if b, err = t.Read(key, b); err != nil {
+			return ByteView{}, fmt.Errorf("transform %s read: %v", t.Name, err)
+		}
+	}
+	return ByteView{b: b, e: value.e}, nil
+}
@@ -0,0 +1,149 @@
+package gocache
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// WarmProgress 描述了节点加入集群前的预热进度
+type WarmProgress struct {
+	Target   int     // 需要预热的key数量
+	Loaded   int     // 已经加载成功的数量
+	Failed   int     // 加载失败的数量
+	MinRatio float64 // 开始对外提供服务所需的最小预热比例
+	Ready    bool    // 是否已经达到预热要求(或等待超时)，达到后才会注册到etcd
+}
+
+// Ratio 返回已预热的比例，没有需要预热的key时为1
+func (p WarmProgress) Ratio() float64 {
+	if p.Target == 0 {
+		return 1
+	}
+	return float64(p.Loaded) / float64(p.Target)
+}
+
+// warmGate 在新节点预热足够多的热点数据之前，阻止其注册到etcd、接管哈希环上的key，
+// 从而限制节点加入后的未命中高峰
+type warmGate struct {
+	mu       sync.Mutex
+	minRatio float64
+	timeout  time.Duration
+	target   int
+	loaded   int
+	failed   int
+	pending  int           // 启动时还没有完成的准备步骤(从快照恢复、读取启动预热的key列表)，完成之前不会通过
+	ready    chan struct{} // 达到预热要求后关闭
+	closed   bool
+}
+
+// WithWarmGate 要求节点在注册之前，通过 Prefetch 登记的key至少有minRatio的比例加载成功，
+// 最多等待timeout，超时后无论进度如何都会注册，timeout 为0表示一直等待。
+func WithWarmGate(minRatio float64, timeout time.Duration) ServerOption {
+	return func(s *Server) {
+		if minRatio > 0 {
+			s.warm = &warmGate{minRatio: minRatio, timeout: timeout, ready: make(chan struct{})}
+		}
+	}
+}
+
+// progress 返回当前进度，调用时需持有 w.mu
+func (w *warmGate) progress() WarmProgress {
+	return WarmProgress{Target: w.target, Loaded: w.loaded, Failed: w.failed, MinRatio: w.minRatio, Ready: w.closed}
+}
+
+// check 达到预热要求时打开闸门，调用时需持有 w.mu
+func (w *warmGate) check() {
+	if !w.closed && w.pending == 0 && w.progress().Ratio() >= w.minRatio {
+		w.open()
+	}
+}
+
+// open 打开闸门，调用时需持有 w.mu
+func (w *warmGate) open() {
+	if !w.closed {
+		w.closed = true
+		close(w.ready)
+	}
+}
+
+// prepared 完成一个准备步骤，其中登记了n个需要预热的key，w 可以为nil
+func (w *warmGate) prepared(n int) {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	w.pending--
+	w.target += n
+	w.check()
+	w.mu.Unlock()
+}
+
+// wait 等待达到预热要求、超时或者收到停止信号，收到停止信号时返回false，超时时通过logger输出当时的进度
+func (w *warmGate) wait(stop <-chan error, logger Logger) bool {
+	w.mu.Lock()
+	w.check() // 没有登记任何key时直接通过
+	w.mu.Unlock()
+
+	var timeout <-chan time.Time
+	if w.timeout > 0 {
+		timer := time.NewTimer(w.timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case <-w.ready:
+		return true
+	case <-timeout:
+		w.mu.Lock()
+		p := w.progress()
+		w.open()
+		w.mu.Unlock()
+		logger.Warn("warm gate timed out, registering anyway", "ratio", p.Ratio(), "min_ratio", p.MinRatio)
+		return true
+	case <-stop:
+		return false
+	}
+}
+
+// Prefetch 在后台加载一批key，例如从其他节点导出的热点key(见 Scan)，用于新节点加入前的预热。
+// 开启 WithWarmGate 时应当在 Start 之前调用，否则节点可能在登记之前就已经通过了预热检查。
+func (s *Server) Prefetch(group string, keys []string) error {
+	g := GetGroup(group)
+	if g == nil {
+		return fmt.Errorf("group %s not found", group)
+	}
+	w := s.warm
+	if w != nil {
+		w.mu.Lock()
+		w.target += len(keys)
+		w.mu.Unlock()
+	}
+	go func() {
+		for _, key := range keys {
+			_, err := g.GetCacheData(key)
+			if w == nil {
+				continue
+			}
+			w.mu.Lock()
+			if err != nil {
+				w.failed++
+			} else {
+				w.loaded++
+			}
+			w.check()
+			w.mu.Unlock()
+		}
+	}()
+	return nil
+}
+
+// WarmProgress 返回预热进度，没有开启 WithWarmGate 时 Ready 总是为true
+func (s *Server) WarmProgress() WarmProgress {
+	if s.warm == nil {
+		return WarmProgress{Ready: true}
+	}
+	s.warm.mu.Lock()
+	defer s.warm.mu.Unlock()
+	return s.warm.progress()
+}
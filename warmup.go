@@ -0,0 +1,256 @@
+package gocache
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"gocache/consistenthash"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WarmupResult 是一次预热的结果
+type WarmupResult struct {
+	Loaded  int // 加载成功的数量
+	Failed  int // 加载失败的数量
+	Skipped int // 不归本节点所有或者已经在缓存中而跳过的数量
+}
+
+// KeyLister 是 Getter 的可选扩展，列出数据源中值得预热的key，例如按访问量排序的前N个key。
+// 依次对每个key调用fn，fn 返回错误时应停止并返回该错误。见 WithStartupWarmup
+type KeyLister interface {
+	ListKeys(ctx context.Context, fn func(key string) error) error
+}
+
+// KeySource 提供启动预热的key列表，约定与 KeyLister.ListKeys 相同
+type KeySource func(ctx context.Context, fn func(key string) error) error
+
+// KeysFromFile 从文件中读取key列表，每行一个key，忽略空行和以 # 开头的行
+func KeysFromFile(path string) KeySource {
+	return func(ctx context.Context, fn func(key string) error) error {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			key := strings.TrimSpace(scanner.Text())
+			if key == "" || strings.HasPrefix(key, "#") {
+				continue
+			}
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if err := fn(key); err != nil {
+				return err
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		return nil
+	}
+}
+
+// Warmup 用concurrency个协程从数据源加载keys中归本节点所有的key并写入主缓存，归其他节点所有的key和已经缓存的key会被跳过。
+// 同一个key的并发读取与预热会合并为一次加载。ctx 被取消时停止提交新的key，等待进行中的加载完成后返回 ctx 的错误。
+func (g *Group) Warmup(ctx context.Context, keys []string, concurrency int) (WarmupResult, error) {
+	return g.warmup(ctx, keys, concurrency, g.ownsKey, nil)
+}
+
+// ownsKey 返回key是否由本节点从数据源加载
+func (g *Group) ownsKey(key string) bool {
+	_, remote := g.pickPeer(key)
+	return !remote
+}
+
+// warmup 是 Warmup 的实现，owns 判断key是否归本节点所有，每个key加载完成后调用done(可以为nil)
+func (g *Group) warmup(ctx context.Context, keys []string, concurrency int, owns func(string) bool, done func(error)) (WarmupResult, error) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	var (
+		mu  sync.Mutex
+		res WarmupResult
+		wg  sync.WaitGroup
+	)
+	keyc := make(chan string)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for key := range keyc {
+				err := g.warmKey(ctx, key)
+				if err != nil {
+					g.logger.Debug("warmup load failed", "group", g.name, "key", key, "error", err)
+				}
+				mu.Lock()
+				if err != nil {
+					res.Failed++
+				} else {
+					res.Loaded++
+				}
+				mu.Unlock()
+				if done != nil {
+					done(err)
+				}
+			}
+		}()
+	}
+
+feed:
+	for _, key := range keys {
+		skip := key == "" || !owns(key)
+		if !skip {
+			_, skip = g.mainCache.peek(key)
+		}
+		if skip {
+			mu.Lock()
+			res.Skipped++
+			mu.Unlock()
+			if done != nil {
+				done(nil)
+			}
+			continue
+		}
+		select {
+		case keyc <- key:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(keyc)
+	wg.Wait()
+	return res, ctx.Err()
+}
+
+// warmKey 从本地数据源加载key，与并发的读取共用 singleflight
+func (g *Group) warmKey(ctx context.Context, key string) error {
+	_, err, _ := g.loader.Do(key, func() (interface{}, error) {
+		value, err := g.getLocally(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		g.counters.localLoads.Add(1)
+		g.emit(EventLoad, key, value.Len())
+		return loaded{value, GetInfo{Source: SourceLocalLoad, Added: time.Now(), Expire: value.Expire()}}, nil
+	})
+	return err
+}
+
+// startupWarmup 是 WithStartupWarmup 登记的一次启动预热
+type startupWarmup struct {
+	group       string
+	source      KeySource // 为nil时使用缓存组数据源的 KeyLister
+	concurrency int
+}
+
+// WithStartupWarmup 在 Start 时读取source中的key，按启动时的哈希环(包含本节点)加载归本节点所有的key，
+// 避免部署后节点以空缓存接管流量造成的未命中高峰。source 为nil时使用缓存组数据源实现的 KeyLister。
+// 与 WithWarmGate 一起使用时，这些key计入预热进度，读完key列表之前不会注册。
+func WithStartupWarmup(group string, source KeySource, concurrency int) ServerOption {
+	return func(s *Server) {
+		s.warmups = append(s.warmups, startupWarmup{group: group, source: source, concurrency: concurrency})
+	}
+}
+
+// prepare 在后台从快照恢复数据(见 WithSnapshots)，然后执行所有的启动预热，ctx 被取消时停止，调用时需持有 s.mu
+func (s *Server) prepare(ctx context.Context) {
+	steps := len(s.warmups)
+	if s.snapshots != nil {
+		steps++
+	}
+	if steps == 0 {
+		return
+	}
+	if s.warm != nil { // 在预热闸门第一次检查之前登记，这些步骤完成之前不会通过
+		s.warm.mu.Lock()
+		s.warm.pending += steps
+		s.warm.mu.Unlock()
+	}
+	go func() {
+		if s.snapshots != nil {
+			s.snapshots.restore(ctx, s.logger)
+			s.warm.prepared(0)
+		}
+		for _, w := range s.warmups {
+			go s.runWarmup(ctx, w)
+		}
+	}()
+}
+
+// warmupRing 返回启动预热时判断key归属的哈希环。通过服务发现加入时本节点注册之前还不在公共哈希环上，需要加入本节点；
+// 缓存组单独指定的节点集合中没有本节点时，本节点不负责该缓存组的任何key
+func (s *Server) warmupRing(group string) *consistenthash.Map {
+	ring := s.groupRing(group)
+	if s.hasGroupRing(group) {
+		return ring
+	}
+	for _, node := range ring.Nodes() {
+		if node == s.self {
+			return ring
+		}
+	}
+	ring = ring.Clone()
+	ring.Add(s.self)
+	return ring
+}
+
+// runWarmup 读取key列表并预热，进度记录到 s.warm
+func (s *Server) runWarmup(ctx context.Context, w startupWarmup) {
+	gate := s.warm
+	listed := false
+	listDone := func(n int) {
+		if !listed {
+			listed = true
+			gate.prepared(n)
+		}
+	}
+	defer listDone(0)
+
+	g := GetGroup(w.group)
+	if g == nil {
+		s.reportErr(fmt.Errorf("warmup: group %s not found", w.group))
+		return
+	}
+	source := w.source
+	if source == nil {
+		lister, ok := g.getter.(KeyLister)
+		if !ok {
+			s.reportErr(fmt.Errorf("warmup: group %s has no key source and its getter does not implement KeyLister", w.group))
+			return
+		}
+		source = lister.ListKeys
+	}
+	var keys []string
+	if err := source(ctx, func(key string) error {
+		keys = append(keys, key)
+		return nil
+	}); err != nil {
+		s.reportErr(fmt.Errorf("warmup %s: %v", w.group, err))
+		return
+	}
+	listDone(len(keys))
+
+	ring := s.warmupRing(w.group)
+	owns := func(key string) bool { return ring.Get(key) == s.self }
+	start := time.Now()
+	res, err := g.warmup(ctx, keys, w.concurrency, owns, func(err error) {
+		if gate == nil {
+			return
+		}
+		gate.mu.Lock()
+		if err != nil {
+			gate.failed++
+		} else {
+			gate.loaded++
+		}
+		gate.check()
+		gate.mu.Unlock()
+	})
+	s.logger.Info("startup warmup finished", "group", w.group, "loaded", res.Loaded, "failed", res.Failed,
+		"skipped", res.Skipped, "elapsed", time.Since(start), "error", err)
+}
@@ -0,0 +1,101 @@
+package gocache
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// prefixPicker 把以 remote 开头的key分配给远程节点
+type prefixPicker struct{}
+
+func (prefixPicker) PickPeer(key string) (PeerGetter, bool) {
+	return nil, strings.HasPrefix(key, "remote")
+}
+
+func TestGroupWarmup(t *testing.T) {
+	var calls atomic.Int64
+	g := NewGroup("warmup", 2<<10, "lru", GetterFunc(func(key string) ([]byte, error) {
+		calls.Add(1)
+		if key == "bad" {
+			return nil, ErrNotFound
+		}
+		return []byte(key), nil
+	}))
+	g.RegisterPeers(prefixPicker{})
+	g.Set("cached", []byte("v"), 0)
+
+	keys := []string{"a", "b", "c", "bad", "remote-1", "cached", ""}
+	res, err := g.Warmup(context.Background(), keys, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != (WarmupResult{Loaded: 3, Failed: 1, Skipped: 3}) || calls.Load() != 4 {
+		t.Fatalf("unexpected result %+v after %d loads", res, calls.Load())
+	}
+	for _, key := range []string{"a", "b", "c"} {
+		if _, ok := g.mainCache.peek(key); !ok {
+			t.Fatalf("%s not in main cache", key)
+		}
+	}
+
+	// 已经预热的key不再加载
+	if res, _ := g.Warmup(context.Background(), []string{"a", "b"}, 1); res.Skipped != 2 || calls.Load() != 4 {
+		t.Fatalf("expect warm keys to be skipped, got %+v", res)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := g.Warmup(ctx, []string{"d", "e"}, 1); err != context.Canceled {
+		t.Fatalf("expect context.Canceled, got %v", err)
+	}
+}
+
+func TestStartupWarmup(t *testing.T) {
+	g := NewGroup("startup-warmup", 2<<10, "lru", GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}))
+	path := filepath.Join(t.TempDir(), "keys")
+	var content strings.Builder
+	content.WriteString("# hot keys\n\n")
+	for i := 0; i < 100; i++ {
+		fmt.Fprintf(&content, "key-%d\n", i)
+	}
+	os.WriteFile(path, []byte(content.String()), 0o600)
+
+	const self, other = "127.0.0.1:9411", "127.0.0.1:9412"
+	svr, _ := NewServer(self, WithWarmGate(1, 0), WithStartupWarmup("startup-warmup", KeysFromFile(path), 4))
+	svr.Set(self, other)
+	svr.prepare(context.Background())
+	if !svr.warm.wait(make(chan error), svr.logger) {
+		t.Fatal("warm gate should open")
+	}
+	if p := svr.WarmProgress(); p.Target != 100 || p.Loaded != 100 || p.Failed != 0 {
+		t.Fatalf("unexpected progress %+v", p)
+	}
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		if _, cached := g.mainCache.peek(key); cached != (svr.peers.Get(key) == self) {
+			t.Fatalf("%s owned by %s, cached %v", key, svr.peers.Get(key), cached)
+		}
+	}
+
+	// 数据源没有实现 KeyLister 时报告错误并放行预热闸门
+	svr, _ = NewServer("127.0.0.1:9413", WithWarmGate(1, 0), WithStartupWarmup("startup-warmup", nil, 1))
+	svr.prepare(context.Background())
+	if !svr.warm.wait(make(chan error), svr.logger) {
+		t.Fatal("warm gate should open")
+	}
+	select {
+	case err := <-svr.Err():
+		if !strings.Contains(err.Error(), "KeyLister") {
+			t.Fatalf("unexpected error %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expect an error for a group without key source")
+	}
+}